@@ -0,0 +1,995 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/model"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/server"
+)
+
+// commandSpec describes a command for --help and --describe-commands
+type commandSpec struct {
+	Name        string        `json:"name"`
+	Aliases     []string      `json:"aliases,omitempty"`
+	Summary     string        `json:"summary"`
+	Usage       string        `json:"usage"`
+	Args        []argSpec     `json:"args,omitempty"`
+	Flags       []flagSpec    `json:"flags,omitempty"`
+	Subcommands []commandSpec `json:"subcommands,omitempty"`
+	PassThrough bool          `json:"pass_through,omitempty"` // arguments are passed on unparsed, such as a command to run
+	Run         handler       `json:"-"`                      // nil when only the subcommands run
+	Help        func()        `json:"-"`                      // prints more help after the generated help
+}
+
+// handler runs a command with its parsed arguments
+type handler func(store *db.Store, cfg *config.Config, c *invocation) error
+
+// argSpec describes a positional argument
+type argSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Variadic    bool   `json:"variadic,omitempty"` // may be given more than once
+}
+
+// flagSpec describes a flag. Type is bool, string, int, float, duration
+// (e.g. 30m) or size (e.g. 4G).
+type flagSpec struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Values      []string `json:"values,omitempty"`  // the only accepted values, when fixed
+	Default     string   `json:"default,omitempty"` // value used when the flag is absent
+	Repeatable  bool     `json:"repeatable,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+}
+
+// globalFlags are accepted before any command
+var globalFlags = []flagSpec{
+	{Name: "--private", Type: "bool", Description: "Don't write logs, caches or usage data for this command"},
+	{Name: "--keep-alive", Type: "duration", Description: "Stop servers started by this command after this long without requests"},
+	{Name: "--no-evict", Type: "bool", Description: "Fail instead of stopping the least recently used servers when a model doesn't fit in memory_budget"},
+	{Name: "--backend", Type: "string", Description: "Send requests to this backend profile from the config file, or to the in-process mock backend with mock or a mock:// URL"},
+	{Name: "--record", Type: "string", Description: "Save every request made to model servers, with its response, to this .http file for replay"},
+	{Name: "--verbose", Type: "bool", Description: "Also print the HTTP requests made, with their responses, and the commands run"},
+	{Name: "--quiet", Type: "bool", Description: "Print only the command's output and errors, without status messages or progress"},
+	{Name: "--accessible", Type: "bool", Description: "Plain sequential output for screen readers: no box drawing, emoji or progress redrawn in place"},
+	{Name: "--describe-commands", Type: "bool", Description: "Print every command, argument and flag as JSON and exit"},
+}
+
+var slugArg = argSpec{Name: "slug", Description: "Installed model", Required: true}
+
+// commands lists every user-facing command with the function that runs it
+var commands = []commandSpec{
+	{
+		Name:    "pull",
+		Run:     pullCommand,
+		Summary: "Download a new model from Hugging Face. Without --quant, or when it isn't found, lists the repository's GGUF files to pick from; --yes never asks and falls back to Q4_K_M. Interrupted downloads resume when run again.",
+		Usage:   "<model_id> [--quant q4_k_m|q5_k_m|q8_0|iq4_xs|...] [--yes] [--hf-cli]",
+		Args:    []argSpec{{Name: "model_id", Description: "Hugging Face repository, e.g. bartowski/Qwen2.5-7B-Instruct-GGUF", Required: true}},
+		Flags: []flagSpec{
+			{Name: "--quant", Type: "string", Description: "Quantization to download, e.g. q4_k_m"},
+			{Name: "--yes", Type: "bool", Description: "Never ask which file to download"},
+			{Name: "--hf-cli", Type: "bool", Description: "Download with huggingface-cli instead of the built-in downloader"},
+		},
+	},
+	{
+		Name:    "convert",
+		Run:     convertCommand,
+		Summary: "Convert a Hugging Face safetensors model to a quantized GGUF model. Re-run to resume.",
+		Usage:   "<hf_model_id> [--quant q4_k_m] [--keep-staging]",
+		Args:    []argSpec{{Name: "hf_model_id", Description: "Hugging Face repository with safetensors weights", Required: true}},
+		Flags: []flagSpec{
+			{Name: "--quant", Type: "string", Description: "Quantization to produce", Default: "q4_k_m"},
+			{Name: "--keep-staging", Type: "bool", Description: "Keep the downloaded weights and intermediate files"},
+		},
+	},
+	{
+		Name:    "gguf",
+		Summary: "Work with GGUF files.",
+		Usage: "join <first-shard> -o <merged.gguf> | split <file|slug> <output-prefix> [--max-tensors N] [--max-size 4G] | " +
+			"set <file|slug> [--chat-template <file.jinja>] [--name <name>] [--set key=value]... [--unset key]...",
+		Subcommands: []commandSpec{
+			{
+				Name:    "join",
+				Run:     ggufJoinCommand,
+				Summary: "Merge the shards of a split model into one file.",
+				Usage:   "<first-shard> -o <merged.gguf>",
+				Args:    []argSpec{{Name: "first-shard", Description: "First shard of the split model", Required: true}},
+				Flags:   []flagSpec{{Name: "-o", Type: "string", Description: "Merged output file", Required: true}},
+			},
+			{
+				Name:    "split",
+				Run:     ggufSplitCommand,
+				Summary: "Split a model into shards.",
+				Usage:   "<file|slug> <output-prefix> [--max-tensors N] [--max-size 4G]",
+				Args: []argSpec{
+					{Name: "file|slug", Description: "GGUF file or installed model", Required: true},
+					{Name: "output-prefix", Description: "Prefix of the shard files", Required: true},
+				},
+				Flags: []flagSpec{
+					{Name: "--max-tensors", Type: "int", Description: "Most tensors per shard"},
+					{Name: "--max-size", Type: "size", Description: "Largest shard size"},
+				},
+			},
+			{
+				Name:    "set",
+				Run:     ggufSetCommand,
+				Summary: "Change metadata in a GGUF file.",
+				Usage:   "<file|slug> [--chat-template <file.jinja>] [--name <name>] [--set key=value]... [--unset key]...",
+				Args:    []argSpec{{Name: "file|slug", Description: "GGUF file or installed model", Required: true}},
+				Flags: []flagSpec{
+					{Name: "--chat-template", Type: "string", Description: "File holding the new chat template"},
+					{Name: "--name", Type: "string", Description: "New general.name"},
+					{Name: "--set", Type: "string", Description: "Set a metadata key, as key=value", Repeatable: true},
+					{Name: "--unset", Type: "string", Description: "Remove a metadata key", Repeatable: true},
+				},
+			},
+		},
+	},
+	{
+		Name:    "ls",
+		Run:     lsCommand,
+		Aliases: []string{"list"},
+		Summary: "List downloaded models with their parameter count, quantization, size, tags and when they were last used, most recent first. --watch keeps a live view of every model with its server's state, port, memory and active requests.",
+		Usage:   "[--watch] [--tag <tag>]... [--sort used|name|size|params] [--absolute|--relative] [--json|--csv]",
+		Flags: []flagSpec{
+			{Name: "--tag", Type: "string", Description: "Only list models with this tag; repeat to require several", Repeatable: true},
+			{Name: "--sort", Type: "string", Description: "List models by last use, by slug, or largest first by size or parameters", Values: model.ListSorts, Default: "used"},
+			{Name: "--watch", Type: "bool", Description: "Refresh the view in place every 2 seconds until Ctrl-C"},
+			{Name: "--absolute", Type: "bool", Description: "Show when models were last used as a local date and time (the default)"},
+			{Name: "--relative", Type: "bool", Description: "Show when models were last used as e.g. 3h ago"},
+			{Name: "--json", Type: "bool", Description: "Print the models as JSON, with ISO 8601 times in UTC"},
+			{Name: "--csv", Type: "bool", Description: "Print the models as CSV, with ISO 8601 times in UTC"},
+		},
+	},
+	{
+		Name:    "which",
+		Run:     whichCommand,
+		Summary: "Find installed models by slug, model ID, file name, quantization, tags or GGUF metadata (name, architecture, size, fine-tune, tags). Every word must match.",
+		Usage:   "<term>",
+		Args:    []argSpec{{Name: "term", Description: "Words to search for, e.g. \"3b qwen coder\"", Required: true, Variadic: true}},
+	},
+	{
+		Name:    "rm",
+		Run:     rmCommand,
+		Aliases: []string{"remove"},
+		Summary: "Remove a model from the filesystem and database.",
+		Usage:   "<slug>",
+		Args:    []argSpec{slugArg},
+	},
+	{
+		Name:    "du",
+		Run:     duCommand,
+		Summary: "Show the disk space each model uses, largest first, and the total.",
+	},
+	{
+		Name:    "prune",
+		Run:     pruneCommand,
+		Summary: "Remove models not used within a period, after confirmation. Models never used count from when they were added.",
+		Usage:   "--older-than <30d|2w|12h> [--yes]",
+		Flags: []flagSpec{
+			{Name: "--older-than", Type: "duration", Description: "Remove models unused for this long; accepts days (30d) and weeks (2w)", Required: true},
+			{Name: "--yes", Type: "bool", Description: "Don't ask for confirmation"},
+		},
+	},
+	{
+		Name:    "info",
+		Run:     infoCommand,
+		Summary: "Show a model's GGUF metadata: architecture, parameters, context length, quantization, tokenizer and chat template, and the saved versions of its configuration. No server is started.",
+		Usage:   "<slug|file> [--template] [--all]",
+		Args:    []argSpec{{Name: "slug|file", Description: "Installed model or GGUF file", Required: true}},
+		Flags: []flagSpec{
+			{Name: "--template", Type: "bool", Description: "Also print the chat template"},
+			{Name: "--all", Type: "bool", Description: "Also list every metadata key"},
+		},
+	},
+	{
+		Name:    "outdated",
+		Run:     outdatedCommand,
+		Summary: "List installed models whose files have changed on Hugging Face since they were pulled.",
+	},
+	{
+		Name:    "upgrade",
+		Run:     upgradeCommand,
+		Summary: "Re-download models whose files have changed on Hugging Face. The old files are kept until the new ones are verified.",
+		Usage:   "<slug|all>",
+		Args:    []argSpec{{Name: "slug|all", Description: "Installed model, or all to upgrade every model", Required: true}},
+	},
+	{
+		Name:    "verify",
+		Run:     verifyCommand,
+		Summary: "Re-hash installed model files and report corruption. Verifies all models when no slug is given.",
+		Usage:   "[slug...]",
+		Args:    []argSpec{{Name: "slug", Description: "Installed model", Variadic: true}},
+	},
+	{
+		Name:    "unquarantine",
+		Run:     unquarantineCommand,
+		Summary: "Allow a model that kept crashing to be started automatically again.",
+		Usage:   "<slug>",
+		Args:    []argSpec{slugArg},
+	},
+	{
+		Name:    "rename",
+		Run:     renameCommand,
+		Summary: "Rename every model with a slug scheme.",
+		Usage:   "[--scheme <scheme>] [--apply]",
+		Flags: []flagSpec{
+			{Name: "--scheme", Type: "string", Description: "author-model, model-only, short-hash or a template such as {model}-{quant}; defaults to slug_scheme"},
+			{Name: "--apply", Type: "bool", Description: "Rename the models instead of showing what would change"},
+		},
+	},
+	{
+		Name:    "tag",
+		Run:     tagCommand,
+		Summary: "Tag a model, e.g. coding or vision, to find it with ls --tag. Without tags, print the model's tags.",
+		Usage:   "<slug> [--rm] [tag...]",
+		Args: []argSpec{
+			slugArg,
+			{Name: "tag", Description: "Letters and digits, with -, . or _ between them; lowercased", Variadic: true},
+		},
+		Flags: []flagSpec{
+			{Name: "--rm", Type: "bool", Description: "Remove the tags instead"},
+		},
+	},
+	{
+		Name:    "alias",
+		Run:     aliasCommand,
+		Summary: "Create an alias for a model.",
+		Usage:   "<old_slug> <new_slug>",
+		Args: []argSpec{
+			{Name: "old_slug", Description: "Installed model", Required: true},
+			{Name: "new_slug", Description: "New name for the model", Required: true},
+		},
+	},
+	{
+		Name: "relink",
+		Run:  relinkCommand,
+		Summary: "Point a model at a renamed Hugging Face repository, keeping its files, settings and history. " +
+			"A slug generated from the old name is renamed to match.",
+		Usage: "<slug> <new_model_id>",
+		Args: []argSpec{
+			slugArg,
+			{Name: "new_model_id", Description: "The repository's new ID (author/model-name)", Required: true},
+		},
+	},
+	{
+		Name:    "import",
+		Run:     importCommand,
+		Summary: "Import existing models from the filesystem into the database. Refused while servers are running unless --force.",
+		Usage:   "[--force]",
+		Flags:   []flagSpec{{Name: "--force", Type: "bool", Description: "Keep running servers and record them against the imported models"}},
+	},
+	{
+		Name:    "reset",
+		Run:     resetCommand,
+		Summary: "Reset the database and re-import existing models. Refused while servers are running unless --force, and while the daemon runs.",
+		Usage:   "[--force]",
+		Flags:   []flagSpec{{Name: "--force", Type: "bool", Description: "Keep running servers and record them against the re-imported models"}},
+	},
+	{
+		Name:    "purge",
+		Run:     purgeCommand,
+		Summary: "Securely remove stored data: server and daemon logs, the sandbox audit log, sessions, history, index collections, saved prompts, task runs, cached embeddings and usage data. Models and the config file are kept.",
+		Usage:   "--all-data",
+		Flags:   []flagSpec{{Name: "--all-data", Type: "bool", Description: "Confirm removing all stored data", Required: true}},
+	},
+	{
+		Name:    "config",
+		Summary: "Show or change settings in the config file.",
+		Usage:   "show | profiles | set <key> [value] | snapshot <slug> | rollback <slug> [version]  (e.g. set hardware-profile m3-max, set persist.logs false)",
+		Subcommands: []commandSpec{
+			{Name: "show", Run: configShowCommand, Summary: "Show the effective settings."},
+			{Name: "profiles", Run: configProfilesCommand, Summary: "List hardware profiles."},
+			{
+				Name:    "set",
+				Run:     configSetCommand,
+				Summary: "Change a config file key. hardware-profile without a value picks one interactively.",
+				Usage:   "<key> [value]",
+				Args: []argSpec{
+					{Name: "key", Description: "Config key, e.g. persist.logs", Required: true},
+					{Name: "value", Description: "New value"},
+				},
+			},
+			{
+				Name:    "snapshot",
+				Run:     configSnapshotCommand,
+				Summary: "Save a model's server and sampling settings and chat template as a new version.",
+				Usage:   "<slug>",
+				Args:    []argSpec{{Name: "slug", Description: "Installed model", Required: true}},
+			},
+			{
+				Name:    "rollback",
+				Run:     configRollbackCommand,
+				Summary: "Restore a model's settings and chat template to a saved version, the latest by default. 'info <slug>' lists the versions.",
+				Usage:   "<slug> [version]",
+				Args: []argSpec{
+					{Name: "slug", Description: "Installed model", Required: true},
+					{Name: "version", Description: "Saved version to restore"},
+				},
+			},
+		},
+	},
+	{
+		Name:    "sync",
+		Summary: "Back up the config file, sessions, history, model settings and snapshots, and a manifest of the installed models, to a git repository or rclone remote, and copy them to other machines. Model weights, caches and indexes stay local.",
+		Usage:   "setup <remote> [--type git|rclone] | push | pull",
+		Subcommands: []commandSpec{
+			{
+				Name:    "setup",
+				Run:     syncSetupCommand,
+				Summary: "Keep the state in a git repository or rclone remote. name:path is taken as an rclone remote, anything else as a git repository.",
+				Usage:   "<remote> [--type git|rclone]",
+				Args:    []argSpec{{Name: "remote", Description: "Git repository URL or path, or rclone remote, e.g. gdrive:llm-cli", Required: true}},
+				Flags:   []flagSpec{{Name: "--type", Type: "string", Description: "git or rclone, when the remote is ambiguous"}},
+			},
+			{Name: "push", Run: syncPushCommand, Summary: "Copy this machine's state to the remote."},
+			{Name: "pull", Run: syncPullCommand, Summary: "Replace this machine's state with the remote's, keeping machine-local settings and saving the replaced state. Lists synced models that aren't installed."},
+		},
+	},
+	{
+		Name:    "open",
+		Summary: "Open the server logs, the models directory or the config file. A slug opens that model's server log. Files open in $VISUAL or $EDITOR when set.",
+		Usage:   "logs [slug] | models | config",
+		Subcommands: []commandSpec{
+			{Name: "logs", Run: openLogsCommand, Summary: "Open the log directory, or a model's server log.", Usage: "[slug]", Args: []argSpec{{Name: "slug", Description: "Installed model"}}},
+			{Name: "models", Run: openModelsCommand, Summary: "Open the models directory."},
+			{Name: "config", Run: openConfigCommand, Summary: "Open the config file, creating it if needed."},
+		},
+	},
+	{
+		Name:    "secrets",
+		Summary: "Store API keys and tokens in the OS keychain.",
+		Usage:   "ls | set <name> | rm <name>",
+		Subcommands: []commandSpec{
+			{Name: "ls", Run: secretsListCommand, Aliases: []string{"list"}, Summary: "List stored secrets."},
+			{Name: "set", Run: secretsSetCommand, Summary: "Store a secret, read from the terminal or stdin.", Usage: "<name>", Args: []argSpec{{Name: "name", Description: "Secret name, e.g. hf-token", Required: true}}},
+			{Name: "rm", Run: secretsRemoveCommand, Aliases: []string{"remove"}, Summary: "Remove a secret.", Usage: "<name>", Args: []argSpec{{Name: "name", Description: "Secret name", Required: true}}},
+		},
+	},
+	{
+		Name:    "login",
+		Run:     loginCommand,
+		Summary: "Check a Hugging Face token and store it in the OS keychain, for gated and private models. Reads the token from stdin when piped.",
+	},
+	{
+		Name:    "logout",
+		Run:     logoutCommand,
+		Summary: "Remove the stored Hugging Face token.",
+	},
+	{
+		Name:    "sandbox",
+		Summary: "Run a command under the tool sandbox policy, or show the audit log.",
+		Usage:   "run -- <command> [args...] | audit",
+		Subcommands: []commandSpec{
+			{
+				Name:    "run",
+				Run:     sandboxRunCommand,
+				Summary: "Run a command under the sandbox policy.",
+				Usage:   "-- <command> [args...]",
+				Args: []argSpec{
+					{Name: "command", Description: "Command to run", Required: true},
+					{Name: "args", Description: "Arguments of the command", Variadic: true},
+				},
+				PassThrough: true,
+			},
+			{Name: "audit", Run: sandboxAuditCommand, Summary: "Show the most recent sandboxed commands."},
+		},
+	},
+	{
+		Name:    "tasks",
+		Summary: "Manage scheduled tasks defined in the config file.",
+		Usage:   "ls | run-now <name> | run-due",
+		Subcommands: []commandSpec{
+			{Name: "ls", Run: tasksListCommand, Aliases: []string{"list"}, Summary: "List tasks and when they run next."},
+			{Name: "run-now", Run: tasksRunNowCommand, Summary: "Run a task immediately.", Usage: "<name>", Args: []argSpec{{Name: "name", Description: "Task name", Required: true}}},
+			{Name: "run-due", Run: tasksRunDueCommand, Summary: "Run every task that is due."},
+		},
+	},
+	{
+		Name:    "set",
+		Run:     setCommand,
+		Help:    printSamplingPresets,
+		Summary: "Show or change per-model server and sampling settings (e.g. ctx 8192, ngl 99, temperature 0.2, mirostat 2).",
+		Usage:   "<slug> [<key> <value> | --unset <key> | --preset <name>]",
+		Args: []argSpec{
+			slugArg,
+			{Name: "key", Description: "Setting to change"},
+			{Name: "value", Description: "New value of the setting"},
+		},
+		Flags: []flagSpec{
+			{Name: "--unset", Type: "string", Description: "Remove a setting"},
+			{Name: "--preset", Type: "string", Description: "Apply a sampling preset", Values: presetNames()},
+		},
+	},
+	{
+		Name:    "ctx",
+		Run:     ctxCommand,
+		Summary: "Show or set a model's context size and RoPE scaling, checked against its trained context.",
+		Usage: "<slug> [--ctx-size N] [--rope-scaling none|linear|yarn] [--rope-scale F] [--rope-freq-base F] [--rope-freq-scale F] " +
+			"[--yarn-orig-ctx N] [--yarn-ext-factor F] [--yarn-attn-factor F] [--yarn-beta-slow F] [--yarn-beta-fast F] [--reset]",
+		Args: []argSpec{slugArg},
+		Flags: append(settingFlags(server.ContextSettings, false),
+			flagSpec{Name: "--reset", Type: "bool", Description: "Remove every context setting"}),
+	},
+	{
+		Name:    "tune",
+		Run:     tuneCommand,
+		Summary: "Benchmark a model across a grid of server settings and recommend the fastest.",
+		Usage:   "<slug> --grid \"ctx=4096,8192;ngl=0,32,99\" [--n-predict 128] [--max-mem 24G] [--apply]",
+		Args:    []argSpec{slugArg},
+		Flags: []flagSpec{
+			{Name: "--grid", Type: "string", Description: "Settings to try, e.g. ctx=4096,8192;ngl=0,32,99", Required: true},
+			{Name: "--n-predict", Type: "int", Description: "Tokens to generate per run", Default: "128"},
+			{Name: "--max-mem", Type: "size", Description: "Don't recommend combinations using more memory"},
+			{Name: "--apply", Type: "bool", Description: "Save the fastest settings for the model"},
+		},
+	},
+	{
+		Name: "bench",
+		Run:  benchCommand,
+		Summary: "Measure prompt evaluation and generation speed, time to first token and memory use of a model " +
+			"for every combination of prompt and generation length, and record the results. " +
+			"Server flags restart the server with those settings for the run. " +
+			"'bench results' compares the recorded results of models and settings.",
+		Usage: "<slug> [--prompt-tokens 128,512,2048] [--n-predict 64,256] [--repeat N] [server flags] | results [slug...]",
+		Args:  []argSpec{slugArg},
+		Flags: append([]flagSpec{
+			{Name: "--prompt-tokens", Type: "string", Description: "Comma-separated prompt lengths in tokens", Default: "128,512,2048"},
+			{Name: "--n-predict", Type: "string", Description: "Comma-separated numbers of tokens to generate", Default: "64,256"},
+			{Name: "--repeat", Type: "int", Description: "Runs averaged per workload", Default: "1"},
+		}, serverFlags()...),
+		Subcommands: []commandSpec{
+			{Name: "results", Run: benchResultsCommand, Summary: "List recorded results by workload, fastest generation first.", Usage: "[slug...]",
+				Args: []argSpec{{Name: "slug", Description: "Only show results of these models", Variadic: true}}},
+		},
+	},
+	{
+		Name: "run",
+		Run:  runCommand,
+		Help: printOutputFilters,
+		Summary: "Run a model server and optionally complete text. Piped input is appended to the text. " +
+			"The completion streams as it is generated, followed by its speed on stderr; --no-stream prints it at the end. " +
+			"Server flags restart the server with those settings; defaults come from 'set' and the config file. " +
+			"--post filters the output through a comma-separated list of filters or named pipelines; " +
+			"--extract code|json keeps only the first code block or JSON value; filters imply --no-stream. " +
+			"--auto-continue N continues output cut off by the n_predict limit up to N times. " +
+			"--ocr reads the text of an image with tesseract and appends it to the text. " +
+			"--json-schema and --grammar constrain the completion to JSON the schema accepts or to a GBNF grammar. " +
+			"--format json asks for JSON, retries replies that don't parse and prints only the JSON, with messages on stderr. " +
+			"--prompt runs a saved prompt template, filled in with --var; the text and piped input become its input variable.",
+		Usage: "<slug> [text] [--prompt <name> [--var key=value]...] [--ngl N] [--ctx N] [--threads N] [--batch N] [--parallel N] [--flash-attn] [--post <filters>] [--extract code|json] [--auto-continue N] [--no-stream] [--ocr <image> [--ocr-lang eng]] [--json-schema <schema.json> | --grammar <file.gbnf>] [--format json [--retries N]]",
+		Args: []argSpec{
+			slugArg,
+			{Name: "text", Description: "Text to complete; piped input is appended", Variadic: true},
+		},
+		Flags: append([]flagSpec{
+			{Name: "--post", Type: "string", Description: "Comma-separated output filters or named pipelines"},
+			{Name: "--extract", Type: "string", Description: "Keep only the first code block or JSON value", Values: []string{"code", "json"}},
+			{Name: "--auto-continue", Type: "int", Description: "Continue output cut off by the n_predict limit up to this many times", Default: "0"},
+			{Name: "--no-stream", Type: "bool", Description: "Print the completion once it is complete, without statistics"},
+			{Name: "--ocr", Type: "string", Description: "Image whose text, read by tesseract, is appended to the text"},
+			{Name: "--ocr-lang", Type: "string", Description: "Tesseract languages of the image, e.g. eng+deu"},
+			{Name: "--json-schema", Type: "string", Description: "JSON schema file the completion must match; converted to a grammar"},
+			{Name: "--grammar", Type: "string", Description: "GBNF grammar file the completion must match"},
+			{Name: "--format", Type: "string", Description: "Reply format; json validates and prints only the JSON", Values: []string{"text", "json"}, Default: "text"},
+			{Name: "--retries", Type: "int", Description: "Times a reply that isn't valid JSON is asked for again", Default: "2"},
+			{Name: "--prompt", Type: "string", Description: "Saved prompt template to run; 'prompt ls' lists them"},
+			{Name: "--var", Type: "string", Description: "Value of a variable of the prompt template, as key=value", Repeatable: true},
+		}, serverFlags()...),
+	},
+	{
+		Name:    "prompt",
+		Aliases: []string{"prompts"},
+		Summary: "Keep a library of reusable prompt templates, run with 'run <slug> --prompt <name> --var key=value'. Templates use Go text/template syntax; {{.input}} is filled in by --var input=... or by the text and piped input of run.",
+		Usage:   "save <name> [template] | ls | show <name> | rm <name>",
+		Subcommands: []commandSpec{
+			{
+				Name:    "save",
+				Run:     promptSaveCommand,
+				Summary: "Save a prompt template, read from stdin when not given, replacing any saved under the name.",
+				Usage:   "<name> [template]",
+				Args: []argSpec{
+					{Name: "name", Description: "Prompt name, e.g. review", Required: true},
+					{Name: "template", Description: "Template, e.g. \"Review this code:\n{{.input}}\"", Variadic: true},
+				},
+			},
+			{Name: "ls", Run: promptListCommand, Aliases: []string{"list"}, Summary: "List saved prompts with their variables."},
+			{Name: "show", Run: promptShowCommand, Summary: "Print a saved prompt's template.", Usage: "<name>", Args: []argSpec{{Name: "name", Description: "Prompt name", Required: true}}},
+			{Name: "rm", Run: promptRemoveCommand, Aliases: []string{"remove"}, Summary: "Remove a saved prompt.", Usage: "<name>", Args: []argSpec{{Name: "name", Description: "Prompt name", Required: true}}},
+		},
+	},
+	{
+		Name: "replay",
+		Run:  replayCommand,
+		Summary: "Send the requests saved with --record again and compare each response with the recorded one, " +
+			"to find what changed between models, servers or settings.",
+		Usage: "<file.http> [--model <slug>]",
+		Args:  []argSpec{{Name: "file.http", Description: "Recording made with --record", Required: true}},
+		Flags: []flagSpec{
+			{Name: "--model", Type: "string", Description: "Send the requests to this model's server, started if needed, instead of the one they were recorded from"},
+		},
+	},
+	{
+		Name: "compare",
+		Run:  compareCommand,
+		Summary: "Send the same prompt to two or more models and show the replies side by side with their token counts and timing. " +
+			"Piped input is appended to the prompt. Narrow terminals and accessibility mode show the replies one after another.",
+		Usage: "<slug> <slug> [slug...] <prompt> [--parallel]",
+		Args: []argSpec{
+			{Name: "slug", Description: "Installed models to compare", Required: true, Variadic: true},
+			{Name: "prompt", Description: "Message sent to every model", Required: true},
+		},
+		Flags: []flagSpec{
+			{Name: "--parallel", Type: "bool", Description: "Ask every model at once, each on its own server, instead of one at a time"},
+		},
+	},
+	{
+		Name:    "chat",
+		Run:     chatCommand,
+		Summary: "Start a chat session with the specified model. Type /help in the chat for its commands: /system, /clear, /save, /model, /edit, /retry, /continue, /tokens and /export. Alt-Enter or a \"\"\" block enters several lines.",
+		Usage:   "<slug> [--session <name>] [--compact] [--show-thinking] [--footer] [--rag <collection[,collection...]> [--top N] [--require-citations]] [--tools] [--format json [--retries N]] [--ping <duration>] [--export <file>]",
+		Args:    []argSpec{slugArg},
+		Flags: []flagSpec{
+			{Name: "--session", Type: "string", Description: "Save the conversation under this name, resuming it if it exists"},
+			{Name: "--compact", Type: "bool", Description: "No separators or blank lines between turns"},
+			{Name: "--show-thinking", Type: "bool", Description: "Show reasoning blocks instead of hiding them"},
+			{Name: "--footer", Type: "bool", Description: "Show token counts and speed after each reply"},
+			{Name: "--rag", Type: "string", Description: "Answer each message from the closest chunks of these index collections, citing them"},
+			{Name: "--top", Type: "int", Description: "Chunks retrieved per message with --rag", Default: "4"},
+			{Name: "--require-citations", Type: "bool", Description: "Ask again, up to twice, when a reply with --rag cites none of its sources"},
+			{Name: "--tools", Type: "bool", Description: "Let the model run the sandbox's allowed commands, up to 5 per message, before it answers"},
+			{Name: "--format", Type: "string", Description: "Reply format; json asks for JSON replies and retries ones that don't parse", Values: []string{"text", "json"}, Default: "text"},
+			{Name: "--retries", Type: "int", Description: "Times a reply that isn't valid JSON is asked for again", Default: "2"},
+			{Name: "--ping", Type: "duration", Description: "Health-check the server this often while idle so it isn't stopped; defaults to chat.ping"},
+			{Name: "--export", Type: "string", Description: "Write the conversation to this .md, .json or .html file when the chat ends"},
+		},
+	},
+	{
+		Name:    "sessions",
+		Aliases: []string{"session"},
+		Summary: "Manage saved chat sessions.",
+		Usage:   "ls | search <query> [--limit N] | export <name|--all> [--format html|markdown|json|openai|sharegpt] [--self-contained] [-o <file>] | import <file> --format openai|sharegpt [--model <slug>]",
+		Subcommands: []commandSpec{
+			{Name: "ls", Run: sessionsListCommand, Aliases: []string{"list"}, Summary: "List saved sessions."},
+			{
+				Name:    "search",
+				Run:     sessionsSearchCommand,
+				Summary: "Search the messages of saved sessions.",
+				Usage:   "<query> [--limit N]",
+				Args:    []argSpec{{Name: "query", Description: "Words to search for", Required: true, Variadic: true}},
+				Flags:   []flagSpec{{Name: "--limit", Type: "int", Description: "Most results to show", Default: "20"}},
+			},
+			{
+				Name:    "export",
+				Run:     sessionsExportCommand,
+				Summary: "Export a session, or every session for fine-tuning.",
+				Usage:   "<name|--all> [--format html|markdown|json|openai|sharegpt] [--self-contained] [-o <file>]",
+				Args:    []argSpec{{Name: "name", Description: "Session to export; omit with --all"}},
+				Flags: []flagSpec{
+					{Name: "--all", Type: "bool", Description: "Export every session; requires --format openai or sharegpt"},
+					{Name: "--format", Type: "string", Description: "Output format; defaults to the one the -o file's extension names (.md, .json, .html), or html", Values: []string{"html", "markdown", "json", "openai", "sharegpt"}},
+					{Name: "--self-contained", Type: "bool", Description: "Don't load syntax highlighting from a CDN"},
+					{Name: "-o", Type: "string", Description: "Output file"},
+				},
+			},
+			{
+				Name:    "import",
+				Run:     sessionsImportCommand,
+				Summary: "Import conversations as sessions.",
+				Usage:   "<file> --format openai|sharegpt [--model <slug>]",
+				Args:    []argSpec{{Name: "file", Description: "JSONL file of conversations", Required: true}},
+				Flags: []flagSpec{
+					{Name: "--format", Type: "string", Description: "Input format", Values: []string{"openai", "sharegpt"}, Required: true},
+					{Name: "--model", Type: "string", Description: "Model to record for the imported sessions"},
+				},
+			},
+		},
+	},
+	{
+		Name: "embed",
+		Run:  embedCommand,
+		Summary: "Generate embeddings for the given text, or for piped input. " +
+			"--file embeds every line of a file (or every string or {\"text\", \"id\"} object of a .jsonl file) in batches " +
+			"and writes the vectors as JSONL or CSV.",
+		Usage: "<slug> [text] [--summary|--raw] | <slug> --file <texts> [--format jsonl|csv] [-o <file>] [--batch-size N]",
+		Args: []argSpec{
+			slugArg,
+			{Name: "text", Description: "Text to embed; piped input is used when omitted", Variadic: true},
+		},
+		Flags: []flagSpec{
+			{Name: "--summary", Type: "bool", Description: "Print a summary instead of the full vector"},
+			{Name: "--raw", Type: "bool", Description: "Print the server's response unchanged"},
+			{Name: "--file", Type: "string", Description: "Text or JSONL file of inputs to embed"},
+			{Name: "--format", Type: "string", Description: "Output format for --file: jsonl or csv", Default: "jsonl"},
+			{Name: "-o", Type: "string", Description: "File to write --file vectors to; stdout when omitted"},
+			{Name: "--batch-size", Type: "int", Description: "Inputs sent per request with --file", Default: "32"},
+		},
+	},
+	{
+		Name: "batch",
+		Run:  batchCommand,
+		Summary: "Complete every prompt of a JSONL file, several at a time, and write the results as JSONL. " +
+			"Each line is a JSON string or an object with \"prompt\" and an optional \"id\".",
+		Usage: "<slug> --input <prompts.jsonl> --output <results.jsonl> [--concurrency N]",
+		Args:  []argSpec{slugArg},
+		Flags: []flagSpec{
+			{Name: "--input", Type: "string", Description: "JSONL file of prompts", Required: true},
+			{Name: "--output", Type: "string", Description: "JSONL file to write results to", Required: true},
+			{Name: "--concurrency", Type: "int", Description: "Requests in flight; defaults to the server's parallel slots"},
+		},
+	},
+	{
+		Name:    "nearest",
+		Run:     nearestCommand,
+		Summary: "Rank the lines of a file by similarity to a query.",
+		Usage:   "<slug> --query <text> --candidates <file> [--top N]",
+		Args:    []argSpec{slugArg},
+		Flags: []flagSpec{
+			{Name: "--query", Type: "string", Description: "Text to compare against", Required: true},
+			{Name: "--candidates", Type: "string", Description: "File with one candidate per line", Required: true},
+			{Name: "--top", Type: "int", Description: "Number of results to show", Default: "5"},
+		},
+	},
+	{
+		Name: "bench-embed",
+		Run:  benchEmbedCommand,
+		Summary: "Compare embedding models by recall@k and MRR on a TSV file of \"query<TAB>relevant passage\" lines. " +
+			"--corpus adds distractor passages, one per line.",
+		Usage: "--models <a,b,...> --dataset <file> [--corpus <file>] [--k N]",
+		Flags: []flagSpec{
+			{Name: "--models", Type: "string", Description: "Comma-separated model slugs", Required: true},
+			{Name: "--dataset", Type: "string", Description: "TSV file of queries and relevant passages", Required: true},
+			{Name: "--corpus", Type: "string", Description: "File of distractor passages, one per line"},
+			{Name: "--k", Type: "int", Description: "Cutoff for recall@k", Default: "5"},
+		},
+	},
+	{
+		Name:    "index",
+		Summary: "Keep a local vector store of embedded files and search it by meaning.",
+		Usage:   "<add|query|inspect|watch|ls|rm> ...",
+		Subcommands: []commandSpec{
+			{
+				Name:    "add",
+				Run:     indexAddCommand,
+				Summary: "Chunk, embed and store files and directories. Unchanged files are skipped.",
+				Usage:   "<collection> <files...> [--model <slug>] [--chunk-size N]",
+				Args: []argSpec{
+					{Name: "collection", Description: "Collection name", Required: true},
+					{Name: "files", Description: "Files or directories to index", Required: true, Variadic: true},
+				},
+				Flags: []flagSpec{
+					{Name: "--model", Type: "string", Description: "Embedding model; required when creating the collection"},
+					{Name: "--chunk-size", Type: "int", Description: "Characters per chunk", Default: "1000"},
+				},
+			},
+			{
+				Name:    "query",
+				Run:     indexQueryCommand,
+				Summary: "Show the chunks closest to a question, or a model's answer from them with the sources it cites.",
+				Usage:   "<collection[,collection...]> <question> [--top N] [--model <slug> [--require-citations]] [--json]",
+				Args: []argSpec{
+					{Name: "collection", Description: "Collection, or comma-separated collections", Required: true},
+					{Name: "question", Description: "Text to search for", Required: true, Variadic: true},
+				},
+				Flags: []flagSpec{
+					{Name: "--top", Type: "int", Description: "Number of chunks to show, or to answer from", Default: "5"},
+					{Name: "--model", Type: "string", Description: "Answer the question with this model from the chunks, citing them"},
+					{Name: "--require-citations", Type: "bool", Description: "Ask the model again, up to twice, when its answer cites none of the chunks"},
+					{Name: "--json", Type: "bool", Description: "Write the chunks, or the answer and its sources, as JSON"},
+				},
+			},
+			{
+				Name:    "inspect",
+				Run:     indexInspectCommand,
+				Summary: "Show how a file was chunked, with each chunk's lines, tokens and overlap, and with --query which chunks match a question.",
+				Usage:   "<collection> --file <path> [--query <question>] [--top N] [--json]",
+				Args:    []argSpec{{Name: "collection", Description: "Collection name", Required: true}},
+				Flags: []flagSpec{
+					{Name: "--file", Type: "string", Description: "Indexed file to show the chunks of", Required: true},
+					{Name: "--query", Type: "string", Description: "Question to score the chunks against"},
+					{Name: "--top", Type: "int", Description: "Number of the collection's closest chunks that count as matches", Default: "5"},
+					{Name: "--json", Type: "bool", Description: "Write the chunks as JSON"},
+				},
+			},
+			{
+				Name:    "watch",
+				Run:     indexWatchCommand,
+				Summary: "Keep a collection up to date: embed files again as they change, add new ones and drop removed ones, until interrupted.",
+				Usage:   "<collection> [files...] [--interval <duration>]",
+				Args: []argSpec{
+					{Name: "collection", Description: "Collection name", Required: true},
+					{Name: "files", Description: "Files or directories to watch; defaults to the directories of the indexed files", Variadic: true},
+				},
+				Flags: []flagSpec{
+					{Name: "--interval", Type: "duration", Description: "How often to look for changes", Default: "5s"},
+				},
+			},
+			{Name: "ls", Run: indexListCommand, Aliases: []string{"list"}, Summary: "List collections."},
+			{
+				Name:    "rm",
+				Run:     indexRemoveCommand,
+				Aliases: []string{"remove"},
+				Summary: "Delete a collection.",
+				Usage:   "<collection>",
+				Args:    []argSpec{{Name: "collection", Description: "Collection name", Required: true}},
+			},
+		},
+	},
+	{
+		Name:    "mail",
+		Summary: "Summarize or draft a reply to an email read from stdin (e.g. piped from mutt or procmail).",
+		Usage:   "<summarize|reply> <slug>",
+		Subcommands: []commandSpec{
+			{Name: "summarize", Run: mailSummarizeCommand, Summary: "Summarize the email.", Usage: "<slug>", Args: []argSpec{slugArg}},
+			{Name: "reply", Run: mailReplyCommand, Summary: "Draft a reply to the email.", Usage: "<slug>", Args: []argSpec{slugArg}},
+		},
+	},
+	{
+		Name:    "dataset",
+		Summary: "Generate instruction/response pairs for fine-tuning from seed prompts.",
+		Usage:   "generate --model <slug> --seed-prompts <file> [--n 100] [-o data.jsonl] [--judge <slug>] [--min-score 7] [--format alpaca|openai|sharegpt]",
+		Subcommands: []commandSpec{
+			{
+				Name:    "generate",
+				Run:     datasetGenerateCommand,
+				Summary: "Generate a dataset.",
+				Usage:   "--model <slug> --seed-prompts <file> [--n 100] [-o data.jsonl] [--judge <slug>] [--min-score 7] [--format alpaca|openai|sharegpt]",
+				Flags: []flagSpec{
+					{Name: "--model", Type: "string", Description: "Model that writes the pairs", Required: true},
+					{Name: "--seed-prompts", Type: "string", Description: "File of seed prompts", Required: true},
+					{Name: "--n", Type: "int", Description: "Number of pairs", Default: "100"},
+					{Name: "-o", Type: "string", Description: "Output file", Default: "data.jsonl"},
+					{Name: "--judge", Type: "string", Description: "Model that scores the pairs"},
+					{Name: "--min-score", Type: "int", Description: "Lowest judge score kept, 1 to 10", Default: "7"},
+					{Name: "--format", Type: "string", Description: "Output format", Values: []string{"alpaca", "openai", "sharegpt"}},
+				},
+			},
+		},
+	},
+	{
+		Name:    "tokenize",
+		Run:     tokenizeCommand,
+		Summary: "Tokenize text using the specified model.",
+		Usage:   "<slug> <text>",
+		Args:    []argSpec{slugArg, {Name: "text", Description: "Text to tokenize", Required: true, Variadic: true}},
+	},
+	{
+		Name:    "detokenize",
+		Run:     detokenizeCommand,
+		Summary: "Detokenize tokens using the specified model.",
+		Usage:   "<slug> <tokens>",
+		Args:    []argSpec{slugArg, {Name: "tokens", Description: "Token IDs", Required: true, Variadic: true}},
+	},
+	{
+		Name: "health",
+		Run:  healthCommand,
+		Summary: "Check the health status of the running server, or of a model's server. " +
+			"--all checks every running server at once, and the models of the stack 'llm-cli up' started, reporting each one's status, port, uptime and last error; it fails if any isn't healthy.",
+		Usage: "[slug] | --all [--json]",
+		Args:  []argSpec{{Name: "slug", Description: "Installed model"}},
+		Flags: []flagSpec{
+			{Name: "--all", Type: "bool", Description: "Check every running server"},
+			{Name: "--json", Type: "bool", Description: "With --all, print one JSON document for monitoring"},
+		},
+	},
+	{
+		Name:    "props",
+		Run:     propsCommand,
+		Summary: "Get the properties of the running server, or of a model's server.",
+		Usage:   "[slug]",
+		Args:    []argSpec{{Name: "slug", Description: "Installed model"}},
+	},
+	{
+		Name: "daemon",
+		Summary: "Run a background supervisor that owns model servers, restarts them when they crash " +
+			"and stops them when idle. 'run' serves in the foreground.",
+		Usage: "start | stop | status | run",
+		Subcommands: []commandSpec{
+			{Name: "start", Run: daemonStartCommand, Summary: "Start the daemon in the background."},
+			{Name: "stop", Run: daemonStopCommand, Summary: "Stop the daemon and its servers."},
+			{Name: "status", Run: daemonStatusCommand, Summary: "Show the daemon's servers with uptime, idle time and restarts."},
+			{Name: "run", Run: daemonRunCommand, Summary: "Run the daemon in the foreground."},
+		},
+	},
+	{
+		Name:    "warmup",
+		Run:     warmupCommand,
+		Summary: "Start model servers ahead of use, one at a time, skipping models that would exceed the memory budget. The daemon warms up the starred models from the config file when it starts.",
+		Usage:   "<slug...> | --all-starred",
+		Args:    []argSpec{{Name: "slug", Description: "Installed model", Variadic: true}},
+		Flags:   []flagSpec{{Name: "--all-starred", Type: "bool", Description: "Warm up every model listed under starred in the config file"}},
+	},
+	{
+		Name: "up",
+		Run:  upCommand,
+		Summary: "Start the model servers declared in a stack file, with their ports, keep-alive and llama-server settings. " +
+			"Running again after editing the file restarts the servers whose declaration changed and stops those no longer listed.",
+		Usage: "[stack.yaml] [--prune]",
+		Args:  []argSpec{{Name: "file", Description: "Stack file to read; stack.yaml in the current directory by default"}},
+		Flags: []flagSpec{{Name: "--prune", Type: "bool", Description: "Also stop running servers the stack didn't start"}},
+	},
+	{
+		Name:    "down",
+		Run:     downCommand,
+		Summary: "Stop the model servers the last 'llm-cli up' started.",
+	},
+	{
+		Name:    "ps",
+		Run:     psCommand,
+		Summary: "Show running llama-server processes. --watch keeps a live view of them with their memory and active requests.",
+		Usage:   "[--watch]",
+		Flags:   []flagSpec{{Name: "--watch", Type: "bool", Description: "Refresh the view in place every 2 seconds until Ctrl-C"}},
+	},
+	{
+		Name:    "logs",
+		Run:     logsCommand,
+		Summary: "Print a model's server log: that of its running server, or else the one its last server wrote.",
+		Usage:   "<slug> [-f] [--tail 200]",
+		Args:    []argSpec{slugArg},
+		Flags: []flagSpec{
+			{Name: "--follow", Aliases: []string{"-f"}, Type: "bool", Description: "Keep printing new output until Ctrl-C, following the server across restarts"},
+			{Name: "--tail", Type: "int", Description: "Lines to print from the end; 0 prints the whole log", Default: "200"},
+		},
+	},
+	{
+		Name: "serve",
+		Run:  serveCommand,
+		Summary: "Serve an OpenAI-compatible API (/v1/chat/completions, /v1/completions, /v1/embeddings and /v1/models) for the installed models. " +
+			"The model field names a slug; its server is started on first use and responses, streamed or not, are passed back. " +
+			"--auth basic requires the proxy-api-key secret with every request, as a bearer token or basic auth password; --auth oidc signs browsers in with the serve.oidc provider. " +
+			"--ui also serves a chat page at /. " +
+			"GET /healthz reports the health of every server as health --all --json does, answering 503 when any isn't healthy. " +
+			"--tailscale listens only on this machine's Tailscale address, sharing the models with your other devices on the tailnet.",
+		Usage: "[--port 8080] [--host 127.0.0.1 | --tailscale [--tailscale-serve]] [--auth none|basic|oidc] [--ui]",
+		Flags: []flagSpec{
+			{Name: "--port", Type: "int", Description: "Port to listen on", Default: "8080"},
+			{Name: "--host", Type: "string", Description: "Address to listen on; 0.0.0.0 serves other machines too", Default: "127.0.0.1"},
+			{Name: "--auth", Type: "string", Description: "Require the proxy-api-key secret with every request, or with oidc a sign-in or the key", Values: []string{"none", "basic", "oidc"}, Default: "none"},
+			{Name: "--ui", Type: "bool", Description: "Serve a chat page for the models at /"},
+			{Name: "--tailscale", Type: "bool", Description: "Listen on the Tailscale address instead of --host"},
+			{Name: "--tailscale-serve", Type: "bool", Description: "Also serve over HTTPS at this machine's tailnet name with Tailscale Serve; implies --tailscale"},
+		},
+	},
+	{
+		Name: "metrics",
+		Run:  metricsCommand,
+		Summary: "Print the installed models and the memory, context size and use, and active requests of their running servers in the Prometheus text format, " +
+			"labelled by slug, quantization and llama-server build. The daemon also serves them at /metrics on its socket.",
+		Usage: "[--output <file>]",
+		Flags: []flagSpec{{Name: "--output", Type: "string", Description: "Write to this file instead, replacing it in one step, e.g. for node_exporter's textfile collector"}},
+	},
+	{
+		Name:    "kill",
+		Run:     killCommand,
+		Aliases: []string{"stop"},
+		Summary: "Kill a model server or all servers.",
+		Usage:   "<slug|all>",
+		Args:    []argSpec{{Name: "slug|all", Description: "Installed model, or all to stop every server", Required: true}},
+	},
+	{
+		Name:    "search",
+		Run:     searchCommand,
+		Summary: "Search Hugging Face for GGUF models, showing the size of each quantization.",
+		Usage:   "<query> [--author <name>] [--sort downloads|likes|modified] [--limit N] [--page N]",
+		Args:    []argSpec{{Name: "query", Description: "Words to search for; may be left out with --author", Variadic: true}},
+		Flags: []flagSpec{
+			{Name: "--author", Type: "string", Description: "Only models from this user or organization"},
+			{Name: "--sort", Type: "string", Description: "Result order", Values: []string{"downloads", "likes", "modified"}, Default: "downloads"},
+			{Name: "--limit", Type: "int", Description: "Results per page", Default: "10"},
+			{Name: "--page", Type: "int", Description: "Page of results", Default: "1"},
+		},
+	},
+	{
+		Name:    "recent",
+		Run:     recentCommand,
+		Summary: "Get the 20 most recent GGUF models from Hugging Face.",
+	},
+	{
+		Name:    "trending",
+		Run:     trendingCommand,
+		Summary: "Get trending GGUF models from Hugging Face.",
+	},
+}
+
+// settingFlags describes the flags of the named settings, with their short
+// aliases when the command accepts them
+func settingFlags(names []string, aliases bool) []flagSpec {
+	var flags []flagSpec
+	for _, name := range names {
+		for _, setting := range server.Settings {
+			if setting.Name == name {
+				flag := flagSpec{
+					Name:        "--" + setting.Name,
+					Type:        setting.Kind,
+					Description: fmt.Sprintf("llama-server --%s", setting.Name),
+				}
+				if aliases {
+					flag.Aliases = setting.Flags()[1:]
+				}
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags
+}
+
+// serverFlags describes the llama-server setting flags run accepts
+func serverFlags() []flagSpec {
+	var names []string
+	for _, setting := range server.Settings {
+		if setting.Server {
+			names = append(names, setting.Name)
+		}
+	}
+	return settingFlags(names, true)
+}
+
+// presetNames lists the sampling presets
+func presetNames() []string {
+	names := make([]string, len(server.SamplingPresets))
+	for i, preset := range server.SamplingPresets {
+		names[i] = preset.Name
+	}
+	return names
+}
+
+// internalCommands are run by llm-cli itself and left out of the help
+var internalCommands = []commandSpec{
+	{
+		// Started in the background by servers launched with a keep-alive
+		Name: "watchdog",
+		Run:  watchdogCommand,
+		Args: []argSpec{
+			{Name: "pid", Required: true},
+			{Name: "port", Required: true},
+			{Name: "keep-alive", Required: true},
+		},
+	},
+}
+
+// lookupCommand finds a command by name or alias
+func lookupCommand(name string) (commandSpec, bool) {
+	for _, spec := range append(commands[:len(commands):len(commands)], internalCommands...) {
+		if spec.Name == name || slices.Contains(spec.Aliases, name) {
+			return spec, true
+		}
+	}
+	return commandSpec{}, false
+}
+
+// printSamplingPresets lists the presets 'set --preset' applies
+func printSamplingPresets() {
+	fmt.Println("Sampling presets:")
+	for _, preset := range server.SamplingPresets {
+		fmt.Printf("  %-12s %s\n", preset.Name, preset.Description)
+	}
+}
+
+// printOutputFilters lists the filters 'run --post' accepts
+func printOutputFilters() {
+	fmt.Println("Output filters:")
+	for _, filter := range post.Filters {
+		fmt.Printf("  %-12s %s\n", filter.Name, filter.Description)
+	}
+}
+
+// describeCommands writes every command, argument and flag as JSON, for
+// tools such as GUIs and completion generators
+func describeCommands(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Name        string        `json:"name"`
+		GlobalFlags []flagSpec    `json:"global_flags"`
+		Commands    []commandSpec `json:"commands"`
+	}{"llm-cli", globalFlags, commands})
+}
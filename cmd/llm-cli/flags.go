@@ -0,0 +1,406 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// flagPattern matches arguments that are flags, such as --top, --top=3 and
+// -o, rather than negative numbers or text that happens to start with a dash
+var flagPattern = regexp.MustCompile(`^--?[A-Za-z][A-Za-z0-9-]*(=.*)?$`)
+
+// invocation is a parsed command line: the command and subcommand to run,
+// their flags and global flags, and the positional arguments
+type invocation struct {
+	spec  *commandSpec // nil until the command is named
+	sub   *commandSpec
+	flags *flag.FlagSet
+	args  []string
+	help  bool // --help or -h was given
+	bare  bool // nothing followed the command and subcommand but global flags
+}
+
+// specValue holds the values given for a flag, checked against its spec.
+// Every name of the flag shares one.
+type specValue struct {
+	spec   flagSpec
+	global bool
+	values []string
+}
+
+func (v *specValue) String() string {
+	if len(v.values) == 0 {
+		return ""
+	}
+	return v.values[len(v.values)-1]
+}
+
+// Set records a value; a flag that isn't repeatable keeps the last one
+func (v *specValue) Set(value string) error {
+	if err := checkValue(v.spec, value); err != nil {
+		return err
+	}
+	if !v.spec.Repeatable {
+		v.values = v.values[:0]
+	}
+	v.values = append(v.values, value)
+	return nil
+}
+
+func (v *specValue) IsBoolFlag() bool {
+	return v.spec.Type == "bool"
+}
+
+// parseArgs parses a command line, looking the command up in commands
+func parseArgs(args []string) (*invocation, error) {
+	c := newInvocation(nil)
+	return c, c.parse(args)
+}
+
+// newInvocation returns an invocation of spec, or of the command the
+// arguments name when spec is nil, accepting the global flags
+func newInvocation(spec *commandSpec) *invocation {
+	c := &invocation{flags: flag.NewFlagSet("llm-cli", flag.ContinueOnError), bare: true}
+	c.flags.SetOutput(io.Discard)
+	c.addFlags(globalFlags, true)
+	if spec != nil {
+		c.useCommand(spec)
+	}
+	return c
+}
+
+// useCommand makes spec the command run, accepting its flags from here on
+func (c *invocation) useCommand(spec *commandSpec) {
+	c.spec = spec
+	c.flags.Init(spec.Name, flag.ContinueOnError)
+	c.addFlags(spec.Flags, false)
+}
+
+// addFlags defines flags in the flag set under every name, without the
+// dashes. A name already taken keeps its first flag.
+func (c *invocation) addFlags(flags []flagSpec, global bool) {
+	for _, spec := range flags {
+		value := &specValue{spec: spec, global: global}
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			if name = strings.TrimLeft(name, "-"); c.flags.Lookup(name) == nil {
+				c.flags.Var(value, name, spec.Description)
+			}
+		}
+	}
+}
+
+// parse reads the arguments into the flag set and positional arguments.
+// Flags can come before, between and after positional arguments, so each
+// is set on its own rather than with FlagSet.Parse, which stops at the
+// first positional argument. The arguments after the first "--", and
+// those of a subcommand that passes them through, are all positional.
+func (c *invocation) parse(args []string) error {
+	literal := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !literal && arg == "--" {
+			literal = true
+			continue
+		}
+		if literal || !flagPattern.MatchString(arg) {
+			if err := c.positional(arg); err != nil {
+				return err
+			}
+			if c.sub != nil && c.sub.PassThrough {
+				rest := args[i+1:]
+				if len(rest) > 0 && rest[0] == "--" {
+					rest = rest[1:]
+				}
+				c.args = append(c.args, rest...)
+				return nil
+			}
+			continue
+		}
+		if arg == "--help" || arg == "-h" {
+			c.help = true
+			return nil
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		f := c.flags.Lookup(strings.TrimLeft(name, "-"))
+		if f == nil {
+			return c.unknownFlag(name)
+		}
+		v := f.Value.(*specValue)
+		if v.IsBoolFlag() {
+			if hasValue {
+				return fmt.Errorf("%s does not take a value", name)
+			}
+			value = "true"
+		} else if !hasValue {
+			if i+1 >= len(args) || args[i+1] == "--" {
+				return fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := c.flags.Set(f.Name, value); err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", name, value, err)
+		}
+		c.bare = c.bare && v.global
+	}
+	return nil
+}
+
+// positional takes an argument that isn't a flag: the command's name, the
+// subcommand's, or else an argument of the command
+func (c *invocation) positional(arg string) error {
+	switch {
+	case c.spec == nil:
+		spec, ok := lookupCommand(arg)
+		if !ok {
+			return fmt.Errorf("unknown command: %s (see 'llm-cli --help')", arg)
+		}
+		c.useCommand(&spec)
+		return nil
+	case c.sub == nil && len(c.args) == 0 && len(c.spec.Subcommands) > 0:
+		if sub, ok := lookupSubcommand(*c.spec, arg); ok {
+			c.sub = &sub
+			c.addFlags(sub.Flags, false)
+			return nil
+		}
+		if c.spec.Run == nil {
+			return fmt.Errorf("unknown %s subcommand: %s (see 'llm-cli %s --help')", c.spec.Name, arg, c.spec.Name)
+		}
+	}
+	c.args = append(c.args, arg)
+	c.bare = false
+	return nil
+}
+
+// unknownFlag reports a flag the command doesn't accept
+func (c *invocation) unknownFlag(name string) error {
+	if c.spec == nil {
+		return fmt.Errorf("unknown flag %s (see 'llm-cli --help')", name)
+	}
+	return fmt.Errorf("unknown flag %s for %s (see 'llm-cli %s --help')", name, c.name(), c.name())
+}
+
+// name returns the command's name, followed by the subcommand's if any
+func (c *invocation) name() string {
+	if c.sub != nil {
+		return c.spec.Name + " " + c.sub.Name
+	}
+	return c.spec.Name
+}
+
+// scope returns the spec of the subcommand if one was given, or else of
+// the command
+func (c *invocation) scope() *commandSpec {
+	if c.sub != nil {
+		return c.sub
+	}
+	return c.spec
+}
+
+// missing returns the first required argument or flag that wasn't given,
+// or a subcommand when the command only runs through one
+func (c *invocation) missing() string {
+	if c.sub == nil && c.spec.Run == nil {
+		return "a subcommand"
+	}
+	spec := c.scope()
+	var required []argSpec
+	for _, arg := range spec.Args {
+		if arg.Required {
+			required = append(required, arg)
+		}
+	}
+	if len(c.args) < len(required) {
+		return "<" + required[len(c.args)].Name + ">"
+	}
+	for _, flag := range spec.Flags {
+		if flag.Required && !c.given(flag.Name) {
+			return flag.Name
+		}
+	}
+	return ""
+}
+
+// unexpected returns the first positional argument beyond those the
+// command takes, if any
+func (c *invocation) unexpected() (string, bool) {
+	spec := c.scope()
+	if slices.ContainsFunc(spec.Args, func(arg argSpec) bool { return arg.Variadic }) || len(c.args) <= len(spec.Args) {
+		return "", false
+	}
+	return c.args[len(spec.Args)], true
+}
+
+// value returns the values of the flag named name, which the command must
+// accept
+func (c *invocation) value(name string) *specValue {
+	f := c.flags.Lookup(strings.TrimLeft(name, "-"))
+	if f == nil {
+		panic("no flag " + name)
+	}
+	return f.Value.(*specValue)
+}
+
+// given reports whether the flag was given
+func (c *invocation) given(name string) bool {
+	return len(c.value(name).values) > 0
+}
+
+// bool reports whether a boolean flag was given
+func (c *invocation) bool(name string) bool {
+	return c.given(name)
+}
+
+// string returns the value given for a flag, or "" when it wasn't
+func (c *invocation) string(name string) string {
+	return c.value(name).String()
+}
+
+// strings returns every value given for a repeatable flag, in order
+func (c *invocation) strings(name string) []string {
+	return c.value(name).values
+}
+
+// int returns the value of an integer flag, or its default when it wasn't
+// given
+func (c *invocation) int(name string) int {
+	v := c.value(name)
+	value := v.String()
+	if value == "" {
+		value = v.spec.Default
+	}
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// resolveSlugs replaces positional arguments naming a model, those whose
+// spec is called slug or slug|..., that resolve gives another slug for. This
+// lets models renamed by 'llm-cli rename' keep answering to their old slugs.
+func (c *invocation) resolveSlugs(resolve func(name string) (string, bool)) {
+	spec := c.scope()
+	if spec.PassThrough {
+		return
+	}
+	for i, arg := range c.args {
+		positional, ok := argFor(spec.Args, i, len(c.args))
+		if !ok || (positional.Name != "slug" && !strings.HasPrefix(positional.Name, "slug|")) {
+			continue
+		}
+		if slug, ok := resolve(arg); ok {
+			c.args[i] = slug
+		}
+	}
+}
+
+// argFor returns the spec of the ith of n positional arguments. A variadic
+// argument takes every argument the ones after it leave.
+func argFor(specs []argSpec, i, n int) (argSpec, bool) {
+	variadic := slices.IndexFunc(specs, func(arg argSpec) bool { return arg.Variadic })
+	switch {
+	case variadic < 0 || i < variadic:
+		if i < len(specs) {
+			return specs[i], true
+		}
+		return argSpec{}, false
+	case i < n-(len(specs)-variadic-1):
+		return specs[variadic], true
+	default:
+		return specs[len(specs)-(n-i)], true
+	}
+}
+
+// lookupSubcommand finds a subcommand of spec by name or alias
+func lookupSubcommand(spec commandSpec, name string) (commandSpec, bool) {
+	for _, sub := range spec.Subcommands {
+		if sub.Name == name || slices.Contains(sub.Aliases, name) {
+			return sub, true
+		}
+	}
+	return commandSpec{}, false
+}
+
+// checkValue checks a flag's value against its type and allowed values.
+// Durations and sizes accept units beyond the standard library's, so the
+// commands parse them.
+func checkValue(flag flagSpec, value string) error {
+	if len(flag.Values) > 0 && !slices.Contains(flag.Values, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(flag.Values, ", "))
+	}
+	switch flag.Type {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("must be a number")
+		}
+	}
+	return nil
+}
+
+// printCommandHelp prints the help of a command, or of one of its
+// subcommands, with its flags and subcommands
+func printCommandHelp(spec commandSpec, sub *commandSpec) {
+	if sub != nil {
+		ui.PrintHelp(spec.Name+" "+sub.Name, sub.Summary, sub.Usage)
+		printFlags(append(append([]flagSpec{}, spec.Flags...), sub.Flags...))
+		return
+	}
+
+	ui.PrintHelp(spec.Name, spec.Summary, spec.Usage)
+	if len(spec.Aliases) > 0 {
+		fmt.Printf("Aliases: %s\n", strings.Join(spec.Aliases, ", "))
+	}
+	printFlags(spec.Flags)
+	if len(spec.Subcommands) > 0 {
+		fmt.Println("Subcommands:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, s := range spec.Subcommands {
+			name := s.Name
+			if len(s.Aliases) > 0 {
+				name += " (" + strings.Join(s.Aliases, ", ") + ")"
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", name, s.Summary)
+		}
+		w.Flush()
+	}
+	if spec.Help != nil {
+		fmt.Println()
+		spec.Help()
+	}
+}
+
+// printFlags lists flags with their aliases, values or type and default
+func printFlags(flags []flagSpec) {
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Println("Flags:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, flag := range flags {
+		name := strings.Join(append([]string{flag.Name}, flag.Aliases...), ", ")
+		switch {
+		case len(flag.Values) > 0:
+			name += " <" + strings.Join(flag.Values, "|") + ">"
+		case flag.Type != "bool":
+			name += " <" + flag.Type + ">"
+		}
+		description := flag.Description
+		if flag.Default != "" {
+			description += fmt.Sprintf(" (default %s)", flag.Default)
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", name, description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// testSpec is a command with a flag of each type and a subcommand that
+// passes its arguments through
+var testSpec = commandSpec{
+	Name: "demo",
+	Run:  func(*db.Store, *config.Config, *invocation) error { return nil },
+	Args: []argSpec{slugArg, {Name: "prompt", Variadic: true}},
+	Flags: []flagSpec{
+		{Name: "--json", Type: "bool"},
+		{Name: "--top", Aliases: []string{"-n"}, Type: "int"},
+		{Name: "--temp", Type: "float"},
+		{Name: "--format", Type: "string", Values: []string{"text", "json"}},
+		{Name: "--session", Type: "string"},
+	},
+	Subcommands: []commandSpec{
+		{Name: "exec", Aliases: []string{"x"}, PassThrough: true},
+		{Name: "show", Args: []argSpec{slugArg}, Flags: []flagSpec{{Name: "--raw", Type: "bool"}}},
+	},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string // "" when the arguments are accepted
+	}{
+		{[]string{"qwen", "hello"}, ""},
+		{[]string{"qwen", "--json", "--top", "3", "hello"}, ""},
+		{[]string{"qwen", "--top=3", "-n", "4", "--temp", "0.7"}, ""},
+		{[]string{"qwen", "--format", "json", "--session", "--weird-name"}, ""},
+		{[]string{"qwen", "-5", "is a number, not a flag"}, ""},
+		{[]string{"--quiet", "qwen", "--backend", "mock"}, ""},
+		{[]string{"qwen", "--", "--not-a-flag", "-x"}, ""},
+		{[]string{"exec", "--anything", "-goes"}, ""},
+		{[]string{"show", "qwen", "--raw", "--json"}, ""},
+		{[]string{"qwen", "--nope"}, "unknown flag --nope for demo (see 'llm-cli demo --help')"},
+		{[]string{"show", "qwen", "--nope"}, "unknown flag --nope for demo show"},
+		{[]string{"qwen", "--raw"}, "unknown flag --raw for demo"},
+		{[]string{"qwen", "--json=true"}, "--json does not take a value"},
+		{[]string{"qwen", "--top"}, "--top requires a value"},
+		{[]string{"qwen", "--top", "--", "3"}, "--top requires a value"},
+		{[]string{"qwen", "--top", "three"}, `invalid --top value "three": must be an integer`},
+		{[]string{"qwen", "-n=2.5"}, `invalid -n value "2.5": must be an integer`},
+		{[]string{"qwen", "--temp", "warm"}, `invalid --temp value "warm": must be a number`},
+		{[]string{"qwen", "--format", "yaml"}, `invalid --format value "yaml": must be one of text, json`},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			err := newInvocation(&testSpec).parse(tt.args)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("parse(%q) = %v, want no error", tt.args, err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("parse(%q) = %v, want an error containing %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	c := newInvocation(&testSpec)
+	if err := c.parse([]string{"qwen", "--top", "3", "hi", "-n", "5", "--json", "there"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"qwen", "hi", "there"}; !reflect.DeepEqual(c.args, want) {
+		t.Errorf("args = %q, want %q", c.args, want)
+	}
+	if c.int("--top") != 5 || !c.bool("--json") || c.given("--temp") || c.string("--session") != "" {
+		t.Errorf("--top %d, --json %t, --temp given %t, --session %q", c.int("--top"), c.bool("--json"), c.given("--temp"), c.string("--session"))
+	}
+}
+
+func TestParseLiteral(t *testing.T) {
+	// Only the first "--" is an escape
+	c := newInvocation(&testSpec)
+	if err := c.parse([]string{"qwen", "--json", "--", "--top", "--", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"qwen", "--top", "--", "3"}; !reflect.DeepEqual(c.args, want) || !c.bool("--json") || c.given("--top") {
+		t.Errorf("args = %q, --top given %t, want %q", c.args, c.given("--top"), want)
+	}
+
+	// A subcommand that passes its arguments through takes them all,
+	// without a leading "--"
+	for _, args := range [][]string{
+		{"x", "--top", "3", "--", "-h"},
+		{"exec", "--", "--top", "3", "--", "-h"},
+	} {
+		c := newInvocation(&testSpec)
+		if err := c.parse(args); err != nil {
+			t.Fatalf("parse(%q): %v", args, err)
+		}
+		if want := []string{"--top", "3", "--", "-h"}; c.sub == nil || c.sub.Name != "exec" || !reflect.DeepEqual(c.args, want) || c.help {
+			t.Errorf("parse(%q) = %q, want exec with %q", args, c.args, want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	c, err := parseArgs([]string{"--quiet", "chat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.spec.Name != "chat" || !c.bare || c.missing() != "<slug>" {
+		t.Errorf("parseArgs(--quiet chat) = %s, bare %t, missing %q", c.name(), c.bare, c.missing())
+	}
+	if c, err = parseArgs([]string{"sessions", "search", "--limit", "3", "fix", "bug"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.name() != "sessions search" || c.bare || c.missing() != "" || c.int("--limit") != 3 {
+		t.Errorf("parseArgs(sessions search) = %s, bare %t, missing %q", c.name(), c.bare, c.missing())
+	}
+	if c, err = parseArgs([]string{"config"}); err != nil || c.missing() != "a subcommand" {
+		t.Errorf("parseArgs(config) = %v, missing %q", err, c.missing())
+	}
+	if c, _ = parseArgs([]string{"kill", "a", "b"}); c.missing() != "" {
+		t.Errorf("kill a b: missing %q", c.missing())
+	} else if arg, ok := c.unexpected(); !ok || arg != "b" {
+		t.Errorf("kill a b: unexpected = %q, %t", arg, ok)
+	}
+
+	for args, want := range map[string]string{
+		"nope":               "unknown command: nope",
+		"--json":             "unknown flag --json (see 'llm-cli --help')",
+		"config frobnicate":  "unknown config subcommand: frobnicate",
+		"run qwen --top 3":   "unknown flag --top for run",
+		"sessions ls --json": "unknown flag --json for sessions ls",
+	} {
+		if _, err := parseArgs(strings.Fields(args)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseArgs(%s) = %v, want an error containing %q", args, err, want)
+		}
+	}
+}
+
+// TestParseCommands checks every command's and subcommand's own flags are
+// accepted
+func TestParseCommands(t *testing.T) {
+	check := func(spec commandSpec, sub *commandSpec, flag flagSpec) {
+		var args []string
+		if sub != nil {
+			args = append(args, sub.Name)
+		}
+		args = append(args, flag.Name)
+		if flag.Type != "bool" {
+			args = append(args, exampleValue(flag))
+		}
+		if err := newInvocation(&spec).parse(args); err != nil {
+			t.Errorf("%s %s: %v", spec.Name, strings.Join(args, " "), err)
+		}
+	}
+	for _, spec := range commands {
+		for _, flag := range spec.Flags {
+			check(spec, nil, flag)
+		}
+		for i, sub := range spec.Subcommands {
+			for _, flag := range sub.Flags {
+				check(spec, &spec.Subcommands[i], flag)
+			}
+		}
+	}
+}
+
+// exampleValue returns a value a flag accepts
+func exampleValue(flag flagSpec) string {
+	if len(flag.Values) > 0 {
+		return flag.Values[0]
+	}
+	switch flag.Type {
+	case "int":
+		return "2"
+	case "float":
+		return "0.5"
+	}
+	return "x"
+}
+
+func TestResolveSlugs(t *testing.T) {
+	resolve := func(name string) (string, bool) {
+		if name == "old" {
+			return "new", true
+		}
+		return "", false
+	}
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"old", "old"}, []string{"new", "old"}},
+		{[]string{"--session", "old", "old"}, []string{"new"}},
+		{[]string{"--json", "old"}, []string{"new"}},
+		{[]string{"show", "old"}, []string{"new"}},
+		{[]string{"exec", "old"}, []string{"old"}},
+		{[]string{"other", "old"}, []string{"other", "old"}},
+	}
+	for _, tt := range tests {
+		c := newInvocation(&testSpec)
+		if err := c.parse(tt.args); err != nil {
+			t.Fatalf("parse(%q): %v", tt.args, err)
+		}
+		if c.resolveSlugs(resolve); !reflect.DeepEqual(c.args, tt.want) {
+			t.Errorf("resolveSlugs(%q) = %q, want %q", tt.args, c.args, tt.want)
+		}
+	}
+}
@@ -1,25 +1,64 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/garyblankenship/llmcli/internal/backup"
+	"github.com/garyblankenship/llmcli/internal/bench"
 	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/dataset"
 	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/grammar"
+	"github.com/garyblankenship/llmcli/internal/index"
+	"github.com/garyblankenship/llmcli/internal/mail"
 	"github.com/garyblankenship/llmcli/internal/model"
+	"github.com/garyblankenship/llmcli/internal/ocr"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/prompt"
+	"github.com/garyblankenship/llmcli/internal/rag"
+	"github.com/garyblankenship/llmcli/internal/record"
+	"github.com/garyblankenship/llmcli/internal/sandbox"
+	"github.com/garyblankenship/llmcli/internal/secrets"
 	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/session"
+	"github.com/garyblankenship/llmcli/internal/stack"
+	"github.com/garyblankenship/llmcli/internal/tasks"
+	"github.com/garyblankenship/llmcli/internal/tune"
 	"github.com/garyblankenship/llmcli/internal/ui"
+	"github.com/garyblankenship/llmcli/internal/vault"
 )
 
 func main() {
 	if err := run(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			// Interrupted with Ctrl-C; the exit status a shell gives SIGINT
+			fmt.Fprintln(os.Stderr, "cancelled")
+			os.Exit(130)
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	c, err := parseArgs(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	// Needs neither the config nor the database, so tools can always call it
+	if c.bool("--describe-commands") {
+		return describeCommands(os.Stdout)
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
@@ -31,165 +70,1160 @@ func run() error {
 	}
 	defer store.Close()
 
-	if len(os.Args) < 2 {
+	if cfg.Encryption.Enabled {
+		store.SetCipherProvider(func() (db.Cipher, error) {
+			v, err := vault.Unlock(cfg, store)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		})
+	}
+	if changed, err := store.SetSearchEncrypted(cfg.Encryption.Enabled); err != nil {
+		return err
+	} else if changed && cfg.Encryption.Enabled {
+		ui.PrintWarn("Encryption is on, so the search index, which held unencrypted text, was emptied. Searches now decrypt and scan every message.")
+	} else if changed {
+		ui.PrintInfo("Encryption is off, so the search index was rebuilt from the unencrypted sessions and history.")
+	}
+
+	if c.bool("--private") {
+		cfg.DisablePersistence()
+	}
+	if keepAlive := c.string("--keep-alive"); keepAlive != "" {
+		cfg.KeepAlive = keepAlive
+		if _, err := cfg.KeepAliveDuration(); err != nil {
+			return err
+		}
+	}
+	cfg.NoEvict = c.bool("--no-evict")
+	if backend := c.string("--backend"); backend != "" {
+		if err := cfg.UseBackend(backend); err != nil {
+			return err
+		}
+	}
+	if c.bool("--accessible") || cfg.Accessible {
+		ui.SetAccessible()
+	}
+	switch verbose, quiet := c.bool("--verbose"), c.bool("--quiet"); {
+	case verbose && quiet:
+		return fmt.Errorf("--verbose and --quiet can't be used together")
+	case verbose:
+		ui.SetVerbose()
+		http.DefaultTransport = ui.LoggingTransport(http.DefaultTransport)
+	case quiet:
+		ui.SetQuiet()
+	}
+	if recording := c.string("--record"); recording != "" {
+		for _, arg := range c.args {
+			if c.spec.Name == "replay" && sameFile(recording, arg) {
+				return fmt.Errorf("--record would overwrite %s before it is replayed; record to another file", recording)
+			}
+		}
+		if err := record.Start(recording); err != nil {
+			return err
+		}
+		defer func() {
+			count, err := record.Stop()
+			if err != nil {
+				ui.PrintWarn(err.Error())
+				return
+			}
+			ui.PrintInfo(fmt.Sprintf("Recorded %d requests to %s.", count, recording))
+		}()
+	}
+
+	if c.spec == nil {
 		ui.PrintUsage()
 		return nil
 	}
+	if c.help {
+		printCommandHelp(*c.spec, c.sub)
+		return nil
+	}
+	if missing := c.missing(); missing != "" {
+		// A command given nothing to work on shows how to use it
+		if c.bare {
+			printCommandHelp(*c.spec, c.sub)
+			return nil
+		}
+		return fmt.Errorf("%s requires %s (see 'llm-cli %s --help')", c.name(), missing, c.name())
+	}
+	if arg, ok := c.unexpected(); ok {
+		return fmt.Errorf("unexpected argument for %s: %s", c.name(), arg)
+	}
+	c.resolveSlugs(store.ResolveSlugAlias)
+	return c.scope().Run(store, cfg, c)
+}
 
-	cmd := os.Args[1]
-	args := os.Args[2:]
+// pullCommand downloads a model from Hugging Face
+func pullCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return model.Pull(ctx, store, cfg, c.args[0], model.PullOptions{Quant: c.string("--quant"), UseHFCLI: c.bool("--hf-cli"), Yes: c.bool("--yes")})
+}
 
-	switch cmd {
-	case "pull":
-		if len(args) < 1 {
-			return fmt.Errorf("pull requires a model ID")
-		}
-		if args[0] == "--help" {
-			ui.PrintHelp("pull", "Download a new model from Hugging Face.", "<model_id>")
-			return nil
+// convertCommand converts a safetensors model to GGUF
+func convertCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Convert(store, cfg, c.args[0], c.string("--quant"), c.bool("--keep-staging"))
+}
+
+// ggufJoinCommand merges the shards of a split model
+func ggufJoinCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.JoinShards(c.args[0], c.string("-o"))
+}
+
+// ggufSplitCommand splits a model into shards
+func ggufSplitCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	maxTensors := c.int("--max-tensors")
+	if c.given("--max-tensors") && maxTensors < 1 {
+		return fmt.Errorf("invalid --max-tensors value: %d", maxTensors)
+	}
+	return model.SplitModel(store, c.args[0], c.args[1], maxTensors, c.string("--max-size"))
+}
+
+// ggufSetCommand changes the metadata of a GGUF file
+func ggufSetCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.SetMetadata(store, c.args[0], model.MetadataChanges{
+		ChatTemplateFile: c.string("--chat-template"),
+		Name:             c.string("--name"),
+		Set:              c.strings("--set"),
+		Unset:            c.strings("--unset"),
+	})
+}
+
+// lsCommand lists the installed models, or watches them
+func lsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if c.bool("--watch") {
+		ctx, stop := ui.Interruptible(context.Background())
+		defer stop()
+		return server.Watch(ctx, store, cfg, server.WatchOptions{})
+	}
+	relative, absolute := c.bool("--relative"), c.bool("--absolute")
+	asJSON, asCSV := c.bool("--json"), c.bool("--csv")
+	opts := model.ListOptions{Relative: relative, Tags: c.strings("--tag"), Sort: c.string("--sort")}
+	switch {
+	case relative && absolute:
+		return fmt.Errorf("--relative and --absolute can't be used together")
+	case asJSON && asCSV:
+		return fmt.Errorf("--json and --csv can't be used together")
+	case asJSON:
+		opts.Format = "json"
+	case asCSV:
+		opts.Format = "csv"
+	}
+	return model.List(store, opts)
+}
+
+// whichCommand finds installed models by name or metadata
+func whichCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Which(store, strings.Join(c.args, " "))
+}
+
+// rmCommand removes a model
+func rmCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Remove(store, cfg, c.args[0])
+}
+
+// duCommand shows the disk space of each model
+func duCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.DiskUsage(store, cfg)
+}
+
+// pruneCommand removes models not used recently
+func pruneCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Prune(store, cfg, c.string("--older-than"), c.bool("--yes"))
+}
+
+// infoCommand shows a model's GGUF metadata
+func infoCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Info(store, c.args[0], model.InfoOptions{Template: c.bool("--template"), All: c.bool("--all")})
+}
+
+// outdatedCommand lists models changed on Hugging Face
+func outdatedCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Outdated(store, cfg)
+}
+
+// upgradeCommand re-downloads models changed on Hugging Face
+func upgradeCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return model.Upgrade(ctx, store, cfg, c.args[0])
+}
+
+// verifyCommand re-hashes model files
+func verifyCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Verify(store, cfg, c.args)
+}
+
+// unquarantineCommand lets a crash-looping model start again
+func unquarantineCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Unquarantine(store, c.args[0])
+}
+
+// aliasCommand gives a model a new slug
+func aliasCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Alias(store, cfg, c.args[0], c.args[1])
+}
+
+// tagCommand adds, removes or prints a model's tags
+func tagCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Tag(store, c.args[0], c.args[1:], c.bool("--rm"))
+}
+
+// renameCommand renames every model with a slug scheme
+func renameCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	scheme := c.string("--scheme")
+	if scheme == "" {
+		scheme = cfg.SlugScheme
+	}
+	if scheme == "" {
+		return fmt.Errorf("rename requires --scheme, or a slug_scheme in the config")
+	}
+	return model.Rename(store, scheme, cfg.SlugScheme, c.bool("--apply"))
+}
+
+// relinkCommand points a model at a renamed repository
+func relinkCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Relink(store, cfg, c.args[0], c.args[1])
+}
+
+// importCommand imports the models already on disk
+func importCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.Reregister(store, cfg, "import", c.bool("--force"), func() error {
+		return model.ImportExisting(store, cfg)
+	})
+}
+
+// resetCommand resets the database and re-imports the models
+func resetCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.Reregister(store, cfg, "reset", c.bool("--force"), func() error {
+		return model.ResetDB(store, cfg)
+	})
+}
+
+// purgeCommand securely removes the stored data
+func purgeCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.PurgeAllData(store, cfg)
+}
+
+// configShowCommand shows the effective settings
+func configShowCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return config.Show(cfg)
+}
+
+// configProfilesCommand lists the hardware profiles
+func configProfilesCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return config.ListProfiles(cfg)
+}
+
+// configSetCommand changes a key of the config file
+func configSetCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	key, value := c.args[0], ""
+	if len(c.args) > 1 {
+		value = c.args[1]
+	} else if key != "hardware-profile" {
+		return fmt.Errorf("config set requires a value for %s", key)
+	}
+	return config.Set(cfg, key, value)
+}
+
+// configSnapshotCommand saves a version of a model's configuration
+func configSnapshotCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.SnapshotConfig(store, c.args[0])
+}
+
+// configRollbackCommand restores a saved version of a model's configuration
+func configRollbackCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	version := 0
+	if len(c.args) > 1 {
+		var err error
+		if version, err = strconv.Atoi(c.args[1]); err != nil || version < 1 {
+			return fmt.Errorf("invalid config version: %s", c.args[1])
 		}
-		return model.Pull(store, cfg, args[0])
+	}
+	return model.RollbackConfig(store, c.args[0], version)
+}
 
-	case "ls":
-		return model.List(store)
+// syncSetupCommand chooses the remote the state is synced with
+func syncSetupCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return backup.Setup(cfg, c.args[0], c.string("--type"))
+}
 
-	case "rm":
-		if len(args) < 1 {
-			return fmt.Errorf("rm requires a model slug")
+// syncPushCommand copies the state to the remote
+func syncPushCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return backup.Push(store, cfg)
+}
+
+// syncPullCommand replaces the state with the remote's
+func syncPullCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return backup.Pull(store, cfg)
+}
+
+// openLogsCommand opens the log directory, or a model's server log
+func openLogsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	path := cfg.LogDir
+	if len(c.args) > 0 {
+		slug := c.args[0]
+		if _, err := store.GetModelBySlug(slug); err != nil {
+			return err
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("rm", "Remove a model from the filesystem and database.", "<slug>")
-			return nil
+		path = cfg.ServerLogPath(slug)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("no server log for %s yet; it is written to %s once the server starts", slug, path)
 		}
-		return model.Remove(store, cfg, args[0])
+	} else {
+		ui.PrintInfo(fmt.Sprintf("Server logs are named %s.", filepath.Base(cfg.ServerLogPath("<slug>"))))
+	}
+	return ui.OpenPath(path)
+}
+
+// openModelsCommand opens the models directory
+func openModelsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if err := os.MkdirAll(cfg.ModelsDir, 0755); err != nil {
+		return fmt.Errorf("creating models directory: %w", err)
+	}
+	return ui.OpenPath(cfg.ModelsDir)
+}
 
-	case "alias":
-		if len(args) < 2 {
-			return fmt.Errorf("alias requires old and new slugs")
+// openConfigCommand opens the config file, creating it if needed
+func openConfigCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	path := cfg.ConfigPath
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("creating config directory: %w", err)
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("alias", "Create an alias for a model.", "<old_slug> <new_slug>")
-			return nil
+		if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+			return fmt.Errorf("creating config file: %w", err)
 		}
-		return model.Alias(store, args[0], args[1])
+		ui.PrintInfo(fmt.Sprintf("Created an empty config file at %s.", path))
+	}
+	return ui.OpenPath(path)
+}
 
-	case "import":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("import", "Import existing models from the filesystem into the database.", "")
-			return nil
-		}
-		return model.ImportExisting(store, cfg)
+// secretsListCommand lists the stored secrets
+func secretsListCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return secrets.List(secrets.New(cfg))
+}
 
-	case "reset":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("reset", "Reset the database and re-import existing models.", "")
-			return nil
+// secretsSetCommand stores a secret
+func secretsSetCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return secrets.SetInteractive(secrets.New(cfg), c.args[0])
+}
+
+// secretsRemoveCommand removes a secret
+func secretsRemoveCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return secrets.Remove(secrets.New(cfg), c.args[0])
+}
+
+// loginCommand stores a Hugging Face token
+func loginCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Login(cfg)
+}
+
+// logoutCommand removes the stored Hugging Face token
+func logoutCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.Logout(cfg)
+}
+
+// sandboxRunCommand runs a command under the sandbox policy
+func sandboxRunCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return sandbox.RunCommand(cfg, c.args)
+}
+
+// sandboxAuditCommand shows the most recent sandboxed commands
+func sandboxAuditCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return sandbox.ShowAudit(cfg, 50)
+}
+
+// tasksListCommand lists the scheduled tasks
+func tasksListCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return tasks.List(store, cfg)
+}
+
+// tasksRunNowCommand runs a task immediately
+func tasksRunNowCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return tasks.RunNow(store, cfg, c.args[0])
+}
+
+// tasksRunDueCommand runs the tasks that are due
+func tasksRunDueCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return tasks.RunDue(store, cfg)
+}
+
+// setCommand shows or changes a model's settings
+func setCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	slug := c.args[0]
+	switch {
+	case c.given("--preset"):
+		return model.ApplyPreset(store, slug, c.string("--preset"))
+	case c.given("--unset"):
+		return model.UnsetSetting(store, slug, c.string("--unset"))
+	case len(c.args) == 1:
+		return model.ShowSettings(store, slug)
+	case len(c.args) == 3:
+		return model.SetSetting(store, cfg, slug, c.args[1], c.args[2])
+	default:
+		return fmt.Errorf("set requires a model slug, a key and a value")
+	}
+}
+
+// ctxCommand shows or sets a model's context settings
+func ctxCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	changes := make(map[string]string)
+	for _, name := range server.ContextSettings {
+		if value := c.string("--" + name); value != "" {
+			changes[name] = value
 		}
-		return model.ResetDB(store, cfg)
+	}
+	return model.Context(store, cfg, c.args[0], changes, c.bool("--reset"))
+}
 
-	case "run":
-		if len(args) < 1 {
-			return fmt.Errorf("run requires a model slug")
+// tuneCommand benchmarks a grid of server settings
+func tuneCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := tune.Options{Grid: c.string("--grid"), NPredict: c.int("--n-predict"), Apply: c.bool("--apply")}
+	if opts.NPredict < 1 {
+		return fmt.Errorf("invalid --n-predict value: %d", opts.NPredict)
+	}
+	var err error
+	if opts.MaxMemory, err = model.ParseSize(c.string("--max-mem")); err != nil {
+		return err
+	}
+	return tune.Run(store, cfg, c.args[0], opts)
+}
+
+// benchCommand measures a model's speed and memory use
+func benchCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := bench.Options{Repeat: c.int("--repeat"), Overrides: serverOverrides(c)}
+	var err error
+	if opts.PromptTokens, err = splitCounts("--prompt-tokens", c.string("--prompt-tokens"), bench.DefaultPromptTokens); err != nil {
+		return err
+	}
+	if opts.NPredict, err = splitCounts("--n-predict", c.string("--n-predict"), bench.DefaultNPredict); err != nil {
+		return err
+	}
+	if opts.Repeat < 1 {
+		return fmt.Errorf("invalid --repeat value: %d", opts.Repeat)
+	}
+	return bench.Run(store, cfg, c.args[0], opts)
+}
+
+// benchResultsCommand compares recorded benchmark results
+func benchResultsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return bench.Results(store, c.args)
+}
+
+// runCommand starts a model's server and completes text
+func runCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	jsonMode, retries, err := responseFormat(c)
+	if err != nil {
+		return err
+	}
+	promptName, pairs := c.string("--prompt"), c.strings("--var")
+	if len(pairs) > 0 && promptName == "" {
+		return fmt.Errorf("--var requires --prompt")
+	}
+	autoContinue := c.int("--auto-continue")
+	if autoContinue < 0 {
+		return fmt.Errorf("invalid --auto-continue value: %d", autoContinue)
+	}
+	noStream := c.bool("--no-stream")
+	pipeline, err := post.ForCommand(cfg, "run", c.string("--post"))
+	if err != nil {
+		return err
+	}
+	if extract := c.string("--extract"); extract != "" {
+		extraction, _ := post.Parse(extract, nil)
+		pipeline = append(pipeline, extraction...)
+	}
+	if jsonMode {
+		if len(pipeline) > 0 || autoContinue > 0 || noStream {
+			return fmt.Errorf("--format json can't be combined with --post, --extract, --auto-continue or --no-stream")
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("run", "Run a model server and optionally complete text.", "<slug> [text]")
-			return nil
+		ui.MessagesToStderr()
+	}
+	var constraint string
+	switch schemaFile, grammarFile := c.string("--json-schema"), c.string("--grammar"); {
+	case schemaFile != "" && grammarFile != "":
+		return fmt.Errorf("--json-schema and --grammar can't be combined")
+	case schemaFile != "":
+		schema, err := os.ReadFile(schemaFile)
+		if err != nil {
+			return fmt.Errorf("reading JSON schema: %w", err)
 		}
-		slug := args[0]
-		text := strings.Join(args[1:], " ")
-		return server.Run(store, cfg, slug, text)
-
-	case "chat":
-		if len(args) < 1 {
-			return fmt.Errorf("chat requires a model slug")
+		if constraint, err = grammar.FromJSONSchema(schema); err != nil {
+			return fmt.Errorf("%s: %w", schemaFile, err)
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("chat", "Start a chat session with the specified model.", "<slug>")
-			return nil
+	case grammarFile != "":
+		data, err := os.ReadFile(grammarFile)
+		if err != nil {
+			return fmt.Errorf("reading grammar: %w", err)
 		}
-		return server.Chat(store, cfg, args[0])
-
-	case "embed":
-		if len(args) < 2 {
-			return fmt.Errorf("embed requires a model slug and text")
+		constraint = string(data)
+	}
+	if constraint != "" && autoContinue > 0 {
+		// A continuation would start the grammar over mid-value
+		return fmt.Errorf("--auto-continue can't be combined with --json-schema or --grammar")
+	}
+	slug := c.args[0]
+	text, err := withStdin(strings.Join(c.args[1:], " "))
+	if err != nil {
+		return err
+	}
+	if ocrImage, ocrLang := c.string("--ocr"), c.string("--ocr-lang"); ocrImage != "" {
+		// The image's text follows the question about it
+		extracted, err := ocr.New(ocrLang).Extract(ocrImage)
+		if err != nil {
+			return err
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("embed", "Generate embeddings for the given text.", "<slug> <text>")
-			return nil
+		if text == "" {
+			text = extracted
+		} else {
+			text += "\n\n" + extracted
+		}
+	} else if ocrLang != "" {
+		return fmt.Errorf("--ocr-lang requires --ocr")
+	}
+	if promptName != "" {
+		vars, err := prompt.ParseVars(pairs)
+		if err != nil {
+			return err
 		}
-		return server.Embed(store, cfg, args[0], strings.Join(args[1:], " "))
+		if text != "" {
+			if _, ok := vars["input"]; ok {
+				return fmt.Errorf("--var input can't be combined with text or piped input; they fill in the same variable")
+			}
+			vars["input"] = text
+		}
+		if text, err = prompt.Render(store, promptName, vars); err != nil {
+			return err
+		}
+	}
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return server.Run(ctx, store, cfg, slug, text, server.RunOptions{Overrides: serverOverrides(c), Post: pipeline, AutoContinue: autoContinue, NoStream: noStream, Grammar: constraint, JSON: jsonMode, Retries: retries})
+}
+
+// promptSaveCommand saves a prompt template
+func promptSaveCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	text, err := withStdin(strings.Join(c.args[1:], " "))
+	if err != nil {
+		return err
+	}
+	return prompt.Save(store, c.args[0], text)
+}
+
+// promptListCommand lists the saved prompts
+func promptListCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return prompt.List(store)
+}
+
+// promptShowCommand prints a saved prompt's template
+func promptShowCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return prompt.Show(store, c.args[0])
+}
+
+// promptRemoveCommand removes a saved prompt
+func promptRemoveCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return prompt.Remove(store, c.args[0])
+}
+
+// replayCommand sends recorded requests again
+func replayCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return server.Replay(ctx, store, cfg, c.args[0], server.ReplayOptions{Model: c.string("--model")})
+}
 
-	case "tokenize":
-		if len(args) < 2 {
-			return fmt.Errorf("tokenize requires a model slug and text")
+// compareCommand sends one prompt to several models
+func compareCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if len(c.args) < 3 {
+		return fmt.Errorf("compare requires at least two model slugs and a prompt")
+	}
+	text, err := withStdin(c.args[len(c.args)-1])
+	if err != nil {
+		return err
+	}
+	return server.Compare(store, cfg, c.args[:len(c.args)-1], text, server.CompareOptions{Parallel: c.bool("--parallel")})
+}
+
+// chatCommand starts a chat session
+func chatCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	jsonMode, retries, err := responseFormat(c)
+	if err != nil {
+		return err
+	}
+	export := c.string("--export")
+	if _, ok := session.FormatForPath(export); export != "" && !ok {
+		return fmt.Errorf("invalid --export file %s: name it .md, .json or .html", export)
+	}
+	opts := server.ChatOptions{
+		Session:      c.string("--session"),
+		Compact:      c.bool("--compact"),
+		ShowThinking: c.bool("--show-thinking"),
+		Footer:       c.bool("--footer"),
+		JSON:         jsonMode,
+		Retries:      retries,
+		Export:       export,
+	}
+	if ping := c.string("--ping"); ping != "" {
+		if opts.Ping, err = time.ParseDuration(ping); err != nil || opts.Ping <= 0 {
+			return fmt.Errorf("invalid --ping duration: %s", ping)
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("tokenize", "Tokenize text using the specified model.", "<slug> <text>")
-			return nil
+	}
+	requireCitations := c.bool("--require-citations")
+	if collections := c.string("--rag"); collections != "" {
+		top := c.int("--top")
+		if top < 1 {
+			return fmt.Errorf("invalid --top value: %d", top)
+		}
+		retriever, err := index.NewRetriever(store, cfg, splitList(collections))
+		if err != nil {
+			return err
 		}
-		return server.Tokenize(store, cfg, args[0], strings.Join(args[1:], " "))
+		opts.Retrieve = func(question string) ([]rag.Chunk, error) {
+			return retriever.Search(question, top)
+		}
+		opts.RequireCitations = requireCitations
+	} else if c.given("--top") {
+		return fmt.Errorf("--top requires --rag")
+	} else if requireCitations {
+		return fmt.Errorf("--require-citations requires --rag")
+	}
+	if c.bool("--tools") {
+		if opts.Sandbox, err = sandbox.New(cfg); err != nil {
+			return err
+		}
+	}
+	return server.Chat(context.Background(), store, cfg, c.args[0], opts)
+}
 
-	case "detokenize":
-		if len(args) < 2 {
-			return fmt.Errorf("detokenize requires a model slug and tokens")
+// sessionsListCommand lists the saved sessions
+func sessionsListCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return session.List(store)
+}
+
+// sessionsSearchCommand searches the messages of saved sessions
+func sessionsSearchCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	limit := c.int("--limit")
+	if limit < 1 {
+		return fmt.Errorf("invalid --limit value: %d", limit)
+	}
+	return session.Search(store, strings.Join(c.args, " "), limit)
+}
+
+// sessionsExportCommand exports a session, or every session
+func sessionsExportCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	format, output := c.string("--format"), c.string("-o")
+	if c.bool("--all") {
+		if format != "openai" && format != "sharegpt" {
+			return fmt.Errorf("--all requires --format openai or sharegpt")
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("detokenize", "Detokenize tokens using the specified model.", "<slug> <tokens>")
-			return nil
+		return session.ExportAll(store, format, output)
+	}
+	if len(c.args) < 1 {
+		return fmt.Errorf("sessions export requires a session name")
+	}
+	if format == "" {
+		if format, _ = session.FormatForPath(output); format == "" {
+			format = "html"
 		}
-		return server.Detokenize(store, cfg, args[0], args[1])
+	}
+	return session.Export(store, c.args[0], session.ExportOptions{
+		Format:        format,
+		Output:        output,
+		SelfContained: c.bool("--self-contained"),
+	})
+}
 
-	case "health":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("health", "Check the health status of the running server.", "")
-			return nil
+// sessionsImportCommand imports conversations as sessions
+func sessionsImportCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return session.Import(store, c.args[0], c.string("--format"), c.string("--model"))
+}
+
+// batchCommand completes every prompt of a file
+func batchCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := server.BatchOptions{Input: c.string("--input"), Output: c.string("--output"), Concurrency: c.int("--concurrency")}
+	if c.given("--concurrency") && opts.Concurrency < 1 {
+		return fmt.Errorf("invalid --concurrency value: %d", opts.Concurrency)
+	}
+	return server.Batch(store, cfg, c.args[0], opts)
+}
+
+// embedCommand embeds text, or every input of a file
+func embedCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	summary, raw := c.bool("--summary"), c.bool("--raw")
+	if file := c.string("--file"); file != "" {
+		if len(c.args) > 1 || summary || raw {
+			return fmt.Errorf("--file can't be combined with text, --summary or --raw")
+		}
+		opts := server.EmbedFileOptions{Input: file, Output: c.string("-o"), Format: c.string("--format"), BatchSize: c.int("--batch-size")}
+		if opts.BatchSize < 1 {
+			return fmt.Errorf("invalid --batch-size value: %d", opts.BatchSize)
 		}
-		return server.CheckHealth(cfg)
+		return server.EmbedFile(store, cfg, c.args[0], opts)
+	}
+	if c.given("--format") || c.given("-o") || c.given("--batch-size") {
+		return fmt.Errorf("--format, -o and --batch-size require --file")
+	}
+	text, err := withStdin(strings.Join(c.args[1:], " "))
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("embed requires a model slug and text")
+	}
+	if summary && raw {
+		return fmt.Errorf("--summary and --raw cannot be used together")
+	}
 
-	case "props":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("props", "Get the properties of the running server.", "")
-			return nil
+	format := server.EmbedJSON
+	if summary {
+		format = server.EmbedSummary
+	} else if raw {
+		format = server.EmbedRaw
+	}
+	return server.Embed(store, cfg, c.args[0], text, format)
+}
+
+// nearestCommand ranks the lines of a file by similarity to a query
+func nearestCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	top := c.int("--top")
+	if top < 1 {
+		return fmt.Errorf("invalid --top value: %d", top)
+	}
+	return server.Nearest(store, cfg, c.args[0], c.string("--query"), c.string("--candidates"), top)
+}
+
+// benchEmbedCommand compares embedding models on a dataset
+func benchEmbedCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	k := c.int("--k")
+	if k < 1 {
+		return fmt.Errorf("invalid --k value: %d", k)
+	}
+	return server.BenchEmbed(store, cfg, splitList(c.string("--models")), c.string("--dataset"), c.string("--corpus"), k)
+}
+
+// indexAddCommand embeds files into a collection
+func indexAddCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := index.AddOptions{Model: c.string("--model"), ChunkSize: c.int("--chunk-size")}
+	if opts.ChunkSize < 100 {
+		return fmt.Errorf("invalid --chunk-size value: %d (at least 100)", opts.ChunkSize)
+	}
+	return index.Add(store, cfg, c.args[0], c.args[1:], opts)
+}
+
+// indexQueryCommand searches collections, or answers from them
+func indexQueryCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := index.QueryOptions{Top: c.int("--top"), JSON: c.bool("--json"), Model: c.string("--model"), RequireCitations: c.bool("--require-citations")}
+	if opts.RequireCitations && opts.Model == "" {
+		return fmt.Errorf("--require-citations requires --model")
+	}
+	if opts.Top < 1 {
+		return fmt.Errorf("invalid --top value: %d", opts.Top)
+	}
+	return index.Query(store, cfg, splitList(c.args[0]), strings.Join(c.args[1:], " "), opts)
+}
+
+// indexInspectCommand shows how a file was chunked
+func indexInspectCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := index.InspectOptions{File: c.string("--file"), Query: c.string("--query"), Top: c.int("--top"), JSON: c.bool("--json")}
+	if opts.Top < 1 {
+		return fmt.Errorf("invalid --top value: %d", opts.Top)
+	}
+	return index.Inspect(store, cfg, c.args[0], opts)
+}
+
+// indexWatchCommand keeps a collection up to date
+func indexWatchCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	interval := 5 * time.Second
+	if s := c.string("--interval"); s != "" {
+		var err error
+		if interval, err = time.ParseDuration(s); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid --interval duration: %s", s)
 		}
-		return server.GetProperties(cfg)
+	}
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return index.Watch(ctx, store, cfg, c.args[0], c.args[1:], interval)
+}
 
-	case "ps":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("ps", "Show running llama-server processes.", "")
-			return nil
+// indexListCommand lists the collections
+func indexListCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return index.List(store)
+}
+
+// indexRemoveCommand deletes a collection
+func indexRemoveCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return index.Remove(store, c.args[0])
+}
+
+// mailSummarizeCommand summarizes the email on stdin
+func mailSummarizeCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return mail.Summarize(store, cfg, c.args[0], os.Stdin)
+}
+
+// mailReplyCommand drafts a reply to the email on stdin
+func mailReplyCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return mail.SuggestReply(store, cfg, c.args[0], os.Stdin)
+}
+
+// datasetGenerateCommand generates a fine-tuning dataset
+func datasetGenerateCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := dataset.Options{Model: c.string("--model"), Judge: c.string("--judge"), SeedsPath: c.string("--seed-prompts"), Format: c.string("--format"),
+		Count: c.int("--n"), Output: c.string("-o"), MinScore: c.int("--min-score"), Similarity: 0.8}
+	if opts.Count < 1 {
+		return fmt.Errorf("invalid --n value: %d", opts.Count)
+	}
+	if opts.MinScore < 1 || opts.MinScore > 10 {
+		return fmt.Errorf("invalid --min-score value: %d", opts.MinScore)
+	}
+	if opts.Output == "" {
+		opts.Output = "data.jsonl"
+	}
+	return dataset.Generate(store, cfg, opts)
+}
+
+// tokenizeCommand tokenizes text
+func tokenizeCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.Tokenize(store, cfg, c.args[0], strings.Join(c.args[1:], " "))
+}
+
+// detokenizeCommand turns token IDs back into text
+func detokenizeCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.Detokenize(store, cfg, c.args[0], strings.Join(c.args[1:], " "))
+}
+
+// healthCommand checks the health of a server, or of every server
+func healthCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	asJSON := c.bool("--json")
+	if c.bool("--all") {
+		if len(c.args) > 0 {
+			return fmt.Errorf("health --all checks every server; leave out the slug")
+		}
+		expected, err := stack.Slugs(cfg)
+		if err != nil {
+			return err
+		}
+		return server.CheckHealthAll(store, cfg, expected, asJSON)
+	}
+	if asJSON {
+		return fmt.Errorf("--json is only supported with --all; a single server's health is printed as JSON already")
+	}
+	if len(c.args) > 0 {
+		var err error
+		if cfg, err = server.ModelConfig(store, cfg, c.args[0]); err != nil {
+			return err
 		}
-		return server.ListProcesses(store)
+	}
+	return server.CheckHealth(cfg)
+}
 
-	case "kill":
-		if len(args) < 1 {
-			return fmt.Errorf("kill requires a model slug or 'all'")
+// propsCommand gets the properties of a server
+func propsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if len(c.args) > 0 {
+		var err error
+		if cfg, err = server.ModelConfig(store, cfg, c.args[0]); err != nil {
+			return err
 		}
-		if args[0] == "--help" {
-			ui.PrintHelp("kill", "Kill a model server or all servers.", "<slug|all>")
-			return nil
+	}
+	return server.GetProperties(cfg)
+}
+
+// daemonStartCommand starts the daemon in the background
+func daemonStartCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.StartDaemon(cfg)
+}
+
+// daemonStopCommand stops the daemon and its servers
+func daemonStopCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.StopDaemon(cfg)
+}
+
+// daemonStatusCommand shows the daemon's servers
+func daemonStatusCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.ShowDaemonStatus(cfg)
+}
+
+// daemonRunCommand runs the daemon in the foreground, with the scheduled
+// tasks
+func daemonRunCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return server.ServeDaemon(store, cfg, func(ensure server.EnsureFunc) { tasks.RunScheduled(store, cfg, ensure) })
+}
+
+// warmupCommand starts model servers ahead of use
+func warmupCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	slugs := c.args
+	if c.bool("--all-starred") {
+		if len(cfg.Starred) == 0 {
+			return fmt.Errorf("no starred models; list them in the config file, e.g. config set starred '[\"qwen\"]'")
 		}
+		slugs = append(slugs, cfg.Starred...)
+	}
+	if len(slugs) == 0 {
+		return fmt.Errorf("warmup requires model slugs or --all-starred")
+	}
+	return server.Warmup(store, cfg, slugs)
+}
 
-		if args[0] == "all" {
-			return server.KillAll()
+// upCommand starts the servers of a stack file
+func upCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	path := stack.DefaultFile
+	if len(c.args) > 0 {
+		path = c.args[0]
+	}
+	return stack.Up(store, cfg, path, c.bool("--prune"))
+}
+
+// downCommand stops the servers of the last up
+func downCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return stack.Down(store, cfg)
+}
+
+// psCommand shows the running servers, or watches them
+func psCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if c.bool("--watch") {
+		ctx, stop := ui.Interruptible(context.Background())
+		defer stop()
+		return server.Watch(ctx, store, cfg, server.WatchOptions{Running: true})
+	}
+	return server.ListProcesses(store)
+}
+
+// logsCommand prints a model's server log
+func logsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := server.LogOptions{Tail: c.int("--tail"), Follow: c.bool("--follow")}
+	if opts.Tail < 0 {
+		return fmt.Errorf("invalid --tail: %d", opts.Tail)
+	}
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return server.Logs(ctx, store, cfg, c.args[0], opts)
+}
+
+// serveCommand serves the OpenAI-compatible API
+func serveCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	host, tailscaleServe := c.string("--host"), c.bool("--tailscale-serve")
+	opts := server.ServeOptions{Host: "127.0.0.1", Port: c.int("--port"), TailscaleServe: tailscaleServe, UI: c.bool("--ui")}
+	if opts.Port < 1 || opts.Port > 65535 {
+		return fmt.Errorf("invalid --port value: %d", opts.Port)
+	}
+	// /healthz also reports the models of a stack that stopped
+	opts.Expected = func() []string {
+		slugs, err := stack.Slugs(cfg)
+		if err != nil {
+			ui.Debug("Reading the stack for /healthz", "error", err)
 		}
-		return server.Kill(args[0])
+		return slugs
+	}
+	if host != "" {
+		opts.Host = host
+	}
+	var err error
+	if c.bool("--tailscale") || tailscaleServe {
+		if host != "" {
+			return fmt.Errorf("--host and --tailscale can't be used together; --tailscale listens on the Tailscale address")
+		}
+		// Only the tailnet can reach the Tailscale address
+		if opts.Host, err = server.TailscaleAddress(); err != nil {
+			return err
+		}
+		opts.Tailnet = true
+	}
+	if auth := c.string("--auth"); auth == "basic" || auth == "oidc" {
+		if opts.APIKey, err = secrets.New(cfg).Resolve(secrets.ProxyAPIKey); err != nil {
+			return fmt.Errorf("reading %s: %w", secrets.ProxyAPIKey, err)
+		}
+		if opts.APIKey == "" && auth == "basic" {
+			return fmt.Errorf("--auth basic requires a key; store one with 'llm-cli secrets set %s' or set $LLM_CLI_PROXY_API_KEY", secrets.ProxyAPIKey)
+		}
+		opts.User = cfg.Serve.User
+		if opts.User == "" {
+			opts.User = "llm-cli"
+		}
+		if auth == "oidc" {
+			if opts.OIDC, err = oidcOptions(cfg); err != nil {
+				return err
+			}
+		}
+	}
+	ctx, stop := ui.Interruptible(context.Background())
+	defer stop()
+	return server.Serve(ctx, store, cfg, opts)
+}
 
-	case "recent":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("recent", "Get the 20 most recent GGUF models from Hugging Face.", "")
-			return nil
+// metricsCommand prints the Prometheus metrics, or writes them to a file
+func metricsCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if output := c.string("--output"); output != "" {
+		return server.SaveMetrics(output, store, cfg)
+	}
+	return server.WriteMetrics(os.Stdout, store, cfg)
+}
+
+// killCommand stops a model's server, or every server
+func killCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	if c.args[0] == "all" {
+		return server.KillAll(store, cfg)
+	}
+	return server.Kill(store, cfg, c.args[0])
+}
+
+// watchdogCommand stops a server launched with a keep-alive once it has
+// been idle that long
+func watchdogCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	pid, err := strconv.Atoi(c.args[0])
+	if err != nil {
+		return fmt.Errorf("invalid PID: %s", c.args[0])
+	}
+	port, err := strconv.Atoi(c.args[1])
+	if err != nil {
+		return fmt.Errorf("invalid port: %s", c.args[1])
+	}
+	keepAlive, err := time.ParseDuration(c.args[2])
+	if err != nil || keepAlive <= 0 {
+		return fmt.Errorf("invalid keep-alive duration: %s", c.args[2])
+	}
+	return server.Watchdog(store, cfg, pid, port, keepAlive)
+}
+
+// searchCommand searches Hugging Face for GGUF models
+func searchCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	opts := model.SearchOptions{Author: c.string("--author"), Sort: c.string("--sort"), Limit: c.int("--limit"), Page: c.int("--page")}
+	if opts.Sort == "" {
+		opts.Sort = "downloads"
+	}
+	if opts.Limit < 1 {
+		return fmt.Errorf("invalid --limit value: %d", opts.Limit)
+	}
+	if opts.Page < 1 {
+		return fmt.Errorf("invalid --page value: %d", opts.Page)
+	}
+	if len(c.args) == 0 && opts.Author == "" {
+		return fmt.Errorf("search requires a query or --author")
+	}
+	return model.Search(cfg, strings.Join(c.args, " "), opts)
+}
+
+// recentCommand lists the most recent GGUF models
+func recentCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.GetRecent()
+}
+
+// trendingCommand lists trending GGUF models
+func trendingCommand(store *db.Store, cfg *config.Config, c *invocation) error {
+	return model.GetTrending()
+}
+
+// oidcOptions returns the OIDC provider serve --auth oidc signs in with,
+// from the serve.oidc settings and the oidc-client-secret secret
+func oidcOptions(cfg *config.Config) (*server.OIDCOptions, error) {
+	oidc := cfg.Serve.OIDC
+	if oidc.Issuer == "" || oidc.ClientID == "" {
+		return nil, fmt.Errorf("--auth oidc requires a provider; set serve.oidc.issuer and serve.oidc.client-id with 'llm-cli config set'")
+	}
+	if len(oidc.Allow) == 0 {
+		return nil, fmt.Errorf("--auth oidc requires the users to let in; set serve.oidc.allow to a list of emails, e.g. '[\"me@example.com\"]'")
+	}
+	clientSecret, err := secrets.New(cfg).Resolve(secrets.OIDCClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", secrets.OIDCClientSecret, err)
+	}
+	if clientSecret == "" {
+		return nil, fmt.Errorf("--auth oidc requires the client secret; store it with 'llm-cli secrets set %s' or set $LLM_CLI_OIDC_CLIENT_SECRET", secrets.OIDCClientSecret)
+	}
+	return &server.OIDCOptions{
+		Issuer:       oidc.Issuer,
+		ClientID:     oidc.ClientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  oidc.RedirectURL,
+		Allow:        oidc.Allow,
+	}, nil
+}
+
+// serverOverrides returns the llama-server setting flags given, such as
+// --ngl 99 or --flash-attn, keyed by setting name
+func serverOverrides(c *invocation) map[string]string {
+	overrides := make(map[string]string)
+	for _, setting := range server.Settings {
+		if setting.Server && c.given("--"+setting.Name) {
+			overrides[setting.Name] = c.string("--" + setting.Name)
 		}
-		return model.GetRecent()
+	}
+	return overrides
+}
 
-	case "trending":
-		if len(args) > 0 && args[0] == "--help" {
-			ui.PrintHelp("trending", "Get trending GGUF models from Hugging Face.", "")
-			return nil
+// responseFormat reads the --format and --retries flags of run and chat,
+// and reports whether replies must be JSON and how often to retry replies
+// that aren't
+func responseFormat(c *invocation) (bool, int, error) {
+	if c.string("--format") != "json" {
+		if c.given("--retries") {
+			return false, 0, fmt.Errorf("--retries requires --format json")
 		}
-		return model.GetTrending()
+		return false, 0, nil
+	}
+	retries := c.int("--retries")
+	if retries < 0 {
+		return false, 0, fmt.Errorf("invalid --retries value: %d", retries)
+	}
+	return true, retries, nil
+}
+
+// withStdin appends piped standard input to text, so content can be piped
+// in instead of, or as well as, given on the command line
+func withStdin(text string) (string, error) {
+	if ui.IsInteractive() {
+		return text, nil
+	}
 
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading standard input: %w", err)
+	}
+
+	piped := strings.TrimRight(string(data), "\r\n")
+	switch {
+	case piped == "":
+		return text, nil
+	case text == "":
+		return piped, nil
 	default:
-		ui.PrintUsage()
-		return fmt.Errorf("unknown command: %s", cmd)
+		return text + "\n\n" + piped, nil
+	}
+}
+
+// sameFile reports whether paths a and b name the same existing file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-}
\ No newline at end of file
+	return items
+}
+
+// splitCounts parses a comma-separated list of positive integers given
+// for flag, returning defaults when the list is empty
+func splitCounts(flag, list string, defaults []int) ([]int, error) {
+	if list == "" {
+		return defaults, nil
+	}
+	var counts []int
+	for _, item := range splitList(list) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid %s value: %s", flag, item)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The tests run the test binary itself as llm-cli, with the mock backend
+// answering in place of a model server, and check what it prints
+func TestMain(m *testing.M) {
+	if os.Getenv("LLM_CLI_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// llmCLI returns a command running llm-cli with args in its own home
+func llmCLI(t *testing.T, home, stdin string, args ...string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if name == "HOME" || name == "USERPROFILE" || name == "API_URL" || strings.HasPrefix(name, "LLM_CLI_") {
+			continue
+		}
+		cmd.Env = append(cmd.Env, env)
+	}
+	cmd.Env = append(cmd.Env, "LLM_CLI_TEST_MAIN=1", "HOME="+home, "USERPROFILE="+home)
+	cmd.Stdin = strings.NewReader(stdin)
+	return cmd
+}
+
+// runCLI runs llm-cli to the end and returns what it printed to stdout
+func runCLI(t *testing.T, home, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := llmCLI(t, home, stdin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	return stdout.String(), err
+}
+
+// mustRunCLI is runCLI for commands that must succeed
+func mustRunCLI(t *testing.T, home, stdin string, args ...string) string {
+	t.Helper()
+	out, err := runCLI(t, home, stdin, args...)
+	if err != nil {
+		t.Fatalf("llm-cli %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestRunMock(t *testing.T) {
+	home := t.TempDir()
+
+	if out := mustRunCLI(t, home, "", "--quiet", "--backend", "mock://?reply=pong", "run", "mock-model", "ping"); out != "pong\n" {
+		t.Errorf("run printed %q, want %q", out, "pong\n")
+	}
+
+	// After --, a prompt can start with a dash
+	if out := mustRunCLI(t, home, "", "--quiet", "--backend", "mock://?echo=true", "run", "mock-model", "--", "--top", "3"); out != "--top 3\n" {
+		t.Errorf("run with -- printed %q, want the prompt echoed", out)
+	}
+
+	out := mustRunCLI(t, home, "", "--backend", "mock", "run", "mock-model", "hello")
+	if !strings.Contains(out, "This is a reply from the mock backend.") {
+		t.Errorf("run printed %q, want the mock backend's reply", out)
+	}
+
+	_, err := runCLI(t, home, "", "--backend", "mock://?error_rate=1", "run", "mock-model", "hello")
+	if err == nil || !strings.Contains(err.Error(), "injected failure from the mock backend") {
+		t.Errorf("run with every request failing = %v, want the injected failure", err)
+	}
+
+	_, err = runCLI(t, home, "", "--backend", "mock", "run", "mock-model", "--top", "3", "hello")
+	if err == nil || !strings.Contains(err.Error(), "unknown flag --top for run") {
+		t.Errorf("run --top = %v, want an unknown flag error", err)
+	}
+}
+
+func TestChatMock(t *testing.T) {
+	home := t.TempDir()
+	out := mustRunCLI(t, home, "first\nsecond\nexit\n", "--backend", "mock://?echo=true", "chat", "mock-model", "--session", "echoes")
+	for _, reply := range []string{"first", "second"} {
+		if !strings.Contains(out, reply) {
+			t.Errorf("chat printed %q, want the reply %q", out, reply)
+		}
+	}
+
+	// The conversation was saved under the session's name
+	path := filepath.Join(t.TempDir(), "echoes.json")
+	mustRunCLI(t, home, "", "sessions", "export", "echoes", "-o", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session struct {
+		Model    string
+		Messages []struct{ Role, Content string }
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		t.Fatalf("parsing the exported session: %v", err)
+	}
+	var got []string
+	for _, message := range session.Messages {
+		got = append(got, message.Role+": "+message.Content)
+	}
+	want := []string{"user: first", "assistant: first", "user: second", "assistant: second"}
+	if session.Model != "mock-model" || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("saved session for %s:\n%s\nwant for mock-model:\n%s", session.Model, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEmbedMock(t *testing.T) {
+	home := t.TempDir()
+	out := mustRunCLI(t, home, "", "--quiet", "--backend", "mock", "embed", "mock-model", "hello")
+	var result []struct {
+		Index     int
+		Embedding [][]float64
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("embed printed %q: %v", out, err)
+	}
+	if len(result) != 1 || len(result[0].Embedding) != 1 || len(result[0].Embedding[0]) == 0 {
+		t.Fatalf("embed printed %q, want one vector", out)
+	}
+
+	// The same text gets the same vector, in a file of one per line
+	dir := t.TempDir()
+	texts, vectors := filepath.Join(dir, "texts.txt"), filepath.Join(dir, "vectors.jsonl")
+	if err := os.WriteFile(texts, []byte("hello\nworld\nhello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mustRunCLI(t, home, "", "--quiet", "--backend", "mock", "embed", "mock-model", "--file", texts, "-o", vectors)
+	data, err := os.ReadFile(vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type vector struct {
+		ID        int
+		Embedding []float64
+	}
+	var lines []vector
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var v vector
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("parsing %q: %v", line, err)
+		}
+		lines = append(lines, v)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("embed --file wrote %d vectors, want 3", len(lines))
+	}
+	if fmt.Sprint(lines[0].Embedding) != fmt.Sprint(result[0].Embedding[0]) || fmt.Sprint(lines[0].Embedding) != fmt.Sprint(lines[2].Embedding) {
+		t.Error("embed --file gave the same text different vectors")
+	}
+	if fmt.Sprint(lines[0].Embedding) == fmt.Sprint(lines[1].Embedding) {
+		t.Error("embed --file gave different texts the same vector")
+	}
+}
+
+func TestServeMock(t *testing.T) {
+	home := t.TempDir()
+	// serve only answers for installed models
+	modelDir := filepath.Join(home, ".cache", "llm-cli", "models", "test", "tiny")
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(modelDir, "tiny-Q4_K_M.gguf"), []byte("GGUF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mustRunCLI(t, home, "", "import")
+
+	port := freePort(t)
+	cmd := llmCLI(t, home, "", "--backend", "mock://?reply=served", "serve", "--port", fmt.Sprint(port))
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	defer func() {
+		if runtime.GOOS == "windows" {
+			cmd.Process.Kill()
+		} else {
+			cmd.Process.Signal(os.Interrupt)
+		}
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			t.Errorf("serve didn't stop when interrupted:\n%s", output.String())
+		}
+	}()
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	var models struct {
+		Data []struct{ ID string }
+	}
+	for start := time.Now(); ; time.Sleep(50 * time.Millisecond) {
+		resp, err := http.Get(base + "/v1/models")
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&models)
+			resp.Body.Close()
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("serve didn't start listening: %v\n%s", err, output.String())
+		}
+	}
+	if len(models.Data) != 1 || models.Data[0].ID != "test-tiny" {
+		t.Fatalf("/v1/models = %+v, want test-tiny", models.Data)
+	}
+
+	resp, err := http.Post(base+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model": "test-tiny", "messages": [{"role": "user", "content": "hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct{ Content string }
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&completion)
+	resp.Body.Close()
+	if err != nil || len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "served" {
+		t.Errorf("chat completion = %+v, %v; want the reply \"served\"", completion, err)
+	}
+
+	resp, err = http.Post(base+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model": "test-tiny", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct{ Content string }
+			}
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err == nil && len(chunk.Choices) > 0 {
+			streamed.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	resp.Body.Close()
+	if streamed.String() != "served" {
+		t.Errorf("streamed chat completion = %q, want \"served\"", streamed.String())
+	}
+
+	resp, err = http.Post(base+"/v1/chat/completions", "application/json", strings.NewReader(`{"model": "missing"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a request for a model that isn't installed got %s, want 404", resp.Status)
+	}
+}
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
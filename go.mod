@@ -2,4 +2,10 @@ module github.com/garyblankenship/llmcli
 
 go 1.21
 
-require github.com/mattn/go-sqlite3 v1.14.24
\ No newline at end of file
+require (
+	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.28.0 // indirect
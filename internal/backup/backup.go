@@ -0,0 +1,442 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+	"github.com/garyblankenship/llmcli/internal/vault"
+)
+
+// Files of the synced state
+const (
+	configFile   = "config.json" // the config file without machine-local settings
+	stateFile    = "state.db"    // sessions, history, model settings and snapshots
+	manifestFile = "models.json" // the installed models, without their weights
+)
+
+// localKeys are config file settings that describe one machine, so they are
+// neither pushed nor replaced by a pull
+var localKeys = []string{"hf_token", "hardware_profile", "memory_budget", "sync", "encryption"}
+
+// manifestEntry is an installed model as listed in the manifest
+type manifestEntry struct {
+	Slug     string `json:"slug"`
+	ModelID  string `json:"model_id"`
+	FileName string `json:"file_name"`
+	FileSize string `json:"file_size"`
+	Quant    string `json:"quant,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// Setup makes remote the place 'sync push' and 'sync pull' keep the state.
+// kind is git or rclone; when empty it is guessed from remote, which is
+// taken as an rclone remote when it looks like name:path and as a git
+// repository otherwise.
+func Setup(cfg *config.Config, remote, kind string) error {
+	if kind == "" {
+		kind = remoteType(remote)
+	}
+	if info, err := os.Stat(remote); err == nil && info.IsDir() {
+		if abs, err := filepath.Abs(remote); err == nil {
+			remote = abs
+		}
+	}
+
+	dir := syncDir(cfg)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clearing %s: %w", dir, err)
+	}
+	switch kind {
+	case "git":
+		if _, err := exec.LookPath("git"); err != nil {
+			return fmt.Errorf("syncing with a git repository needs git installed")
+		}
+		cmd := exec.Command("git", "clone", "--quiet", remote, dir)
+		ui.LogCommand(cmd)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("cloning %s: %s", remote, commandError(out, err))
+		}
+	case "rclone":
+		if _, err := exec.LookPath("rclone"); err != nil {
+			return fmt.Errorf("syncing with an rclone remote needs rclone installed (https://rclone.org/install/)")
+		}
+		if _, err := rclone("mkdir", remote); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating %s: %w", dir, err)
+		}
+	default:
+		return fmt.Errorf("unknown sync type %q (expected git or rclone)", kind)
+	}
+
+	value, err := json.Marshal(config.SyncConfig{Remote: remote, Type: kind})
+	if err != nil {
+		return fmt.Errorf("encoding sync settings: %w", err)
+	}
+	if err := config.Set(cfg, "sync", string(value)); err != nil {
+		return err
+	}
+	cfg.Sync = config.SyncConfig{Remote: remote, Type: kind}
+	ui.PrintInfo("Run 'llm-cli sync push' to copy this machine's state there, or 'llm-cli sync pull' to copy it here.")
+	return nil
+}
+
+// Push copies the config file, the database without the model weights,
+// caches and indexes, and a manifest of the installed models to the sync
+// remote
+func Push(store *db.Store, cfg *config.Config) error {
+	dir, err := fetch(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeState(store, cfg, dir); err != nil {
+		return err
+	}
+
+	switch cfg.Sync.Type {
+	case "git":
+		if _, err := git(dir, "add", "--all"); err != nil {
+			return err
+		}
+		if changes, err := git(dir, "status", "--porcelain"); err != nil {
+			return err
+		} else if changes == "" {
+			ui.PrintInfo(fmt.Sprintf("Nothing changed since the last push to %s.", cfg.Sync.Remote))
+			return nil
+		}
+		host, _ := os.Hostname()
+		if _, err := git(dir, "config", "user.email"); err != nil {
+			// The commits need an author even where git isn't set up
+			git(dir, "config", "user.name", "llm-cli")
+			git(dir, "config", "user.email", "llm-cli@"+host)
+		}
+		if _, err := git(dir, "commit", "--quiet", "-m", "Sync from "+host); err != nil {
+			return err
+		}
+		if _, err := git(dir, "push", "--quiet", "origin", "HEAD"); err != nil {
+			return err
+		}
+	case "rclone":
+		if _, err := rclone("sync", dir, cfg.Sync.Remote); err != nil {
+			return err
+		}
+	}
+	ui.PrintInfo(fmt.Sprintf("Pushed the llm-cli state to %s.", cfg.Sync.Remote))
+	return nil
+}
+
+// Pull replaces the config file settings, sessions, history, model settings
+// and snapshots with those last pushed to the sync remote, saving the
+// replaced state first, and lists the models in the manifest that aren't
+// installed here. Machine-local settings such as the hardware profile are
+// kept.
+func Pull(store *db.Store, cfg *config.Config) error {
+	dir, err := fetch(cfg)
+	if err != nil {
+		return err
+	}
+	statePath := filepath.Join(dir, stateFile)
+	if _, err := os.Stat(statePath); err != nil {
+		return fmt.Errorf("nothing has been pushed to %s yet", cfg.Sync.Remote)
+	}
+	salt, check, err := checkVault(store, cfg, statePath)
+	if err != nil {
+		return err
+	}
+
+	saved := filepath.Join(cfg.CacheDir, "sync-backups", time.Now().Format("20060102-150405"))
+	if err := writeState(store, cfg, saved); err != nil {
+		return fmt.Errorf("saving the current state: %w", err)
+	}
+	// Keep the whole config file, local settings included
+	if data, err := os.ReadFile(cfg.ConfigPath); err == nil {
+		if err := os.WriteFile(filepath.Join(saved, configFile), data, 0600); err != nil {
+			return fmt.Errorf("saving the current state: %w", err)
+		}
+	}
+	if err := applyConfig(cfg, filepath.Join(dir, configFile)); err != nil {
+		return err
+	}
+	if err := store.ImportState(statePath); err != nil {
+		return err
+	}
+	if check != "" {
+		// Take on the key the pulled rows are sealed with
+		if err := store.SetMeta("vault_salt", salt); err != nil {
+			return err
+		}
+		if err := store.SetMeta("vault_check", check); err != nil {
+			return err
+		}
+		if !cfg.Encryption.Enabled {
+			ui.PrintWarn("The pulled sessions and history are encrypted. Turn on encryption here with the same passphrase or key to read them.")
+		}
+	}
+	ui.PrintInfo(fmt.Sprintf("Pulled the llm-cli state from %s. The state it replaced is in %s.", cfg.Sync.Remote, saved))
+	return reportMissing(store, filepath.Join(dir, manifestFile))
+}
+
+// checkVault makes sure this machine can read the encrypted rows of the
+// state at path. Each machine keeps its own key, so they must be sealed
+// with the key this machine has, or this machine must not have one yet;
+// then the salt and check value of the pulled key are returned, to be
+// stored along with the state.
+func checkVault(store *db.Store, cfg *config.Config, path string) (string, string, error) {
+	salt, check, err := db.StateVault(path)
+	if err != nil || check == "" {
+		return "", "", err
+	}
+	localSalt, err := store.GetMeta("vault_salt")
+	if err != nil {
+		return "", "", err
+	}
+	localCheck, err := store.GetMeta("vault_check")
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case localCheck == "":
+		return salt, check, nil
+	case localCheck == check && localSalt == salt:
+		return "", "", nil
+	}
+
+	v, err := vault.Unlock(cfg, store)
+	if err != nil {
+		return "", "", fmt.Errorf("unlocking this machine's encrypted history to compare keys: %w", err)
+	}
+	if !v.Matches(check) {
+		return "", "", fmt.Errorf("the pulled sessions and history are encrypted with a different key than this machine's, so they couldn't be read here; nothing was changed")
+	}
+	return "", "", nil
+}
+
+// fetch brings the sync directory up to date with the remote and returns it
+func fetch(cfg *config.Config) (string, error) {
+	if cfg.Sync.Remote == "" {
+		return "", fmt.Errorf("no sync remote is set up; run 'llm-cli sync setup <remote>' first")
+	}
+	dir := syncDir(cfg)
+
+	switch cfg.Sync.Type {
+	case "git":
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			return "", fmt.Errorf("the copy of %s is missing; run 'llm-cli sync setup %s' again", cfg.Sync.Remote, cfg.Sync.Remote)
+		}
+		if _, err := git(dir, "fetch", "--quiet", "origin"); err != nil {
+			return "", err
+		}
+		branch, err := git(dir, "symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return "", err
+		}
+		if _, err := git(dir, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch); err != nil {
+			// Nothing has been pushed yet
+			return dir, nil
+		}
+		// The state is written whole on every push, so the remote's
+		// version simply replaces the local copy
+		if _, err := git(dir, "reset", "--quiet", "--hard", "origin/"+branch); err != nil {
+			return "", err
+		}
+	case "rclone":
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("creating %s: %w", dir, err)
+		}
+		if _, err := rclone("sync", cfg.Sync.Remote, dir); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown sync type %q (expected git or rclone)", cfg.Sync.Type)
+	}
+	return dir, nil
+}
+
+// writeState writes the config file, the database state and the manifest
+// to dir
+func writeState(store *db.Store, cfg *config.Config, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	settings, err := readSettings(cfg.ConfigPath)
+	if err != nil {
+		return err
+	}
+	for _, key := range localKeys {
+		delete(settings, key)
+	}
+	if err := writeJSON(filepath.Join(dir, configFile), settings); err != nil {
+		return err
+	}
+
+	if err := store.ExportState(filepath.Join(dir, stateFile)); err != nil {
+		return err
+	}
+
+	models, err := store.GetAllModels()
+	if err != nil {
+		return fmt.Errorf("retrieving models: %w", err)
+	}
+	manifest := []manifestEntry{}
+	for _, m := range models {
+		manifest = append(manifest, manifestEntry{
+			Slug: m.Slug, ModelID: m.ModelID, FileName: m.FileName, FileSize: m.FileSize,
+			Quant: m.Quant, Revision: m.Revision, SHA256: m.SHA256,
+		})
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Slug < manifest[j].Slug })
+	return writeJSON(filepath.Join(dir, manifestFile), manifest)
+}
+
+// applyConfig replaces the config file with the pulled one, keeping this
+// machine's local settings
+func applyConfig(cfg *config.Config, pulled string) error {
+	settings, err := readSettings(pulled)
+	if err != nil {
+		return err
+	}
+	local, err := readSettings(cfg.ConfigPath)
+	if err != nil {
+		return err
+	}
+	for _, key := range localKeys {
+		delete(settings, key)
+		if value, ok := local[key]; ok {
+			settings[key] = value
+		}
+	}
+
+	tmp := cfg.ConfigPath + ".tmp"
+	if err := writeJSON(tmp, settings); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cfg.ConfigPath); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	return nil
+}
+
+// reportMissing lists the models in the manifest that aren't installed,
+// with the commands that download them
+func reportMissing(store *db.Store, path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	var manifest []manifestEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	var missing []manifestEntry
+	for _, entry := range manifest {
+		if _, err := store.GetModelBySlug(entry.Slug); err != nil {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	ui.PrintWarn(fmt.Sprintf("%d synced models aren't installed here. Download them with:", len(missing)))
+	for _, entry := range missing {
+		command := "llm-cli pull " + entry.ModelID
+		if entry.Quant != "" {
+			command += " --quant " + strings.ToLower(entry.Quant)
+		}
+		fmt.Printf("  %s  # %s, %s\n", command, entry.Slug, entry.FileSize)
+	}
+	return nil
+}
+
+// readSettings reads a config file as generic JSON; a missing file has no
+// settings
+func readSettings(path string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// writeJSON writes v to path as indented JSON, readable only by the
+// current user since a config file can hold tokens
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", filepath.Base(path), err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// syncDir is the local copy of the sync remote
+func syncDir(cfg *config.Config) string {
+	return filepath.Join(cfg.CacheDir, "sync")
+}
+
+// remoteType guesses whether remote is a git repository or an rclone remote
+func remoteType(remote string) string {
+	if strings.HasSuffix(remote, ".git") || strings.Contains(remote, "://") || strings.HasPrefix(remote, "git@") {
+		return "git"
+	}
+	if _, err := os.Stat(remote); err == nil {
+		return "git"
+	}
+	if name, _, ok := strings.Cut(remote, ":"); ok && name != "" && !strings.ContainsAny(name, `/\.@`) {
+		return "rclone"
+	}
+	return "git"
+}
+
+// git runs git in dir and returns what it printed
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	ui.LogCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], commandError(out, err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// rclone runs rclone and returns what it printed
+func rclone(args ...string) (string, error) {
+	cmd := exec.Command("rclone", args...)
+	ui.LogCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("rclone %s: %s", args[0], commandError(out, err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commandError describes a failed command by what it printed, or by its
+// exit status when it printed nothing
+func commandError(out []byte, err error) string {
+	if message := strings.TrimSpace(string(out)); message != "" {
+		return message
+	}
+	return err.Error()
+}
@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/vault"
+)
+
+func TestCheckVault(t *testing.T) {
+	dir := t.TempDir()
+	// Machines sharing a key in the file-backed secret store
+	cfg := &config.Config{}
+	cfg.Encryption.KeySource = "keychain"
+	cfg.Secrets = config.SecretsConfig{Backend: "file", FilePath: filepath.Join(dir, "secrets.json")}
+	otherKey := *cfg
+	otherKey.Secrets.FilePath = filepath.Join(dir, "other-secrets.json")
+
+	// machine returns a store sealed with cfg's key, or an unsealed one
+	// when cfg is nil, and the path of its exported state
+	machine := func(name string, cfg *config.Config) (*db.Store, string) {
+		store, err := db.New(filepath.Join(dir, name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		if cfg != nil {
+			if _, err := vault.Unlock(cfg, store); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path := filepath.Join(dir, name+"-state.db")
+		if err := store.ExportState(path); err != nil {
+			t.Fatal(err)
+		}
+		return store, path
+	}
+	plain, plainState := machine("plain", nil)
+	sealed, sealedState := machine("sealed", cfg)
+	_, sameKeyState := machine("same-key", cfg)
+	_, otherKeyState := machine("other-key", &otherKey)
+	check, _ := sealed.GetMeta("vault_check")
+	salt, _ := sealed.GetMeta("vault_salt")
+
+	tests := []struct {
+		name        string
+		store       *db.Store
+		state       string
+		salt, check string
+		err         string
+	}{
+		{"nothing sealed", plain, plainState, "", "", ""},
+		{"unsealed here", sealed, plainState, "", "", ""},
+		{"sealed there only", plain, sealedState, salt, check, ""},
+		{"same state", sealed, sealedState, "", "", ""},
+		{"same key", sealed, sameKeyState, "", "", ""},
+		{"other key", sealed, otherKeyState, "", "", "encrypted with a different key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSalt, gotCheck, err := checkVault(tt.store, cfg, tt.state)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("checkVault = %v, want no error", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("checkVault = %v, want an error containing %q", err, tt.err)
+			}
+			if gotSalt != tt.salt || gotCheck != tt.check {
+				t.Errorf("checkVault = %q, %q; want %q, %q", gotSalt, gotCheck, tt.salt, tt.check)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Default workloads: a short, a medium and a long prompt, each followed by
+// a short and a long generation
+var (
+	DefaultPromptTokens = []int{128, 512, 2048}
+	DefaultNPredict     = []int{64, 256}
+)
+
+// Options controls a benchmark run
+type Options struct {
+	PromptTokens []int             // prompt lengths to measure
+	NPredict     []int             // generation lengths to measure
+	Repeat       int               // runs averaged per workload
+	Overrides    map[string]string // server settings; restarts the server with them applied
+}
+
+// workload is one prompt length and generation length
+type workload struct {
+	promptTokens, nPredict int
+}
+
+// Run measures prompt evaluation and generation speed, time to first token
+// and memory use of a model for every combination of prompt and generation
+// length, and records the results for comparison with other models and
+// settings
+func Run(store *db.Store, cfg *config.Config, slug string, opts Options) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+
+	settings := ""
+	if !cfg.RemoteBackend() {
+		args, err := server.SettingArgs(store, cfg, model, opts.Overrides)
+		if err != nil {
+			return err
+		}
+		settings = strings.Join(args, " ")
+	}
+
+	pid := 0
+	if len(opts.Overrides) > 0 {
+		if pid, err = server.StartServer(store, cfg, slug, opts.Overrides); err != nil {
+			return err
+		}
+		// Leave no benchmark server behind; the next use starts with the stored settings
+		defer func() {
+			if err := server.StopServer(store, cfg, model.FilePath); err != nil {
+				ui.PrintWarn(err.Error())
+			}
+		}()
+	} else {
+		if err := server.EnsureServerRunning(store, cfg, slug); err != nil {
+			return err
+		}
+		pid = server.ServerPID(store, slug)
+	}
+	modelCfg, err := server.ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
+
+	var workloads []workload
+	for _, p := range opts.PromptTokens {
+		for _, n := range opts.NPredict {
+			workloads = append(workloads, workload{p, n})
+		}
+	}
+	ui.PrintInfo(fmt.Sprintf("Benchmarking %s with %d workloads...", slug, len(workloads)))
+
+	// Warm up once so model loading doesn't skew the first measurement
+	if _, err := server.CompleteTimed(modelCfg, "Hello", 8); err != nil {
+		return fmt.Errorf("warming up: %w", err)
+	}
+
+	var results []db.BenchResult
+	for i, w := range workloads {
+		ui.PrintInfo(fmt.Sprintf("[%d/%d] %d prompt tokens, %d generated", i+1, len(workloads), w.promptTokens, w.nPredict))
+		result, err := measure(modelCfg, w, opts.Repeat)
+		if err != nil {
+			ui.PrintWarn(fmt.Sprintf("%d prompt tokens, %d generated failed: %v", w.promptTokens, w.nPredict, err))
+			continue
+		}
+		result.Slug, result.Settings = slug, settings
+		if pid > 0 {
+			result.MemoryBytes, _ = server.ProcessMemory(pid)
+		}
+		if err := store.AddBenchResult(*result); err != nil {
+			return err
+		}
+		results = append(results, *result)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no workload completed")
+	}
+
+	printResults(results, false)
+	return nil
+}
+
+// measure runs a workload repeat times and averages the measurements
+func measure(cfg *config.Config, w workload, repeat int) (*db.BenchResult, error) {
+	prompt, err := server.BenchPrompt(cfg, w.promptTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &db.BenchResult{PromptTokens: w.promptTokens, NPredict: w.nPredict}
+	for i := 0; i < repeat; i++ {
+		timings, firstToken, err := server.CompleteStreamTimed(cfg, prompt, w.nPredict)
+		if err != nil {
+			return nil, err
+		}
+		result.PromptTPS += timings.PromptPerSecond / float64(repeat)
+		result.GenTPS += timings.PredictedPerSecond / float64(repeat)
+		result.TTFTMS += float64(firstToken.Microseconds()) / 1000 / float64(repeat)
+	}
+	return result, nil
+}
+
+// Results prints the recorded benchmark results of the given models, or of
+// every model, grouped by workload with the fastest generation first
+func Results(store *db.Store, slugs []string) error {
+	results, err := store.GetBenchResults(slugs)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		ui.PrintInfo("No benchmark results recorded. Run 'llm-cli bench <slug>' first.")
+		return nil
+	}
+	printResults(results, true)
+	return nil
+}
+
+// printResults prints results as a table, with the model, date and
+// settings of each when listing recorded history
+func printResults(results []db.BenchResult, history bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "PROMPT\tGEN\tPROMPT T/S\tGEN T/S\tTTFT\tMEMORY"
+	if history {
+		header = "MODEL\tDATE\t" + header + "\tSETTINGS"
+	}
+	fmt.Fprintln(w, header)
+	for _, r := range results {
+		row := fmt.Sprintf("%d\t%d\t%.1f\t%.1f\t%s\t%s", r.PromptTokens, r.NPredict, r.PromptTPS, r.GenTPS,
+			formatTTFT(r.TTFTMS), formatMemory(r.MemoryBytes))
+		if history {
+			row = r.Slug + "\t" + r.CreatedAt.Local().Format("2006-01-02 15:04") + "\t" + row + "\t" + r.Settings
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+}
+
+// formatTTFT formats a time to first token, e.g. "85ms" or "1.42s"
+func formatTTFT(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", ms/1000)
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
+
+// formatMemory formats resident memory in MiB, or "-" when unknown
+func formatMemory(bytes int64) string {
+	if bytes <= 0 {
+		return "-"
+	}
+	return strconv.FormatInt(bytes/(1024*1024), 10) + "M"
+}
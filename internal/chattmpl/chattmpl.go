@@ -0,0 +1,124 @@
+// Package chattmpl recognizes the chat prompt format a model was trained
+// with from its GGUF metadata.
+package chattmpl
+
+import (
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/gguf"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string // "system", "user" or "assistant"
+	Content string
+}
+
+// Format is a family of chat prompt formats
+type Format struct {
+	Name    string
+	markers []string // substrings of a chat template that identify the format
+	Stops   []string // text that ends the assistant's turn
+	render  func(messages []Message) string
+}
+
+// formats is checked in order; more specific formats come first
+var formats = []Format{
+	{Name: "chatml", markers: []string{"<|im_start|>"}, Stops: []string{"<|im_end|>", "<|im_start|>"}, render: renderChatML},
+	{Name: "llama3", markers: []string{"<|start_header_id|>"}, Stops: []string{"<|eot_id|>", "<|start_header_id|>"}, render: renderLlama3},
+	{Name: "gemma", markers: []string{"<start_of_turn>"}, Stops: []string{"<end_of_turn>", "<start_of_turn>"}, render: renderGemma},
+	{Name: "phi3", markers: []string{"<|user|>", "<|end|>"}, Stops: []string{"<|end|>", "<|user|>"}, render: renderPhi3},
+	{Name: "zephyr", markers: []string{"<|user|>"}, Stops: []string{"</s>", "<|user|>"}, render: renderZephyr},
+	{Name: "deepseek", markers: []string{"<｜User｜>"}, Stops: []string{"<｜end▁of▁sentence｜>", "<｜User｜>"}, render: renderDeepSeek},
+	{Name: "mistral", markers: []string{"[INST]"}, Stops: []string{"</s>", "[INST]"}, render: renderMistral},
+	{Name: "alpaca", markers: []string{"### Instruction:"}, Stops: []string{"### Instruction:"}, render: renderAlpaca},
+}
+
+// Fallback is the plain Human/Assistant format used for models whose
+// template isn't recognized
+var Fallback = &Format{Name: "human-assistant", Stops: []string{"\n### Human:"}, render: renderFallback}
+
+// Render formats a conversation as a prompt ending where the assistant's
+// next reply begins
+func (f *Format) Render(messages []Message) string {
+	return f.render(messages)
+}
+
+// Detect returns the format a chat template uses, or nil if it isn't recognized
+func Detect(template string) *Format {
+	for i := range formats {
+		matched := true
+		for _, marker := range formats[i].markers {
+			if !strings.Contains(template, marker) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &formats[i]
+		}
+	}
+	return nil
+}
+
+// Template is the chat template and special tokens of a model
+type Template struct {
+	Source string  // Jinja source from tokenizer.chat_template; empty if the model has none
+	Format *Format // recognized format, nil if unknown
+	EOS    string  // end-of-sequence token text
+	EOT    string  // end-of-turn token text, if the model defines one
+}
+
+// FromGGUF reads the chat template and special tokens from a GGUF file
+func FromGGUF(path string) (*Template, error) {
+	f, err := gguf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{}
+	t.Source, _ = f.String("tokenizer.chat_template")
+	t.Format = Detect(t.Source)
+	t.EOS = tokenText(f, "tokenizer.ggml.eos_token_id")
+	t.EOT = tokenText(f, "tokenizer.ggml.eot_token_id")
+	return t, nil
+}
+
+// Stops returns the stop sequences that end an assistant turn for this model
+func (t *Template) Stops() []string {
+	var stops []string
+	if t.Format != nil {
+		stops = append(stops, t.Format.Stops...)
+	}
+	stops = append(stops, t.EOT, t.EOS)
+
+	seen := make(map[string]bool)
+	unique := stops[:0]
+	for _, stop := range stops {
+		if stop != "" && !seen[stop] {
+			seen[stop] = true
+			unique = append(unique, stop)
+		}
+	}
+	return unique
+}
+
+// tokenText looks up the text of the token whose id is stored under key
+func tokenText(f *gguf.File, key string) string {
+	id, ok := f.Uint(key)
+	if !ok {
+		return ""
+	}
+
+	kv, ok := f.Get("tokenizer.ggml.tokens")
+	if !ok {
+		return ""
+	}
+	tokens, ok := kv.Value.(gguf.Array)
+	if !ok || id >= uint64(len(tokens.Values)) {
+		return ""
+	}
+
+	text, _ := tokens.Values[id].(string)
+	return text
+}
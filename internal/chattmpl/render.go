@@ -0,0 +1,130 @@
+package chattmpl
+
+import (
+	"strings"
+)
+
+// The renderers below reproduce the common chat templates without a Jinja
+// engine. They leave out the beginning-of-sequence token, which llama-server
+// adds when it tokenizes the prompt.
+
+func renderChatML(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString("<|im_start|>" + m.Role + "\n" + m.Content + "<|im_end|>\n")
+	}
+	b.WriteString("<|im_start|>assistant\n")
+	return b.String()
+}
+
+func renderLlama3(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString("<|start_header_id|>" + m.Role + "<|end_header_id|>\n\n" + strings.TrimSpace(m.Content) + "<|eot_id|>")
+	}
+	b.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	return b.String()
+}
+
+func renderGemma(messages []Message) string {
+	var b strings.Builder
+	for _, m := range foldSystem(messages) {
+		role := m.Role
+		if role == "assistant" {
+			role = "model"
+		}
+		b.WriteString("<start_of_turn>" + role + "\n" + strings.TrimSpace(m.Content) + "<end_of_turn>\n")
+	}
+	b.WriteString("<start_of_turn>model\n")
+	return b.String()
+}
+
+func renderPhi3(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString("<|" + m.Role + "|>\n" + m.Content + "<|end|>\n")
+	}
+	b.WriteString("<|assistant|>\n")
+	return b.String()
+}
+
+func renderZephyr(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString("<|" + m.Role + "|>\n" + m.Content + "</s>\n")
+	}
+	b.WriteString("<|assistant|>\n")
+	return b.String()
+}
+
+func renderDeepSeek(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			b.WriteString(m.Content)
+		case "user":
+			b.WriteString("<｜User｜>" + m.Content)
+		case "assistant":
+			b.WriteString("<｜Assistant｜>" + m.Content + "<｜end▁of▁sentence｜>")
+		}
+	}
+	b.WriteString("<｜Assistant｜>")
+	return b.String()
+}
+
+func renderMistral(messages []Message) string {
+	var b strings.Builder
+	for _, m := range foldSystem(messages) {
+		if m.Role == "user" {
+			b.WriteString("[INST] " + strings.TrimSpace(m.Content) + " [/INST]")
+		} else {
+			b.WriteString(strings.TrimSpace(m.Content) + "</s>")
+		}
+	}
+	return b.String()
+}
+
+func renderAlpaca(messages []Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			b.WriteString(m.Content + "\n\n")
+		case "user":
+			b.WriteString("### Instruction:\n" + m.Content + "\n\n")
+		case "assistant":
+			b.WriteString("### Response:\n" + m.Content + "\n\n")
+		}
+	}
+	b.WriteString("### Response:\n")
+	return b.String()
+}
+
+func renderFallback(messages []Message) string {
+	var b strings.Builder
+	b.WriteString("A chat between a curious human and an artificial intelligence assistant. ")
+	b.WriteString("The assistant gives helpful, detailed, and polite answers to the human's questions.")
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			b.WriteString("\n" + m.Content)
+		case "user":
+			b.WriteString("\n### Human: " + m.Content)
+		case "assistant":
+			b.WriteString("\n### Assistant: " + m.Content)
+		}
+	}
+	b.WriteString("\n### Assistant: ")
+	return b.String()
+}
+
+// foldSystem merges a leading system message into the first user message,
+// for formats without a system role
+func foldSystem(messages []Message) []Message {
+	if len(messages) < 2 || messages[0].Role != "system" || messages[1].Role != "user" {
+		return messages
+	}
+
+	return append([]Message{{Role: "user", Content: messages[0].Content + "\n\n" + messages[1].Content}}, messages[2:]...)
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MockScheme starts the URL of the mock backend, which answers in process
+// like a llama-server with a model loaded, with settings in the query, e.g.
+// mock://?latency=200ms&error_rate=0.1. --backend mock selects it with
+// its defaults.
+const MockScheme = "mock://"
+
+// MockOptions are the settings of the mock backend
+type MockOptions struct {
+	Reply       string        // the canned reply; "" for the default one
+	Echo        bool          // reply with the last user message instead
+	Latency     time.Duration // before every response
+	TokenDelay  time.Duration // between the streamed tokens of a reply
+	ErrorRate   float64       // share of requests, other than health checks, that fail with status 500
+	Seed        int64         // seeds the failures, so a run can be repeated; 0 picks one
+	ContextSize int           // reported by /props
+}
+
+// ParseMockURL reads the mock backend's settings from its URL
+func ParseMockURL(rawURL string) (MockOptions, error) {
+	opts := MockOptions{ContextSize: 4096}
+	query, ok := strings.CutPrefix(rawURL, MockScheme)
+	if !ok {
+		return opts, fmt.Errorf("invalid mock backend URL %q: it must start with %s", rawURL, MockScheme)
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid mock backend URL %q: %w", rawURL, err)
+	}
+
+	for name := range values {
+		value := values.Get(name)
+		switch name {
+		case "reply":
+			opts.Reply = value
+		case "echo":
+			opts.Echo, err = strconv.ParseBool(value)
+		case "latency":
+			opts.Latency, err = time.ParseDuration(value)
+		case "token_delay":
+			opts.TokenDelay, err = time.ParseDuration(value)
+		case "error_rate":
+			opts.ErrorRate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (opts.ErrorRate < 0 || opts.ErrorRate > 1) {
+				err = fmt.Errorf("must be between 0 and 1")
+			}
+		case "seed":
+			opts.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "ctx":
+			opts.ContextSize, err = strconv.Atoi(value)
+			if err == nil && opts.ContextSize < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return opts, fmt.Errorf("unknown mock backend setting %q (use reply, echo, latency, token_delay, error_rate, seed or ctx)", name)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid mock backend setting %s=%s: %v", name, value, err)
+		}
+	}
+	if opts.Latency < 0 || opts.TokenDelay < 0 {
+		return opts, fmt.Errorf("invalid mock backend URL %q: delays can't be negative", rawURL)
+	}
+	return opts, nil
+}
+
+// BackendConfig describes the llama-server API llm-cli talks to, such as a
+// remote server behind a reverse proxy that requires authentication
+type BackendConfig struct {
+	Name        string            `json:"-"`
+	URL         string            `json:"url"`          // remote server; empty uses servers llm-cli runs locally
+	Headers     map[string]string `json:"headers"`      // sent with every request; $VARS are expanded
+	TokenSecret string            `json:"token_secret"` // secret sent as a bearer token, e.g. api-key
+}
+
+// UseBackend selects a backend profile from the config file. "mock", unless
+// the file defines a profile by that name, selects the mock backend, and a
+// mock:// URL the mock backend with those settings.
+func (c *Config) UseBackend(name string) error {
+	profile, ok := c.Backends[name]
+	if !ok && name == "mock" {
+		profile, ok = BackendConfig{URL: MockScheme}, true
+	}
+	if !ok && strings.HasPrefix(name, MockScheme) {
+		profile, ok = BackendConfig{URL: name}, true
+		name = "mock"
+	}
+	if !ok {
+		names := make([]string, 0, len(c.Backends))
+		for known := range c.Backends {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown backend %q: no backends are defined in %s", name, c.ConfigPath)
+		}
+		return fmt.Errorf("unknown backend %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+
+	profile.Name = name
+	c.Backend = profile
+	if strings.HasPrefix(profile.URL, MockScheme) {
+		if _, err := ParseMockURL(profile.URL); err != nil {
+			return fmt.Errorf("backend %s: %w", name, err)
+		}
+		c.APIURL = profile.URL
+	} else if profile.URL != "" {
+		c.APIURL = strings.TrimRight(profile.URL, "/")
+	}
+	return nil
+}
+
+// RemoteBackend reports whether requests go to a server llm-cli doesn't
+// run itself, so it must not start, restart or reconfigure servers
+func (c *Config) RemoteBackend() bool {
+	return c.Backend.URL != ""
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Set writes a value to the config file. key is a dotted path such as
+// "hardware-profile" or "persist.logs"; dashes are read as underscores.
+// Values are parsed as JSON when possible and kept as strings otherwise.
+func Set(cfg *Config, key, value string) error {
+	path := strings.Split(strings.ReplaceAll(key, "-", "_"), ".")
+
+	if strings.Join(path, ".") == "hardware_profile" {
+		if value == "" && ui.IsInteractive() {
+			picked, err := pickProfile()
+			if err != nil {
+				return err
+			}
+			value = picked
+		}
+		profile, ok := LookupProfile(value)
+		if !ok {
+			return fmt.Errorf("unknown hardware profile %q (run 'llm-cli config profiles' to list them)", value)
+		}
+		value = profile.Name
+	}
+
+	values, err := readValues(cfg)
+	if err != nil {
+		return err
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		parsed = value
+	}
+
+	// Walk to the parent object, creating it as needed
+	parent := values
+	for _, name := range path[:len(path)-1] {
+		child, ok := parent[name].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			parent[name] = child
+		}
+		parent = child
+	}
+	parent[path[len(path)-1]] = parsed
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+
+	// Make sure the result still loads before replacing the file
+	var check fileConfig
+	if err := json.Unmarshal(data, &check); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	if err := writeConfig(cfg, data); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Set %s = %s in %s", key, value, cfg.ConfigPath))
+	return nil
+}
+
+// RenameModel points the config file's references to a model, in starred
+// and in the tasks, at its new slug, and returns how many it changed
+func RenameModel(cfg *Config, oldSlug, newSlug string) (int, error) {
+	values, err := readValues(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	starred, _ := values["starred"].([]interface{})
+	for i, slug := range starred {
+		if slug == oldSlug {
+			starred[i] = newSlug
+			changed++
+		}
+	}
+	tasks, _ := values["tasks"].([]interface{})
+	for _, task := range tasks {
+		if task, ok := task.(map[string]interface{}); ok && task["model"] == oldSlug {
+			task["model"] = newSlug
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("encoding config: %w", err)
+	}
+	if err := writeConfig(cfg, data); err != nil {
+		return 0, err
+	}
+
+	for i, slug := range cfg.Starred {
+		if slug == oldSlug {
+			cfg.Starred[i] = newSlug
+		}
+	}
+	for i := range cfg.Tasks {
+		if cfg.Tasks[i].Model == oldSlug {
+			cfg.Tasks[i].Model = newSlug
+		}
+	}
+	return changed, nil
+}
+
+// readValues reads the config file as generic JSON; a missing file has no values
+func readValues(cfg *Config) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	data, err := os.ReadFile(cfg.ConfigPath)
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", cfg.ConfigPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return values, nil
+}
+
+// writeConfig replaces the config file with data, readable only by the
+// current user since it can hold tokens
+func writeConfig(cfg *Config, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(cfg.ConfigPath), 0755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	tmp := cfg.ConfigPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := os.Rename(tmp, cfg.ConfigPath); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	return nil
+}
+
+// Show prints the config file location and its contents
+func Show(cfg *Config) error {
+	fmt.Printf("Config file: %s\n", cfg.ConfigPath)
+
+	data, err := os.ReadFile(cfg.ConfigPath)
+	if os.IsNotExist(err) {
+		fmt.Println("(not created yet; built-in defaults apply)")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	fmt.Println(strings.TrimSpace(string(data)))
+	return nil
+}
+
+// ListProfiles prints the hardware profiles, marking the active and suggested ones
+func ListProfiles(cfg *Config) error {
+	suggested := DetectProfile()
+	active := ""
+	if profile := cfg.Profile(); profile != nil {
+		active = profile.Name
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tCTX\tGPU LAYERS\tBATCH\tPARALLEL\tDESCRIPTION")
+	for _, p := range Profiles {
+		mark := ""
+		if p.Name == active {
+			mark = " (active)"
+		} else if p.Name == suggested {
+			mark = " (suggested)"
+		}
+		fmt.Fprintf(w, "%s%s\t%d\t%d\t%d\t%d\t%s\n", p.Name, mark, p.CtxSize, p.GPULayers, p.BatchSize, p.Parallel, p.Description)
+	}
+	return w.Flush()
+}
+
+// pickProfile asks the user to choose a hardware profile
+func pickProfile() (string, error) {
+	suggested := DetectProfile()
+	options := make([]string, len(Profiles))
+	for i, p := range Profiles {
+		options[i] = fmt.Sprintf("%-12s %s", p.Name, p.Description)
+		if p.Name == suggested {
+			options[i] += " (suggested)"
+		}
+	}
+
+	choice, err := ui.Choose("Select a hardware profile:", options)
+	if err != nil {
+		return "", err
+	}
+	return Profiles[choice].Name, nil
+}
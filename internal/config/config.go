@@ -1,8 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the application configuration
@@ -11,12 +16,163 @@ type Config struct {
 	DBPath       string
 	LlamaServer  string
 	LlamaCLI     string
+	LlamaQuantize string
+	CacheDir     string
 	DefaultPort  int
 	APIURL       string
 	Temperature  float64
 	TopK         int
 	TopP         float64
 	NPredictMax  int
+	Stop         []string // stop sequences sent with completions, set per model
+	Mirostat     int      // 0 (off), 1 or 2; replaces top-k/top-p sampling when on
+	MirostatTau  float64  // target entropy; 0 uses the server default
+	MirostatEta  float64  // learning rate; 0 uses the server default
+	DynatempRange    float64 // temperature varies by +/- this much with token entropy
+	DynatempExponent float64
+	ConfigPath   string
+	LogDir       string
+	Persist      PersistConfig
+	Encryption   EncryptionConfig
+	Secrets      SecretsConfig
+	Sandbox      SandboxConfig
+	Tasks        []TaskConfig
+	Daemon       DaemonConfig
+	Timeouts     TimeoutConfig
+	Sync         SyncConfig
+	Serve        ServeConfig
+	Starred      []string // models warmed up when the daemon starts and by 'warmup --all-starred'
+	KeepAlive    string // stop servers started by llm-cli after this long without requests
+	MemoryBudget string // memory the running models' weights may use together, e.g. 24G or 75%
+	NoEvict      bool   // fail rather than stop servers to keep within MemoryBudget
+	Port         int    // port for servers this command starts instead of the model's own; not saved
+	SlugScheme   string // how pulled and imported models are named: author-model, model-only, short-hash or a template
+	Socket       bool   // servers listen on unix sockets in CacheDir instead of TCP ports
+	Accessible   bool   // plain sequential output for screen readers
+	Post         map[string]string // output filters per command, and named filter pipelines
+	Chat         ChatConfig
+	HFToken      string // Hugging Face token from the config file; prefer 'llm-cli login'
+	Backend      BackendConfig            // the selected backend profile; zero for local servers
+	Backends     map[string]BackendConfig // backend profiles by name
+	HardwareProfile string
+	ServerDefaults  map[string]string // llama-server settings applied to every model
+}
+
+// PersistConfig controls which kinds of user data llm-cli writes to disk
+type PersistConfig struct {
+	Sessions bool `json:"sessions"`
+	History  bool `json:"history"`
+	Usage    bool `json:"usage"`
+	Logs     bool `json:"logs"`
+	Cache    bool `json:"cache"`
+}
+
+// ChatConfig controls interactive chat sessions
+type ChatConfig struct {
+	Footer bool `json:"footer"` // print token counts, speed and context use after each reply
+	Ping   string `json:"ping"`   // health-check the server this often while waiting for input; off by default
+	Overflow string `json:"overflow"` // what to do with the oldest messages once the context is nearly full: truncate (default), summarize or off
+}
+
+// EncryptionConfig controls encryption-at-rest of stored sessions and history
+type EncryptionConfig struct {
+	Enabled   bool   `json:"enabled"`
+	KeySource string `json:"key_source"` // "passphrase" (default) or "keychain"
+}
+
+// SecretsConfig controls where API keys and tokens are stored
+type SecretsConfig struct {
+	Backend  string `json:"backend"` // "auto" (default), "keychain" or "file"
+	FilePath string `json:"-"`
+}
+
+// SandboxConfig restricts commands executed on behalf of a model
+type SandboxConfig struct {
+	Allow     []string `json:"allow"`
+	Workdir   string   `json:"workdir"`
+	Timeout   string   `json:"timeout"`
+	MaxOutput int      `json:"max_output"`
+	AuditLog  string   `json:"audit_log"`
+}
+
+// TaskConfig describes a recurring prompt run on a schedule
+type TaskConfig struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"` // "every 2h", "daily 08:00", "weekly mon 09:00"
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt"`
+	Input    string `json:"input,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Append   bool   `json:"append,omitempty"`
+	Post     string `json:"post,omitempty"` // output filters, e.g. "strip-think,trim"
+}
+
+// DaemonConfig controls the supervising daemon
+type DaemonConfig struct {
+	IdleTimeout  string  `json:"idle_timeout"`   // stop servers unused this long; "0" never stops them
+	MaxErrorRate float64 `json:"max_error_rate"` // restart servers whose recent requests fail more often; 0 uses 0.5, 1 never restarts
+}
+
+// TimeoutConfig bounds how long requests to a model's server wait. Each is
+// a duration such as 30s; "off" waits forever.
+type TimeoutConfig struct {
+	Connect    string `json:"connect"`     // connecting to the server; default 5s
+	FirstToken string `json:"first_token"` // the server starting its response, prompt evaluation included; default 10m
+	Read       string `json:"read"`        // a pause once the response has started; default 2m
+}
+
+// RequestTimeouts are the parsed request timeouts; 0 waits forever
+type RequestTimeouts struct {
+	Connect    time.Duration
+	FirstToken time.Duration
+	Read       time.Duration
+}
+
+// SyncConfig is where 'llm-cli sync' keeps a copy of the llm-cli state
+type SyncConfig struct {
+	Remote string `json:"remote"` // git repository URL or rclone remote, e.g. backup:llm-cli
+	Type   string `json:"type"`   // git or rclone
+}
+
+// ServeConfig controls who 'llm-cli serve' lets in
+type ServeConfig struct {
+	User string     `json:"user"` // user name basic auth must give with the key; default llm-cli
+	OIDC OIDCConfig `json:"oidc"`
+}
+
+// OIDCConfig is the OpenID Connect provider 'serve --auth oidc' signs
+// browsers in with. Its client secret is the oidc-client-secret secret.
+type OIDCConfig struct {
+	Issuer      string   `json:"issuer"`       // e.g. https://accounts.google.com
+	ClientID    string   `json:"client_id"`
+	RedirectURL string   `json:"redirect_url"` // where the provider sends users back; defaults to /auth/callback on the address serve was reached at
+	Allow       []string `json:"allow"`        // emails, or subjects, of the users let in
+}
+
+// fileConfig is the subset of the configuration that can be set in the config file
+type fileConfig struct {
+	Persist    PersistConfig    `json:"persist"`
+	Encryption EncryptionConfig `json:"encryption"`
+	Secrets    SecretsConfig    `json:"secrets"`
+	Sandbox    SandboxConfig    `json:"sandbox"`
+	Tasks      []TaskConfig     `json:"tasks"`
+	Daemon     DaemonConfig     `json:"daemon"`
+	Timeouts   TimeoutConfig    `json:"timeouts"`
+	Sync       SyncConfig       `json:"sync"`
+	Serve      ServeConfig      `json:"serve"`
+	Starred    []string         `json:"starred"`
+	KeepAlive  string           `json:"keep_alive"`
+	MemoryBudget string         `json:"memory_budget"`
+	SlugScheme string           `json:"slug_scheme"`
+	Socket     bool             `json:"socket"`
+	Accessible bool             `json:"accessible"`
+	Post       map[string]string `json:"post"`
+	Chat       ChatConfig       `json:"chat"`
+	HFToken    string           `json:"hf_token"`
+	Backend    string           `json:"backend"`
+	Backends   map[string]BackendConfig `json:"backends"`
+	HardwareProfile string      `json:"hardware_profile"`
+	Server     map[string]interface{} `json:"server"`
 }
 
 // Load creates a Config with values from environment or defaults
@@ -49,22 +205,268 @@ func Load() (*Config, error) {
 		llamaCLI = "/opt/homebrew/bin/llama-cli"
 	}
 	
+	llamaQuantize := os.Getenv("LLAMA_QUANTIZE")
+	if llamaQuantize == "" {
+		llamaQuantize = "/opt/homebrew/bin/llama-quantize"
+	}
+	
 	// API URL (prefer env var if set)
 	apiURL := os.Getenv("API_URL")
 	if apiURL == "" {
 		apiURL = "http://localhost:1966"
 	}
 
-	return &Config{
+	// Config file (optional)
+	configPath := os.Getenv("LLM_CLI_CONFIG")
+	if configPath == "" {
+		configPath = filepath.Join(cacheDir, "config.json")
+	}
+
+	file := fileConfig{
+		Persist: PersistConfig{Sessions: true, History: true, Usage: true, Logs: true, Cache: true},
+		Sandbox: SandboxConfig{
+			Allow:     []string{"ls", "cat", "head", "tail", "wc", "grep", "pwd", "echo", "date"},
+			Workdir:   filepath.Join(cacheDir, "workspace"),
+			Timeout:   "30s",
+			MaxOutput: 64 * 1024,
+			AuditLog:  filepath.Join(cacheDir, "sandbox-audit.log"),
+		},
+		Daemon: DaemonConfig{IdleTimeout: "30m"},
+	}
+	if err := loadFile(configPath, &file); err != nil {
+		return nil, err
+	}
+	file.Secrets.FilePath = filepath.Join(cacheDir, "secrets.json")
+	if file.HardwareProfile != "" {
+		if _, ok := LookupProfile(file.HardwareProfile); !ok {
+			return nil, fmt.Errorf("unknown hardware_profile %q in %s", file.HardwareProfile, configPath)
+		}
+	}
+
+	// Server defaults are stored as strings like per-model settings
+	serverDefaults := make(map[string]string, len(file.Server))
+	for key, value := range file.Server {
+		serverDefaults[key] = fmt.Sprint(value)
+	}
+
+	cfg := &Config{
 		ModelsDir:    modelsDir,
 		DBPath:       dbPath,
 		LlamaServer:  llamaServer,
 		LlamaCLI:     llamaCLI,
+		LlamaQuantize: llamaQuantize,
+		CacheDir:     cacheDir,
 		DefaultPort:  defaultPort,
 		APIURL:       apiURL,
 		Temperature:  0.7,
 		TopK:         40,
 		TopP:         0.5,
 		NPredictMax:  256,
-	}, nil
-}
\ No newline at end of file
+		ConfigPath:   configPath,
+		LogDir:       "/tmp",
+		Persist:      file.Persist,
+		Encryption:   file.Encryption,
+		Secrets:      file.Secrets,
+		Sandbox:      file.Sandbox,
+		Tasks:        file.Tasks,
+		Daemon:       file.Daemon,
+		Timeouts:     file.Timeouts,
+		Sync:         file.Sync,
+		Serve:        file.Serve,
+		Starred:      file.Starred,
+		KeepAlive:    file.KeepAlive,
+		MemoryBudget: file.MemoryBudget,
+		SlugScheme:   file.SlugScheme,
+		Socket:       file.Socket,
+		Accessible:   file.Accessible,
+		Post:         file.Post,
+		Chat:         file.Chat,
+		HFToken:      file.HFToken,
+		Backends:     file.Backends,
+		HardwareProfile: file.HardwareProfile,
+		ServerDefaults:  serverDefaults,
+	}
+
+	// Unix sockets (prefer env var if set)
+	if value := os.Getenv("LLM_CLI_SOCKET"); value != "" {
+		socket, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_CLI_SOCKET %q", value)
+		}
+		cfg.Socket = socket
+	}
+
+	// Accessibility mode (prefer env var if set)
+	if value := os.Getenv("LLM_CLI_ACCESSIBLE"); value != "" {
+		accessible, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_CLI_ACCESSIBLE %q", value)
+		}
+		cfg.Accessible = accessible
+	}
+
+	// Backend profile (prefer env var if set)
+	backend := os.Getenv("LLM_CLI_BACKEND")
+	if backend == "" {
+		backend = file.Backend
+	}
+	if backend != "" {
+		if err := cfg.UseBackend(backend); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// loadFile reads the JSON config file into file, leaving defaults for
+// anything the file doesn't set. A missing file is not an error.
+func loadFile(path string, file *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// DisablePersistence turns off every kind of persistence for this invocation
+func (c *Config) DisablePersistence() {
+	c.Persist = PersistConfig{}
+}
+
+// ServerLogPath returns the log file used by the server for a model
+func (c *Config) ServerLogPath(slug string) string {
+	return filepath.Join(c.LogDir, fmt.Sprintf("llama_server_%s.log", slug))
+}
+
+// DaemonSocketPath returns the control socket of the supervising daemon
+func (c *Config) DaemonSocketPath() string {
+	return filepath.Join(c.CacheDir, "daemon.sock")
+}
+
+// ServerSocketPath returns the unix socket of the server numbered port when
+// servers listen on sockets. The directory is private to the user.
+func (c *Config) ServerSocketPath(port int) string {
+	return filepath.Join(c.CacheDir, "sockets", fmt.Sprintf("%d.sock", port))
+}
+
+// DaemonLogPath returns the log file of the supervising daemon
+func (c *Config) DaemonLogPath() string {
+	return filepath.Join(c.LogDir, "llm-cli-daemon.log")
+}
+
+// DaemonIdleTimeout returns how long the daemon keeps an unused server
+// running, or 0 if it never stops idle servers
+func (c *Config) DaemonIdleTimeout() (time.Duration, error) {
+	return parseIdleTimeout("daemon.idle_timeout", c.Daemon.IdleTimeout)
+}
+
+// KeepAliveDuration returns how long a server started outside the daemon
+// keeps running without requests, or 0 if it runs until stopped
+func (c *Config) KeepAliveDuration() (time.Duration, error) {
+	return parseIdleTimeout("keep_alive", c.KeepAlive)
+}
+
+// RequestTimeouts returns the timeouts of requests to a model's server,
+// with the defaults for those not set
+func (c *Config) RequestTimeouts() (RequestTimeouts, error) {
+	var timeouts RequestTimeouts
+	for _, t := range []struct {
+		name, value string
+		fallback    time.Duration
+		into        *time.Duration
+	}{
+		{"timeouts.connect", c.Timeouts.Connect, 5 * time.Second, &timeouts.Connect},
+		{"timeouts.first_token", c.Timeouts.FirstToken, 10 * time.Minute, &timeouts.FirstToken},
+		{"timeouts.read", c.Timeouts.Read, 2 * time.Minute, &timeouts.Read},
+	} {
+		*t.into = t.fallback
+		if t.value == "" {
+			continue
+		}
+		d, err := parseIdleTimeout(t.name, t.value)
+		if err != nil {
+			return timeouts, err
+		}
+		*t.into = d
+	}
+	return timeouts, nil
+}
+
+// MemoryBudgetBytes returns how much memory the weights of the running
+// models may use together, or 0 if there is no budget. A budget ending in
+// % is a share of the physical memory.
+func (c *Config) MemoryBudgetBytes() (int64, error) {
+	value := strings.TrimSpace(c.MemoryBudget)
+	switch value {
+	case "", "0", "off":
+		return 0, nil
+	}
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		share, err := strconv.ParseFloat(percent, 64)
+		if err != nil || share <= 0 || share > 100 {
+			return 0, fmt.Errorf("invalid memory_budget %q", c.MemoryBudget)
+		}
+		total := SystemMemory()
+		if total == 0 {
+			return 0, fmt.Errorf("memory_budget %q needs the physical memory, which is unknown on this system; give a size such as 24G", c.MemoryBudget)
+		}
+		return int64(float64(total) * share / 100), nil
+	}
+
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	upper := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(value), "B"), "I")
+	multiplier := int64(1)
+	if upper == "" {
+		return 0, fmt.Errorf("invalid memory_budget %q", c.MemoryBudget)
+	}
+	if unit, ok := units[upper[len(upper)-1:]]; ok {
+		multiplier = unit
+		upper = upper[:len(upper)-1]
+	}
+	size, err := strconv.ParseFloat(upper, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid memory_budget %q", c.MemoryBudget)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// ChatPingInterval returns how often chat pings its server while waiting
+// for input, or 0 if it doesn't
+func (c *Config) ChatPingInterval() (time.Duration, error) {
+	return parseIdleTimeout("chat.ping", c.Chat.Ping)
+}
+
+// ChatOverflow returns what chat does with the oldest messages when the
+// conversation would no longer leave room in the context for a reply:
+// truncate drops them, summarize replaces them with a summary and off sends
+// them anyway
+func (c *Config) ChatOverflow() (string, error) {
+	switch c.Chat.Overflow {
+	case "", "truncate":
+		return "truncate", nil
+	case "summarize", "off":
+		return c.Chat.Overflow, nil
+	}
+	return "", fmt.Errorf("invalid chat.overflow %q (use truncate, summarize or off)", c.Chat.Overflow)
+}
+
+// parseIdleTimeout parses a duration where "", "0" and "off" mean no timeout
+func parseIdleTimeout(name, value string) (time.Duration, error) {
+	switch value {
+	case "", "0", "off":
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return timeout, nil
+}
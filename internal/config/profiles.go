@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// HardwareProfile holds llama-server defaults suited to a class of device.
+// Per-model settings take precedence over these.
+type HardwareProfile struct {
+	Name        string
+	Description string
+	CtxSize     int
+	GPULayers   int
+	BatchSize   int
+	Parallel    int
+}
+
+// Profiles are the built-in hardware profiles
+var Profiles = []HardwareProfile{
+	{"macbook-air", "Apple Silicon with 8-16 GB unified memory", 4096, 99, 256, 1},
+	{"m-pro", "Apple M-series Pro with 18-36 GB unified memory", 8192, 99, 512, 2},
+	{"m-max", "Apple M-series Max or Ultra with 48 GB or more", 16384, 99, 1024, 4},
+	{"gpu-12gb", "NVIDIA/AMD GPU with 8-16 GB VRAM", 8192, 99, 512, 2},
+	{"gpu-24gb", "NVIDIA/AMD GPU with 24 GB VRAM or more", 16384, 99, 2048, 4},
+	{"cpu-only", "No GPU offload", 4096, 0, 256, 1},
+}
+
+// profileAliases maps specific device names to a profile
+var profileAliases = map[string]string{
+	"air":     "macbook-air",
+	"m1-pro":  "m-pro",
+	"m2-pro":  "m-pro",
+	"m3-pro":  "m-pro",
+	"m4-pro":  "m-pro",
+	"m1-max":  "m-max",
+	"m2-max":  "m-max",
+	"m3-max":  "m-max",
+	"m4-max":  "m-max",
+	"ultra":   "m-max",
+	"rtx3090": "gpu-24gb",
+	"rtx4090": "gpu-24gb",
+	"cpu":     "cpu-only",
+}
+
+// LookupProfile finds a hardware profile by name or alias
+func LookupProfile(name string) (*HardwareProfile, bool) {
+	name = strings.ToLower(name)
+	if canonical, ok := profileAliases[name]; ok {
+		name = canonical
+	}
+	for i := range Profiles {
+		if Profiles[i].Name == name {
+			return &Profiles[i], true
+		}
+	}
+	return nil, false
+}
+
+// Profile returns the configured hardware profile, or nil if none is set
+func (c *Config) Profile() *HardwareProfile {
+	profile, _ := LookupProfile(c.HardwareProfile)
+	return profile
+}
+
+// DetectProfile suggests a hardware profile for this machine, or "" if unsure
+func DetectProfile() string {
+	if runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" {
+		bytes := SystemMemory()
+		if bytes == 0 {
+			return ""
+		}
+		switch gb := bytes >> 30; {
+		case gb <= 16:
+			return "macbook-air"
+		case gb <= 36:
+			return "m-pro"
+		default:
+			return "m-max"
+		}
+	}
+
+	out, err := exec.Command("nvidia-smi", "--query-gpu=memory.total", "--format=csv,noheader,nounits").Output()
+	if err == nil {
+		fields := strings.Fields(string(out))
+		if len(fields) > 0 {
+			if mib, err := strconv.Atoi(fields[0]); err == nil {
+				if mib >= 20*1024 {
+					return "gpu-24gb"
+				}
+				return "gpu-12gb"
+			}
+		}
+	}
+
+	return "cpu-only"
+}
+
+// SystemMemory returns the machine's physical memory in bytes, or 0 if it
+// can't be determined
+func SystemMemory() int64 {
+	if runtime.GOOS == "darwin" {
+		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0
+		}
+		bytes, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		return bytes
+	}
+
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
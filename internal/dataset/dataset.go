@@ -0,0 +1,316 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Options controls dataset generation
+type Options struct {
+	Model      string  // model generating instructions and responses
+	Judge      string  // model scoring pairs, defaults to Model
+	SeedsPath  string  // file with one seed prompt per line
+	Count      int     // number of pairs to produce
+	Output     string  // JSONL output file
+	Format     string  // alpaca, openai or sharegpt
+	MinScore   int     // minimum judge score (1-10) to keep a pair
+	Similarity float64 // word overlap above which instructions count as duplicates
+}
+
+// Pair is a generated instruction/response example
+type Pair struct {
+	Instruction string
+	Response    string
+}
+
+const (
+	batchSize       = 20
+	maxAttemptRatio = 5
+)
+
+var (
+	scorePattern   = regexp.MustCompile(`\b(10|[1-9])\b`)
+	nonWordPattern = regexp.MustCompile(`[^a-z0-9]+`)
+	refusalPhrases = []string{"as an ai", "i cannot", "i can't help", "i'm sorry, but", "i am unable to", "as a language model"}
+)
+
+// Generate produces instruction/response pairs from seed prompts, removes
+// duplicates and low-quality pairs, and writes the survivors as JSONL
+func Generate(store *db.Store, cfg *config.Config, opts Options) error {
+	if opts.Judge == "" {
+		opts.Judge = opts.Model
+	}
+	if opts.Format == "" {
+		opts.Format = "alpaca"
+	}
+	if opts.Format != "alpaca" && opts.Format != "openai" && opts.Format != "sharegpt" {
+		return fmt.Errorf("unsupported dataset format: %s", opts.Format)
+	}
+
+	for _, slug := range []string{opts.Model, opts.Judge} {
+		if _, err := store.GetModelBySlug(slug); err != nil {
+			return err
+		}
+	}
+
+	seeds, err := readSeeds(opts.SeedsPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(opts.Output)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	dedup := newDeduper(opts.Similarity)
+	for _, seed := range seeds {
+		dedup.add(seed)
+	}
+
+	accepted, attempts, seedIndex := 0, 0, 0
+	var duplicates, lowQuality, rejected int
+	maxAttempts := opts.Count * maxAttemptRatio
+
+	for accepted < opts.Count && attempts < maxAttempts {
+		// Generate a batch of candidates with the generator model
+		genCfg, err := useModel(store, cfg, opts.Model)
+		if err != nil {
+			return err
+		}
+
+		want := opts.Count - accepted
+		if want > batchSize {
+			want = batchSize
+		}
+
+		var batch []Pair
+		for len(batch) < want && attempts < maxAttempts {
+			attempts++
+			seed := seeds[seedIndex%len(seeds)]
+			seedIndex++
+
+			pair, err := generatePair(genCfg, seed)
+			if err != nil {
+				return err
+			}
+			if !passesHeuristics(pair) {
+				lowQuality++
+				continue
+			}
+			if !dedup.add(pair.Instruction) {
+				duplicates++
+				continue
+			}
+			batch = append(batch, pair)
+		}
+
+		// Score the batch with the judge model
+		judgeCfg, err := useModel(store, cfg, opts.Judge)
+		if err != nil {
+			return err
+		}
+		for _, pair := range batch {
+			score, err := judgePair(judgeCfg, pair)
+			if err != nil {
+				return err
+			}
+			if score < opts.MinScore {
+				rejected++
+				continue
+			}
+			if err := writeRecord(writer, pair, opts.Format); err != nil {
+				return err
+			}
+			accepted++
+		}
+		writer.Flush()
+
+		ui.PrintInfo(fmt.Sprintf("Accepted %d/%d pairs (%d attempts)", accepted, opts.Count, attempts))
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Wrote %d pairs to %s (dropped %d duplicates, %d low quality, %d below score %d)",
+		accepted, opts.Output, duplicates, lowQuality, rejected, opts.MinScore))
+	if accepted < opts.Count {
+		ui.PrintWarn(fmt.Sprintf("Stopped after %d attempts; try more varied seed prompts or a lower --min-score", attempts))
+	}
+	return nil
+}
+
+// readSeeds loads non-empty lines from the seed file
+func readSeeds(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening seed prompts: %w", err)
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			seeds = append(seeds, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading seed prompts: %w", err)
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no seed prompts found in %s", path)
+	}
+	return seeds, nil
+}
+
+// useModel makes sure the model's server is running and returns the
+// configuration with the model's own settings and port applied
+func useModel(store *db.Store, cfg *config.Config, slug string) (*config.Config, error) {
+	if err := server.EnsureServerRunning(store, cfg, slug); err != nil {
+		return nil, err
+	}
+	return server.ModelConfig(store, cfg, slug)
+}
+
+// generatePair asks the model for a new instruction inspired by seed and then answers it
+func generatePair(cfg *config.Config, seed string) (Pair, error) {
+	instruction, err := server.CompleteRunning(cfg,
+		"Here is an example of a task someone might ask an assistant:\n\n"+seed+
+			"\n\nWrite one new task on a related topic that is clearly different from the example. "+
+			"Output only the task itself.\n\nTask:")
+	if err != nil {
+		return Pair{}, err
+	}
+	instruction = strings.TrimSpace(instruction)
+
+	response, err := server.CompleteRunning(cfg,
+		"Respond to the following request accurately and helpfully.\n\nRequest: "+instruction+"\n\nResponse:")
+	if err != nil {
+		return Pair{}, err
+	}
+
+	return Pair{Instruction: instruction, Response: strings.TrimSpace(response)}, nil
+}
+
+// judgePair asks the judge model to score a pair from 1 to 10
+func judgePair(cfg *config.Config, pair Pair) (int, error) {
+	reply, err := server.CompleteRunning(cfg,
+		"Rate the following instruction and response for correctness, helpfulness and clarity "+
+			"on a scale from 1 (useless) to 10 (excellent). Reply with the number only.\n\n"+
+			"Instruction: "+pair.Instruction+"\n\nResponse: "+pair.Response+"\n\nScore:")
+	if err != nil {
+		return 0, err
+	}
+
+	match := scorePattern.FindString(reply)
+	if match == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(match)
+}
+
+// passesHeuristics drops empty, trivial, echoed and refused pairs before judging
+func passesHeuristics(pair Pair) bool {
+	if len(pair.Instruction) < 10 || len(pair.Response) < 20 {
+		return false
+	}
+	if strings.Contains(pair.Instruction, "\n\n") {
+		return false
+	}
+
+	response := strings.ToLower(pair.Response)
+	if strings.HasPrefix(response, strings.ToLower(pair.Instruction)) {
+		return false
+	}
+	for _, phrase := range refusalPhrases {
+		if strings.Contains(response, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRecord writes a pair in the chosen fine-tuning format
+func writeRecord(w *bufio.Writer, pair Pair, format string) error {
+	var record interface{}
+
+	switch format {
+	case "alpaca":
+		record = map[string]string{"instruction": pair.Instruction, "input": "", "output": pair.Response}
+	case "openai":
+		record = map[string]interface{}{"messages": []map[string]string{
+			{"role": "user", "content": pair.Instruction},
+			{"role": "assistant", "content": pair.Response},
+		}}
+	case "sharegpt":
+		record = map[string]interface{}{"conversations": []map[string]string{
+			{"from": "human", "value": pair.Instruction},
+			{"from": "gpt", "value": pair.Response},
+		}}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding pair: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", line)
+	return err
+}
+
+// deduper rejects instructions that repeat or closely resemble earlier ones
+type deduper struct {
+	threshold float64
+	seen      map[string]bool
+	words     []map[string]bool
+}
+
+func newDeduper(threshold float64) *deduper {
+	return &deduper{threshold: threshold, seen: make(map[string]bool)}
+}
+
+// add records text and reports whether it was new
+func (d *deduper) add(text string) bool {
+	normalized := strings.TrimSpace(nonWordPattern.ReplaceAllString(strings.ToLower(text), " "))
+	if d.seen[normalized] {
+		return false
+	}
+
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		words[word] = true
+	}
+	for _, other := range d.words {
+		if jaccard(words, other) >= d.threshold {
+			return false
+		}
+	}
+
+	d.seen[normalized] = true
+	d.words = append(d.words, words)
+	return true
+}
+
+// jaccard returns the overlap between two word sets
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,42 @@
+package db
+
+import "fmt"
+
+// AddSlugAlias makes alias another name for the model with the given slug,
+// replacing any earlier alias of that name
+func (s *Store) AddSlugAlias(alias, slug string) error {
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO slug_aliases (alias, slug) VALUES (?, ?)`, alias, slug); err != nil {
+		return fmt.Errorf("adding slug alias: %w", err)
+	}
+	return nil
+}
+
+// ResolveSlugAlias returns the slug of the model name is an alias of. A
+// name that is a model's own slug is not resolved.
+func (s *Store) ResolveSlugAlias(name string) (string, bool) {
+	var slug string
+	query := `SELECT slug FROM slug_aliases WHERE alias = ? AND NOT EXISTS (SELECT 1 FROM models WHERE slug = ?)`
+	if err := s.db.QueryRow(query, name, name).Scan(&slug); err != nil {
+		return "", false
+	}
+	return slug, true
+}
+
+// GetSlugAliases returns the aliases of every model, by slug
+func (s *Store) GetSlugAliases() (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT alias, slug FROM slug_aliases ORDER BY alias`)
+	if err != nil {
+		return nil, fmt.Errorf("querying slug aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := make(map[string][]string)
+	for rows.Next() {
+		var alias, slug string
+		if err := rows.Scan(&alias, &slug); err != nil {
+			return nil, fmt.Errorf("scanning slug alias: %w", err)
+		}
+		aliases[slug] = append(aliases[slug], alias)
+	}
+	return aliases, rows.Err()
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BenchResult is the measurement of one benchmark workload
+type BenchResult struct {
+	ID           int
+	Slug         string
+	Settings     string // llama-server arguments the model ran with
+	PromptTokens int
+	NPredict     int
+	PromptTPS    float64
+	GenTPS       float64
+	TTFTMS       float64 // time to first token in milliseconds
+	MemoryBytes  int64   // 0 if unknown
+	CreatedAt    time.Time
+}
+
+// AddBenchResult records a benchmark result
+func (s *Store) AddBenchResult(r BenchResult) error {
+	query := `INSERT INTO bench_results (slug, settings, prompt_tokens, n_predict, prompt_tps, gen_tps, ttft_ms, memory_bytes)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, r.Slug, r.Settings, r.PromptTokens, r.NPredict, r.PromptTPS, r.GenTPS, r.TTFTMS, r.MemoryBytes); err != nil {
+		return fmt.Errorf("saving bench result: %w", err)
+	}
+	return nil
+}
+
+// GetBenchResults returns the benchmark results of the given models, or of
+// every model if none are given, ordered by workload and then fastest
+// generation first
+func (s *Store) GetBenchResults(slugs []string) ([]BenchResult, error) {
+	query := `SELECT id, slug, settings, prompt_tokens, n_predict, prompt_tps, gen_tps, ttft_ms, memory_bytes, created_at
+              FROM bench_results`
+	args := make([]interface{}, len(slugs))
+	if len(slugs) > 0 {
+		query += ` WHERE slug IN (?` + strings.Repeat(", ?", len(slugs)-1) + `)`
+		for i, slug := range slugs {
+			args[i] = slug
+		}
+	}
+	query += ` ORDER BY prompt_tokens, n_predict, gen_tps DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying bench results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []BenchResult
+	for rows.Next() {
+		var r BenchResult
+		if err := rows.Scan(&r.ID, &r.Slug, &r.Settings, &r.PromptTokens, &r.NPredict, &r.PromptTPS, &r.GenTPS, &r.TTFTMS, &r.MemoryBytes, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning bench result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecordServerCrash records that a model's server failed and returns how
+// many failures have been recorded for the model since the given time
+func (s *Store) RecordServerCrash(slug, reason string, since time.Time) (int, error) {
+	if _, err := s.db.Exec(`INSERT INTO server_crashes (slug, reason) VALUES (?, ?)`, slug, reason); err != nil {
+		return 0, fmt.Errorf("recording server crash: %w", err)
+	}
+
+	var count int
+	query := `SELECT COUNT(*) FROM server_crashes WHERE slug = ? AND crashed_at >= ?`
+	if err := s.db.QueryRow(query, slug, since.UTC().Format("2006-01-02 15:04:05")).Scan(&count); err != nil {
+		return 0, fmt.Errorf("counting server crashes: %w", err)
+	}
+	return count, nil
+}
+
+// ClearServerCrashes forgets the recorded failures of a model
+func (s *Store) ClearServerCrashes(slug string) error {
+	if _, err := s.db.Exec(`DELETE FROM server_crashes WHERE slug = ?`, slug); err != nil {
+		return fmt.Errorf("clearing server crashes: %w", err)
+	}
+	return nil
+}
+
+// SetModelQuarantine quarantines a model with a reason, or lifts the
+// quarantine when reason is empty
+func (s *Store) SetModelQuarantine(slug, reason string) error {
+	result, err := s.db.Exec(`UPDATE models SET quarantine = ? WHERE slug = ?`, reason, slug)
+	if err != nil {
+		return fmt.Errorf("updating quarantine: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no model with slug '%s' found", slug)
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package db
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,19 +17,39 @@ import (
 
 // Store represents the database connection and operations
 type Store struct {
-	db *sql.DB
+	db  *sql.DB
+	fts bool // the full-text search index is available
+
+	cipherProvider func() (Cipher, error)
+	cipher         Cipher
+}
+
+// Cipher encrypts and decrypts stored conversation content
+type Cipher interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(ciphertext []byte) ([]byte, error)
 }
 
+// sealedPrefix marks content that was encrypted before being stored
+const sealedPrefix = "llmcli-sealed:v1:"
+
 // Model represents a model in the database
 type Model struct {
-	ID        int
-	Slug      string
-	ModelID   string
-	FileName  string
-	FilePath  string
-	FileSize  string
-	CreatedAt time.Time
-	LastUsed  sql.NullTime
+	ID         int
+	Slug       string
+	ModelID    string
+	FileName   string
+	FilePath   string
+	FileSize   string
+	Quant      string
+	SHA256     string // comma-separated per shard for split models
+	Quarantine string // why auto-restarts are refused; empty when not quarantined
+	Port       int    // port assigned to the model's server; 0 until first started
+	Revision   string // Hugging Face commit the file was downloaded from; empty if unknown
+	Arch       string // architecture recorded in the GGUF, such as llama; empty if unknown
+	Params     int64  // number of weights in the GGUF; 0 if unknown
+	CreatedAt  time.Time
+	LastUsed   sql.NullTime
 }
 
 // New creates a new database connection and initializes the schema
@@ -50,7 +75,13 @@ func New(dbPath string) (*Store, error) {
 		return nil, err
 	}
 
-	return &Store{db: db}, nil
+	fts, err := initSearchIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, fts: fts}, nil
 }
 
 // Close closes the database connection
@@ -71,24 +102,234 @@ func initSchema(db *sql.DB) error {
         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
         last_used DATETIME
     );
+
+    CREATE TABLE IF NOT EXISTS embedding_cache (
+        model_key TEXT,
+        text_hash TEXT,
+        vector BLOB,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (model_key, text_hash)
+    );
+
+    CREATE TABLE IF NOT EXISTS meta (
+        key TEXT PRIMARY KEY,
+        value TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS sessions (
+        id INTEGER PRIMARY KEY,
+        name TEXT UNIQUE,
+        model_slug TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS session_messages (
+        id INTEGER PRIMARY KEY,
+        session_id INTEGER REFERENCES sessions(id) ON DELETE CASCADE,
+        role TEXT,
+        content BLOB,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS task_runs (
+        id INTEGER PRIMARY KEY,
+        task_name TEXT,
+        started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        finished_at DATETIME,
+        status TEXT DEFAULT 'running',
+        error TEXT DEFAULT ''
+    );
+
+    CREATE TABLE IF NOT EXISTS model_settings (
+        slug TEXT,
+        key TEXT,
+        value TEXT,
+        PRIMARY KEY (slug, key)
+    );
+
+    CREATE TABLE IF NOT EXISTS server_crashes (
+        id INTEGER PRIMARY KEY,
+        slug TEXT,
+        reason TEXT,
+        crashed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS slug_aliases (
+        alias TEXT PRIMARY KEY,
+        slug TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS model_tags (
+        slug TEXT,
+        tag TEXT,
+        PRIMARY KEY (slug, tag)
+    );
+
+    CREATE TABLE IF NOT EXISTS prompts (
+        name TEXT PRIMARY KEY,
+        template TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS servers (
+        pid INTEGER PRIMARY KEY,
+        port INTEGER,
+        slug TEXT,
+        model_path TEXT,
+        started_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS tune_results (
+        id INTEGER PRIMARY KEY,
+        slug TEXT,
+        params TEXT,
+        prompt_tps REAL,
+        gen_tps REAL,
+        memory_bytes INTEGER,
+        status TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS bench_results (
+        id INTEGER PRIMARY KEY,
+        slug TEXT,
+        settings TEXT,
+        prompt_tokens INTEGER,
+        n_predict INTEGER,
+        prompt_tps REAL,
+        gen_tps REAL,
+        ttft_ms REAL,
+        memory_bytes INTEGER,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS config_snapshots (
+        id INTEGER PRIMARY KEY,
+        slug TEXT,
+        version INTEGER,
+        settings TEXT,
+        chat_template TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (slug, version)
+    );
+
+    CREATE TABLE IF NOT EXISTS history (
+        id INTEGER PRIMARY KEY,
+        model_slug TEXT,
+        prompt BLOB,
+        response BLOB,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS index_collections (
+        name TEXT PRIMARY KEY,
+        model_slug TEXT,
+        dimension INTEGER,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE TABLE IF NOT EXISTS index_files (
+        collection TEXT,
+        path TEXT,
+        hash TEXT,
+        indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (collection, path)
+    );
+
+    CREATE TABLE IF NOT EXISTS index_chunks (
+        id INTEGER PRIMARY KEY,
+        collection TEXT,
+        path TEXT,
+        start_line INTEGER,
+        end_line INTEGER,
+        text TEXT,
+        vector BLOB
+    );
+
+    CREATE INDEX IF NOT EXISTS index_chunks_by_file ON index_chunks (collection, path);
     `
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("creating schema: %w", err)
 	}
 
+	return migrate(db)
+}
+
+// migrate adds columns introduced after a table was first created
+func migrate(db *sql.DB) error {
+	columns := []struct {
+		table, name, decl string
+	}{
+		{"sessions", "params", "TEXT DEFAULT ''"},
+		{"sessions", "system_prompt", "BLOB"},
+		{"models", "quant", "TEXT DEFAULT ''"},
+		{"models", "sha256", "TEXT DEFAULT ''"},
+		{"models", "quarantine", "TEXT DEFAULT ''"},
+		{"models", "port", "INTEGER DEFAULT 0"},
+		{"models", "revision", "TEXT DEFAULT ''"},
+		{"models", "arch", "TEXT DEFAULT ''"},
+		{"models", "params", "INTEGER DEFAULT 0"},
+		{"servers", "size", "INTEGER DEFAULT 0"},
+		{"servers", "last_used", "DATETIME"},
+		{"servers", "log_path", "TEXT DEFAULT ''"},
+		{"servers", "requests", "INTEGER DEFAULT 0"},
+		{"servers", "error_rate", "REAL DEFAULT 0"},
+		{"servers", "latency_ms", "REAL DEFAULT 0"},
+		{"servers", "baseline_ms", "REAL DEFAULT 0"},
+		{"servers", "last_error", "TEXT DEFAULT ''"},
+		{"servers", "last_error_at", "DATETIME"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.name, c.decl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspecting table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("inspecting table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspecting table %s: %w", table, err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("adding column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
 // GetModelBySlug retrieves a model by its slug
 func (s *Store) GetModelBySlug(slug string) (*Model, error) {
-	query := `SELECT id, slug, model_id, file_name, file_path, file_size, created_at, last_used 
+	query := `SELECT id, slug, model_id, file_name, file_path, file_size, quant, sha256, quarantine, port, revision, arch, params, created_at, last_used 
               FROM models WHERE slug = ?`
 	
 	var model Model
 	err := s.db.QueryRow(query, slug).Scan(
 		&model.ID, &model.Slug, &model.ModelID, &model.FileName, 
-		&model.FilePath, &model.FileSize, &model.CreatedAt, &model.LastUsed,
+		&model.FilePath, &model.FileSize, &model.Quant, &model.SHA256, &model.Quarantine, &model.Port, &model.Revision, &model.Arch, &model.Params, &model.CreatedAt, &model.LastUsed,
 	)
 	
 	if err == sql.ErrNoRows {
@@ -102,8 +343,8 @@ func (s *Store) GetModelBySlug(slug string) (*Model, error) {
 
 // GetAllModels retrieves all models from the database
 func (s *Store) GetAllModels() ([]Model, error) {
-	query := `SELECT id, slug, model_id, file_name, file_path, file_size, created_at, last_used 
-              FROM models ORDER BY last_used DESC, created_at DESC`
+	query := `SELECT id, slug, model_id, file_name, file_path, file_size, quant, sha256, quarantine, port, revision, arch, params, created_at, last_used 
+              FROM models ORDER BY last_used DESC, created_at DESC, slug`
 	
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -116,7 +357,7 @@ func (s *Store) GetAllModels() ([]Model, error) {
 		var model Model
 		if err := rows.Scan(
 			&model.ID, &model.Slug, &model.ModelID, &model.FileName, 
-			&model.FilePath, &model.FileSize, &model.CreatedAt, &model.LastUsed,
+			&model.FilePath, &model.FileSize, &model.Quant, &model.SHA256, &model.Quarantine, &model.Port, &model.Revision, &model.Arch, &model.Params, &model.CreatedAt, &model.LastUsed,
 		); err != nil {
 			return nil, fmt.Errorf("scanning model row: %w", err)
 		}
@@ -152,11 +393,11 @@ func (s *Store) UpdateModelLastUsed(slug string) error {
 }
 
 // AddModel adds a new model to the database
-func (s *Store) AddModel(slug, modelID, fileName, filePath, fileSize string) error {
-	query := `INSERT OR REPLACE INTO models (slug, model_id, file_name, file_path, file_size)
-              VALUES (?, ?, ?, ?, ?)`
+func (s *Store) AddModel(slug, modelID, fileName, filePath, fileSize, quant string) error {
+	query := `INSERT OR REPLACE INTO models (slug, model_id, file_name, file_path, file_size, quant)
+              VALUES (?, ?, ?, ?, ?, ?)`
 	
-	_, err := s.db.Exec(query, slug, modelID, fileName, filePath, fileSize)
+	_, err := s.db.Exec(query, slug, modelID, fileName, filePath, fileSize, quant)
 	if err != nil {
 		return fmt.Errorf("inserting model: %w", err)
 	}
@@ -164,6 +405,56 @@ func (s *Store) AddModel(slug, modelID, fileName, filePath, fileSize string) err
 	return nil
 }
 
+// SetModelChecksum records the SHA256 of a model's file
+func (s *Store) SetModelChecksum(slug, checksum string) error {
+	if _, err := s.db.Exec(`UPDATE models SET sha256 = ? WHERE slug = ?`, checksum, slug); err != nil {
+		return fmt.Errorf("saving model checksum: %w", err)
+	}
+	return nil
+}
+
+// SetModelRevision records the Hugging Face commit a model was downloaded from
+func (s *Store) SetModelRevision(slug, revision string) error {
+	if _, err := s.db.Exec(`UPDATE models SET revision = ? WHERE slug = ?`, revision, slug); err != nil {
+		return fmt.Errorf("saving model revision: %w", err)
+	}
+	return nil
+}
+
+// SetModelFileSize records the size of a model's file after it is replaced
+func (s *Store) SetModelFileSize(slug, fileSize string) error {
+	if _, err := s.db.Exec(`UPDATE models SET file_size = ? WHERE slug = ?`, fileSize, slug); err != nil {
+		return fmt.Errorf("saving model file size: %w", err)
+	}
+	return nil
+}
+
+// SetModelID records the Hugging Face repository a model comes from, such
+// as after the repository was renamed
+func (s *Store) SetModelID(slug, modelID string) error {
+	if _, err := s.db.Exec(`UPDATE models SET model_id = ? WHERE slug = ?`, modelID, slug); err != nil {
+		return fmt.Errorf("saving model ID: %w", err)
+	}
+	return nil
+}
+
+// SetModelMetadata records the architecture and parameter count read from
+// a model's GGUF
+func (s *Store) SetModelMetadata(slug, arch string, params int64) error {
+	if _, err := s.db.Exec(`UPDATE models SET arch = ?, params = ? WHERE slug = ?`, arch, params, slug); err != nil {
+		return fmt.Errorf("saving model metadata: %w", err)
+	}
+	return nil
+}
+
+// SetModelPort records the port assigned to a model's server
+func (s *Store) SetModelPort(slug string, port int) error {
+	if _, err := s.db.Exec(`UPDATE models SET port = ? WHERE slug = ?`, port, slug); err != nil {
+		return fmt.Errorf("saving model port: %w", err)
+	}
+	return nil
+}
+
 // RemoveModel removes a model from the database
 func (s *Store) RemoveModel(slug string) error {
 	query := `DELETE FROM models WHERE slug = ?`
@@ -182,14 +473,33 @@ func (s *Store) RemoveModel(slug string) error {
 		return fmt.Errorf("no model with slug '%s' found", slug)
 	}
 	
-	return nil
+	if err := s.ClearServerCrashes(slug); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM config_snapshots WHERE slug = ?`, slug); err != nil {
+		return fmt.Errorf("deleting config snapshots: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM slug_aliases WHERE slug = ?`, slug); err != nil {
+		return fmt.Errorf("deleting slug aliases: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM model_tags WHERE slug = ?`, slug); err != nil {
+		return fmt.Errorf("deleting model tags: %w", err)
+	}
+	return s.DeleteModelSettings(slug)
 }
 
-// UpdateModelSlug updates a model's slug (alias)
+// UpdateModelSlug updates a model's slug (alias) and every row referring
+// to it, all or none of them
 func (s *Store) UpdateModelSlug(oldSlug, newSlug string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("updating model slug: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `UPDATE models SET slug = ? WHERE slug = ?`
 	
-	result, err := s.db.Exec(query, newSlug, oldSlug)
+	result, err := tx.Exec(query, newSlug, oldSlug)
 	if err != nil {
 		return fmt.Errorf("updating model slug: %w", err)
 	}
@@ -203,5 +513,170 @@ func (s *Store) UpdateModelSlug(oldSlug, newSlug string) error {
 		return fmt.Errorf("no model with slug '%s' found", oldSlug)
 	}
 	
+	if _, err := tx.Exec(`UPDATE model_settings SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating model settings: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE server_crashes SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating server crashes: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE servers SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating servers: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE tune_results SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating tune results: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE bench_results SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating bench results: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE config_snapshots SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating config snapshots: %w", err)
+	}
+	// Aliases keep pointing at the model; one named like its new slug is dropped
+	if _, err := tx.Exec(`UPDATE slug_aliases SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating slug aliases: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM slug_aliases WHERE alias = ?`, newSlug); err != nil {
+		return fmt.Errorf("updating slug aliases: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE model_tags SET slug = ? WHERE slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating model tags: %w", err)
+	}
+	// Usage history follows the model to its new slug
+	if _, err := tx.Exec(`UPDATE sessions SET model_slug = ? WHERE model_slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating sessions: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE history SET model_slug = ? WHERE model_slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating history: %w", err)
+	}
+	// Indexes keep embedding queries with the model they were built with
+	if _, err := tx.Exec(`UPDATE index_collections SET model_slug = ? WHERE model_slug = ?`, newSlug, oldSlug); err != nil {
+		return fmt.Errorf("updating indexes: %w", err)
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("updating model slug: %w", err)
+	}
+	return nil
+}
+
+// GetCachedEmbedding returns the cached embedding of text for a model, or nil if none is cached
+func (s *Store) GetCachedEmbedding(modelKey, text string) ([]float64, error) {
+	query := `SELECT vector FROM embedding_cache WHERE model_key = ? AND text_hash = ?`
+
+	var blob []byte
+	err := s.db.QueryRow(query, modelKey, hashText(text)).Scan(&blob)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("querying embedding cache: %w", err)
+	}
+
+	return decodeVector(blob), nil
+}
+
+// CacheEmbedding stores the embedding of text for a model
+func (s *Store) CacheEmbedding(modelKey, text string, vector []float64) error {
+	query := `INSERT OR REPLACE INTO embedding_cache (model_key, text_hash, vector)
+              VALUES (?, ?, ?)`
+
+	if _, err := s.db.Exec(query, modelKey, hashText(text), encodeVector(vector)); err != nil {
+		return fmt.Errorf("caching embedding: %w", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// GetCachedEmbeddings returns the cached embeddings of texts for a model,
+// with nil in place of each text that isn't cached
+func (s *Store) GetCachedEmbeddings(modelKey string, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector, err := s.GetCachedEmbedding(modelKey, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// CacheEmbeddings stores the embeddings of texts for a model in one transaction
+func (s *Store) CacheEmbeddings(modelKey string, texts []string, vectors [][]float64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR REPLACE INTO embedding_cache (model_key, text_hash, vector) VALUES (?, ?, ?)`
+	for i, text := range texts {
+		if _, err := tx.Exec(query, modelKey, hashText(text), encodeVector(vectors[i])); err != nil {
+			return fmt.Errorf("caching embedding: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// hashText returns the hex-encoded SHA-256 of text
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeVector packs a vector as little-endian float32 values
+func encodeVector(vector []float64) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, x := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(x)))
+	}
+	return buf
+}
+
+// decodeVector unpacks a vector written by encodeVector
+func decodeVector(buf []byte) []float64 {
+	vector := make([]float64, len(buf)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return vector
+}
+
+// PurgeUserData removes sessions, history, cached embeddings, index
+// collections, saved prompts, task runs and usage timestamps, overwriting
+// the deleted content on disk and compacting the database file
+func (s *Store) PurgeUserData() error {
+	ctx := context.Background()
+
+	// Pragmas apply per connection, so run everything on a single one
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	statements := []string{
+		`PRAGMA secure_delete = ON`,
+		`DELETE FROM embedding_cache`,
+		`DELETE FROM session_messages`,
+		`DELETE FROM sessions`,
+		`DELETE FROM history`,
+		`DELETE FROM index_chunks`,
+		`DELETE FROM index_files`,
+		`DELETE FROM index_collections`,
+		`DELETE FROM prompts`,
+		`DELETE FROM task_runs`,
+		`UPDATE models SET last_used = NULL`,
+	}
+	if s.fts {
+		// Merge the index so deleted text doesn't linger in old segments
+		statements = append(statements, `INSERT INTO search_index (search_index) VALUES ('optimize')`)
+	}
+	statements = append(statements, `VACUUM`)
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("purging user data: %w", err)
+		}
+	}
+
+	return nil
+}
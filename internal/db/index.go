@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IndexCollection is a named set of embedded document chunks
+type IndexCollection struct {
+	Name      string
+	ModelSlug string // embedding model the chunks were embedded with
+	Dimension int
+	Files     int
+	Chunks    int
+	CreatedAt time.Time
+}
+
+// IndexChunk is a piece of an indexed file and its embedding
+type IndexChunk struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Text      string
+	Vector    []float64
+}
+
+// CreateIndexCollection records a new, empty collection
+func (s *Store) CreateIndexCollection(name, modelSlug string, dimension int) error {
+	query := `INSERT INTO index_collections (name, model_slug, dimension) VALUES (?, ?, ?)`
+	if _, err := s.db.Exec(query, name, modelSlug, dimension); err != nil {
+		return fmt.Errorf("creating index collection: %w", err)
+	}
+	return nil
+}
+
+// GetIndexCollection returns a collection with its file and chunk counts
+func (s *Store) GetIndexCollection(name string) (*IndexCollection, error) {
+	collections, err := s.queryIndexCollections(`WHERE c.name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("index collection '%s' not found", name)
+	}
+	return &collections[0], nil
+}
+
+// ListIndexCollections returns every collection by name
+func (s *Store) ListIndexCollections() ([]IndexCollection, error) {
+	return s.queryIndexCollections(``)
+}
+
+// queryIndexCollections returns the collections matching a WHERE clause
+func (s *Store) queryIndexCollections(where string, args ...interface{}) ([]IndexCollection, error) {
+	query := `SELECT c.name, c.model_slug, c.dimension, c.created_at,
+                     (SELECT COUNT(*) FROM index_files f WHERE f.collection = c.name),
+                     (SELECT COUNT(*) FROM index_chunks k WHERE k.collection = c.name)
+              FROM index_collections c ` + where + ` ORDER BY c.name`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying index collections: %w", err)
+	}
+	defer rows.Close()
+
+	var collections []IndexCollection
+	for rows.Next() {
+		var c IndexCollection
+		if err := rows.Scan(&c.Name, &c.ModelSlug, &c.Dimension, &c.CreatedAt, &c.Files, &c.Chunks); err != nil {
+			return nil, fmt.Errorf("scanning index collection: %w", err)
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating index collections: %w", err)
+	}
+	return collections, nil
+}
+
+// DeleteIndexCollection removes a collection with its files and chunks
+func (s *Store) DeleteIndexCollection(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM index_collections WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("deleting index collection: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("index collection '%s' not found", name)
+	}
+	if _, err := tx.Exec(`DELETE FROM index_files WHERE collection = ?`, name); err != nil {
+		return fmt.Errorf("deleting indexed files: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM index_chunks WHERE collection = ?`, name); err != nil {
+		return fmt.Errorf("deleting index chunks: %w", err)
+	}
+	return tx.Commit()
+}
+
+// IndexedFileHash returns the hash of a file's contents when it was last
+// indexed in a collection, or "" if it wasn't
+func (s *Store) IndexedFileHash(collection, path string) (string, error) {
+	var hash string
+	err := s.db.QueryRow(`SELECT hash FROM index_files WHERE collection = ? AND path = ?`, collection, path).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("querying indexed file: %w", err)
+	}
+	return hash, nil
+}
+
+// IndexedFiles returns the paths of the files indexed in a collection
+func (s *Store) IndexedFiles(collection string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT path FROM index_files WHERE collection = ? ORDER BY path`, collection)
+	if err != nil {
+		return nil, fmt.Errorf("querying indexed files: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("scanning indexed file: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// RemoveIndexedFile deletes a file and its chunks from a collection
+func (s *Store) RemoveIndexedFile(collection, path string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM index_chunks WHERE collection = ? AND path = ?`, collection, path); err != nil {
+		return fmt.Errorf("deleting index chunks: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM index_files WHERE collection = ? AND path = ?`, collection, path); err != nil {
+		return fmt.Errorf("deleting indexed file: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ReplaceIndexedFile replaces the chunks of a file in a collection
+func (s *Store) ReplaceIndexedFile(collection, path, hash string, chunks []IndexChunk) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM index_chunks WHERE collection = ? AND path = ?`, collection, path); err != nil {
+		return fmt.Errorf("deleting index chunks: %w", err)
+	}
+	insert := `INSERT INTO index_chunks (collection, path, start_line, end_line, text, vector) VALUES (?, ?, ?, ?, ?, ?)`
+	for _, chunk := range chunks {
+		if _, err := tx.Exec(insert, collection, path, chunk.StartLine, chunk.EndLine, chunk.Text, encodeVector(chunk.Vector)); err != nil {
+			return fmt.Errorf("saving index chunk: %w", err)
+		}
+	}
+	upsert := `INSERT OR REPLACE INTO index_files (collection, path, hash, indexed_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`
+	if _, err := tx.Exec(upsert, collection, path, hash); err != nil {
+		return fmt.Errorf("saving indexed file: %w", err)
+	}
+	return tx.Commit()
+}
+
+// IndexChunks returns every chunk of a collection
+func (s *Store) IndexChunks(collection string) ([]IndexChunk, error) {
+	rows, err := s.db.Query(`SELECT path, start_line, end_line, text, vector FROM index_chunks WHERE collection = ? ORDER BY id`, collection)
+	if err != nil {
+		return nil, fmt.Errorf("querying index chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []IndexChunk
+	for rows.Next() {
+		var chunk IndexChunk
+		var blob []byte
+		if err := rows.Scan(&chunk.Path, &chunk.StartLine, &chunk.EndLine, &chunk.Text, &blob); err != nil {
+			return nil, fmt.Errorf("scanning index chunk: %w", err)
+		}
+		chunk.Vector = decodeVector(blob)
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating index chunks: %w", err)
+	}
+	return chunks, nil
+}
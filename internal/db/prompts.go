@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Prompt is a saved prompt template
+type Prompt struct {
+	Name      string
+	Template  string // Go text/template source
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SavePrompt stores a prompt template under name, replacing the template of
+// a prompt already saved under it
+func (s *Store) SavePrompt(name, template string) error {
+	query := `INSERT INTO prompts (name, template) VALUES (?, ?)
+              ON CONFLICT(name) DO UPDATE SET template = excluded.template, updated_at = CURRENT_TIMESTAMP`
+	if _, err := s.db.Exec(query, name, template); err != nil {
+		return fmt.Errorf("saving prompt: %w", err)
+	}
+	return nil
+}
+
+// GetPrompt returns the prompt saved under name, or nil if there is none
+func (s *Store) GetPrompt(name string) (*Prompt, error) {
+	var prompt Prompt
+	query := `SELECT name, template, created_at, updated_at FROM prompts WHERE name = ?`
+	err := s.db.QueryRow(query, name).Scan(&prompt.Name, &prompt.Template, &prompt.CreatedAt, &prompt.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying prompt: %w", err)
+	}
+	return &prompt, nil
+}
+
+// GetPrompts returns every saved prompt, by name
+func (s *Store) GetPrompts() ([]Prompt, error) {
+	rows, err := s.db.Query(`SELECT name, template, created_at, updated_at FROM prompts ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("querying prompts: %w", err)
+	}
+	defer rows.Close()
+
+	var prompts []Prompt
+	for rows.Next() {
+		var prompt Prompt
+		if err := rows.Scan(&prompt.Name, &prompt.Template, &prompt.CreatedAt, &prompt.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scanning prompt: %w", err)
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, rows.Err()
+}
+
+// RemovePrompt deletes the prompt saved under name, reporting whether there
+// was one
+func (s *Store) RemovePrompt(name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM prompts WHERE name = ?`, name)
+	if err != nil {
+		return false, fmt.Errorf("removing prompt: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,387 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SearchHit is a stored session message or one-shot completion matching a search
+type SearchHit struct {
+	SessionID   int    // 0 for history entries
+	SessionName string // empty for history entries
+	ModelSlug   string
+	Role        string
+	Content     string
+	ContextRole string // the message before the match, if any
+	Context     string
+	CreatedAt   time.Time
+}
+
+// searchTable indexes unencrypted session messages and history with FTS5
+const searchTable = `
+    CREATE VIRTUAL TABLE search_index USING fts5(content, source UNINDEXED, ref UNINDEXED);
+`
+
+// searchTriggers keep the index in step with the tables. Encrypted content
+// is never indexed so its plaintext isn't stored.
+const searchTriggers = `
+    CREATE TRIGGER search_messages_insert AFTER INSERT ON session_messages
+    WHEN CAST(new.content AS TEXT) NOT LIKE 'llmcli-sealed:%' BEGIN
+        INSERT INTO search_index (content, source, ref) VALUES (CAST(new.content AS TEXT), 'message', new.id);
+    END;
+
+    CREATE TRIGGER search_messages_delete AFTER DELETE ON session_messages BEGIN
+        DELETE FROM search_index WHERE source = 'message' AND ref = old.id;
+    END;
+
+    CREATE TRIGGER search_history_insert AFTER INSERT ON history
+    WHEN CAST(new.prompt AS TEXT) NOT LIKE 'llmcli-sealed:%' BEGIN
+        INSERT INTO search_index (content, source, ref)
+        VALUES (CAST(new.prompt AS TEXT) || char(10) || CAST(new.response AS TEXT), 'history', new.id);
+    END;
+
+    CREATE TRIGGER search_history_delete AFTER DELETE ON history BEGIN
+        DELETE FROM search_index WHERE source = 'history' AND ref = old.id;
+    END;
+`
+
+// searchTriggerCount is how many triggers searchTriggers creates
+const searchTriggerCount = 4
+
+// dropSearchTriggers removes the triggers, which fail every insert and
+// delete they fire on when SQLite is built without FTS5
+const dropSearchTriggers = `
+    DROP TRIGGER IF EXISTS search_messages_insert;
+    DROP TRIGGER IF EXISTS search_messages_delete;
+    DROP TRIGGER IF EXISTS search_history_insert;
+    DROP TRIGGER IF EXISTS search_history_delete;
+`
+
+// searchFill indexes everything stored so far
+const searchFill = `
+    DELETE FROM search_index;
+
+    INSERT INTO search_index (content, source, ref)
+    SELECT CAST(content AS TEXT), 'message', id FROM session_messages
+    WHERE CAST(content AS TEXT) NOT LIKE 'llmcli-sealed:%';
+
+    INSERT INTO search_index (content, source, ref)
+    SELECT CAST(prompt AS TEXT) || char(10) || CAST(response AS TEXT), 'history', id FROM history
+    WHERE CAST(prompt AS TEXT) NOT LIKE 'llmcli-sealed:%';
+`
+
+// initSearchIndex creates the full-text search index on first use and
+// reports whether it is available. SQLite builds without FTS5 (the default
+// for go-sqlite3 unless built with -tags sqlite_fts5) fall back to scanning.
+// The same database may be opened by builds with and without FTS5, so
+// builds without it drop the index's triggers, and builds with it put them
+// back and index what was stored meanwhile.
+func initSearchIndex(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("checking for full-text search: %w", err)
+	}
+	if !enabled {
+		if _, err := db.Exec(dropSearchTriggers); err != nil {
+			return false, fmt.Errorf("removing search index triggers: %w", err)
+		}
+		return false, nil
+	}
+
+	var tables, triggers int
+	err := db.QueryRow(`SELECT COUNT(*) FILTER (WHERE type = 'table' AND name = 'search_index'),
+                               COUNT(*) FILTER (WHERE type = 'trigger' AND name LIKE 'search\_%' ESCAPE '\')
+                        FROM sqlite_master`).Scan(&tables, &triggers)
+	if err != nil {
+		return false, fmt.Errorf("checking search index: %w", err)
+	}
+	if tables == 1 && triggers == searchTriggerCount {
+		return true, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("creating search index: %w", err)
+	}
+	defer tx.Rollback()
+
+	schema := dropSearchTriggers + searchTriggers + searchFill
+	if tables == 0 {
+		schema = searchTable + schema
+	}
+	if _, err := tx.Exec(schema); err != nil {
+		return false, fmt.Errorf("creating search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("creating search index: %w", err)
+	}
+	return true, nil
+}
+
+// searchCleared is the meta key set while the index is kept empty because
+// stored content is encrypted
+const searchCleared = "search_index_cleared"
+
+// SetSearchEncrypted keeps the full-text index in step with whether stored
+// content is encrypted, and reports whether that changed the index. The
+// index holds plaintext, so while content is encrypted it is kept empty
+// (searches decrypt and scan instead), and once encryption is turned off
+// it is rebuilt from the content stored in plaintext.
+func (s *Store) SetSearchEncrypted(encrypted bool) (bool, error) {
+	if !s.fts {
+		return false, nil
+	}
+	cleared, err := s.GetMeta(searchCleared)
+	if err != nil {
+		return false, err
+	}
+
+	if !encrypted {
+		if cleared == "" {
+			return false, nil
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			return false, fmt.Errorf("rebuilding search index: %w", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(searchFill); err != nil {
+			return false, fmt.Errorf("rebuilding search index: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM meta WHERE key = ?`, searchCleared); err != nil {
+			return false, fmt.Errorf("rebuilding search index: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return false, fmt.Errorf("rebuilding search index: %w", err)
+		}
+		return true, nil
+	}
+
+	// Plaintext can still reach the index, as from a pulled state, so
+	// anything in it is removed on every run
+	var indexed bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM search_index)`).Scan(&indexed); err != nil {
+		return false, fmt.Errorf("checking search index: %w", err)
+	}
+	if indexed {
+		ctx := context.Background()
+		// Pragmas apply per connection, so run everything on a single one
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return false, fmt.Errorf("acquiring connection: %w", err)
+		}
+		defer conn.Close()
+		for _, stmt := range []string{
+			`PRAGMA secure_delete = ON`,
+			`DELETE FROM search_index`,
+			// Merge the index so deleted text doesn't linger in old segments
+			`INSERT INTO search_index (search_index) VALUES ('optimize')`,
+			`PRAGMA secure_delete = OFF`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return false, fmt.Errorf("clearing search index: %w", err)
+			}
+		}
+	}
+	if cleared == "" {
+		if err := s.SetMeta(searchCleared, "1"); err != nil {
+			return false, err
+		}
+	}
+	return cleared == "" && indexed, nil
+}
+
+// SearchConversations returns up to limit session messages and history
+// entries containing every word of query, best matches first. Without the
+// full-text index, or when stored content is encrypted, every message is
+// decrypted and scanned instead, newest first.
+func (s *Store) SearchConversations(query string, limit int) ([]SearchHit, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	if s.fts && s.cipherProvider == nil {
+		return s.searchIndex(terms, limit)
+	}
+	return s.searchScan(terms, limit)
+}
+
+// searchIndex finds matches with the FTS5 index
+func (s *Store) searchIndex(terms []string, limit int) ([]SearchHit, error) {
+	// Quote each term so punctuation isn't read as query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	query := `SELECT source, ref FROM search_index WHERE search_index MATCH ? ORDER BY rank LIMIT ?`
+	rows, err := s.db.Query(query, strings.Join(quoted, " "), limit)
+	if err != nil {
+		return nil, fmt.Errorf("searching: %w", err)
+	}
+
+	type match struct {
+		source string
+		ref    int
+	}
+	var matches []match
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.source, &m.ref); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning search results: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating search results: %w", err)
+	}
+
+	var hits []SearchHit
+	for _, m := range matches {
+		var hit *SearchHit
+		if m.source == "history" {
+			hit, err = s.historyHit(m.ref)
+		} else {
+			hit, err = s.messageHit(m.ref)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hit != nil {
+			hits = append(hits, *hit)
+		}
+	}
+	return hits, nil
+}
+
+// searchScan finds matches by reading every stored message
+func (s *Store) searchScan(terms []string, limit int) ([]SearchHit, error) {
+	var hits []SearchHit
+
+	rows, err := s.db.Query(`SELECT id FROM session_messages`)
+	if err != nil {
+		return nil, fmt.Errorf("searching sessions: %w", err)
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hit, err := s.messageHit(id)
+		if err != nil {
+			return nil, err
+		}
+		if hit != nil && containsAll(hit.Content, terms) {
+			hits = append(hits, *hit)
+		}
+	}
+
+	rows, err = s.db.Query(`SELECT id FROM history`)
+	if err != nil {
+		return nil, fmt.Errorf("searching history: %w", err)
+	}
+	if ids, err = scanIDs(rows); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hit, err := s.historyHit(id)
+		if err != nil {
+			return nil, err
+		}
+		if hit != nil && containsAll(hit.Context+"\n"+hit.Content, terms) {
+			hits = append(hits, *hit)
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].CreatedAt.After(hits[j].CreatedAt) })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// messageHit loads a session message with the message before it, or nil if it no longer exists
+func (s *Store) messageHit(id int) (*SearchHit, error) {
+	query := `SELECT m.session_id, s.name, s.model_slug, m.role, m.content, m.created_at
+              FROM session_messages m JOIN sessions s ON s.id = m.session_id WHERE m.id = ?`
+
+	var hit SearchHit
+	var content []byte
+	err := s.db.QueryRow(query, id).Scan(&hit.SessionID, &hit.SessionName, &hit.ModelSlug, &hit.Role, &content, &hit.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loading message: %w", err)
+	}
+	if hit.Content, err = s.open(content); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT role, content FROM session_messages WHERE session_id = ? AND id < ? ORDER BY id DESC LIMIT 1`
+	var previous []byte
+	err = s.db.QueryRow(query, hit.SessionID, id).Scan(&hit.ContextRole, &previous)
+	if err == nil {
+		if hit.Context, err = s.open(previous); err != nil {
+			return nil, err
+		}
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("loading message context: %w", err)
+	}
+
+	return &hit, nil
+}
+
+// historyHit loads a history entry as its response with the prompt as
+// context, or nil if it no longer exists
+func (s *Store) historyHit(id int) (*SearchHit, error) {
+	query := `SELECT model_slug, prompt, response, created_at FROM history WHERE id = ?`
+
+	hit := SearchHit{Role: "assistant", ContextRole: "user"}
+	var prompt, response []byte
+	err := s.db.QueryRow(query, id).Scan(&hit.ModelSlug, &prompt, &response, &hit.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loading history entry: %w", err)
+	}
+	if hit.Context, err = s.open(prompt); err != nil {
+		return nil, err
+	}
+	if hit.Content, err = s.open(response); err != nil {
+		return nil, err
+	}
+	return &hit, nil
+}
+
+// scanIDs reads a single integer column and closes rows
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// containsAll reports whether text contains every term, ignoring case
+func containsAll(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Server is a llama-server process started by llm-cli
+type Server struct {
+	PID       int
+	Port      int
+	Slug      string
+	ModelPath string
+	StartedAt time.Time
+	Size      int64     // bytes of model weights the server loaded
+	LastUsed  time.Time // when llm-cli last sent the model a request; StartedAt until then
+	LogPath   string    // file the server's output goes to; os.DevNull when logs are off
+
+	// Rolling request statistics, kept by RecordServerRequest
+	Requests  int           // requests recorded since the server started
+	ErrorRate float64       // share of recent requests that failed, 0 to 1
+	Latency   time.Duration // recent time to the first byte of a response
+	Baseline  time.Duration // the same over many more requests, for comparison
+
+	LastError   string    // why the last failed request failed; "" if none has
+	LastErrorAt time.Time // when it failed
+}
+
+// AddServer records a started server, replacing any earlier record of a
+// process with the same PID. A zero StartedAt means now.
+func (s *Store) AddServer(server Server) error {
+	var started interface{}
+	if !server.StartedAt.IsZero() {
+		started = server.StartedAt
+	}
+	query := `INSERT OR REPLACE INTO servers (pid, port, slug, model_path, size, log_path, started_at)
+              VALUES (?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`
+	if _, err := s.db.Exec(query, server.PID, server.Port, server.Slug, server.ModelPath, server.Size, server.LogPath, started); err != nil {
+		return fmt.Errorf("recording server: %w", err)
+	}
+	return nil
+}
+
+// TouchServer records that the servers for a model file were just used
+func (s *Store) TouchServer(modelPath string) error {
+	if _, err := s.db.Exec(`UPDATE servers SET last_used = CURRENT_TIMESTAMP WHERE model_path = ?`, modelPath); err != nil {
+		return fmt.Errorf("updating server: %w", err)
+	}
+	return nil
+}
+
+// RecordServerRequest adds a request to the rolling statistics of the
+// server on port: how long it took to start answering and, if it failed,
+// why, which is kept as the server's last error. Recent requests weigh most; the baseline latency changes slowly,
+// so a server that got slower stands out against it.
+func (s *Store) RecordServerRequest(port int, latency time.Duration, reqErr error) error {
+	ms := float64(latency) / float64(time.Millisecond)
+	failed := reqErr != nil
+	failure, message := 0.0, ""
+	if failed {
+		failure, message = 1, reqErr.Error()
+	}
+	// Failed requests say nothing about latency
+	query := `UPDATE servers SET
+                  error_rate  = CASE WHEN requests = 0 THEN ?1 ELSE error_rate * 0.8 + ?1 * 0.2 END,
+                  latency_ms  = CASE WHEN ?3 THEN latency_ms WHEN latency_ms = 0 THEN ?2 ELSE latency_ms * 0.8 + ?2 * 0.2 END,
+                  baseline_ms = CASE WHEN ?3 THEN baseline_ms WHEN baseline_ms = 0 THEN ?2 ELSE baseline_ms * 0.98 + ?2 * 0.02 END,
+                  requests    = requests + 1,
+                  last_error    = CASE WHEN ?3 THEN ?5 ELSE last_error END,
+                  last_error_at = CASE WHEN ?3 THEN CURRENT_TIMESTAMP ELSE last_error_at END
+              WHERE port = ?4`
+	if _, err := s.db.Exec(query, failure, ms, failed, port, message); err != nil {
+		return fmt.Errorf("recording server request: %w", err)
+	}
+	return nil
+}
+
+// RemoveServer forgets the server with the given PID
+func (s *Store) RemoveServer(pid int) error {
+	if _, err := s.db.Exec(`DELETE FROM servers WHERE pid = ?`, pid); err != nil {
+		return fmt.Errorf("removing server: %w", err)
+	}
+	return nil
+}
+
+// GetServers returns every recorded server, oldest first
+func (s *Store) GetServers() ([]Server, error) {
+	rows, err := s.db.Query(`SELECT pid, port, slug, model_path, started_at, size, last_used, log_path,
+                                    requests, error_rate, latency_ms, baseline_ms, last_error, last_error_at
+                             FROM servers ORDER BY started_at, pid`)
+	if err != nil {
+		return nil, fmt.Errorf("querying servers: %w", err)
+	}
+	defer rows.Close()
+
+	var servers []Server
+	for rows.Next() {
+		var server Server
+		var lastUsed, lastErrorAt sql.NullTime
+		var latency, baseline float64
+		if err := rows.Scan(&server.PID, &server.Port, &server.Slug, &server.ModelPath, &server.StartedAt, &server.Size, &lastUsed, &server.LogPath,
+			&server.Requests, &server.ErrorRate, &latency, &baseline, &server.LastError, &lastErrorAt); err != nil {
+			return nil, fmt.Errorf("scanning server: %w", err)
+		}
+		server.Latency = time.Duration(latency * float64(time.Millisecond))
+		server.Baseline = time.Duration(baseline * float64(time.Millisecond))
+		server.LastUsed = server.StartedAt
+		if lastUsed.Valid {
+			server.LastUsed = lastUsed.Time
+		}
+		if lastErrorAt.Valid {
+			server.LastErrorAt = lastErrorAt.Time
+		}
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
@@ -0,0 +1,351 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Session represents a saved chat session
+type Session struct {
+	ID        int
+	Name      string
+	ModelSlug string
+	Params    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Messages  int
+}
+
+// Message represents a single turn in a chat session
+type Message struct {
+	ID        int
+	SessionID int
+	Role      string
+	Content   string
+	CreatedAt time.Time
+}
+
+// HistoryEntry represents a stored one-shot completion
+type HistoryEntry struct {
+	ID        int
+	ModelSlug string
+	Prompt    string
+	Response  string
+	CreatedAt time.Time
+}
+
+// SetCipherProvider registers a function that supplies the cipher used to
+// encrypt sessions and history. It is only called the first time stored
+// content is read or written, so commands that never touch conversations
+// don't need to unlock it.
+func (s *Store) SetCipherProvider(provider func() (Cipher, error)) {
+	s.cipherProvider = provider
+	s.cipher = nil
+}
+
+// getCipher returns the configured cipher, or nil if encryption is disabled
+func (s *Store) getCipher() (Cipher, error) {
+	if s.cipher == nil && s.cipherProvider != nil {
+		cipher, err := s.cipherProvider()
+		if err != nil {
+			return nil, fmt.Errorf("unlocking encrypted storage: %w", err)
+		}
+		s.cipher = cipher
+	}
+	return s.cipher, nil
+}
+
+// seal prepares content for storage, encrypting it when a cipher is configured
+func (s *Store) seal(content string) ([]byte, error) {
+	cipher, err := s.getCipher()
+	if err != nil {
+		return nil, err
+	}
+	if cipher == nil {
+		return []byte(content), nil
+	}
+
+	sealed, err := cipher.Seal([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting content: %w", err)
+	}
+	return append([]byte(sealedPrefix), sealed...), nil
+}
+
+// open reverses seal. Plaintext written before encryption was enabled is returned as is.
+func (s *Store) open(stored []byte) (string, error) {
+	if !bytes.HasPrefix(stored, []byte(sealedPrefix)) {
+		return string(stored), nil
+	}
+
+	cipher, err := s.getCipher()
+	if err != nil {
+		return "", err
+	}
+	if cipher == nil {
+		return "", fmt.Errorf("content is encrypted but encryption is not enabled in the config")
+	}
+
+	plaintext, err := cipher.Open(stored[len(sealedPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("decrypting content: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// GetMeta returns a value from the meta table, or "" if it isn't set
+func (s *Store) GetMeta(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("querying meta: %w", err)
+	}
+	return value, nil
+}
+
+// SetMeta stores a value in the meta table
+func (s *Store) SetMeta(key, value string) error {
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, key, value); err != nil {
+		return fmt.Errorf("updating meta: %w", err)
+	}
+	return nil
+}
+
+// GetOrCreateSession returns the session with the given name, creating it if
+// needed. params records the sampling settings the session was started with.
+func (s *Store) GetOrCreateSession(name, modelSlug, params string) (*Session, error) {
+	query := `INSERT OR IGNORE INTO sessions (name, model_slug, params) VALUES (?, ?, ?)`
+	if _, err := s.db.Exec(query, name, modelSlug, params); err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+	return s.GetSession(name)
+}
+
+// GetSession retrieves a session by name
+func (s *Store) GetSession(name string) (*Session, error) {
+	query := `SELECT s.id, s.name, s.model_slug, s.params, s.created_at, s.updated_at, COUNT(m.id)
+              FROM sessions s LEFT JOIN session_messages m ON m.session_id = s.id
+              WHERE s.name = ? GROUP BY s.id`
+
+	var session Session
+	err := s.db.QueryRow(query, name).Scan(
+		&session.ID, &session.Name, &session.ModelSlug, &session.Params,
+		&session.CreatedAt, &session.UpdatedAt, &session.Messages,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session '%s' not found", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("querying session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// GetAllSessions retrieves all sessions, most recently updated first
+func (s *Store) GetAllSessions() ([]Session, error) {
+	query := `SELECT s.id, s.name, s.model_slug, s.params, s.created_at, s.updated_at, COUNT(m.id)
+              FROM sessions s LEFT JOIN session_messages m ON m.session_id = s.id
+              GROUP BY s.id ORDER BY s.updated_at DESC, s.id DESC`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID, &session.Name, &session.ModelSlug, &session.Params,
+			&session.CreatedAt, &session.UpdatedAt, &session.Messages,
+		); err != nil {
+			return nil, fmt.Errorf("scanning session row: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating session rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// AddSessionMessage appends a message to a session
+func (s *Store) AddSessionMessage(sessionID int, role, content string) error {
+	sealed, err := s.seal(content)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO session_messages (session_id, role, content) VALUES (?, ?, ?)`
+	if _, err := s.db.Exec(query, sessionID, role, sealed); err != nil {
+		return fmt.Errorf("inserting session message: %w", err)
+	}
+
+	query = `UPDATE sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceLastSessionMessage replaces the content of a session's most recent
+// message, such as a reply that was continued after being cut off. The
+// message is deleted and re-inserted so the search index follows it.
+func (s *Store) ReplaceLastSessionMessage(sessionID int, content string) error {
+	sealed, err := s.seal(content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("replacing session message: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var role string
+	query := `SELECT id, role FROM session_messages WHERE session_id = ? ORDER BY id DESC LIMIT 1`
+	if err := tx.QueryRow(query, sessionID).Scan(&id, &role); err != nil {
+		return fmt.Errorf("finding last session message: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM session_messages WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("replacing session message: %w", err)
+	}
+	query = `INSERT INTO session_messages (session_id, role, content) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(query, sessionID, role, sealed); err != nil {
+		return fmt.Errorf("replacing session message: %w", err)
+	}
+	query = `UPDATE sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := tx.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// SetSessionSystemPrompt stores the system prompt of a session, or removes
+// it when prompt is empty. It is encrypted like the session's messages.
+func (s *Store) SetSessionSystemPrompt(sessionID int, prompt string) error {
+	var sealed interface{}
+	if prompt != "" {
+		var err error
+		if sealed, err = s.seal(prompt); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE sessions SET system_prompt = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, sealed, sessionID); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionSystemPrompt returns the system prompt of a session, or "" if
+// it has none
+func (s *Store) GetSessionSystemPrompt(sessionID int) (string, error) {
+	var stored []byte
+	if err := s.db.QueryRow(`SELECT system_prompt FROM sessions WHERE id = ?`, sessionID).Scan(&stored); err != nil {
+		return "", fmt.Errorf("querying session: %w", err)
+	}
+	if stored == nil {
+		return "", nil
+	}
+	return s.open(stored)
+}
+
+// SetSessionModel records the model a session continues with
+func (s *Store) SetSessionModel(sessionID int, modelSlug string) error {
+	query := `UPDATE sessions SET model_slug = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, modelSlug, sessionID); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+	return nil
+}
+
+// RenameSession gives a session a new name, which no other session may have
+func (s *Store) RenameSession(sessionID int, name string) error {
+	var taken bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sessions WHERE name = ? AND id != ?)`, name, sessionID).Scan(&taken); err != nil {
+		return fmt.Errorf("querying sessions: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("session '%s' already exists", name)
+	}
+	query := `UPDATE sessions SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, name, sessionID); err != nil {
+		return fmt.Errorf("renaming session: %w", err)
+	}
+	return nil
+}
+
+// ClearSessionMessages deletes every message of a session, keeping the
+// session itself
+func (s *Store) ClearSessionMessages(sessionID int) error {
+	if _, err := s.db.Exec(`DELETE FROM session_messages WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("clearing session: %w", err)
+	}
+	query := `UPDATE sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionMessages retrieves the messages of a session in order
+func (s *Store) GetSessionMessages(sessionID int) ([]Message, error) {
+	query := `SELECT id, session_id, role, content, created_at
+              FROM session_messages WHERE session_id = ? ORDER BY id`
+
+	rows, err := s.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("querying session messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var message Message
+		var content []byte
+		if err := rows.Scan(&message.ID, &message.SessionID, &message.Role, &content, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning message row: %w", err)
+		}
+		if message.Content, err = s.open(content); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating message rows: %w", err)
+	}
+
+	return messages, nil
+}
+
+// AddHistory records a one-shot completion
+func (s *Store) AddHistory(modelSlug, prompt, response string) error {
+	sealedPrompt, err := s.seal(prompt)
+	if err != nil {
+		return err
+	}
+	sealedResponse, err := s.seal(response)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO history (model_slug, prompt, response) VALUES (?, ?, ?)`
+	if _, err := s.db.Exec(query, modelSlug, sealedPrompt, sealedResponse); err != nil {
+		return fmt.Errorf("inserting history: %w", err)
+	}
+
+	return nil
+}
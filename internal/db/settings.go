@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+)
+
+// GetModelSettings returns the stored settings of a model keyed by name
+func (s *Store) GetModelSettings(slug string) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM model_settings WHERE slug = ?`, slug)
+	if err != nil {
+		return nil, fmt.Errorf("querying model settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("scanning model setting: %w", err)
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// SetModelSettings stores several settings of a model in one transaction
+func (s *Store) SetModelSettings(slug string, settings map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range settings {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO model_settings (slug, key, value) VALUES (?, ?, ?)`, slug, key, value); err != nil {
+			return fmt.Errorf("saving model setting %s: %w", key, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteModelSettings removes the given settings of a model, or all of them when keys is empty
+func (s *Store) DeleteModelSettings(slug string, keys ...string) error {
+	if len(keys) == 0 {
+		if _, err := s.db.Exec(`DELETE FROM model_settings WHERE slug = ?`, slug); err != nil {
+			return fmt.Errorf("deleting model settings: %w", err)
+		}
+		return nil
+	}
+
+	for _, key := range keys {
+		if _, err := s.db.Exec(`DELETE FROM model_settings WHERE slug = ? AND key = ?`, slug, key); err != nil {
+			return fmt.Errorf("deleting model setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ReplaceModelSettings replaces every stored setting of a model with settings
+// in one transaction
+func (s *Store) ReplaceModelSettings(slug string, settings map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM model_settings WHERE slug = ?`, slug); err != nil {
+		return fmt.Errorf("deleting model settings: %w", err)
+	}
+	for key, value := range settings {
+		if _, err := tx.Exec(`INSERT INTO model_settings (slug, key, value) VALUES (?, ?, ?)`, slug, key, value); err != nil {
+			return fmt.Errorf("saving model setting %s: %w", key, err)
+		}
+	}
+	return tx.Commit()
+}
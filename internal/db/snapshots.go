@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ConfigSnapshot is a saved version of a model's configuration
+type ConfigSnapshot struct {
+	Slug         string
+	Version      int               // 1 for a model's first snapshot, counting up
+	Settings     map[string]string // the model_settings of the model
+	ChatTemplate string            // tokenizer.chat_template of the model file; empty if none
+	CreatedAt    time.Time
+}
+
+// AddConfigSnapshot saves a model's configuration as its next version and
+// returns the version number
+func (s *Store) AddConfigSnapshot(slug string, settings map[string]string, chatTemplate string) (int, error) {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return 0, fmt.Errorf("encoding settings: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM config_snapshots WHERE slug = ?`, slug).Scan(&version); err != nil {
+		return 0, fmt.Errorf("querying config snapshots: %w", err)
+	}
+	query := `INSERT INTO config_snapshots (slug, version, settings, chat_template) VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, slug, version, string(encoded), chatTemplate); err != nil {
+		return 0, fmt.Errorf("saving config snapshot: %w", err)
+	}
+	return version, tx.Commit()
+}
+
+// GetConfigSnapshot returns a version of a model's configuration, or the
+// latest when version is 0, or nil if there is no such snapshot
+func (s *Store) GetConfigSnapshot(slug string, version int) (*ConfigSnapshot, error) {
+	query := `SELECT slug, version, settings, chat_template, created_at FROM config_snapshots
+              WHERE slug = ? AND (version = ? OR ? = 0) ORDER BY version DESC LIMIT 1`
+	snapshot, err := scanConfigSnapshot(s.db.QueryRow(query, slug, version, version))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// GetConfigSnapshots returns every saved version of a model's
+// configuration, oldest first
+func (s *Store) GetConfigSnapshots(slug string) ([]ConfigSnapshot, error) {
+	rows, err := s.db.Query(`SELECT slug, version, settings, chat_template, created_at FROM config_snapshots
+              WHERE slug = ? ORDER BY version`, slug)
+	if err != nil {
+		return nil, fmt.Errorf("querying config snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []ConfigSnapshot
+	for rows.Next() {
+		snapshot, err := scanConfigSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// scanConfigSnapshot reads a config_snapshots row
+func scanConfigSnapshot(row interface{ Scan(...any) error }) (*ConfigSnapshot, error) {
+	var snapshot ConfigSnapshot
+	var settings string
+	if err := row.Scan(&snapshot.Slug, &snapshot.Version, &settings, &snapshot.ChatTemplate, &snapshot.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scanning config snapshot: %w", err)
+	}
+	if err := json.Unmarshal([]byte(settings), &snapshot.Settings); err != nil {
+		return nil, fmt.Errorf("decoding config snapshot settings: %w", err)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stateTables are the tables ExportState and ImportState copy, parents
+// before the tables that refer to them: the user's sessions, history,
+// model settings, tags and snapshots. Models, servers, caches, indexes,
+// benchmark results and the encryption salt belong to the machine they
+// were made on.
+var stateTables = []string{"sessions", "session_messages", "model_settings", "model_tags", "config_snapshots", "history"}
+
+// vaultKeys are the meta rows describing the key encrypted rows are sealed
+// with. An exported state carries them, so an import can tell whether the
+// key is the one the importing machine has.
+var vaultKeys = []string{"vault_salt", "vault_check"}
+
+// ExportState writes the tables that can move between machines to a new
+// database at path, replacing any file already there
+func (s *Store) ExportState(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	export, err := New(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range vaultKeys {
+		value, err := s.GetMeta(key)
+		if err == nil && value != "" {
+			err = export.SetMeta(key, value)
+		}
+		if err != nil {
+			export.Close()
+			return err
+		}
+	}
+	export.Close()
+	return s.copyState(path, "main", "state")
+}
+
+// StateVault returns the encryption salt and check value of the machine
+// that exported the state at path, or "" when it had none
+func StateVault(path string) (salt, check string, err error) {
+	state, err := New(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer state.Close()
+	if salt, err = state.GetMeta("vault_salt"); err != nil {
+		return "", "", err
+	}
+	check, err = state.GetMeta("vault_check")
+	return salt, check, err
+}
+
+// ImportState replaces the tables that can move between machines with
+// those of the database at path, as written by ExportState
+func (s *Store) ImportState(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("reading state: %w", err)
+	}
+	return s.copyState(path, "state", "main")
+}
+
+// copyState attaches the database at path as "state" and replaces the
+// state tables of schema to with those of schema from. Columns missing on
+// either side, as in a database from an older llm-cli, are left out.
+func (s *Store) copyState(path, from, to string) error {
+	ctx := context.Background()
+
+	// ATTACH applies per connection, so run everything on a single one
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS state`, path); err != nil {
+		return fmt.Errorf("attaching %s: %w", path, err)
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE state`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := len(stateTables) - 1; i >= 0; i-- {
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s.%s`, to, stateTables[i])); err != nil {
+			return fmt.Errorf("clearing %s: %w", stateTables[i], err)
+		}
+	}
+	for _, table := range stateTables {
+		columns, err := sharedColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		if columns == "" {
+			continue
+		}
+		query := fmt.Sprintf(`INSERT INTO %s.%s (%s) SELECT %s FROM %s.%s`, to, table, columns, columns, from, table)
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("copying %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing state: %w", err)
+	}
+	return nil
+}
+
+// sharedColumns returns the columns a table has in both the main and the
+// attached state database, comma-separated
+func sharedColumns(tx *sql.Tx, table string) (string, error) {
+	names := func(schema string) (map[string]bool, []string, error) {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s', '%s')`, table, schema))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading columns of %s: %w", table, err)
+		}
+		defer rows.Close()
+		set := make(map[string]bool)
+		var ordered []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, nil, fmt.Errorf("reading columns of %s: %w", table, err)
+			}
+			set[name] = true
+			ordered = append(ordered, name)
+		}
+		return set, ordered, rows.Err()
+	}
+
+	_, mainColumns, err := names("main")
+	if err != nil {
+		return "", err
+	}
+	stateColumns, _, err := names("state")
+	if err != nil {
+		return "", err
+	}
+	var shared []string
+	for _, name := range mainColumns {
+		if stateColumns[name] {
+			shared = append(shared, name)
+		}
+	}
+	return strings.Join(shared, ", "), nil
+}
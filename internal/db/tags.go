@@ -0,0 +1,45 @@
+package db
+
+import "fmt"
+
+// AddModelTag tags the model with the given slug; a tag it already has is
+// left as is
+func (s *Store) AddModelTag(slug, tag string) error {
+	if _, err := s.db.Exec(`INSERT OR IGNORE INTO model_tags (slug, tag) VALUES (?, ?)`, slug, tag); err != nil {
+		return fmt.Errorf("adding model tag: %w", err)
+	}
+	return nil
+}
+
+// RemoveModelTag removes a tag from the model with the given slug,
+// reporting whether it had it
+func (s *Store) RemoveModelTag(slug, tag string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM model_tags WHERE slug = ? AND tag = ?`, slug, tag)
+	if err != nil {
+		return false, fmt.Errorf("removing model tag: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("checking rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetModelTags returns the tags of every model, by slug
+func (s *Store) GetModelTags() (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT slug, tag FROM model_tags ORDER BY tag`)
+	if err != nil {
+		return nil, fmt.Errorf("querying model tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var slug, tag string
+		if err := rows.Scan(&slug, &tag); err != nil {
+			return nil, fmt.Errorf("scanning model tag: %w", err)
+		}
+		tags[slug] = append(tags[slug], tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TaskRun records one execution of a scheduled task
+type TaskRun struct {
+	ID         int
+	TaskName   string
+	StartedAt  time.Time
+	FinishedAt sql.NullTime
+	Status     string
+	Error      string
+}
+
+// StartTaskRun records that a task has started and returns the run ID
+func (s *Store) StartTaskRun(taskName string) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO task_runs (task_name) VALUES (?)`, taskName)
+	if err != nil {
+		return 0, fmt.Errorf("recording task run: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// FinishTaskRun records the outcome of a task run
+func (s *Store) FinishTaskRun(id int64, status, errMsg string) error {
+	query := `UPDATE task_runs SET finished_at = CURRENT_TIMESTAMP, status = ?, error = ? WHERE id = ?`
+	if _, err := s.db.Exec(query, status, errMsg, id); err != nil {
+		return fmt.Errorf("recording task result: %w", err)
+	}
+	return nil
+}
+
+// GetLastTaskRun returns the most recent run of a task, or nil if it never ran
+func (s *Store) GetLastTaskRun(taskName string) (*TaskRun, error) {
+	query := `SELECT id, task_name, started_at, finished_at, status, error
+              FROM task_runs WHERE task_name = ? ORDER BY id DESC LIMIT 1`
+
+	var run TaskRun
+	err := s.db.QueryRow(query, taskName).Scan(
+		&run.ID, &run.TaskName, &run.StartedAt, &run.FinishedAt, &run.Status, &run.Error,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("querying task runs: %w", err)
+	}
+
+	return &run, nil
+}
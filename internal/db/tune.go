@@ -0,0 +1,28 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// TuneResult is the benchmark of one parameter combination
+type TuneResult struct {
+	ID          int
+	Slug        string
+	Params      string
+	PromptTPS   float64
+	GenTPS      float64
+	MemoryBytes int64
+	Status      string
+	CreatedAt   time.Time
+}
+
+// AddTuneResult records a benchmark result
+func (s *Store) AddTuneResult(r TuneResult) error {
+	query := `INSERT INTO tune_results (slug, params, prompt_tps, gen_tps, memory_bytes, status)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, r.Slug, r.Params, r.PromptTPS, r.GenTPS, r.MemoryBytes, r.Status); err != nil {
+		return fmt.Errorf("saving tune result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+// Package gguf reads and writes GGUF model files without loading tensor data.
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const (
+	magic            = 0x46554747 // "GGUF" little-endian
+	defaultAlignment = 32
+	alignmentKey     = "general.alignment"
+)
+
+// ValueType is the type of a metadata value
+type ValueType uint32
+
+// Metadata value types
+const (
+	TypeUint8 ValueType = iota
+	TypeInt8
+	TypeUint16
+	TypeInt16
+	TypeUint32
+	TypeInt32
+	TypeFloat32
+	TypeBool
+	TypeString
+	TypeArray
+	TypeUint64
+	TypeInt64
+	TypeFloat64
+)
+
+// KV is a metadata key/value pair. Value holds the Go type matching Type
+// (uint8, int8, ..., string, bool) or an Array.
+type KV struct {
+	Key   string
+	Type  ValueType
+	Value interface{}
+}
+
+// Array is an array metadata value
+type Array struct {
+	Type   ValueType
+	Values []interface{}
+}
+
+// TensorInfo describes a tensor and where its data lives in the file
+type TensorInfo struct {
+	Name   string
+	Dims   []uint64
+	Type   uint32
+	Offset uint64 // relative to the start of the data section
+	Size   uint64 // bytes up to the next tensor, including padding
+}
+
+// File is a parsed GGUF header
+type File struct {
+	Path       string
+	Version    uint32
+	KV         []KV
+	Tensors    []TensorInfo
+	Alignment  uint64
+	DataOffset int64
+	FileSize   int64
+}
+
+// Open parses the header, metadata and tensor infos of a GGUF file
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	r := &reader{r: bufio.NewReaderSize(file, 1<<20)}
+	f := &File{Path: path, FileSize: info.Size(), Alignment: defaultAlignment}
+
+	if m := r.u32(); r.err == nil && m != magic {
+		return nil, fmt.Errorf("%s is not a GGUF file", path)
+	}
+	f.Version = r.u32()
+	if r.err == nil && f.Version < 2 {
+		return nil, fmt.Errorf("%s uses unsupported GGUF version %d", path, f.Version)
+	}
+
+	tensorCount := r.u64()
+	kvCount := r.u64()
+	if r.err != nil {
+		return nil, fmt.Errorf("reading %s header: %w", path, r.err)
+	}
+
+	for i := uint64(0); i < kvCount && r.err == nil; i++ {
+		key := r.str()
+		typ := ValueType(r.u32())
+		value := r.value(typ)
+		f.KV = append(f.KV, KV{Key: key, Type: typ, Value: value})
+	}
+
+	for i := uint64(0); i < tensorCount && r.err == nil; i++ {
+		t := TensorInfo{Name: r.str()}
+		dims := r.u32()
+		for d := uint32(0); d < dims && r.err == nil; d++ {
+			t.Dims = append(t.Dims, r.u64())
+		}
+		t.Type = r.u32()
+		t.Offset = r.u64()
+		f.Tensors = append(f.Tensors, t)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("reading %s metadata: %w", path, r.err)
+	}
+
+	if v, ok := f.Uint(alignmentKey); ok && v > 0 {
+		f.Alignment = v
+	}
+	f.DataOffset = int64(align(uint64(r.n), f.Alignment))
+
+	// Derive each tensor's size from the distance to the next one
+	order := make([]int, len(f.Tensors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return f.Tensors[order[a]].Offset < f.Tensors[order[b]].Offset })
+	dataSize := uint64(f.FileSize - f.DataOffset)
+	for i, idx := range order {
+		end := dataSize
+		if i+1 < len(order) {
+			end = f.Tensors[order[i+1]].Offset
+		}
+		if end < f.Tensors[idx].Offset {
+			return nil, fmt.Errorf("%s has an invalid offset for tensor %s", path, f.Tensors[idx].Name)
+		}
+		f.Tensors[idx].Size = end - f.Tensors[idx].Offset
+	}
+
+	return f, nil
+}
+
+// Get returns the metadata entry for key
+func (f *File) Get(key string) (*KV, bool) {
+	for i := range f.KV {
+		if f.KV[i].Key == key {
+			return &f.KV[i], true
+		}
+	}
+	return nil, false
+}
+
+// Set adds or replaces a metadata entry
+func (f *File) Set(key string, typ ValueType, value interface{}) {
+	if kv, ok := f.Get(key); ok {
+		kv.Type, kv.Value = typ, value
+		return
+	}
+	f.KV = append(f.KV, KV{Key: key, Type: typ, Value: value})
+}
+
+// Delete removes a metadata entry, reporting whether it existed
+func (f *File) Delete(key string) bool {
+	for i := range f.KV {
+		if f.KV[i].Key == key {
+			f.KV = append(f.KV[:i], f.KV[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a string metadata value
+func (f *File) String(key string) (string, bool) {
+	kv, ok := f.Get(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := kv.Value.(string)
+	return s, ok
+}
+
+// Uint returns an integer metadata value as uint64
+func (f *File) Uint(key string) (uint64, bool) {
+	kv, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch v := kv.Value.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// Float returns a numeric metadata value as float64
+func (f *File) Float(key string) (float64, bool) {
+	kv, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch v := kv.Value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	if u, ok := f.Uint(key); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+// ParseValue converts text to a metadata value of the given scalar type
+func ParseValue(typ ValueType, text string) (interface{}, error) {
+	var value interface{}
+	var err error
+
+	switch typ {
+	case TypeString:
+		return text, nil
+	case TypeBool:
+		value, err = strconv.ParseBool(text)
+	case TypeUint8, TypeUint16, TypeUint32, TypeUint64:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, typ.bits())
+		switch typ {
+		case TypeUint8:
+			value = uint8(u)
+		case TypeUint16:
+			value = uint16(u)
+		case TypeUint32:
+			value = uint32(u)
+		default:
+			value = u
+		}
+	case TypeInt8, TypeInt16, TypeInt32, TypeInt64:
+		var n int64
+		n, err = strconv.ParseInt(text, 10, typ.bits())
+		switch typ {
+		case TypeInt8:
+			value = int8(n)
+		case TypeInt16:
+			value = int16(n)
+		case TypeInt32:
+			value = int32(n)
+		default:
+			value = n
+		}
+	case TypeFloat32:
+		var v float64
+		v, err = strconv.ParseFloat(text, 32)
+		value = float32(v)
+	case TypeFloat64:
+		value, err = strconv.ParseFloat(text, 64)
+	default:
+		return nil, fmt.Errorf("values of type %s cannot be set from text", typ)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", typ, text)
+	}
+	return value, nil
+}
+
+// bits returns the size of an integer type in bits
+func (t ValueType) bits() int {
+	switch t {
+	case TypeUint8, TypeInt8:
+		return 8
+	case TypeUint16, TypeInt16:
+		return 16
+	case TypeUint32, TypeInt32:
+		return 32
+	}
+	return 64
+}
+
+// String returns the GGUF name of a value type
+func (t ValueType) String() string {
+	names := []string{"uint8", "int8", "uint16", "int16", "uint32", "int32", "float32", "bool", "string", "array", "uint64", "int64", "float64"}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	return fmt.Sprintf("type(%d)", uint32(t))
+}
+
+// align rounds n up to a multiple of alignment
+func align(n, alignment uint64) uint64 {
+	return (n + alignment - 1) / alignment * alignment
+}
+
+// reader decodes little-endian GGUF primitives, remembering the first error
+type reader struct {
+	r   io.Reader
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func (r *reader) read(n int) []byte {
+	if r.err != nil {
+		return r.buf[:n]
+	}
+	_, r.err = io.ReadFull(r.r, r.buf[:n])
+	r.n += int64(n)
+	return r.buf[:n]
+}
+
+func (r *reader) u8() uint8   { return r.read(1)[0] }
+func (r *reader) u16() uint16 { return binary.LittleEndian.Uint16(r.read(2)) }
+func (r *reader) u32() uint32 { return binary.LittleEndian.Uint32(r.read(4)) }
+func (r *reader) u64() uint64 { return binary.LittleEndian.Uint64(r.read(8)) }
+
+func (r *reader) str() string {
+	n := r.u64()
+	if r.err != nil {
+		return ""
+	}
+	if n > 1<<30 {
+		r.err = fmt.Errorf("string length %d too large", n)
+		return ""
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	r.n += int64(n)
+	return string(b)
+}
+
+func (r *reader) value(typ ValueType) interface{} {
+	switch typ {
+	case TypeUint8:
+		return r.u8()
+	case TypeInt8:
+		return int8(r.u8())
+	case TypeUint16:
+		return r.u16()
+	case TypeInt16:
+		return int16(r.u16())
+	case TypeUint32:
+		return r.u32()
+	case TypeInt32:
+		return int32(r.u32())
+	case TypeFloat32:
+		return math.Float32frombits(r.u32())
+	case TypeBool:
+		return r.u8() != 0
+	case TypeString:
+		return r.str()
+	case TypeUint64:
+		return r.u64()
+	case TypeInt64:
+		return int64(r.u64())
+	case TypeFloat64:
+		return math.Float64frombits(r.u64())
+	case TypeArray:
+		arr := Array{Type: ValueType(r.u32())}
+		n := r.u64()
+		if r.err == nil && n > 1<<28 {
+			r.err = fmt.Errorf("array length %d too large", n)
+		}
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			arr.Values = append(arr.Values, r.value(arr.Type))
+		}
+		return arr
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("unknown metadata type %d", typ)
+	}
+	return nil
+}
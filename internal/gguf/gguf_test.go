@@ -0,0 +1,88 @@
+package gguf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	path, _ := writeTestModel(t, t.TempDir())
+	before := tensorData(t, path)
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Set("general.name", TypeString, "Renamed")
+	f.Set("tokenizer.chat_template", TypeString, "{{ messages }}")
+	if !f.Delete("general.file_type") {
+		t.Error("Delete didn't find general.file_type")
+	}
+	if f.Delete("general.missing") {
+		t.Error("Delete found a key that isn't there")
+	}
+	// Saved over the file it was read from
+	if err := f.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	saved, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := saved.String("general.name"); name != "Renamed" {
+		t.Errorf("general.name = %q, want Renamed", name)
+	}
+	if template, _ := saved.String("tokenizer.chat_template"); template != "{{ messages }}" {
+		t.Errorf("tokenizer.chat_template = %q", template)
+	}
+	if _, ok := saved.Get("general.file_type"); ok {
+		t.Error("general.file_type is still there")
+	}
+	if !reflect.DeepEqual(tensorData(t, path), before) {
+		t.Error("saving changed the tensors")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		typ  ValueType
+		text string
+		want interface{}
+	}{
+		{TypeString, "hello", "hello"},
+		{TypeBool, "true", true},
+		{TypeUint8, "255", uint8(255)},
+		{TypeUint16, "1024", uint16(1024)},
+		{TypeUint32, "32768", uint32(32768)},
+		{TypeUint64, "1099511627776", uint64(1 << 40)},
+		{TypeInt8, "-128", int8(-128)},
+		{TypeInt32, "-5", int32(-5)},
+		{TypeInt64, "7", int64(7)},
+		{TypeFloat32, "0.5", float32(0.5)},
+		{TypeFloat64, "1e6", float64(1e6)},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.typ, tt.text)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseValue(%s, %q) = %#v, %v; want %#v", tt.typ, tt.text, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		typ  ValueType
+		text string
+	}{
+		{TypeUint8, "256"},
+		{TypeUint32, "-1"},
+		{TypeInt8, "128"},
+		{TypeBool, "maybe"},
+		{TypeFloat32, "fast"},
+		{TypeArray, "[1]"},
+	}
+	for _, tt := range invalid {
+		if got, err := ParseValue(tt.typ, tt.text); err == nil {
+			t.Errorf("ParseValue(%s, %q) = %#v, want an error", tt.typ, tt.text, got)
+		}
+	}
+}
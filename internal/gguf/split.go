@@ -0,0 +1,156 @@
+package gguf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys written by llama.cpp's gguf-split
+const (
+	splitNoKey           = "split.no"
+	splitCountKey        = "split.count"
+	splitTensorsCountKey = "split.tensors.count"
+)
+
+var shardPattern = regexp.MustCompile(`^(.*)-(\d{5})-of-(\d{5})\.gguf$`)
+
+// ShardPath returns the file name of shard n (1-based) of count for prefix
+func ShardPath(prefix string, n, count int) string {
+	return fmt.Sprintf("%s-%05d-of-%05d.gguf", prefix, n, count)
+}
+
+// ShardPaths returns every shard path of a split model given any one of its
+// shards, or nil if path is not named like a shard
+func ShardPaths(path string) []string {
+	match := shardPattern.FindStringSubmatch(path)
+	if match == nil {
+		return nil
+	}
+	count, _ := strconv.Atoi(match[3])
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = ShardPath(match[1], i+1, count)
+	}
+	return paths
+}
+
+// isSplitKey reports whether key is split bookkeeping metadata
+func isSplitKey(key string) bool {
+	return strings.HasPrefix(key, "split.")
+}
+
+// Join merges the shards of a split model, starting from its first shard,
+// into a single GGUF file
+func Join(firstShard, output string) (int, error) {
+	first, err := Open(firstShard)
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := first.Uint(splitCountKey)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a split GGUF shard", firstShard)
+	}
+	if no, _ := first.Uint(splitNoKey); no != 0 {
+		return 0, fmt.Errorf("%s is shard %d; pass the first shard", firstShard, no+1)
+	}
+
+	paths := ShardPaths(firstShard)
+	if len(paths) != int(count) {
+		return 0, fmt.Errorf("cannot locate the %d shards of %s", count, firstShard)
+	}
+
+	var kvs []KV
+	for _, kv := range first.KV {
+		if !isSplitKey(kv.Key) {
+			kvs = append(kvs, kv)
+		}
+	}
+
+	var tensors []TensorInfo
+	var sources []tensorSource
+	for i, path := range paths {
+		shard := first
+		if i > 0 {
+			if shard, err = Open(path); err != nil {
+				return 0, err
+			}
+			if no, _ := shard.Uint(splitNoKey); int(no) != i {
+				return 0, fmt.Errorf("%s has split number %d, expected %d", path, no, i)
+			}
+		}
+		for j := range shard.Tensors {
+			tensors = append(tensors, shard.Tensors[j])
+			sources = append(sources, shard.source(j))
+		}
+	}
+
+	if expected, ok := first.Uint(splitTensorsCountKey); ok && int(expected) != len(tensors) {
+		return 0, fmt.Errorf("shards contain %d tensors, expected %d", len(tensors), expected)
+	}
+
+	return len(paths), writeFile(output, first.Version, kvs, tensors, sources)
+}
+
+// Split writes path as shards named prefix-0000N-of-0000M.gguf, starting a
+// new shard after maxTensors tensors or before exceeding maxBytes of tensor
+// data (zero disables a limit). The first shard carries all metadata.
+func Split(path, prefix string, maxTensors int, maxBytes int64) ([]string, error) {
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.Get(splitCountKey); ok {
+		return nil, fmt.Errorf("%s is already a shard; join it first", path)
+	}
+
+	// Group tensor indexes into shards
+	var groups [][]int
+	var current []int
+	var size int64
+	for i, t := range f.Tensors {
+		full := maxTensors > 0 && len(current) >= maxTensors
+		tooBig := maxBytes > 0 && len(current) > 0 && size+int64(t.Size) > maxBytes
+		if full || tooBig {
+			groups = append(groups, current)
+			current, size = nil, 0
+		}
+		current = append(current, i)
+		size += int64(t.Size)
+	}
+	if len(current) > 0 || len(groups) == 0 {
+		groups = append(groups, current)
+	}
+
+	var written []string
+	for n, group := range groups {
+		var kvs []KV
+		if n == 0 {
+			kvs = append(kvs, f.KV...)
+		} else if alignment, ok := f.Get(alignmentKey); ok {
+			kvs = append(kvs, *alignment)
+		}
+		kvs = append(kvs,
+			KV{Key: splitNoKey, Type: TypeUint16, Value: uint16(n)},
+			KV{Key: splitCountKey, Type: TypeUint16, Value: uint16(len(groups))},
+			KV{Key: splitTensorsCountKey, Type: TypeInt32, Value: int32(len(f.Tensors))},
+		)
+
+		tensors := make([]TensorInfo, len(group))
+		sources := make([]tensorSource, len(group))
+		for j, idx := range group {
+			tensors[j] = f.Tensors[idx]
+			sources[j] = f.source(idx)
+		}
+
+		out := ShardPath(prefix, n+1, len(groups))
+		if err := writeFile(out, f.Version, kvs, tensors, sources); err != nil {
+			return written, err
+		}
+		written = append(written, out)
+	}
+
+	return written, nil
+}
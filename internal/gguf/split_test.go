@@ -0,0 +1,228 @@
+package gguf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testTensors are the tensors of the model writeTestModel writes, with
+// sizes that need padding to the alignment
+var testTensors = []struct {
+	name string
+	size int
+}{
+	{"token_embd.weight", 40},
+	{"blk.0.attn_q.weight", 7},
+	{"blk.0.ffn_up.weight", 100},
+	{"output.weight", 32},
+}
+
+// writeTestModel writes a small GGUF model to dir and returns its path and
+// each tensor's data
+func writeTestModel(t *testing.T, dir string) (string, [][]byte) {
+	t.Helper()
+	var raw bytes.Buffer
+	var tensors []TensorInfo
+	var sources []tensorSource
+	var data [][]byte
+	rawPath := filepath.Join(dir, "tensors.bin")
+	for i, tt := range testTensors {
+		b := bytes.Repeat([]byte{byte(i + 1)}, tt.size)
+		sources = append(sources, tensorSource{path: rawPath, offset: int64(raw.Len()), size: uint64(tt.size)})
+		raw.Write(b)
+		tensors = append(tensors, TensorInfo{Name: tt.name, Dims: []uint64{uint64(tt.size)}, Type: 0})
+		data = append(data, b)
+	}
+	if err := os.WriteFile(rawPath, raw.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs := []KV{
+		{Key: "general.architecture", Type: TypeString, Value: "llama"},
+		{Key: "general.name", Type: TypeString, Value: "Test"},
+		{Key: "llama.context_length", Type: TypeUint32, Value: uint32(4096)},
+		{Key: "general.file_type", Type: TypeUint32, Value: uint32(15)},
+		{Key: "tokenizer.ggml.tokens", Type: TypeArray, Value: Array{Type: TypeString, Values: []interface{}{"<s>", "</s>"}}},
+	}
+	path := filepath.Join(dir, "model.gguf")
+	if err := writeFile(path, 3, kvs, tensors, sources); err != nil {
+		t.Fatalf("writing the test model: %v", err)
+	}
+	return path, data
+}
+
+// tensorData reads the data of each tensor of the GGUF file at path,
+// without the padding after it
+func tensorData(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[string][]byte)
+	for _, tensor := range f.Tensors {
+		start := f.DataOffset + int64(tensor.Offset)
+		data[tensor.Name] = content[start : start+int64(tensor.Dims[0])]
+	}
+	return data
+}
+
+func TestWriteAndOpen(t *testing.T) {
+	path, data := writeTestModel(t, t.TempDir())
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if f.Version != 3 || len(f.KV) != 5 || len(f.Tensors) != len(testTensors) {
+		t.Fatalf("Open = version %d, %d keys, %d tensors", f.Version, len(f.KV), len(f.Tensors))
+	}
+	if name, _ := f.String("general.name"); name != "Test" {
+		t.Errorf("general.name = %q", name)
+	}
+	if ctx, _ := f.Uint("llama.context_length"); ctx != 4096 {
+		t.Errorf("llama.context_length = %d", ctx)
+	}
+	if tokens, _ := f.Get("tokenizer.ggml.tokens"); !reflect.DeepEqual(tokens.Value, Array{Type: TypeString, Values: []interface{}{"<s>", "</s>"}}) {
+		t.Errorf("tokenizer.ggml.tokens = %v", tokens.Value)
+	}
+	for i, tensor := range f.Tensors {
+		if tensor.Offset%defaultAlignment != 0 {
+			t.Errorf("tensor %s at offset %d is not aligned", tensor.Name, tensor.Offset)
+		}
+		if tensor.Size < uint64(testTensors[i].size) {
+			t.Errorf("tensor %s has size %d, less than its %d bytes", tensor.Name, tensor.Size, testTensors[i].size)
+		}
+	}
+	got := tensorData(t, path)
+	for i, tt := range testTensors {
+		if !bytes.Equal(got[tt.name], data[i]) {
+			t.Errorf("tensor %s holds %v, want %v", tt.name, got[tt.name], data[i])
+		}
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	dir := t.TempDir()
+	notGGUF := filepath.Join(dir, "model.bin")
+	os.WriteFile(notGGUF, []byte("not a model at all"), 0644)
+	if _, err := Open(notGGUF); err == nil {
+		t.Error("Open accepted a file that isn't GGUF")
+	}
+
+	path, _ := writeTestModel(t, dir)
+	content, _ := os.ReadFile(path)
+	truncated := filepath.Join(dir, "truncated.gguf")
+	os.WriteFile(truncated, content[:40], 0644)
+	if _, err := Open(truncated); err == nil {
+		t.Error("Open accepted a truncated header")
+	}
+}
+
+func TestSplitAndJoin(t *testing.T) {
+	dir := t.TempDir()
+	path, _ := writeTestModel(t, dir)
+	original, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		maxTensors int
+		maxBytes   int64
+		shards     int
+	}{
+		{"by tensors", 1, 0, 4},
+		{"by size", 0, 128, 3},
+		{"one shard", 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := filepath.Join(t.TempDir(), "model")
+			shards, err := Split(path, prefix, tt.maxTensors, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			if len(shards) != tt.shards {
+				t.Fatalf("Split wrote %d shards, want %d", len(shards), tt.shards)
+			}
+			if want := ShardPaths(shards[len(shards)-1]); !reflect.DeepEqual(shards, want) {
+				t.Errorf("Split wrote %q, ShardPaths gives %q", shards, want)
+			}
+
+			first, err := Open(shards[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name, _ := first.String("general.name"); name != "Test" {
+				t.Error("the first shard doesn't carry the metadata")
+			}
+			if count, _ := first.Uint(splitCountKey); int(count) != tt.shards {
+				t.Errorf("split.count = %d, want %d", count, tt.shards)
+			}
+			if len(shards) > 1 {
+				if _, err := Join(shards[1], filepath.Join(t.TempDir(), "x.gguf")); err == nil {
+					t.Error("Join accepted a shard other than the first")
+				}
+			}
+
+			joined := filepath.Join(t.TempDir(), "joined.gguf")
+			n, err := Join(shards[0], joined)
+			if err != nil {
+				t.Fatalf("Join: %v", err)
+			}
+			if n != tt.shards {
+				t.Errorf("Join read %d shards, want %d", n, tt.shards)
+			}
+			f, err := Open(joined)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(f.KV, original.KV) {
+				t.Errorf("joined metadata = %v, want %v", f.KV, original.KV)
+			}
+			if !reflect.DeepEqual(tensorData(t, joined), tensorData(t, path)) {
+				t.Error("the joined tensors differ from the original's")
+			}
+		})
+	}
+}
+
+func TestSplitRejectsShard(t *testing.T) {
+	path, _ := writeTestModel(t, t.TempDir())
+	shards, err := Split(path, filepath.Join(t.TempDir(), "model"), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Split(shards[0], filepath.Join(t.TempDir(), "again"), 1, 0); err == nil {
+		t.Error("Split accepted a shard")
+	}
+
+	// A missing shard is found before anything is written
+	os.Remove(shards[1])
+	joined := filepath.Join(t.TempDir(), "joined.gguf")
+	if _, err := Join(shards[0], joined); err == nil {
+		t.Error("Join succeeded with a shard missing")
+	}
+	if _, err := os.Stat(joined); !os.IsNotExist(err) {
+		t.Error("Join left a file behind after failing")
+	}
+}
+
+func TestShardPaths(t *testing.T) {
+	if got, want := ShardPaths("/m/qwen-00002-of-00003.gguf"), []string{
+		"/m/qwen-00001-of-00003.gguf", "/m/qwen-00002-of-00003.gguf", "/m/qwen-00003-of-00003.gguf",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ShardPaths = %q, want %q", got, want)
+	}
+	if got := ShardPaths("/m/qwen.gguf"); got != nil {
+		t.Errorf("ShardPaths of an unsplit model = %q, want nil", got)
+	}
+}
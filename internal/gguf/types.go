@@ -0,0 +1,56 @@
+package gguf
+
+import "fmt"
+
+// tensorTypes names ggml tensor types by their enum value
+var tensorTypes = map[uint32]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 6: "Q5_0", 7: "Q5_1", 8: "Q8_0", 9: "Q8_1",
+	10: "Q2_K", 11: "Q3_K", 12: "Q4_K", 13: "Q5_K", 14: "Q6_K", 15: "Q8_K",
+	16: "IQ2_XXS", 17: "IQ2_XS", 18: "IQ3_XXS", 19: "IQ1_S", 20: "IQ4_NL", 21: "IQ3_S",
+	22: "IQ2_S", 23: "IQ4_XS", 24: "I8", 25: "I16", 26: "I32", 27: "I64", 28: "F64",
+	29: "IQ1_M", 30: "BF16", 34: "TQ1_0", 35: "TQ2_0",
+}
+
+// fileTypes names the general.file_type values written by llama.cpp, which
+// describe the quantization of the model as a whole
+var fileTypes = map[uint64]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M",
+	16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S",
+	22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0",
+}
+
+// TensorTypeName returns the name of a ggml tensor type, such as Q4_K
+func TensorTypeName(typ uint32) string {
+	if name, ok := tensorTypes[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", typ)
+}
+
+// FileType returns the quantization recorded in general.file_type, such as
+// Q4_K_M, or false if the file doesn't record one
+func (f *File) FileType() (string, bool) {
+	ft, ok := f.Uint("general.file_type")
+	if !ok {
+		return "", false
+	}
+	if name, ok := fileTypes[ft]; ok {
+		return name, true
+	}
+	return fmt.Sprintf("type %d", ft), true
+}
+
+// ParameterCount returns the number of weights in the file's tensors
+func (f *File) ParameterCount() uint64 {
+	var total uint64
+	for _, t := range f.Tensors {
+		n := uint64(1)
+		for _, d := range t.Dims {
+			n *= d
+		}
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,237 @@
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// tensorSource locates a tensor's data in an existing file
+type tensorSource struct {
+	path   string
+	offset int64
+	size   uint64
+}
+
+// source returns where the data of tensor i lives in f
+func (f *File) source(i int) tensorSource {
+	t := f.Tensors[i]
+	return tensorSource{path: f.Path, offset: f.DataOffset + int64(t.Offset), size: t.Size}
+}
+
+// Save writes f, with its current metadata, to path. Tensor data is copied
+// from the file f was read from. The file is written to a temporary name
+// and renamed into place, so path may be f.Path itself.
+func (f *File) Save(path string) error {
+	sources := make([]tensorSource, len(f.Tensors))
+	for i := range f.Tensors {
+		sources[i] = f.source(i)
+	}
+	return writeFile(path, f.Version, f.KV, f.Tensors, sources)
+}
+
+// writeFile writes a GGUF file whose tensor data is copied from sources
+func writeFile(path string, version uint32, kvs []KV, tensors []TensorInfo, sources []tensorSource) error {
+	alignment := uint64(defaultAlignment)
+	for _, kv := range kvs {
+		if kv.Key == alignmentKey {
+			if v, ok := kv.Value.(uint32); ok && v > 0 {
+				alignment = uint64(v)
+			}
+		}
+	}
+
+	tmp := path + ".partial"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	w := &writer{w: bufio.NewWriterSize(out, 1<<20)}
+	w.u32(magic)
+	w.u32(version)
+	w.u64(uint64(len(tensors)))
+	w.u64(uint64(len(kvs)))
+	for _, kv := range kvs {
+		w.str(kv.Key)
+		w.u32(uint32(kv.Type))
+		w.value(kv.Type, kv.Value)
+	}
+
+	offset := uint64(0)
+	for i, t := range tensors {
+		w.str(t.Name)
+		w.u32(uint32(len(t.Dims)))
+		for _, d := range t.Dims {
+			w.u64(d)
+		}
+		w.u32(t.Type)
+		w.u64(offset)
+		offset = align(offset+sources[i].size, alignment)
+	}
+	w.pad(alignment)
+
+	files := map[string]*os.File{}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	for _, src := range sources {
+		if w.err != nil {
+			break
+		}
+		in, ok := files[src.path]
+		if !ok {
+			if in, err = os.Open(src.path); err != nil {
+				return fmt.Errorf("opening %s: %w", src.path, err)
+			}
+			files[src.path] = in
+		}
+		n, err := io.Copy(w.w, io.NewSectionReader(in, src.offset, int64(src.size)))
+		w.n += n
+		if err != nil {
+			return fmt.Errorf("copying tensor data: %w", err)
+		}
+		w.pad(alignment)
+	}
+
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err != nil {
+		return fmt.Errorf("writing %s: %w", path, w.err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := verify(tmp, kvs, tensors); err != nil {
+		return fmt.Errorf("verifying %s: %w", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// verify re-reads a written file and checks it holds the expected metadata and tensors
+func verify(path string, kvs []KV, tensors []TensorInfo) error {
+	f, err := Open(path)
+	if err != nil {
+		return err
+	}
+	if len(f.KV) != len(kvs) || len(f.Tensors) != len(tensors) {
+		return fmt.Errorf("expected %d keys and %d tensors, found %d and %d", len(kvs), len(tensors), len(f.KV), len(f.Tensors))
+	}
+	for i, kv := range kvs {
+		got := f.KV[i]
+		if got.Key != kv.Key || got.Type != kv.Type {
+			return fmt.Errorf("metadata key %s was not written correctly", kv.Key)
+		}
+		if kv.Type != TypeArray && got.Value != kv.Value {
+			return fmt.Errorf("metadata value of %s was not written correctly", kv.Key)
+		}
+	}
+	for i, t := range tensors {
+		if f.Tensors[i].Name != t.Name {
+			return fmt.Errorf("tensor %s was not written correctly", t.Name)
+		}
+	}
+	return nil
+}
+
+// writer encodes little-endian GGUF primitives, remembering the first error
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) u8(v uint8) { w.write([]byte{v}) }
+
+func (w *writer) u16(v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	w.write(b[:])
+}
+
+func (w *writer) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.write(b[:])
+}
+
+func (w *writer) u64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.write(b[:])
+}
+
+func (w *writer) str(s string) {
+	w.u64(uint64(len(s)))
+	w.write([]byte(s))
+}
+
+// pad writes zeros up to the next multiple of alignment
+func (w *writer) pad(alignment uint64) {
+	if n := align(uint64(w.n), alignment) - uint64(w.n); n > 0 {
+		w.write(make([]byte, n))
+	}
+}
+
+func (w *writer) value(typ ValueType, value interface{}) {
+	if w.err != nil {
+		return
+	}
+	switch typ {
+	case TypeUint8:
+		w.u8(value.(uint8))
+	case TypeInt8:
+		w.u8(uint8(value.(int8)))
+	case TypeUint16:
+		w.u16(value.(uint16))
+	case TypeInt16:
+		w.u16(uint16(value.(int16)))
+	case TypeUint32:
+		w.u32(value.(uint32))
+	case TypeInt32:
+		w.u32(uint32(value.(int32)))
+	case TypeFloat32:
+		w.u32(math.Float32bits(value.(float32)))
+	case TypeBool:
+		if value.(bool) {
+			w.u8(1)
+		} else {
+			w.u8(0)
+		}
+	case TypeString:
+		w.str(value.(string))
+	case TypeUint64:
+		w.u64(value.(uint64))
+	case TypeInt64:
+		w.u64(uint64(value.(int64)))
+	case TypeFloat64:
+		w.u64(math.Float64bits(value.(float64)))
+	case TypeArray:
+		arr := value.(Array)
+		w.u32(uint32(arr.Type))
+		w.u64(uint64(len(arr.Values)))
+		for _, v := range arr.Values {
+			w.value(arr.Type, v)
+		}
+	default:
+		w.err = fmt.Errorf("unknown metadata type %d", typ)
+	}
+}
@@ -0,0 +1,425 @@
+// Package grammar converts JSON schemas to GBNF, the grammar format
+// llama-server uses to constrain generation, so a completion is always a
+// JSON value the schema accepts.
+package grammar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// primitives are the rules shared by every grammar, added when used
+var primitives = map[string]string{
+	"space":         `| " " | "\n" [ \t]{0,20}`,
+	"boolean":       `("true" | "false") space`,
+	"null":          `"null" space`,
+	"integral-part": `[0] | [1-9] [0-9]{0,15}`,
+	"decimal-part":  `[0-9]{1,16}`,
+	"integer":       `("-"? integral-part) space`,
+	"number":        `("-"? integral-part) ("." decimal-part)? ([eE] [-+]? integral-part)? space`,
+	"char":          `[^"\\\x7F\x00-\x1F] | [\\] (["\\bfnrt] | "u" [0-9a-fA-F]{4})`,
+	"string":        `"\"" char* "\"" space`,
+	"value":         `object | array | string | number | boolean | null`,
+	"object":        `"{" space ( string ":" space value ("," space string ":" space value)* )? "}" space`,
+	"array":         `"[" space ( value ("," space value)* )? "]" space`,
+}
+
+// dependencies lists the primitives each primitive refers to
+var dependencies = map[string][]string{
+	"boolean":       {"space"},
+	"null":          {"space"},
+	"integer":       {"integral-part", "space"},
+	"number":        {"integral-part", "decimal-part", "space"},
+	"string":        {"char", "space"},
+	"value":         {"object", "array", "string", "number", "boolean", "null"},
+	"object":        {"string", "value", "space"},
+	"array":         {"value", "space"},
+	"char":          nil,
+	"space":         nil,
+	"decimal-part":  nil,
+	"integral-part": nil,
+}
+
+var invalidRuleChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// schema is the part of a JSON schema the converter understands
+type schema struct {
+	Type        json.RawMessage            `json:"type"`
+	Properties  json.RawMessage            `json:"properties"`
+	Required    []string                   `json:"required"`
+	Items       json.RawMessage            `json:"items"`
+	MinItems    *int                       `json:"minItems"`
+	MaxItems    *int                       `json:"maxItems"`
+	MinLength   *int                       `json:"minLength"`
+	MaxLength   *int                       `json:"maxLength"`
+	Enum        []json.RawMessage          `json:"enum"`
+	Const       json.RawMessage            `json:"const"`
+	AnyOf       []json.RawMessage          `json:"anyOf"`
+	OneOf       []json.RawMessage          `json:"oneOf"`
+	AllOf       []json.RawMessage          `json:"allOf"`
+	Ref         string                     `json:"$ref"`
+	Defs        map[string]json.RawMessage `json:"$defs"`
+	Definitions map[string]json.RawMessage `json:"definitions"`
+	Pattern     string                     `json:"pattern"`
+}
+
+// converter builds the rules of one grammar
+type converter struct {
+	rules map[string]string
+	defs  map[string]json.RawMessage
+	refs  map[string]string // rule name by $ref, so recursive schemas terminate
+}
+
+// FromJSONSchema returns a GBNF grammar matching the JSON values data, a
+// JSON schema, accepts. It supports types, properties and required,
+// items, minItems and maxItems, string lengths, enum, const, anyOf, oneOf
+// and local $refs. Properties are generated in the order the schema lists
+// them, required ones first.
+func FromJSONSchema(data []byte) (string, error) {
+	var root schema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return "", fmt.Errorf("parsing JSON schema: %w", err)
+	}
+	c := &converter{rules: make(map[string]string), defs: make(map[string]json.RawMessage), refs: make(map[string]string)}
+	for name, def := range root.Definitions {
+		c.defs["#/definitions/"+name] = def
+	}
+	for name, def := range root.Defs {
+		c.defs["#/$defs/"+name] = def
+	}
+
+	expr, err := c.visit(data, "root")
+	if err != nil {
+		return "", err
+	}
+	if expr != "root" {
+		c.rules["root"] = expr
+	}
+	return c.format(), nil
+}
+
+// visit returns a grammar expression for a schema, adding the rules it needs
+// under names starting with name
+func (c *converter) visit(data json.RawMessage, name string) (string, error) {
+	if t := bytes.TrimSpace(data); bytes.Equal(t, []byte("true")) || bytes.Equal(t, []byte("{}")) {
+		return c.primitive("value"), nil
+	}
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return "", fmt.Errorf("parsing %s: %w", name, err)
+	}
+
+	switch {
+	case s.Ref != "":
+		return c.ref(s.Ref)
+	case s.Const != nil:
+		return literal(s.Const) + " " + c.primitive("space"), nil
+	case s.Enum != nil:
+		var alternatives []string
+		for _, value := range s.Enum {
+			alternatives = append(alternatives, literal(value))
+		}
+		return c.add(name, "("+strings.Join(alternatives, " | ")+") "+c.primitive("space")), nil
+	case s.AnyOf != nil || s.OneOf != nil:
+		return c.alternatives(append(s.AnyOf, s.OneOf...), name)
+	case s.AllOf != nil:
+		return "", fmt.Errorf("%s: allOf is not supported", name)
+	case s.Pattern != "":
+		return "", fmt.Errorf("%s: pattern is not supported", name)
+	}
+
+	var types []string
+	if len(s.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(s.Type, &single); err == nil {
+			types = []string{single}
+		} else if err := json.Unmarshal(s.Type, &types); err != nil {
+			return "", fmt.Errorf("%s: invalid type: %s", name, s.Type)
+		}
+	} else if s.Properties != nil {
+		types = []string{"object"}
+	} else if s.Items != nil {
+		types = []string{"array"}
+	}
+	if len(types) == 0 {
+		return c.primitive("value"), nil
+	}
+
+	var alternatives []string
+	for _, typ := range types {
+		ruleName := name
+		if len(types) > 1 {
+			ruleName = name + "-" + typ
+		}
+		expr, err := c.typed(s, typ, ruleName)
+		if err != nil {
+			return "", err
+		}
+		alternatives = append(alternatives, expr)
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return c.add(name, strings.Join(alternatives, " | ")), nil
+}
+
+// typed returns a grammar expression for a schema of a single type
+func (c *converter) typed(s schema, typ, name string) (string, error) {
+	switch typ {
+	case "boolean", "null", "integer", "number":
+		return c.primitive(typ), nil
+	case "string":
+		if s.MinLength == nil && s.MaxLength == nil {
+			return c.primitive("string"), nil
+		}
+		return c.add(name, `"\"" `+c.primitive("char")+repeat(s.MinLength, s.MaxLength)+` "\"" `+c.primitive("space")), nil
+	case "array":
+		return c.array(s, name)
+	case "object":
+		return c.object(s, name)
+	}
+	return "", fmt.Errorf("%s: unsupported type %q", name, typ)
+}
+
+// array returns a rule for an array schema
+func (c *converter) array(s schema, name string) (string, error) {
+	space := c.primitive("space")
+	if s.MaxItems != nil && *s.MaxItems == 0 {
+		return c.add(name, `"[" `+space+` "]" `+space), nil
+	}
+
+	var item string
+	if s.Items != nil {
+		var err error
+		if item, err = c.visit(s.Items, name+"-item"); err != nil {
+			return "", err
+		}
+	} else {
+		item = c.primitive("value")
+	}
+
+	minItems, maxItems := 0, -1
+	if s.MinItems != nil {
+		minItems = *s.MinItems
+	}
+	if s.MaxItems != nil {
+		maxItems = *s.MaxItems
+	}
+
+	// The first item, then the rest each after a comma
+	rest := `("," ` + space + ` ` + item + `)`
+	switch {
+	case maxItems < 0 && minItems <= 1:
+		rest += "*"
+	case maxItems < 0:
+		rest += fmt.Sprintf("{%d,}", minItems-1)
+	default:
+		rest += fmt.Sprintf("{%d,%d}", max(minItems-1, 0), maxItems-1)
+	}
+	items := item + " " + rest
+	if minItems == 0 {
+		items = "(" + items + ")?"
+	}
+	return c.add(name, `"[" `+space+` `+items+` "]" `+space), nil
+}
+
+// object returns a rule for an object schema
+func (c *converter) object(s schema, name string) (string, error) {
+	if s.Properties == nil {
+		return c.primitive("object"), nil
+	}
+	keys, err := orderedKeys(s.Properties)
+	if err != nil {
+		return "", fmt.Errorf("%s: reading properties: %w", name, err)
+	}
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(s.Properties, &properties); err != nil {
+		return "", fmt.Errorf("%s: reading properties: %w", name, err)
+	}
+
+	required := make(map[string]bool)
+	for _, key := range s.Required {
+		if _, ok := properties[key]; !ok {
+			return "", fmt.Errorf("%s: required property %q is not defined", name, key)
+		}
+		required[key] = true
+	}
+
+	space := c.primitive("space")
+	var requiredPairs, optionalPairs []string
+	for _, key := range keys {
+		value, err := c.visit(properties[key], name+"-"+key)
+		if err != nil {
+			return "", err
+		}
+		keyJSON, _ := json.Marshal(key)
+		pair := c.add(name+"-"+key+"-kv", literal(keyJSON)+` `+space+` ":" `+space+` `+value)
+		if required[key] {
+			requiredPairs = append(requiredPairs, pair)
+		} else {
+			optionalPairs = append(optionalPairs, pair)
+		}
+	}
+
+	comma := `"," ` + space + ` `
+	var body string
+	if len(requiredPairs) > 0 {
+		body = strings.Join(requiredPairs, " "+comma)
+		for _, pair := range optionalPairs {
+			body += " (" + comma + pair + ")?"
+		}
+	} else if len(optionalPairs) > 0 {
+		// Any optional property can come first, followed by any of the ones after it
+		var starts []string
+		for i, pair := range optionalPairs {
+			start := pair
+			for _, later := range optionalPairs[i+1:] {
+				start += " (" + comma + later + ")?"
+			}
+			starts = append(starts, start)
+		}
+		body = "(" + strings.Join(starts, " | ") + ")?"
+	}
+	return c.add(name, `"{" `+space+` `+body+` "}" `+space), nil
+}
+
+// alternatives returns a rule matching any of several schemas
+func (c *converter) alternatives(schemas []json.RawMessage, name string) (string, error) {
+	var exprs []string
+	for i, sub := range schemas {
+		expr, err := c.visit(sub, fmt.Sprintf("%s-%d", name, i))
+		if err != nil {
+			return "", err
+		}
+		exprs = append(exprs, expr)
+	}
+	return c.add(name, strings.Join(exprs, " | ")), nil
+}
+
+// ref returns the rule of a local $ref, converting its schema the first
+// time it is used
+func (c *converter) ref(ref string) (string, error) {
+	if rule, ok := c.refs[ref]; ok {
+		return rule, nil
+	}
+	def, ok := c.defs[ref]
+	if !ok {
+		return "", fmt.Errorf("unsupported $ref %q (only #/$defs/... and #/definitions/... are)", ref)
+	}
+	name := ruleName("ref-" + ref[strings.LastIndex(ref, "/")+1:])
+	c.refs[ref] = name
+	// Reserve the name so recursive references see it
+	c.rules[name] = ""
+	expr, err := c.visit(def, name)
+	if err != nil {
+		return "", err
+	}
+	if expr != name {
+		c.rules[name] = expr
+	}
+	return name, nil
+}
+
+// add defines a rule named after name and returns its name
+func (c *converter) add(name, expr string) string {
+	name = ruleName(name)
+	if existing, ok := c.rules[name]; ok && existing != "" && existing != expr {
+		for i := 2; ; i++ {
+			candidate := fmt.Sprintf("%s%d", name, i)
+			if _, taken := c.rules[candidate]; !taken {
+				name = candidate
+				break
+			}
+		}
+	}
+	c.rules[name] = expr
+	return name
+}
+
+// primitive adds a shared rule, and the rules it uses, and returns its name
+func (c *converter) primitive(name string) string {
+	if _, ok := c.rules[name]; ok {
+		return name
+	}
+	c.rules[name] = primitives[name]
+	for _, dep := range dependencies[name] {
+		c.primitive(dep)
+	}
+	return name
+}
+
+// format writes the rules, root first and the rest by name
+func (c *converter) format() string {
+	names := make([]string, 0, len(c.rules))
+	for name := range c.rules {
+		if name != "root" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "root ::= %s\n", c.rules["root"])
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s ::= %s\n", name, c.rules[name])
+	}
+	return b.String()
+}
+
+// ruleName makes a string usable as a rule name
+func ruleName(name string) string {
+	name = strings.Trim(invalidRuleChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "rule"
+	}
+	return name
+}
+
+// literal returns a grammar literal matching a JSON value written compactly
+func literal(value json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		compact.Write(value)
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(compact.String()) + `"`
+}
+
+// repeat returns the GBNF repetition of a string's minimum and maximum length
+func repeat(minLength, maxLength *int) string {
+	lo := 0
+	if minLength != nil {
+		lo = *minLength
+	}
+	if maxLength == nil {
+		return fmt.Sprintf("{%d,}", lo)
+	}
+	return fmt.Sprintf("{%d,%d}", lo, *maxLength)
+}
+
+// orderedKeys returns the keys of a JSON object in the order they appear
+func orderedKeys(data json.RawMessage) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('{') {
+		return nil, fmt.Errorf("expected an object")
+	}
+	var keys []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, token.(string))
+		var skip json.RawMessage
+		if err := decoder.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,147 @@
+package grammar
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	space   = `space ::= | " " | "\n" [ \t]{0,20}`
+	char    = `char ::= [^"\\\x7F\x00-\x1F] | [\\] (["\\bfnrt] | "u" [0-9a-fA-F]{4})`
+	str     = `string ::= "\"" char* "\"" space`
+	integer = `integer ::= ("-"? integral-part) space`
+	intpart = `integral-part ::= [0] | [1-9] [0-9]{0,15}`
+)
+
+func TestFromJSONSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   []string // the grammar's lines
+	}{
+		{
+			name:   "boolean",
+			schema: `{"type": "boolean"}`,
+			want:   []string{`root ::= boolean`, `boolean ::= ("true" | "false") space`, space},
+		},
+		{
+			name:   "enum",
+			schema: `{"enum": ["a", "b"]}`,
+			want:   []string{`root ::= ("\"a\"" | "\"b\"") space`, space},
+		},
+		{
+			name:   "const written compactly",
+			schema: `{"const": {"x": 1}}`,
+			want:   []string{`root ::= "{\"x\":1}" space`, space},
+		},
+		{
+			name:   "string length",
+			schema: `{"type": "string", "maxLength": 3}`,
+			want:   []string{`root ::= "\"" char{0,3} "\"" space`, char, space},
+		},
+		{
+			name:   "array bounds",
+			schema: `{"type": "array", "items": {"type": "integer"}, "minItems": 1, "maxItems": 3}`,
+			want:   []string{`root ::= "[" space integer ("," space integer){0,2} "]" space`, integer, intpart, space},
+		},
+		{
+			name:   "array minimum only",
+			schema: `{"type": "array", "items": {"type": "integer"}, "minItems": 3}`,
+			want:   []string{`root ::= "[" space integer ("," space integer){2,} "]" space`, integer, intpart, space},
+		},
+		{
+			name:   "empty array",
+			schema: `{"type": "array", "maxItems": 0}`,
+			want:   []string{`root ::= "[" space "]" space`, space},
+		},
+		{
+			name:   "required properties first",
+			schema: `{"type": "object", "properties": {"b": {"type": "string"}, "a": {"type": "integer"}}, "required": ["a"]}`,
+			want: []string{
+				`root ::= "{" space root-a-kv ("," space root-b-kv)? "}" space`,
+				char, integer, intpart,
+				`root-a-kv ::= "\"a\"" space ":" space integer`,
+				`root-b-kv ::= "\"b\"" space ":" space string`,
+				space, str,
+			},
+		},
+		{
+			name:   "optional properties in order",
+			schema: `{"properties": {"x": {"type": "null"}, "y": {"type": "boolean"}}}`,
+			want: []string{
+				`root ::= "{" space (root-x-kv ("," space root-y-kv)? | root-y-kv)? "}" space`,
+				`boolean ::= ("true" | "false") space`,
+				`null ::= "null" space`,
+				`root-x-kv ::= "\"x\"" space ":" space null`,
+				`root-y-kv ::= "\"y\"" space ":" space boolean`,
+				space,
+			},
+		},
+		{
+			name:   "several types",
+			schema: `{"type": ["string", "null"]}`,
+			want:   []string{`root ::= string | null`, char, `null ::= "null" space`, space, str},
+		},
+		{
+			name:   "anyOf",
+			schema: `{"anyOf": [{"type": "integer"}, {"type": "string"}]}`,
+			want:   []string{`root ::= integer | string`, char, integer, intpart, space, str},
+		},
+		{
+			name:   "recursive ref",
+			schema: `{"$defs": {"node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/node"}}}}, "$ref": "#/$defs/node"}`,
+			want: []string{
+				`root ::= ref-node`,
+				`ref-node ::= "{" space (ref-node-next-kv)? "}" space`,
+				`ref-node-next-kv ::= "\"next\"" space ":" space ref-node`,
+				space,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("FromJSONSchema(%s): %v", tt.schema, err)
+			}
+			if want := strings.Join(tt.want, "\n") + "\n"; got != want {
+				t.Errorf("FromJSONSchema(%s) =\n%s\nwant\n%s", tt.schema, got, want)
+			}
+		})
+	}
+}
+
+func TestFromJSONSchemaErrors(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		{`nope`, "parsing JSON schema"},
+		{`{"allOf": [{"type": "string"}]}`, "allOf is not supported"},
+		{`{"type": "string", "pattern": "^a"}`, "pattern is not supported"},
+		{`{"$ref": "https://example.com/schema"}`, `unsupported $ref "https://example.com/schema"`},
+		{`{"properties": {}, "required": ["z"]}`, `required property "z" is not defined`},
+		{`{"type": "date"}`, `unsupported type "date"`},
+		{`{"type": 1}`, "invalid type"},
+	}
+	for _, tt := range tests {
+		_, err := FromJSONSchema([]byte(tt.schema))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("FromJSONSchema(%s) error = %v, want one containing %q", tt.schema, err, tt.want)
+		}
+	}
+}
+
+func TestRuleName(t *testing.T) {
+	tests := map[string]string{
+		"root-first_name": "root-first-name",
+		"ref-a.b":         "ref-a-b",
+		"--":              "rule",
+		"naïve":           "na-ve",
+	}
+	for name, want := range tests {
+		if got := ruleName(name); got != want {
+			t.Errorf("ruleName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package index
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overlapLines is the most lines a chunk repeats from the end of the one
+// before it, so text split between chunks is found in either
+const overlapLines = 2
+
+// maxFileSize is the largest file indexed; bigger files are rarely prose
+const maxFileSize = 10 * 1024 * 1024
+
+// piece is a chunk of a file before it is embedded
+type piece struct {
+	startLine int
+	endLine   int
+	text      string
+}
+
+// chunkText splits text into pieces of about size characters along line
+// boundaries, preferring to end a piece at a blank line once it is half
+// full. Lines longer than size are split on their own.
+func chunkText(text string, size int) []piece {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var pieces []piece
+	start, length := 0, 0
+	flush := func(end int) {
+		// Line numbers cover the text, not the blank lines around it
+		first, last := start, end
+		for first < last && strings.TrimSpace(lines[first]) == "" {
+			first++
+		}
+		for last > first && strings.TrimSpace(lines[last-1]) == "" {
+			last--
+		}
+		if first < last {
+			body := strings.TrimSpace(strings.Join(lines[first:last], "\n"))
+			pieces = append(pieces, piece{startLine: first + 1, endLine: last, text: body})
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if len(line) > size {
+			if i > start {
+				flush(i)
+			}
+			for offset := 0; offset < len(line); offset += size {
+				body := strings.TrimSpace(line[offset:min(offset+size, len(line))])
+				if body != "" {
+					pieces = append(pieces, piece{startLine: i + 1, endLine: i + 1, text: body})
+				}
+			}
+			start, length = i+1, 0
+			continue
+		}
+
+		if length > 0 && (length+len(line) > size || (strings.TrimSpace(line) == "" && length >= size/2)) {
+			flush(i)
+			// Back up for the overlap while it stays a small part of the
+			// chunk, but always move forward
+			next := i
+			length = 0
+			for next > start+1 && next > i-overlapLines && length+len(lines[next-1])+1 <= size/4 {
+				next--
+				length += len(lines[next]) + 1
+			}
+			start = next
+		}
+		length += len(line) + 1
+	}
+	if start < len(lines) {
+		flush(len(lines))
+	}
+	return pieces
+}
+
+// expandPaths lists the files to index: files as given, and the files
+// under directories, skipping hidden files and directories
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != path && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// isText reports whether data looks like text rather than a binary file
+func isText(data []byte) bool {
+	return !bytes.Contains(data[:min(len(data), 8000)], []byte{0})
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+		want []piece
+	}{
+		{
+			name: "fits in one piece",
+			text: "one\ntwo\nthree\n",
+			size: 100,
+			want: []piece{{1, 3, "one\ntwo\nthree"}},
+		},
+		{
+			name: "blank lines around the text",
+			text: "\n\n  \nfirst\nsecond\n\n\n",
+			size: 100,
+			want: []piece{{4, 5, "first\nsecond"}},
+		},
+		{
+			name: "only blank lines",
+			text: "\n \n\t\n",
+			size: 100,
+			want: nil,
+		},
+		{
+			name: "ends at a blank line once half full",
+			text: "aaaaaaaaaa\nbbbbbbbbbb\n\ncccccccccc\n",
+			size: 40,
+			want: []piece{{1, 2, "aaaaaaaaaa\nbbbbbbbbbb"}, {4, 4, "cccccccccc"}},
+		},
+		{
+			name: "repeats a short last line",
+			text: "111111111\n222222222\n333333333\n444444444\n555555555",
+			size: 40,
+			want: []piece{{1, 4, "111111111\n222222222\n333333333\n444444444"}, {4, 5, "444444444\n555555555"}},
+		},
+		{
+			name: "windows line endings",
+			text: "one\r\ntwo\r\n",
+			size: 100,
+			want: []piece{{1, 2, "one\ntwo"}},
+		},
+		{
+			name: "long line split on its own",
+			text: "short\n" + strings.Repeat("x", 25) + "\nafter",
+			size: 10,
+			want: []piece{
+				{1, 1, "short"},
+				{2, 2, "xxxxxxxxxx"},
+				{2, 2, "xxxxxxxxxx"},
+				{2, 2, "xxxxx"},
+				{3, 3, "after"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkText(tt.text, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkText(%q, %d) =\n%+v\nwant\n%+v", tt.text, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestChunkTextCoversEveryLine checks that the pieces of a long text stay
+// near the size, overlap a little and leave out no line
+func TestChunkTextCoversEveryLine(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, strings.Repeat(string(rune('a'+i%26)), 5+i%30))
+		if i%7 == 6 {
+			lines = append(lines, "")
+		}
+	}
+	const size = 300
+	pieces := chunkText(strings.Join(lines, "\n"), size)
+	if len(pieces) < 2 {
+		t.Fatalf("chunkText returned %d pieces, want several", len(pieces))
+	}
+
+	covered := make([]bool, len(lines)+1)
+	for i, p := range pieces {
+		if len(p.text) > size {
+			t.Errorf("piece %d is %d characters, more than %d", i, len(p.text), size)
+		}
+		if i > 0 && p.startLine <= pieces[i-1].startLine {
+			t.Errorf("piece %d starts at line %d, not after piece %d at line %d", i, p.startLine, i-1, pieces[i-1].startLine)
+		}
+		if want := strings.Join(lines[p.startLine-1:p.endLine], "\n"); p.text != want {
+			t.Errorf("piece %d (lines %d-%d) = %q, want %q", i, p.startLine, p.endLine, p.text, want)
+		}
+		for line := p.startLine; line <= p.endLine; line++ {
+			covered[line] = true
+		}
+	}
+	for i, line := range lines {
+		if line != "" && !covered[i+1] {
+			t.Errorf("line %d is in no piece", i+1)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Package index keeps collections of embedded document chunks in the
+// database and finds the chunks closest to a question, a local building
+// block for retrieval-augmented generation.
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/rag"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// AddOptions controls adding files to a collection
+type AddOptions struct {
+	Model     string // embedding model; required for a new collection
+	ChunkSize int    // characters per chunk
+	BatchSize int    // chunks embedded per request
+}
+
+// Add chunks and embeds files, and the files under directories, into a
+// collection, creating it on first use. Files indexed before are embedded
+// again only if they changed, and chunks whose text any index has embedded
+// with the same model before are taken from the embedding cache.
+func Add(store *db.Store, cfg *config.Config, collection string, paths []string, opts AddOptions) error {
+	if opts.ChunkSize < 1 {
+		opts.ChunkSize = 1000
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 32
+	}
+
+	existing, err := store.GetIndexCollection(collection)
+	if err == nil {
+		if opts.Model != "" && opts.Model != existing.ModelSlug {
+			return fmt.Errorf("collection %s is embedded with %s; remove it with 'index rm %s' to use %s", collection, existing.ModelSlug, collection, opts.Model)
+		}
+		opts.Model = existing.ModelSlug
+	} else if opts.Model == "" {
+		return fmt.Errorf("collection %s doesn't exist yet; give the embedding model with --model", collection)
+	}
+	model, err := store.GetModelBySlug(opts.Model)
+	if err != nil {
+		return err
+	}
+
+	files, err := expandPaths(paths)
+	if err != nil {
+		return err
+	}
+
+	e := &embedder{store: store, cfg: cfg, slug: opts.Model, key: server.EmbeddingModelKey(model), batchSize: opts.BatchSize}
+	added, unchanged, chunkCount := 0, 0, 0
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxFileSize {
+			ui.PrintWarn(fmt.Sprintf("Skipping %s: larger than %d MB.", file, maxFileSize/(1024*1024)))
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		if !isText(data) {
+			ui.PrintWarn(fmt.Sprintf("Skipping %s: not a text file.", file))
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		if previous, err := store.IndexedFileHash(collection, path); err != nil {
+			return err
+		} else if previous == hash {
+			unchanged++
+			continue
+		}
+
+		pieces := chunkText(string(data), opts.ChunkSize)
+		texts := make([]string, len(pieces))
+		for i, p := range pieces {
+			texts[i] = p.text
+		}
+		vectors, err := e.embed(texts)
+		if err != nil {
+			return fmt.Errorf("embedding %s: %w", file, err)
+		}
+
+		if existing == nil && len(vectors) > 0 {
+			if err := store.CreateIndexCollection(collection, opts.Model, len(vectors[0])); err != nil {
+				return err
+			}
+			if existing, err = store.GetIndexCollection(collection); err != nil {
+				return err
+			}
+		}
+		chunks := make([]db.IndexChunk, len(pieces))
+		for i, p := range pieces {
+			if len(vectors[i]) != existing.Dimension {
+				return fmt.Errorf("%s returned %d dimensions, but collection %s has %d", opts.Model, len(vectors[i]), collection, existing.Dimension)
+			}
+			chunks[i] = db.IndexChunk{Path: path, StartLine: p.startLine, EndLine: p.endLine, Text: p.text, Vector: vectors[i]}
+		}
+		if existing == nil {
+			// An empty file in a collection that doesn't exist yet
+			continue
+		}
+		if err := store.ReplaceIndexedFile(collection, path, hash, chunks); err != nil {
+			return err
+		}
+		ui.PrintInfo(fmt.Sprintf("Indexed %s (%d chunks).", file, len(chunks)))
+		added++
+		chunkCount += len(chunks)
+	}
+
+	summary := fmt.Sprintf("Added %d files (%d chunks) to %s.", added, chunkCount, collection)
+	if unchanged > 0 {
+		summary += fmt.Sprintf(" %d unchanged files were skipped.", unchanged)
+	}
+	if e.reused > 0 {
+		summary += fmt.Sprintf(" %d chunks were reused from the embedding cache.", e.reused)
+	}
+	ui.PrintInfo(summary)
+	return nil
+}
+
+// embedder embeds chunks with a collection's model, embedding only text
+// that isn't in the embedding cache. The model's server is started for the
+// first chunk that needs it, so re-indexing cached content needs no server.
+type embedder struct {
+	store     *db.Store
+	cfg       *config.Config
+	slug      string
+	key       string // embedding cache key of the model
+	batchSize int
+	modelCfg  *config.Config // set once the server is running
+	reused    int            // chunks that weren't embedded again
+}
+
+// embed returns the embeddings of texts, from the cache where possible,
+// and caches the new ones
+func (e *embedder) embed(texts []string) ([][]float64, error) {
+	vectors, err := e.store.GetCachedEmbeddings(e.key, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each distinct text that isn't cached is embedded once
+	var missing []string
+	positions := map[string]int{}
+	for i, vector := range vectors {
+		if vector != nil {
+			continue
+		}
+		if _, ok := positions[texts[i]]; !ok {
+			positions[texts[i]] = len(missing)
+			missing = append(missing, texts[i])
+		}
+	}
+	e.reused += len(texts) - len(missing)
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	if e.modelCfg == nil {
+		if err := server.EnsureServerRunning(e.store, e.cfg, e.slug); err != nil {
+			return nil, err
+		}
+		if e.modelCfg, err = server.ModelConfig(e.store, e.cfg, e.slug); err != nil {
+			return nil, err
+		}
+	}
+	embedded, err := server.EmbedBatches(e.modelCfg, missing, e.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			vectors[i] = embedded[positions[texts[i]]]
+		}
+	}
+	if e.cfg.Persist.Cache {
+		if err := e.store.CacheEmbeddings(e.key, missing, embedded); err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// Retriever searches collections for the chunks closest to questions. It
+// starts the collections' embedding servers once, so it suits asking many
+// questions, as in a chat.
+type Retriever struct {
+	collections []*db.IndexCollection
+	chunks      [][]db.IndexChunk
+	modelCfgs   map[string]*config.Config // embedding server config by model slug
+}
+
+// NewRetriever loads collections and starts their embedding models' servers
+func NewRetriever(store *db.Store, cfg *config.Config, collections []string) (*Retriever, error) {
+	r := &Retriever{modelCfgs: make(map[string]*config.Config)}
+	for _, name := range collections {
+		collection, err := store.GetIndexCollection(name)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := store.IndexChunks(name)
+		if err != nil {
+			return nil, err
+		}
+		r.collections = append(r.collections, collection)
+		r.chunks = append(r.chunks, chunks)
+
+		if _, ok := r.modelCfgs[collection.ModelSlug]; ok {
+			continue
+		}
+		if err := server.EnsureServerRunning(store, cfg, collection.ModelSlug); err != nil {
+			return nil, err
+		}
+		modelCfg, err := server.ModelConfig(store, cfg, collection.ModelSlug)
+		if err != nil {
+			return nil, err
+		}
+		r.modelCfgs[collection.ModelSlug] = modelCfg
+	}
+	return r, nil
+}
+
+// Search returns the top chunks closest to question. The question is
+// embedded once per embedding model, and results from several collections
+// are merged into one ranking.
+func (r *Retriever) Search(question string, top int) ([]rag.Chunk, error) {
+	queryVectors := make(map[string][]float64)
+	var results []rag.IndexResults
+	for i, collection := range r.collections {
+		queryVector, ok := queryVectors[collection.ModelSlug]
+		if !ok {
+			vectors, err := server.EmbedBatches(r.modelCfgs[collection.ModelSlug], []string{question}, 1)
+			if err != nil {
+				return nil, fmt.Errorf("embedding question: %w", err)
+			}
+			queryVector = vectors[0]
+			queryVectors[collection.ModelSlug] = queryVector
+		}
+		if len(queryVector) != collection.Dimension {
+			return nil, fmt.Errorf("%s now returns %d dimensions, but collection %s has %d; rebuild it", collection.ModelSlug, len(queryVector), collection.Name, collection.Dimension)
+		}
+
+		chunks := make([]rag.Chunk, len(r.chunks[i]))
+		for j, c := range r.chunks[i] {
+			chunks[j] = rag.Chunk{
+				Path:      c.Path,
+				StartLine: c.StartLine,
+				EndLine:   c.EndLine,
+				Text:      c.Text,
+				Score:     server.CosineSimilarity(queryVector, c.Vector),
+			}
+		}
+		sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+		if top > 0 && len(chunks) > top {
+			chunks = chunks[:top]
+		}
+		results = append(results, rag.IndexResults{Index: collection.Name, EmbedModel: collection.ModelSlug, Chunks: chunks})
+	}
+
+	if len(results) == 1 {
+		return results[0].Chunks, nil
+	}
+	return rag.Merge(results, top), nil
+}
+
+// QueryOptions controls how Query answers
+type QueryOptions struct {
+	Top  int // chunks retrieved
+	JSON bool
+	// Model, when set, answers the question from the chunks, citing them,
+	// instead of showing the chunks themselves
+	Model            string
+	RequireCitations bool // ask the model again when its answer cites nothing
+}
+
+// Query prints the top chunks closest to question, or writes them as JSON.
+// With opts.Model the model's answer from them is shown instead, with the
+// sources it cites.
+func Query(store *db.Store, cfg *config.Config, collections []string, question string, opts QueryOptions) error {
+	retriever, err := NewRetriever(store, cfg, collections)
+	if err != nil {
+		return err
+	}
+	chunks, err := retriever.Search(question, opts.Top)
+	if err != nil {
+		return err
+	}
+	if opts.Model != "" {
+		return answer(store, cfg, question, chunks, opts)
+	}
+
+	if opts.JSON {
+		data, err := json.MarshalIndent(chunks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding results: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(chunks) == 0 {
+		fmt.Println("No chunks indexed.")
+		return nil
+	}
+	for i, chunk := range chunks {
+		location := chunk.Location()
+		if chunk.Index != "" {
+			location = chunk.Index + ": " + location
+		}
+		fmt.Printf("\n[%d] %.4f  %s\n", i+1, chunk.Score, location)
+		for _, line := range strings.Split(preview(chunk.Text, 6), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	return nil
+}
+
+// answer prints opts.Model's answer to question from chunks and the
+// sources it cites, or writes them as JSON
+func answer(store *db.Store, cfg *config.Config, question string, chunks []rag.Chunk, opts QueryOptions) error {
+	if len(chunks) == 0 {
+		return fmt.Errorf("no chunks indexed to answer from")
+	}
+	if err := server.EnsureServerRunning(store, cfg, opts.Model); err != nil {
+		return err
+	}
+	modelCfg, err := server.ModelConfig(store, cfg, opts.Model)
+	if err != nil {
+		return err
+	}
+	complete := func(prompt string) (string, error) {
+		return server.CompleteRunning(modelCfg, prompt)
+	}
+	reply, err := rag.Ask(complete, question, chunks, opts.RequireCitations)
+	if reply == nil {
+		return err
+	}
+
+	if opts.JSON {
+		cited := make([]rag.Chunk, 0, len(reply.Cited))
+		for _, n := range reply.Cited {
+			cited = append(cited, chunks[n-1])
+		}
+		data, jsonErr := json.MarshalIndent(map[string]interface{}{
+			"answer":  reply.Text,
+			"sources": cited,
+		}, "", "  ")
+		if jsonErr != nil {
+			return fmt.Errorf("encoding answer: %w", jsonErr)
+		}
+		fmt.Println(string(data))
+		return err
+	}
+
+	fmt.Println(reply.Text)
+	if sources := rag.Footer(chunks, reply.Cited); sources != "" {
+		fmt.Printf("\n%s", sources)
+	}
+	return err
+}
+
+// preview returns the first lines of text, noting how many were left out
+func preview(text string, lines int) string {
+	all := strings.Split(text, "\n")
+	if len(all) <= lines {
+		return text
+	}
+	return strings.Join(all[:lines], "\n") + fmt.Sprintf("\n… (%d more lines)", len(all)-lines)
+}
+
+// List prints every collection with its model and size
+func List(store *db.Store) error {
+	collections, err := store.ListIndexCollections()
+	if err != nil {
+		return err
+	}
+	if len(collections) == 0 {
+		fmt.Println("No index collections. Create one with 'llm-cli index add <collection> <files...> --model <slug>'.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tMODEL\tDIM\tFILES\tCHUNKS\tCREATED")
+	for _, c := range collections {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", c.Name, c.ModelSlug, c.Dimension, c.Files, c.Chunks, c.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// Remove deletes a collection
+func Remove(store *db.Store, collection string) error {
+	if err := store.DeleteIndexCollection(collection); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Removed index collection %s.", collection))
+	return nil
+}
@@ -0,0 +1,249 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// InspectOptions controls what Inspect shows of a file's chunks
+type InspectOptions struct {
+	File  string // indexed file whose chunks are shown
+	Query string // question to score the chunks against, if any
+	Top   int    // how many of the collection's closest chunks count as matches
+	JSON  bool
+}
+
+// inspectedChunk is a chunk of the inspected file as Inspect reports it
+type inspectedChunk struct {
+	Number    int     `json:"chunk"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Tokens    int     `json:"tokens"`
+	Chars     int     `json:"chars"`
+	Overlap   int     `json:"overlap_lines"` // lines repeated from the chunk before
+	Score     float64 `json:"score,omitempty"`
+	Rank      int     `json:"rank,omitempty"` // place among all the collection's chunks
+	Matched   bool    `json:"matched,omitempty"`
+	Text      string  `json:"text"`
+}
+
+// Inspect shows how a file of a collection was chunked: each chunk's lines,
+// size in tokens of the embedding model and overlap with the chunk before.
+// With a query it also scores the chunks against it and marks those among
+// the collection's top matches, to find out why a question misses the text
+// that answers it.
+func Inspect(store *db.Store, cfg *config.Config, collection string, opts InspectOptions) error {
+	if opts.Top < 1 {
+		opts.Top = 5
+	}
+	c, err := store.GetIndexCollection(collection)
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(opts.File)
+	if err != nil {
+		return err
+	}
+	all, err := store.IndexChunks(collection)
+	if err != nil {
+		return err
+	}
+	var chunks []inspectedChunk
+	var positions []int // of the file's chunks in all
+	for i, chunk := range all {
+		if chunk.Path != path {
+			continue
+		}
+		chunks = append(chunks, inspectedChunk{
+			Number:    len(chunks) + 1,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Chars:     len(chunk.Text),
+			Text:      chunk.Text,
+		})
+		positions = append(positions, i)
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("%s is not in collection %s; add it with 'llm-cli index add %s %s'", opts.File, collection, collection, opts.File)
+	}
+	if changed, err := fileChanged(store, collection, path); err != nil {
+		return err
+	} else if changed {
+		ui.PrintWarn(fmt.Sprintf("%s changed since it was indexed; these are the chunks of the indexed version. Run 'llm-cli index add %s %s' to update them.", opts.File, collection, opts.File))
+	}
+
+	if err := server.EnsureServerRunning(store, cfg, c.ModelSlug); err != nil {
+		return err
+	}
+	modelCfg, err := server.ModelConfig(store, cfg, c.ModelSlug)
+	if err != nil {
+		return err
+	}
+	for i := range chunks {
+		tokens, err := server.TokenizeContext(context.Background(), modelCfg, chunks[i].Text)
+		if err != nil {
+			return fmt.Errorf("counting tokens: %w", err)
+		}
+		chunks[i].Tokens = len(tokens)
+		if i > 0 && chunks[i-1].EndLine >= chunks[i].StartLine {
+			chunks[i].Overlap = chunks[i-1].EndLine - chunks[i].StartLine + 1
+		}
+	}
+
+	var others map[string]int
+	if opts.Query != "" {
+		if others, err = scoreChunks(modelCfg, c, all, chunks, positions, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.JSON {
+		data, err := json.MarshalIndent(chunks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding chunks: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printInspection(opts, c, chunks, others)
+	return nil
+}
+
+// scoreChunks scores every chunk of the collection against the query,
+// filling in the score and rank of the inspected file's chunks and marking
+// those in the top matches. It returns how many of the top matches each
+// other file has.
+func scoreChunks(modelCfg *config.Config, c *db.IndexCollection, all []db.IndexChunk, chunks []inspectedChunk, positions []int, opts InspectOptions) (map[string]int, error) {
+	vectors, err := server.EmbedBatches(modelCfg, []string{opts.Query}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("embedding question: %w", err)
+	}
+	if len(vectors[0]) != c.Dimension {
+		return nil, fmt.Errorf("%s now returns %d dimensions, but collection %s has %d; rebuild it", c.ModelSlug, len(vectors[0]), c.Name, c.Dimension)
+	}
+
+	scores := make([]float64, len(all))
+	order := make([]int, len(all))
+	for i, chunk := range all {
+		scores[i] = server.CosineSimilarity(vectors[0], chunk.Vector)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	ranks := make([]int, len(all))
+	for rank, i := range order {
+		ranks[i] = rank + 1
+	}
+
+	for i, position := range positions {
+		chunks[i].Score = scores[position]
+		chunks[i].Rank = ranks[position]
+		chunks[i].Matched = ranks[position] <= opts.Top
+	}
+	others := make(map[string]int)
+	for _, i := range order[:min(opts.Top, len(order))] {
+		if all[i].Path != all[positions[0]].Path {
+			others[all[i].Path]++
+		}
+	}
+	return others, nil
+}
+
+// printInspection prints the chunks as a table, then each chunk's first
+// and last lines so the boundaries can be seen
+func printInspection(opts InspectOptions, c *db.IndexCollection, chunks []inspectedChunk, others map[string]int) {
+	fmt.Printf("%s in %s: %d chunks embedded with %s\n\n", opts.File, c.Name, len(chunks), c.ModelSlug)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "CHUNK\tLINES\tTOKENS\tCHARS\tOVERLAP"
+	if opts.Query != "" {
+		header += "\tSCORE\tRANK\tMATCH"
+	}
+	fmt.Fprintln(w, header)
+	for _, chunk := range chunks {
+		overlap := "-"
+		switch {
+		case chunk.Overlap == 1:
+			overlap = "1 line"
+		case chunk.Overlap > 1:
+			overlap = fmt.Sprintf("%d lines", chunk.Overlap)
+		}
+		row := fmt.Sprintf("%d\t%d-%d\t%d\t%d\t%s", chunk.Number, chunk.StartLine, chunk.EndLine, chunk.Tokens, chunk.Chars, overlap)
+		if opts.Query != "" {
+			match := ""
+			if chunk.Matched {
+				match = "yes"
+			}
+			row += fmt.Sprintf("\t%.4f\t%d\t%s", chunk.Score, chunk.Rank, match)
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+
+	for _, chunk := range chunks {
+		fmt.Printf("\n[%d] lines %d-%d\n", chunk.Number, chunk.StartLine, chunk.EndLine)
+		for _, line := range strings.Split(boundaries(chunk.Text, 2), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+
+	if opts.Query == "" {
+		return
+	}
+	matched := 0
+	for _, chunk := range chunks {
+		if chunk.Matched {
+			matched++
+		}
+	}
+	fmt.Printf("\n%d of the top %d chunks for the query come from this file.", matched, opts.Top)
+	if len(others) > 0 {
+		files := make([]string, 0, len(others))
+		for file := range others {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for i, file := range files {
+			files[i] = fmt.Sprintf("%s (%d)", file, others[file])
+		}
+		fmt.Printf(" The others: %s.", strings.Join(files, ", "))
+	}
+	fmt.Println()
+}
+
+// boundaries returns the first and last lines of text, with how many lines
+// between them were left out
+func boundaries(text string, lines int) string {
+	all := strings.Split(text, "\n")
+	if len(all) <= 2*lines+1 {
+		return text
+	}
+	omitted := fmt.Sprintf("… (%d more lines)", len(all)-2*lines)
+	return strings.Join(append(append(all[:lines:lines], omitted), all[len(all)-lines:]...), "\n")
+}
+
+// fileChanged reports whether an indexed file differs from the version
+// indexed, or is gone
+func fileChanged(store *db.Store, collection, path string) (bool, error) {
+	indexed, err := store.IndexedFileHash(collection, path)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return true, nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) != indexed, nil
+}
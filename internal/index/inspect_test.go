@@ -0,0 +1,21 @@
+package index
+
+import "testing"
+
+func TestBoundaries(t *testing.T) {
+	tests := []struct {
+		text  string
+		lines int
+		want  string
+	}{
+		{"a\nb\nc", 1, "a\nb\nc"},
+		{"a\nb\nc\nd\ne", 2, "a\nb\nc\nd\ne"},
+		{"a\nb\nc\nd\ne\nf", 2, "a\nb\n… (2 more lines)\ne\nf"},
+		{"a\nb\nc\nd", 1, "a\n… (2 more lines)\nd"},
+	}
+	for _, tt := range tests {
+		if got := boundaries(tt.text, tt.lines); got != tt.want {
+			t.Errorf("boundaries(%q, %d) = %q, want %q", tt.text, tt.lines, got, tt.want)
+		}
+	}
+}
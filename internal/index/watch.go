@@ -0,0 +1,112 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+	"github.com/garyblankenship/llmcli/internal/watch"
+)
+
+// Watch keeps a collection up to date with the files under paths, or under
+// the directories of its indexed files when none are given. Every interval
+// until ctx is done, changed and new files are embedded and removed files
+// are dropped from it.
+func Watch(ctx context.Context, store *db.Store, cfg *config.Config, collection string, paths []string, interval time.Duration) error {
+	if _, err := store.GetIndexCollection(collection); err != nil {
+		return err
+	}
+	roots, err := watchRoots(store, collection, paths)
+	if err != nil {
+		return err
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("collection %s has no files; give the files or directories to watch", collection)
+	}
+
+	w := watch.New(roots, nil)
+	if _, err := w.Scan(); err != nil {
+		return err
+	}
+	// Catch up on what changed while nothing was watching
+	if err := Add(store, cfg, collection, roots, AddOptions{}); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Watching %d paths for changes to %s. Press Ctrl-C to stop.", len(roots), collection))
+
+	return w.Run(interval, ctx.Done(), func(changes []watch.Change) error {
+		var changed []string
+		for _, change := range changes {
+			if !change.Removed {
+				changed = append(changed, change.Path)
+				continue
+			}
+			if hash, err := store.IndexedFileHash(collection, change.Path); err != nil {
+				return err
+			} else if hash == "" {
+				continue
+			}
+			if err := store.RemoveIndexedFile(collection, change.Path); err != nil {
+				return err
+			}
+			ui.PrintInfo(fmt.Sprintf("Removed %s from %s.", change.Path, collection))
+		}
+		if len(changed) > 0 {
+			// A file can go away or be half written; the next change retries it
+			if err := Add(store, cfg, collection, changed, AddOptions{}); err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to update %s: %v", collection, err))
+			}
+		}
+		return nil
+	})
+}
+
+// watchRoots returns paths made absolute, so changes match the indexed
+// paths, or the directories of the collection's indexed files that still
+// exist. Paths under another of them are left out.
+func watchRoots(store *db.Store, collection string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		files, err := store.IndexedFiles(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if dir := filepath.Dir(file); dirExists(dir) {
+				paths = append(paths, dir)
+			}
+		}
+	}
+
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		var err error
+		if abs[i], err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(abs)
+
+	var roots []string
+	for _, path := range abs {
+		if !slices.ContainsFunc(roots, func(root string) bool {
+			return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+		}) {
+			roots = append(roots, path)
+		}
+	}
+	return roots, nil
+}
+
+// dirExists reports whether path is an existing directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
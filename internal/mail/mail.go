@@ -0,0 +1,285 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/server"
+)
+
+// Message is the readable content extracted from an RFC822 message
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Date    string
+	Body    string
+}
+
+// maxBodyChars keeps very long messages from overflowing the model's context
+const maxBodyChars = 12000
+
+// Summarize reads a message from r and prints a summary produced by the model
+func Summarize(store *db.Store, cfg *config.Config, slug string, r io.Reader) error {
+	msg, err := Parse(r)
+	if err != nil {
+		return err
+	}
+
+	prompt := "Summarize the following email in a few bullet points. " +
+		"Mention any questions asked, requests made and deadlines.\n\n" + msg.String()
+	return completeAndPrint(store, cfg, slug, prompt)
+}
+
+// SuggestReply reads a message from r and prints a suggested reply produced by the model
+func SuggestReply(store *db.Store, cfg *config.Config, slug string, r io.Reader) error {
+	msg, err := Parse(r)
+	if err != nil {
+		return err
+	}
+
+	prompt := "Write a concise, polite reply to the following email. " +
+		"Answer any questions it asks and keep the sender's tone. " +
+		"Output only the body of the reply.\n\n" + msg.String()
+	return completeAndPrint(store, cfg, slug, prompt)
+}
+
+// completeAndPrint runs a completion and prints the trimmed result
+func completeAndPrint(store *db.Store, cfg *config.Config, slug, prompt string) error {
+	pipeline, err := post.ForCommand(cfg, "mail", "")
+	if err != nil {
+		return err
+	}
+	result, err := server.Complete(store, cfg, slug, prompt)
+	if err != nil {
+		return err
+	}
+	if result, err = pipeline.Apply(result); err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(result))
+	return nil
+}
+
+// String formats the message as plain text for a prompt
+func (m *Message) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", m.From)
+	if m.To != "" {
+		fmt.Fprintf(&b, "To: %s\n", m.To)
+	}
+	if m.Date != "" {
+		fmt.Fprintf(&b, "Date: %s\n", m.Date)
+	}
+	fmt.Fprintf(&b, "Subject: %s\n\n%s\n", m.Subject, m.Body)
+	return b.String()
+}
+
+// Parse reads an RFC822 message and extracts its headers and readable body,
+// preferring text/plain parts, stripping HTML, quoted replies and signatures
+func Parse(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("parsing message: %w", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	header := func(name string) string {
+		value := raw.Header.Get(name)
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+
+	body, err := extractText(raw.Header.Get("Content-Type"), raw.Header.Get("Content-Transfer-Encoding"), raw.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	body = stripSignature(stripQuotes(body))
+	if len(body) > maxBodyChars {
+		body = body[:maxBodyChars] + "\n[message truncated]"
+	}
+
+	return &Message{
+		From:    header("From"),
+		To:      header("To"),
+		Subject: header("Subject"),
+		Date:    header("Date"),
+		Body:    strings.TrimSpace(body),
+	}, nil
+}
+
+// extractText returns the best plain-text rendering of a MIME entity
+func extractText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Messages without a (valid) Content-Type are plain text
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return extractMultipart(mediaType, params["boundary"], body)
+	}
+
+	data, err := io.ReadAll(decodeTransfer(encoding, body))
+	if err != nil {
+		return "", fmt.Errorf("reading message body: %w", err)
+	}
+
+	switch mediaType {
+	case "text/html":
+		return htmlToText(string(data)), nil
+	case "text/plain", "":
+		return string(data), nil
+	}
+	return "", nil
+}
+
+// extractMultipart walks the parts of a multipart entity. Alternatives prefer
+// text/plain over HTML; other multipart types concatenate their text parts.
+func extractMultipart(mediaType, boundary string, body io.Reader) (string, error) {
+	if boundary == "" {
+		return "", fmt.Errorf("multipart message without boundary")
+	}
+
+	reader := multipart.NewReader(body, boundary)
+	var plain, htmlText, combined []string
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("reading message part: %w", err)
+		}
+
+		// Skip attachments
+		if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+			continue
+		}
+
+		partType := part.Header.Get("Content-Type")
+		text, err := extractText(partType, part.Header.Get("Content-Transfer-Encoding"), part)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(partType, "text/html") {
+			htmlText = append(htmlText, text)
+		} else {
+			plain = append(plain, text)
+		}
+		combined = append(combined, text)
+	}
+
+	if mediaType == "multipart/alternative" {
+		if len(plain) > 0 {
+			return plain[len(plain)-1], nil
+		}
+		return strings.Join(htmlText, "\n\n"), nil
+	}
+	return strings.Join(combined, "\n\n"), nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a body
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return body
+		}
+		cleaned := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' {
+				return -1
+			}
+			return r
+		}, string(data))
+		decoded, err := base64.StdEncoding.DecodeString(cleaned)
+		if err != nil {
+			return bytes.NewReader(data)
+		}
+		return bytes.NewReader(decoded)
+	}
+	return body
+}
+
+var (
+	scriptPattern     = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	blockPattern      = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6])[^>]*>`)
+	quoteBlockPattern = regexp.MustCompile(`(?is)<blockquote[^>]*>.*?</blockquote>`)
+	tagPattern        = regexp.MustCompile(`(?s)<[^>]+>`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText strips tags from HTML, keeping line structure
+func htmlToText(s string) string {
+	s = scriptPattern.ReplaceAllString(s, "")
+	s = quoteBlockPattern.ReplaceAllString(s, "")
+	s = blockPattern.ReplaceAllString(s, "\n")
+	s = tagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+var attributionPattern = regexp.MustCompile(`(?i)^(on .+ wrote:|.+ schrieb .+:|-+ ?original message ?-+|from: .+)$`)
+
+// stripQuotes removes quoted reply text and the attribution line introducing it
+func stripQuotes(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	var kept []string
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+
+		// Drop attribution lines directly followed by quoted text, and
+		// everything below an Outlook-style "Original Message" separator
+		if attributionPattern.MatchString(trimmed) {
+			if strings.HasPrefix(strings.ToLower(trimmed), "-") {
+				break
+			}
+			if i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), ">") {
+				continue
+			}
+		}
+
+		kept = append(kept, line)
+	}
+
+	return strings.Join(kept, "\n")
+}
+
+// stripSignature removes a conventional "-- " signature block
+func stripSignature(s string) string {
+	if i := strings.Index(s, "\n-- \n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/secrets"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// hfToken returns the Hugging Face token, warning rather than failing when
+// it can't be read since public models don't need one
+func hfToken(cfg *config.Config) string {
+	token, err := secrets.HuggingFaceToken(cfg)
+	if err != nil {
+		ui.PrintWarn(fmt.Sprintf("Could not read Hugging Face token: %v", err))
+	}
+	return token
+}
+
+// hfGet requests a Hugging Face API URL, authenticated when a token is available
+func hfGet(cfg *config.Config, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := hfToken(cfg); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// apiError describes an unsuccessful Hugging Face API response
+func apiError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("API returned status %d; the model may be gated or private (run 'llm-cli login' with a token that has access)", resp.StatusCode)
+	case http.StatusNotFound:
+		return fmt.Errorf("API returned status %d; the model does not exist, or is private (run 'llm-cli login')", resp.StatusCode)
+	}
+	return fmt.Errorf("API returned status %d", resp.StatusCode)
+}
+
+// exportHFToken passes the token on to huggingface-cli, which reads $HF_TOKEN
+func exportHFToken(cfg *config.Config) {
+	if os.Getenv("HF_TOKEN") == "" {
+		if token := hfToken(cfg); token != "" {
+			os.Setenv("HF_TOKEN", token)
+		}
+	}
+}
+
+// Login checks a Hugging Face token and stores it in the secret store.
+// The token is read from the terminal, or from stdin when piped.
+func Login(cfg *config.Config) error {
+	var token string
+	var err error
+	if ui.IsInteractive() {
+		fmt.Println("Create a token at https://huggingface.co/settings/tokens (read access is enough).")
+		token, err = ui.ReadSecret("Hugging Face token: ")
+	} else {
+		token, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if token != "" {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("reading token: %w", err)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return fmt.Errorf("token cannot be empty")
+	}
+
+	user, err := whoami(token)
+	if err != nil {
+		return err
+	}
+
+	store := secrets.New(cfg)
+	if err := store.Set(secrets.HFToken, token); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Logged in to Hugging Face as %s. Token stored in the %s.", user, store.Backend()))
+	if os.Getenv("HF_TOKEN") != "" {
+		ui.PrintWarn("$HF_TOKEN is set and takes precedence over the stored token.")
+	} else if cfg.HFToken != "" {
+		ui.PrintWarn(fmt.Sprintf("hf_token in %s takes precedence over the stored token.", cfg.ConfigPath))
+	}
+	return nil
+}
+
+// Logout removes the stored Hugging Face token
+func Logout(cfg *config.Config) error {
+	if err := secrets.New(cfg).Delete(secrets.HFToken); err != nil {
+		return err
+	}
+	ui.PrintInfo("Removed the stored Hugging Face token.")
+	return nil
+}
+
+// whoami returns the name of the account a token belongs to
+func whoami(token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://huggingface.co/api/whoami-v2", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("checking token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("Hugging Face rejected the token")
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checking token: API returned status %d", resp.StatusCode)
+	}
+
+	var account struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return "", fmt.Errorf("parsing account: %w", err)
+	}
+	return account.Name, nil
+}
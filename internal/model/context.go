@@ -0,0 +1,206 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// contextInfo is the context window a model was trained with, read from its GGUF metadata
+type contextInfo struct {
+	Trained      uint64  // <arch>.context_length
+	ScalingType  string  // <arch>.rope.scaling.type, if the model ships with scaling
+	ScalingScale float64 // <arch>.rope.scaling.factor
+}
+
+// readContextInfo reads the trained context and built-in RoPE scaling of a model file
+func readContextInfo(path string) (contextInfo, error) {
+	f, err := gguf.Open(path)
+	if err != nil {
+		return contextInfo{}, err
+	}
+
+	arch, _ := f.String("general.architecture")
+	var info contextInfo
+	info.Trained, _ = f.Uint(arch + ".context_length")
+	info.ScalingType, _ = f.String(arch + ".rope.scaling.type")
+	info.ScalingScale, _ = f.Float(arch + ".rope.scaling.factor")
+	return info, nil
+}
+
+// Context shows or updates a model's context size and RoPE scaling settings.
+// changes maps llama-server flag names (without dashes) to values; the
+// combined settings are validated against the model's trained context and
+// only stored when valid. reset clears all of them first.
+func Context(store *db.Store, cfg *config.Config, slug string, changes map[string]string, reset bool) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+
+	info, err := readContextInfo(model.FilePath)
+	if err != nil {
+		ui.PrintWarn(fmt.Sprintf("Could not read model metadata, skipping context checks: %v", err))
+	}
+
+	if reset {
+		if err := store.DeleteModelSettings(slug, server.ContextSettings...); err != nil {
+			return err
+		}
+		ui.PrintInfo(fmt.Sprintf("Context settings for %s reset to model defaults.", slug))
+	}
+
+	if len(changes) > 0 {
+		current, err := store.GetModelSettings(slug)
+		if err != nil {
+			return err
+		}
+		for key, value := range changes {
+			current[key] = value
+		}
+
+		warnings, err := validateContext(current, info)
+		if err != nil {
+			return err
+		}
+
+		// Default YaRN's original context to the trained one
+		if current["rope-scaling"] == "yarn" && current["yarn-orig-ctx"] == "" && info.Trained > 0 {
+			changes["yarn-orig-ctx"] = strconv.FormatUint(info.Trained, 10)
+		}
+
+		if err := store.SetModelSettings(slug, changes); err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			ui.PrintWarn(warning)
+		}
+		ui.PrintInfo(fmt.Sprintf("Context settings for %s saved. Restart its server (llm-cli kill %s) to apply them.", slug, slug))
+	}
+
+	return showContext(store, cfg, model, info)
+}
+
+// showContext prints the trained context and the stored settings of a
+// model, or the context size chosen automatically when none is set
+func showContext(store *db.Store, cfg *config.Config, model *db.Model, info contextInfo) error {
+	settings, err := store.GetModelSettings(model.Slug)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	trained := "unknown"
+	if info.Trained > 0 {
+		trained = strconv.FormatUint(info.Trained, 10)
+	}
+	fmt.Fprintf(w, "trained context\t%s\n", trained)
+	if info.ScalingType != "" {
+		fmt.Fprintf(w, "built-in rope scaling\t%s x%g\n", info.ScalingType, info.ScalingScale)
+	}
+	if _, ok := settings["ctx-size"]; !ok {
+		if ctx := server.AutoContext(cfg, model); ctx > 0 {
+			fmt.Fprintf(w, "ctx-size\t%d (automatic)\n", ctx)
+		}
+	}
+	for _, name := range server.ContextSettings {
+		if value, ok := settings[name]; ok {
+			fmt.Fprintf(w, "%s\t%s\n", name, value)
+		}
+	}
+	return w.Flush()
+}
+
+// validateContext checks a combination of context settings, returning
+// warnings for risky but allowed values and an error for invalid ones
+func validateContext(settings map[string]string, info contextInfo) ([]string, error) {
+	var warnings []string
+	numbers := make(map[string]float64)
+
+	for _, name := range server.ContextSettings {
+		value, ok := settings[name]
+		if !ok || name == "rope-scaling" {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %s", name, value)
+		}
+		switch name {
+		case "ctx-size", "yarn-orig-ctx":
+			if n < 1 || n != math.Trunc(n) {
+				return nil, fmt.Errorf("%s must be a positive integer", name)
+			}
+		case "yarn-ext-factor":
+			if n < 0 && n != -1 {
+				return nil, fmt.Errorf("yarn-ext-factor must be -1 (auto) or non-negative")
+			}
+		default:
+			if n <= 0 {
+				return nil, fmt.Errorf("%s must be positive", name)
+			}
+		}
+		numbers[name] = n
+	}
+
+	scaling := settings["rope-scaling"]
+	switch scaling {
+	case "", "none", "linear", "yarn":
+	default:
+		return nil, fmt.Errorf("rope-scaling must be none, linear or yarn")
+	}
+
+	if scaling != "yarn" && info.ScalingType != "yarn" {
+		for _, name := range []string{"yarn-orig-ctx", "yarn-ext-factor", "yarn-attn-factor", "yarn-beta-slow", "yarn-beta-fast"} {
+			if _, ok := numbers[name]; ok {
+				return nil, fmt.Errorf("%s requires rope-scaling yarn", name)
+			}
+		}
+	}
+	if _, ok := numbers["rope-scale"]; ok {
+		if _, ok := numbers["rope-freq-scale"]; ok {
+			return nil, fmt.Errorf("set either rope-scale or rope-freq-scale, not both")
+		}
+	}
+
+	ctx, ok := numbers["ctx-size"]
+	if !ok || info.Trained == 0 {
+		return warnings, nil
+	}
+
+	// Work out how far the configured scaling stretches the trained context
+	scale := 1.0
+	switch {
+	case numbers["rope-scale"] > 0:
+		scale = numbers["rope-scale"]
+	case numbers["rope-freq-scale"] > 0:
+		scale = 1 / numbers["rope-freq-scale"]
+	case scaling == "" && info.ScalingScale > 0:
+		scale = info.ScalingScale
+	}
+	if scaling == "none" {
+		scale = 1
+	}
+
+	trained := float64(info.Trained)
+	effective := trained * scale
+	needed := math.Ceil(ctx / trained)
+
+	if (scaling == "linear" || scaling == "yarn") && numbers["rope-scale"] == 0 && numbers["rope-freq-scale"] == 0 && ctx > trained {
+		warnings = append(warnings, fmt.Sprintf("rope-scaling %s without rope-scale uses the model default; a ctx-size of %.0f needs a scale of about %.0f", scaling, ctx, needed))
+	} else if ctx > effective {
+		warnings = append(warnings, fmt.Sprintf(
+			"ctx-size %.0f exceeds the %.0f tokens this model supports (trained %d x scale %g); output quality usually degrades past that. Consider --rope-scaling yarn --rope-scale %.0f",
+			ctx, effective, info.Trained, scale, needed))
+	}
+
+	return warnings, nil
+}
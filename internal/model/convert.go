@@ -0,0 +1,256 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+const (
+	llamaCppRepo  = "https://github.com/ggerganov/llama.cpp"
+	convertScript = "convert_hf_to_gguf.py"
+)
+
+// convertRequirements are installed when the converter has no requirements file next to it
+var convertRequirements = []string{"numpy", "sentencepiece", "transformers", "protobuf", "safetensors", "torch", "gguf"}
+
+// outTypes are quantizations convert_hf_to_gguf.py can write directly
+var outTypes = map[string]bool{"F32": true, "F16": true, "BF16": true, "Q8_0": true}
+
+// Convert downloads a Hugging Face model's safetensors weights, converts
+// them to GGUF and quantizes the result. Each stage is recorded in a staging
+// directory so an interrupted conversion resumes where it stopped.
+func Convert(store *db.Store, cfg *config.Config, modelID, quant string, keepStaging bool) error {
+	if !validateModelID(modelID) {
+		return fmt.Errorf("invalid model ID format: %s", modelID)
+	}
+
+	quant = strings.ToUpper(quant)
+	if quant == "" {
+		quant = defaultQuant
+	}
+
+	if err := checkConvertPrerequisites(cfg, quant); err != nil {
+		return err
+	}
+
+	modelDir := filepath.Join(cfg.ModelsDir, modelID)
+	fileName := fmt.Sprintf("%s-%s.gguf", filepath.Base(modelID), quant)
+	outFile := filepath.Join(modelDir, fileName)
+
+	if _, err := os.Stat(outFile); err == nil {
+		ui.PrintWarn(fmt.Sprintf("%s already exists. Remove it to convert again.", outFile))
+		return nil
+	}
+
+	staging := filepath.Join(cfg.CacheDir, "convert", generateSlug(modelID))
+	hfDir := filepath.Join(staging, "hf")
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return fmt.Errorf("creating staging directory: %w", err)
+	}
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		return fmt.Errorf("creating model directory: %w", err)
+	}
+
+	// Stage 1: download weights, config and tokenizer files
+	if !stageDone(staging, "download") {
+		ui.PrintInfo(fmt.Sprintf("Downloading %s to %s...", modelID, hfDir))
+		exportHFToken(cfg)
+		err := runStep("huggingface-cli", "download", modelID, "--local-dir", hfDir,
+			"--include", "*.safetensors", "*.json", "*.model", "*.txt", "*.tiktoken")
+		if err != nil {
+			return fmt.Errorf("downloading model (re-run to resume): %w", err)
+		}
+		if err := markStage(staging, "download"); err != nil {
+			return err
+		}
+	} else {
+		ui.PrintInfo("Download already complete, skipping.")
+	}
+
+	// Stage 2: convert to GGUF, directly in the target type when possible
+	python, script, err := ensureConverter(cfg)
+	if err != nil {
+		return err
+	}
+
+	convertType, convertOut := "f16", filepath.Join(staging, "model-f16.gguf")
+	if outTypes[quant] {
+		convertType, convertOut = strings.ToLower(quant), outFile
+	}
+
+	if _, err := os.Stat(convertOut); err != nil || !stageDone(staging, "convert-"+convertType) {
+		ui.PrintInfo(fmt.Sprintf("Converting to GGUF (%s)...", convertType))
+		if err := runStep(python, script, hfDir, "--outfile", convertOut+".partial", "--outtype", convertType); err != nil {
+			return fmt.Errorf("converting model: %w", err)
+		}
+		if err := os.Rename(convertOut+".partial", convertOut); err != nil {
+			return fmt.Errorf("finalizing converted model: %w", err)
+		}
+		if err := markStage(staging, "convert-"+convertType); err != nil {
+			return err
+		}
+	} else {
+		ui.PrintInfo("Conversion already complete, skipping.")
+	}
+
+	// Stage 3: quantize
+	if !outTypes[quant] {
+		ui.PrintInfo(fmt.Sprintf("Quantizing to %s...", quant))
+		if err := runStep(cfg.LlamaQuantize, convertOut, outFile+".partial", quant); err != nil {
+			return fmt.Errorf("quantizing model: %w", err)
+		}
+		if err := os.Rename(outFile+".partial", outFile); err != nil {
+			return fmt.Errorf("finalizing quantized model: %w", err)
+		}
+	}
+
+	fileInfo, err := os.Stat(outFile)
+	if err != nil {
+		return fmt.Errorf("getting file info: %w", err)
+	}
+	fileSize := fmt.Sprintf("%dM", fileInfo.Size()/(1024*1024))
+
+	checksum, err := hashFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	slug, err := quantSlug(store, cfg.SlugScheme, modelID, quant, outFile)
+	if err != nil {
+		return err
+	}
+	if err := store.AddModel(slug, modelID, fileName, outFile, fileSize, quant); err != nil {
+		return fmt.Errorf("adding model to database: %w", err)
+	}
+	if err := store.SetModelChecksum(slug, checksum); err != nil {
+		return err
+	}
+	recordMetadata(store, db.Model{Slug: slug, FilePath: outFile})
+
+	if keepStaging {
+		ui.PrintInfo(fmt.Sprintf("Staging files kept in %s", staging))
+	} else if err := os.RemoveAll(staging); err != nil {
+		ui.PrintWarn(fmt.Sprintf("Failed to remove staging directory %s: %v", staging, err))
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Model added to database with slug: %s", slug))
+	fmt.Printf("To use this model, run: llm-cli chat %s\n", slug)
+	return nil
+}
+
+// checkConvertPrerequisites reports every missing tool at once, with a hint for each
+func checkConvertPrerequisites(cfg *config.Config, quant string) error {
+	var missing []string
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		missing = append(missing, "python3 (install Python 3.9 or newer)")
+	}
+	if _, err := exec.LookPath("huggingface-cli"); err != nil {
+		missing = append(missing, "huggingface-cli (pip install -U \"huggingface_hub[cli]\")")
+	}
+	if !outTypes[quant] {
+		if _, err := exec.LookPath(cfg.LlamaQuantize); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (install llama.cpp or set LLAMA_QUANTIZE)", cfg.LlamaQuantize))
+		}
+	}
+	if _, err := findConvertScript(cfg); err != nil {
+		if _, err := exec.LookPath("git"); err != nil {
+			missing = append(missing, fmt.Sprintf("git (needed to fetch %s, or set LLAMA_CPP_DIR)", convertScript))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing prerequisites for convert:\n  - %s", strings.Join(missing, "\n  - "))
+	}
+	return nil
+}
+
+// findConvertScript looks for convert_hf_to_gguf.py in LLAMA_CPP_DIR, on
+// PATH and in the llama.cpp checkout managed by llm-cli
+func findConvertScript(cfg *config.Config) (string, error) {
+	if dir := os.Getenv("LLAMA_CPP_DIR"); dir != "" {
+		path := filepath.Join(dir, convertScript)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	if path, err := exec.LookPath(convertScript); err == nil {
+		return path, nil
+	}
+
+	path := filepath.Join(cfg.CacheDir, "llama.cpp", convertScript)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s not found", convertScript)
+	}
+	return path, nil
+}
+
+// ensureConverter returns a Python interpreter with the converter's
+// dependencies installed and the path to the conversion script, cloning
+// llama.cpp and creating a virtual environment on first use
+func ensureConverter(cfg *config.Config) (string, string, error) {
+	script, err := findConvertScript(cfg)
+	if err != nil {
+		checkout := filepath.Join(cfg.CacheDir, "llama.cpp")
+		ui.PrintInfo(fmt.Sprintf("Fetching %s into %s...", convertScript, checkout))
+		os.RemoveAll(checkout)
+		if err := runStep("git", "clone", "--depth", "1", llamaCppRepo, checkout); err != nil {
+			return "", "", fmt.Errorf("cloning llama.cpp: %w", err)
+		}
+		script = filepath.Join(checkout, convertScript)
+	}
+
+	venv := filepath.Join(cfg.CacheDir, "convert-venv")
+	python := filepath.Join(venv, "bin", "python")
+	if stageDone(venv, "requirements") {
+		return python, script, nil
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Creating Python environment in %s...", venv))
+	if err := runStep("python3", "-m", "venv", venv); err != nil {
+		return "", "", fmt.Errorf("creating virtual environment: %w", err)
+	}
+
+	install := []string{"-m", "pip", "install", "--upgrade"}
+	requirements := filepath.Join(filepath.Dir(script), "requirements", "requirements-convert_hf_to_gguf.txt")
+	if _, err := os.Stat(requirements); err == nil {
+		install = append(install, "-r", requirements)
+	} else {
+		install = append(install, convertRequirements...)
+	}
+	if err := runStep(python, install...); err != nil {
+		return "", "", fmt.Errorf("installing converter dependencies: %w", err)
+	}
+
+	return python, script, markStage(venv, "requirements")
+}
+
+// runStep runs an external command with its output shown on the terminal
+func runStep(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	ui.LogCommand(cmd)
+	return cmd.Run()
+}
+
+// stageDone reports whether a stage marker exists in dir
+func stageDone(dir, stage string) bool {
+	_, err := os.Stat(filepath.Join(dir, "."+stage+".done"))
+	return err == nil
+}
+
+// markStage records that a stage completed
+func markStage(dir, stage string) error {
+	if err := os.WriteFile(filepath.Join(dir, "."+stage+".done"), nil, 0644); err != nil {
+		return fmt.Errorf("recording %s stage: %w", stage, err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// resolveURL returns the Hugging Face download URL of a file in a model repository
+func resolveURL(modelID, fileName string) string {
+	parts := strings.Split(fileName, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return fmt.Sprintf("https://huggingface.co/%s/resolve/main/%s", modelID, strings.Join(parts, "/"))
+}
+
+// downloadFile streams rawURL to dest through a .part file, resuming a
+// previous partial download with an HTTP range request, and renames the
+// file into place once it is complete. A download stopped by ctx removes
+// its .part file; one that fails keeps it to resume from.
+func downloadFile(ctx context.Context, rawURL, dest, token string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("creating download directory: %w", err)
+	}
+
+	part := dest + ".part"
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating download request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return cancelDownload(ctx, part)
+		}
+		return fmt.Errorf("downloading %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server ignored the range request; start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file already holds the whole download
+		return os.Rename(part, dest)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("download refused with status %d; the model may be gated or require a Hugging Face token (run 'llm-cli login')", resp.StatusCode)
+	default:
+		return fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	if offset > 0 {
+		ui.PrintInfo(fmt.Sprintf("Resuming download at %s.", formatBytes(offset)))
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", part, err)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+
+	progress := &progressWriter{done: offset, total: total, start: time.Now(), resumed: offset, line: ui.NewProgress(os.Stdout)}
+	_, copyErr := io.Copy(io.MultiWriter(out, progress), resp.Body)
+	progress.finish()
+	closeErr := out.Close()
+
+	if ctx.Err() != nil {
+		return cancelDownload(ctx, part)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("download interrupted (run the command again to resume): %w", copyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("writing %s: %w", part, closeErr)
+	}
+	if total >= 0 && progress.done != total {
+		return fmt.Errorf("download incomplete: got %d of %d bytes (run the command again to resume)", progress.done, total)
+	}
+
+	return os.Rename(part, dest)
+}
+
+// cancelDownload removes the partial file of a cancelled download and
+// returns why it was cancelled
+func cancelDownload(ctx context.Context, part string) error {
+	if err := os.Remove(part); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ui.PrintWarn(fmt.Sprintf("Failed to remove partial download %s: %v", part, err))
+	} else {
+		ui.PrintInfo("Download cancelled; the partial file was removed.")
+	}
+	return ctx.Err()
+}
+
+// progressWriter prints download progress on a single terminal line
+type progressWriter struct {
+	done, total, resumed int64
+	start, last          time.Time
+	line                 *ui.Progress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.last) >= 500*time.Millisecond {
+		p.print()
+		p.last = time.Now()
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) print() {
+	rate := ""
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = fmt.Sprintf("  %s/s", formatBytes(int64(float64(p.done-p.resumed)/elapsed)))
+	}
+	if p.total > 0 {
+		fraction := float64(p.done) / float64(p.total)
+		p.line.Update(fraction,
+			fmt.Sprintf("  %s / %s (%.1f%%)%s   ", formatBytes(p.done), formatBytes(p.total), fraction*100, rate),
+			fmt.Sprintf("Downloaded %.0f%% (%s of %s).", fraction*100, formatBytes(p.done), formatBytes(p.total)))
+	} else {
+		p.line.Update(-1,
+			fmt.Sprintf("  %s%s   ", formatBytes(p.done), rate),
+			fmt.Sprintf("Downloaded %s so far.", formatBytes(p.done)))
+	}
+}
+
+func (p *progressWriter) finish() {
+	p.print()
+	p.line.Done()
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// JoinShards merges a split GGUF model into a single file
+func JoinShards(firstShard, output string) error {
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("%s already exists", output)
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Joining shards of %s...", firstShard))
+	count, err := gguf.Join(firstShard, output)
+	if err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Joined %d shards into %s", count, output))
+	return nil
+}
+
+// SplitModel splits a GGUF file, or the file of an installed model slug,
+// into shards named <prefix>-0000N-of-0000M.gguf
+func SplitModel(store *db.Store, input, prefix string, maxTensors int, maxSize string) error {
+	path := input
+	if _, err := os.Stat(path); err != nil {
+		model, err := store.GetModelBySlug(input)
+		if err != nil {
+			return fmt.Errorf("%s is neither a file nor a model slug", input)
+		}
+		path = model.FilePath
+	}
+
+	maxBytes, err := ParseSize(maxSize)
+	if err != nil {
+		return err
+	}
+	if maxTensors == 0 && maxBytes == 0 {
+		maxTensors = 128
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Splitting %s...", path))
+	shards, err := gguf.Split(path, prefix, maxTensors, maxBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		ui.PrintInfo(fmt.Sprintf("Wrote %s", shard))
+	}
+	return nil
+}
+
+// ParseSize parses sizes such as 500M or 4G into bytes; empty means no limit
+func ParseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	upper := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if upper == "" {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	multiplier := int64(1)
+	if unit, ok := units[upper[len(upper)-1:]]; ok {
+		multiplier = unit
+		upper = upper[:len(upper)-1]
+	}
+
+	value, err := strconv.ParseFloat(upper, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// modelWithFile returns the installed model whose file is at path, or nil
+// if there is none
+func modelWithFile(store *db.Store, path string) (*db.Model, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	models, err := store.GetAllModels()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving models: %w", err)
+	}
+	for i := range models {
+		if filepath.Clean(models[i].FilePath) == abs {
+			return &models[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// MetadataChanges lists GGUF metadata edits
+type MetadataChanges struct {
+	ChatTemplateFile string   // file whose contents become tokenizer.chat_template
+	Name             string   // new general.name
+	Set              []string // key=value pairs; existing keys keep their type, new keys are strings
+	Unset            []string // keys to remove
+}
+
+// SetMetadata rewrites the metadata of a model file (given by slug or path).
+// The new file is written next to the original, verified, then renamed over
+// it, and the checksum of an installed model is updated to match.
+func SetMetadata(store *db.Store, target string, changes MetadataChanges) error {
+	if changes.ChatTemplateFile == "" && changes.Name == "" && len(changes.Set) == 0 && len(changes.Unset) == 0 {
+		return fmt.Errorf("no metadata changes given")
+	}
+
+	path := target
+	model, err := store.GetModelBySlug(target)
+	if err == nil {
+		path = model.FilePath
+	} else if _, statErr := os.Stat(path); statErr != nil {
+		return err
+	} else if model, err = modelWithFile(store, path); err != nil {
+		return err
+	}
+
+	f, err := gguf.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if changes.ChatTemplateFile != "" {
+		template, err := os.ReadFile(changes.ChatTemplateFile)
+		if err != nil {
+			return fmt.Errorf("reading chat template: %w", err)
+		}
+		f.Set("tokenizer.chat_template", gguf.TypeString, string(template))
+	}
+	if changes.Name != "" {
+		f.Set("general.name", gguf.TypeString, changes.Name)
+	}
+
+	for _, pair := range changes.Set {
+		key, text, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid --set value %q, expected key=value", pair)
+		}
+		typ := gguf.TypeString
+		if existing, ok := f.Get(key); ok {
+			typ = existing.Type
+		}
+		value, err := gguf.ParseValue(typ, text)
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+		f.Set(key, typ, value)
+	}
+
+	for _, key := range changes.Unset {
+		if !f.Delete(key) {
+			ui.PrintWarn(fmt.Sprintf("Key %s not present, nothing to remove", key))
+		}
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Rewriting metadata of %s...", path))
+	if err := f.Save(path); err != nil {
+		return err
+	}
+	if model != nil {
+		if err := rehashModel(store, model); err != nil {
+			return err
+		}
+	}
+
+	ui.PrintInfo("Metadata updated. Restart any running server for this model to pick up the change.")
+	return nil
+}
@@ -0,0 +1,32 @@
+package model
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"512", 512},
+		{"4K", 4 << 10},
+		{"500M", 500 << 20},
+		{"500mb", 500 << 20},
+		{"4G", 4 << 30},
+		{"1.5G", 3 << 29},
+		{" 2T ", 2 << 40},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"B", "G", "0", "-1G", "4X", "four", "1e400G"} {
+		if got, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
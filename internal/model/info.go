@@ -0,0 +1,205 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+)
+
+// InfoOptions controls what Info prints besides the summary
+type InfoOptions struct {
+	Template bool // print the full chat template
+	All      bool // print every metadata key
+}
+
+// Info prints what the GGUF header of a model (given by slug or path) says
+// about it, without starting a server, and for an installed model the saved
+// versions of its configuration
+func Info(store *db.Store, target string, opts InfoOptions) error {
+	path, slug := target, ""
+	if model, err := store.GetModelBySlug(target); err == nil {
+		path, slug = model.FilePath, model.Slug
+	} else if _, statErr := os.Stat(path); statErr != nil {
+		return err
+	}
+
+	f, err := gguf.Open(path)
+	if err != nil {
+		return err
+	}
+
+	// Split models keep their tensors, and so their size, across all shards
+	shards := []*gguf.File{f}
+	if paths := gguf.ShardPaths(path); paths != nil {
+		for _, shardPath := range paths[1:] {
+			shard, err := gguf.Open(shardPath)
+			if err != nil {
+				return err
+			}
+			shards = append(shards, shard)
+		}
+	}
+	var params uint64
+	var size int64
+	tensorTypes := make(map[string]int)
+	for _, shard := range shards {
+		params += shard.ParameterCount()
+		size += shard.FileSize
+		for _, t := range shard.Tensors {
+			tensorTypes[gguf.TensorTypeName(t.Type)]++
+		}
+	}
+
+	arch, _ := f.String("general.architecture")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "file\t%s\n", path)
+	if len(shards) > 1 {
+		fmt.Fprintf(w, "shards\t%d\n", len(shards))
+	}
+	fmt.Fprintf(w, "size\t%s\n", formatBytes(size))
+	fmt.Fprintf(w, "gguf version\t%d\n", f.Version)
+	if name, ok := f.String("general.name"); ok {
+		fmt.Fprintf(w, "name\t%s\n", name)
+	}
+	fmt.Fprintf(w, "architecture\t%s\n", valueOr(arch, "unknown"))
+	fmt.Fprintf(w, "parameters\t%s\n", formatCount(params))
+
+	quant, ok := f.FileType()
+	if !ok {
+		quant = valueOr(detectQuant(path), "unknown")
+	}
+	fmt.Fprintf(w, "quantization\t%s\n", quant)
+	fmt.Fprintf(w, "tensor types\t%s\n", formatTensorTypes(tensorTypes))
+
+	for _, field := range []struct{ label, key string }{
+		{"context length", ".context_length"},
+		{"embedding length", ".embedding_length"},
+		{"layers", ".block_count"},
+		{"attention heads", ".attention.head_count"},
+		{"kv heads", ".attention.head_count_kv"},
+		{"experts", ".expert_count"},
+		{"experts used", ".expert_used_count"},
+	} {
+		if value, ok := f.Uint(arch + field.key); ok {
+			fmt.Fprintf(w, "%s\t%d\n", field.label, value)
+		}
+	}
+
+	if tokenizer, ok := f.String("tokenizer.ggml.model"); ok {
+		if pre, ok := f.String("tokenizer.ggml.pre"); ok {
+			tokenizer += " (" + pre + ")"
+		}
+		fmt.Fprintf(w, "tokenizer\t%s\n", tokenizer)
+	}
+	if kv, ok := f.Get("tokenizer.ggml.tokens"); ok {
+		if tokens, ok := kv.Value.(gguf.Array); ok {
+			fmt.Fprintf(w, "vocabulary\t%d tokens\n", len(tokens.Values))
+			for _, special := range []struct{ label, key string }{
+				{"bos token", "tokenizer.ggml.bos_token_id"},
+				{"eos token", "tokenizer.ggml.eos_token_id"},
+				{"eot token", "tokenizer.ggml.eot_token_id"},
+			} {
+				if id, ok := f.Uint(special.key); ok && id < uint64(len(tokens.Values)) {
+					fmt.Fprintf(w, "%s\t%d %q\n", special.label, id, tokens.Values[id])
+				}
+			}
+		}
+	}
+
+	template, _ := f.String("tokenizer.chat_template")
+	if template == "" {
+		fmt.Fprintf(w, "chat template\tnone\n")
+	} else {
+		format := "not recognized"
+		if detected := chattmpl.Detect(template); detected != nil {
+			format = detected.Name
+		}
+		fmt.Fprintf(w, "chat template\t%s (%d characters)\n", format, len(template))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if slug != "" {
+		if err := printConfigHistory(store, slug); err != nil {
+			return err
+		}
+	}
+
+	if opts.Template && template != "" {
+		fmt.Printf("\n%s\n", strings.TrimRight(template, "\n"))
+	}
+	if opts.All {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tTYPE\tVALUE")
+		for _, kv := range f.KV {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", kv.Key, kv.Type, formatMetadataValue(kv.Value))
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// formatCount abbreviates a count such as a parameter count, e.g. 7.6B
+func formatCount(n uint64) string {
+	switch {
+	case n >= 1e12:
+		return fmt.Sprintf("%.1fT", float64(n)/1e12)
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// formatTensorTypes lists tensor types by how many tensors use them, most first
+func formatTensorTypes(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s x%d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatMetadataValue shows a metadata value on one line, summarizing
+// arrays and cutting long strings
+func formatMetadataValue(value interface{}) string {
+	switch v := value.(type) {
+	case gguf.Array:
+		return fmt.Sprintf("[%d %s values]", len(v.Values), v.Type)
+	case string:
+		if runes := []rune(v); len(runes) > 60 {
+			v = string(runes[:57]) + "..."
+		}
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(value)
+}
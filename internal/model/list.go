@@ -0,0 +1,226 @@
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// ListOptions controls how List shows the models
+type ListOptions struct {
+	Relative bool     // show when models were last used as "3h ago" rather than the date
+	Format   string   // table (the default), json or csv
+	Tags     []string // only models with every one of these tags
+	Sort     string   // used (the default), name, size or params
+}
+
+// ListSorts are the orders ls --sort can list models in
+var ListSorts = []string{"used", "name", "size", "params"}
+
+// listedModel is a model as ls --json and --csv write it. Times are
+// ISO 8601 in UTC, so they compare the same whatever the locale.
+type listedModel struct {
+	Slug       string     `json:"slug"`
+	ModelID    string     `json:"model_id"`
+	Arch       string     `json:"arch,omitempty"`
+	Params     int64      `json:"params,omitempty"` // number of weights; omitted if unknown
+	Quant      string     `json:"quant"`
+	Size       string     `json:"size"`
+	Tags       []string   `json:"tags"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsed   *time.Time `json:"last_used"` // null if never used
+	Quarantine string     `json:"quarantine,omitempty"`
+}
+
+// List lists the downloaded models, the most recently used first; ties,
+// and models never used, go by when they were downloaded, then by slug.
+// opts.Sort lists them by name, or largest first by size or parameters.
+func List(store *db.Store, opts ListOptions) error {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return fmt.Errorf("retrieving models: %w", err)
+	}
+	tags, err := store.GetModelTags()
+	if err != nil {
+		return err
+	}
+	models = withTags(models, tags, opts.Tags)
+	for i, model := range models {
+		// Models added before metadata was recorded get it on first listing
+		if model.Arch == "" && model.Params == 0 {
+			models[i] = recordMetadata(store, model)
+		}
+	}
+	if err := sortModels(models, opts.Sort); err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case "json", "csv":
+		listed := make([]listedModel, 0, len(models))
+		for _, model := range models {
+			entry := listedModel{
+				Slug: model.Slug, ModelID: model.ModelID, Arch: model.Arch, Params: model.Params, Quant: model.Quant,
+				Size: model.FileSize, Tags: tags[model.Slug], CreatedAt: model.CreatedAt.UTC(), Quarantine: model.Quarantine,
+			}
+			if entry.Tags == nil {
+				entry.Tags = []string{}
+			}
+			if model.LastUsed.Valid {
+				lastUsed := model.LastUsed.Time.UTC()
+				entry.LastUsed = &lastUsed
+			}
+			listed = append(listed, entry)
+		}
+		if opts.Format == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(listed); err != nil {
+				return fmt.Errorf("encoding models: %w", err)
+			}
+			return nil
+		}
+		return writeModelsCSV(listed)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tMODEL ID\tPARAMS\tQUANT\tSIZE\tTAGS\tLAST USED")
+	for _, model := range models {
+		lastUsed := "Never"
+		if model.LastUsed.Valid {
+			if opts.Relative {
+				lastUsed = relativeTime(model.LastUsed.Time, now)
+			} else {
+				lastUsed = model.LastUsed.Time.Local().Format("2006-01-02 15:04:05")
+			}
+		}
+
+		quant := model.Quant
+		if quant == "" {
+			quant = "-"
+		}
+		params := "-"
+		if model.Params > 0 {
+			params = formatCount(uint64(model.Params))
+		}
+		modelTags := "-"
+		if len(tags[model.Slug]) > 0 {
+			modelTags = strings.Join(tags[model.Slug], ",")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			model.Slug, model.ModelID, params, quant, model.FileSize, modelTags, lastUsed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, model := range models {
+		if model.Quarantine != "" {
+			ui.PrintWarn(fmt.Sprintf("%s is quarantined: %s", model.Slug, model.Quarantine))
+		}
+	}
+	return nil
+}
+
+// writeModelsCSV writes models as CSV with a header row; a model never
+// used has an empty last_used
+func writeModelsCSV(models []listedModel) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"slug", "model_id", "arch", "params", "quant", "size", "tags", "created_at", "last_used", "quarantine"})
+	for _, model := range models {
+		lastUsed := ""
+		if model.LastUsed != nil {
+			lastUsed = model.LastUsed.Format(time.RFC3339)
+		}
+		params := ""
+		if model.Params > 0 {
+			params = strconv.FormatInt(model.Params, 10)
+		}
+		w.Write([]string{model.Slug, model.ModelID, model.Arch, params, model.Quant, model.Size, strings.Join(model.Tags, ","),
+			model.CreatedAt.Format(time.RFC3339), lastUsed, model.Quarantine})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("writing CSV: %w", err)
+	}
+	return nil
+}
+
+// withTags returns the models tagged with every one of want
+func withTags(models []db.Model, tags map[string][]string, want []string) []db.Model {
+	if len(want) == 0 {
+		return models
+	}
+	var kept []db.Model
+	for _, model := range models {
+		has := make(map[string]bool)
+		for _, tag := range tags[model.Slug] {
+			has[tag] = true
+		}
+		all := true
+		for _, tag := range want {
+			all = all && has[strings.ToLower(tag)]
+		}
+		if all {
+			kept = append(kept, model)
+		}
+	}
+	return kept
+}
+
+// sortModels orders models, already most recently used first, by name,
+// or largest first by size or parameter count. Ties keep the usage order.
+func sortModels(models []db.Model, by string) error {
+	var less func(a, b db.Model) bool
+	switch by {
+	case "", "used":
+		return nil
+	case "name":
+		less = func(a, b db.Model) bool { return a.Slug < b.Slug }
+	case "size":
+		less = func(a, b db.Model) bool { return sizeMB(a) > sizeMB(b) }
+	case "params":
+		less = func(a, b db.Model) bool { return a.Params > b.Params }
+	default:
+		return fmt.Errorf("invalid sort %q: use %s", by, strings.Join(ListSorts, ", "))
+	}
+	sort.SliceStable(models, func(i, j int) bool { return less(models[i], models[j]) })
+	return nil
+}
+
+// sizeMB returns the size of a model's files in MB, as recorded when it
+// was added, e.g. 4370M
+func sizeMB(model db.Model) int {
+	size, _ := strconv.Atoi(strings.TrimSuffix(model.FileSize, "M"))
+	return size
+}
+
+// relativeTime describes how long before now t was, e.g. "5m ago",
+// "3h ago" or "2d ago"
+func relativeTime(t, now time.Time) string {
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed/time.Minute))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed/time.Hour))
+	case elapsed < 60*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(elapsed/(24*time.Hour)))
+	case elapsed < 730*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(elapsed/(30*24*time.Hour)))
+	}
+	return fmt.Sprintf("%dy ago", int(elapsed/(365*24*time.Hour)))
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,20 +12,25 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/garyblankenship/llmcli/internal/config"
 	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
 	"github.com/garyblankenship/llmcli/internal/ui"
 )
 
 // huggingFaceModel represents a model from the Hugging Face API
 type huggingFaceModel struct {
 	ModelID      string   `json:"modelId"`
+	SHA          string   `json:"sha"` // commit of the repository's main branch
 	LastModified string   `json:"lastModified"`
 	Tags         []string `json:"tags"`
 	Siblings     []struct {
 		RFileName string `json:"rfilename"`
+		LFS       *struct {
+			SHA256 string `json:"sha256"`
+			Size   int64  `json:"size"`
+		} `json:"lfs,omitempty"`
 	} `json:"siblings"`
 	Downloads int `json:"downloads,omitempty"`
 	Likes     int `json:"likes,omitempty"`
@@ -55,130 +61,347 @@ func generateSlug(modelID string) string {
 	return slug
 }
 
+// defaultQuant is pulled when no quantization is requested and no terminal is available to ask
+const defaultQuant = "Q4_K_M"
+
+var shardSuffixPattern = regexp.MustCompile(`-\d{5}-of-\d{5}\.gguf$`)
+
+var quantPattern = regexp.MustCompile(`(?i)(?:^|[-_.])(i?q[0-9](?:_[a-z0-9]+)*|bf16|f16|f32)\.gguf$`)
+
+// detectQuant extracts the quantization type (e.g. Q4_K_M, IQ4_XS, F16) from a GGUF file name
+func detectQuant(fileName string) string {
+	name := shardSuffixPattern.ReplaceAllString(filepath.Base(fileName), ".gguf")
+	match := quantPattern.FindStringSubmatch(name)
+	if match == nil {
+		return ""
+	}
+	return strings.ToUpper(match[1])
+}
+
+// PullOptions controls how a model is downloaded
+type PullOptions struct {
+	Quant    string // quantization to download; asks when empty or missing and several exist
+	UseHFCLI bool   // download with huggingface-cli instead of the built-in downloader
+	Yes      bool   // never ask which file to download
+}
+
 // Pull downloads a model from Hugging Face
-func Pull(store *db.Store, cfg *config.Config, modelID string) error {
+func Pull(ctx context.Context, store *db.Store, cfg *config.Config, modelID string, opts PullOptions) error {
+	model, err := Download(ctx, store, cfg, modelID, opts)
+	if err != nil || model == nil {
+		return err
+	}
+	fmt.Printf("To use this model, run: llm-cli chat %s\n", model.Slug)
+	return nil
+}
+
+// Download downloads a model from Hugging Face and returns it as installed,
+// or the installed model if its files are already there. It returns nil if
+// the files are there but belong to no installed model. Cancelling ctx
+// stops the download and installs nothing.
+func Download(ctx context.Context, store *db.Store, cfg *config.Config, modelID string, opts PullOptions) (*db.Model, error) {
 	if !validateModelID(modelID) {
-		return fmt.Errorf("invalid model ID format: %s", modelID)
+		return nil, fmt.Errorf("invalid model ID format: %s", modelID)
 	}
 
 	// Create model directory
 	modelDir := filepath.Join(cfg.ModelsDir, modelID)
 	
-	// Check if model already exists
-	if _, err := os.Stat(modelDir); err == nil {
-		// Directory exists, check for .gguf files
-		files, err := filepath.Glob(filepath.Join(modelDir, "*.gguf"))
-		if err != nil {
-			return fmt.Errorf("checking existing files: %w", err)
-		}
-		
-		if len(files) > 0 {
-			ui.PrintWarn(fmt.Sprintf("Model already exists in %s. Remove existing files to re-download.", modelDir))
-			return nil
-		}
-	}
-	
 	// Fetch model information from Hugging Face API
 	ui.PrintInfo(fmt.Sprintf("Fetching model information for %s...", modelID))
-	apiURL := fmt.Sprintf("https://huggingface.co/api/models/%s?filter=gguf&sort=lastModified", modelID)
+	modelInfo, err := fetchModelInfo(cfg, modelID)
+	if err != nil {
+		return nil, err
+	}
 	
-	resp, err := http.Get(apiURL)
+	// Find the GGUF file for the requested quantization
+	fileToDownload, err := selectQuantFile(modelInfo, opts.Quant, !opts.Yes && ui.IsInteractive())
 	if err != nil {
-		return fmt.Errorf("fetching model information: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	quant := detectQuant(fileToDownload)
 	
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	// Split models are downloaded shard by shard; the first shard is the entry point
+	files := gguf.ShardPaths(fileToDownload)
+	if files == nil {
+		files = []string{fileToDownload}
+	} else {
+		ui.PrintInfo(fmt.Sprintf("%s is split into %d shards.", quant, len(files)))
 	}
 	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading API response: %w", err)
+	// Check if these files already exist
+	downloadedFile := filepath.Join(modelDir, fileToDownload)
+	if allExist(modelDir, files) {
+		ui.PrintWarn(fmt.Sprintf("%s already exists in %s. Remove it to re-download.", fileToDownload, modelDir))
+		return installedModel(store, downloadedFile)
 	}
 	
-	var modelInfo huggingFaceModel
-	if err := json.Unmarshal(body, &modelInfo); err != nil {
-		return fmt.Errorf("parsing model information: %w", err)
+	// Create directory if it doesn't exist
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating model directory: %w", err)
 	}
 	
-	// Find q4_k_m.gguf file to download
-	var fileToDownload string
-	for _, sibling := range modelInfo.Siblings {
-		lowerName := strings.ToLower(sibling.RFileName)
-		if strings.HasSuffix(lowerName, "q4_k_m.gguf") {
-			fileToDownload = sibling.RFileName
-			break
+	var totalSize int64
+	var checksums []string
+	for i, file := range files {
+		path := filepath.Join(modelDir, file)
+		if len(files) > 1 {
+			ui.PrintInfo(fmt.Sprintf("Shard %d/%d", i+1, len(files)))
+		}
+		
+		checksum, size, err := downloadModelFile(ctx, cfg, modelInfo, file, path, opts.UseHFCLI)
+		if err != nil {
+			return nil, err
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		totalSize += size
+		checksums = append(checksums, checksum)
 	}
 	
-	if fileToDownload == "" {
-		return fmt.Errorf("no q4_k_m.gguf file found for %s", modelID)
-	}
+	fileSize := fmt.Sprintf("%dM", totalSize/(1024*1024)) // Size in MB
 	
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(modelDir, 0755); err != nil {
-		return fmt.Errorf("creating model directory: %w", err)
+	// Generate slug, keeping other installed quantizations of the same model
+	slug, err := quantSlug(store, cfg.SlugScheme, modelID, quant, downloadedFile)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Download the file using huggingface-cli
-	ui.PrintInfo(fmt.Sprintf("Downloading %s for model %s...", fileToDownload, modelID))
-	cmd := exec.Command("huggingface-cli", "download", modelID, fileToDownload, "--local-dir", modelDir)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Add to database
+	if err := store.AddModel(slug, modelID, fileToDownload, downloadedFile, fileSize, quant); err != nil {
+		return nil, fmt.Errorf("adding model to database: %w", err)
+	}
+	if err := store.SetModelChecksum(slug, strings.Join(checksums, ",")); err != nil {
+		return nil, err
+	}
+	if err := store.SetModelRevision(slug, modelInfo.SHA); err != nil {
+		return nil, err
+	}
+	recordMetadata(store, db.Model{Slug: slug, FilePath: downloadedFile})
 	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("downloading model: %w", err)
+	ui.PrintInfo(fmt.Sprintf("Model added to database with slug: %s", slug))
+	return store.GetModelBySlug(slug)
+}
+
+// installedModel returns the installed model whose file is path, or nil if none is
+func installedModel(store *db.Store, path string) (*db.Model, error) {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return nil, err
+	}
+	for i := range models {
+		if models[i].FilePath == path {
+			return &models[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// fetchModelInfo fetches a model repository's details, including the
+// checksums of its files, from the Hugging Face API. The token, if any, is
+// sent so gated and private repositories can be read.
+func fetchModelInfo(cfg *config.Config, modelID string) (huggingFaceModel, error) {
+	var info huggingFaceModel
+	
+	apiURL := fmt.Sprintf("https://huggingface.co/api/models/%s?blobs=true", modelID)
+	resp, err := hfGet(cfg, apiURL)
+	if err != nil {
+		return info, fmt.Errorf("fetching model information: %w", err)
 	}
+	defer resp.Body.Close()
 	
-	downloadedFile := filepath.Join(modelDir, fileToDownload)
-	if _, err := os.Stat(downloadedFile); err != nil {
-		return fmt.Errorf("downloaded file not found: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		return info, apiError(resp)
 	}
 	
-	// Get file size
-	fileInfo, err := os.Stat(downloadedFile)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("getting file info: %w", err)
+		return info, fmt.Errorf("reading API response: %w", err)
 	}
 	
-	fileSize := fmt.Sprintf("%dM", fileInfo.Size()/(1024*1024)) // Size in MB
-	
-	// Generate slug
-	slug := generateSlug(modelID)
+	if err := json.Unmarshal(body, &info); err != nil {
+		return info, fmt.Errorf("parsing model information: %w", err)
+	}
+	return info, nil
+}
+
+// downloadModelFile downloads one file of a model repository to path,
+// skipping files that are already complete, and verifies it against the
+// published checksum. It returns the file's SHA256 and size.
+func downloadModelFile(ctx context.Context, cfg *config.Config, info huggingFaceModel, file, path string, useHFCLI bool) (string, int64, error) {
+	if _, err := os.Stat(path); err != nil {
+		ui.PrintInfo(fmt.Sprintf("Downloading %s for model %s...", file, info.ModelID))
+		if useHFCLI {
+			// Download the file using huggingface-cli
+			exportHFToken(cfg)
+			cmd := exec.CommandContext(ctx, "huggingface-cli", "download", info.ModelID, file, "--local-dir", filepath.Join(cfg.ModelsDir, info.ModelID))
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			ui.LogCommand(cmd)
+			
+			if err := cmd.Run(); err != nil {
+				if ctx.Err() != nil {
+					return "", 0, ctx.Err()
+				}
+				return "", 0, fmt.Errorf("downloading model: %w", err)
+			}
+		} else {
+			if err := downloadFile(ctx, resolveURL(info.ModelID, file), path, hfToken(cfg)); err != nil {
+				return "", 0, err
+			}
+		}
+	}
 	
-	// Add to database
-	if err := store.AddModel(slug, modelID, fileToDownload, downloadedFile, fileSize); err != nil {
-		return fmt.Errorf("adding model to database: %w", err)
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("downloaded file not found: %w", err)
 	}
 	
-	ui.PrintInfo(fmt.Sprintf("Model added to database with slug: %s", slug))
-	fmt.Printf("To use this model, run: llm-cli chat %s\n", slug)
+	// Verify the download against the checksum published by Hugging Face
+	ui.PrintInfo("Verifying checksum...")
+	checksum, err := hashFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if expected := info.checksum(file); expected == "" {
+		ui.PrintWarn("No published checksum found; recording the local one for later verification.")
+	} else if checksum != expected {
+		os.Remove(path)
+		return "", 0, fmt.Errorf("checksum mismatch for %s (expected %s, got %s); the corrupt file was removed, run pull again", file, expected, checksum)
+	}
 	
-	return nil
+	return checksum, fileInfo.Size(), nil
 }
 
-// List displays all models
-func List(store *db.Store) error {
-	models, err := store.GetAllModels()
+// allExist reports whether every file exists in dir
+func allExist(dir string, files []string) bool {
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checksum returns the SHA256 Hugging Face publishes for a file, or "" if unknown
+func (m huggingFaceModel) checksum(fileName string) string {
+	for _, sibling := range m.Siblings {
+		if sibling.RFileName == fileName && sibling.LFS != nil {
+			return sibling.LFS.SHA256
+		}
+	}
+	return ""
+}
+
+// quantSlug returns the slug scheme gives a model file, suffixed with its
+// quantization when another file already has the plain slug
+func quantSlug(store *db.Store, scheme, modelID, quant, filePath string) (string, error) {
+	slug, err := modelSlug(scheme, modelID, quant)
 	if err != nil {
-		return fmt.Errorf("retrieving models: %w", err)
+		return "", err
+	}
+	if existing, err := store.GetModelBySlug(slug); err == nil && existing.FilePath != filePath {
+		slug = generateSlug(slug + "-" + quant)
+	}
+	return slug, nil
+}
+
+// ggufCandidate is a GGUF file that can be pulled from a repository
+type ggufCandidate struct {
+	file  string // the file, or the first shard of a split model
+	quant string // detected quantization, empty if the name doesn't say
+	size  int64  // total size of every shard
+}
+
+// ggufCandidates lists the model files in a repository, with split models
+// listed once by their first shard
+func ggufCandidates(info huggingFaceModel) []ggufCandidate {
+	sizes := make(map[string]int64)
+	for _, sibling := range info.Siblings {
+		if sibling.LFS != nil {
+			sizes[sibling.RFileName] = sibling.LFS.Size
+		}
 	}
 	
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "SLUG\tMODEL ID\tSIZE\tLAST USED")
+	var candidates []ggufCandidate
+	for _, sibling := range info.Siblings {
+		name := sibling.RFileName
+		if !strings.HasSuffix(strings.ToLower(name), ".gguf") {
+			continue
+		}
+		// Vision projectors are companions to a model, not a model themselves
+		if strings.HasPrefix(strings.ToLower(filepath.Base(name)), "mmproj") {
+			continue
+		}
+		size := sizes[name]
+		// Split models are listed by their first shard
+		if shards := gguf.ShardPaths(name); shards != nil {
+			if shards[0] != name {
+				continue
+			}
+			size = 0
+			for _, shard := range shards {
+				size += sizes[shard]
+			}
+		}
+		candidates = append(candidates, ggufCandidate{file: name, quant: detectQuant(name), size: size})
+	}
+	return candidates
+}
+
+// selectQuantFile picks the GGUF file to download for quant. When quant is
+// empty or not found and ask is set, the user picks from every GGUF file in
+// the repository; otherwise Q4_K_M is the fallback.
+func selectQuantFile(info huggingFaceModel, quant string, ask bool) (string, error) {
+	candidates := ggufCandidates(info)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no GGUF files found for %s", info.ModelID)
+	}
+	
+	var quants []string
+	for _, c := range candidates {
+		if c.quant != "" {
+			quants = append(quants, c.quant)
+		}
+	}
 	
-	for _, model := range models {
-		lastUsed := "Never"
-		if model.LastUsed.Valid {
-			lastUsed = model.LastUsed.Time.Format("2006-01-02 15:04:05")
+	if quant != "" {
+		for _, c := range candidates {
+			if strings.EqualFold(c.quant, quant) {
+				return c.file, nil
+			}
 		}
-		
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", 
-			model.Slug, model.ModelID, model.FileSize, lastUsed)
+		if !ask {
+			return "", fmt.Errorf("no %s file found for %s (available: %s)", strings.ToUpper(quant), info.ModelID, strings.Join(quants, ", "))
+		}
+		ui.PrintWarn(fmt.Sprintf("No %s file found for %s.", strings.ToUpper(quant), info.ModelID))
+	} else if len(candidates) == 1 {
+		return candidates[0].file, nil
+	}
+	
+	if !ask {
+		for _, c := range candidates {
+			if c.quant == defaultQuant {
+				return c.file, nil
+			}
+		}
+		return "", fmt.Errorf("multiple files available for %s, choose one with --quant (available: %s)", info.ModelID, strings.Join(quants, ", "))
 	}
 	
-	return w.Flush()
+	options := make([]string, len(candidates))
+	for i, c := range candidates {
+		size := "?"
+		if c.size > 0 {
+			size = formatBytes(c.size)
+		}
+		options[i] = fmt.Sprintf("%-8s %10s  %s", valueOr(c.quant, "-"), size, c.file)
+	}
+	choice, err := ui.Choose(fmt.Sprintf("Select a file to download from %s:", info.ModelID), options)
+	if err != nil {
+		return "", err
+	}
+	return candidates[choice].file, nil
 }
 
 // Remove removes a model
@@ -188,9 +411,11 @@ func Remove(store *db.Store, cfg *config.Config, slug string) error {
 		return err
 	}
 	
-	// Remove file
-	if err := os.Remove(model.FilePath); err != nil {
-		return fmt.Errorf("removing file: %w", err)
+	// Remove file, including every shard of a split model
+	for _, path := range modelFiles(model) {
+		if err := os.Remove(path); err != nil && !(os.IsNotExist(err) && path != model.FilePath) {
+			return fmt.Errorf("removing file: %w", err)
+		}
 	}
 	
 	// Remove from database
@@ -202,8 +427,16 @@ func Remove(store *db.Store, cfg *config.Config, slug string) error {
 	return nil
 }
 
+// modelFiles returns the files of a model: its shards when split, otherwise just its file
+func modelFiles(model *db.Model) []string {
+	if shards := gguf.ShardPaths(model.FilePath); shards != nil {
+		return shards
+	}
+	return []string{model.FilePath}
+}
+
 // Alias creates an alias for a model
-func Alias(store *db.Store, oldSlug, newSlug string) error {
+func Alias(store *db.Store, cfg *config.Config, oldSlug, newSlug string) error {
 	// Check if old slug exists
 	if _, err := store.GetModelBySlug(oldSlug); err != nil {
 		return err
@@ -215,7 +448,7 @@ func Alias(store *db.Store, oldSlug, newSlug string) error {
 	}
 	
 	// Update slug
-	if err := store.UpdateModelSlug(oldSlug, newSlug); err != nil {
+	if err := renameModel(store, cfg, oldSlug, newSlug); err != nil {
 		return err
 	}
 	
@@ -223,8 +456,26 @@ func Alias(store *db.Store, oldSlug, newSlug string) error {
 	return nil
 }
 
+// renameModel changes a model's slug in the database and in the config
+// file's starred models and tasks
+func renameModel(store *db.Store, cfg *config.Config, oldSlug, newSlug string) error {
+	if err := store.UpdateModelSlug(oldSlug, newSlug); err != nil {
+		return err
+	}
+	changed, err := config.RenameModel(cfg, oldSlug, newSlug)
+	if err != nil {
+		ui.PrintWarn(fmt.Sprintf("Couldn't update %s in %s, where starred models and tasks may still name it: %v", oldSlug, cfg.ConfigPath, err))
+	} else if changed > 0 {
+		ui.PrintInfo(fmt.Sprintf("Updated %d references to %s in %s.", changed, oldSlug, cfg.ConfigPath))
+	}
+	return nil
+}
+
 // ImportExisting imports existing models from the filesystem
 func ImportExisting(store *db.Store, cfg *config.Config) error {
+	if err := ValidateSlugScheme(cfg.SlugScheme); err != nil {
+		return err
+	}
 	ui.PrintInfo(fmt.Sprintf("Scanning for existing models in %s...", cfg.ModelsDir))
 	
 	err := filepath.Walk(cfg.ModelsDir, func(path string, info os.FileInfo, err error) error {
@@ -250,15 +501,34 @@ func ImportExisting(store *db.Store, cfg *config.Config) error {
 				modelID = filepath.Join(parts[:len(parts)-1]...)
 			}
 			
+			// Split models are imported once, through their first shard
+			size := info.Size()
+			if shards := gguf.ShardPaths(path); shards != nil {
+				if shards[0] != path {
+					return nil
+				}
+				size = 0
+				for _, shard := range shards {
+					if shardInfo, err := os.Stat(shard); err == nil {
+						size += shardInfo.Size()
+					}
+				}
+			}
+			
 			fileName := filepath.Base(path)
-			fileSize := fmt.Sprintf("%dM", info.Size()/(1024*1024)) // Size in MB
-			slug := generateSlug(modelID)
+			fileSize := fmt.Sprintf("%dM", size/(1024*1024)) // Size in MB
+			quant := detectQuant(fileName)
+			slug, err := quantSlug(store, cfg.SlugScheme, modelID, quant, path)
+			if err != nil {
+				return err
+			}
 			
 			// Add to database
-			if err := store.AddModel(slug, modelID, fileName, path, fileSize); err != nil {
+			if err := store.AddModel(slug, modelID, fileName, path, fileSize, quant); err != nil {
 				ui.PrintWarn(fmt.Sprintf("Failed to import model %s: %v", path, err))
 				return nil
 			}
+			recordMetadata(store, db.Model{Slug: slug, FilePath: path})
 			
 			ui.PrintInfo(fmt.Sprintf("Imported model: %s", slug))
 		}
@@ -303,6 +573,78 @@ func ResetDB(store *db.Store, cfg *config.Config) error {
 	return nil
 }
 
+// PurgeAllData securely removes stored user data: server and daemon logs,
+// the sandbox audit log, sessions, history, cached embeddings, index
+// collections, saved prompts, task runs and usage history. Downloaded
+// models and the config file are kept.
+func PurgeAllData(store *db.Store, cfg *config.Config) error {
+	if !ui.Confirm("This permanently deletes all stored logs, sessions, indexes, prompts, caches and usage data. Continue?") {
+		ui.PrintWarn("Purge cancelled.")
+		return nil
+	}
+	
+	logs, err := filepath.Glob(cfg.ServerLogPath("*"))
+	if err != nil {
+		return fmt.Errorf("finding server logs: %w", err)
+	}
+	logs = append(logs, cfg.DaemonLogPath(), cfg.Sandbox.AuditLog)
+	
+	for _, path := range logs {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := shredFile(path); err != nil {
+			ui.PrintWarn(fmt.Sprintf("Failed to remove %s: %v", path, err))
+			continue
+		}
+		ui.PrintInfo(fmt.Sprintf("Removed %s", path))
+	}
+	
+	if err := store.PurgeUserData(); err != nil {
+		return err
+	}
+	
+	ui.PrintInfo("All stored user data purged.")
+	return nil
+}
+
+// shredFile overwrites a file with zeros before removing it
+func shredFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	
+	zeros := make([]byte, 64*1024)
+	for remaining := info.Size(); remaining > 0; {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := file.Write(zeros[:n]); err != nil {
+			file.Close()
+			return err
+		}
+		remaining -= n
+	}
+	
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	
+	return os.Remove(path)
+}
+
 // GetRecent fetches recent GGUF models from Hugging Face
 func GetRecent() error {
 	url := "https://huggingface.co/api/models?filter=gguf&sort=lastModified"
@@ -360,13 +702,13 @@ func GetRecent() error {
 	downloadsWidth := 9
 	
 	// Print header with border
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	fmt.Printf("%-*s %-*s %*s %*s\n",
 		modelIDWidth, "MODEL ID",
 		dateWidth, "LAST MODIFIED",
 		likesWidth, "LIKES",
 		downloadsWidth, "DOWNLOADS")
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	
 	// Format and print each model
 	count := 0
@@ -407,7 +749,7 @@ func GetRecent() error {
 		}
 	}
 	
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	fmt.Printf("Showing %d recent GGUF models from Hugging Face\n", count)
 	
 	return nil
@@ -471,13 +813,13 @@ func GetTrending() error {
 	downloadsWidth := 12
 	
 	// Print header with border
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	fmt.Printf("%-*s %-*s %*s %*s\n",
 		modelIDWidth, "MODEL ID",
 		dateWidth, "LAST UPDATED",
 		likesWidth, "LIKES",
 		downloadsWidth, "DOWNLOADS")
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	
 	// Format and print each model
 	count := 0
@@ -535,7 +877,7 @@ func GetTrending() error {
 		}
 	}
 	
-	fmt.Println(strings.Repeat("─", termWidth))
+	ui.Rule(termWidth)
 	fmt.Printf("Showing the top %d trending GGUF models from Hugging Face\n", count)
 	
 	return nil
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Unquarantine lets a crash-looping model be started automatically again
+func Unquarantine(store *db.Store, slug string) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+
+	if err := store.ClearServerCrashes(slug); err != nil {
+		return err
+	}
+	if model.Quarantine == "" {
+		ui.PrintInfo(fmt.Sprintf("Model %s is not quarantined.", slug))
+		return nil
+	}
+
+	if err := store.SetModelQuarantine(slug, ""); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Model %s is no longer quarantined.", slug))
+	return nil
+}
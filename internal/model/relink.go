@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Relink points a model at another Hugging Face repository, such as after
+// its repository was renamed, keeping its files, settings and history.
+// Hugging Face redirects renamed repositories, so the repository's current
+// name is recorded even when an old one is given.
+func Relink(store *db.Store, cfg *config.Config, slug, modelID string) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	if !validateModelID(modelID) {
+		return fmt.Errorf("invalid model ID format: %s (expected author/model-name)", modelID)
+	}
+
+	info, err := fetchModelInfo(cfg, modelID)
+	if err != nil {
+		return err
+	}
+	if info.ModelID != "" {
+		modelID = info.ModelID
+	}
+	if modelID == model.ModelID {
+		ui.PrintInfo(fmt.Sprintf("%s already comes from %s.", slug, modelID))
+		return nil
+	}
+	if !info.hasFile(model.FileName) {
+		ui.PrintWarn(fmt.Sprintf("%s doesn't publish %s, so upgrade and verify won't find it there.", modelID, model.FileName))
+	}
+	return relink(store, cfg, model, modelID)
+}
+
+// relink records a model's new repository, renaming the model when its slug
+// was generated from the old repository name. Slugs chosen with alias are kept.
+func relink(store *db.Store, cfg *config.Config, model *db.Model, modelID string) error {
+	if err := store.SetModelID(model.Slug, modelID); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("%s now comes from %s (was %s).", model.Slug, modelID, model.ModelID))
+
+	slug := relinkedSlug(model, modelID)
+	if slug != model.Slug {
+		if _, err := store.GetModelBySlug(slug); err == nil {
+			ui.PrintWarn(fmt.Sprintf("Keeping the slug %s, since %s is taken.", model.Slug, slug))
+		} else {
+			if err := renameModel(store, cfg, model.Slug, slug); err != nil {
+				return err
+			}
+			ui.PrintInfo(fmt.Sprintf("Renamed %s to %s.", model.Slug, slug))
+			model.Slug = slug
+		}
+	}
+	model.ModelID = modelID
+	return nil
+}
+
+// relinkedSlug returns the slug a model gets from its new repository: the
+// one a built-in slug scheme generates from modelID if its current slug was
+// generated from the old repository name that way, and its current slug
+// otherwise
+func relinkedSlug(model *db.Model, modelID string) string {
+	for _, scheme := range SlugSchemes() {
+		old, _ := modelSlug(scheme, model.ModelID, model.Quant)
+		slug, _ := modelSlug(scheme, modelID, model.Quant)
+		switch model.Slug {
+		case old:
+			return slug
+		case generateSlug(old + "-" + model.Quant):
+			return generateSlug(slug + "-" + model.Quant)
+		}
+	}
+	return model.Slug
+}
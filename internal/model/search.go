@@ -0,0 +1,211 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// SearchOptions controls a Hugging Face model search
+type SearchOptions struct {
+	Author string // only models from this user or organization
+	Sort   string // downloads, likes or modified
+	Limit  int    // results per page
+	Page   int    // 1-based page of results
+}
+
+// searchSorts maps the sort names accepted by search to API sort keys
+var searchSorts = map[string]string{
+	"downloads": "downloads",
+	"likes":     "likes",
+	"modified":  "lastModified",
+}
+
+// quantSize is the total size of a model's files for one quantization
+type quantSize struct {
+	Quant string
+	Size  int64
+}
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Search finds GGUF models on Hugging Face matching query and prints them
+// with the sizes of their quantized files
+func Search(cfg *config.Config, query string, opts SearchOptions) error {
+	apiSort, ok := searchSorts[opts.Sort]
+	if !ok {
+		return fmt.Errorf("invalid sort: %s (use downloads, likes or modified)", opts.Sort)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+
+	params := url.Values{}
+	params.Set("filter", "gguf")
+	params.Set("sort", apiSort)
+	params.Set("direction", "-1")
+	params.Set("limit", strconv.Itoa(opts.Limit))
+	if query != "" {
+		params.Set("search", query)
+	}
+	if opts.Author != "" {
+		params.Set("author", opts.Author)
+	}
+
+	// The API pages with a cursor, so earlier pages are walked to reach later ones
+	pageURL := "https://huggingface.co/api/models?" + params.Encode()
+	var models []huggingFaceModel
+	var next string
+	for page := 1; page <= opts.Page; page++ {
+		if pageURL == "" {
+			models = nil
+			break
+		}
+		var err error
+		if models, next, err = fetchSearchPage(cfg, pageURL); err != nil {
+			return err
+		}
+		pageURL = next
+	}
+
+	if len(models) == 0 {
+		fmt.Println("No GGUF models found.")
+		return nil
+	}
+
+	sizes := fetchQuantSizes(cfg, models)
+	for i, m := range models {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Printf("\033[1;36m%s\033[0m  %d downloads, %d likes", m.ModelID, m.Downloads, m.Likes)
+		if len(m.LastModified) >= 10 {
+			fmt.Printf(", modified %s", m.LastModified[:10])
+		}
+		fmt.Println()
+
+		quants, err := sizes[i].quants, sizes[i].err
+		if err != nil {
+			fmt.Printf("  (could not list files: %v)\n", err)
+			continue
+		}
+		if len(quants) == 0 {
+			fmt.Println("  (no quantized GGUF files)")
+			continue
+		}
+		for j, q := range quants {
+			if j%4 == 0 {
+				fmt.Print(" ")
+			}
+			fmt.Printf("  \033[0;33m%-8s\033[0m %9s", q.Quant, formatBytes(q.Size))
+			if j%4 == 3 || j == len(quants)-1 {
+				fmt.Println()
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Page %d, %d models.", opts.Page, len(models))
+	if next != "" {
+		fmt.Printf(" More with --page %d.", opts.Page+1)
+	}
+	fmt.Println(" Download one with: llmcli pull <model-id> --quant <quant>")
+	return nil
+}
+
+// fetchSearchPage fetches one page of search results and the URL of the next
+// page, which is empty on the last page
+func fetchSearchPage(cfg *config.Config, pageURL string) ([]huggingFaceModel, string, error) {
+	resp, err := hfGet(cfg, pageURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("searching models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", apiError(resp)
+	}
+
+	var models []huggingFaceModel
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, "", fmt.Errorf("parsing models: %w", err)
+	}
+
+	next := ""
+	if match := nextLinkPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		next = match[1]
+	}
+	return models, next, nil
+}
+
+// quantListing is the result of listing one model's quantized files
+type quantListing struct {
+	quants []quantSize
+	err    error
+}
+
+// fetchQuantSizes lists the quantized files of each model concurrently,
+// since search results don't include file sizes
+func fetchQuantSizes(cfg *config.Config, models []huggingFaceModel) []quantListing {
+	listings := make([]quantListing, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		wg.Add(1)
+		go func(i int, modelID string) {
+			defer wg.Done()
+			listings[i].quants, listings[i].err = fetchQuants(cfg, modelID)
+		}(i, m.ModelID)
+	}
+	wg.Wait()
+	return listings
+}
+
+// fetchQuants returns the quantizations available for a model, smallest
+// first, with the sizes of all shards of split models added together
+func fetchQuants(cfg *config.Config, modelID string) ([]quantSize, error) {
+	info, err := fetchModelInfo(cfg, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64)
+	for _, sibling := range info.Siblings {
+		if strings.HasPrefix(strings.ToLower(filepath.Base(sibling.RFileName)), "mmproj") {
+			continue
+		}
+		quant := detectQuant(sibling.RFileName)
+		if quant == "" {
+			continue
+		}
+		var size int64
+		if sibling.LFS != nil {
+			size = sibling.LFS.Size
+		}
+		totals[quant] += size
+	}
+
+	quants := make([]quantSize, 0, len(totals))
+	for quant, size := range totals {
+		quants = append(quants, quantSize{quant, size})
+	}
+	sort.Slice(quants, func(i, j int) bool {
+		if quants[i].Size != quants[j].Size {
+			return quants[i].Size < quants[j].Size
+		}
+		return quants[i].Quant < quants[j].Quant
+	})
+	return quants, nil
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// SetSetting stores a per-model override. Context and RoPE settings go
+// through the same checks as the ctx command.
+func SetSetting(store *db.Store, cfg *config.Config, slug, key, value string) error {
+	if _, err := store.GetModelBySlug(slug); err != nil {
+		return err
+	}
+
+	setting, ok := server.LookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown setting: %s (run 'llm-cli set %s' to list settings)", key, slug)
+	}
+	if err := setting.Validate(value); err != nil {
+		return err
+	}
+
+	for _, name := range server.ContextSettings {
+		if name == setting.Name {
+			return Context(store, cfg, slug, map[string]string{name: value}, false)
+		}
+	}
+
+	if err := store.SetModelSettings(slug, map[string]string{setting.Name: value}); err != nil {
+		return err
+	}
+
+	if setting.Server {
+		ui.PrintInfo(fmt.Sprintf("%s set to %s for %s. Restart its server (llm-cli kill %s) to apply it.", setting.Name, value, slug, slug))
+	} else {
+		ui.PrintInfo(fmt.Sprintf("%s set to %s for %s.", setting.Name, value, slug))
+	}
+	return nil
+}
+
+// ApplyPreset stores a sampling preset as a model's settings, replacing
+// any mirostat or dynamic temperature settings the preset doesn't use
+func ApplyPreset(store *db.Store, slug, name string) error {
+	if _, err := store.GetModelBySlug(slug); err != nil {
+		return err
+	}
+
+	preset, ok := server.LookupPreset(name)
+	if !ok {
+		return fmt.Errorf("unknown preset: %s (run 'llm-cli set --help' to list presets)", name)
+	}
+	// With no keys DeleteModelSettings would remove every setting
+	if unset := preset.Unset(); len(unset) > 0 {
+		if err := store.DeleteModelSettings(slug, unset...); err != nil {
+			return err
+		}
+	}
+	if err := store.SetModelSettings(slug, preset.Values); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Applied the %s sampling preset to %s.", preset.Name, slug))
+	return nil
+}
+
+// UnsetSetting removes a per-model override so the default applies again
+func UnsetSetting(store *db.Store, slug, key string) error {
+	if _, err := store.GetModelBySlug(slug); err != nil {
+		return err
+	}
+
+	setting, ok := server.LookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	if err := store.DeleteModelSettings(slug, setting.Name); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("%s reset to default for %s.", setting.Name, slug))
+	return nil
+}
+
+// ShowSettings lists every setting and the model's override, if any
+func ShowSettings(store *db.Store, slug string) error {
+	if _, err := store.GetModelBySlug(slug); err != nil {
+		return err
+	}
+
+	settings, err := store.GetModelSettings(slug)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tAPPLIES TO")
+	for _, setting := range server.Settings {
+		value, ok := settings[setting.Name]
+		if !ok {
+			value = "-"
+		}
+		appliesTo := "requests"
+		if setting.Server {
+			appliesTo = "server"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Name, value, appliesTo)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// slugSchemes are the named slug schemes and the templates they stand for
+var slugSchemes = map[string]string{
+	"author-model": "{author}-{model}",
+	"model-only":   "{model}",
+	"short-hash":   "{model}-{hash}",
+}
+
+var slugPlaceholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// SlugSchemes returns the names of the built-in slug schemes
+func SlugSchemes() []string {
+	names := make([]string, 0, len(slugSchemes))
+	for name := range slugSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSlugScheme checks that scheme names a built-in scheme or is a
+// template using only {author}, {model}, {quant}, {id} and {hash}
+func ValidateSlugScheme(scheme string) error {
+	_, err := modelSlug(scheme, "author/model", "Q4_K_M")
+	return err
+}
+
+// modelSlug returns the slug scheme gives a model. The default scheme,
+// author-model, is the one llm-cli has always used.
+func modelSlug(scheme, modelID, quant string) (string, error) {
+	if scheme == "" || scheme == "author-model" {
+		return generateSlug(modelID), nil
+	}
+	template, ok := slugSchemes[scheme]
+	if !ok {
+		if !strings.Contains(scheme, "{") {
+			return "", fmt.Errorf("unknown slug scheme %q; use one of %s or a template such as {model}-{quant}", scheme, strings.Join(SlugSchemes(), ", "))
+		}
+		template = scheme
+	}
+
+	author, name := "", modelID
+	if i := strings.Index(modelID, "/"); i >= 0 {
+		author = modelID[:i]
+		name = modelID[strings.LastIndex(modelID, "/")+1:]
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(modelID)))
+	values := map[string]string{
+		"{author}": author,
+		"{model}":  name,
+		"{quant}":  quant,
+		"{id}":     modelID,
+		"{hash}":   hex.EncodeToString(sum[:])[:6],
+	}
+
+	var unknown string
+	filled := slugPlaceholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := values[placeholder]
+		if !ok && unknown == "" {
+			unknown = placeholder
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("slug scheme %q uses %s; templates can use {author}, {model}, {quant}, {id} and {hash}", scheme, unknown)
+	}
+	slug := regexp.MustCompile(`-+`).ReplaceAllString(generateSlug(filled), "-")
+	if slug == "" {
+		return "", fmt.Errorf("slug scheme %q gives %s an empty slug", scheme, modelID)
+	}
+	return slug, nil
+}
+
+// Rename gives every model the slug scheme generates for it. Without apply
+// it only shows what would change. Renamed models keep their old slug as an
+// alias, so scripts using it keep working.
+func Rename(store *db.Store, scheme, configured string, apply bool) error {
+	if err := ValidateSlugScheme(scheme); err != nil {
+		return err
+	}
+	models, err := store.GetAllModels()
+	if err != nil {
+		return err
+	}
+
+	// Slugs taken once the renames are done
+	taken := make(map[string]bool)
+	for _, m := range models {
+		taken[m.Slug] = true
+	}
+	type rename struct{ from, to, note string }
+	var renames []rename
+	for _, m := range models {
+		slug, err := modelSlug(scheme, m.ModelID, m.Quant)
+		if err != nil {
+			return err
+		}
+		if slug == m.Slug {
+			continue
+		}
+		// Another model has the slug; tell them apart by quantization
+		if taken[slug] && m.Quant != "" {
+			slug = generateSlug(slug + "-" + m.Quant)
+		}
+		if slug == m.Slug {
+			continue
+		}
+		if taken[slug] {
+			renames = append(renames, rename{m.Slug, slug, "skipped, slug taken"})
+			continue
+		}
+		delete(taken, m.Slug)
+		taken[slug] = true
+		renames = append(renames, rename{m.Slug, slug, ""})
+	}
+
+	if len(renames) == 0 {
+		ui.PrintInfo(fmt.Sprintf("Every model already has its %s slug.", scheme))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OLD\tNEW\tNOTE")
+		for _, r := range renames {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.from, r.to, r.note)
+		}
+		w.Flush()
+	}
+
+	if apply {
+		renamed := 0
+		for _, r := range renames {
+			if r.note != "" {
+				continue
+			}
+			if err := store.UpdateModelSlug(r.from, r.to); err != nil {
+				return err
+			}
+			if err := store.AddSlugAlias(r.from, r.to); err != nil {
+				return err
+			}
+			renamed++
+		}
+		if renamed > 0 {
+			ui.PrintInfo(fmt.Sprintf("Renamed %d models; their old slugs keep working as aliases.", renamed))
+		}
+	} else if len(renames) > 0 {
+		ui.PrintInfo("Run again with --apply to rename them; the old slugs keep working as aliases.")
+	}
+	if scheme != configured && !(scheme == "author-model" && configured == "") {
+		ui.PrintInfo(fmt.Sprintf("To name models pulled from now on the same way: llm-cli config set slug_scheme %s", scheme))
+	}
+	return nil
+}
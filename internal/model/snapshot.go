@@ -0,0 +1,163 @@
+package model
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// SnapshotConfig saves a model's configuration, its stored server and
+// sampling settings and its chat template, as a new version that
+// RollbackConfig can restore
+func SnapshotConfig(store *db.Store, slug string) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	settings, err := store.GetModelSettings(slug)
+	if err != nil {
+		return err
+	}
+	template, err := chatTemplate(model.FilePath)
+	if err != nil {
+		return err
+	}
+
+	latest, err := store.GetConfigSnapshot(slug, 0)
+	if err != nil {
+		return err
+	}
+	if latest != nil && maps.Equal(latest.Settings, settings) && latest.ChatTemplate == template {
+		ui.PrintInfo(fmt.Sprintf("The configuration of %s is unchanged since version %d.", slug, latest.Version))
+		return nil
+	}
+
+	version, err := store.AddConfigSnapshot(slug, settings, template)
+	if err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Saved the configuration of %s as version %d. Restore it with 'llm-cli config rollback %s'.", slug, version, slug))
+	return nil
+}
+
+// RollbackConfig restores a model's settings and chat template to a saved
+// version, or to the latest when version is 0
+func RollbackConfig(store *db.Store, slug string, version int) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	snapshot, err := store.GetConfigSnapshot(slug, version)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		if version > 0 {
+			return fmt.Errorf("%s has no config version %d (see 'llm-cli info %s')", slug, version, slug)
+		}
+		return fmt.Errorf("%s has no saved configuration; save one with 'llm-cli config snapshot %s'", slug, slug)
+	}
+
+	current, err := store.GetModelSettings(slug)
+	if err != nil {
+		return err
+	}
+	restart := false
+	for _, setting := range server.Settings {
+		if setting.Server && current[setting.Name] != snapshot.Settings[setting.Name] {
+			restart = true
+		}
+	}
+	if err := store.ReplaceModelSettings(slug, snapshot.Settings); err != nil {
+		return err
+	}
+
+	template, err := chatTemplate(model.FilePath)
+	if err != nil {
+		return err
+	}
+	if template != snapshot.ChatTemplate {
+		f, err := gguf.Open(model.FilePath)
+		if err != nil {
+			return err
+		}
+		if snapshot.ChatTemplate == "" {
+			f.Delete("tokenizer.chat_template")
+		} else {
+			f.Set("tokenizer.chat_template", gguf.TypeString, snapshot.ChatTemplate)
+		}
+		ui.PrintInfo(fmt.Sprintf("Restoring the chat template of %s...", model.FilePath))
+		if err := f.Save(model.FilePath); err != nil {
+			return err
+		}
+		if err := rehashModel(store, model); err != nil {
+			return err
+		}
+		restart = true
+	}
+
+	if restart {
+		ui.PrintInfo(fmt.Sprintf("Rolled %s back to config version %d. Restart its server (llm-cli kill %s) to apply it.", slug, snapshot.Version, slug))
+	} else {
+		ui.PrintInfo(fmt.Sprintf("Rolled %s back to config version %d.", slug, snapshot.Version))
+	}
+	return nil
+}
+
+// chatTemplate returns the chat template in a model file, or "" if it has none
+func chatTemplate(path string) (string, error) {
+	f, err := gguf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	template, _ := f.String("tokenizer.chat_template")
+	return template, nil
+}
+
+// printConfigHistory lists the saved versions of a model's configuration
+func printConfigHistory(store *db.Store, slug string) error {
+	snapshots, err := store.GetConfigSnapshots(slug)
+	if err != nil || len(snapshots) == 0 {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Config history:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSAVED\tTEMPLATE\tSETTINGS")
+	for _, snapshot := range snapshots {
+		template := "none"
+		if snapshot.ChatTemplate != "" {
+			template = "not recognized"
+			if detected := chattmpl.Detect(snapshot.ChatTemplate); detected != nil {
+				template = detected.Name
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", snapshot.Version, snapshot.CreatedAt.Local().Format("2006-01-02 15:04"),
+			template, formatSettings(snapshot.Settings))
+	}
+	return w.Flush()
+}
+
+// formatSettings lists settings as sorted key=value pairs, or "defaults"
+// when there are none
+func formatSettings(settings map[string]string) string {
+	if len(settings) == 0 {
+		return "defaults"
+	}
+	pairs := make([]string, 0, len(settings))
+	for key, value := range settings {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
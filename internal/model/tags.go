@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// tagPattern is what a tag may look like once lowercased: a word such as
+// coding, vision or 8k, with dashes, dots or underscores inside
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+
+// Tag adds tags to the model with the given slug or, with remove, takes
+// them off it. Without tags it prints the tags the model has.
+func Tag(store *db.Store, slug string, tags []string, remove bool) error {
+	if _, err := store.GetModelBySlug(slug); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		all, err := store.GetModelTags()
+		if err != nil {
+			return err
+		}
+		if len(all[slug]) == 0 {
+			ui.PrintInfo(fmt.Sprintf("%s has no tags.", slug))
+			return nil
+		}
+		fmt.Println(strings.Join(all[slug], "\n"))
+		return nil
+	}
+
+	for i, tag := range tags {
+		tags[i] = strings.ToLower(tag)
+		if !tagPattern.MatchString(tags[i]) {
+			return fmt.Errorf("invalid tag %q: use letters, digits, and -, . or _ between them", tag)
+		}
+	}
+	for _, tag := range tags {
+		if remove {
+			removed, err := store.RemoveModelTag(slug, tag)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				ui.PrintWarn(fmt.Sprintf("%s isn't tagged %s.", slug, tag))
+				continue
+			}
+			ui.PrintInfo(fmt.Sprintf("Removed tag %s from %s.", tag, slug))
+			continue
+		}
+		if err := store.AddModelTag(slug, tag); err != nil {
+			return err
+		}
+		ui.PrintInfo(fmt.Sprintf("Tagged %s %s.", slug, tag))
+	}
+	return nil
+}
+
+// recordMetadata reads the architecture and parameter count of a model
+// from its GGUF, every shard of a split model, and saves them for ls. A
+// file that can't be read is left without them.
+func recordMetadata(store *db.Store, model db.Model) db.Model {
+	paths := gguf.ShardPaths(model.FilePath)
+	if paths == nil {
+		paths = []string{model.FilePath}
+	}
+	var arch string
+	var params uint64
+	for i, path := range paths {
+		f, err := gguf.Open(path)
+		if err != nil {
+			return model
+		}
+		if i == 0 {
+			arch, _ = f.String("general.architecture")
+		}
+		params += f.ParameterCount()
+	}
+	if err := store.SetModelMetadata(model.Slug, arch, int64(params)); err != nil {
+		ui.PrintWarn(fmt.Sprintf("Failed to save the metadata of %s: %v", model.Slug, err))
+		return model
+	}
+	model.Arch, model.Params = arch, int64(params)
+	return model
+}
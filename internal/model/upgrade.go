@@ -0,0 +1,297 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Models that can't be upgraded from Hugging Face: installed from elsewhere,
+// or converted locally from a repository without the GGUF file
+var (
+	errNotFromHF    = errors.New("not from Hugging Face")
+	errNotPublished = errors.New("file not published in the repository")
+)
+
+// upstream compares an installed model with its Hugging Face repository
+type upstream struct {
+	model   db.Model
+	info    huggingFaceModel
+	files   []string // the model's files in the repository, every shard of split models
+	changed bool     // the published files differ from the installed ones
+	movedTo string   // the repository's new name when it was renamed
+	err     error
+}
+
+// status describes the comparison for the outdated table
+func (u upstream) status() string {
+	if u.movedTo != "" {
+		return u.baseStatus() + ", moved to " + u.movedTo
+	}
+	return u.baseStatus()
+}
+
+// baseStatus describes the comparison without any rename
+func (u upstream) baseStatus() string {
+	switch {
+	case u.err == errNotFromHF, u.err == errNotPublished:
+		return u.err.Error()
+	case u.err != nil:
+		return "error: " + u.err.Error()
+	case u.changed:
+		return "update available"
+	case u.model.Revision != "" && u.model.Revision != u.info.SHA:
+		return "up to date (repository changed, file did not)"
+	}
+	return "up to date"
+}
+
+// checkUpstream fetches a model's repository and compares the checksums it
+// publishes with those recorded when the model was downloaded. Comparing
+// files rather than commits ignores commits that only touch other files.
+func checkUpstream(cfg *config.Config, model db.Model) upstream {
+	u := upstream{model: model}
+	if !validateModelID(model.ModelID) {
+		u.err = errNotFromHF
+		return u
+	}
+	if u.info, u.err = fetchModelInfo(cfg, model.ModelID); u.err != nil {
+		return u
+	}
+	// Hugging Face redirects renamed repositories, including case changes
+	if u.info.ModelID != "" && u.info.ModelID != model.ModelID {
+		u.movedTo = u.info.ModelID
+	}
+
+	u.files = gguf.ShardPaths(model.FileName)
+	if u.files == nil {
+		u.files = []string{model.FileName}
+	}
+	installed := strings.Split(model.SHA256, ",")
+	for i, file := range u.files {
+		published := u.info.checksum(file)
+		if published == "" {
+			if !u.info.hasFile(file) {
+				u.err = errNotPublished
+				return u
+			}
+			// Without a published checksum only the commit can tell
+			if model.Revision != u.info.SHA {
+				u.changed = true
+			}
+			continue
+		}
+		if i >= len(installed) || installed[i] != published {
+			u.changed = true
+		}
+	}
+	return u
+}
+
+// hasFile reports whether the repository contains fileName
+func (m huggingFaceModel) hasFile(fileName string) bool {
+	for _, sibling := range m.Siblings {
+		if sibling.RFileName == fileName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAll checks the given models against Hugging Face concurrently
+func checkAll(cfg *config.Config, models []db.Model) []upstream {
+	results := make([]upstream, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model db.Model) {
+			defer wg.Done()
+			results[i] = checkUpstream(cfg, model)
+		}(i, model)
+	}
+	wg.Wait()
+	return results
+}
+
+// shortRevision abbreviates a commit hash for display
+func shortRevision(revision string) string {
+	if revision == "" {
+		return "-"
+	}
+	if len(revision) > 7 {
+		return revision[:7]
+	}
+	return revision
+}
+
+// Outdated lists installed models whose files have changed on Hugging Face
+func Outdated(store *db.Store, cfg *config.Config) error {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		fmt.Println("No models installed.")
+		return nil
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Checking %d models on Hugging Face...", len(models)))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tMODEL\tINSTALLED\tLATEST\tSTATUS")
+	available, moved := 0, 0
+	for _, u := range checkAll(cfg, models) {
+		if u.changed {
+			available++
+		}
+		if u.movedTo != "" {
+			moved++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.model.Slug, u.model.ModelID,
+			shortRevision(u.model.Revision), shortRevision(u.info.SHA), u.status())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if available > 0 {
+		fmt.Printf("\n%d update(s) available. Run 'llm-cli upgrade <slug|all>' to download them.\n", available)
+	}
+	if moved > 0 {
+		fmt.Printf("\n%d repositories were renamed. 'llm-cli upgrade' records their new names, as does 'llm-cli relink <slug> <model_id>'.\n", moved)
+	}
+	return nil
+}
+
+// Upgrade re-downloads a model (or every model, for "all") whose files
+// have changed on Hugging Face. Cancelling ctx stops the upgrade, keeping
+// the previous version of the model being downloaded.
+func Upgrade(ctx context.Context, store *db.Store, cfg *config.Config, target string) error {
+	var models []db.Model
+	if target == "all" {
+		all, err := store.GetAllModels()
+		if err != nil {
+			return err
+		}
+		models = all
+	} else {
+		model, err := store.GetModelBySlug(target)
+		if err != nil {
+			return err
+		}
+		models = []db.Model{*model}
+	}
+
+	var failed []string
+	for _, u := range checkAll(cfg, models) {
+		if err := upgradeModel(ctx, store, cfg, u); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			ui.PrintError(fmt.Sprintf("%s: %v", u.model.Slug, err))
+			failed = append(failed, u.model.Slug)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not upgrade %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// upgradeModel replaces a model's files with the published ones if they
+// changed. The old files are kept until the new ones are downloaded and
+// verified, and put back if that fails.
+func upgradeModel(ctx context.Context, store *db.Store, cfg *config.Config, u upstream) error {
+	if u.movedTo != "" {
+		if err := relink(store, cfg, &u.model, u.movedTo); err != nil {
+			return err
+		}
+	}
+	slug := u.model.Slug
+	if u.err == errNotFromHF || u.err == errNotPublished {
+		ui.PrintInfo(fmt.Sprintf("Skipping %s: %v.", slug, u.err))
+		return nil
+	} else if u.err != nil {
+		return u.err
+	}
+	if !u.changed {
+		if u.model.Revision != u.info.SHA {
+			if err := store.SetModelRevision(slug, u.info.SHA); err != nil {
+				return err
+			}
+		}
+		ui.PrintInfo(fmt.Sprintf("%s is up to date.", slug))
+		return nil
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Upgrading %s to revision %s...", slug, shortRevision(u.info.SHA)))
+	if running, err := server.IsServerRunningForPath(store, u.model.FilePath); err == nil && running {
+		ui.PrintInfo(fmt.Sprintf("Stopping the server for %s; start it again once the upgrade is done.", slug))
+		if err := server.StopServer(store, cfg, u.model.FilePath); err != nil {
+			return err
+		}
+	}
+
+	paths := gguf.ShardPaths(u.model.FilePath)
+	if paths == nil {
+		paths = []string{u.model.FilePath}
+	}
+	for i := range paths {
+		if err := os.Rename(paths[i], paths[i]+".old"); err != nil && !os.IsNotExist(err) {
+			restoreFiles(paths[:i])
+			return fmt.Errorf("setting aside %s: %w", paths[i], err)
+		}
+	}
+
+	var totalSize int64
+	var checksums []string
+	for i, file := range u.files {
+		checksum, size, err := downloadModelFile(ctx, cfg, u.info, file, paths[i], false)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			restoreFiles(paths)
+			return fmt.Errorf("%w (the previous version was kept)", err)
+		}
+		totalSize += size
+		checksums = append(checksums, checksum)
+	}
+
+	for _, path := range paths {
+		os.Remove(path + ".old")
+	}
+	if err := store.SetModelChecksum(slug, strings.Join(checksums, ",")); err != nil {
+		return err
+	}
+	if err := store.SetModelRevision(slug, u.info.SHA); err != nil {
+		return err
+	}
+	if err := store.SetModelFileSize(slug, fmt.Sprintf("%dM", totalSize/(1024*1024))); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Upgraded %s.", slug))
+	return nil
+}
+
+// restoreFiles puts back files set aside with an .old suffix, replacing
+// anything downloaded in their place. Partial downloads are left so a
+// later upgrade can resume them.
+func restoreFiles(paths []string) {
+	for _, path := range paths {
+		if _, err := os.Stat(path + ".old"); err == nil {
+			os.Remove(path)
+			os.Rename(path+".old", path)
+		}
+	}
+}
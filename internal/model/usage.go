@@ -0,0 +1,171 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// modelUsage is the space a model takes on disk
+type modelUsage struct {
+	model db.Model
+	size  int64
+}
+
+// diskUsage measures the files of every model, largest first
+func diskUsage(store *db.Store) ([]modelUsage, error) {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving models: %w", err)
+	}
+
+	usage := make([]modelUsage, len(models))
+	for i := range models {
+		usage[i].model = models[i]
+		for _, path := range modelFiles(&models[i]) {
+			if info, err := os.Stat(path); err == nil {
+				usage[i].size += info.Size()
+			}
+		}
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].size > usage[j].size
+	})
+	return usage, nil
+}
+
+// lastUsed describes when a model was last used
+func lastUsed(model db.Model) string {
+	if !model.LastUsed.Valid {
+		return "Never"
+	}
+	return model.LastUsed.Time.Format("2006-01-02 15:04")
+}
+
+// DiskUsage prints the space each model takes, largest first, and the total
+func DiskUsage(store *db.Store, cfg *config.Config) error {
+	usage, err := diskUsage(store)
+	if err != nil {
+		return err
+	}
+	if len(usage) == 0 {
+		fmt.Println("No models installed.")
+		return nil
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tSIZE\tLAST USED\tPATH")
+	for _, u := range usage {
+		size := formatBytes(u.size)
+		if u.size == 0 {
+			size = "missing"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.model.Slug, size, lastUsed(u.model), u.model.FilePath)
+		total += u.size
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nTotal: %s in %d models\n", formatBytes(total), len(usage))
+
+	// Partial downloads, upgrade leftovers and files that were never imported
+	var dirSize int64
+	filepath.Walk(cfg.ModelsDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			dirSize += info.Size()
+		}
+		return nil
+	})
+	if other := dirSize - total; other > 0 {
+		fmt.Printf("Other files in %s: %s\n", cfg.ModelsDir, formatBytes(other))
+	}
+	return nil
+}
+
+// parseAge parses a duration such as 30d, 2w or 12h
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 30d, 2w or 12h)", value)
+	}
+	return age, nil
+}
+
+// Prune removes models not used within olderThan, such as "30d", after
+// confirmation. Models that were never used count from when they were
+// added, and models whose server is running are kept.
+func Prune(store *db.Store, cfg *config.Config, olderThan string, yes bool) error {
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+
+	usage, err := diskUsage(store)
+	if err != nil {
+		return err
+	}
+
+	var stale []modelUsage
+	var total int64
+	for _, u := range usage {
+		used := u.model.CreatedAt
+		if u.model.LastUsed.Valid {
+			used = u.model.LastUsed.Time
+		}
+		if !used.Before(cutoff) {
+			continue
+		}
+		if running, err := server.IsServerRunningForPath(store, u.model.FilePath); err == nil && running {
+			ui.PrintInfo(fmt.Sprintf("Keeping %s: its server is running.", u.model.Slug))
+			continue
+		}
+		stale = append(stale, u)
+		total += u.size
+	}
+	if len(stale) == 0 {
+		fmt.Printf("No models unused for %s.\n", olderThan)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tSIZE\tLAST USED")
+	for _, u := range stale {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", u.model.Slug, formatBytes(u.size), lastUsed(u.model))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !yes && !ui.Confirm(fmt.Sprintf("Remove these %d models, freeing %s?", len(stale), formatBytes(total))) {
+		fmt.Println("Nothing removed.")
+		return nil
+	}
+	for _, u := range stale {
+		if err := Remove(store, cfg, u.model.Slug); err != nil {
+			return err
+		}
+	}
+	ui.PrintInfo(fmt.Sprintf("Freed %s.", formatBytes(total)))
+	return nil
+}
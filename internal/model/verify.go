@@ -0,0 +1,151 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// hashFile returns the hex SHA256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// rehashModel records the checksums of a model's files after llm-cli has
+// rewritten them, so verify doesn't take the change for corruption
+func rehashModel(store *db.Store, model *db.Model) error {
+	var checksums []string
+	for _, path := range modelFiles(model) {
+		ui.PrintInfo(fmt.Sprintf("Hashing %s...", path))
+		checksum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return store.SetModelChecksum(model.Slug, strings.Join(checksums, ","))
+}
+
+// fetchChecksum looks up the SHA256 Hugging Face publishes for a model file
+func fetchChecksum(cfg *config.Config, modelID, fileName string) (string, error) {
+	info, err := fetchModelInfo(cfg, modelID)
+	if err != nil {
+		return "", err
+	}
+	return info.checksum(fileName), nil
+}
+
+// Verify re-hashes the files of the given models (all models when slugs is
+// empty) and reports any that no longer match their recorded checksum.
+// Models without a recorded checksum are checked against Hugging Face.
+func Verify(store *db.Store, cfg *config.Config, slugs []string) error {
+	var models []db.Model
+	if len(slugs) == 0 {
+		all, err := store.GetAllModels()
+		if err != nil {
+			return fmt.Errorf("retrieving models: %w", err)
+		}
+		models = all
+	} else {
+		for _, slug := range slugs {
+			model, err := store.GetModelBySlug(slug)
+			if err != nil {
+				return err
+			}
+			models = append(models, *model)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tSTATUS\tSHA256")
+	failed := 0
+
+	for i := range models {
+		status, checksums, err := verifyModel(store, cfg, &models[i])
+		if err != nil {
+			return err
+		}
+		if status != "OK" && status != "UNKNOWN" {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", models[i].Slug, status, strings.Join(checksums, ","))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d model(s) failed verification; remove and pull them again", failed)
+	}
+	return nil
+}
+
+// verifyModel hashes every file of a model and compares the results with
+// the recorded checksums, or the published ones when none are recorded
+func verifyModel(store *db.Store, cfg *config.Config, model *db.Model) (string, []string, error) {
+	paths := modelFiles(model)
+	names := gguf.ShardPaths(model.FileName)
+	if names == nil {
+		names = []string{model.FileName}
+	}
+
+	var expected []string
+	if model.SHA256 != "" {
+		expected = strings.Split(model.SHA256, ",")
+	}
+	recorded := len(expected) == len(paths)
+
+	status := "OK"
+	var actual []string
+	for i, path := range paths {
+		ui.PrintInfo(fmt.Sprintf("Hashing %s...", path))
+		checksum, err := hashFile(path)
+		if err != nil {
+			return "MISSING", actual, nil
+		}
+		actual = append(actual, checksum)
+
+		want := ""
+		if recorded {
+			want = expected[i]
+		} else if i < len(names) {
+			if want, err = fetchChecksum(cfg, model.ModelID, names[i]); err != nil {
+				ui.PrintWarn(fmt.Sprintf("Could not fetch checksum for %s: %v", model.Slug, err))
+			}
+		}
+
+		switch {
+		case want == "":
+			status = "UNKNOWN"
+		case want != checksum:
+			return "CORRUPT", actual, nil
+		}
+	}
+
+	// Remember the published checksums now that the files match them
+	if status == "OK" && !recorded {
+		if err := store.SetModelChecksum(model.Slug, strings.Join(actual, ",")); err != nil {
+			return "", nil, err
+		}
+	}
+	return status, actual, nil
+}
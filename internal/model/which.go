@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+)
+
+// modelFacts are the searchable facts about an installed model
+type modelFacts struct {
+	arch   string
+	size   string // parameter count, e.g. 3B
+	quant  string
+	fields []searchField
+}
+
+// searchField is one searchable fact, named for showing what matched
+type searchField struct {
+	name  string
+	value string
+}
+
+// Which lists the installed models matching every word of term in their
+// slug, model ID, file name, quantization, tags given with tag, or GGUF
+// metadata (name, architecture, size, fine-tune, tags), e.g. "3b qwen
+// coder q4".
+func Which(store *db.Store, term string) error {
+	words := strings.Fields(strings.ToLower(term))
+	if len(words) == 0 {
+		return fmt.Errorf("which requires a search term")
+	}
+
+	models, err := store.GetAllModels()
+	if err != nil {
+		return fmt.Errorf("retrieving models: %w", err)
+	}
+	tags, err := store.GetModelTags()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	found := 0
+	for _, model := range models {
+		facts := readModelFacts(model)
+		for _, tag := range tags[model.Slug] {
+			facts.add("tags", tag)
+		}
+		matched, ok := facts.match(words)
+		if !ok {
+			continue
+		}
+		if found == 0 {
+			fmt.Fprintln(w, "SLUG\tMODEL ID\tARCH\tSIZE\tQUANT\tMATCHED")
+		}
+		found++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", model.Slug, model.ModelID,
+			valueOr(facts.arch, "-"), valueOr(facts.size, "-"), valueOr(facts.quant, "-"), strings.Join(matched, ", "))
+	}
+	if found == 0 {
+		fmt.Printf("No installed models match %q.\n", term)
+		return nil
+	}
+	return w.Flush()
+}
+
+// readModelFacts gathers what is known about a model from the database and
+// its GGUF header. A file that can't be read is searched by name only.
+func readModelFacts(model db.Model) modelFacts {
+	facts := modelFacts{quant: model.Quant}
+	facts.add("slug", model.Slug)
+	facts.add("model id", model.ModelID)
+	facts.add("file", model.FileName)
+
+	f, err := gguf.Open(model.FilePath)
+	if err == nil {
+		facts.arch, _ = f.String("general.architecture")
+		if quant, ok := f.FileType(); ok && facts.quant == "" {
+			facts.quant = quant
+		}
+		if label, ok := f.String("general.size_label"); ok {
+			facts.size = label
+		} else if params := f.ParameterCount(); params > 0 && gguf.ShardPaths(model.FilePath) == nil {
+			facts.size = formatCount(params)
+		}
+		for _, key := range []string{"general.name", "general.basename", "general.finetune"} {
+			if value, ok := f.String(key); ok {
+				facts.add(strings.TrimPrefix(key, "general."), value)
+			}
+		}
+		if kv, ok := f.Get("general.tags"); ok {
+			if tags, ok := kv.Value.(gguf.Array); ok {
+				for _, tag := range tags.Values {
+					if s, ok := tag.(string); ok {
+						facts.add("tags", s)
+					}
+				}
+			}
+		}
+	}
+	facts.add("architecture", facts.arch)
+	facts.add("quant", facts.quant)
+	facts.add("size", facts.size)
+	// 3.1B is also found as 3B
+	if whole, _, ok := strings.Cut(facts.size, "."); ok && len(facts.size) > 0 {
+		facts.add("size", whole+facts.size[len(facts.size)-1:])
+	}
+	return facts
+}
+
+// add records a searchable fact, skipping empty ones
+func (m *modelFacts) add(name, value string) {
+	if value != "" {
+		m.fields = append(m.fields, searchField{name: name, value: strings.ToLower(value)})
+	}
+}
+
+// match reports whether every word is found in some field, and returns the
+// names of the fields that matched, in order and without repeats
+func (m *modelFacts) match(words []string) ([]string, bool) {
+	var matched []string
+	seen := make(map[string]bool)
+	for _, word := range words {
+		found := false
+		for _, field := range m.fields {
+			if !strings.Contains(field.value, word) {
+				continue
+			}
+			found = true
+			if !seen[field.name] {
+				seen[field.name] = true
+				matched = append(matched, field.name)
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return matched, true
+}
@@ -0,0 +1,87 @@
+// Package ocr extracts the text of images, such as screenshots, so it can
+// be given to a model as part of a prompt.
+package ocr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Engine extracts the text of an image file
+type Engine interface {
+	Extract(path string) (string, error)
+}
+
+// Tesseract extracts text with the tesseract command-line tool
+type Tesseract struct {
+	Command   string // tesseract binary
+	Languages string // e.g. eng or eng+deu; empty uses tesseract's default
+}
+
+// New returns the local OCR engine: tesseract, found through the TESSERACT
+// environment variable or on PATH
+func New(languages string) Engine {
+	command := os.Getenv("TESSERACT")
+	if command == "" {
+		command = "tesseract"
+	}
+	return &Tesseract{Command: command, Languages: languages}
+}
+
+// Extract returns the text tesseract reads in the image at path
+func (t *Tesseract) Extract(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("reading image: %w", err)
+	}
+	if _, err := exec.LookPath(t.Command); err != nil {
+		return "", fmt.Errorf("%s not found; install tesseract (e.g. brew install tesseract or apt install tesseract-ocr) or set TESSERACT to its path", t.Command)
+	}
+
+	args := []string{path, "stdout"}
+	if t.Languages != "" {
+		args = append(args, "-l", t.Languages)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	ui.LogCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("running tesseract: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("running tesseract: %w", err)
+	}
+
+	text := clean(stdout.String())
+	if text == "" {
+		return "", fmt.Errorf("no text found in %s", path)
+	}
+	return text, nil
+}
+
+// clean drops the form feed tesseract ends pages with, trailing spaces and
+// runs of blank lines
+func clean(text string) string {
+	text = strings.ReplaceAll(text, "\f", "\n")
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if !blank && len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,153 @@
+// Package post cleans up model output with composable filters, such as
+// removing reasoning blocks or extracting the first code block.
+package post
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// Filter transforms model output
+type Filter struct {
+	Name        string
+	Description string
+	apply       func(text string) (string, error)
+}
+
+// Filters lists the built-in filters
+var Filters = []Filter{
+	{"strip-think", "remove <think>…</think> reasoning blocks", StripThink},
+	{"trim", "trim surrounding whitespace", func(text string) (string, error) { return strings.TrimSpace(text), nil }},
+	{"code", "keep only the first fenced code block", ExtractCode},
+	{"json", "keep only the first JSON object or array", ExtractJSON},
+}
+
+// Pipeline is a sequence of filters applied in order
+type Pipeline []Filter
+
+// Apply runs text through every filter in the pipeline
+func (p Pipeline) Apply(text string) (string, error) {
+	for _, filter := range p {
+		var err error
+		if text, err = filter.apply(text); err != nil {
+			return "", fmt.Errorf("%s: %w", filter.Name, err)
+		}
+	}
+	return text, nil
+}
+
+// Parse builds a pipeline from a comma-separated list of filter names.
+// Names that aren't built-in filters are looked up in named, which maps
+// pipeline names to specs of their own, e.g. "clean": "strip-think,trim".
+func Parse(spec string, named map[string]string) (Pipeline, error) {
+	return parse(spec, named, map[string]bool{})
+}
+
+func parse(spec string, named map[string]string, expanding map[string]bool) (Pipeline, error) {
+	var pipeline Pipeline
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if filter, ok := lookup(name); ok {
+			pipeline = append(pipeline, filter)
+			continue
+		}
+
+		sub, ok := named[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown output filter %q (available: %s)", name, names())
+		}
+		if expanding[name] {
+			return nil, fmt.Errorf("output pipeline %q refers to itself", name)
+		}
+		expanding[name] = true
+		filters, err := parse(sub, named, expanding)
+		if err != nil {
+			return nil, err
+		}
+		delete(expanding, name)
+		pipeline = append(pipeline, filters...)
+	}
+	return pipeline, nil
+}
+
+// ForCommand returns the pipeline for a command: spec if given, otherwise
+// the one configured for the command in the config file's "post" section
+func ForCommand(cfg *config.Config, command, spec string) (Pipeline, error) {
+	if spec == "" {
+		spec = cfg.Post[command]
+	}
+	return Parse(spec, cfg.Post)
+}
+
+func lookup(name string) (Filter, bool) {
+	for _, filter := range Filters {
+		if filter.Name == name {
+			return filter, true
+		}
+	}
+	return Filter{}, false
+}
+
+func names() string {
+	list := make([]string, len(Filters))
+	for i, filter := range Filters {
+		list[i] = filter.Name
+	}
+	return strings.Join(list, ", ")
+}
+
+var (
+	thinkBlock = regexp.MustCompile(`(?s)<(think|thinking|reasoning)>.*?</(think|thinking|reasoning)>`)
+	codeBlock  = regexp.MustCompile("(?s)```[^\\n`]*\\n(.*?)```")
+)
+
+// StripThink removes reasoning blocks. An unterminated block, from output
+// cut off while the model was still reasoning, is removed to the end.
+func StripThink(text string) (string, error) {
+	text = thinkBlock.ReplaceAllString(text, "")
+	for _, tag := range []string{"<think>", "<thinking>", "<reasoning>"} {
+		if i := strings.Index(text, tag); i >= 0 {
+			text = text[:i]
+		}
+	}
+	// Some templates open the block in the prompt, leaving only the close tag
+	for _, tag := range []string{"</think>", "</thinking>", "</reasoning>"} {
+		if i := strings.Index(text, tag); i >= 0 {
+			text = text[i+len(tag):]
+		}
+	}
+	return strings.TrimLeft(text, "\n"), nil
+}
+
+// ExtractCode returns the contents of the first fenced code block
+func ExtractCode(text string) (string, error) {
+	match := codeBlock.FindStringSubmatch(text)
+	if match == nil {
+		return "", fmt.Errorf("no code block in output")
+	}
+	return match[1], nil
+}
+
+// ExtractJSON returns the first JSON object or array in text that parses
+func ExtractJSON(text string) (string, error) {
+	for i := 0; i < len(text); i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text[i:]))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", fmt.Errorf("no JSON object or array in output")
+}
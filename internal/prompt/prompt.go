@@ -0,0 +1,238 @@
+// Package prompt keeps a library of reusable prompt templates in the
+// database. Templates are Go text/template source whose fields, such as
+// {{.input}}, are filled in with --var when a prompt is run.
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// validName matches the names prompts can be saved under
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Save stores a prompt template under name, replacing any saved before
+func Save(store *db.Store, name, text string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid prompt name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("prompt %s is empty; give the template as an argument or on stdin", name)
+	}
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return err
+	}
+	existing, err := store.GetPrompt(name)
+	if err != nil {
+		return err
+	}
+	if err := store.SavePrompt(name, text); err != nil {
+		return err
+	}
+
+	verb := "Saved"
+	if existing != nil {
+		verb = "Updated"
+	}
+	vars := variables(tmpl)
+	if len(vars) == 0 {
+		ui.PrintInfo(fmt.Sprintf("%s prompt %s. It has no variables.", verb, name))
+	} else {
+		ui.PrintInfo(fmt.Sprintf("%s prompt %s with variables: %s.", verb, name, strings.Join(vars, ", ")))
+	}
+	return nil
+}
+
+// List prints the saved prompts with their variables and the start of
+// their templates
+func List(store *db.Store) error {
+	prompts, err := store.GetPrompts()
+	if err != nil {
+		return err
+	}
+	if len(prompts) == 0 {
+		fmt.Println("No saved prompts. Save one with 'llm-cli prompt save <name> \"template with {{.input}}\"'.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVARIABLES\tUPDATED\tTEMPLATE")
+	for _, p := range prompts {
+		vars := "-"
+		if tmpl, err := parseTemplate(p.Name, p.Template); err == nil && len(variables(tmpl)) > 0 {
+			vars = strings.Join(variables(tmpl), ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, vars, p.UpdatedAt.Local().Format("2006-01-02 15:04"), preview(p.Template, 50))
+	}
+	return w.Flush()
+}
+
+// Show prints a saved prompt's template
+func Show(store *db.Store, name string) error {
+	p, err := get(store, name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(p.Template)
+	return nil
+}
+
+// Remove deletes a saved prompt
+func Remove(store *db.Store, name string) error {
+	removed, err := store.RemovePrompt(name)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("no prompt named %s; 'llm-cli prompt ls' lists them", name)
+	}
+	ui.PrintInfo(fmt.Sprintf("Removed prompt %s.", name))
+	return nil
+}
+
+// Render fills in a saved prompt's template with vars. Every variable the
+// template uses must be given, and none it doesn't, which is likely a typo.
+func Render(store *db.Store, name string, vars map[string]string) (string, error) {
+	p, err := get(store, name)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := parseTemplate(name, p.Template)
+	if err != nil {
+		return "", err
+	}
+	used := variables(tmpl)
+	var missing []string
+	for _, v := range used {
+		if _, ok := vars[v]; !ok {
+			missing = append(missing, fmt.Sprintf("--var %s=...", v))
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("prompt %s needs %s", name, strings.Join(missing, " "))
+	}
+	for v := range vars {
+		if !slices.Contains(used, v) {
+			return "", fmt.Errorf("prompt %s has no {{.%s}} to fill in; 'llm-cli prompt show %s' prints it", name, v, name)
+		}
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("filling in prompt %s: %w", name, err)
+	}
+	return out.String(), nil
+}
+
+// ParseVars reads --var values given as key=value
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --var value: %s (use name=value)", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// get returns a saved prompt, or an error naming the missing prompt
+func get(store *db.Store, name string) (*db.Prompt, error) {
+	p, err := store.GetPrompt(name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("no prompt named %s; 'llm-cli prompt ls' lists them", name)
+	}
+	return p, nil
+}
+
+// parseTemplate parses a prompt's template, failing on fields that aren't
+// given rather than printing "<no value>"
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// variables returns the names of the top-level fields a template uses, such
+// as input for {{.input}}, sorted
+func variables(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			seen[n.Ident[0]] = true
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			// Fields inside a range or with refer to its value, not the vars
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// preview returns the first line of text, cut to at most n characters
+func preview(text string, n int) string {
+	line, _, more := strings.Cut(strings.TrimSpace(text), "\n")
+	runes := []rune(line)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	if more {
+		return line + " …"
+	}
+	return line
+}
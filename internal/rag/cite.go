@@ -0,0 +1,213 @@
+// Package rag answers questions from retrieved document chunks and ties
+// the answer back to its sources with [n]-style citations.
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Chunk is a piece of a source document retrieved for a question
+type Chunk struct {
+	Index     string  `json:"index,omitempty"` // index the chunk was retrieved from, when searching several
+	Path      string  `json:"path"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Text      string  `json:"text"`
+	Score     float64 `json:"score"`
+}
+
+// Location returns the chunk's file and line range
+func (c Chunk) Location() string {
+	if c.StartLine == 0 {
+		return c.Path
+	}
+	if c.EndLine <= c.StartLine {
+		return fmt.Sprintf("%s:%d", c.Path, c.StartLine)
+	}
+	return fmt.Sprintf("%s:%d-%d", c.Path, c.StartLine, c.EndLine)
+}
+
+// Completer returns the model's completion of a prompt
+type Completer func(prompt string) (string, error)
+
+// Answer is a model answer with the chunks it cites
+type Answer struct {
+	Text  string
+	Cited []int // 1-based chunk numbers in order of first citation
+}
+
+// MaxCitationRetries limits re-prompts when citations are required
+const MaxCitationRetries = 2
+
+// CitationReminder asks again for an answer that cited none of its sources
+const CitationReminder = "That answer did not cite its sources. Answer again, citing the numbered sources like [1] after each claim."
+
+// attachThreshold is the share of a sentence's words that must appear in
+// a chunk for the chunk to be cited automatically
+const attachThreshold = 0.6
+
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Ask answers question from chunks. Sentences the model left uncited are
+// matched to the chunk they draw on; with requireCitations the model is
+// re-prompted when its answer cites nothing.
+func Ask(complete Completer, question string, chunks []Chunk, requireCitations bool) (*Answer, error) {
+	prompt := Prompt(question, chunks)
+	text, err := complete(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	for retry := 0; requireCitations && retry < MaxCitationRetries && len(Citations(text, len(chunks))) == 0; retry++ {
+		text, err = complete(prompt + strings.TrimSpace(text) + "\n\n" + CitationReminder + "\n\nAnswer:")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Cite(text, chunks, requireCitations)
+}
+
+// Cite finds the chunks an answer cites, matching its sentences to the
+// chunks they draw on when it cites none itself. With requireCitations an
+// answer that cites nothing even then is an error.
+func Cite(text string, chunks []Chunk, requireCitations bool) (*Answer, error) {
+	text = strings.TrimSpace(text)
+	if len(Citations(text, len(chunks))) == 0 {
+		text = Attach(text, chunks)
+	}
+	answer := &Answer{Text: text, Cited: Citations(text, len(chunks))}
+	if requireCitations && len(answer.Cited) == 0 {
+		return answer, fmt.Errorf("the model did not cite any sources after %d attempts", MaxCitationRetries+1)
+	}
+	return answer, nil
+}
+
+// Prompt numbers the chunks and asks the model to answer from them with citations
+func Prompt(question string, chunks []Chunk) string {
+	var b strings.Builder
+	b.WriteString("Answer the question using only the numbered sources below. ")
+	b.WriteString("Cite the sources you use with their number in square brackets, like [1] or [2, 3], right after each claim. ")
+	b.WriteString("If the sources don't contain the answer, say so.\n\n")
+	for i, chunk := range chunks {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, chunk.Location(), strings.TrimSpace(chunk.Text))
+	}
+	fmt.Fprintf(&b, "Question: %s\n\nAnswer:", question)
+	return b.String()
+}
+
+// Citations returns the chunk numbers cited in text in order of first use,
+// ignoring numbers that don't refer to one of count chunks
+func Citations(text string, count int) []int {
+	var cited []int
+	seen := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			var n int
+			if _, err := fmt.Sscan(strings.TrimSpace(part), &n); err != nil || n < 1 || n > count || seen[n] {
+				continue
+			}
+			seen[n] = true
+			cited = append(cited, n)
+		}
+	}
+	return cited
+}
+
+// Attach appends a citation to each sentence of text whose words mostly
+// come from a single chunk
+func Attach(text string, chunks []Chunk) string {
+	chunkWords := make([]map[string]bool, len(chunks))
+	for i, chunk := range chunks {
+		chunkWords[i] = wordSet(chunk.Text)
+	}
+
+	sentences := splitSentences(text)
+	for i, sentence := range sentences {
+		words := wordSet(sentence)
+		if len(words) < 4 || citationPattern.MatchString(sentence) {
+			continue
+		}
+
+		best, bestShare := -1, 0.0
+		for j, set := range chunkWords {
+			found := 0
+			for word := range words {
+				if set[word] {
+					found++
+				}
+			}
+			if share := float64(found) / float64(len(words)); share > bestShare {
+				best, bestShare = j, share
+			}
+		}
+		if best >= 0 && bestShare >= attachThreshold {
+			sentences[i] = insertCitation(sentence, best+1)
+		}
+	}
+	return strings.Join(sentences, "")
+}
+
+// Footer lists the cited chunks with their file paths and lines
+func Footer(chunks []Chunk, cited []int) string {
+	if len(cited) == 0 {
+		return ""
+	}
+
+	numbers := append([]int(nil), cited...)
+	sort.Ints(numbers)
+
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	for _, n := range numbers {
+		chunk := chunks[n-1]
+		if chunk.Index != "" {
+			fmt.Fprintf(&b, "  [%d] %s: %s\n", n, chunk.Index, chunk.Location())
+		} else {
+			fmt.Fprintf(&b, "  [%d] %s\n", n, chunk.Location())
+		}
+	}
+	return b.String()
+}
+
+// splitSentences splits text after sentence-ending punctuation and line
+// breaks, keeping the separators so joining the parts restores text
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		end := text[i] == '\n' ||
+			(strings.IndexByte(".!?", text[i]) >= 0 && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n'))
+		if end {
+			sentences = append(sentences, text[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// insertCitation places [n] before a sentence's final punctuation
+func insertCitation(sentence string, n int) string {
+	trimmed := strings.TrimRight(sentence, " \n")
+	trailing := sentence[len(trimmed):]
+	body := strings.TrimRight(trimmed, ".!?")
+	return fmt.Sprintf("%s [%d]%s%s", body, n, trimmed[len(body):], trailing)
+}
+
+// wordSet returns the lowercased words of text longer than two letters
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if len(word) > 2 {
+			words[word] = true
+		}
+	}
+	return words
+}
@@ -0,0 +1,62 @@
+package rag
+
+import "sort"
+
+// IndexResults are the chunks one index returned for a query
+type IndexResults struct {
+	Index      string
+	EmbedModel string // embedding model the index was built with
+	Chunks     []Chunk
+}
+
+// Merge combines the results of several indexes into a single ranking of
+// at most top chunks, labelling each with its index. Similarity scores are
+// only comparable between indexes built with the same embedding model;
+// otherwise each index's scores are first rescaled so its best match scores
+// 1 and its worst 0. An index whose matches all score the same has no range
+// to rescale, so its scores are kept, clamped to 0-1, rather than all
+// becoming the best match.
+func Merge(results []IndexResults, top int) []Chunk {
+	rescale := false
+	for _, r := range results[min(1, len(results)):] {
+		if r.EmbedModel != results[0].EmbedModel {
+			rescale = true
+			break
+		}
+	}
+
+	var merged []Chunk
+	for _, r := range results {
+		lo, hi := scoreRange(r.Chunks)
+		for _, chunk := range r.Chunks {
+			chunk.Index = r.Index
+			if rescale {
+				if hi > lo {
+					chunk.Score = (chunk.Score - lo) / (hi - lo)
+				} else {
+					chunk.Score = max(0, min(1, chunk.Score))
+				}
+			}
+			merged = append(merged, chunk)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	if top > 0 && len(merged) > top {
+		merged = merged[:top]
+	}
+	return merged
+}
+
+// scoreRange returns the lowest and highest score among chunks
+func scoreRange(chunks []Chunk) (lo, hi float64) {
+	for i, chunk := range chunks {
+		if i == 0 || chunk.Score < lo {
+			lo = chunk.Score
+		}
+		if i == 0 || chunk.Score > hi {
+			hi = chunk.Score
+		}
+	}
+	return lo, hi
+}
@@ -0,0 +1,306 @@
+// Package record saves the requests llm-cli makes to model servers, with
+// their responses, to a file that replay can send again later. Each
+// exchange is written as the HTTP request and response themselves, after
+// a ### line giving when it was made and how long it took:
+//
+//	### 2026-01-02T15:04:05Z 1.234s
+//	POST http://localhost:8080/completion HTTP/1.1
+//	Content-Type: application/json
+//	Content-Length: 33
+//
+//	{"prompt":"Hello","n_predict":16}
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/json
+//	Content-Length: 19
+//
+//	{"content":" Hi!"}
+//
+// Request headers other than the content type are left out, since they can
+// hold the backend's token.
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange is a recorded request and the response to it
+type Exchange struct {
+	Time     time.Time
+	Took     time.Duration // until the whole response was read
+	Request  *http.Request // Body is nil; see RequestBody
+	Response *http.Response
+	// RequestBody and ResponseBody are the bodies as sent and received
+	RequestBody, ResponseBody []byte
+}
+
+// recorder writes exchanges to the file being recorded to
+type recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	count int
+	err   error // the first write that failed
+}
+
+// active is the recording in progress, if any
+var active struct {
+	sync.Mutex
+	rec *recorder
+}
+
+// Start records every exchange made through a Transport to path, replacing
+// the file, until Stop
+func Start(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating recording: %w", err)
+	}
+	active.Lock()
+	defer active.Unlock()
+	active.rec = &recorder{file: file}
+	return nil
+}
+
+// Stop ends the recording and returns how many exchanges were recorded.
+// Responses still being read then are left out.
+func Stop() (int, error) {
+	active.Lock()
+	rec := active.rec
+	active.rec = nil
+	active.Unlock()
+	if rec == nil {
+		return 0, nil
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	err := rec.file.Close()
+	if rec.err != nil {
+		err = rec.err
+	}
+	rec.file = nil
+	if err != nil {
+		return rec.count, fmt.Errorf("writing recording: %w", err)
+	}
+	return rec.count, nil
+}
+
+// current returns the recording in progress, or nil
+func current() *recorder {
+	active.Lock()
+	defer active.Unlock()
+	return active.rec
+}
+
+// Transport wraps an HTTP transport to record each request and its
+// response while a recording is in progress. Requests that fail without a
+// response aren't recorded.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := current()
+	if rec == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	exchange := &Exchange{Time: start, Request: req, Response: resp, RequestBody: body}
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	resp.Body = &teeBody{body: resp.Body, drain: !stream, done: func(received []byte) {
+		exchange.Took = time.Since(start)
+		exchange.ResponseBody = received
+		rec.write(exchange)
+	}}
+	return resp, nil
+}
+
+// teeBody keeps a copy of a response body as it is read, and hands it to
+// done once it has been read to the end or closed
+type teeBody struct {
+	body  io.ReadCloser
+	buf   bytes.Buffer
+	drain bool // read what is left on Close, which a stream may never finish
+	once  sync.Once
+	done  func([]byte)
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf.Bytes()) })
+	}
+	return n, err
+}
+
+func (b *teeBody) Close() error {
+	b.once.Do(func() {
+		if b.drain {
+			io.Copy(&b.buf, b.body)
+		}
+		b.done(b.buf.Bytes())
+	})
+	return b.body.Close()
+}
+
+// write appends an exchange to the recording
+func (r *recorder) write(e *Exchange) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "### %s %s\n", e.Time.UTC().Format(time.RFC3339), e.Took.Round(time.Millisecond))
+
+	fmt.Fprintf(&out, "%s %s HTTP/1.1\n", e.Request.Method, e.Request.URL.String())
+	if contentType := e.Request.Header.Get("Content-Type"); contentType != "" {
+		fmt.Fprintf(&out, "Content-Type: %s\n", contentType)
+	}
+	fmt.Fprintf(&out, "Content-Length: %d\n\n", len(e.RequestBody))
+	writeBody(&out, e.RequestBody)
+
+	status := e.Response.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", e.Response.StatusCode, http.StatusText(e.Response.StatusCode))
+	}
+	fmt.Fprintf(&out, "HTTP/1.1 %s\n", status)
+	names := make([]string, 0, len(e.Response.Header))
+	for name := range e.Response.Header {
+		switch name {
+		case "Content-Length", "Transfer-Encoding", "Set-Cookie":
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range e.Response.Header[name] {
+			fmt.Fprintf(&out, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintf(&out, "Content-Length: %d\n\n", len(e.ResponseBody))
+	writeBody(&out, e.ResponseBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil || r.err != nil {
+		return
+	}
+	if _, err := r.file.Write(out.Bytes()); err != nil {
+		r.err = err
+		return
+	}
+	r.count++
+}
+
+// writeBody writes a request or response body followed by a blank line,
+// without a line break of its own to end it
+func writeBody(out *bytes.Buffer, body []byte) {
+	if len(body) > 0 {
+		out.Write(body)
+		out.WriteString("\n\n")
+	}
+}
+
+// Read returns the exchanges recorded in the file at path, in the order
+// they finished
+func Read(path string) ([]Exchange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading recording: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var exchanges []Exchange
+	for n := 1; ; n++ {
+		var e Exchange
+		comment, err := skipBlank(r)
+		if err == io.EOF {
+			return exchanges, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading recording: %w", err)
+		}
+		if fields := strings.Fields(strings.TrimPrefix(comment, "###")); len(fields) == 2 {
+			e.Time, _ = time.Parse(time.RFC3339, fields[0])
+			e.Took, _ = time.ParseDuration(fields[1])
+		}
+
+		if e.Request, err = http.ReadRequest(r); err != nil {
+			return nil, fmt.Errorf("%s: request %d: %w", path, n, err)
+		}
+		if e.RequestBody, err = io.ReadAll(e.Request.Body); err != nil {
+			return nil, fmt.Errorf("%s: request %d: %w", path, n, err)
+		}
+		e.Request.Body = nil
+
+		if _, err := skipBlank(r); err != nil {
+			return nil, fmt.Errorf("%s: response %d: %w", path, n, unexpectedEOF(err))
+		}
+		if e.Response, err = http.ReadResponse(r, e.Request); err != nil {
+			return nil, fmt.Errorf("%s: response %d: %w", path, n, err)
+		}
+		if e.ResponseBody, err = io.ReadAll(e.Response.Body); err != nil {
+			return nil, fmt.Errorf("%s: response %d: %w", path, n, err)
+		}
+		e.Response.Body = nil
+		exchanges = append(exchanges, e)
+	}
+}
+
+// skipBlank skips blank lines and ### lines up to the next request or
+// response, returning the last ### line skipped
+func skipBlank(r *bufio.Reader) (string, error) {
+	var comment string
+	for {
+		next, err := r.Peek(1)
+		if err != nil {
+			return comment, err
+		}
+		if next[0] != '\n' && next[0] != '\r' && next[0] != '#' {
+			return comment, nil
+		}
+		line, err := r.ReadString('\n')
+		if strings.HasPrefix(line, "###") {
+			comment = strings.TrimSpace(line)
+		}
+		if err != nil {
+			return comment, err
+		}
+	}
+}
+
+// unexpectedEOF turns the end of the file, where more was expected, into
+// io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
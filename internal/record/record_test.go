@@ -0,0 +1,191 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	request := `{"prompt":"Hello","n_predict":16}`
+	response := `{"content":" Hi!"}`
+	path := writeFile(t, fmt.Sprintf(`### 2026-01-02T15:04:05Z 1.234s
+POST http://localhost:8080/completion HTTP/1.1
+Content-Type: application/json
+Content-Length: %d
+
+%s
+
+HTTP/1.1 200 OK
+Content-Type: application/json
+Content-Length: %d
+
+%s
+
+### 2026-01-02T15:04:07Z 20ms
+GET http://localhost:8080/health HTTP/1.1
+Content-Length: 0
+
+HTTP/1.1 503 Service Unavailable
+Content-Length: 0
+
+`, len(request), request, len(response), response))
+
+	exchanges, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("Read returned %d exchanges, want 2", len(exchanges))
+	}
+
+	first := exchanges[0]
+	if want := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC); !first.Time.Equal(want) {
+		t.Errorf("Time = %v, want %v", first.Time, want)
+	}
+	if first.Took != 1234*time.Millisecond {
+		t.Errorf("Took = %v, want 1.234s", first.Took)
+	}
+	if first.Request.Method != http.MethodPost || first.Request.URL.String() != "http://localhost:8080/completion" {
+		t.Errorf("request = %s %s, want POST http://localhost:8080/completion", first.Request.Method, first.Request.URL)
+	}
+	if string(first.RequestBody) != request {
+		t.Errorf("RequestBody = %q, want %q", first.RequestBody, request)
+	}
+	if first.Response.StatusCode != http.StatusOK || first.Response.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("response = %s %q, want 200 OK application/json", first.Response.Status, first.Response.Header.Get("Content-Type"))
+	}
+	if string(first.ResponseBody) != response {
+		t.Errorf("ResponseBody = %q, want %q", first.ResponseBody, response)
+	}
+
+	second := exchanges[1]
+	if second.Request.Method != http.MethodGet || second.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second exchange = %s → %s, want GET → 503", second.Request.Method, second.Response.Status)
+	}
+	if len(second.RequestBody) != 0 || len(second.ResponseBody) != 0 {
+		t.Errorf("second exchange has bodies %q and %q, want none", second.RequestBody, second.ResponseBody)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing response", "GET http://localhost:8080/health HTTP/1.1\n\n", "response 1: unexpected EOF"},
+		{"not a request", "hello\n", "request 1"},
+		{"short body", "POST http://localhost:8080/completion HTTP/1.1\nContent-Length: 10\n\n{}\n", "request 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(writeFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.http")); err == nil {
+		t.Error("Read of a missing file succeeded")
+	}
+}
+
+func TestReadEmpty(t *testing.T) {
+	exchanges, err := Read(writeFile(t, "\n\n"))
+	if err != nil || len(exchanges) != 0 {
+		t.Errorf("Read = %d exchanges, %v; want none", len(exchanges), err)
+	}
+}
+
+// TestRecordAndRead records exchanges through a Transport and reads them
+// back as they were made
+func TestRecordAndRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"content\":\"a\"}\n\ndata: {\"content\":\"b\"}\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		fmt.Fprintf(w, `{"echo":%s}`, body)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "session.http")
+	if err := Start(path); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/completion", strings.NewReader(`{"prompt":"Hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer backend-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	// Closed without being read, the body is still recorded in full
+	resp.Body.Close()
+
+	resp, err = client.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	count, err := Stop()
+	if err != nil || count != 2 {
+		t.Fatalf("Stop = %d, %v; want 2 exchanges", count, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"backend-token", "secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the recording holds %q:\n%s", secret, data)
+		}
+	}
+
+	exchanges, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("Read returned %d exchanges, want 2", len(exchanges))
+	}
+	if got := string(exchanges[0].RequestBody); got != `{"prompt":"Hi"}` {
+		t.Errorf("RequestBody = %q", got)
+	}
+	if got := string(exchanges[0].ResponseBody); got != `{"echo":{"prompt":"Hi"}}` {
+		t.Errorf("ResponseBody = %q", got)
+	}
+	if got := string(exchanges[1].ResponseBody); got != "data: {\"content\":\"a\"}\n\ndata: {\"content\":\"b\"}\n\n" {
+		t.Errorf("streamed ResponseBody = %q", got)
+	}
+	if exchanges[1].Request.URL.Path != "/stream" {
+		t.Errorf("second request went to %s, want /stream", exchanges[1].Request.URL)
+	}
+}
+
+// writeFile writes content to a recording in a temporary directory
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "recording.http")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,274 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Role colors and markers
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorCyan   = "\033[0;36m"
+	colorGreen  = "\033[0;32m"
+	colorYellow = "\033[0;33m"
+	colorGray   = "\033[0;90m"
+)
+
+// roleStyle is how a speaker is labelled in a transcript
+type roleStyle struct {
+	marker string
+	label  string
+	color  string
+}
+
+var roleStyles = map[string]roleStyle{
+	"user":      {"🧑", "You", colorGreen},
+	"assistant": {"🤖", "Assistant", colorCyan},
+	"system":    {"⚙️", "System", colorYellow},
+}
+
+// defaultWidth is used when the terminal width can't be determined
+const defaultWidth = 80
+
+// Options controls how a transcript is rendered
+type Options struct {
+	Width   int  // wrap column; 0 uses the terminal width
+	Compact bool // no separators or blank lines, role labels inline
+}
+
+// Transcript renders a conversation turn by turn
+type Transcript struct {
+	w     io.Writer
+	opts  Options
+	turns int
+}
+
+// NewTranscript creates a transcript writing to w
+func NewTranscript(w io.Writer, opts Options) *Transcript {
+	if opts.Width <= 0 {
+		opts.Width = TerminalWidth()
+	}
+	return &Transcript{w: w, opts: opts}
+}
+
+// StartTurn begins a new exchange, separated from the previous one unless
+// compact or in accessibility mode
+func (t *Transcript) StartTurn() {
+	if t.turns > 0 && !t.opts.Compact && !ui.Accessible() {
+		fmt.Fprintf(t.w, "%s%s%s\n", colorGray, strings.Repeat("─", t.opts.Width), colorReset)
+	}
+	t.turns++
+}
+
+// Label prints the label of the speaker whose text follows and returns
+// the column that text starts at
+func (t *Transcript) Label(role string) int {
+	return t.LabelNote(role, "")
+}
+
+// LabelNote is Label with a short note after the speaker's name, such as
+// how much context is left, or none if note is ""
+func (t *Transcript) LabelNote(role, note string) int {
+	style, ok := roleStyles[role]
+	if !ok {
+		style = roleStyle{"•", role, colorBold}
+	}
+
+	// Screen readers would read out the marker's name before every message
+	if ui.Accessible() {
+		label := style.label
+		if note != "" {
+			label += " (" + note + ")"
+		}
+		if t.opts.Compact {
+			fmt.Fprintf(t.w, "%s%s: %s", style.color, label, colorReset)
+			return len(label) + 2
+		}
+		fmt.Fprintf(t.w, "%s%s%s\n", style.color+colorBold, label, colorReset)
+		return 0
+	}
+
+	if t.opts.Compact {
+		label := style.marker + " " + style.label
+		if note != "" {
+			label += " (" + note + ")"
+		}
+		label += ": "
+		fmt.Fprintf(t.w, "%s%s%s", style.color, label, colorReset)
+		return displayWidth(label)
+	}
+
+	fmt.Fprintf(t.w, "%s%s %s%s", style.color+colorBold, style.marker, style.label, colorReset)
+	if note != "" {
+		fmt.Fprintf(t.w, "  %s%s%s", colorGray, note, colorReset)
+	}
+	fmt.Fprintln(t.w)
+	return 0
+}
+
+// Role prints the label of the speaker whose text follows and returns a
+// writer that wraps that text to the transcript width. The caller must
+// Close the writer when the message is complete.
+func (t *Transcript) Role(role string) *Wrapper {
+	return NewWrapper(t.w, t.opts.Width, t.Label(role))
+}
+
+// Message prints a complete message from role
+func (t *Transcript) Message(role, text string) error {
+	wrapper := t.Role(role)
+	if _, err := io.WriteString(wrapper, text); err != nil {
+		return err
+	}
+	return wrapper.Close()
+}
+
+// Note prints a dimmed line of information about the conversation, such as
+// the statistics of a turn
+func (t *Transcript) Note(text string) {
+	fmt.Fprintf(t.w, "%s%s%s\n", colorGray, text, colorReset)
+}
+
+// Wrapper is a writer that word-wraps streamed text to a width. Words are
+// held back until they are complete so they are never split across lines,
+// except for words longer than a whole line.
+type Wrapper struct {
+	w       io.Writer
+	width   int
+	col     int
+	spaces  int
+	word    []rune
+	partial []byte // incomplete UTF-8 sequence held until the next write
+}
+
+// NewWrapper creates a Wrapper writing to w, starting at column col
+func NewWrapper(w io.Writer, width, col int) *Wrapper {
+	return &Wrapper{w: w, width: width, col: col}
+}
+
+// Write wraps p and writes every complete word
+func (w *Wrapper) Write(p []byte) (int, error) {
+	// A multi-byte character may be split across writes
+	data := append(w.partial, p...)
+	w.partial = nil
+
+	var out strings.Builder
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && !utf8.FullRune(data) {
+			w.partial = append([]byte(nil), data...)
+			break
+		}
+		data = data[size:]
+
+		switch r {
+		case '\n':
+			w.flushWord(&out)
+			out.WriteByte('\n')
+			w.col, w.spaces = 0, 0
+		case ' ':
+			w.flushWord(&out)
+			w.spaces++
+		default:
+			w.word = append(w.word, r)
+			if len(w.word) >= w.width {
+				w.flushWord(&out)
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w.w, out.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes any pending word and ends the line
+func (w *Wrapper) Close() error {
+	var out strings.Builder
+	w.flushWord(&out)
+	if w.col > 0 {
+		out.WriteByte('\n')
+	}
+	w.col, w.spaces = 0, 0
+	_, err := io.WriteString(w.w, out.String())
+	return err
+}
+
+// Style writes a terminal escape code, such as a color, after any pending
+// word without counting it toward the line width
+func (w *Wrapper) Style(code string) error {
+	var out strings.Builder
+	w.flushWord(&out)
+	out.WriteString(code)
+	_, err := io.WriteString(w.w, out.String())
+	return err
+}
+
+// flushWord places the pending word on the current line, or on a new one
+// if it doesn't fit
+func (w *Wrapper) flushWord(out *strings.Builder) {
+	if len(w.word) == 0 {
+		return
+	}
+
+	// Spaces at a wrap point are dropped
+	if w.col > 0 && w.col+w.spaces+len(w.word) > w.width {
+		out.WriteByte('\n')
+		w.col, w.spaces = 0, 0
+	}
+
+	out.WriteString(strings.Repeat(" ", w.spaces))
+	out.WriteString(string(w.word))
+	w.col += w.spaces + len(w.word)
+	w.spaces = 0
+	w.word = w.word[:0]
+}
+
+// TerminalWidth returns the width of the terminal, from $COLUMNS or the
+// terminal itself, falling back to 80 columns
+func TerminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	if err != nil {
+		return defaultWidth
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return defaultWidth
+	}
+	if columns, err := strconv.Atoi(fields[1]); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultWidth
+}
+
+// displayWidth approximates the number of columns text occupies, counting
+// emoji as two columns
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case r == 0xFE0F:
+			// variation selector, no width of its own
+		case r >= 0x1F000:
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,159 @@
+package render
+
+import (
+	"io"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// ThinkOpen and ThinkClose delimit the reasoning of DeepSeek-R1-style models
+const (
+	ThinkOpen  = "<think>"
+	ThinkClose = "</think>"
+)
+
+// Reply renders a streamed assistant reply, setting reasoning blocks apart
+// from the answer. Shown reasoning is dimmed; hidden reasoning is replaced by
+// a short note. Either way it is left out of Answer.
+type Reply struct {
+	out      *Wrapper
+	show     bool
+	thinking bool
+	trim     bool   // drop whitespace at the start of a block or the answer after it
+	pending  string // text that may be the start of a tag
+	space    string // trailing whitespace of shown reasoning, held back
+	answer   strings.Builder
+}
+
+// Reply prints the assistant's label and returns a writer for its streamed
+// reply. The caller must Close the reply when the stream ends.
+func (t *Transcript) Reply(showThinking bool) *Reply {
+	return &Reply{out: t.Role("assistant"), show: showThinking}
+}
+
+// BeginThinking starts the reply inside a reasoning block, for chat
+// templates that open the block in the prompt
+func (r *Reply) BeginThinking() {
+	r.enter()
+}
+
+// Write renders the next part of the reply. Tags may be split across writes.
+func (r *Reply) Write(p []byte) (int, error) {
+	data := r.pending + string(p)
+	r.pending = ""
+
+	for data != "" {
+		tag := ThinkOpen
+		if r.thinking {
+			tag = ThinkClose
+		}
+
+		if i := strings.Index(data, tag); i >= 0 {
+			if err := r.emit(data[:i]); err != nil {
+				return 0, err
+			}
+			if r.thinking {
+				r.leave()
+			} else {
+				r.enter()
+			}
+			data = data[i+len(tag):]
+			continue
+		}
+
+		keep := partialTag(data, tag)
+		if err := r.emit(data[:len(data)-keep]); err != nil {
+			return 0, err
+		}
+		r.pending = data[len(data)-keep:]
+		break
+	}
+	return len(p), nil
+}
+
+// Close renders anything held back and ends the reply
+func (r *Reply) Close() error {
+	if err := r.emit(r.pending); err != nil {
+		return err
+	}
+	r.pending = ""
+	if r.thinking {
+		r.out.Style(colorReset)
+	}
+	return r.out.Close()
+}
+
+// Answer returns the reply without its reasoning
+func (r *Reply) Answer() string {
+	return r.answer.String()
+}
+
+// emit renders text as reasoning or answer, depending on where the reply is
+func (r *Reply) emit(text string) error {
+	if text == "" {
+		return nil
+	}
+
+	if r.trim {
+		if text = strings.TrimLeft(text, " \t\n"); text == "" {
+			return nil
+		}
+		r.trim = false
+	}
+
+	if r.thinking {
+		if !r.show {
+			return nil
+		}
+		text = r.space + text
+		body := strings.TrimRight(text, " \t\n")
+		r.space = text[len(body):]
+		_, err := io.WriteString(r.out, body)
+		return err
+	}
+
+	r.answer.WriteString(text)
+	_, err := io.WriteString(r.out, text)
+	return err
+}
+
+// enter starts a reasoning block
+func (r *Reply) enter() {
+	r.thinking = true
+	r.trim = true
+	r.space = ""
+	r.out.Style(colorGray)
+	if !r.show {
+		note := "💭 thinking…"
+		if ui.Accessible() {
+			note = "The model is thinking."
+		}
+		io.WriteString(r.out, note)
+		r.out.Style(colorReset)
+	}
+}
+
+// leave ends a reasoning block, putting the answer on a new line
+func (r *Reply) leave() {
+	r.thinking = false
+	r.trim = true
+	if r.show {
+		r.out.Style(colorReset)
+	}
+	r.out.Close()
+	if r.show {
+		io.WriteString(r.out, "\n")
+	}
+}
+
+// partialTag returns the length of the longest suffix of text that is a
+// prefix of tag, which may be completed by the next write
+func partialTag(text, tag string) int {
+	for n := min(len(text), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
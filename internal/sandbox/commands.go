@@ -0,0 +1,84 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// RunCommand runs a command through the sandbox and prints its output, so
+// the policy can be tried out before handing it to a model
+func RunCommand(cfg *config.Config, args []string) error {
+	runner, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := runner.Run(context.Background(), args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(result.Stdout)
+	fmt.Fprint(os.Stderr, result.Stderr)
+
+	if result.Truncated {
+		ui.PrintWarn(fmt.Sprintf("Output truncated to %d bytes.", cfg.Sandbox.MaxOutput))
+	}
+	if result.TimedOut {
+		return fmt.Errorf("command timed out after %s", cfg.Sandbox.Timeout)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("command exited with status %d", result.ExitCode)
+	}
+
+	return nil
+}
+
+// ShowAudit prints the most recent entries of the sandbox audit log
+func ShowAudit(cfg *config.Config, limit int) error {
+	file, err := os.Open(cfg.Sandbox.AuditLog)
+	if os.IsNotExist(err) {
+		fmt.Println("No sandboxed commands have been run.")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	for _, entry := range entries {
+		status := fmt.Sprintf("exit %d", entry.ExitCode)
+		if !entry.Allowed {
+			status = "DENIED: " + entry.Reason
+		} else if entry.TimedOut {
+			status = "timed out"
+		}
+		fmt.Printf("%s  %-40s  %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			strings.Join(entry.Args, " "), status)
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package sandbox
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// killGroupOnCancel starts cmd in a process group of its own and makes
+// cancelling it kill the command with every process it started, so none
+// outlive its timeout
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	cmd.Cancel = func() error {
+		if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
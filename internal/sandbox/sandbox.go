@@ -0,0 +1,321 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Result is the outcome of a sandboxed command
+type Result struct {
+	Stdout    string
+	Stderr    string
+	ExitCode  int
+	Duration  time.Duration
+	TimedOut  bool
+	Truncated bool
+}
+
+// Runner executes commands requested by a model under a restrictive policy:
+// only allowlisted binaries, inside a working-directory jail, with a timeout
+// and capped output. Every attempt, allowed or not, is written to an audit log.
+type Runner struct {
+	allow     map[string]bool
+	workdir   string
+	timeout   time.Duration
+	maxOutput int
+	auditLog  string
+}
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Args      []string  `json:"args"`
+	Dir       string    `json:"dir"`
+	Allowed   bool      `json:"allowed"`
+	Reason    string    `json:"reason,omitempty"`
+	ExitCode  int       `json:"exit_code"`
+	Duration  string    `json:"duration,omitempty"`
+	TimedOut  bool      `json:"timed_out,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// New creates a runner from the sandbox configuration
+func New(cfg *config.Config) (*Runner, error) {
+	timeout, err := time.ParseDuration(cfg.Sandbox.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sandbox timeout: %w", err)
+	}
+
+	if err := os.MkdirAll(cfg.Sandbox.Workdir, 0755); err != nil {
+		return nil, fmt.Errorf("creating sandbox directory: %w", err)
+	}
+	workdir, err := filepath.EvalSymlinks(cfg.Sandbox.Workdir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving sandbox directory: %w", err)
+	}
+
+	allow := make(map[string]bool, len(cfg.Sandbox.Allow))
+	for _, name := range cfg.Sandbox.Allow {
+		allow[name] = true
+	}
+
+	return &Runner{
+		allow:     allow,
+		workdir:   workdir,
+		timeout:   timeout,
+		maxOutput: cfg.Sandbox.MaxOutput,
+		auditLog:  cfg.Sandbox.AuditLog,
+	}, nil
+}
+
+// Run executes args[0] with the remaining arguments inside the sandbox
+func (r *Runner) Run(ctx context.Context, args []string) (*Result, error) {
+	entry := auditEntry{Time: time.Now(), Args: args, Dir: r.workdir, ExitCode: -1}
+
+	if err := r.check(args); err != nil {
+		entry.Reason = err.Error()
+		r.audit(entry)
+		return nil, err
+	}
+	entry.Allowed = true
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: r.maxOutput}
+	stderr := &cappedBuffer{limit: r.maxOutput}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = r.workdir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + r.workdir, "LANG=C.UTF-8"}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	killGroupOnCancel(cmd)
+	// Stop waiting for output a little after the kill, in case something
+	// outside the group still holds the pipes open
+	cmd.WaitDelay = time.Second
+	ui.LogCommand(cmd)
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Duration:  time.Since(start),
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		entry.Reason = err.Error()
+		r.audit(entry)
+		return nil, fmt.Errorf("running command: %w", err)
+	}
+
+	entry.ExitCode = result.ExitCode
+	entry.Duration = result.Duration.Round(time.Millisecond).String()
+	entry.TimedOut = result.TimedOut
+	entry.Truncated = result.Truncated
+	r.audit(entry)
+
+	return result, nil
+}
+
+// check enforces the allowlist and working-directory jail
+func (r *Runner) check(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	name := args[0]
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") {
+		return fmt.Errorf("command must be a bare name, not a path: %s", name)
+	}
+	if !r.allow[name] {
+		return fmt.Errorf("command not allowed by sandbox policy: %s", name)
+	}
+
+	for _, arg := range args[1:] {
+		for _, value := range pathValues(arg) {
+			if !r.insideJail(value) {
+				return fmt.Errorf("argument escapes the sandbox directory: %s", arg)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pathValues returns the parts of an argument that could name a path: a
+// plain argument itself, the value of --flag=path, and the value attached
+// to a short option, as in -I/usr/include, -o=/tmp/x or -rf../x
+func pathValues(arg string) []string {
+	if !strings.HasPrefix(arg, "-") {
+		return []string{arg}
+	}
+
+	var values []string
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		values = append(values, arg[i+1:])
+	}
+	if !strings.HasPrefix(arg, "--") {
+		// Short options run together, so a path starts at its first / ~ or .
+		if i := strings.IndexAny(arg[1:], "/~."); i >= 0 {
+			values = append(values, arg[1+i:])
+		}
+	}
+	return values
+}
+
+// insideJail reports whether a path argument stays within the working directory
+func (r *Runner) insideJail(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.HasPrefix(value, "~") {
+		return false
+	}
+
+	path := value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.workdir, path)
+	}
+	path = filepath.Clean(path)
+
+	path = resolveExisting(path)
+	return path == r.workdir || strings.HasPrefix(path, r.workdir+string(filepath.Separator))
+}
+
+// resolveExisting resolves the symlinks in the longest part of path that
+// exists, so a link can't lead outside even to a file that doesn't exist yet
+func resolveExisting(path string) string {
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// audit appends an entry to the audit log. Failing to audit is reported but not fatal.
+func (r *Runner) audit(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(r.auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: writing audit log: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	file.Write(append(line, '\n'))
+}
+
+// Allowed returns the commands the policy allows, sorted
+func (r *Runner) Allowed() []string {
+	names := make([]string, 0, len(r.allow))
+	for name := range r.allow {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Split splits a command line into arguments the way a shell would, with
+// quotes and backslashes, but without expanding or redirecting anything
+func Split(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unfinished quote or escape in %q", line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Workdir returns the directory commands run in
+func (r *Runner) Workdir() string {
+	return r.workdir
+}
+
+// cappedBuffer keeps at most limit bytes and records whether more was written
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,157 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRunner returns a runner allowing cat and sh in a temporary workdir
+func testRunner(t *testing.T) *Runner {
+	t.Helper()
+	workdir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Runner{
+		allow:     map[string]bool{"cat": true, "sh": true},
+		workdir:   workdir,
+		timeout:   time.Minute,
+		maxOutput: 1024,
+		auditLog:  filepath.Join(t.TempDir(), "audit.log"),
+	}
+}
+
+func TestPathValues(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want []string
+	}{
+		{"notes.txt", []string{"notes.txt"}},
+		{"-n", nil},
+		{"--verbose", nil},
+		{"-I/etc", []string{"/etc"}},
+		{"-o=/tmp/x", []string{"/tmp/x", "/tmp/x"}},
+		{"--file=../x", []string{"../x"}},
+		{"-rf../x", []string{"../x"}},
+		{"-C~", []string{"~"}},
+	}
+	for _, tt := range tests {
+		if got := pathValues(tt.arg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pathValues(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := testRunner(t)
+	if err := os.Mkdir(filepath.Join(r.workdir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A link inside the workdir leading out of it
+	if err := os.Symlink(t.TempDir(), filepath.Join(r.workdir, "out")); err != nil {
+		t.Skipf("can't create a symlink: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want string // "" when the command is allowed
+	}{
+		{[]string{"cat", "notes.txt"}, ""},
+		{[]string{"cat", "-n", "sub/../notes.txt"}, ""},
+		{[]string{"cat", "--file=sub/x"}, ""},
+		{[]string{"cat", filepath.Join(r.workdir, "sub")}, ""},
+		{[]string{}, "no command given"},
+		{[]string{"rm", "notes.txt"}, "not allowed"},
+		{[]string{"/bin/cat", "notes.txt"}, "bare name"},
+		{[]string{"cat", "/etc/passwd"}, "escapes"},
+		{[]string{"cat", "../x"}, "escapes"},
+		{[]string{"cat", "-I/etc"}, "escapes"},
+		{[]string{"cat", "--file=../x"}, "escapes"},
+		{[]string{"cat", "-o=/tmp/x"}, "escapes"},
+		{[]string{"cat", "~"}, "escapes"},
+		{[]string{"cat", "~/.ssh/id_ed25519"}, "escapes"},
+		{[]string{"cat", "out"}, "escapes"},
+		{[]string{"cat", "out/secret"}, "escapes"},
+	}
+	for _, tt := range tests {
+		err := r.check(tt.args)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("check(%q) = %v, want no error", tt.args, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("check(%q) = %v, want an error containing %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need sh")
+	}
+	r := testRunner(t)
+	if err := os.WriteFile(filepath.Join(r.workdir, "notes.txt"), []byte(strings.Repeat("x", 2000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.Run(context.Background(), []string{"cat", "notes.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stdout) != r.maxOutput || !result.Truncated || result.ExitCode != 0 {
+		t.Errorf("Run = %d bytes, truncated %v, exit %d; want %d bytes, truncated", len(result.Stdout), result.Truncated, result.ExitCode, r.maxOutput)
+	}
+
+	if _, err := r.Run(context.Background(), []string{"cat", "/etc/passwd"}); err == nil {
+		t.Error("Run allowed a path outside the workdir")
+	}
+	audit, err := os.ReadFile(r.auditLog)
+	if err != nil || strings.Count(string(audit), "\n") != 2 || !strings.Contains(string(audit), `"allowed":false`) {
+		t.Errorf("audit log = %q, %v; want both attempts", audit, err)
+	}
+}
+
+// TestRunTimeout checks a timeout ends the command and what it started in
+// the background, without waiting on it
+func TestRunTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need sh")
+	}
+	r := testRunner(t)
+	r.timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	result, err := r.Run(context.Background(), []string{"sh", "-c", "sleep 30 & echo $! > child.pid; sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Error("Run didn't report the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %s to return after a 200ms timeout", elapsed)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	pid, err := os.ReadFile(filepath.Join(r.workdir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		// Gone, or killed and waiting to be reaped
+		stat, err := os.ReadFile("/proc/" + strings.TrimSpace(string(pid)) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the background command outlived the timeout")
+		}
+	}
+}
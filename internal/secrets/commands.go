@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// validateName checks that a secret name is one llm-cli uses
+func validateName(name string) error {
+	for _, known := range Known {
+		if known.Name == name {
+			return nil
+		}
+	}
+
+	names := make([]string, len(Known))
+	for i, known := range Known {
+		names[i] = known.Name
+	}
+	return fmt.Errorf("unknown secret '%s' (expected one of: %s)", name, strings.Join(names, ", "))
+}
+
+// List shows which secrets are set and where each comes from, without printing values
+func List(s *Store) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE")
+
+	for _, known := range Known {
+		source := "not set"
+		if os.Getenv(known.EnvVar) != "" {
+			source = "environment ($" + known.EnvVar + ")"
+		} else if value, err := s.Get(known.Name); err != nil {
+			source = "error: " + err.Error()
+		} else if value != "" {
+			source = s.Backend()
+		}
+		fmt.Fprintf(w, "%s\t%s\n", known.Name, source)
+	}
+
+	return w.Flush()
+}
+
+// SetInteractive reads a secret from the terminal (or piped stdin) and stores it
+func SetInteractive(s *Store, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	var value string
+	var err error
+	if ui.IsInteractive() {
+		value, err = ui.ReadSecret(fmt.Sprintf("Value for %s: ", name))
+	} else {
+		value, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if value != "" {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("reading secret: %w", err)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("secret value cannot be empty")
+	}
+
+	if err := s.Set(name, value); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Stored %s in the %s.", name, s.Backend()))
+	return nil
+}
+
+// Remove deletes a stored secret
+func Remove(s *Store, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := s.Delete(name); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Removed %s.", name))
+	return nil
+}
@@ -0,0 +1,133 @@
+//go:build !windows
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainTool returns the keychain CLI for this platform, or "" if there is none
+func keychainTool() string {
+	var tool string
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "linux", "freebsd", "openbsd", "netbsd":
+		tool = "secret-tool"
+	default:
+		return ""
+	}
+
+	if _, err := exec.LookPath(tool); err != nil {
+		return ""
+	}
+	return tool
+}
+
+// keychainAvailable reports whether secrets can be kept in the OS keychain
+func keychainAvailable() bool {
+	return keychainTool() != ""
+}
+
+// keychainGet reads a secret from the OS keychain, returning "" if it doesn't exist
+func keychainGet(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch keychainTool() {
+	case "security":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "secret-tool":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", errKeychainUnavailable
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		if notFound(err, output) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading keychain: %w%s", err, toolError(err))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// keychainSet stores a secret in the OS keychain
+func keychainSet(service, account, secret string) error {
+	var cmd *exec.Cmd
+	switch keychainTool() {
+	case "security":
+		// -w last without a value reads the secret from stdin, keeping it
+		// out of the argument list other users can see; it is asked twice
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w")
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	case "secret-tool":
+		cmd = exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return errKeychainUnavailable
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("writing keychain: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// keychainDelete removes a secret from the OS keychain if it exists
+func keychainDelete(service, account string) error {
+	var cmd *exec.Cmd
+	switch keychainTool() {
+	case "security":
+		cmd = exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
+	case "secret-tool":
+		cmd = exec.Command("secret-tool", "clear", "service", service, "account", account)
+	default:
+		return errKeychainUnavailable
+	}
+
+	if output, err := cmd.Output(); err != nil {
+		// Missing items are not an error
+		if notFound(err, output) {
+			return nil
+		}
+		return fmt.Errorf("deleting from keychain: %w%s", err, toolError(err))
+	}
+
+	return nil
+}
+
+// notFound reports whether a keychain tool failed only because the item
+// doesn't exist: security exits 44 (errSecItemNotFound), secret-tool exits
+// 1 without printing anything. Any other failure, such as a locked keychain
+// or no secret service running, must not read as an unset secret.
+func notFound(err error, output []byte) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	switch keychainTool() {
+	case "security":
+		return exitErr.ExitCode() == 44
+	case "secret-tool":
+		return exitErr.ExitCode() == 1 && len(strings.TrimSpace(string(output))) == 0 &&
+			len(strings.TrimSpace(string(exitErr.Stderr))) == 0
+	}
+	return false
+}
+
+// toolError returns what a failed keychain tool printed to stderr, for error messages
+func toolError(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr := strings.TrimSpace(string(exitErr.Stderr)); stderr != "" {
+			return ": " + stderr
+		}
+	}
+	return ""
+}
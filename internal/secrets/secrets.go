@@ -0,0 +1,205 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// Names of the secrets llm-cli knows about
+const (
+	HFToken     = "hf-token"
+	APIKey      = "api-key"
+	ProxyAPIKey = "proxy-api-key"
+	VaultKey    = "vault-key"
+
+	OIDCClientSecret = "oidc-client-secret"
+)
+
+// service is the keychain service all secrets are stored under
+const service = "llm-cli"
+
+// Known lists the user-facing secrets with the environment variable that overrides each
+var Known = []struct {
+	Name   string
+	EnvVar string
+}{
+	{HFToken, "HF_TOKEN"},
+	{APIKey, "LLM_CLI_API_KEY"},
+	{ProxyAPIKey, "LLM_CLI_PROXY_API_KEY"},
+	{OIDCClientSecret, "LLM_CLI_OIDC_CLIENT_SECRET"},
+}
+
+// errKeychainUnavailable is returned when the platform has no usable keychain
+var errKeychainUnavailable = errors.New("OS keychain is not available")
+
+// Store reads and writes secrets in the OS keychain, falling back to a
+// permission-restricted file when no keychain is available
+type Store struct {
+	backend  string
+	filePath string
+}
+
+// New creates a secret store using the configured backend
+func New(cfg *config.Config) *Store {
+	backend := cfg.Secrets.Backend
+	if backend == "" {
+		backend = "auto"
+	}
+	return &Store{backend: backend, filePath: cfg.Secrets.FilePath}
+}
+
+// Resolve returns a secret, preferring its environment variable when set
+func (s *Store) Resolve(name string) (string, error) {
+	for _, known := range Known {
+		if known.Name == name {
+			if value := os.Getenv(known.EnvVar); value != "" {
+				return value, nil
+			}
+		}
+	}
+	return s.Get(name)
+}
+
+// HuggingFaceToken returns the token used for Hugging Face requests, from
+// $HF_TOKEN, the config file's hf_token, the secret store, or the token
+// saved by huggingface-cli, in that order. It returns "" if there is none.
+func HuggingFaceToken(cfg *config.Config) (string, error) {
+	if value := os.Getenv("HF_TOKEN"); value != "" {
+		return value, nil
+	}
+	if cfg.HFToken != "" {
+		return cfg.HFToken, nil
+	}
+
+	value, err := New(cfg).Get(HFToken)
+	if value != "" || err != nil {
+		return value, err
+	}
+
+	hfHome := os.Getenv("HF_HOME")
+	if hfHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		hfHome = filepath.Join(home, ".cache", "huggingface")
+	}
+	data, err := os.ReadFile(filepath.Join(hfHome, "token"))
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Get returns a stored secret, or "" if it isn't set
+func (s *Store) Get(name string) (string, error) {
+	if s.useKeychain() {
+		value, err := keychainGet(service, name)
+		if err == nil || s.backend == "keychain" || !errors.Is(err, errKeychainUnavailable) {
+			return value, err
+		}
+	}
+
+	values, err := s.readFile()
+	if err != nil {
+		return "", err
+	}
+	return values[name], nil
+}
+
+// Set stores a secret
+func (s *Store) Set(name, value string) error {
+	if s.useKeychain() {
+		err := keychainSet(service, name, value)
+		if err == nil || s.backend == "keychain" || !errors.Is(err, errKeychainUnavailable) {
+			return err
+		}
+	}
+
+	values, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	values[name] = value
+	return s.writeFile(values)
+}
+
+// Delete removes a secret from every backend it may be stored in
+func (s *Store) Delete(name string) error {
+	if s.useKeychain() {
+		if err := keychainDelete(service, name); err != nil && !errors.Is(err, errKeychainUnavailable) {
+			return err
+		}
+	}
+
+	if s.backend == "keychain" {
+		return nil
+	}
+
+	values, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return nil
+	}
+	delete(values, name)
+	return s.writeFile(values)
+}
+
+// Backend describes where secrets are currently stored
+func (s *Store) Backend() string {
+	if s.useKeychain() && keychainAvailable() {
+		return "keychain"
+	}
+	return "file (" + s.filePath + ")"
+}
+
+// useKeychain reports whether the keychain should be tried first
+func (s *Store) useKeychain() bool {
+	return s.backend == "auto" || s.backend == "keychain"
+}
+
+// readFile loads the fallback secrets file
+func (s *Store) readFile() (map[string]string, error) {
+	values := make(map[string]string)
+
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return values, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return values, nil
+}
+
+// writeFile saves the fallback secrets file, readable only by the current user
+func (s *Store) writeFile(values map[string]string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding secrets: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("creating secrets directory: %w", err)
+	}
+
+	tmp := s.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, s.filePath); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/secrets"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// backendTokens caches bearer tokens by secret name, so the keychain is
+// read once per process rather than once per request
+var backendTokens sync.Map
+
+// requestRecorders holds, by API URL, the functions told how long each
+// request to a local model's server took to start answering and why it
+// failed, if it did. ModelConfig registers them.
+var requestRecorders sync.Map
+
+// requestRecorder returns the function recording requests to the server
+// at apiURL, or nil if there is none
+func requestRecorder(apiURL string) func(latency time.Duration, err error) {
+	if record, ok := requestRecorders.Load(apiURL); ok {
+		return record.(func(time.Duration, error))
+	}
+	return nil
+}
+
+// apiRequest sends a request to an endpoint of the backend API, such as
+// /completion, with the backend's headers and bearer token. A non-nil body
+// is sent as JSON.
+func apiRequest(cfg *config.Config, method, endpoint string, body []byte) (*http.Response, error) {
+	return apiRequestContext(context.Background(), cfg, method, endpoint, body)
+}
+
+// apiRequestContext is apiRequest, abandoning the request when ctx is done
+// or the server runs past the timeouts in the config. A refused connection,
+// as while a server is still starting, is retried with backoff.
+func apiRequestContext(ctx context.Context, cfg *config.Config, method, endpoint string, body []byte) (*http.Response, error) {
+	timeouts, err := cfg.RequestTimeouts()
+	if err != nil {
+		return nil, err
+	}
+	client, baseURL := httpTarget(cfg.APIURL)
+	ctx = context.WithValue(ctx, connectTimeoutKey{}, timeouts.Connect)
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, baseURL+endpoint, reader)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if err := setBackendHeaders(cfg, req.Header); err != nil {
+			return nil, err
+		}
+		resp, err := doWithTimeouts(client, req, timeouts, requestRecorder(cfg.APIURL))
+		if err == nil || !connectionRefused(err) || attempt == len(connectBackoff) {
+			return resp, err
+		}
+		ui.Debug("Connection refused; retrying", "url", baseURL+endpoint, "in", connectBackoff[attempt])
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(connectBackoff[attempt]):
+		}
+	}
+}
+
+// setBackendHeaders adds the selected backend's headers and bearer token.
+// An Authorization header set explicitly takes precedence over the token.
+func setBackendHeaders(cfg *config.Config, header http.Header) error {
+	for name, value := range cfg.Backend.Headers {
+		header.Set(name, os.ExpandEnv(value))
+	}
+	if cfg.Backend.TokenSecret == "" || header.Get("Authorization") != "" {
+		return nil
+	}
+
+	token, ok := backendTokens.Load(cfg.Backend.TokenSecret)
+	if !ok {
+		value, err := secrets.New(cfg).Resolve(cfg.Backend.TokenSecret)
+		if err != nil {
+			return fmt.Errorf("reading token for backend %s: %w", cfg.Backend.Name, err)
+		}
+		if value == "" {
+			return fmt.Errorf("backend %s needs the secret %s; store it with 'llm-cli secrets set %s'",
+				cfg.Backend.Name, cfg.Backend.TokenSecret, cfg.Backend.TokenSecret)
+		}
+		token, _ = backendTokens.LoadOrStore(cfg.Backend.TokenSecret, value)
+	}
+	header.Set("Authorization", "Bearer "+token.(string))
+	return nil
+}
+
+// checkRemoteBackend makes sure a remote backend is reachable, since its
+// server can't be started from here
+func checkRemoteBackend(cfg *config.Config) error {
+	resp, err := apiRequest(cfg, http.MethodGet, "/health", nil)
+	if err != nil {
+		return fmt.Errorf("backend %s at %s is not reachable: %w", cfg.Backend.Name, cfg.APIURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("backend %s refused the request with status %d; check its headers and token_secret in %s",
+			cfg.Backend.Name, resp.StatusCode, cfg.ConfigPath)
+	}
+	return fmt.Errorf("backend %s returned status %d", cfg.Backend.Name, resp.StatusCode)
+}
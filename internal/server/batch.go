@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// BatchOptions controls a batch of completions
+type BatchOptions struct {
+	Input       string // JSONL file of prompts
+	Output      string // JSONL file results are written to
+	Concurrency int    // requests in flight; 0 uses the server's parallel slots
+}
+
+// batchPrompt is one input of a batch or embedding file
+type batchPrompt struct {
+	ID     json.RawMessage
+	Prompt string
+}
+
+// batchResult is one line of a batch output file
+type batchResult struct {
+	ID           json.RawMessage `json:"id"`
+	Prompt       string          `json:"prompt"`
+	Completion   string          `json:"completion"`
+	Truncated    bool            `json:"truncated"`
+	PromptTokens int             `json:"prompt_tokens"`
+	Tokens       int             `json:"tokens"`
+	DurationMS   int64           `json:"duration_ms"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// Batch completes every prompt of a JSONL file and writes one result per
+// prompt, in input order, to another. Each input line is either a JSON
+// string or an object with a "prompt" and an optional "id", which is
+// copied to the result; the line number is used when there is no id.
+// Prompts that fail are recorded with an error rather than stopping the batch.
+func Batch(store *db.Store, cfg *config.Config, slug string, opts BatchOptions) error {
+	prompts, err := readBatchPrompts(opts.Input, "prompt", false)
+	if err != nil {
+		return err
+	}
+	if len(prompts) == 0 {
+		return fmt.Errorf("no prompts in %s", opts.Input)
+	}
+
+	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+		return err
+	}
+	cfg, err = ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
+
+	slots := serverSlots(cfg)
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = max(slots, 1)
+	} else if slots > 0 && workers > slots {
+		ui.PrintWarn(fmt.Sprintf("The server has %d parallel slots, so requests beyond that will queue. Raise them with 'set %s parallel N'.", slots, slug))
+	}
+	workers = min(workers, len(prompts))
+
+	file, err := os.Create(opts.Output)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	ui.PrintInfo(fmt.Sprintf("Completing %d prompts with %s, %d at a time...", len(prompts), slug, workers))
+	start := time.Now()
+
+	type finishedPrompt struct {
+		index  int
+		result *batchResult
+	}
+	jobs := make(chan int)
+	done := make(chan finishedPrompt)
+	results := make([]*batchResult, len(prompts))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				done <- finishedPrompt{index, completeBatchPrompt(cfg, prompts[index])}
+			}
+		}()
+	}
+	go func() {
+		for i := range prompts {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	// Progress is only shown on a terminal, where \r overwrites it
+	info, err := os.Stderr.Stat()
+	progress := err == nil && info.Mode()&os.ModeCharDevice != 0
+	line := ui.NewProgress(os.Stderr)
+	next, finished, failed, tokens := 0, 0, 0, 0
+	encoder := json.NewEncoder(writer)
+	var writeErr error
+	for f := range done {
+		results[f.index] = f.result
+		finished++
+		// Results are written as soon as every earlier one is, so the
+		// output stays in input order and a partial file is still usable
+		for next < len(results) && results[next] != nil {
+			result := results[next]
+			if result.Error != "" {
+				failed++
+			}
+			tokens += result.Tokens
+			if writeErr == nil {
+				writeErr = encoder.Encode(result)
+			}
+			results[next] = nil
+			next++
+		}
+		if progress {
+			line.Update(float64(finished)/float64(len(prompts)),
+				fmt.Sprintf("%d/%d done", finished, len(prompts)),
+				fmt.Sprintf("Finished %d of %d prompts.", finished, len(prompts)))
+		}
+	}
+	line.Done()
+	if writeErr == nil {
+		writeErr = writer.Flush()
+	}
+	if writeErr != nil {
+		return fmt.Errorf("writing results: %w", writeErr)
+	}
+
+	elapsed := time.Since(start)
+	ui.PrintInfo(fmt.Sprintf("Wrote %d results to %s in %s (%.1f tok/s overall).",
+		len(prompts), opts.Output, elapsed.Round(time.Millisecond), float64(tokens)/elapsed.Seconds()))
+	if failed > 0 {
+		ui.PrintWarn(fmt.Sprintf("%d prompts failed; their results have an \"error\" field.", failed))
+	}
+	return nil
+}
+
+// completeBatchPrompt completes one prompt of a batch
+func completeBatchPrompt(cfg *config.Config, prompt batchPrompt) *batchResult {
+	result := &batchResult{ID: prompt.ID, Prompt: prompt.Prompt}
+	start := time.Now()
+
+	var response map[string]interface{}
+	err := postJSON(cfg, "/completion", samplingRequest(cfg, prompt.Prompt), &response)
+	result.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	stats := statsFromResult(response)
+	result.Completion, _ = response["content"].(string)
+	result.Truncated = stoppedAtLimit(response)
+	result.PromptTokens = stats.PromptTokens
+	result.Tokens = stats.PredictedTokens
+	return result
+}
+
+// readBatchPrompts reads the inputs of a batch file, skipping blank lines.
+// Each line is a JSON string or an object with the input under field and
+// an optional "id", or with plain set the input itself. The line number is
+// the id of inputs without one.
+func readBatchPrompts(path, field string, plain bool) ([]batchPrompt, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening input file: %w", err)
+	}
+	defer file.Close()
+
+	var prompts []batchPrompt
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		prompt := batchPrompt{Prompt: line}
+		if !plain {
+			if prompt, err = parseBatchLine(line, field); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, lineNum, err)
+			}
+			if prompt.Prompt == "" {
+				return nil, fmt.Errorf("%s line %d: no %s", path, lineNum, field)
+			}
+		}
+		if len(prompt.ID) == 0 {
+			prompt.ID = json.RawMessage(fmt.Sprint(lineNum))
+		}
+		prompts = append(prompts, prompt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input file: %w", err)
+	}
+	return prompts, nil
+}
+
+// parseBatchLine reads a JSON line of a batch file: a string, or an object
+// with the input under field and an optional "id"
+func parseBatchLine(line, field string) (batchPrompt, error) {
+	var prompt batchPrompt
+	if strings.HasPrefix(line, "\"") {
+		err := json.Unmarshal([]byte(line), &prompt.Prompt)
+		return prompt, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		return prompt, err
+	}
+	prompt.ID = object["id"]
+	if value, ok := object[field]; ok {
+		if err := json.Unmarshal(value, &prompt.Prompt); err != nil {
+			return prompt, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	return prompt, nil
+}
+
+// serverSlots returns how many requests the running server processes in
+// parallel, or 0 if it can't be determined
+func serverSlots(cfg *config.Config) int {
+	resp, err := apiRequest(cfg, http.MethodGet, "/props", nil)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	var props struct {
+		TotalSlots int `json:"total_slots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&props); err != nil {
+		return 0
+	}
+	return props.TotalSlots
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// fillerText is tokenized and repeated to build benchmark prompts of an
+// exact length
+const fillerText = "The history of computing is a story of abstractions layered on abstractions, " +
+	"from switching circuits to instruction sets, compilers, operating systems and networks. "
+
+// Timings are llama-server's measurements of one completion
+type Timings struct {
+	PromptN            int     `json:"prompt_n"`
+	PromptMS           float64 `json:"prompt_ms"`
+	PromptPerSecond    float64 `json:"prompt_per_second"`
+	PredictedN         int     `json:"predicted_n"`
+	PredictedMS        float64 `json:"predicted_ms"`
+	PredictedPerSecond float64 `json:"predicted_per_second"`
+}
+
+// CompleteTimed runs an uncached completion of nPredict tokens on the
+// running server and returns the server's timings
+func CompleteTimed(cfg *config.Config, prompt string, nPredict int) (*Timings, error) {
+	req := completionRequest{
+		Prompt:      prompt,
+		NPredict:    nPredict,
+		Temperature: cfg.Temperature,
+		TopK:        cfg.TopK,
+		TopP:        cfg.TopP,
+	}
+
+	var result struct {
+		Timings *Timings `json:"timings"`
+	}
+	if err := postJSON(cfg, "/completion", req, &result); err != nil {
+		return nil, err
+	}
+	if result.Timings == nil {
+		return nil, fmt.Errorf("server did not report timings")
+	}
+	return result.Timings, nil
+}
+
+// BenchPrompt returns a prompt of exactly n tokens for the running server's model
+func BenchPrompt(cfg *config.Config, n int) ([]int, error) {
+	var result struct {
+		Tokens []int `json:"tokens"`
+	}
+	if err := postJSON(cfg, "/tokenize", tokenizeRequest{Content: fillerText}, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Tokens) == 0 {
+		return nil, fmt.Errorf("server returned no tokens")
+	}
+	prompt := make([]int, n)
+	for i := range prompt {
+		prompt[i] = result.Tokens[i%len(result.Tokens)]
+	}
+	return prompt, nil
+}
+
+// CompleteStreamTimed runs an uncached streaming completion of exactly
+// nPredict tokens for a tokenized prompt and returns the server's timings
+// and the time until the first token arrived
+func CompleteStreamTimed(cfg *config.Config, prompt []int, nPredict int) (*Timings, time.Duration, error) {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"prompt":       prompt,
+		"n_predict":    nPredict,
+		"temperature":  cfg.Temperature,
+		"top_k":        cfg.TopK,
+		"top_p":        cfg.TopP,
+		"ignore_eos":   true, // generate every token even if the model would stop
+		"cache_prompt": false,
+		"stream":       true,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	touchActivity(cfg, apiPort(cfg))
+	start := time.Now()
+	resp, err := apiRequest(cfg, http.MethodPost, "/completion", reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var firstToken time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var chunk struct {
+			Content string   `json:"content"`
+			Stop    bool     `json:"stop"`
+			Timings *Timings `json:"timings"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if firstToken == 0 && chunk.Content != "" {
+			firstToken = time.Since(start)
+		}
+		if chunk.Stop {
+			if chunk.Timings == nil {
+				return nil, 0, fmt.Errorf("server did not report timings")
+			}
+			return chunk.Timings, firstToken, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		var timeout *timeoutError
+		if errors.As(err, &timeout) {
+			return nil, 0, err
+		}
+		return nil, 0, streamBroken(cfg, err)
+	}
+	return nil, 0, streamBroken(cfg, nil)
+}
+
+// ServerPID returns the PID of the running server started for slug, or 0
+// if there is none, such as when the daemon or another backend runs it
+func ServerPID(store *db.Store, slug string) int {
+	servers, err := runningServers(store)
+	if err != nil {
+		return 0
+	}
+	for _, srv := range servers {
+		if srv.Slug == slug {
+			return srv.PID
+		}
+	}
+	return 0
+}
+
+// ProcessMemory returns the resident memory of a process in bytes
+func ProcessMemory(pid int) (int64, error) {
+	out, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("reading memory of process %d: %w", pid, err)
+	}
+	kb, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing memory of process %d: %w", pid, err)
+	}
+	return kb * 1024, nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// retrievalDataset is a set of queries, each with the passages that answer
+// it, and the corpus of passages searched
+type retrievalDataset struct {
+	Queries  []string
+	Relevant map[string]map[int]bool // query -> indexes into Passages
+	Passages []string
+}
+
+// embedScore is how well one embedding model retrieved a dataset
+type embedScore struct {
+	Slug      string
+	Dimension int
+	Recall    float64
+	MRR       float64
+	Duration  time.Duration
+}
+
+// BenchEmbed measures how well each embedding model retrieves the relevant
+// passages of a labelled dataset, reporting recall@k and mean reciprocal
+// rank. The dataset is a TSV file of "query<TAB>relevant passage" lines;
+// every passage in it, plus any lines of corpusPath, is searched for every query.
+func BenchEmbed(store *db.Store, cfg *config.Config, slugs []string, datasetPath, corpusPath string, k int) error {
+	dataset, err := readRetrievalDataset(datasetPath)
+	if err != nil {
+		return err
+	}
+	if corpusPath != "" {
+		extra, err := readCandidates(corpusPath)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(dataset.Passages))
+		for _, passage := range dataset.Passages {
+			seen[passage] = true
+		}
+		for _, c := range extra {
+			if !seen[c.Text] {
+				seen[c.Text] = true
+				dataset.Passages = append(dataset.Passages, c.Text)
+			}
+		}
+	}
+	ui.PrintInfo(fmt.Sprintf("Dataset: %d queries over %d passages.", len(dataset.Queries), len(dataset.Passages)))
+
+	var scores []embedScore
+	for _, slug := range slugs {
+		score, err := benchEmbedModel(store, cfg, slug, dataset, k)
+		if err != nil {
+			return fmt.Errorf("benchmarking %s: %w", slug, err)
+		}
+		scores = append(scores, *score)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Recall != scores[j].Recall {
+			return scores[i].Recall > scores[j].Recall
+		}
+		return scores[i].MRR > scores[j].MRR
+	})
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MODEL\tDIM\tRECALL@%d\tMRR\tTIME\n", k)
+	for _, s := range scores {
+		fmt.Fprintf(w, "%s\t%d\t%.3f\t%.3f\t%s\n", s.Slug, s.Dimension, s.Recall, s.MRR, s.Duration.Round(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(scores) > 1 {
+		fmt.Println()
+		ui.PrintInfo(fmt.Sprintf("Best: %s (recall@%d %.3f, MRR %.3f)", scores[0].Slug, k, scores[0].Recall, scores[0].MRR))
+	}
+	return nil
+}
+
+// benchEmbedModel embeds the dataset with one model and scores its rankings
+func benchEmbedModel(store *db.Store, cfg *config.Config, slug string, dataset *retrievalDataset, k int) (*embedScore, error) {
+	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+		return nil, err
+	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return nil, err
+	}
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	modelKey := EmbeddingModelKey(model)
+
+	start := time.Now()
+	passages := make([][]float64, len(dataset.Passages))
+	for i, passage := range dataset.Passages {
+		if passages[i], _, err = cachedEmbedding(store, cfg, modelKey, passage); err != nil {
+			return nil, fmt.Errorf("embedding passage: %w", err)
+		}
+	}
+
+	score := &embedScore{Slug: slug}
+	if len(passages) > 0 {
+		score.Dimension = len(passages[0])
+	}
+	for _, query := range dataset.Queries {
+		vector, _, err := cachedEmbedding(store, cfg, modelKey, query)
+		if err != nil {
+			return nil, fmt.Errorf("embedding query: %w", err)
+		}
+
+		ranking := make([]int, len(passages))
+		similarity := make([]float64, len(passages))
+		for i := range passages {
+			ranking[i] = i
+			similarity[i] = CosineSimilarity(vector, passages[i])
+		}
+		sort.SliceStable(ranking, func(a, b int) bool { return similarity[ranking[a]] > similarity[ranking[b]] })
+
+		relevant := dataset.Relevant[query]
+		found, first := 0, 0
+		for rank, passage := range ranking {
+			if !relevant[passage] {
+				continue
+			}
+			if first == 0 {
+				first = rank + 1
+			}
+			if rank < k {
+				found++
+			}
+		}
+		score.Recall += float64(found) / float64(len(relevant))
+		if first > 0 {
+			score.MRR += 1 / float64(first)
+		}
+	}
+	score.Duration = time.Since(start)
+
+	score.Recall /= float64(len(dataset.Queries))
+	score.MRR /= float64(len(dataset.Queries))
+	return score, nil
+}
+
+// readRetrievalDataset reads "query<TAB>relevant passage" lines, skipping
+// blank lines and lines starting with #
+func readRetrievalDataset(path string) (*retrievalDataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening dataset: %w", err)
+	}
+	defer file.Close()
+
+	dataset := &retrievalDataset{Relevant: make(map[string]map[int]bool)}
+	passageIndex := make(map[string]int)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		query, passage, ok := strings.Cut(text, "\t")
+		query, passage = strings.TrimSpace(query), strings.TrimSpace(passage)
+		if !ok || query == "" || passage == "" {
+			return nil, fmt.Errorf("%s:%d: expected a query and a relevant passage separated by a tab", path, line)
+		}
+
+		index, ok := passageIndex[passage]
+		if !ok {
+			index = len(dataset.Passages)
+			passageIndex[passage] = index
+			dataset.Passages = append(dataset.Passages, passage)
+		}
+		if dataset.Relevant[query] == nil {
+			dataset.Relevant[query] = make(map[int]bool)
+			dataset.Queries = append(dataset.Queries, query)
+		}
+		dataset.Relevant[query][index] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading dataset: %w", err)
+	}
+
+	if len(dataset.Queries) == 0 {
+		return nil, fmt.Errorf("no queries found in %s", path)
+	}
+	return dataset, nil
+}
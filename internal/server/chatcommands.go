@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// chatCommands are the slash commands of a chat, as /help lists them
+var chatCommands = []struct{ usage, description string }{
+	{"/system [text|off]", "Show, change or remove the system prompt"},
+	{"/clear", "Forget the conversation so far, keeping the system prompt"},
+	{"/save <name>", "Save the session under a name; later messages are saved there too"},
+	{"/model <slug>", "Continue the conversation with another model"},
+	{"/edit [text]", "Write the next message in $EDITOR"},
+	{"/retry", "Generate the last reply again"},
+	{"/continue", "Continue a reply that was cut off or cancelled"},
+	{"/tokens", "Show how much of the context the conversation uses"},
+	{"/export [file]", "Write the conversation to a .md, .json or .html file"},
+	{"/help", "List these commands"},
+	{"exit", "End the chat"},
+}
+
+// chatCommandPattern matches a slash command at the start of a message,
+// leaving out messages that merely start with a path such as /etc/hosts
+var chatCommandPattern = regexp.MustCompile(`^/([a-z]+)(?:\s+(.*))?$`)
+
+// parseChatCommand splits a chat message that is a slash command into the
+// command's name, without the slash, and its argument
+func parseChatCommand(input string) (name, arg string, ok bool) {
+	match := chatCommandPattern.FindStringSubmatch(input)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], strings.TrimSpace(match[2]), true
+}
+
+// printChatCommands prints the slash commands for /help
+func printChatCommands() {
+	fmt.Println("Commands:")
+	for _, cmd := range chatCommands {
+		fmt.Printf("  %-20s %s\n", cmd.usage, cmd.description)
+	}
+}
+
+// chatModel is the model a chat talks to, which /model can change
+type chatModel struct {
+	slug   string
+	cfg    *config.Config
+	conn   *chatConnection
+	format *chattmpl.Format
+	stops  []string // the model's stop strings and those of its chat format
+}
+
+// openChatModel starts a model's server, if needed, for a chat. Its
+// connection is pinged every ping while the chat is idle, unless ping is 0;
+// close it once the chat is done with the model.
+func openChatModel(ctx context.Context, store *db.Store, base *config.Config, slug string, ping time.Duration) (*chatModel, error) {
+	startCtx, stop := ui.Interruptible(ctx)
+	err := EnsureServerRunningContext(startCtx, store, base, slug)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ModelConfig(store, base, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers that stop during a long pause are restarted for the next message
+	m := &chatModel{slug: slug, cfg: cfg, conn: newChatConnection(store, base, slug, cfg)}
+	if ping > 0 {
+		m.conn.startPings(ping)
+	}
+	m.format = chatFormat(store, cfg, slug)
+	m.stops = append([]string{}, cfg.Stop...)
+	for _, stop := range m.format.Stops {
+		if !slices.Contains(m.stops, stop) {
+			m.stops = append(m.stops, stop)
+		}
+	}
+	return m, nil
+}
+
+// systemPrompt returns the system prompt that leads a chat's history, or ""
+// if it has none
+func systemPrompt(history []chattmpl.Message) string {
+	if len(history) > 0 && history[0].Role == "system" {
+		return history[0].Content
+	}
+	return ""
+}
+
+// withSystemPrompt returns history led by prompt as its system prompt, in
+// place of any it had, or without one when prompt is empty
+func withSystemPrompt(history []chattmpl.Message, prompt string) []chattmpl.Message {
+	if len(history) > 0 && history[0].Role == "system" {
+		history = history[1:]
+	}
+	if prompt == "" {
+		return history
+	}
+	return append([]chattmpl.Message{{Role: "system", Content: prompt}}, history...)
+}
+
+// contextUsage describes how much of the server's context a chat's history
+// takes up, for /tokens. contextSize is 0 when it isn't known.
+func contextUsage(cfg *config.Config, format *chattmpl.Format, history []chattmpl.Message, contextSize int) (string, error) {
+	used, err := countTokens(cfg, format.Render(history))
+	if err != nil {
+		return "", fmt.Errorf("counting tokens: %w", err)
+	}
+	messages := 0
+	for _, message := range history {
+		if message.Role != "system" {
+			messages++
+		}
+	}
+	system := ""
+	if prompt := systemPrompt(history); prompt != "" {
+		if n, err := countTokens(cfg, prompt); err == nil {
+			system = fmt.Sprintf(", %d of them the system prompt", n)
+		}
+	}
+	if contextSize == 0 {
+		return fmt.Sprintf("The conversation takes %d tokens in %d messages%s. The server's context size is unknown.", used, messages, system), nil
+	}
+	return fmt.Sprintf("The conversation takes %d of %d tokens of context (%d%%) in %d messages%s; %d are left.",
+		used, contextSize, used*100/contextSize, messages, system, max(contextSize-used, 0)), nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/post"
+)
+
+const (
+	// defaultReplyReserve is the context left free for a reply when
+	// n_predict doesn't limit it
+	defaultReplyReserve = 512
+	// summaryTokens is the longest summary of dropped messages asked for
+	summaryTokens = 400
+	// summaryRequest stands in for the user's side of a summary, so the
+	// history still alternates between the user and the model
+	summaryRequest = "Summarize our conversation so far."
+)
+
+// errNoRoom is returned by fitContext when the last message doesn't fit
+// even without the rest of the history
+var errNoRoom = errors.New("no room in the context")
+
+// replyReserve returns how many tokens of a context of contextSize a chat
+// leaves free for the reply: n_predict when it is set, and at most half
+func replyReserve(cfg *config.Config, contextSize int) int {
+	reserve := cfg.NPredictMax
+	if reserve <= 0 {
+		reserve = min(defaultReplyReserve, contextSize/4)
+	}
+	return min(reserve, contextSize/2)
+}
+
+// contextLeft describes the context a chat's history leaves for the next
+// message, for the prompt line, e.g. "5120 tokens left", or "" if either
+// isn't known
+func contextLeft(history, contextSize int) string {
+	if history < 0 || contextSize <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d tokens left", max(contextSize-history, 0))
+}
+
+// fitContext makes room for a reply when the prompt built from a chat's
+// history would take more than limit tokens. The oldest exchanges are
+// dropped or, with the summarize policy, replaced with a summary of them;
+// the system prompt and the last message are always kept. It returns the
+// new history, the tokens its prompt takes and a note saying what was done.
+func fitContext(ctx context.Context, cfg *config.Config, format *chattmpl.Format, stops []string, history []chattmpl.Message,
+	build func([]chattmpl.Message) []chattmpl.Message, limit int, policy string) ([]chattmpl.Message, int, string, error) {
+	count := func(history []chattmpl.Message) (int, error) {
+		return countTokens(cfg, format.Render(build(history)))
+	}
+	system := systemPrompt(history)
+	rest := withSystemPrompt(history, "")
+
+	used, err := count(history)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("counting tokens: %w", err)
+	}
+	dropped := 0
+	for used > limit && len(rest)-dropped > 1 {
+		// Drop an exchange: the oldest message and the reply to it
+		n := 1
+		if rest[dropped].Role == "user" && dropped+2 < len(rest) && rest[dropped+1].Role == "assistant" {
+			n = 2
+		}
+		dropped += n
+		if used, err = count(withSystemPrompt(rest[dropped:], system)); err != nil {
+			return nil, 0, "", fmt.Errorf("counting tokens: %w", err)
+		}
+	}
+	if used > limit {
+		return nil, 0, "", fmt.Errorf("%w: the message takes %d tokens with the system prompt, more than the %d left for it", errNoRoom, used, limit)
+	}
+	if dropped == 0 {
+		return history, used, "", nil
+	}
+
+	if policy == "summarize" {
+		// A summary of a single exchange would save little, so the older
+		// half of the conversation is summarized at least
+		summarize := max(dropped, (len(rest)-1)/2)
+		if rest[summarize-1].Role == "user" && summarize < len(rest)-1 {
+			summarize++
+		}
+		summary, err := summarizeMessages(ctx, cfg, format, stops, rest[:summarize], limit)
+		if err == nil {
+			summarized := append([]chattmpl.Message{
+				{Role: "user", Content: summaryRequest},
+				{Role: "assistant", Content: summary},
+			}, rest[summarize:]...)
+			summarized = withSystemPrompt(summarized, system)
+			if n, err := count(summarized); err == nil && n <= limit {
+				return summarized, n, fmt.Sprintf("Summarized the %d oldest messages to keep the conversation within the context (~%d tokens).", summarize, n), nil
+			}
+			err = fmt.Errorf("the summary leaves no room for the reply")
+		}
+		note := fmt.Sprintf("Couldn't summarize the oldest messages (%v); dropped %d of them instead to keep the conversation within the context (~%d tokens).", err, dropped, used)
+		return withSystemPrompt(rest[dropped:], system), used, note, nil
+	}
+	return withSystemPrompt(rest[dropped:], system), used,
+		fmt.Sprintf("Dropped the %d oldest messages to keep the conversation within the context (~%d tokens).", dropped, used), nil
+}
+
+// summarizeMessages asks the chat's model to summarize messages, within a
+// prompt of at most limit tokens
+func summarizeMessages(ctx context.Context, cfg *config.Config, format *chattmpl.Format, stops []string, messages []chattmpl.Message, limit int) (string, error) {
+	var text strings.Builder
+	for _, message := range messages {
+		speaker := "User"
+		if message.Role == "assistant" {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&text, "%s: %s\n\n", speaker, message.Content)
+	}
+	prompt := format.Render([]chattmpl.Message{{Role: "user", Content: "Summarize this conversation in a short paragraph, keeping the facts, " +
+		"decisions and open questions needed to carry it on. Reply with the summary only.\n\n" + strings.TrimSpace(text.String())}})
+	if n, err := countTokens(cfg, prompt); err != nil || n > limit {
+		return "", fmt.Errorf("the messages are too long to summarize at once")
+	}
+
+	req := samplingRequest(cfg, prompt)
+	req.NPredict = summaryTokens
+	req.Stop = stops
+	summary, _, err := completeRequest(ctx, cfg, req)
+	if err != nil {
+		return "", err
+	}
+	summary, _ = post.StripThink(summary)
+	if summary = strings.TrimSpace(summary); summary == "" {
+		return "", fmt.Errorf("the model returned an empty summary")
+	}
+	return summary, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/session"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// chatLog is the whole of a chat's conversation, with the time of every
+// message, for exporting. Unlike the history sent to the model, nothing is
+// dropped from it to fit the context.
+type chatLog struct {
+	name     string // of the session, or made up when it isn't saved
+	started  time.Time
+	messages []db.Message
+}
+
+// add records a message
+func (l *chatLog) add(role, content string, at time.Time) {
+	l.messages = append(l.messages, db.Message{Role: role, Content: content, CreatedAt: at})
+}
+
+// replaceReply replaces the last reply, once it was continued or generated
+// again
+func (l *chatLog) replaceReply(content string) {
+	if n := len(l.messages); n > 0 && l.messages[n-1].Role == "assistant" {
+		l.messages[n-1].Content = content
+		l.messages[n-1].CreatedAt = time.Now()
+	}
+}
+
+// export writes the conversation with slug, led by its system prompt, to
+// path in the format the path's extension names
+func (l *chatLog) export(store *db.Store, path, slug, params, system string) error {
+	info := &db.Session{Name: l.name, ModelSlug: slug, Params: params, CreatedAt: l.started, UpdatedAt: l.started}
+	messages := l.messages
+	if system != "" {
+		messages = append([]db.Message{{Role: "system", Content: system, CreatedAt: l.started}}, messages...)
+	}
+	if n := len(messages); n > 0 {
+		info.UpdatedAt = messages[n-1].CreatedAt
+	}
+	if err := session.ExportConversation(store, path, info, messages); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Exported the conversation to %s.", path))
+	return nil
+}
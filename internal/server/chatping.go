@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// reconnectAfter is how long a chat can sit idle before its server is
+// checked before the next message is sent
+const reconnectAfter = 30 * time.Second
+
+// chatConnection keeps a chat's server available across long pauses. It
+// can ping the server while the user is idle, so the keep-alive timeout
+// doesn't stop it, and restarts a server that stopped anyway, such as while
+// the computer slept.
+type chatConnection struct {
+	store    *db.Store
+	base     *config.Config // config without the model's settings applied
+	slug     string
+	cfg      atomic.Pointer[config.Config]
+	lastUsed time.Time
+	stop     chan struct{}
+}
+
+func newChatConnection(store *db.Store, base *config.Config, slug string, cfg *config.Config) *chatConnection {
+	c := &chatConnection{store: store, base: base, slug: slug, lastUsed: time.Now(), stop: make(chan struct{})}
+	c.cfg.Store(cfg)
+	return c
+}
+
+// startPings pings the server every interval until close is called
+func (c *chatConnection) startPings(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				cfg := c.cfg.Load()
+				if healthy(cfg) {
+					touchActivity(cfg, apiPort(cfg))
+				}
+			}
+		}
+	}()
+}
+
+// close stops the pings
+func (c *chatConnection) close() {
+	close(c.stop)
+}
+
+// used records a request to the server
+func (c *chatConnection) used() {
+	c.lastUsed = time.Now()
+}
+
+// ensure returns the config of a running server for the chat's model. A
+// server that stopped during a long pause is restarted.
+func (c *chatConnection) ensure() (*config.Config, error) {
+	cfg := c.cfg.Load()
+	if time.Since(c.lastUsed) < reconnectAfter || healthy(cfg) {
+		return cfg, nil
+	}
+
+	ui.PrintInfo(fmt.Sprintf("The server for %s stopped while the chat was idle; restarting it.", c.slug))
+	if err := EnsureServerRunning(c.store, c.base, c.slug); err != nil {
+		return nil, err
+	}
+	cfg, err := ModelConfig(c.store, c.base, c.slug)
+	if err != nil {
+		return nil, err
+	}
+	c.cfg.Store(cfg)
+	return cfg, nil
+}
+
+// healthy reports whether the server cfg sends requests to answers its
+// health check
+func healthy(cfg *config.Config) bool {
+	resp, err := apiRequest(cfg, http.MethodGet, "/health", nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
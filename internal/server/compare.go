@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/render"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// minColumnWidth is the narrowest column replies are shown side by side in;
+// narrower terminals show them one after another
+const minColumnWidth = 30
+
+// CompareOptions controls a comparison
+type CompareOptions struct {
+	Parallel bool // complete on every model at once instead of one at a time
+}
+
+// comparison is one model's reply to the compared prompt
+type comparison struct {
+	slug    string
+	cfg     *config.Config
+	format  *chattmpl.Format
+	reply   string
+	stats   completionStats
+	elapsed time.Duration
+	err     error
+}
+
+// Compare sends text to every model as a chat message and shows the replies
+// side by side with their token counts and timing. Every model's server is
+// started first, each on its own port, so with opts.Parallel the models
+// answer at the same time.
+func Compare(store *db.Store, cfg *config.Config, slugs []string, text string, opts CompareOptions) error {
+	results := make([]*comparison, len(slugs))
+	for i, slug := range slugs {
+		if err := EnsureServerRunning(store, cfg, slug); err != nil {
+			return err
+		}
+		modelCfg, err := ModelConfig(store, cfg, slug)
+		if err != nil {
+			return err
+		}
+		results[i] = &comparison{slug: slug, cfg: modelCfg, format: chatFormat(store, modelCfg, slug)}
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Comparing %s...", strings.Join(slugs, ", ")))
+	if opts.Parallel {
+		var wg sync.WaitGroup
+		for _, c := range results {
+			wg.Add(1)
+			go func(c *comparison) {
+				defer wg.Done()
+				c.complete(text)
+			}(c)
+		}
+		wg.Wait()
+	} else {
+		for _, c := range results {
+			c.complete(text)
+		}
+	}
+
+	width := render.TerminalWidth()
+	columnWidth := (width - 3*(len(results)-1)) / len(results)
+	if ui.Accessible() || columnWidth < minColumnWidth {
+		printSequential(results, width)
+	} else {
+		printColumns(results, columnWidth)
+	}
+
+	if cfg.Persist.History {
+		for _, c := range results {
+			if c.err != nil {
+				continue
+			}
+			if err := store.AddHistory(c.slug, text, c.reply); err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to save history: %v", err))
+			}
+		}
+	}
+	return nil
+}
+
+// complete asks the model for its reply to text in its own chat format
+func (c *comparison) complete(text string) {
+	req := samplingRequest(c.cfg, c.format.Render([]chattmpl.Message{{Role: "user", Content: text}}))
+	req.Stop = append([]string{}, c.cfg.Stop...)
+	for _, stop := range c.format.Stops {
+		if !slices.Contains(req.Stop, stop) {
+			req.Stop = append(req.Stop, stop)
+		}
+	}
+
+	start := time.Now()
+	var result map[string]interface{}
+	if c.err = postJSON(c.cfg, "/completion", req, &result); c.err != nil {
+		return
+	}
+	c.elapsed = time.Since(start)
+	content, _ := result["content"].(string)
+	c.reply, _ = post.StripThink(content)
+	c.reply = strings.TrimSpace(c.reply)
+	c.stats = statsFromResult(result)
+}
+
+// summary describes the reply's length and timing, e.g.
+// "96 tokens · 24.1 tok/s · 4.2s", or the error that prevented it
+func (c *comparison) summary() string {
+	if c.err != nil {
+		return "failed: " + c.err.Error()
+	}
+	parts := []string{fmt.Sprintf("%d tokens", c.stats.PredictedTokens)}
+	if c.stats.TokensPerSecond > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f tok/s", c.stats.TokensPerSecond))
+	}
+	parts = append(parts, fmt.Sprintf("%.1fs", c.elapsed.Seconds()))
+	return strings.Join(parts, " · ")
+}
+
+// wrap returns text word-wrapped to width as lines
+func wrap(text string, width int) []string {
+	var b strings.Builder
+	w := render.NewWrapper(&b, width, 0)
+	w.Write([]byte(text))
+	w.Close()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// printColumns prints the replies next to each other, each in a column
+// width characters wide headed by its model and followed by its summary
+func printColumns(results []*comparison, width int) {
+	// The headings, replies and summaries each line up across the columns
+	columns := make([][]string, len(results))
+	for _, section := range []func(c *comparison) []string{
+		func(c *comparison) []string { return append(wrap(c.slug, width), strings.Repeat("─", width)) },
+		func(c *comparison) []string { return wrap(c.reply, width) },
+		func(c *comparison) []string { return append([]string{""}, wrap(c.summary(), width)...) },
+	} {
+		parts := make([][]string, len(results))
+		rows := 0
+		for i, c := range results {
+			parts[i] = section(c)
+			rows = max(rows, len(parts[i]))
+		}
+		for i, lines := range parts {
+			columns[i] = append(append(columns[i], lines...), make([]string, rows-len(lines))...)
+		}
+	}
+
+	fmt.Println()
+	for row := range columns[0] {
+		cells := make([]string, len(columns))
+		for i, lines := range columns {
+			cells[i] = lines[row] + strings.Repeat(" ", max(width-utf8.RuneCountInString(lines[row]), 0))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(cells, " │ "), " "))
+	}
+}
+
+// printSequential prints the replies one after another
+func printSequential(results []*comparison, width int) {
+	for _, c := range results {
+		fmt.Println()
+		fmt.Printf("Reply from %s:\n", c.slug)
+		ui.Rule(min(width, 80))
+		if c.err == nil {
+			for _, line := range wrap(c.reply, width) {
+				fmt.Println(line)
+			}
+		}
+		fmt.Println(c.summary())
+	}
+}
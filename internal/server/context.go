@@ -0,0 +1,98 @@
+package server
+
+import (
+	"os"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/gguf"
+)
+
+const (
+	// minAutoContext is the smallest context chosen automatically, unless
+	// the model was trained with less
+	minAutoContext = 2048
+	// memoryShare is the share of physical memory the model and its KV
+	// cache may use together
+	memoryShare = 0.75
+)
+
+// AutoContext returns the context size used for a model without a ctx-size
+// setting: the context it was trained with, capped by the hardware profile
+// and by how much f16 KV cache fits in memory next to the model weights.
+// It returns 0 when the trained context is unknown, leaving llama-server's
+// default in place.
+func AutoContext(cfg *config.Config, model *db.Model) int {
+	f, err := gguf.Open(model.FilePath)
+	if err != nil {
+		return 0
+	}
+
+	arch, _ := f.String("general.architecture")
+	trained, ok := f.Uint(arch + ".context_length")
+	if !ok || trained == 0 {
+		return 0
+	}
+
+	ctx := int(trained)
+	if profile := cfg.Profile(); profile != nil && profile.CtxSize < ctx {
+		ctx = profile.CtxSize
+	}
+
+	if perToken := kvBytesPerToken(f, arch); perToken > 0 {
+		if total := config.SystemMemory(); total > 0 {
+			budget := int64(float64(total)*memoryShare) - modelSize(model)
+			if fits := int(budget / perToken); fits < ctx {
+				ctx = fits
+			}
+		}
+	}
+
+	// Round down to a multiple of 1024 but keep a usable minimum
+	if ctx > 1024 {
+		ctx -= ctx % 1024
+	}
+	if ctx < minAutoContext {
+		ctx = minAutoContext
+	}
+	if ctx > int(trained) {
+		ctx = int(trained)
+	}
+	return ctx
+}
+
+// kvBytesPerToken estimates the size of the f16 KV cache for one token of
+// context, or 0 if the model's dimensions aren't in its metadata
+func kvBytesPerToken(f *gguf.File, arch string) int64 {
+	layers, _ := f.Uint(arch + ".block_count")
+	embedding, _ := f.Uint(arch + ".embedding_length")
+	heads, _ := f.Uint(arch + ".attention.head_count")
+	if layers == 0 || embedding == 0 || heads == 0 {
+		return 0
+	}
+
+	kvHeads, ok := f.Uint(arch + ".attention.head_count_kv")
+	if !ok || kvHeads == 0 {
+		kvHeads = heads
+	}
+
+	// Keys and values, 2 bytes per element
+	kvEmbedding := embedding / heads * kvHeads
+	return int64(2 * layers * kvEmbedding * 2)
+}
+
+// modelSize returns the size of a model's weights across all shards
+func modelSize(model *db.Model) int64 {
+	paths := gguf.ShardPaths(model.FilePath)
+	if paths == nil {
+		paths = []string{model.FilePath}
+	}
+
+	var size int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
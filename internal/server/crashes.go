@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// A model whose server fails crashLimit times within crashWindow is
+// quarantined: it is no longer started automatically until unquarantined
+const (
+	crashLimit  = 3
+	crashWindow = 10 * time.Minute
+)
+
+// recordCrash records a failed server start, or a crash of a server that
+// llm-cli or the daemon started and is still watching, and quarantines the
+// model once it is crash-looping
+func recordCrash(store *db.Store, model *db.Model, failure error) {
+	count, err := store.RecordServerCrash(model.Slug, failure.Error(), time.Now().Add(-crashWindow))
+	if err != nil {
+		ui.PrintWarn(err.Error())
+		return
+	}
+	if count < crashLimit {
+		return
+	}
+
+	reason := fmt.Sprintf("%d failed starts or crashes within %s, last: %v", count, crashWindow, failure)
+	if err := store.SetModelQuarantine(model.Slug, reason); err != nil {
+		ui.PrintWarn(err.Error())
+		return
+	}
+	ui.PrintWarn(fmt.Sprintf("Model %s keeps crashing and has been quarantined. Run 'llm-cli unquarantine %s' after fixing it.", model.Slug, model.Slug))
+}
+
+// crashed reports whether a server's exit status, as returned by Wait, is
+// a crash rather than a clean exit or being stopped
+func crashed(err error) bool {
+	var exit *exec.ExitError
+	return errors.As(err, &exit) && !stoppedOnRequest(exit.ProcessState)
+}
+
+// checkQuarantine refuses to start a quarantined model automatically
+func checkQuarantine(model *db.Model) error {
+	if model.Quarantine == "" {
+		return nil
+	}
+	return fmt.Errorf("model %s is quarantined (%s); run 'llm-cli unquarantine %s' to allow restarts", model.Slug, model.Quarantine, model.Slug)
+}
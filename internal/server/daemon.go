@@ -0,0 +1,526 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+const (
+	// restartDelay is how long the daemon waits before restarting a crashed server
+	restartDelay = 2 * time.Second
+	// reapInterval is how often the daemon looks for idle servers
+	reapInterval = 15 * time.Second
+	// taskInterval is how often the daemon runs the scheduled tasks that are due
+	taskInterval = time.Minute
+)
+
+// DaemonServer is a llama-server owned by the daemon
+type DaemonServer struct {
+	Slug      string    `json:"slug"`
+	Path      string    `json:"path"`
+	PID       int       `json:"pid"`
+	Port      int       `json:"port"`
+	Started   time.Time `json:"started"`
+	LastUsed  time.Time `json:"last_used"`
+	Restarts  int       `json:"restarts"`
+	KeepAlive string    `json:"keep_alive,omitempty"` // idle timeout requested for this server
+}
+
+// DaemonStatus describes the running daemon and its servers
+type DaemonStatus struct {
+	PID         int            `json:"pid"`
+	Started     time.Time      `json:"started"`
+	IdleTimeout string         `json:"idle_timeout"`
+	Servers     []DaemonServer `json:"servers"`
+}
+
+// stopRequest selects servers to stop by slug, model path or PID; an empty
+// request selects every server
+type stopRequest struct {
+	Slug string `json:"slug,omitempty"`
+	Path string `json:"path,omitempty"`
+	PID  int    `json:"pid,omitempty"`
+}
+
+// child is a server the supervisor owns. ready is closed once a launch
+// finishes, with err set if it failed.
+type child struct {
+	DaemonServer
+	proc     *process
+	idle     time.Duration // overrides the daemon's idle timeout when set
+	ready    chan struct{}
+	err      error
+	stopping bool
+	// restartReason is why the supervisor stopped the server to restart
+	// it, when it did
+	restartReason string
+}
+
+// supervisor starts servers on request, restarts them when they crash and
+// stops them once idle
+type supervisor struct {
+	store    *db.Store
+	cfg      *config.Config
+	idle     time.Duration
+	started  time.Time
+	mu       sync.Mutex
+	children map[string]*child
+	done     chan struct{}
+	once     sync.Once
+}
+
+// EnsureFunc starts a model's server unless it is running and waits until
+// it is ready
+type EnsureFunc func(slug string) error
+
+// ServeDaemon runs the supervisor in the foreground until it is stopped
+// with 'daemon stop' or a signal. runTasks, if not nil, is called every
+// minute to run the scheduled tasks that are due, with a function that
+// starts their models' servers under the supervisor.
+func ServeDaemon(store *db.Store, cfg *config.Config, runTasks func(ensure EnsureFunc)) error {
+	idle, err := cfg.DaemonIdleTimeout()
+	if err != nil {
+		return err
+	}
+
+	socket := cfg.DaemonSocketPath()
+	if daemonRunning(cfg) {
+		return fmt.Errorf("daemon is already running (socket %s)", socket)
+	}
+	// A socket left behind by a daemon that didn't exit cleanly
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", socket, err)
+	}
+	defer os.Remove(socket)
+
+	s := &supervisor{
+		store:    store,
+		cfg:      cfg,
+		idle:     idle,
+		started:  time.Now(),
+		children: make(map[string]*child),
+		done:     make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/start", s.handleStart)
+	mux.HandleFunc("/stop", s.handleStop)
+	mux.HandleFunc("/shutdown", s.handleShutdown)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	httpServer := &http.Server{Handler: mux}
+	go httpServer.Serve(listener)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		s.shutdown()
+	}()
+
+	go s.reapIdle()
+	go s.watchHealth()
+	if runTasks != nil {
+		go s.runTasks(runTasks)
+	}
+	if len(cfg.Starred) > 0 {
+		go s.warmupDaemon()
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Daemon listening on %s (PID %d).", socket, os.Getpid()))
+	<-s.done
+
+	ui.PrintInfo("Daemon stopping servers...")
+	s.stop(stopRequest{})
+	httpServer.Close()
+	return nil
+}
+
+// shutdown ends ServeDaemon
+func (s *supervisor) shutdown() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// ensure starts the model's server unless it is already running or starting,
+// waits until it is ready and marks it as used. A keepAlive other than 0
+// replaces the daemon's idle timeout for the server; evict lets it stop
+// other servers to keep within the memory budget.
+func (s *supervisor) ensure(slug string, keepAlive time.Duration, evict bool) (DaemonServer, error) {
+	s.mu.Lock()
+	c, ok := s.children[slug]
+	if !ok {
+		c = &child{DaemonServer: DaemonServer{Slug: slug}, ready: make(chan struct{})}
+		s.children[slug] = c
+		go s.launch(c, evict)
+	}
+	if keepAlive > 0 {
+		c.idle = keepAlive
+		c.KeepAlive = keepAlive.String()
+	}
+	c.LastUsed = time.Now()
+	ready := c.ready
+	s.mu.Unlock()
+
+	<-ready
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.err != nil {
+		return DaemonServer{}, c.err
+	}
+	return c.DaemonServer, nil
+}
+
+// launch starts a child's server and closes its ready channel. A child whose
+// server can't be started is forgotten so the next request tries again.
+func (s *supervisor) launch(c *child, evict bool) {
+	model, err := s.store.GetModelBySlug(c.Slug)
+	if err == nil {
+		err = checkQuarantine(model)
+	}
+	if err == nil {
+		// Take over from a server started outside the daemon
+		err = stopProcesses(s.store, model.FilePath)
+	}
+	var release func()
+	if err == nil {
+		release, err = makeRoom(s.store, s.cfg, model, evict, s.evict)
+	}
+	var proc *process
+	if err == nil {
+		proc, err = launchServer(context.Background(), s.store, s.cfg, model, nil)
+		release()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		c.err = err
+		if s.children[c.Slug] == c {
+			delete(s.children, c.Slug)
+		}
+		close(c.ready)
+		return
+	}
+
+	c.proc = proc
+	c.Path = model.FilePath
+	c.PID = proc.cmd.Process.Pid
+	c.Port = proc.port
+	c.Started = time.Now()
+	close(c.ready)
+
+	if c.stopping {
+		// Stopped while it was starting
+		go terminate(proc)
+		return
+	}
+	go s.supervise(c, proc)
+}
+
+// evict stops a server to make room for another, whether the daemon or
+// llm-cli started it
+func (s *supervisor) evict(srv db.Server) error {
+	s.stop(stopRequest{Path: srv.ModelPath})
+	return stopProcesses(s.store, srv.ModelPath)
+}
+
+// supervise waits for a child's server to exit and restarts it unless it
+// was stopped on purpose
+func (s *supervisor) supervise(c *child, proc *process) {
+	<-proc.done
+
+	s.mu.Lock()
+	if c.stopping || s.children[c.Slug] != c {
+		s.mu.Unlock()
+		return
+	}
+	c.Restarts++
+	c.proc = nil
+	c.ready = make(chan struct{})
+	restarted := c.restartReason != ""
+	c.restartReason = ""
+	s.mu.Unlock()
+
+	delay := restartDelay
+	if restarted {
+		// Stopped by the supervisor rather than crashed
+		delay = 0
+	} else {
+		// launchServer counts the crash toward quarantining the model
+		ui.PrintWarn(fmt.Sprintf("Server for model %s (PID %d) crashed: %v. Restarting...", c.Slug, proc.cmd.Process.Pid, proc.err))
+	}
+
+	select {
+	case <-time.After(delay):
+		s.launch(c, true)
+	case <-s.done:
+		s.mu.Lock()
+		c.err = fmt.Errorf("daemon is stopping")
+		close(c.ready)
+		s.mu.Unlock()
+	}
+}
+
+// stop terminates the servers selected by req and returns their slugs
+func (s *supervisor) stop(req stopRequest) []string {
+	s.mu.Lock()
+	var slugs []string
+	var procs []*process
+	for slug, c := range s.children {
+		if (req.Slug != "" && req.Slug != slug) || (req.Path != "" && req.Path != c.Path) || (req.PID != 0 && req.PID != c.PID) {
+			continue
+		}
+		c.stopping = true
+		delete(s.children, slug)
+		slugs = append(slugs, slug)
+		// A server still starting is stopped by launch once it is up
+		if c.proc != nil {
+			procs = append(procs, c.proc)
+		}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proc := range procs {
+		wg.Add(1)
+		go func(proc *process) {
+			defer wg.Done()
+			terminate(proc)
+		}(proc)
+	}
+	wg.Wait()
+
+	sort.Strings(slugs)
+	return slugs
+}
+
+// runTasks calls run every taskInterval until the daemon stops
+func (s *supervisor) runTasks(run func(ensure EnsureFunc)) {
+	ticker := time.NewTicker(taskInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			run(s.ensureTask)
+		}
+	}
+}
+
+// ensureTask starts a scheduled task's model as a /start request would,
+// without the round trip through the daemon's own socket
+func (s *supervisor) ensureTask(slug string) error {
+	if s.cfg.RemoteBackend() {
+		return checkRemoteBackend(s.cfg)
+	}
+	model, err := s.store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	if s.cfg.Persist.Usage {
+		if err := s.store.UpdateModelLastUsed(slug); err != nil {
+			return fmt.Errorf("updating last used timestamp: %w", err)
+		}
+	}
+	keepAlive, err := time.ParseDuration(s.cfg.KeepAlive)
+	if s.cfg.KeepAlive == "" || err != nil {
+		keepAlive = 0
+	}
+	if _, err := s.ensure(slug, keepAlive, !s.cfg.NoEvict); err != nil {
+		return err
+	}
+	s.store.TouchServer(model.FilePath)
+	return nil
+}
+
+// reapIdle stops servers that haven't been used for their idle timeout,
+// going by the last request to each as well as the last /start, since
+// clients send requests straight to the servers
+func (s *supervisor) reapIdle() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.noteRequests()
+		s.mu.Lock()
+		var idle []*child
+		ports := make(map[*child]int)
+		for _, c := range s.children {
+			timeout := s.idle
+			if c.idle > 0 {
+				timeout = c.idle
+			}
+			if c.proc != nil && timeout > 0 && time.Since(c.LastUsed) > timeout {
+				idle = append(idle, c)
+				ports[c] = c.Port
+			}
+		}
+		s.mu.Unlock()
+
+		for _, c := range idle {
+			// A long generation counts as use even without new requests
+			if serverBusy(s.cfg, ports[c]) {
+				s.mu.Lock()
+				c.LastUsed = time.Now()
+				s.mu.Unlock()
+				continue
+			}
+			ui.PrintInfo(fmt.Sprintf("Stopping idle server for model %s.", c.Slug))
+			s.stop(stopRequest{Slug: c.Slug})
+		}
+	}
+}
+
+// noteRequests marks the servers as used when requests were last sent
+// to them, which llm-cli records in the store
+func (s *supervisor) noteRequests() {
+	servers, err := s.store.GetServers()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.children {
+		for _, srv := range servers {
+			if srv.PID == c.PID && srv.LastUsed.After(c.LastUsed) {
+				c.LastUsed = srv.LastUsed
+			}
+		}
+	}
+}
+
+// status returns the daemon's state with servers sorted by slug
+func (s *supervisor) status() DaemonStatus {
+	s.noteRequests()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := DaemonStatus{PID: os.Getpid(), Started: s.started, IdleTimeout: "off"}
+	if s.idle > 0 {
+		status.IdleTimeout = s.idle.String()
+	}
+	for _, c := range s.children {
+		if c.proc != nil {
+			status.Servers = append(status.Servers, c.DaemonServer)
+		}
+	}
+	sort.Slice(status.Servers, func(i, j int) bool { return status.Servers[i].Slug < status.Servers[j].Slug })
+	return status
+}
+
+func (s *supervisor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.status())
+}
+
+func (s *supervisor) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Slug      string `json:"slug"`
+		KeepAlive string `json:"keep_alive"`
+		NoEvict   bool   `json:"no_evict"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Slug == "" {
+		http.Error(w, "start requires a model slug", http.StatusBadRequest)
+		return
+	}
+	keepAlive, err := time.ParseDuration(req.KeepAlive)
+	if req.KeepAlive == "" || err != nil {
+		keepAlive = 0
+	}
+
+	srv, err := s.ensure(req.Slug, keepAlive, !req.NoEvict)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, srv)
+}
+
+func (s *supervisor) handleStop(w http.ResponseWriter, r *http.Request) {
+	var req stopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.stop(req))
+}
+
+func (s *supervisor) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]int{"pid": os.Getpid()})
+	s.shutdown()
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// terminate stops a server started by this process, killing it if it
+// doesn't exit within 30 seconds
+func terminate(proc *process) {
+	stopProcess(proc.cmd.Process.Pid, false)
+	select {
+	case <-proc.done:
+	case <-time.After(30 * time.Second):
+		proc.cmd.Process.Kill()
+		<-proc.done
+	}
+}
+
+// serverBusy reports whether any of a server's slots is processing a request
+func serverBusy(cfg *config.Config, port int) bool {
+	return activeRequests(cfg, port) > 0
+}
+
+// activeRequests returns how many of a server's slots are processing a
+// request, or -1 if the server doesn't say
+func activeRequests(cfg *config.Config, port int) int {
+	shared, baseURL := httpTarget(modelURL(cfg, port))
+	client := *shared
+	client.Timeout = 5 * time.Second
+	resp, err := client.Get(baseURL + "/slots")
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+
+	var slots []struct {
+		IsProcessing bool `json:"is_processing"`
+		State        int  `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&slots); err != nil {
+		return -1
+	}
+	active := 0
+	for _, slot := range slots {
+		if slot.IsProcessing || slot.State != 0 {
+			active++
+		}
+	}
+	return active
+}
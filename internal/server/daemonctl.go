@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// daemonClient returns an HTTP client that talks to the daemon's control socket
+func daemonClient(cfg *config.Config, timeout time.Duration) *http.Client {
+	socket := cfg.DaemonSocketPath()
+	return &http.Client{
+		Timeout: timeout,
+		Transport: ui.LoggingTransport(&http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}),
+	}
+}
+
+// daemonCall sends a request to the daemon and decodes its JSON response
+// into out. A nil req makes a GET request.
+func daemonCall(cfg *config.Config, endpoint string, req, out interface{}, timeout time.Duration) error {
+	client := daemonClient(cfg, timeout)
+	url := "http://daemon" + endpoint
+
+	var resp *http.Response
+	var err error
+	if req == nil {
+		resp, err = client.Get(url)
+	} else {
+		body, marshalErr := json.Marshal(req)
+		if marshalErr != nil {
+			return fmt.Errorf("marshaling request: %w", marshalErr)
+		}
+		resp, err = client.Post(url, "application/json", bytes.NewReader(body))
+	}
+	if err != nil {
+		return fmt.Errorf("contacting daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding daemon response: %w", err)
+	}
+	return nil
+}
+
+// daemonStatus returns the daemon's status, or nil if it isn't running
+func daemonStatus(cfg *config.Config) *DaemonStatus {
+	var status DaemonStatus
+	if err := daemonCall(cfg, "/status", nil, &status, 2*time.Second); err != nil {
+		return nil
+	}
+	return &status
+}
+
+// daemonRunning reports whether the daemon answers on its control socket
+func daemonRunning(cfg *config.Config) bool {
+	return daemonStatus(cfg) != nil
+}
+
+// daemonRelease asks the daemon to stop the servers selected by req so it
+// doesn't restart them, returning their slugs. Without a daemon it does nothing.
+func daemonRelease(cfg *config.Config, req stopRequest) ([]string, error) {
+	if !daemonRunning(cfg) {
+		return nil, nil
+	}
+	var slugs []string
+	if err := daemonCall(cfg, "/stop", req, &slugs, time.Minute); err != nil {
+		return nil, fmt.Errorf("stopping servers through daemon: %w", err)
+	}
+	return slugs, nil
+}
+
+// StartDaemon starts the supervising daemon in the background
+func StartDaemon(cfg *config.Config) error {
+	if status := daemonStatus(cfg); status != nil {
+		ui.PrintInfo(fmt.Sprintf("Daemon is already running (PID %d).", status.PID))
+		return nil
+	}
+	if _, err := cfg.DaemonIdleTimeout(); err != nil {
+		return err
+	}
+
+	logFile := cfg.DaemonLogPath()
+	if !cfg.Persist.Logs {
+		logFile = os.DevNull
+	}
+	if _, err := spawnDetached(logFile, "daemon", "run"); err != nil {
+		return fmt.Errorf("starting daemon: %w", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if status := daemonStatus(cfg); status != nil {
+			ui.PrintInfo(fmt.Sprintf("Daemon started with PID %d. Logs: %s", status.PID, logFile))
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("daemon did not start (logs: %s)", logFile)
+}
+
+// spawnDetached starts llm-cli with args in a new session, so it outlives
+// this command, appending its output to logFile
+func spawnDetached(logFile string, args ...string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("finding llm-cli executable: %w", err)
+	}
+
+	logOut, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("opening log file: %w", err)
+	}
+	defer logOut.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	detachProcess(cmd)
+	ui.LogCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+	return pid, nil
+}
+
+// StopDaemon stops the daemon and the servers it owns
+func StopDaemon(cfg *config.Config) error {
+	if !daemonRunning(cfg) {
+		ui.PrintWarn("Daemon is not running.")
+		return nil
+	}
+
+	ui.PrintInfo("Stopping daemon and its servers...")
+	var resp struct {
+		PID int `json:"pid"`
+	}
+	if err := daemonCall(cfg, "/shutdown", struct{}{}, &resp, 5*time.Second); err != nil {
+		return err
+	}
+
+	for i := 0; i < 60; i++ {
+		if !daemonRunning(cfg) {
+			ui.PrintInfo(fmt.Sprintf("Daemon (PID %d) stopped.", resp.PID))
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("daemon (PID %d) did not stop", resp.PID)
+}
+
+// ShowDaemonStatus prints the daemon's state and the servers it owns
+func ShowDaemonStatus(cfg *config.Config) error {
+	status := daemonStatus(cfg)
+	if status == nil {
+		fmt.Println("Daemon is not running.")
+		return nil
+	}
+
+	fmt.Printf("Daemon running with PID %d for %s (idle timeout: %s, socket: %s)\n",
+		status.PID, time.Since(status.Started).Round(time.Second), status.IdleTimeout, cfg.DaemonSocketPath())
+	if len(status.Servers) == 0 {
+		fmt.Println("No servers running.")
+		return nil
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tPID\tPORT\tUPTIME\tIDLE\tRESTARTS")
+	for _, srv := range status.Servers {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%d\n", srv.Slug, srv.PID, srv.Port,
+			time.Since(srv.Started).Round(time.Second), time.Since(srv.LastUsed).Round(time.Second), srv.Restarts)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// EmbedFileOptions controls embedding every input of a file
+type EmbedFileOptions struct {
+	Input     string // text file with one input per line, or JSONL
+	Output    string // file the vectors are written to; empty writes to stdout
+	Format    string // jsonl (default) or csv
+	BatchSize int    // inputs sent per request
+}
+
+// EmbedFile embeds every input of a file in batches and writes the vectors
+// as JSONL, one {"id", "embedding"} object per input, or as CSV with the id
+// in the first column. Inputs are the lines of a text file, or in a .jsonl
+// file JSON strings or objects with "text" and an optional "id"; the line
+// number is used when there is no id.
+func EmbedFile(store *db.Store, cfg *config.Config, slug string, opts EmbedFileOptions) error {
+	if opts.Format == "" {
+		opts.Format = "jsonl"
+	}
+	if opts.Format != "jsonl" && opts.Format != "csv" {
+		return fmt.Errorf("unsupported embedding format: %s (use jsonl or csv)", opts.Format)
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 32
+	}
+
+	ext := strings.ToLower(filepath.Ext(opts.Input))
+	jsonl := ext == ".jsonl" || ext == ".ndjson"
+	inputs, err := readBatchPrompts(opts.Input, "text", !jsonl)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no inputs in %s", opts.Input)
+	}
+
+	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+		return err
+	}
+	cfg, err = ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := bufio.NewWriter(out)
+	csvWriter := csv.NewWriter(writer)
+	encoder := json.NewEncoder(writer)
+
+	// Progress is shown when the embeddings go to a file rather than the terminal
+	progress := ui.NewProgress(os.Stderr)
+	dimension := 0
+	for start := 0; start < len(inputs); start += opts.BatchSize {
+		batch := inputs[start:min(start+opts.BatchSize, len(inputs))]
+		texts := make([]string, len(batch))
+		for i, input := range batch {
+			texts[i] = input.Prompt
+		}
+		vectors, err := embedTexts(context.Background(), cfg, texts)
+		if err != nil {
+			return fmt.Errorf("embedding inputs %d-%d: %w", start+1, start+len(batch), err)
+		}
+
+		for i, vector := range vectors {
+			if dimension == 0 {
+				dimension = len(vector)
+				if opts.Format == "csv" {
+					header := []string{"id"}
+					for d := range vector {
+						header = append(header, fmt.Sprintf("d%d", d))
+					}
+					csvWriter.Write(header)
+				}
+			}
+			if opts.Format == "jsonl" {
+				err = encoder.Encode(struct {
+					ID        json.RawMessage `json:"id"`
+					Embedding []float64       `json:"embedding"`
+				}{batch[i].ID, vector})
+			} else {
+				id := string(batch[i].ID)
+				// String ids are written without their JSON quotes
+				json.Unmarshal(batch[i].ID, &id)
+				record := []string{id}
+				for _, x := range vector {
+					record = append(record, strconv.FormatFloat(x, 'g', -1, 64))
+				}
+				err = csvWriter.Write(record)
+			}
+			if err != nil {
+				return fmt.Errorf("writing embeddings: %w", err)
+			}
+		}
+		if opts.Output != "" {
+			done := start + len(batch)
+			progress.Update(float64(done)/float64(len(inputs)),
+				fmt.Sprintf("%d/%d embedded", done, len(inputs)),
+				fmt.Sprintf("Embedded %d of %d inputs.", done, len(inputs)))
+		}
+	}
+	progress.Done()
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("writing embeddings: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("writing embeddings: %w", err)
+	}
+	if opts.Output != "" {
+		ui.PrintInfo(fmt.Sprintf("Wrote %d embeddings of dimension %d to %s.", len(inputs), dimension, opts.Output))
+	}
+	return nil
+}
+
+// Embeddings makes sure the model's server is running and returns the
+// embeddings of texts, batchSize at a time
+func Embeddings(store *db.Store, cfg *config.Config, slug string, texts []string, batchSize int) ([][]float64, error) {
+	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+		return nil, err
+	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return nil, err
+	}
+	return EmbedBatches(cfg, texts, batchSize)
+}
+
+// EmbedBatches returns the embeddings of texts from the running server of
+// a model's config, as returned by ModelConfig, batchSize at a time
+func EmbedBatches(cfg *config.Config, texts []string, batchSize int) ([][]float64, error) {
+	return EmbedBatchesContext(context.Background(), cfg, texts, batchSize)
+}
+
+// EmbedBatchesContext is EmbedBatches, stopping when ctx is done
+func EmbedBatchesContext(ctx context.Context, cfg *config.Config, texts []string, batchSize int) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		batch, err := embedTexts(ctx, cfg, texts[start:min(start+batchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embedTexts embeds several texts with one request. Servers that don't
+// accept a list of inputs get one request per text instead.
+func embedTexts(ctx context.Context, cfg *config.Config, texts []string) ([][]float64, error) {
+	var value interface{}
+	if err := postJSONContext(ctx, cfg, "/embedding", map[string][]string{"content": texts}, &value); err == nil {
+		if vectors, ok := batchEmbeddings(value, len(texts)); ok {
+			return vectors, nil
+		}
+	}
+
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector, err := embedText(ctx, cfg, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// batchEmbeddings reads the vectors of a batched /embedding response, a
+// list with an {"index", "embedding"} entry per input
+func batchEmbeddings(value interface{}, count int) ([][]float64, bool) {
+	entries, ok := value.([]interface{})
+	if !ok || len(entries) != count {
+		return nil, false
+	}
+	vectors := make([][]float64, count)
+	for i, entry := range entries {
+		index := i
+		if m, ok := entry.(map[string]interface{}); ok {
+			if n, ok := m["index"].(float64); ok {
+				index = int(n)
+			}
+		}
+		vector, err := extractEmbedding(entry)
+		if err != nil || index < 0 || index >= count || vectors[index] != nil {
+			return nil, false
+		}
+		vectors[index] = vector
+	}
+	return vectors, true
+}
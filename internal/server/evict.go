@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// roomMu is held from checking the memory budget for a server until it has
+// been started, so two servers starting at once can't both be given the
+// room left for one
+var roomMu sync.Mutex
+
+// makeRoom makes sure the weights of model fit in the memory budget next to
+// those of the models already running, stopping the least recently used
+// idle servers with stop until they do. Without a memory_budget it does
+// nothing; with evict false it fails instead of stopping anything. Unless
+// it fails, the caller starts the server and then calls release, and other
+// servers wait until then to check the budget.
+func makeRoom(store *db.Store, cfg *config.Config, model *db.Model, evict bool, stop func(srv db.Server) error) (release func(), err error) {
+	budget, err := cfg.MemoryBudgetBytes()
+	if err != nil {
+		return nil, err
+	}
+	if budget == 0 {
+		return func() {}, nil
+	}
+	roomMu.Lock()
+	if err := fitInBudget(store, cfg, model, budget, evict, stop); err != nil {
+		roomMu.Unlock()
+		return nil, err
+	}
+	return roomMu.Unlock, nil
+}
+
+// fitInBudget stops servers with stop until model fits in budget
+func fitInBudget(store *db.Store, cfg *config.Config, model *db.Model, budget int64, evict bool, stop func(srv db.Server) error) error {
+	size := modelSize(model)
+	if size > budget {
+		return fmt.Errorf("model %s needs %s, more than the memory budget of %s", model.Slug, formatGiB(size), formatGiB(budget))
+	}
+
+	servers, err := runningServers(store)
+	if err != nil {
+		return err
+	}
+	var loaded []db.Server
+	var used int64
+	for _, srv := range servers {
+		if srv.ModelPath == model.FilePath {
+			continue
+		}
+		if srv.Size == 0 {
+			srv.Size = modelSize(&db.Model{FilePath: srv.ModelPath})
+		}
+		used += srv.Size
+		loaded = append(loaded, srv)
+	}
+	if used+size <= budget {
+		return nil
+	}
+	if !evict {
+		return fmt.Errorf("starting %s would take the running models to %s, past the memory budget of %s; stop one with 'llm-cli kill <slug>' or leave out --no-evict",
+			model.Slug, formatGiB(used+size), formatGiB(budget))
+	}
+
+	// Least recently used first
+	sort.SliceStable(loaded, func(i, j int) bool {
+		return loaded[i].LastUsed.Before(loaded[j].LastUsed)
+	})
+	for _, srv := range loaded {
+		if used+size <= budget {
+			break
+		}
+		// Never cut off a request in progress
+		if serverBusy(cfg, srv.Port) {
+			continue
+		}
+		ui.PrintInfo(fmt.Sprintf("Stopping %s, last used %s ago, to fit %s in the memory budget of %s.",
+			srv.Slug, time.Since(srv.LastUsed).Round(time.Second), model.Slug, formatGiB(budget)))
+		if err := stop(srv); err != nil {
+			return fmt.Errorf("stopping %s to make room: %w", srv.Slug, err)
+		}
+		used -= srv.Size
+	}
+	if used+size > budget {
+		return fmt.Errorf("starting %s would take the running models to %s, past the memory budget of %s, and the others are busy",
+			model.Slug, formatGiB(used+size), formatGiB(budget))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// completionStats are the token counts and speed of a completion, as
+// reported in the server's final response
+type completionStats struct {
+	PromptTokens    int // 0 if the server didn't report it
+	PredictedTokens int
+	TokensPerSecond float64
+	PromptMS        float64 // time spent evaluating the prompt
+	PredictedMS     float64 // time spent generating
+	PromptPerSecond float64 // prompt tokens evaluated per second, not counting cached ones
+}
+
+// statsFromResult reads the token counts and timings of a final completion response
+func statsFromResult(result map[string]interface{}) completionStats {
+	var stats completionStats
+	if n, ok := result["tokens_evaluated"].(float64); ok {
+		stats.PromptTokens = int(n)
+	}
+	if n, ok := result["tokens_predicted"].(float64); ok {
+		stats.PredictedTokens = int(n)
+	}
+	if timings, ok := result["timings"].(map[string]interface{}); ok {
+		if n, ok := timings["predicted_n"].(float64); ok && stats.PredictedTokens == 0 {
+			stats.PredictedTokens = int(n)
+		}
+		stats.TokensPerSecond, _ = timings["predicted_per_second"].(float64)
+		stats.PromptMS, _ = timings["prompt_ms"].(float64)
+		stats.PromptPerSecond, _ = timings["prompt_per_second"].(float64)
+		stats.PredictedMS, _ = timings["predicted_ms"].(float64)
+	}
+	return stats
+}
+
+// add combines the stats of a continuation with those of the completion it continues
+func (s *completionStats) add(more completionStats) {
+	s.PromptTokens += more.PromptTokens
+	s.PredictedTokens += more.PredictedTokens
+	s.PromptMS += more.PromptMS
+	s.PredictedMS += more.PredictedMS
+	if s.PredictedMS > 0 {
+		s.TokensPerSecond = float64(s.PredictedTokens) / s.PredictedMS * 1000
+	} else {
+		s.TokensPerSecond = more.TokensPerSecond
+	}
+}
+
+// countTokens returns how many tokens the running server's model splits text into
+func countTokens(cfg *config.Config, text string) (int, error) {
+	var result struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := postJSON(cfg, "/tokenize", tokenizeRequest{Content: text}, &result); err != nil {
+		return 0, err
+	}
+	return len(result.Tokens), nil
+}
+
+// serverContext returns the context size of the running server, or 0 if
+// it can't be determined
+func serverContext(cfg *config.Config) int {
+	resp, err := apiRequest(cfg, http.MethodGet, "/props", nil)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	var props interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&props); err != nil {
+		return 0
+	}
+	return effectiveContext(props)
+}
+
+// runSummary summarizes a streamed completion, e.g.
+// "812 prompt tokens in 0.31s · 96 tokens at 24.1 tok/s · 4.2s"
+func runSummary(stats completionStats, elapsed time.Duration) string {
+	prompt := fmt.Sprintf("%d prompt tokens", stats.PromptTokens)
+	if stats.PromptMS > 0 {
+		prompt += fmt.Sprintf(" in %.2fs", stats.PromptMS/1000)
+	}
+	generated := fmt.Sprintf("%d tokens", stats.PredictedTokens)
+	if stats.TokensPerSecond > 0 {
+		generated += fmt.Sprintf(" at %.1f tok/s", stats.TokensPerSecond)
+	}
+	return strings.Join([]string{prompt, generated, fmt.Sprintf("%.1fs", elapsed.Seconds())}, " · ")
+}
+
+// turnFooter summarizes a chat turn, e.g. "812 in · 96 out · 24.1 tok/s · 4.2s · context 22% of 4096"
+func turnFooter(stats completionStats, elapsed time.Duration, contextSize int) string {
+	parts := []string{
+		fmt.Sprintf("%d in", stats.PromptTokens),
+		fmt.Sprintf("%d out", stats.PredictedTokens),
+	}
+	if stats.TokensPerSecond > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f tok/s", stats.TokensPerSecond))
+	}
+	parts = append(parts, fmt.Sprintf("%.1fs", elapsed.Seconds()))
+	if contextSize > 0 {
+		used := float64(stats.PromptTokens+stats.PredictedTokens) / float64(contextSize) * 100
+		parts = append(parts, fmt.Sprintf("context %.0f%% of %d", used, contextSize))
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+const (
+	// minHealthRequests is how many requests a server must have had before
+	// the daemon judges it by its error rate
+	minHealthRequests = 5
+	// defaultMaxErrorRate is the error rate past which the daemon restarts a
+	// server when daemon.max_error_rate isn't set
+	defaultMaxErrorRate = 0.5
+)
+
+// healthScore rates a server from 0 to 100 by its recent requests: the
+// share that succeeded, lowered further when they have started answering
+// more than twice as slowly as usual. ok is false before any requests.
+func healthScore(srv db.Server) (score int, ok bool) {
+	if srv.Requests == 0 {
+		return 0, false
+	}
+	health := 100 * (1 - srv.ErrorRate)
+	if srv.Baseline > 0 && srv.Latency > 2*srv.Baseline {
+		health *= float64(2*srv.Baseline) / float64(srv.Latency)
+	}
+	return int(health + 0.5), true
+}
+
+// formatHealth describes a server's health for ps, e.g. "97", "41 (38%
+// errors)" or "62 (3.2x slower)", or "-" before any requests
+func formatHealth(srv db.Server) string {
+	score, ok := healthScore(srv)
+	if !ok {
+		return "-"
+	}
+	switch {
+	case srv.ErrorRate >= 0.05:
+		return fmt.Sprintf("%d (%.0f%% errors)", score, srv.ErrorRate*100)
+	case srv.Baseline > 0 && srv.Latency > 2*srv.Baseline:
+		return fmt.Sprintf("%d (%.1fx slower)", score, float64(srv.Latency)/float64(srv.Baseline))
+	}
+	return fmt.Sprint(score)
+}
+
+// formatLatency shows a server's recent time to start answering, or "-"
+// before any successful requests
+func formatLatency(srv db.Server) string {
+	if srv.Latency == 0 {
+		return "-"
+	}
+	return srv.Latency.Round(time.Millisecond).String()
+}
+
+// watchHealth restarts the daemon's servers whose recent requests fail more
+// often than daemon.max_error_rate allows
+func (s *supervisor) watchHealth() {
+	limit := s.cfg.Daemon.MaxErrorRate
+	if limit <= 0 {
+		limit = defaultMaxErrorRate
+	}
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		servers, err := s.store.GetServers()
+		if err != nil {
+			ui.PrintWarn(fmt.Sprintf("Checking server health: %v", err))
+			continue
+		}
+		for _, srv := range servers {
+			if srv.Requests < minHealthRequests || srv.ErrorRate <= limit {
+				continue
+			}
+			reason := fmt.Sprintf("%.0f%% of its recent requests failed, more than daemon.max_error_rate allows (%.0f%%)", srv.ErrorRate*100, limit*100)
+			s.restart(srv.PID, reason)
+		}
+	}
+}
+
+// restart stops the daemon's server with pid so that it is started again,
+// logging why
+func (s *supervisor) restart(pid int, reason string) {
+	s.mu.Lock()
+	var target *child
+	for _, c := range s.children {
+		if c.proc != nil && c.PID == pid && !c.stopping {
+			target = c
+		}
+	}
+	if target == nil || target.restartReason != "" {
+		s.mu.Unlock()
+		return
+	}
+	target.restartReason = reason
+	proc := target.proc
+	s.mu.Unlock()
+
+	ui.PrintWarn(fmt.Sprintf("Restarting the server for model %s (PID %d): %s.", target.Slug, pid, reason))
+	// supervise starts it again once it has exited
+	terminate(proc)
+}
+
+// healthCheckTimeout is how long HealthReport waits for each server
+const healthCheckTimeout = 5 * time.Second
+
+// ServerHealth is one server's entry in a HealthReport
+type ServerHealth struct {
+	Slug        string     `json:"slug"`
+	Status      string     `json:"status"` // ok, loading, error or stopped
+	Error       string     `json:"error,omitempty"`
+	PID         int        `json:"pid,omitempty"`
+	Port        int        `json:"port,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	Uptime      int64      `json:"uptime_seconds,omitempty"`
+	Requests    int        `json:"requests"`
+	ErrorRate   float64    `json:"error_rate"`
+	LatencyMS   int64      `json:"latency_ms"`
+	Health      *int       `json:"health,omitempty"` // the score ps shows; absent before any requests
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// HealthReport is the state of every running server, checked together,
+// for monitoring
+type HealthReport struct {
+	Status    string         `json:"status"` // ok when every server is, degraded otherwise
+	CheckedAt time.Time      `json:"checked_at"`
+	Servers   []ServerHealth `json:"servers"`
+}
+
+// CheckAllHealth asks every running server for its health at once. Models
+// in expected that have no running server, such as those of a stack that
+// stopped, are reported as stopped.
+func CheckAllHealth(ctx context.Context, store *db.Store, cfg *config.Config, expected []string) (*HealthReport, error) {
+	if cfg.RemoteBackend() {
+		return nil, fmt.Errorf("backend %s runs its own servers; check one model with 'llm-cli health <slug>'", cfg.Backend.Name)
+	}
+	servers, err := runningServers(store)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HealthReport{Status: "ok", CheckedAt: time.Now().UTC(), Servers: make([]ServerHealth, len(servers))}
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv db.Server) {
+			defer wg.Done()
+			report.Servers[i] = checkServer(ctx, cfg, srv)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	for _, slug := range expected {
+		if !slices.ContainsFunc(servers, func(srv db.Server) bool { return srv.Slug == slug }) {
+			report.Servers = append(report.Servers, ServerHealth{Slug: slug, Status: "stopped"})
+		}
+	}
+	for _, s := range report.Servers {
+		if s.Status != "ok" {
+			report.Status = "degraded"
+		}
+	}
+	return report, nil
+}
+
+// checkServer asks one server for its health and fills in what the
+// registry knows of it
+func checkServer(ctx context.Context, cfg *config.Config, srv db.Server) ServerHealth {
+	started := srv.StartedAt.UTC()
+	h := ServerHealth{
+		Slug: srv.Slug, Status: "ok", PID: srv.PID, Port: srv.Port,
+		StartedAt: &started, Uptime: int64(time.Since(srv.StartedAt).Seconds()),
+		Requests: srv.Requests, ErrorRate: srv.ErrorRate, LatencyMS: srv.Latency.Milliseconds(),
+		LastError: srv.LastError,
+	}
+	if score, ok := healthScore(srv); ok {
+		h.Health = &score
+	}
+	if !srv.LastErrorAt.IsZero() {
+		at := srv.LastErrorAt.UTC()
+		h.LastErrorAt = &at
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	serverCfg := *cfg
+	serverCfg.APIURL = modelURL(cfg, srv.Port)
+	resp, err := apiRequestContext(ctx, &serverCfg, http.MethodGet, "/health", nil)
+	if err != nil {
+		h.Status, h.Error = "error", err.Error()
+		return h
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return h
+	}
+
+	// llama-server answers 503 while it loads the model
+	var body struct {
+		Error struct{ Message string } `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+	h.Status, h.Error = "error", fmt.Sprintf("the server answered %s", resp.Status)
+	if body.Error.Message != "" {
+		h.Error = body.Error.Message
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable && strings.Contains(strings.ToLower(h.Error), "loading") {
+		h.Status = "loading"
+	}
+	return h
+}
+
+// CheckHealthAll prints the health of every running server, and of the
+// models in expected that aren't running, as a table or as JSON. It fails
+// when any isn't healthy, so scripts can check the exit status.
+func CheckHealthAll(store *db.Store, cfg *config.Config, expected []string, asJSON bool) error {
+	report, err := CheckAllHealth(context.Background(), store, cfg, expected)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encoding health report: %w", err)
+		}
+	} else if len(report.Servers) == 0 {
+		fmt.Println("No running llama-server processes found.")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SLUG\tPORT\tSTATUS\tUPTIME\tHEALTH\tLAST ERROR")
+		for _, s := range report.Servers {
+			port, uptime, health := "-", "-", "-"
+			if s.Port != 0 {
+				port = fmt.Sprint(s.Port)
+				uptime = (time.Duration(s.Uptime) * time.Second).String()
+			}
+			if s.Health != nil {
+				health = fmt.Sprint(*s.Health)
+			}
+			lastError := "-"
+			if s.Error != "" {
+				lastError = s.Error
+			} else if s.LastError != "" {
+				lastError = fmt.Sprintf("%s (%s ago)", s.LastError, time.Since(*s.LastErrorAt).Round(time.Second))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Slug, port, s.Status, uptime, health, lastError)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	unhealthy := 0
+	for _, s := range report.Servers {
+		if s.Status != "ok" {
+			unhealthy++
+		}
+	}
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d servers are not healthy", unhealthy, len(report.Servers))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// jsonInstruction asks the model for a reply that is only JSON
+const jsonInstruction = "Respond with only a valid JSON value, without any other text or code fences."
+
+// parseJSONReply returns the JSON value of a reply asked to be JSON. Models
+// often wrap it in a code block or a sentence anyway, so the first JSON
+// object or array is taken when the whole reply doesn't parse.
+func parseJSONReply(text string) (string, error) {
+	text, _ = post.StripThink(text)
+	text = strings.TrimSpace(text)
+	if code, err := post.ExtractCode(text); err == nil {
+		text = strings.TrimSpace(code)
+	}
+	if json.Valid([]byte(text)) {
+		return text, nil
+	}
+	if value, err := post.ExtractJSON(text); err == nil {
+		return value, nil
+	}
+
+	var value interface{}
+	err := json.Unmarshal([]byte(text), &value)
+	if err == nil {
+		err = fmt.Errorf("not a JSON value")
+	}
+	return "", err
+}
+
+// jsonCorrection asks the model to answer again after a reply that wasn't JSON
+func jsonCorrection(err error) string {
+	return fmt.Sprintf("That was not valid JSON (%v). %s", err, jsonInstruction)
+}
+
+// withJSONInstruction returns history with its last message, the user's,
+// asking for a JSON reply. History is left unchanged.
+func withJSONInstruction(history []chattmpl.Message) []chattmpl.Message {
+	if len(history) == 0 {
+		return history
+	}
+	last := history[len(history)-1]
+	last.Content += "\n\n" + jsonInstruction
+	return append(history[:len(history)-1:len(history)-1], last)
+}
+
+// jsonRun completes text asking for JSON and prints only the JSON value, so
+// it can be piped into tools such as jq. A reply that doesn't parse is
+// followed by a prompt pointing out the error, up to opts.Retries times.
+func jsonRun(ctx context.Context, cfg *config.Config, text string, opts RunOptions) (string, error) {
+	prompt := text + "\n\n" + jsonInstruction + "\n\n"
+	for attempt := 0; ; attempt++ {
+		content, _, err := completeRequest(ctx, cfg, opts.request(cfg, prompt))
+		if err != nil {
+			return "", err
+		}
+		value, err := parseJSONReply(content)
+		if err == nil {
+			fmt.Println(value)
+			return value, nil
+		}
+		if attempt == opts.Retries {
+			return "", fmt.Errorf("the model did not return valid JSON after %d attempts: %w", attempt+1, err)
+		}
+		ui.PrintWarn(fmt.Sprintf("The reply was not valid JSON (%v); retrying (%d/%d)...", err, attempt+1, opts.Retries))
+		prompt += strings.TrimSpace(content) + "\n\n" + jsonCorrection(err) + "\n\n"
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// activityPath returns the file whose modification time records the last
+// request to the server on port. It exists only while a watchdog runs.
+func activityPath(cfg *config.Config, port int) string {
+	return filepath.Join(cfg.CacheDir, "activity", strconv.Itoa(port))
+}
+
+// touchActivity records a request to the server on port for its watchdog
+func touchActivity(cfg *config.Config, port int) {
+	now := time.Now()
+	os.Chtimes(activityPath(cfg, port), now, now)
+}
+
+// apiPort returns the port of the server cfg sends requests to
+func apiPort(cfg *config.Config) int {
+	if socket, ok := strings.CutPrefix(cfg.APIURL, unixScheme); ok {
+		port, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(socket), ".sock"))
+		return port
+	}
+	u, err := url.Parse(cfg.APIURL)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// startWatchdog launches a background process that stops the server with
+// pid once it has had no requests for the keep-alive duration
+func startWatchdog(cfg *config.Config, pid, port int, keepAlive time.Duration) error {
+	path := activityPath(cfg, port)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating activity directory: %w", err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		return fmt.Errorf("creating activity file: %w", err)
+	}
+
+	if _, err := spawnDetached(os.DevNull, "watchdog", strconv.Itoa(pid), strconv.Itoa(port), keepAlive.String()); err != nil {
+		return fmt.Errorf("starting watchdog: %w", err)
+	}
+	ui.PrintInfo(fmt.Sprintf("Server will stop after %s without requests.", keepAlive))
+	return nil
+}
+
+// Watchdog stops the server with pid on port once no request has reached
+// it for keepAlive, and returns when the server is gone. It goes by the
+// server's record in the store, so a process that reused the PID is left
+// alone.
+func Watchdog(store *db.Store, cfg *config.Config, pid, port int, keepAlive time.Duration) error {
+	path := activityPath(cfg, port)
+	defer os.Remove(path)
+
+	interval := keepAlive / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	for {
+		time.Sleep(interval)
+
+		srv, err := watchedServer(store, pid)
+		if err != nil {
+			return err
+		}
+		if srv == nil {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < keepAlive {
+			continue
+		}
+		// A long generation counts as use even without new requests
+		if serverBusy(cfg, port) {
+			touchActivity(cfg, port)
+			continue
+		}
+
+		return stopProcess(srv.PID, false)
+	}
+}
+
+// watchedServer returns the recorded server with pid, or nil once it has
+// exited or its PID belongs to another program
+func watchedServer(store *db.Store, pid int) (*db.Server, error) {
+	servers, err := store.GetServers()
+	if err != nil {
+		return nil, err
+	}
+	for _, srv := range servers {
+		if srv.PID == pid && serverAlive(srv) {
+			return &srv, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/post"
+)
+
+// Completion is a finished completion with its token counts, as returned
+// to programs using the pkg/llmcli library rather than printed
+type Completion struct {
+	Text            string // with any <think> reasoning removed
+	Truncated       bool   // stopped at the n_predict limit
+	PromptTokens    int
+	PredictedTokens int
+	TokensPerSecond float64
+}
+
+// CompleteContext returns the completion of prompt from the running server
+// of a model's config, as returned by ModelConfig, without printing it.
+// nPredict overrides the configured limit when positive, and stop adds
+// stop sequences to the model's own.
+func CompleteContext(ctx context.Context, cfg *config.Config, prompt string, nPredict int, stop []string) (*Completion, error) {
+	req := samplingRequest(cfg, prompt)
+	if nPredict > 0 {
+		req.NPredict = nPredict
+	}
+	req.Stop = append([]string{}, cfg.Stop...)
+	for _, s := range stop {
+		if !slices.Contains(req.Stop, s) {
+			req.Stop = append(req.Stop, s)
+		}
+	}
+
+	var result map[string]interface{}
+	if err := postJSONContext(ctx, cfg, "/completion", req, &result); err != nil {
+		return nil, err
+	}
+	content, _ := result["content"].(string)
+	text, err := post.StripThink(content)
+	if err != nil {
+		return nil, err
+	}
+	stats := statsFromResult(result)
+	return &Completion{
+		Text:            text,
+		Truncated:       stoppedAtLimit(result),
+		PromptTokens:    stats.PromptTokens,
+		PredictedTokens: stats.PredictedTokens,
+		TokensPerSecond: stats.TokensPerSecond,
+	}, nil
+}
+
+// ChatPrompt renders messages in a model's chat format, which may ask its
+// running server, and returns the prompt and the stop sequences that end
+// the reply
+func ChatPrompt(store *db.Store, cfg *config.Config, slug string, messages []chattmpl.Message) (string, []string) {
+	format := chatFormat(store, cfg, slug)
+	return format.Render(messages), format.Stops
+}
+
+// TokenizeContext returns the token ids of text from the running server of
+// a model's config
+func TokenizeContext(ctx context.Context, cfg *config.Config, text string) ([]int, error) {
+	var result struct {
+		Tokens []int `json:"tokens"`
+	}
+	if err := postJSONContext(ctx, cfg, "/tokenize", tokenizeRequest{Content: text}, &result); err != nil {
+		return nil, err
+	}
+	return result.Tokens, nil
+}
+
+// HealthContext returns nil if the server of a model's config answers its
+// health check, or why it doesn't
+func HealthContext(ctx context.Context, cfg *config.Config) error {
+	resp, err := apiRequestContext(ctx, cfg, http.MethodGet, "/health", nil)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// RunningServers returns the llama-server processes started by llm-cli
+// that are still running
+func RunningServers(store *db.Store) ([]db.Server, error) {
+	return runningServers(store)
+}
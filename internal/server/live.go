@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// watchInterval is how often the live view is refreshed by default
+const watchInterval = 2 * time.Second
+
+// WatchOptions controls the live view of models and their servers
+type WatchOptions struct {
+	Interval time.Duration // how often the view is refreshed; watchInterval when 0
+	Running  bool          // show only models whose server is running, as ps does
+}
+
+// watchRow is one model in the live view
+type watchRow struct {
+	slug, quant, size string
+	state             string // running, daemon or stopped
+	pid, port         int
+	memory            int64 // resident bytes; 0 when unknown
+	active            int   // requests being processed; -1 when unknown
+	uptime            time.Duration
+}
+
+// Watch shows the installed models with the state of their servers,
+// refreshed every opts.Interval until ctx is done. On a terminal the view
+// is redrawn in place; otherwise, and in accessibility mode, each refresh
+// is printed after the last.
+func Watch(ctx context.Context, store *db.Store, cfg *config.Config, opts WatchOptions) error {
+	if opts.Interval == 0 {
+		opts.Interval = watchInterval
+	}
+	info, err := os.Stdout.Stat()
+	redraw := err == nil && info.Mode()&os.ModeCharDevice != 0 && !ui.Accessible()
+	if redraw {
+		// Clear the screen and hide the cursor while the view is shown
+		fmt.Print("\033[2J\033[?25l")
+		defer fmt.Print("\033[?25h")
+	}
+
+	for {
+		rows, err := watchRows(store, cfg, daemonStatus(cfg), opts.Running)
+		if err != nil {
+			return err
+		}
+		var frame bytes.Buffer
+		if err := renderWatch(&frame, rows, opts); err != nil {
+			return err
+		}
+		if redraw {
+			// Rewrite each line from the top instead of clearing the
+			// screen first, so the view doesn't flicker
+			lines := strings.ReplaceAll(frame.String(), "\n", "\033[K\n")
+			fmt.Print("\033[H" + lines + "\033[J")
+		} else {
+			fmt.Println(frame.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// watchRows collects the installed models and the servers running them,
+// whether started by llm-cli directly or by the daemon described by status,
+// which is nil when no daemon is running
+func watchRows(store *db.Store, cfg *config.Config, status *DaemonStatus, runningOnly bool) ([]watchRow, error) {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving models: %w", err)
+	}
+	servers, err := runningServers(store)
+	if err != nil {
+		return nil, err
+	}
+	direct := make(map[string]db.Server, len(servers))
+	for _, srv := range servers {
+		direct[srv.ModelPath] = srv
+	}
+	daemon := make(map[string]DaemonServer)
+	if status != nil {
+		for _, srv := range status.Servers {
+			daemon[srv.Path] = srv
+		}
+	}
+
+	var rows []watchRow
+	for _, model := range models {
+		row := watchRow{slug: model.Slug, quant: model.Quant, size: model.FileSize, state: "stopped", active: -1}
+		if srv, ok := direct[model.FilePath]; ok {
+			row.state, row.pid, row.port, row.uptime = "running", srv.PID, srv.Port, time.Since(srv.StartedAt)
+		} else if srv, ok := daemon[model.FilePath]; ok {
+			row.state, row.pid, row.port, row.uptime = "daemon", srv.PID, srv.Port, time.Since(srv.Started)
+		} else if runningOnly {
+			continue
+		}
+		if row.pid != 0 {
+			row.memory, _ = ProcessMemory(row.pid)
+			row.active = activeRequests(cfg, row.port)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// renderWatch writes the live view: a summary line and a table of rows
+func renderWatch(out io.Writer, rows []watchRow, opts WatchOptions) error {
+	running := 0
+	for _, row := range rows {
+		if row.state != "stopped" {
+			running++
+		}
+	}
+	if opts.Running {
+		fmt.Fprintf(out, "Running servers: %d", running)
+	} else {
+		fmt.Fprintf(out, "Models: %d, running: %d", len(rows), running)
+	}
+	fmt.Fprintf(out, " at %s, refreshed every %s. Press Ctrl-C to quit.\n\n",
+		time.Now().Format("15:04:05"), opts.Interval)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tQUANT\tSIZE\tSTATE\tPORT\tPID\tMEMORY\tACTIVE\tUPTIME")
+	for _, row := range rows {
+		quant, port, pid, memory, active, uptime := "-", "-", "-", "-", "-", "-"
+		if row.quant != "" {
+			quant = row.quant
+		}
+		if row.port != 0 {
+			port = strconv.Itoa(row.port)
+		}
+		if row.pid != 0 {
+			pid = strconv.Itoa(row.pid)
+		}
+		if row.memory > 0 {
+			memory = fmt.Sprintf("%dM", row.memory/(1024*1024))
+		}
+		if row.active >= 0 {
+			active = strconv.Itoa(row.active)
+		}
+		if row.uptime > 0 {
+			uptime = row.uptime.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.slug, quant, row.size, row.state, port, pid, memory, active, uptime)
+	}
+	return w.Flush()
+}
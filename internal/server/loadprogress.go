@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+var (
+	offloadPattern = regexp.MustCompile(`offloaded (\d+)/(\d+) layers to GPU`)
+	bufferPattern  = regexp.MustCompile(`(\S+?)(?:_Mapped)? (?:model )?buffer size =\s+([\d.]+) MiB`)
+)
+
+// loadWatcher follows a server's log while it starts, to show how far
+// llama.cpp has got loading the model
+type loadWatcher struct {
+	file    *os.File
+	partial string // text after the last newline read
+
+	// llama.cpp prints a dot for every percent of the tensors loaded
+	loading bool
+	dots    int
+
+	offloaded string             // e.g. "33/33", empty until reported
+	buffers   map[string]float64 // MiB of model weights per device
+	shown     int                // percentage last drawn, 0 before the bar is shown
+	progress  *ui.Progress
+}
+
+// newLoadWatcher follows the log file at path, or returns nil if it can't
+// be read, such as when logs aren't kept
+func newLoadWatcher(path string) *loadWatcher {
+	if path == os.DevNull {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	return &loadWatcher{file: file, buffers: make(map[string]float64), progress: ui.NewProgress(ui.Messages())}
+}
+
+// close stops following the log
+func (w *loadWatcher) close() {
+	w.file.Close()
+}
+
+// update reads what the server has logged since the last call
+func (w *loadWatcher) update() {
+	data, err := io.ReadAll(w.file)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	text := w.partial + string(data)
+	lines := strings.Split(text, "\n")
+	w.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		w.parseLine(line)
+	}
+	// Dots arrive without a newline until loading finishes
+	if w.loading {
+		w.countDots(w.partial)
+	}
+}
+
+// parseLine takes the load state from a complete log line
+func (w *loadWatcher) parseLine(line string) {
+	// Lines about KV cache and compute buffers come from other functions
+	if strings.Contains(line, "load_tensors") {
+		w.loading = true
+		if m := offloadPattern.FindStringSubmatch(line); m != nil {
+			w.offloaded = m[1] + "/" + m[2]
+		}
+		if m := bufferPattern.FindStringSubmatch(line); m != nil {
+			if mib, err := strconv.ParseFloat(m[2], 64); err == nil {
+				w.buffers[m[1]] += mib
+			}
+		}
+		return
+	}
+	if w.loading && line != "" && strings.Trim(line, ".") == "" {
+		w.dots = max(w.dots, len(line))
+		w.loading = false
+	}
+}
+
+// countDots counts the progress dots of an unfinished line
+func (w *loadWatcher) countDots(line string) {
+	if line != "" && strings.Trim(line, ".") == "" {
+		w.dots = max(w.dots, len(line))
+	}
+}
+
+// render draws a progress bar while tensors load, redrawing it only when
+// the percentage changes
+func (w *loadWatcher) render() {
+	percent := min(w.dots, 100)
+	if percent == w.shown {
+		return
+	}
+	bar := strings.Repeat("█", percent/5) + strings.Repeat("░", 20-percent/5)
+	w.progress.Update(float64(percent)/100,
+		fmt.Sprintf("Loading model %s %3d%%", bar, percent),
+		fmt.Sprintf("Loading the model: %d%% done.", percent))
+	w.shown = percent
+}
+
+// finish ends the progress bar and summarizes GPU offload
+func (w *loadWatcher) finish() {
+	w.update()
+	if w.shown > 0 {
+		w.dots = 100
+		w.render()
+		w.progress.Done()
+	}
+	if summary := w.summary(); summary != "" {
+		ui.PrintInfo(summary)
+	}
+}
+
+// summary describes where the model's layers and weights ended up, e.g.
+// "Offloaded 33/33 layers to GPU (Metal 4165 MiB, CPU 281 MiB)"
+func (w *loadWatcher) summary() string {
+	if w.offloaded == "" {
+		return ""
+	}
+	devices := make([]string, 0, len(w.buffers))
+	for device := range w.buffers {
+		devices = append(devices, device)
+	}
+	// Largest first, so the device holding most of the model leads
+	sort.Slice(devices, func(i, j int) bool { return w.buffers[devices[i]] > w.buffers[devices[j]] })
+	for i, device := range devices {
+		devices[i] = fmt.Sprintf("%s %.0f MiB", device, w.buffers[device])
+	}
+
+	summary := fmt.Sprintf("Offloaded %s layers to GPU", w.offloaded)
+	if len(devices) > 0 {
+		summary += " (" + strings.Join(devices, ", ") + ")"
+	}
+	return summary
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// logPollInterval is how often a followed log is checked for new output
+const logPollInterval = 250 * time.Millisecond
+
+// LogOptions controls how a server log is shown
+type LogOptions struct {
+	Tail   int  // lines to show from the end; 0 shows the whole log
+	Follow bool // keep printing what the server writes, as tail -f does
+}
+
+// Logs prints the log of a model's server: that of its running server as
+// recorded in the servers registry, or else the one its last server wrote.
+// With opts.Follow it keeps printing new output until ctx is done, picking
+// up the new log when the server restarts.
+func Logs(ctx context.Context, store *db.Store, cfg *config.Config, slug string, opts LogOptions) error {
+	path, err := serverLog(store, cfg, slug)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening server log: %w", err)
+	}
+	defer func() { f.Close() }()
+
+	if opts.Tail > 0 {
+		offset, err := tailOffset(f, opts.Tail)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("reading server log: %w", err)
+		}
+	}
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return fmt.Errorf("reading server log: %w", err)
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logPollInterval):
+		}
+
+		// A restarted server recreates or truncates its log
+		opened, openErr := f.Stat()
+		current, statErr := os.Stat(path)
+		offset, seekErr := f.Seek(0, io.SeekCurrent)
+		if openErr == nil && statErr == nil && seekErr == nil && (!os.SameFile(opened, current) || current.Size() < offset) {
+			reopened, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("opening server log: %w", err)
+			}
+			f.Close()
+			f = reopened
+			ui.PrintInfo(fmt.Sprintf("The server for %s restarted; following its new log.", slug))
+		}
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return fmt.Errorf("reading server log: %w", err)
+		}
+	}
+}
+
+// serverLog returns the log file of a model's server
+func serverLog(store *db.Store, cfg *config.Config, slug string) (string, error) {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return "", err
+	}
+	servers, err := runningServers(store)
+	if err != nil {
+		return "", err
+	}
+
+	path := cfg.ServerLogPath(slug)
+	for _, srv := range servers {
+		if srv.ModelPath == model.FilePath && srv.LogPath != "" {
+			path = srv.LogPath
+		}
+	}
+	logsOff := fmt.Errorf("server logs are off; turn them on with 'llm-cli config set persist.logs true' and restart the server")
+	if path == os.DevNull {
+		return "", logsOff
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if !cfg.Persist.Logs {
+			return "", logsOff
+		}
+		return "", fmt.Errorf("no server log for %s yet; it is written to %s once the server starts", slug, path)
+	}
+	return path, nil
+}
+
+// tailOffset returns where the last n lines of f begin, reading backwards
+// from the end so large logs aren't read whole
+func tailOffset(f *os.File, n int) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("reading server log: %w", err)
+	}
+	end := info.Size()
+	buf := make([]byte, 64*1024)
+	lines := 0
+	for pos := end; pos > 0; {
+		size := int64(len(buf))
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		if _, err := f.ReadAt(buf[:size], pos); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("reading server log: %w", err)
+		}
+		for i := size - 1; i >= 0; i-- {
+			// The newline ending the last line doesn't start another
+			if buf[i] != '\n' || pos+i == end-1 {
+				continue
+			}
+			lines++
+			if lines == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// modelMetrics is what the metrics report about one running model
+type modelMetrics struct {
+	watchRow
+	version     string // llama-server build, e.g. b4567; "unknown" when not reported
+	contextSize int    // tokens, of all the server's slots together; 0 when unknown
+	contextUsed int    // tokens held by the server's slots; -1 when not reported
+}
+
+// metric is one series of the metrics, with a value per running model;
+// value reports false for models it has no value for
+type metric struct {
+	name, help string
+	value      func(m modelMetrics) (float64, bool)
+}
+
+// modelSeries are the per-model series, each labelled with the model's
+// slug, quantization and llama-server build
+var modelSeries = []metric{
+	{"llmcli_model_info", "Running model servers; always 1.", func(m modelMetrics) (float64, bool) {
+		return 1, true
+	}},
+	{"llmcli_model_memory_bytes", "Resident memory of the model's server.", func(m modelMetrics) (float64, bool) {
+		return float64(m.memory), m.memory > 0
+	}},
+	{"llmcli_model_context_size_tokens", "Context size of the server's slots together.", func(m modelMetrics) (float64, bool) {
+		return float64(m.contextSize), m.contextSize > 0
+	}},
+	{"llmcli_model_context_used_tokens", "Tokens held in the context by the server's slots.", func(m modelMetrics) (float64, bool) {
+		return float64(m.contextUsed), m.contextUsed >= 0
+	}},
+	{"llmcli_model_context_utilization_ratio", "Share of the context in use, from 0 to 1.", func(m modelMetrics) (float64, bool) {
+		if m.contextUsed < 0 || m.contextSize <= 0 {
+			return 0, false
+		}
+		return float64(m.contextUsed) / float64(m.contextSize), true
+	}},
+	{"llmcli_model_active_requests", "Requests the server is processing.", func(m modelMetrics) (float64, bool) {
+		return float64(m.active), m.active >= 0
+	}},
+	{"llmcli_model_uptime_seconds", "How long the server has been running.", func(m modelMetrics) (float64, bool) {
+		return m.uptime.Seconds(), true
+	}},
+}
+
+// WriteMetrics writes the installed models and the state of their running
+// servers, whether started by llm-cli directly or by the daemon, in the
+// Prometheus text format
+func WriteMetrics(w io.Writer, store *db.Store, cfg *config.Config) error {
+	return writeMetrics(w, store, cfg, daemonStatus(cfg))
+}
+
+// SaveMetrics writes the metrics to path, replacing it in one step so a
+// collector such as node_exporter's textfile collector never reads half
+// a file
+func SaveMetrics(path string, store *db.Store, cfg *config.Config) error {
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf, store, cfg); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".llmcli-metrics-*")
+	if err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("writing metrics: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleMetrics serves the metrics from the daemon's socket
+func (s *supervisor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	status := s.status()
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, s.store, s.cfg, &status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// writeMetrics writes the metrics, taking the daemon's servers from status
+func writeMetrics(w io.Writer, store *db.Store, cfg *config.Config, status *DaemonStatus) error {
+	rows, err := watchRows(store, cfg, status, false)
+	if err != nil {
+		return err
+	}
+	var running []modelMetrics
+	for _, row := range rows {
+		if row.state == "stopped" {
+			continue
+		}
+		m := modelMetrics{watchRow: row}
+		var propsContext int
+		m.version, propsContext = serverProps(cfg, row.port)
+		if m.contextSize, m.contextUsed = slotContext(cfg, row.port); m.contextSize == 0 {
+			m.contextSize = propsContext
+		}
+		running = append(running, m)
+	}
+
+	fmt.Fprintln(w, "# HELP llmcli_models_installed Installed models.")
+	fmt.Fprintln(w, "# TYPE llmcli_models_installed gauge")
+	fmt.Fprintf(w, "llmcli_models_installed %d\n", len(rows))
+	fmt.Fprintln(w, "# HELP llmcli_models_running Models with a running server.")
+	fmt.Fprintln(w, "# TYPE llmcli_models_running gauge")
+	fmt.Fprintf(w, "llmcli_models_running %d\n", len(running))
+
+	for _, series := range modelSeries {
+		fmt.Fprintf(w, "# HELP %s %s\n", series.name, series.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", series.name)
+		for _, m := range running {
+			value, ok := series.value(m)
+			if !ok {
+				continue
+			}
+			quant := m.quant
+			if quant == "" {
+				quant = "unknown"
+			}
+			fmt.Fprintf(w, "%s{slug=%s,quant=%s,backend_version=%s} %g\n", series.name,
+				promLabel(m.slug), promLabel(quant), promLabel(m.version), value)
+		}
+	}
+	return nil
+}
+
+// promLabel quotes a Prometheus label value
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// serverProps returns the llama-server build and context size a server
+// reports, or "unknown" and 0
+func serverProps(cfg *config.Config, port int) (string, int) {
+	shared, baseURL := httpTarget(modelURL(cfg, port))
+	client := *shared
+	client.Timeout = 5 * time.Second
+	resp, err := client.Get(baseURL + "/props")
+	if err != nil {
+		return "unknown", 0
+	}
+	defer resp.Body.Close()
+
+	var props interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&props); err != nil {
+		return "unknown", 0
+	}
+	version := "unknown"
+	if m, ok := props.(map[string]interface{}); ok {
+		if build, ok := m["build_info"].(string); ok && build != "" {
+			version = build
+		}
+	}
+	return version, effectiveContext(props)
+}
+
+// slotContext returns the context size of a server's slots together, or 0
+// if it doesn't report it, and how many tokens they hold, or -1 if it
+// doesn't report that. Only llama-server builds that include n_past in
+// /slots do.
+func slotContext(cfg *config.Config, port int) (int, int) {
+	shared, baseURL := httpTarget(modelURL(cfg, port))
+	client := *shared
+	client.Timeout = 5 * time.Second
+	resp, err := client.Get(baseURL + "/slots")
+	if err != nil {
+		return 0, -1
+	}
+	defer resp.Body.Close()
+
+	var slots []struct {
+		NCtx  int  `json:"n_ctx"`
+		NPast *int `json:"n_past"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&slots); err != nil {
+		return 0, -1
+	}
+	size, used, reported := 0, 0, false
+	for _, slot := range slots {
+		size += slot.NCtx
+		if slot.NPast != nil {
+			used += *slot.NPast
+			reported = true
+		}
+	}
+	if !reported {
+		return size, -1
+	}
+	return size, used
+}
@@ -0,0 +1,466 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/record"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// defaultMockReply is what the mock backend replies when no reply is set
+const defaultMockReply = "This is a reply from the mock backend. It stands in for a model, " +
+	"so scripts and plugins can be developed and tested without downloading one."
+
+// mockTemplate is the chat template the mock backend reports, so chats
+// use the ChatML format with it
+const mockTemplate = "{% for message in messages %}<|im_start|>{{ message.role }}\n{{ message.content }}<|im_end|>\n{% endfor %}"
+
+// mockEmbeddingSize is the length of the mock backend's embeddings
+const mockEmbeddingSize = 64
+
+// mockTokenPattern splits text into the mock backend's tokens: words with
+// the space before them, so the tokens of a reply join up into it
+var mockTokenPattern = regexp.MustCompile(`\s*\S+`)
+
+// mockClients caches the clients of mock backends by URL, so the tokens
+// and failures of a backend carry across requests
+var mockClients sync.Map
+
+// mockClient returns the client that answers requests to the mock backend
+// at apiURL in process
+func mockClient(apiURL string) *http.Client {
+	client, ok := mockClients.Load(apiURL)
+	if !ok {
+		// The settings were checked when the backend was selected
+		opts, _ := config.ParseMockURL(apiURL)
+		seed := opts.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		mock := &mockBackend{opts: opts, rand: rand.New(rand.NewSource(seed)), words: make(map[int]string)}
+		client, _ = mockClients.LoadOrStore(apiURL, &http.Client{Transport: record.Transport(ui.LoggingTransport(mock))})
+	}
+	return client.(*http.Client)
+}
+
+// mockBackend answers requests as a llama-server with a model loaded
+// would, with canned replies and the delays and failures it was set up with
+type mockBackend struct {
+	opts config.MockOptions
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	words map[int]string // tokenized so far, by token, for /detokenize
+}
+
+// RoundTrip answers a request
+func (m *mockBackend) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	if err := sleepContext(req.Context(), m.opts.Latency); err != nil {
+		return nil, err
+	}
+	if req.URL.Path != "/health" && m.fail() {
+		return mockError(req, http.StatusInternalServerError, "server_error", "injected failure from the mock backend"), nil
+	}
+
+	switch req.URL.Path {
+	case "/health":
+		return mockJSON(req, http.StatusOK, map[string]string{"status": "ok"}), nil
+	case "/props":
+		return mockJSON(req, http.StatusOK, map[string]interface{}{
+			"default_generation_settings": map[string]int{"n_ctx": m.opts.ContextSize},
+			"chat_template":               mockTemplate,
+			"model_path":                  "mock.gguf",
+			"build_info":                  "mock",
+			"total_slots":                 1,
+		}), nil
+	case "/slots":
+		return mockJSON(req, http.StatusOK, []map[string]interface{}{{"id": 0, "is_processing": false}}), nil
+	case "/v1/models":
+		return mockJSON(req, http.StatusOK, map[string]interface{}{
+			"object": "list",
+			"data":   []map[string]string{{"id": "mock", "object": "model", "owned_by": "llm-cli"}},
+		}), nil
+	case "/tokenize":
+		var r struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(body, &r); err != nil {
+			return mockError(req, http.StatusBadRequest, "invalid_request_error", err.Error()), nil
+		}
+		return mockJSON(req, http.StatusOK, map[string][]int{"tokens": m.tokenize(r.Content)}), nil
+	case "/detokenize":
+		var r struct {
+			Tokens []int `json:"tokens"`
+		}
+		if err := json.Unmarshal(body, &r); err != nil {
+			return mockError(req, http.StatusBadRequest, "invalid_request_error", err.Error()), nil
+		}
+		return mockJSON(req, http.StatusOK, map[string]string{"content": m.detokenize(r.Tokens)}), nil
+	case "/completion":
+		return m.completion(req, body), nil
+	case "/v1/completions", "/v1/chat/completions":
+		return m.openAICompletion(req, body), nil
+	case "/embedding", "/v1/embeddings":
+		return m.embedding(req, body), nil
+	}
+	return mockError(req, http.StatusNotFound, "not_found_error", "File Not Found"), nil
+}
+
+// fail reports whether a request should fail, at the configured rate
+func (m *mockBackend) fail() bool {
+	if m.opts.ErrorRate <= 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rand.Float64() < m.opts.ErrorRate
+}
+
+// completion answers /completion, streaming the reply when asked to
+func (m *mockBackend) completion(req *http.Request, body []byte) *http.Response {
+	var r completionRequest
+	if err := json.Unmarshal(body, &r); err != nil {
+		return mockError(req, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+	started := time.Now()
+	tokens, cut := m.reply(lastUserMessage(r.Prompt), r.NPredict)
+	final := func(content string) map[string]interface{} {
+		return m.finalResult(content, len(m.tokenize(r.Prompt)), len(tokens), cut, time.Since(started))
+	}
+	if !r.Stream {
+		return mockJSON(req, http.StatusOK, final(strings.Join(tokens, "")))
+	}
+	return m.stream(req, tokens, func(token string) interface{} {
+		return map[string]interface{}{"content": token, "stop": false}
+	}, func() []interface{} {
+		return []interface{}{final("")}
+	})
+}
+
+// finalResult is the last response to a completion, with its token counts
+// and timings
+func (m *mockBackend) finalResult(content string, evaluated, predicted int, cut bool, elapsed time.Duration) map[string]interface{} {
+	stopType := "eos"
+	if cut {
+		stopType = "limit"
+	}
+	predictedMS := float64(elapsed.Microseconds()) / 1000
+	perSecond := 0.0
+	if predictedMS > 0 {
+		perSecond = float64(predicted) / predictedMS * 1000
+	}
+	return map[string]interface{}{
+		"content":          content,
+		"stop":             true,
+		"stop_type":        stopType,
+		"stopped_limit":    cut,
+		"tokens_evaluated": evaluated,
+		"tokens_predicted": predicted,
+		"timings": map[string]interface{}{
+			"prompt_n":             evaluated,
+			"prompt_ms":            0.0,
+			"predicted_n":          predicted,
+			"predicted_ms":         predictedMS,
+			"predicted_per_second": perSecond,
+		},
+	}
+}
+
+// openAICompletion answers the OpenAI-compatible /v1/completions and
+// /v1/chat/completions
+func (m *mockBackend) openAICompletion(req *http.Request, body []byte) *http.Response {
+	var r struct {
+		Prompt   interface{} `json:"prompt"`
+		Messages []struct {
+			Role    string      `json:"role"`
+			Content interface{} `json:"content"`
+		} `json:"messages"`
+		MaxTokens int  `json:"max_tokens"`
+		Stream    bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return mockError(req, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+	chat := req.URL.Path == "/v1/chat/completions"
+	var prompt, question string
+	if chat {
+		for _, message := range r.Messages {
+			text, ok := message.Content.(string)
+			if !ok {
+				text = fmt.Sprint(message.Content)
+			}
+			prompt += text + "\n"
+			if message.Role == "user" {
+				question = text
+			}
+		}
+	} else {
+		prompt = fmt.Sprint(r.Prompt)
+		question = lastUserMessage(prompt)
+	}
+
+	tokens, cut := m.reply(question, r.MaxTokens)
+	finish := "stop"
+	if cut {
+		finish = "length"
+	}
+	object, id, created := "text_completion", "cmpl-mock", time.Now().Unix()
+	if chat {
+		object, id = "chat.completion", "chatcmpl-mock"
+	}
+	choice := func(text string, finish interface{}) map[string]interface{} {
+		if chat && r.Stream {
+			return map[string]interface{}{"index": 0, "delta": map[string]string{"content": text}, "finish_reason": finish}
+		}
+		if chat {
+			return map[string]interface{}{"index": 0, "message": map[string]string{"role": "assistant", "content": text}, "finish_reason": finish}
+		}
+		return map[string]interface{}{"index": 0, "text": text, "finish_reason": finish}
+	}
+	result := func(choice map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"id": id, "object": object, "created": created, "model": "mock", "choices": []interface{}{choice}}
+	}
+
+	if !r.Stream {
+		response := result(choice(strings.Join(tokens, ""), finish))
+		evaluated := len(m.tokenize(prompt))
+		response["usage"] = map[string]int{"prompt_tokens": evaluated, "completion_tokens": len(tokens), "total_tokens": evaluated + len(tokens)}
+		return mockJSON(req, http.StatusOK, response)
+	}
+	if chat {
+		object += ".chunk"
+	}
+	return m.stream(req, tokens, func(token string) interface{} {
+		return result(choice(token, nil))
+	}, func() []interface{} {
+		return []interface{}{result(choice("", finish)), "[DONE]"}
+	})
+}
+
+// embedding answers /embedding and /v1/embeddings with a vector of the
+// words of each input, so that texts sharing words come out similar
+func (m *mockBackend) embedding(req *http.Request, body []byte) *http.Response {
+	var r struct {
+		Content interface{} `json:"content"`
+		Input   interface{} `json:"input"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return mockError(req, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+	input := r.Content
+	if req.URL.Path == "/v1/embeddings" {
+		input = r.Input
+	}
+	var texts []string
+	switch v := input.(type) {
+	case string:
+		texts = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			texts = append(texts, fmt.Sprint(item))
+		}
+	default:
+		return mockError(req, http.StatusBadRequest, "invalid_request_error", "the input must be a string or a list of strings")
+	}
+
+	var data []map[string]interface{}
+	for i, text := range texts {
+		if req.URL.Path == "/v1/embeddings" {
+			data = append(data, map[string]interface{}{"object": "embedding", "index": i, "embedding": mockEmbedding(text)})
+		} else {
+			data = append(data, map[string]interface{}{"index": i, "embedding": [][]float64{mockEmbedding(text)}})
+		}
+	}
+	if req.URL.Path == "/v1/embeddings" {
+		return mockJSON(req, http.StatusOK, map[string]interface{}{"object": "list", "model": "mock", "data": data})
+	}
+	return mockJSON(req, http.StatusOK, data)
+}
+
+// reply returns the tokens of the reply to question, at most limit of them
+// when limit is positive, and whether it was cut short
+func (m *mockBackend) reply(question string, limit int) ([]string, bool) {
+	text := m.opts.Reply
+	switch {
+	case m.opts.Echo:
+		text = question
+	case text == "":
+		text = defaultMockReply
+	}
+	tokens := mockTokenPattern.FindAllString(text, -1)
+	if limit > 0 && len(tokens) > limit {
+		return tokens[:limit], true
+	}
+	return tokens, false
+}
+
+// stream sends a reply's tokens as server-sent events, one at a time with
+// the configured delay between them, and then the events of last
+func (m *mockBackend) stream(req *http.Request, tokens []string, event func(token string) interface{}, last func() []interface{}) *http.Response {
+	reader, writer := io.Pipe()
+	send := func(value interface{}) error {
+		data, ok := value.(string)
+		if !ok {
+			encoded, _ := json.Marshal(value)
+			data = string(encoded)
+		}
+		_, err := fmt.Fprintf(writer, "data: %s\n\n", data)
+		return err
+	}
+	go func() {
+		for _, token := range tokens {
+			if err := sleepContext(req.Context(), m.opts.TokenDelay); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if err := send(event(token)); err != nil {
+				return
+			}
+		}
+		for _, value := range last() {
+			if err := send(value); err != nil {
+				return
+			}
+		}
+		writer.Close()
+	}()
+	return mockResponse(req, http.StatusOK, "text/event-stream", reader, -1)
+}
+
+// tokenize splits text into the mock backend's tokens, one per word,
+// remembering each so /detokenize can turn it back
+func (m *mockBackend) tokenize(text string) []int {
+	words := mockTokenPattern.FindAllString(text, -1)
+	tokens := make([]int, len(words))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, word := range words {
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		tokens[i] = int(hash.Sum32() % 32000)
+		m.words[tokens[i]] = word
+	}
+	return tokens
+}
+
+// detokenize turns tokens back into text; tokens never tokenized come out
+// as <unk>
+func (m *mockBackend) detokenize(tokens []int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var text strings.Builder
+	for _, token := range tokens {
+		word, ok := m.words[token]
+		if !ok {
+			word = "<unk>"
+		}
+		text.WriteString(word)
+	}
+	return text.String()
+}
+
+// lastUserMessage returns the last user message of a ChatML prompt, or its
+// last line when it isn't one
+func lastUserMessage(prompt string) string {
+	const start, end = "<|im_start|>user\n", "<|im_end|>"
+	if i := strings.LastIndex(prompt, start); i >= 0 {
+		message, _, _ := strings.Cut(prompt[i+len(start):], end)
+		return strings.TrimSpace(message)
+	}
+	lines := strings.Split(strings.TrimSpace(prompt), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// mockEmbedding returns a unit vector for the words of text
+func mockEmbedding(text string) []float64 {
+	vector := make([]float64, mockEmbeddingSize)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?\"'()[]{}")
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		sum := hash.Sum32()
+		sign := 1.0
+		if sum&(1<<31) != 0 {
+			sign = -1
+		}
+		vector[sum%mockEmbeddingSize] += sign
+	}
+	var norm float64
+	for _, x := range vector {
+		norm += x * x
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// mockJSON returns a response with value as its JSON body
+func mockJSON(req *http.Request, status int, value interface{}) *http.Response {
+	data, _ := json.Marshal(value)
+	return mockResponse(req, status, "application/json", io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+}
+
+// mockError returns an error response in llama-server's format
+func mockError(req *http.Request, status int, kind, message string) *http.Response {
+	return mockJSON(req, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message, "type": kind},
+	})
+}
+
+// mockResponse returns a response with body, length bytes long or -1 if
+// unknown
+func mockResponse(req *http.Request, status int, contentType string, body io.ReadCloser, length int64) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// candidate is a line from a candidates file scored against a query
+type candidate struct {
+	Line  int
+	Text  string
+	Score float64
+}
+
+// Nearest embeds a query and every line of a candidates file, then prints
+// the top closest lines by cosine similarity. Candidate embeddings are cached
+// in the database so repeated runs over the same file are fast.
+func Nearest(store *db.Store, cfg *config.Config, slug, query, candidatesPath string, top int) error {
+	candidates, err := readCandidates(candidatesPath)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no candidates found in %s", candidatesPath)
+	}
+
+	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+		return err
+	}
+	cfg, err = ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
+
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	modelKey := EmbeddingModelKey(model)
+
+	queryVector, err := embedText(context.Background(), cfg, query)
+	if err != nil {
+		return fmt.Errorf("embedding query: %w", err)
+	}
+
+	cached := 0
+	for i := range candidates {
+		vector, hit, err := cachedEmbedding(store, cfg, modelKey, candidates[i].Text)
+		if err != nil {
+			return fmt.Errorf("embedding line %d: %w", candidates[i].Line, err)
+		}
+		if hit {
+			cached++
+		}
+
+		candidates[i].Score = CosineSimilarity(queryVector, vector)
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Scored %d candidates (%d from cache).", len(candidates), cached))
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if top > 0 && top < len(candidates) {
+		candidates = candidates[:top]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tLINE\tTEXT")
+	for _, c := range candidates {
+		text := c.Text
+		if runes := []rune(text); len(runes) > 80 {
+			text = string(runes[:77]) + "..."
+		}
+		fmt.Fprintf(w, "%.4f\t%d\t%s\n", c.Score, c.Line, text)
+	}
+
+	return w.Flush()
+}
+
+// readCandidates reads the non-empty lines of a file
+func readCandidates(path string) ([]candidate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening candidates file: %w", err)
+	}
+	defer file.Close()
+
+	var candidates []candidate
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		candidates = append(candidates, candidate{Line: line, Text: text})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading candidates file: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// cachedEmbedding embeds text with the running server unless its embedding
+// by the model is cached, reporting whether it was
+func cachedEmbedding(store *db.Store, cfg *config.Config, modelKey, text string) ([]float64, bool, error) {
+	vector, err := store.GetCachedEmbedding(modelKey, text)
+	if err != nil {
+		return nil, false, err
+	}
+	if vector != nil {
+		return vector, true, nil
+	}
+
+	vector, err = embedText(context.Background(), cfg, text)
+	if err != nil {
+		return nil, false, err
+	}
+	if cfg.Persist.Cache {
+		if err := store.CacheEmbedding(modelKey, text, vector); err != nil {
+			return nil, false, err
+		}
+	}
+	return vector, false, nil
+}
+
+// EmbeddingModelKey identifies the model that produced a cached embedding:
+// the checksum of its file when known, so every slug of the same file
+// shares its embeddings, or else its repository and file name
+func EmbeddingModelKey(model *db.Model) string {
+	if model.SHA256 != "" {
+		return "sha256:" + model.SHA256
+	}
+	return model.ModelID + "/" + model.FileName
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCOptions is the OpenID Connect provider serve signs browsers in with
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // defaults to /auth/callback on the address serve was reached at
+	Allow        []string // emails, or subjects, of the users let in
+}
+
+// signInTimeout is how long a user has to sign in with the provider
+const signInTimeout = 10 * time.Minute
+
+// oidcProvider signs users in with the authorization code flow
+type oidcProvider struct {
+	opts          OIDCOptions
+	authEndpoint  string
+	tokenEndpoint string
+	pending       sync.Map // pendingSignIn by state
+}
+
+// pendingSignIn is a sign-in sent to the provider and not yet back
+type pendingSignIn struct {
+	nonce       string
+	redirectURL string
+	next        string
+	expires     time.Time
+}
+
+// discoverOIDC reads the provider's endpoints from its discovery document
+func discoverOIDC(ctx context.Context, opts OIDCOptions) (*oidcProvider, error) {
+	issuer, err := url.Parse(opts.Issuer)
+	if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && !(issuer.Scheme == "http" && loopback(issuer.Hostname()))) {
+		return nil, fmt.Errorf("invalid OIDC issuer %q: use an https URL", opts.Issuer)
+	}
+
+	discovery := strings.TrimSuffix(opts.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading the OIDC provider's configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading the OIDC provider's configuration: %s answered %s", discovery, resp.Status)
+	}
+	var config struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("parsing the OIDC provider's configuration: %w", err)
+	}
+	if config.Issuer != opts.Issuer || config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%s doesn't describe the OIDC issuer %s", discovery, opts.Issuer)
+	}
+	return &oidcProvider{opts: opts, authEndpoint: config.AuthorizationEndpoint, tokenEndpoint: config.TokenEndpoint}, nil
+}
+
+// login sends the browser to the provider to sign in, to come back to the
+// page it asked for
+func (p *oidcProvider) login(w http.ResponseWriter, r *http.Request) {
+	state, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	next := r.URL.Query().Get("next")
+	// Only pages of serve itself, never another site
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	redirectURL := p.redirectURL(r)
+	p.pending.Range(func(state, value interface{}) bool {
+		if time.Now().After(value.(pendingSignIn).expires) {
+			p.pending.Delete(state)
+		}
+		return true
+	})
+	p.pending.Store(state, pendingSignIn{nonce: nonce, redirectURL: redirectURL, next: next, expires: time.Now().Add(signInTimeout)})
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.opts.ClientID},
+		"redirect_uri":  {redirectURL},
+		"scope":         {"openid email"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, p.authEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// redirectURL is where the provider sends the browser back to
+func (p *oidcProvider) redirectURL(r *http.Request) string {
+	if p.opts.RedirectURL != "" {
+		return p.opts.RedirectURL
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/auth/callback"
+}
+
+// finish checks the provider's answer to a sign-in and returns who signed
+// in and the page to go back to
+func (p *oidcProvider) finish(r *http.Request) (string, string, error) {
+	query := r.URL.Query()
+	value, ok := p.pending.LoadAndDelete(query.Get("state"))
+	if !ok {
+		return "", "", fmt.Errorf("unknown or reused sign-in; try again")
+	}
+	pending := value.(pendingSignIn)
+	if time.Now().After(pending.expires) {
+		return "", "", fmt.Errorf("the sign-in took too long; try again")
+	}
+	if reason := query.Get("error"); reason != "" {
+		return "", "", fmt.Errorf("the provider refused: %s", reason)
+	}
+
+	claims, err := p.exchange(r.Context(), query.Get("code"), pending.redirectURL)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Nonce != pending.nonce {
+		return "", "", fmt.Errorf("the ID token is for another sign-in")
+	}
+	// An email the provider hasn't verified could be anyone's
+	user := claims.Subject
+	if claims.Email != "" && (claims.EmailVerified == true || claims.EmailVerified == "true") {
+		user = claims.Email
+	}
+	if !slices.Contains(p.opts.Allow, user) && !slices.Contains(p.opts.Allow, claims.Subject) {
+		return "", "", fmt.Errorf("%s is not allowed in", user)
+	}
+	return user, pending.next, nil
+}
+
+// idClaims are the claims of an ID token serve checks
+type idClaims struct {
+	Issuer        string      `json:"iss"`
+	Subject       string      `json:"sub"`
+	Audience      audience    `json:"aud"`
+	Expires       int64       `json:"exp"`
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // a bool, or a string from some providers
+}
+
+// audience is the aud claim, a single client ID or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// exchange trades an authorization code for an ID token and returns its
+// claims. The token comes straight from the provider's token endpoint over
+// TLS, which OpenID Connect accepts in place of checking its signature.
+func (p *oidcProvider) exchange(ctx context.Context, code, redirectURL string) (*idClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.opts.ClientID},
+		"client_secret": {p.opts.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("redeeming the sign-in: %w", err)
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("redeeming the sign-in: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("redeeming the sign-in: %s %s", resp.Status, tokens.Error)
+	}
+
+	parts := strings.Split(tokens.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("the provider returned a malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("the provider returned a malformed ID token: %w", err)
+	}
+	var claims idClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("the provider returned a malformed ID token: %w", err)
+	}
+	switch {
+	case claims.Issuer != p.opts.Issuer:
+		return nil, fmt.Errorf("the ID token is from %s, not %s", claims.Issuer, p.opts.Issuer)
+	case !slices.Contains(claims.Audience, p.opts.ClientID):
+		return nil, fmt.Errorf("the ID token is for another client")
+	case time.Now().Unix() >= claims.Expires:
+		return nil, fmt.Errorf("the ID token has expired")
+	case claims.Subject == "":
+		return nil, fmt.Errorf("the ID token names no user")
+	}
+	return &claims, nil
+}
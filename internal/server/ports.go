@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/record"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// maxPorts limits how far past the default port a free port is searched for
+const maxPorts = 100
+
+// unixScheme prefixes the API URL of a server listening on a unix socket,
+// e.g. unix:///home/me/.cache/llm-cli/sockets/1966.sock. With sockets on,
+// a model's port only numbers its socket.
+const unixScheme = "unix://"
+
+// socketClients holds an HTTP client per unix socket so connections are reused
+var socketClients sync.Map
+
+// modelPort returns the port a model's server listens on: that of its
+// running server, which may have been started on another port for a
+// stack, or else the model's own. Models started before ports were
+// assigned per model use the default port.
+func modelPort(store *db.Store, cfg *config.Config, model *db.Model) int {
+	if servers, err := store.GetServers(); err == nil {
+		// The newest server for the model is the one requests go to
+		for i := len(servers) - 1; i >= 0; i-- {
+			if servers[i].ModelPath == model.FilePath {
+				return servers[i].Port
+			}
+		}
+	}
+	if model.Port != 0 {
+		return model.Port
+	}
+	return cfg.DefaultPort
+}
+
+// modelURL returns the API URL of a server listening on port
+func modelURL(cfg *config.Config, port int) string {
+	if cfg.Socket {
+		return unixScheme + cfg.ServerSocketPath(port)
+	}
+	u, err := url.Parse(cfg.APIURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Sprintf("http://localhost:%d", port)
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	return u.String()
+}
+
+// serverAddress describes where the server numbered port listens, for messages
+func serverAddress(cfg *config.Config, port int) string {
+	if cfg.Socket {
+		return cfg.ServerSocketPath(port)
+	}
+	return fmt.Sprintf("port %d", port)
+}
+
+// listenArgs returns the llama-server arguments that make it listen on
+// port, or on its unix socket when sockets are on
+func listenArgs(cfg *config.Config, port int) ([]string, error) {
+	if !cfg.Socket {
+		return []string{"--port", strconv.Itoa(port)}, nil
+	}
+	socket := cfg.ServerSocketPath(port)
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, fmt.Errorf("creating socket directory: %w", err)
+	}
+	// A socket left behind by a server that didn't exit cleanly
+	os.Remove(socket)
+	// llama-server listens on a unix socket when the host ends in .sock
+	return []string{"--host", socket}, nil
+}
+
+// tcpClient sends requests to servers listening on TCP ports and to remote
+// backends, connecting within the connect timeout of the request's context.
+// Requests to servers, unlike those to Hugging Face, are recorded with --record.
+var tcpClient = func() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialContext
+	return &http.Client{Transport: record.Transport(ui.LoggingTransport(transport))}
+}()
+
+// httpTarget returns the client and base URL for requests to apiURL, which
+// is an http(s) URL or unixScheme followed by a socket path
+func httpTarget(apiURL string) (*http.Client, string) {
+	if strings.HasPrefix(apiURL, config.MockScheme) {
+		// The host is ignored, since the mock backend answers in process
+		return mockClient(apiURL), "http://mock"
+	}
+	socket, ok := strings.CutPrefix(apiURL, unixScheme)
+	if !ok {
+		return tcpClient, apiURL
+	}
+	client, ok := socketClients.Load(socket)
+	if !ok {
+		client, _ = socketClients.LoadOrStore(socket, &http.Client{
+			Transport: record.Transport(ui.LoggingTransport(&http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialContext(ctx, "unix", socket)
+				},
+			})),
+		})
+	}
+	// The host is ignored, since every connection goes to the socket
+	return client.(*http.Client), "http://localhost"
+}
+
+// allocatePort picks the port for a model's server: cfg.Port if set, for
+// this launch only, otherwise the one it had before if nothing else is
+// using it, otherwise the first free port from the default port up that
+// isn't assigned to another model. That assignment is recorded so the
+// model keeps its port across restarts.
+func allocatePort(store *db.Store, cfg *config.Config, model *db.Model) (int, error) {
+	if cfg.Port != 0 {
+		if !portFree(cfg, cfg.Port) {
+			return 0, fmt.Errorf("%s is already in use", serverAddress(cfg, cfg.Port))
+		}
+		return cfg.Port, nil
+	}
+	if model.Port != 0 && portFree(cfg, model.Port) {
+		return model.Port, nil
+	}
+
+	models, err := store.GetAllModels()
+	if err != nil {
+		return 0, err
+	}
+	assigned := make(map[int]bool)
+	for _, m := range models {
+		if m.Slug != model.Slug && m.Port != 0 {
+			assigned[m.Port] = true
+		}
+	}
+
+	for port := cfg.DefaultPort; port < cfg.DefaultPort+maxPorts; port++ {
+		if assigned[port] || !portFree(cfg, port) {
+			continue
+		}
+		if err := store.SetModelPort(model.Slug, port); err != nil {
+			return 0, err
+		}
+		model.Port = port
+		return port, nil
+	}
+
+	return 0, fmt.Errorf("no free port between %d and %d", cfg.DefaultPort, cfg.DefaultPort+maxPorts-1)
+}
+
+// portFree reports whether nothing is listening on a local port, or on the
+// socket it numbers when sockets are on
+func portFree(cfg *config.Config, port int) bool {
+	if cfg.Socket {
+		conn, err := net.Dial("unix", cfg.ServerSocketPath(port))
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// preflight tokenizes a chat's history in the background while the user
+// types the next message, so that when it is sent the context it will use
+// and the time to the first token can be shown without waiting on the server
+type preflight struct {
+	cfg         *config.Config
+	contextSize int // 0 if unknown
+
+	mu         sync.Mutex
+	done       chan struct{} // closed when the count in flight finishes
+	history    int           // tokens in the history; -1 if it couldn't be counted
+	promptRate float64       // prompt tokens evaluated per second in the last reply; 0 if unknown
+}
+
+func newPreflight(cfg *config.Config, contextSize int) *preflight {
+	done := make(chan struct{})
+	close(done)
+	return &preflight{cfg: cfg, contextSize: contextSize, done: done}
+}
+
+// start counts the tokens of prompt, the rendered history, in the background
+func (p *preflight) start(prompt string) {
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.done = done
+	p.mu.Unlock()
+
+	cfg := p.cfg
+	go func() {
+		n, err := countTokens(cfg, prompt)
+		if err != nil {
+			n = -1
+		}
+		p.mu.Lock()
+		p.history = n
+		p.mu.Unlock()
+		close(done)
+	}()
+}
+
+// observe records how fast the server evaluated the last prompt
+func (p *preflight) observe(stats completionStats) {
+	if stats.PromptPerSecond > 0 {
+		p.promptRate = stats.PromptPerSecond
+	}
+}
+
+// tokens returns how many tokens the history takes, once the count in
+// flight finishes, or -1 if it couldn't be counted
+func (p *preflight) tokens() int {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	<-done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.history
+}
+
+// count returns how many tokens the conversation will take once message
+// is added, and how many of those are message's. The history was tokenized
+// ahead, so only the new message is. ok is false if either couldn't be
+// counted.
+func (p *preflight) count(message string) (total, added int, ok bool) {
+	history := p.tokens()
+	if history < 0 {
+		return 0, 0, false
+	}
+	added, err := countTokens(p.cfg, message)
+	if err != nil {
+		return 0, 0, false
+	}
+	return history + added, added, true
+}
+
+// estimate returns a note on the context a message of added tokens brings
+// the conversation to, total, and how long until the first token, e.g.
+// "~2140 of 8192 tokens (26%) · first token in ~0.3s". The server caches
+// the history, so only the message is evaluated.
+func (p *preflight) estimate(total, added int) string {
+	parts := []string{fmt.Sprintf("~%d tokens", total)}
+	if p.contextSize > 0 {
+		parts[0] = fmt.Sprintf("~%d of %d tokens (%.0f%%)", total, p.contextSize, float64(total)/float64(p.contextSize)*100)
+	}
+	if p.promptRate > 0 {
+		parts = append(parts, fmt.Sprintf("first token in ~%.1fs", float64(added)/p.promptRate))
+	}
+	return strings.Join(parts, " · ")
+}
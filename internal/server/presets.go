@@ -0,0 +1,47 @@
+package server
+
+// SamplingPreset is a named group of sampling settings
+type SamplingPreset struct {
+	Name        string
+	Description string
+	Values      map[string]string
+}
+
+// samplingModes are cleared by every preset that doesn't set them, so a
+// preset fully replaces the previous sampling mode
+var samplingModes = []string{"mirostat", "mirostat-tau", "mirostat-eta", "dynatemp-range", "dynatemp-exponent"}
+
+// SamplingPresets lists the available presets
+var SamplingPresets = []SamplingPreset{
+	{"default", "turn off mirostat and dynamic temperature", map[string]string{}},
+	{"precise", "low temperature for factual and code answers", map[string]string{"temperature": "0.2", "top-p": "0.9"}},
+	{"creative", "higher temperature that adapts to token entropy", map[string]string{
+		"temperature": "1.0", "dynatemp-range": "0.5", "dynatemp-exponent": "1.0"}},
+	{"dynatemp", "dynamic temperature around the current temperature", map[string]string{
+		"dynatemp-range": "0.3", "dynatemp-exponent": "1.0"}},
+	{"mirostat", "mirostat 2.0, steady perplexity for long-form text", map[string]string{
+		"mirostat": "2", "mirostat-tau": "5.0", "mirostat-eta": "0.1"}},
+	{"mirostat-v1", "original mirostat algorithm", map[string]string{
+		"mirostat": "1", "mirostat-tau": "5.0", "mirostat-eta": "0.1"}},
+}
+
+// LookupPreset finds a sampling preset by name
+func LookupPreset(name string) (SamplingPreset, bool) {
+	for _, preset := range SamplingPresets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return SamplingPreset{}, false
+}
+
+// Unset returns the sampling mode settings the preset removes
+func (p SamplingPreset) Unset() []string {
+	var unset []string
+	for _, name := range samplingModes {
+		if _, ok := p.Values[name]; !ok {
+			unset = append(unset, name)
+		}
+	}
+	return unset
+}
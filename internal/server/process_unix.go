@@ -0,0 +1,51 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// processExists reports whether a process with pid is running
+func processExists(pid int) bool {
+	// Signal 0 checks that the process exists without signaling it
+	return syscall.Kill(pid, 0) == nil
+}
+
+// stopProcess asks the process with pid to exit, or kills it if force is
+// set. A process that has already exited isn't an error.
+func stopProcess(pid int, force bool) error {
+	sig := syscall.SIGTERM
+	if force {
+		sig = syscall.SIGKILL
+	}
+	if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// stoppedOnRequest reports whether a process that exited was ended by the
+// signal stopProcess or Ctrl-C sends. Being killed outright isn't, since
+// that is also how the kernel stops a server that ran out of memory.
+func stoppedOnRequest(state *os.ProcessState) bool {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+	return status.Signal() == syscall.SIGTERM || status.Signal() == syscall.SIGINT
+}
+
+// detachProcess starts cmd in a session of its own, so it keeps running
+// after the terminal that started it closes
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// separateProcessGroup starts cmd in a process group of its own, so
+// Ctrl-C in the terminal doesn't reach it
+func separateProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
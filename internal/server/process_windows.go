@@ -0,0 +1,64 @@
+//go:build windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259
+	detachedProcess                = 0x00000008
+)
+
+// processExists reports whether a process with pid is running
+func processExists(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// stopProcess ends the process with pid. Windows has no signal to ask a
+// process to exit, so it is killed whether or not force is set. A process
+// that has already exited isn't an error.
+func stopProcess(pid int, force bool) error {
+	if !processExists(pid) {
+		return nil
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Kill(); err != nil && processExists(pid) {
+		return err
+	}
+	return nil
+}
+
+// stoppedOnRequest reports whether a process that exited was ended by
+// stopProcess, which kills it with exit code 1
+func stoppedOnRequest(state *os.ProcessState) bool {
+	return state.ExitCode() == 1
+}
+
+// detachProcess starts cmd without a console, so it keeps running after
+// the terminal that started it closes
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
+
+// separateProcessGroup starts cmd in a process group of its own, so
+// Ctrl-C in the terminal doesn't reach it
+func separateProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
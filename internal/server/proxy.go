@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// maxProxyBody is the largest request body the proxy accepts
+const maxProxyBody = 32 << 20
+
+// proxiedEndpoints are the OpenAI API endpoints passed on to a model's
+// llama-server, which serves them itself
+var proxiedEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+// ServeOptions controls the OpenAI-compatible proxy
+type ServeOptions struct {
+	Host string // address to listen on, e.g. 127.0.0.1
+	Port int
+
+	// APIKey, when set, must come with every request, as a bearer token or
+	// as the basic auth password of User
+	APIKey string
+	User   string
+
+	// OIDC, when set, lets browsers sign in with an OpenID Connect provider
+	// instead, keeping them signed in with a session cookie
+	OIDC *OIDCOptions
+
+	// UI serves a chat page for the models at /
+	UI bool
+
+	// Tailnet reports that Host is this machine's Tailscale address, which
+	// only the tailnet can reach, so serving there without auth is expected
+	Tailnet bool
+
+	// TailscaleServe also registers the address with Tailscale Serve, for
+	// HTTPS at this machine's tailnet name, until serving stops
+	TailscaleServe bool
+
+	// Expected, if set, returns the models /healthz reports as stopped
+	// when they have no running server, such as those of a stack
+	Expected func() []string
+}
+
+// proxy answers OpenAI API requests with the installed models, starting
+// their servers when they are first asked for
+type proxy struct {
+	store    *db.Store
+	cfg      *config.Config
+	expected func() []string
+
+	// starting holds a mutex per slug, so concurrent first requests for a
+	// model start its server once
+	starting sync.Map
+}
+
+// Serve runs an OpenAI-compatible API on opts.Host and opts.Port until ctx
+// is done. The model field of each request names an installed model,
+// whose server is started if it isn't running; the request is then passed
+// on to it and the response, streamed or not, passed back.
+func Serve(ctx context.Context, store *db.Store, cfg *config.Config, opts ServeOptions) error {
+	p := &proxy{store: store, cfg: cfg, expected: opts.Expected}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", p.handleModels)
+	mux.HandleFunc("/healthz", p.handleHealth)
+	for _, endpoint := range proxiedEndpoints {
+		mux.HandleFunc(endpoint, p.handleProxy)
+	}
+	if opts.UI {
+		mux.HandleFunc("/", handleUI(opts.OIDC != nil))
+	}
+
+	var handler http.Handler = mux
+	if opts.APIKey != "" || opts.OIDC != nil {
+		auth := &authenticator{key: opts.APIKey, user: opts.User}
+		if opts.OIDC != nil {
+			var err error
+			if auth.oidc, err = discoverOIDC(ctx, *opts.OIDC); err != nil {
+				return err
+			}
+		}
+		handler = auth.requireAuth(mux)
+	} else if !loopback(opts.Host) && !opts.Tailnet {
+		ui.PrintWarn(fmt.Sprintf("Listening on %s without --auth: anyone on the network can use the models. Add --auth basic to require the proxy-api-key secret, or --auth oidc to sign in.", opts.Host))
+	}
+
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	httpServer := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	ui.PrintInfo(fmt.Sprintf("Serving the OpenAI API for the installed models on http://%s/v1", addr))
+	if opts.UI {
+		ui.PrintInfo(fmt.Sprintf("Serving the chat page on http://%s/", addr))
+	}
+	if opts.TailscaleServe {
+		url, remove, err := tailscaleServe(addr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		defer remove()
+		ui.PrintInfo(fmt.Sprintf("Also serving it to the tailnet at %s/v1 with Tailscale Serve.", url))
+	}
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving: %w", err)
+	}
+	ui.PrintInfo("Stopped serving.")
+	return nil
+}
+
+// handleModels lists the installed models the way OpenAI lists its models
+func (p *proxy) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		openAIError(w, http.StatusMethodNotAllowed, "use GET to list models", "method_not_allowed")
+		return
+	}
+	models, err := p.store.GetAllModels()
+	if err != nil {
+		openAIError(w, http.StatusInternalServerError, err.Error(), "internal_error")
+		return
+	}
+	type entry struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := struct {
+		Object string  `json:"object"`
+		Data   []entry `json:"data"`
+	}{Object: "list", Data: []entry{}}
+	for _, model := range models {
+		list.Data = append(list.Data, entry{ID: model.Slug, Object: "model", Created: model.CreatedAt.Unix(), OwnedBy: "llm-cli"})
+	}
+	writeJSON(w, list)
+}
+
+// handleHealth reports the health of every running server, answering 503
+// when any isn't healthy so monitors need only check the status code
+func (p *proxy) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		openAIError(w, http.StatusMethodNotAllowed, "use GET to check health", "method_not_allowed")
+		return
+	}
+	var expected []string
+	if p.expected != nil {
+		expected = p.expected()
+	}
+	report, err := CheckAllHealth(r.Context(), p.store, p.cfg, expected)
+	if err != nil {
+		openAIError(w, http.StatusInternalServerError, err.Error(), "internal_error")
+		return
+	}
+	if report.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// handleProxy passes a request on to the server of the model it names
+func (p *proxy) handleProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		openAIError(w, http.StatusMethodNotAllowed, "use POST for "+r.URL.Path, "method_not_allowed")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxProxyBody+1))
+	if err != nil {
+		openAIError(w, http.StatusBadRequest, fmt.Sprintf("reading request: %v", err), "invalid_request")
+		return
+	}
+	if len(body) > maxProxyBody {
+		openAIError(w, http.StatusRequestEntityTooLarge, "request body too large", "invalid_request")
+		return
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		openAIError(w, http.StatusBadRequest, fmt.Sprintf("parsing request: %v", err), "invalid_request")
+		return
+	}
+	if req.Model == "" {
+		openAIError(w, http.StatusBadRequest, "the model field must name an installed model; GET /v1/models lists them", "model_not_found")
+		return
+	}
+	if _, err := p.store.GetModelBySlug(req.Model); err != nil {
+		openAIError(w, http.StatusNotFound, fmt.Sprintf("model %q is not installed; GET /v1/models lists the installed models", req.Model), "model_not_found")
+		return
+	}
+
+	cfg, err := p.ensure(r.Context(), req.Model)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		openAIError(w, http.StatusServiceUnavailable, fmt.Sprintf("starting model %s: %v", req.Model, err), "model_unavailable")
+		return
+	}
+	touchActivity(cfg, apiPort(cfg))
+
+	client, baseURL := httpTarget(cfg.APIURL)
+	target, err := url.Parse(baseURL)
+	if err != nil {
+		openAIError(w, http.StatusInternalServerError, err.Error(), "internal_error")
+		return
+	}
+	// The client's own API key is not passed on; the backend's is
+	backendHeader := http.Header{}
+	if err := setBackendHeaders(cfg, backendHeader); err != nil {
+		openAIError(w, http.StatusBadGateway, err.Error(), "bad_gateway")
+		return
+	}
+	// Requests that pass through count toward the server's health like
+	// llm-cli's own
+	record := func(err error) {}
+	if recordRequest := requestRecorder(cfg.APIURL); recordRequest != nil {
+		start := time.Now()
+		record = func(err error) { recordRequest(time.Since(start), err) }
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(out *httputil.ProxyRequest) {
+			out.SetURL(target)
+			out.Out.Body = io.NopCloser(bytes.NewReader(body))
+			out.Out.ContentLength = int64(len(body))
+			out.Out.Header.Del("Authorization")
+			for name, values := range backendHeader {
+				out.Out.Header[name] = values
+			}
+		},
+		Transport: client.Transport,
+		// Streamed responses are passed on as each event arrives
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode >= http.StatusInternalServerError {
+				record(fmt.Errorf("the server answered %s", resp.Status))
+			} else {
+				record(nil)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() == nil {
+				if !connectionRefused(err) {
+					record(err)
+				}
+				openAIError(w, http.StatusBadGateway, fmt.Sprintf("model %s: %v", req.Model, err), "bad_gateway")
+			}
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// ensure makes sure a model's server is running and returns the config
+// its requests use
+func (p *proxy) ensure(ctx context.Context, slug string) (*config.Config, error) {
+	mu, _ := p.starting.LoadOrStore(slug, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	if err := EnsureServerRunningContext(ctx, p.store, p.cfg, slug); err != nil {
+		return nil, err
+	}
+	return ModelConfig(p.store, p.cfg, slug)
+}
+
+// openAIError writes an error the way the OpenAI API reports them
+func openAIError(w http.ResponseWriter, status int, message, code string) {
+	errorType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errorType = "server_error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": errorType, "code": code},
+	})
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// runningServers returns the recorded servers whose processes are still
+// running, forgetting any that have exited
+func runningServers(store *db.Store) ([]db.Server, error) {
+	servers, err := store.GetServers()
+	if err != nil {
+		return nil, err
+	}
+
+	running := servers[:0]
+	for _, srv := range servers {
+		if serverAlive(srv) {
+			running = append(running, srv)
+		} else if err := store.RemoveServer(srv.PID); err != nil {
+			return nil, err
+		}
+	}
+	return running, nil
+}
+
+// serverAlive reports whether a recorded server's process still exists.
+// Where /proc is available it also checks that the PID hasn't been reused
+// by another program.
+func serverAlive(srv db.Server) bool {
+	if !processExists(srv.PID) {
+		return false
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", srv.PID))
+	if err != nil {
+		return true
+	}
+	return bytes.Contains(cmdline, []byte(srv.ModelPath))
+}
+
+// signalServers asks each server to exit, or kills it if force is set,
+// returning the first failure
+func signalServers(servers []db.Server, force bool) error {
+	var firstErr error
+	for _, srv := range servers {
+		if err := stopProcess(srv.PID, force); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("signaling process %d: %w", srv.PID, err)
+		}
+	}
+	return firstErr
+}
+
+// waitForExit waits up to timeout for the servers to exit and returns
+// those still running
+func waitForExit(servers []db.Server, timeout time.Duration) []db.Server {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := servers[:0:0]
+		for _, srv := range servers {
+			if serverAlive(srv) {
+				remaining = append(remaining, srv)
+			}
+		}
+		if len(remaining) == 0 || time.Now().After(deadline) {
+			return remaining
+		}
+		servers = remaining
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// Reregister runs rebuild, which records the installed models afresh as
+// 'reset' and 'import' do, without losing track of running servers. While
+// servers are running it refuses unless force is set, and then records
+// them again against the rebuilt models, restoring their ports. Servers
+// whose model is gone are left running and named so they can be killed.
+// A reset replaces the database file the daemon has open, so it is always
+// refused while the daemon runs.
+func Reregister(store *db.Store, cfg *config.Config, action string, force bool, rebuild func() error) error {
+	servers, err := runningServers(store)
+	if err != nil {
+		return err
+	}
+	status := daemonStatus(cfg)
+	if status != nil && action == "reset" {
+		return fmt.Errorf("the daemon has the database open; stop it with 'llm-cli daemon stop' before a reset")
+	}
+	if len(servers) > 0 {
+		slugs := make([]string, len(servers))
+		for i, srv := range servers {
+			slugs[i] = srv.Slug
+		}
+		if !force {
+			return fmt.Errorf("servers are running for %s; stop them with 'llm-cli kill all' before the %s, or add --force to keep them running",
+				strings.Join(slugs, ", "), action)
+		}
+		ui.PrintWarn(fmt.Sprintf("Keeping the servers for %s running through the %s.", strings.Join(slugs, ", "), action))
+	}
+
+	if err := rebuild(); err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	// A reset replaces the database file, so open it again
+	rebuilt, err := db.New(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer rebuilt.Close()
+	return reconcile(rebuilt, cfg, servers, status)
+}
+
+// reconcile records servers running before a rebuild against the rebuilt
+// models, matched by model file. A daemon server whose slug is gone is
+// released, since the daemon knows its servers by slug; it starts the
+// model again under its new slug when it is next used.
+func reconcile(store *db.Store, cfg *config.Config, servers []db.Server, status *DaemonStatus) error {
+	models, err := store.GetAllModels()
+	if err != nil {
+		return fmt.Errorf("retrieving models: %w", err)
+	}
+	byPath := make(map[string][]db.Model)
+	for _, model := range models {
+		byPath[model.FilePath] = append(byPath[model.FilePath], model)
+	}
+	daemonPIDs := make(map[int]bool)
+	if status != nil {
+		for _, srv := range status.Servers {
+			daemonPIDs[srv.PID] = true
+		}
+	}
+
+	for _, srv := range servers {
+		candidates := byPath[srv.ModelPath]
+		if len(candidates) == 0 {
+			ui.PrintWarn(fmt.Sprintf("The server for %s (PID %d) serves %s, which is no longer installed; stop it with 'llm-cli kill %d'.",
+				srv.Slug, srv.PID, srv.ModelPath, srv.PID))
+			continue
+		}
+		model := candidates[0]
+		for _, candidate := range candidates {
+			if candidate.Slug == srv.Slug {
+				model = candidate
+			}
+		}
+
+		if model.Slug != srv.Slug && daemonPIDs[srv.PID] {
+			if _, err := daemonRelease(cfg, stopRequest{PID: srv.PID}); err != nil {
+				return err
+			}
+			ui.PrintInfo(fmt.Sprintf("Stopped the daemon's server for %s; it starts again as %s when next used.", srv.Slug, model.Slug))
+			continue
+		}
+		if model.Slug != srv.Slug {
+			ui.PrintInfo(fmt.Sprintf("The server for %s (PID %d) now belongs to model %s.", srv.Slug, srv.PID, model.Slug))
+		}
+		srv.Slug = model.Slug
+		if err := store.AddServer(srv); err != nil {
+			return err
+		}
+		if err := store.SetModelPort(model.Slug, srv.Port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/record"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// ReplayOptions controls where Replay sends the recorded requests
+type ReplayOptions struct {
+	Model string // the model whose server they go to, started if needed
+}
+
+// Replay sends the requests recorded with --record in path again and
+// compares each response with the recorded one. They go to the server of
+// opts.Model, to the backend selected with --backend, or else to the server
+// each was recorded from.
+func Replay(ctx context.Context, store *db.Store, cfg *config.Config, path string, opts ReplayOptions) error {
+	exchanges, err := record.Read(path)
+	if err != nil {
+		return err
+	}
+	if len(exchanges) == 0 {
+		return fmt.Errorf("%s has no recorded requests", path)
+	}
+
+	// Without a target, each request goes back where it was recorded
+	var target *config.Config
+	if opts.Model != "" {
+		if err := EnsureServerRunningContext(ctx, store, cfg, opts.Model); err != nil {
+			return err
+		}
+		if target, err = ModelConfig(store, cfg, opts.Model); err != nil {
+			return err
+		}
+	} else if cfg.RemoteBackend() {
+		target = cfg
+	}
+
+	var same, different, failed int
+	for i, exchange := range exchanges {
+		fmt.Printf("[%d/%d] %s %s\n", i+1, len(exchanges), exchange.Request.Method, exchange.Request.URL.RequestURI())
+		fmt.Printf("  recorded  %s\n", replaySummary(exchange.Response.Status, exchange.Took))
+
+		requestCfg := target
+		if requestCfg == nil {
+			requestCfg = recordedServer(cfg, exchange.Request.URL)
+		}
+		start := time.Now()
+		status, contentType, body, err := replayRequest(ctx, requestCfg, exchange)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if connectionRefused(err) {
+				return fmt.Errorf("no server is listening at %s; start one, or replay to a model with --model", requestCfg.APIURL)
+			}
+			fmt.Printf("  replayed  failed: %v\n\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("  replayed  %s\n", replaySummary(status, time.Since(start)))
+
+		recorded := responseText(exchange.Response.Header.Get("Content-Type"), exchange.ResponseBody)
+		replayed := responseText(contentType, body)
+		if recorded == replayed && status == exchange.Response.Status {
+			fmt.Printf("  same output\n\n")
+			same++
+			continue
+		}
+		different++
+		fmt.Println("  output differs")
+		fmt.Printf("  --- recorded\n%s\n", indentLines(recorded, "  "))
+		fmt.Printf("  +++ replayed\n%s\n\n", indentLines(replayed, "  "))
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Replayed %d requests: %d with the same output, %d different, %d failed.",
+		len(exchanges), same, different, failed))
+	return nil
+}
+
+// recordedServer returns cfg with its API URL pointed at the server a
+// request was recorded from. The mock backend answers in process, so a
+// request recorded from it goes to a mock with the default settings.
+func recordedServer(cfg *config.Config, recorded *url.URL) *config.Config {
+	serverCfg := *cfg
+	if recorded.Host == "mock" {
+		serverCfg.APIURL = config.MockScheme
+	} else {
+		serverCfg.APIURL = recorded.Scheme + "://" + recorded.Host
+	}
+	return &serverCfg
+}
+
+// replayRequest sends a recorded request to the server cfg points at and
+// returns the response's status, content type and body
+func replayRequest(ctx context.Context, cfg *config.Config, exchange record.Exchange) (string, string, []byte, error) {
+	var body []byte
+	if len(exchange.RequestBody) > 0 {
+		body = exchange.RequestBody
+	}
+	resp, err := apiRequestContext(ctx, cfg, exchange.Request.Method, exchange.Request.URL.RequestURI(), body)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer resp.Body.Close()
+	received, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("reading response: %w", err)
+	}
+	return resp.Status, resp.Header.Get("Content-Type"), received, nil
+}
+
+// replaySummary describes a response, e.g. "200 OK · 1.2s"
+func replaySummary(status string, took time.Duration) string {
+	if took <= 0 {
+		return status
+	}
+	return fmt.Sprintf("%s · %.1fs", status, took.Seconds())
+}
+
+// responseText returns what a response says, for comparing: the text
+// generated, for completions whether streamed or not, and otherwise the
+// body itself
+func responseText(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		var text strings.Builder
+		for _, line := range strings.Split(string(body), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			var chunk map[string]interface{}
+			if json.Unmarshal([]byte(data), &chunk) == nil {
+				generated, _ := generatedText(chunk)
+				text.WriteString(generated)
+			}
+		}
+		return text.String()
+	}
+
+	var result map[string]interface{}
+	if json.Unmarshal(body, &result) == nil {
+		if generated, ok := generatedText(result); ok {
+			return generated
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// generatedText returns the text in a completion or a chunk of one, as
+// llama-server's /completion or the OpenAI endpoints return it
+func generatedText(result map[string]interface{}) (string, bool) {
+	if content, ok := result["content"].(string); ok {
+		return content, true
+	}
+	choices, _ := result["choices"].([]interface{})
+	if len(choices) == 0 {
+		return "", false
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if text, ok := choice["text"].(string); ok {
+		return text, true
+	}
+	for _, key := range []string{"message", "delta"} {
+		if message, ok := choice[key].(map[string]interface{}); ok {
+			content, _ := message["content"].(string)
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// indentLines prefixes every line of text with indent
+func indentLines(text, indent string) string {
+	return indent + strings.ReplaceAll(text, "\n", "\n"+indent)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// sessionCookie holds the session of a browser signed in with OIDC
+const sessionCookie = "llm_cli_session"
+
+// sessionLifetime is how long a sign-in lasts
+const sessionLifetime = 12 * time.Hour
+
+// authenticator lets through requests carrying the key, or the session
+// cookie of a browser signed in with the OIDC provider
+type authenticator struct {
+	key  string // as a bearer token, or the basic auth password of user
+	user string
+	oidc *oidcProvider // nil when browsers can't sign in
+
+	mu       sync.Mutex
+	sessions map[string]signIn // by cookie value
+}
+
+// signIn is a browser's session, kept only in memory, so restarting serve
+// signs everyone out
+type signIn struct {
+	user    string
+	expires time.Time
+}
+
+// requireAuth wraps the proxy's handler so only signed-in requests get
+// through. Others get a 401, or browsers are sent to sign in when there is
+// a provider to sign in with.
+func (a *authenticator) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.oidc != nil {
+			switch r.URL.Path {
+			case "/auth/login":
+				a.oidc.login(w, r)
+				return
+			case "/auth/callback":
+				a.callback(w, r)
+				return
+			case "/auth/logout":
+				a.logout(w, r)
+				return
+			}
+		}
+		if a.keyGiven(r) || a.sessionUser(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ui.Debug("Rejected unauthenticated request", "remote", r.RemoteAddr, "path", r.URL.Path)
+		if a.oidc != nil && r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		if a.key != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="llm-cli", charset="UTF-8"`)
+		}
+		openAIError(w, http.StatusUnauthorized, "missing or wrong API key; send the proxy-api-key secret as a bearer token or basic auth password", "invalid_api_key")
+	})
+}
+
+// keyGiven reports whether r carries the key: as a bearer token, the way
+// OpenAI clients send their API key, or as the password of HTTP basic auth
+// for the user, the way browsers and curl -u do
+func (a *authenticator) keyGiven(r *http.Request) bool {
+	if a.key == "" {
+		return false
+	}
+	if given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return equal(given, a.key)
+	}
+	user, given, ok := r.BasicAuth()
+	// Check both, so a wrong user name takes as long as a wrong key
+	userOK, keyOK := equal(user, a.user), equal(given, a.key)
+	return ok && userOK && keyOK
+}
+
+// equal compares secrets in constant time
+func equal(given, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+}
+
+// sessionUser returns who r's session cookie signed in as, or ""
+func (a *authenticator) sessionUser(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[cookie.Value]
+	if !ok {
+		return ""
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, cookie.Value)
+		return ""
+	}
+	return s.user
+}
+
+// callback finishes signing in with the provider and starts a session
+func (a *authenticator) callback(w http.ResponseWriter, r *http.Request) {
+	user, next, err := a.oidc.finish(r)
+	if err != nil {
+		ui.Debug("Rejected sign-in", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, "Sign-in failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.mu.Lock()
+	if a.sessions == nil {
+		a.sessions = make(map[string]signIn)
+	}
+	a.sessions[id] = signIn{user: user, expires: time.Now().Add(sessionLifetime)}
+	a.mu.Unlock()
+	ui.PrintInfo("Signed in " + user + ".")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// logout ends the browser's session
+func (a *authenticator) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: secureRequest(r)})
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Signed out.\n"))
+}
+
+// secureRequest reports whether r reached serve over HTTPS, directly or
+// through a proxy such as Tailscale Serve
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// randomToken returns an unguessable token for cookies and sign-in state
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loopback reports whether host only accepts connections from this machine
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
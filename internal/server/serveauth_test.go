@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// okHandler stands in for the proxy behind requireAuth
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestRequireAuthKey(t *testing.T) {
+	handler := (&authenticator{key: "secret-key", user: "llm-cli"}).requireAuth(okHandler)
+
+	tests := []struct {
+		name   string
+		header string
+		user   string
+		pass   string
+		want   int
+	}{
+		{"no credentials", "", "", "", http.StatusUnauthorized},
+		{"bearer token", "Bearer secret-key", "", "", http.StatusOK},
+		{"wrong bearer token", "Bearer secret-kez", "", "", http.StatusUnauthorized},
+		{"empty bearer token", "Bearer ", "", "", http.StatusUnauthorized},
+		{"basic auth", "", "llm-cli", "secret-key", http.StatusOK},
+		{"basic auth, wrong user", "", "admin", "secret-key", http.StatusUnauthorized},
+		{"basic auth, wrong key", "", "llm-cli", "secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("a rejected request isn't asked for basic auth")
+			}
+		})
+	}
+
+	// Without a key only a session gets in
+	handler = (&authenticator{}).requireAuth(okHandler)
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("an empty key let a request in: status %d", rec.Code)
+	}
+}
+
+// testProvider is an OIDC provider answering the token request with an ID
+// token of claims
+type testProvider struct {
+	*httptest.Server
+	claims map[string]interface{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	p := &testProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "the-code" || r.FormValue("client_secret") != "client-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		payload, _ := json.Marshal(p.claims)
+		token := "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// signInWith goes through /auth/login and /auth/callback, with the provider
+// answering with the claims change makes of valid ones, and returns the
+// response to the callback
+func signInWith(t *testing.T, handler http.Handler, p *testProvider, next string, callback url.Values, change func(claims map[string]interface{})) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login?next="+url.QueryEscape(next), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("/auth/login status = %d, want a redirect", rec.Code)
+	}
+	login, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(login.String(), p.URL+"/authorize?") {
+		t.Fatalf("/auth/login redirected to %q, not the provider", rec.Header().Get("Location"))
+	}
+
+	p.claims = map[string]interface{}{
+		"iss":            p.URL,
+		"aud":            []string{"client-id"},
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          login.Query().Get("nonce"),
+		"email":          "ann@example.com",
+		"email_verified": true,
+	}
+	if change != nil {
+		change(p.claims)
+	}
+	query := url.Values{"state": {login.Query().Get("state")}, "code": {"the-code"}}
+	for name, values := range callback {
+		query[name] = values
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?"+query.Encode(), nil))
+	return rec
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	p := newTestProvider(t)
+	provider, err := discoverOIDC(context.Background(), OIDCOptions{
+		Issuer:       p.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Allow:        []string{"ann@example.com", "user-2"},
+	})
+	if err != nil {
+		t.Fatalf("discoverOIDC: %v", err)
+	}
+	handler := (&authenticator{oidc: provider}).requireAuth(okHandler)
+
+	// A browser is sent to sign in, an API client just refused
+	req := httptest.NewRequest(http.MethodGet, "/chat?x=1", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/auth/login?next=%2Fchat%3Fx%3D1" {
+		t.Errorf("a browser got %d to %q, want a redirect to sign in", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("an API client got %d, want 401", rec.Code)
+	}
+
+	rec = signInWith(t, handler, p, "/chat", nil, nil)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/chat" {
+		t.Fatalf("/auth/callback = %d to %q, want a redirect to /chat: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("/auth/callback set cookies %v, want the HttpOnly session cookie", cookies)
+	}
+	session := cookies[0]
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("a signed-in request got %d, want 200", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/logout", nil)
+	req.AddCookie(session)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("a request after signing out got %d, want 401", rec.Code)
+	}
+}
+
+func TestOIDCSignInRejected(t *testing.T) {
+	p := newTestProvider(t)
+	provider, err := discoverOIDC(context.Background(), OIDCOptions{
+		Issuer:       p.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Allow:        []string{"ann@example.com", "user-2"},
+	})
+	if err != nil {
+		t.Fatalf("discoverOIDC: %v", err)
+	}
+	handler := (&authenticator{oidc: provider}).requireAuth(okHandler)
+
+	tests := []struct {
+		name     string
+		callback url.Values
+		change   func(claims map[string]interface{})
+		want     string
+	}{
+		{"provider refused", url.Values{"error": {"access_denied"}}, nil, "the provider refused: access_denied"},
+		{"unknown state", url.Values{"state": {"made-up"}}, nil, "unknown or reused sign-in"},
+		{"wrong code", url.Values{"code": {"stolen"}}, nil, "invalid_grant"},
+		{"other nonce", nil, func(c map[string]interface{}) { c["nonce"] = "replayed" }, "another sign-in"},
+		{"other issuer", nil, func(c map[string]interface{}) { c["iss"] = "https://evil.example" }, "not " + p.URL},
+		{"other client", nil, func(c map[string]interface{}) { c["aud"] = "someone-else" }, "another client"},
+		{"expired", nil, func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, "expired"},
+		{"no subject", nil, func(c map[string]interface{}) { c["sub"] = "" }, "names no user"},
+		{"not allowed", nil, func(c map[string]interface{}) { c["email"] = "bob@example.com" }, "bob@example.com is not allowed in"},
+		{"unverified email", nil, func(c map[string]interface{}) { c["email_verified"] = false }, "user-1 is not allowed in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := signInWith(t, handler, p, "/", tt.callback, tt.change)
+			if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("/auth/callback = %d %q, want 403 containing %q", rec.Code, rec.Body, tt.want)
+			}
+			if len(rec.Result().Cookies()) != 0 {
+				t.Error("a rejected sign-in set a cookie")
+			}
+		})
+	}
+
+	// A subject on the allow list gets in even without a verified email
+	rec := signInWith(t, handler, p, "/", nil, func(c map[string]interface{}) {
+		c["sub"], c["email_verified"] = "user-2", "false"
+	})
+	if rec.Code != http.StatusFound {
+		t.Errorf("an allowed subject got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Pages of other sites are never gone back to
+	for _, next := range []string{"https://evil.example/", "//evil.example/", "/\\evil.example"} {
+		if rec := signInWith(t, handler, p, next, nil, nil); rec.Header().Get("Location") != "/" {
+			t.Errorf("signing in from %q went back to %q, want /", next, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestOIDCSignInReused(t *testing.T) {
+	p := newTestProvider(t)
+	provider, err := discoverOIDC(context.Background(), OIDCOptions{
+		Issuer: p.URL, ClientID: "client-id", ClientSecret: "client-secret", Allow: []string{"ann@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := (&authenticator{oidc: provider}).requireAuth(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	login, _ := url.Parse(rec.Header().Get("Location"))
+	p.claims = map[string]interface{}{
+		"iss": p.URL, "aud": "client-id", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix(),
+		"nonce": login.Query().Get("nonce"), "email": "ann@example.com", "email_verified": true,
+	}
+	callback := "/auth/callback?" + url.Values{"state": {login.Query().Get("state")}, "code": {"the-code"}}.Encode()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("first callback = %d: %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "reused") {
+		t.Errorf("replayed callback = %d %q, want it refused", rec.Code, rec.Body)
+	}
+}
@@ -3,20 +3,29 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
 	"github.com/garyblankenship/llmcli/internal/config"
 	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/rag"
+	"github.com/garyblankenship/llmcli/internal/render"
+	"github.com/garyblankenship/llmcli/internal/sandbox"
 	"github.com/garyblankenship/llmcli/internal/ui"
 )
 
@@ -30,6 +39,30 @@ type completionRequest struct {
 	CachePrompt bool    `json:"cache_prompt,omitempty"`
 	Stop        []string `json:"stop,omitempty"`
 	Stream      bool    `json:"stream,omitempty"`
+	Mirostat    int     `json:"mirostat,omitempty"`
+	MirostatTau float64 `json:"mirostat_tau,omitempty"`
+	MirostatEta float64 `json:"mirostat_eta,omitempty"`
+	DynatempRange    float64 `json:"dynatemp_range,omitempty"`
+	DynatempExponent float64 `json:"dynatemp_exponent,omitempty"`
+	Grammar          string  `json:"grammar,omitempty"` // GBNF grammar the completion must match
+}
+
+// samplingRequest returns a completion request for prompt with the
+// configuration's sampling parameters
+func samplingRequest(cfg *config.Config, prompt string) completionRequest {
+	return completionRequest{
+		Prompt:           prompt,
+		NPredict:         cfg.NPredictMax,
+		Temperature:      cfg.Temperature,
+		TopK:             cfg.TopK,
+		TopP:             cfg.TopP,
+		Stop:             cfg.Stop,
+		Mirostat:         cfg.Mirostat,
+		MirostatTau:      cfg.MirostatTau,
+		MirostatEta:      cfg.MirostatEta,
+		DynatempRange:    cfg.DynatempRange,
+		DynatempExponent: cfg.DynatempExponent,
+	}
 }
 
 type embeddingRequest struct {
@@ -42,6 +75,21 @@ type tokenizeRequest struct {
 
 // EnsureServerRunning makes sure a server is running for the given model
 func EnsureServerRunning(store *db.Store, cfg *config.Config, slug string) error {
+	return EnsureServerRunningContext(context.Background(), store, cfg, slug)
+}
+
+// EnsureServerRunningContext is EnsureServerRunning, giving up on a server
+// it is starting, and stopping it, when ctx is done
+func EnsureServerRunningContext(ctx context.Context, store *db.Store, cfg *config.Config, slug string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// A remote backend's servers are run by someone else
+	if cfg.RemoteBackend() {
+		return checkRemoteBackend(cfg)
+	}
+
 	// Get model from database
 	model, err := store.GetModelBySlug(slug)
 	if err != nil {
@@ -49,68 +97,253 @@ func EnsureServerRunning(store *db.Store, cfg *config.Config, slug string) error
 	}
 
 	// Update last used timestamp
-	if err := store.UpdateModelLastUsed(slug); err != nil {
-		return fmt.Errorf("updating last used timestamp: %w", err)
+	if cfg.Persist.Usage {
+		if err := store.UpdateModelLastUsed(slug); err != nil {
+			return fmt.Errorf("updating last used timestamp: %w", err)
+		}
+	}
+
+	// A running daemon owns the servers it starts
+	if daemonRunning(cfg) {
+		var srv DaemonServer
+		req := map[string]interface{}{"slug": slug, "keep_alive": cfg.KeepAlive, "no_evict": cfg.NoEvict}
+		if err := daemonCall(cfg, "/start", req, &srv, 0); err != nil {
+			return err
+		}
+		store.TouchServer(model.FilePath)
+		ui.PrintInfo(fmt.Sprintf("Server for model %s is running under the daemon on %s.", slug, serverAddress(cfg, srv.Port)))
+		return nil
 	}
 
 	// Check if server is already running
-	serverRunning, err := IsServerRunningForPath(model.FilePath)
+	serverRunning, err := IsServerRunningForPath(store, model.FilePath)
 	if err != nil {
 		return fmt.Errorf("checking server status: %w", err)
 	}
 
 	if serverRunning {
+		touchActivity(cfg, modelPort(store, cfg, model))
+		store.TouchServer(model.FilePath)
 		ui.PrintInfo(fmt.Sprintf("Server for model %s is already running.", slug))
 		return nil
 	}
 
+	if err := checkQuarantine(model); err != nil {
+		return err
+	}
+
+	_, err = startServer(ctx, store, cfg, model, nil)
+	return err
+}
+
+// StartServer stops any server running for the model and starts a new one
+// with overrides applied on top of the model's stored settings, returning
+// the new server's PID once it is ready
+func StartServer(store *db.Store, cfg *config.Config, slug string, overrides map[string]string) (int, error) {
+	return StartServerContext(context.Background(), store, cfg, slug, overrides)
+}
+
+// StartServerContext is StartServer, stopping the new server if ctx is done
+// before it is ready
+func StartServerContext(ctx context.Context, store *db.Store, cfg *config.Config, slug string, overrides map[string]string) (int, error) {
+	if cfg.RemoteBackend() {
+		return 0, fmt.Errorf("server settings can't be changed on backend %s; it runs its own servers", cfg.Backend.Name)
+	}
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return 0, err
+	}
+	if err := StopServer(store, cfg, model.FilePath); err != nil {
+		return 0, err
+	}
+	return startServer(ctx, store, cfg, model, overrides)
+}
+
+// startServer launches llama-server for a model and waits until it is ready
+// or exits
+func startServer(ctx context.Context, store *db.Store, cfg *config.Config, model *db.Model, overrides map[string]string) (int, error) {
+	keepAlive, err := cfg.KeepAliveDuration()
+	if err != nil {
+		return 0, err
+	}
+	release, err := makeRoom(store, cfg, model, !cfg.NoEvict, func(srv db.Server) error {
+		return StopServer(store, cfg, srv.ModelPath)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	proc, err := launchServer(ctx, store, cfg, model, overrides)
+	release()
+	if err != nil {
+		return 0, err
+	}
+
+	pid := proc.cmd.Process.Pid
+	if keepAlive > 0 {
+		if err := startWatchdog(cfg, pid, proc.port, keepAlive); err != nil {
+			ui.PrintWarn(err.Error())
+		}
+	}
+	return pid, nil
+}
+
+// process is a llama-server started by this process
+type process struct {
+	cmd     *exec.Cmd
+	port    int
+	logFile string
+	done chan struct{} // closed when the process exits
+	err  error         // exit status, set before done is closed
+	// ready is set once the server has answered; exiting after that
+	// without being stopped is a crash
+	ready atomic.Bool
+}
+
+// launchServer starts llama-server for a model and waits until it is ready,
+// returning the running process. A server still starting when ctx is done
+// is stopped.
+func launchServer(ctx context.Context, store *db.Store, cfg *config.Config, model *db.Model, overrides map[string]string) (*process, error) {
 	// Start server
-	ui.PrintInfo(fmt.Sprintf("Starting server for model %s...", slug))
-	logFile := fmt.Sprintf("/tmp/llama_server_%s.log", slug)
+	ui.PrintInfo(fmt.Sprintf("Starting server for model %s...", model.Slug))
+	logFile := cfg.ServerLogPath(model.Slug)
+	if !cfg.Persist.Logs {
+		logFile = os.DevNull
+	}
 
-	cmd := exec.Command(cfg.LlamaServer, "-m", model.FilePath, "--port", strconv.Itoa(cfg.DefaultPort))
+	port, err := allocatePort(store, cfg, model)
+	if err != nil {
+		return nil, err
+	}
+
+	listen, err := listenArgs(cfg, port)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"-m", model.FilePath}, listen...)
+	settingArgs, err := SettingArgs(store, cfg, model, overrides)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, settingArgs...)
+	
+	cmd := exec.Command(cfg.LlamaServer, args...)
 	stdout, err := os.Create(logFile)
 	if err != nil {
-		return fmt.Errorf("creating log file: %w", err)
+		return nil, fmt.Errorf("creating log file: %w", err)
 	}
 	defer stdout.Close()
 
 	cmd.Stdout = stdout
 	cmd.Stderr = stdout
+	// Servers outlive the command that starts them, so Ctrl-C in the
+	// terminal, which signals the whole process group, must not stop them
+	separateProcessGroup(cmd)
+	ui.LogCommand(cmd)
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("starting server: %w", err)
+		return nil, fmt.Errorf("starting server: %w", err)
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Server started with PID %d on %s. Logs: %s", cmd.Process.Pid, serverAddress(cfg, port), logFile))
+
+	pid := cmd.Process.Pid
+	if err := store.AddServer(db.Server{PID: pid, Port: port, Slug: model.Slug, ModelPath: model.FilePath, Size: modelSize(model), LogPath: logFile}); err != nil {
+		ui.PrintWarn(err.Error())
 	}
 
-	ui.PrintInfo(fmt.Sprintf("Server started with PID %d. Logs: %s", cmd.Process.Pid, logFile))
+	// Notice a server that dies during startup instead of waiting out the timeout
+	proc := &process{cmd: cmd, port: port, logFile: logFile, done: make(chan struct{})}
+	go func() {
+		proc.err = cmd.Wait()
+		store.RemoveServer(pid)
+		// Failures with explicit overrides (e.g. while tuning) say nothing
+		// about whether the model itself can run
+		if proc.ready.Load() && overrides == nil && crashed(proc.err) {
+			recordCrash(store, model, fmt.Errorf("server exited: %v", proc.err))
+		}
+		close(proc.done)
+	}()
 
 	// Wait for server to be ready
-	if err := WaitForServer(cfg.DefaultPort, 300); err != nil {
-		return fmt.Errorf("waiting for server: %w", err)
+	if err := waitForServer(ctx, cfg, port, 300, proc); err != nil {
+		if ctx.Err() != nil {
+			ui.PrintInfo(fmt.Sprintf("Stopping the server for model %s that was starting.", model.Slug))
+			terminate(proc)
+			return nil, err
+		}
+		// Failures with explicit overrides (e.g. while tuning) say nothing
+		// about whether the model itself can run
+		if overrides == nil {
+			recordCrash(store, model, err)
+		}
+		return nil, fmt.Errorf("waiting for server (logs: %s): %w", logFile, err)
+	}
+	proc.ready.Store(true)
+
+	return proc, nil
+}
+
+// StopServer terminates any server running for a model file and waits for it to exit
+func StopServer(store *db.Store, cfg *config.Config, modelPath string) error {
+	if _, err := daemonRelease(cfg, stopRequest{Path: modelPath}); err != nil {
+		return err
+	}
+	return stopProcesses(store, modelPath)
+}
+
+// stopProcesses terminates the recorded servers for a model file that
+// weren't started by the daemon
+func stopProcesses(store *db.Store, modelPath string) error {
+	servers, err := serversForPath(store, modelPath)
+	if err != nil || len(servers) == 0 {
+		return err
 	}
 
+	if err := signalServers(servers, false); err != nil {
+		return err
+	}
+	if remaining := waitForExit(servers, 30*time.Second); len(remaining) > 0 {
+		return fmt.Errorf("server for %s (PID %d) did not stop", modelPath, remaining[0].PID)
+	}
+	for _, srv := range servers {
+		store.RemoveServer(srv.PID)
+	}
 	return nil
 }
 
 // IsServerRunningForPath checks if a server is running for the given model path
-func IsServerRunningForPath(modelPath string) (bool, error) {
-	cmd := exec.Command("pgrep", "-f", fmt.Sprintf("llama-server.*%s", modelPath))
-	output, err := cmd.Output()
-	
+func IsServerRunningForPath(store *db.Store, modelPath string) (bool, error) {
+	servers, err := serversForPath(store, modelPath)
 	if err != nil {
-		// pgrep returns error when no process is found, which is not an error for us
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return false, nil
-		}
 		return false, fmt.Errorf("checking server: %w", err)
 	}
-	
-	return len(output) > 0, nil
+	return len(servers) > 0, nil
+}
+
+// serversForPath returns the running servers for a model file
+func serversForPath(store *db.Store, modelPath string) ([]db.Server, error) {
+	servers, err := runningServers(store)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []db.Server
+	for _, srv := range servers {
+		if srv.ModelPath == modelPath {
+			matching = append(matching, srv)
+		}
+	}
+	return matching, nil
 }
 
 // IsServerRunning checks if a server is running on the given port
-func IsServerRunning(port int) (bool, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/health", port))
+func IsServerRunning(cfg *config.Config, port int) (bool, error) {
+	shared, baseURL := httpTarget(modelURL(cfg, port))
+	// A hung server must not hang every command that checks on it
+	client := *shared
+	client.Timeout = 5 * time.Second
+	resp, err := client.Get(baseURL + "/health")
 	if err != nil {
 		return false, nil
 	}
@@ -119,31 +352,118 @@ func IsServerRunning(port int) (bool, error) {
 	return resp.StatusCode == http.StatusOK, nil
 }
 
-// WaitForServer waits for the server to be ready
-func WaitForServer(port, maxWaitSeconds int) error {
+// WaitForServer waits for the server to be ready, giving up when ctx is done
+func WaitForServer(ctx context.Context, cfg *config.Config, port, maxWaitSeconds int) error {
+	return waitForServer(ctx, cfg, port, maxWaitSeconds, nil)
+}
+
+// waitForServer waits for the server to be ready, giving up early if ctx
+// is done or proc is not nil and ends
+func waitForServer(ctx context.Context, cfg *config.Config, port, maxWaitSeconds int, proc *process) error {
+	var exited <-chan struct{}
+	// Show llama.cpp's progress loading the model when its log is kept
+	var load *loadWatcher
+	if proc != nil {
+		exited = proc.done
+		if load = newLoadWatcher(proc.logFile); load != nil {
+			defer load.close()
+		}
+	}
 	ui.PrintInfo("Waiting for server to be ready...")
 	
-	for i := 0; i < maxWaitSeconds; i++ {
-		if i > 0 && i%10 == 0 {
-			fmt.Print(".")
+	start := time.Now()
+	dots := 0
+	for time.Since(start) < time.Duration(maxWaitSeconds)*time.Second {
+		if load != nil {
+			load.update()
+			load.render()
+		}
+		if load == nil || load.shown == 0 {
+			for ; dots < int(time.Since(start).Seconds())/10; dots++ {
+				if ui.Accessible() {
+					ui.PrintInfo(fmt.Sprintf("Still waiting for the server after %d seconds.", (dots+1)*10))
+				} else {
+					fmt.Fprint(ui.Messages(), ".")
+				}
+			}
 		}
 		
-		running, _ := IsServerRunning(port)
+		select {
+		case <-exited:
+			if !ui.Accessible() {
+				fmt.Fprintln(ui.Messages())
+			}
+			return fmt.Errorf("server exited during startup: %v", proc.err)
+		default:
+		}
+		
+		running, _ := IsServerRunning(cfg, port)
 		if running {
-			fmt.Println() // End the dots with a newline
-			ui.PrintInfo(fmt.Sprintf("Server is ready after %d seconds.", i))
+			if (load == nil || load.shown == 0) && !ui.Accessible() {
+				fmt.Fprintln(ui.Messages()) // End the dots with a newline
+			}
+			if load != nil {
+				load.finish()
+			}
+			ui.PrintInfo(fmt.Sprintf("Server is ready after %d seconds.", int(time.Since(start).Seconds())))
 			return nil
 		}
 		
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			if !ui.Accessible() {
+				fmt.Fprintln(ui.Messages())
+			}
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
 	}
 	
 	return fmt.Errorf("server failed to start within %d seconds", maxWaitSeconds)
 }
 
+// RunOptions controls a run
+type RunOptions struct {
+	Overrides map[string]string // server settings; restarts the server with them applied
+	Post      post.Pipeline     // filters applied to the completion
+
+	// AutoContinue is how many times a completion cut off by the
+	// n_predict limit is continued before giving up
+	AutoContinue int
+
+	// NoStream prints the completion once it is complete instead of as it
+	// is generated, without statistics. Output filters need the whole
+	// completion, so they always imply it.
+	NoStream bool
+
+	// Grammar is a GBNF grammar the completion must match, such as one
+	// converted from a JSON schema
+	Grammar string
+
+	// JSON asks the model for JSON and prints only the JSON value, retrying
+	// with the parse error pointed out up to Retries times
+	JSON    bool
+	Retries int
+}
+
+// request returns the completion request for prompt with the run's grammar
+func (o RunOptions) request(cfg *config.Config, prompt string) completionRequest {
+	req := samplingRequest(cfg, prompt)
+	req.Grammar = o.Grammar
+	return req
+}
+
 // Run starts a model server and optionally completes text
-func Run(store *db.Store, cfg *config.Config, slug, text string) error {
-	if err := EnsureServerRunning(store, cfg, slug); err != nil {
+func Run(ctx context.Context, store *db.Store, cfg *config.Config, slug, text string, opts RunOptions) error {
+	if len(opts.Overrides) > 0 {
+		if _, err := StartServerContext(ctx, store, cfg, slug, opts.Overrides); err != nil {
+			return err
+		}
+	} else if err := EnsureServerRunningContext(ctx, store, cfg, slug); err != nil {
+		return err
+	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
 		return err
 	}
 	
@@ -155,227 +475,968 @@ func Run(store *db.Store, cfg *config.Config, slug, text string) error {
 	// Complete text
 	ui.PrintInfo(fmt.Sprintf("Completing text: %s", text))
 	
-	// Prepare request
-	req := completionRequest{
-		Prompt:      text,
-		NPredict:    cfg.NPredictMax,
-		Temperature: cfg.Temperature,
-		TopK:        cfg.TopK,
-		TopP:        cfg.TopP,
+	var content string
+	if opts.JSON {
+		if content, err = jsonRun(ctx, cfg, text, opts); err != nil {
+			return err
+		}
+	} else if opts.NoStream || len(opts.Post) > 0 {
+		if content, err = bufferedRun(ctx, cfg, slug, text, opts); err != nil {
+			return err
+		}
+	} else if content, err = streamedRun(ctx, cfg, slug, text, opts); err != nil {
+		return err
+	}
+	
+	if cfg.Persist.History {
+		if err := store.AddHistory(slug, text, content); err != nil {
+			ui.PrintWarn(fmt.Sprintf("Failed to save history: %v", err))
+		}
+	}
+	
+	return nil
+}
+
+// bufferedRun completes text and prints the result once it is complete and
+// filtered
+func bufferedRun(ctx context.Context, cfg *config.Config, slug, text string, opts RunOptions) (string, error) {
+	content, truncated, err := completeRequest(ctx, cfg, opts.request(cfg, text))
+	if err != nil {
+		return "", err
+	}
+	for i := 1; truncated && i <= opts.AutoContinue; i++ {
+		ui.PrintInfo(fmt.Sprintf("Output hit the n_predict limit, continuing (%d/%d)...", i, opts.AutoContinue))
+		var more string
+		if more, truncated, err = completeRequest(ctx, cfg, opts.request(cfg, text+content)); err != nil {
+			return "", err
+		}
+		content += more
+	}
+	if truncated {
+		warnTruncated(slug)
+	}
+	if content, err = opts.Post.Apply(content); err != nil {
+		return "", err
+	}
+
+	ui.Rule(80)
+	fmt.Println(content)
+	return content, nil
+}
+
+// streamedRun completes text, printing it as it is generated, followed by
+// the prompt evaluation time and generation speed
+func streamedRun(ctx context.Context, cfg *config.Config, slug, text string, opts RunOptions) (string, error) {
+	ui.Rule(80)
+
+	var content strings.Builder
+	output := io.MultiWriter(os.Stdout, &content)
+	start := time.Now()
+	result, err := streamCompletion(ctx, cfg, opts.request(cfg, text), output)
+	if err != nil {
+		// End the partial reply so the error starts a line of its own
+		if content.Len() > 0 && !strings.HasSuffix(content.String(), "\n") {
+			fmt.Println()
+		}
+		return "", err
+	}
+	stats := result.Stats
+	// Continuations carry on the same line, so no notice is printed between them
+	for i := 1; result.Truncated && i <= opts.AutoContinue; i++ {
+		if result, err = streamCompletion(ctx, cfg, opts.request(cfg, text+content.String()), output); err != nil {
+			if !strings.HasSuffix(content.String(), "\n") {
+				fmt.Println()
+			}
+			return "", err
+		}
+		stats.add(result.Stats)
+	}
+	if !strings.HasSuffix(content.String(), "\n") {
+		fmt.Println()
+	}
+
+	if !ui.Quiet() {
+		fmt.Fprintf(os.Stderr, "\033[0;90m%s\033[0m\n", runSummary(stats, time.Since(start)))
+	}
+	if result.Truncated {
+		warnTruncated(slug)
+	}
+	return content.String(), nil
+}
+
+// warnTruncated tells the user how to get the rest of a completion cut off
+// by the n_predict limit
+func warnTruncated(slug string) {
+	ui.PrintWarn(fmt.Sprintf("Output was cut off at the n_predict limit. Continue it with --auto-continue N, or raise the limit with 'set %s n-predict N'.", slug))
+}
+
+// Complete makes sure the model's server is running and returns the
+// completion of prompt without printing it
+func Complete(store *db.Store, cfg *config.Config, slug, prompt string) (string, error) {
+	return CompleteWith(store, cfg, slug, prompt, func(slug string) error {
+		return EnsureServerRunning(store, cfg, slug)
+	})
+}
+
+// CompleteWith is Complete, starting the model's server with ensure
+func CompleteWith(store *db.Store, cfg *config.Config, slug, prompt string, ensure EnsureFunc) (string, error) {
+	if err := ensure(slug); err != nil {
+		return "", err
+	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return "", err
+	}
+	return complete(cfg, prompt)
+}
+
+// CompleteRunning returns the completion of prompt from whichever model
+// is currently serving, without starting one
+func CompleteRunning(cfg *config.Config, prompt string) (string, error) {
+	return complete(cfg, prompt)
+}
+
+// complete sends a non-streaming completion request to the running server
+func complete(cfg *config.Config, prompt string) (string, error) {
+	content, _, err := completeResult(cfg, prompt)
+	return content, err
+}
+
+// completeResult is complete, also reporting whether the completion was
+// cut off by the n_predict limit
+func completeResult(cfg *config.Config, prompt string) (string, bool, error) {
+	return completeRequest(context.Background(), cfg, samplingRequest(cfg, prompt))
+}
+
+// completeRequest sends a completion request and returns the generated
+// text and whether it stopped at the n_predict limit
+func completeRequest(ctx context.Context, cfg *config.Config, req completionRequest) (string, bool, error) {
+	var result map[string]interface{}
+	if err := postJSONContext(ctx, cfg, "/completion", req, &result); err != nil {
+		return "", false, err
+	}
+
+	content, _ := result["content"].(string)
+	return content, stoppedAtLimit(result), nil
+}
+
+// ChatOptions controls an interactive chat session
+type ChatOptions struct {
+	Session string // session to save to or resume; generated if empty
+	Compact bool   // render the transcript without separators or blank lines
+
+	// ShowThinking prints the reasoning of models that think in <think>
+	// blocks, dimmed, instead of hiding it. Reasoning is never kept in the
+	// conversation history either way.
+	ShowThinking bool
+
+	// Footer prints token counts, speed and context use after every
+	// reply, as the chat.footer config setting does
+	Footer bool
+
+	// Retrieve, when set, finds document chunks for each message. They are
+	// given to the model as numbered sources with that message only, and
+	// the sources the reply cites are listed after it.
+	Retrieve func(question string) ([]rag.Chunk, error)
+
+	// RequireCitations asks again, up to rag.MaxCitationRetries times,
+	// for a reply to retrieved sources that cites none of them
+	RequireCitations bool
+
+	// Sandbox, when set, lets the model run commands in it before it
+	// answers, up to maxToolRounds per message, by asking with <run>
+	Sandbox *sandbox.Runner
+
+	// JSON asks for every reply as JSON. A reply that doesn't parse is
+	// asked for again, with the error pointed out, up to Retries times.
+	JSON    bool
+	Retries int
+
+	// Ping checks on the server this often while the chat is idle, so its
+	// keep-alive timeout doesn't stop it; 0 uses the chat.ping setting
+	Ping time.Duration
+
+	// Export writes the whole conversation to this file when the chat
+	// ends, as Markdown, JSON or HTML by its extension
+	Export string
+}
+
+// Chat starts an interactive chat session. When sessions are persisted the
+// conversation is saved under opts.Session (generated if empty), and an
+// existing session with that name is resumed. Ctrl-C while a reply is
+// being generated stops the reply; at the prompt it ends the chat.
+func Chat(ctx context.Context, store *db.Store, cfg *config.Config, slug string, opts ChatOptions) error {
+	baseCfg := cfg
+	ping := opts.Ping
+	if ping == 0 {
+		var err error
+		if ping, err = cfg.ChatPingInterval(); err != nil {
+			return err
+		}
+	}
+	model, err := openChatModel(ctx, store, baseCfg, slug, ping)
+	if err != nil {
+		return err
+	}
+	// /model switches to another model's connection
+	cfg, conn, format, stops := model.cfg, model.conn, model.format, model.stops
+	defer func() { conn.close() }()
+
+	// Chat history
+	var chatHistory []chattmpl.Message
+	// The whole conversation, for /export
+	conversation := &chatLog{name: opts.Session, started: time.Now()}
+	if conversation.name == "" {
+		conversation.name = fmt.Sprintf("%s-%s", slug, conversation.started.Format("20060102-150405"))
+	}
+	params, _ := json.Marshal(map[string]interface{}{
+		"temperature": cfg.Temperature,
+		"top_k":       cfg.TopK,
+		"top_p":       cfg.TopP,
+		"n_predict":   cfg.NPredictMax,
+		"mirostat":    cfg.Mirostat,
+		"dynatemp_range": cfg.DynatempRange,
+	})
+	
+	sessionName := opts.Session
+	var session *db.Session
+	if cfg.Persist.Sessions {
+		if sessionName == "" {
+			sessionName = conversation.name
+		}
+		
+		var err error
+		session, err = store.GetOrCreateSession(sessionName, slug, string(params))
+		if err != nil {
+			return err
+		}
+		
+		messages, err := store.GetSessionMessages(session.ID)
+		if err != nil {
+			return err
+		}
+		conversation.started = session.CreatedAt
+		for _, message := range messages {
+			if message.Role == "user" || message.Role == "assistant" {
+				conversation.add(message.Role, message.Content, message.CreatedAt)
+				content := message.Content
+				if message.Role == "assistant" {
+					// Sessions saved or imported with reasoning would otherwise fill the context
+					content, _ = post.StripThink(content)
+				}
+				chatHistory = append(chatHistory, chattmpl.Message{Role: message.Role, Content: content})
+			}
+		}
+		system, err := store.GetSessionSystemPrompt(session.ID)
+		if err != nil {
+			return err
+		}
+		// Imported conversations keep theirs as the first message
+		if system == "" && len(messages) > 0 && messages[0].Role == "system" {
+			system = messages[0].Content
+		}
+		chatHistory = withSystemPrompt(chatHistory, system)
+		
+		if len(messages) > 0 {
+			ui.PrintInfo(fmt.Sprintf("Resumed session '%s' with %d messages.", session.Name, len(messages)))
+		} else {
+			ui.PrintInfo(fmt.Sprintf("Saving this conversation as session '%s'.", session.Name))
+		}
+	} else if sessionName != "" {
+		ui.PrintWarn("Session persistence is disabled; this conversation will not be saved.")
+	}
+
+	ui.PrintInfo("Starting chat session. Type 'exit' to end, or /help for commands.")
+	
+	transcript := render.NewTranscript(os.Stdout, render.Options{Compact: opts.Compact})
+	
+	ui.PrintInfo(fmt.Sprintf("Using the %s chat format.", format.Name))
+	// Up arrow recalls the messages sent in this session before
+	var sent []string
+	for _, message := range chatHistory {
+		if message.Role == "user" {
+			sent = append(sent, message.Content)
+		}
+	}
+	reader := ui.NewLineReader(sent)
+	
+	footer := cfg.Chat.Footer || opts.Footer
+	overflow, err := cfg.ChatOverflow()
+	if err != nil {
+		return err
+	}
+	// The history is counted while the user types, to show how much context
+	// is left and make room before it runs out
+	contextSize := serverContext(cfg)
+	ahead := newPreflight(cfg, contextSize)
+	if len(chatHistory) > 0 {
+		ahead.start(format.Render(chatHistory))
+	}
+	
+	// The last reply as generated, reasoning included, whether it was cut
+	// off by the n_predict limit, and the sources it was given, for /continue
+	var lastRaw string
+	var lastTruncated bool
+	var lastSources []rag.Chunk
+
+	// recount counts the history ahead again once a command changed it
+	recount := func() {
+		ahead.start(format.Render(chatHistory))
+	}
+	// command runs a slash command other than /continue and /retry, which
+	// are answered like messages
+	command := func(name, arg string) error {
+		switch name {
+		case "help":
+			printChatCommands()
+		case "system":
+			switch arg {
+			case "":
+				if prompt := systemPrompt(chatHistory); prompt != "" {
+					transcript.Note(prompt)
+				} else {
+					ui.PrintInfo("There is no system prompt; set one with /system <text>.")
+				}
+				return nil
+			case "off":
+				arg = ""
+			}
+			chatHistory = withSystemPrompt(chatHistory, arg)
+			recount()
+			if session != nil {
+				if err := store.SetSessionSystemPrompt(session.ID, arg); err != nil {
+					ui.PrintWarn(fmt.Sprintf("Failed to save session: %v", err))
+				}
+			}
+			if arg == "" {
+				ui.PrintInfo("Removed the system prompt.")
+			} else {
+				ui.PrintInfo("Set the system prompt.")
+			}
+		case "clear":
+			chatHistory = withSystemPrompt(nil, systemPrompt(chatHistory))
+			conversation.messages = nil
+			lastRaw, lastTruncated, lastSources = "", false, nil
+			recount()
+			if session != nil {
+				if err := store.ClearSessionMessages(session.ID); err != nil {
+					ui.PrintWarn(fmt.Sprintf("Failed to save session: %v", err))
+				}
+			}
+			ui.PrintInfo("Cleared the conversation.")
+		case "save":
+			if session == nil {
+				ui.PrintWarn("Session persistence is disabled; this conversation can't be saved.")
+				return nil
+			}
+			if arg == "" {
+				ui.PrintInfo(fmt.Sprintf("This conversation is saved as session '%s'; /save <name> renames it.", session.Name))
+				return nil
+			}
+			if err := store.RenameSession(session.ID, arg); err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to save session: %v", err))
+				return nil
+			}
+			session.Name = arg
+			conversation.name = arg
+			ui.PrintInfo(fmt.Sprintf("Saved this conversation as session '%s'.", arg))
+		case "model":
+			if resolved, ok := store.ResolveSlugAlias(arg); ok {
+				arg = resolved
+			}
+			if arg == "" || arg == slug {
+				ui.PrintInfo(fmt.Sprintf("Chatting with %s; /model <slug> switches to another model.", slug))
+				return nil
+			}
+			if _, err := store.GetModelBySlug(arg); err != nil {
+				ui.PrintWarn(err.Error())
+				return nil
+			}
+			next, err := openChatModel(ctx, store, baseCfg, arg, ping)
+			if err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to switch to %s: %v", arg, err))
+				return nil
+			}
+			conn.close()
+			slug, cfg, conn, format, stops = arg, next.cfg, next.conn, next.format, next.stops
+			// A cut-off reply is continued in its own model's format only
+			lastRaw, lastTruncated = "", false
+			contextSize = serverContext(cfg)
+			ahead = newPreflight(cfg, contextSize)
+			recount()
+			if session != nil {
+				if err := store.SetSessionModel(session.ID, slug); err != nil {
+					ui.PrintWarn(fmt.Sprintf("Failed to save session: %v", err))
+				}
+			}
+			ui.PrintInfo(fmt.Sprintf("Switched to %s, using the %s chat format.", slug, format.Name))
+		case "tokens":
+			var err error
+			if cfg, err = conn.ensure(); err != nil {
+				return err
+			}
+			size := contextSize
+			if size == 0 {
+				size = serverContext(cfg)
+			}
+			usage, err := contextUsage(cfg, format, chatHistory, size)
+			if err != nil {
+				ui.PrintWarn(err.Error())
+				return nil
+			}
+			transcript.Note(usage)
+		case "export":
+			path := arg
+			if path == "" {
+				path = opts.Export
+			}
+			if path == "" {
+				path = conversation.name + ".md"
+			}
+			if err := conversation.export(store, path, slug, string(params), systemPrompt(chatHistory)); err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to export the conversation: %v", err))
+			}
+		default:
+			ui.PrintWarn(fmt.Sprintf("Unknown command /%s; type /help to list the commands.", name))
+		}
+		return nil
+	}
+	
+	for {
+		transcript.StartTurn()
+		indent := transcript.LabelNote("user", contextLeft(ahead.tokens(), contextSize))
+		userInput, err := reader.ReadLine(indent)
+		asked := time.Now()
+		if errors.Is(err, ui.ErrInterrupted) || errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+		
+		userInput = strings.TrimSpace(userInput)
+		if userInput == "exit" {
+			break
+		}
+		retrying := false
+		if name, arg, ok := parseChatCommand(userInput); ok && name == "edit" {
+			// Compose the message in an editor, starting from any text given
+			if userInput, err = ui.EditText(arg); err != nil {
+				ui.PrintWarn(err.Error())
+				continue
+			}
+			if userInput = strings.TrimSpace(userInput); userInput == "" {
+				ui.PrintInfo("The message is empty; nothing was sent.")
+				continue
+			}
+			fmt.Println(userInput)
+		} else if ok && name != "continue" {
+			if name != "retry" {
+				if err := command(name, arg); err != nil {
+					return err
+				}
+				continue
+			}
+			n := len(chatHistory)
+			if n < 2 || chatHistory[n-1].Role != "assistant" || chatHistory[n-2].Role != "user" {
+				ui.PrintWarn("There is no reply to generate again yet.")
+				continue
+			}
+			// Ask the last message again in place of its reply
+			userInput = chatHistory[n-2].Content
+			chatHistory = chatHistory[:n-2]
+			retrying = true
+		}
+		if cfg, err = conn.ensure(); err != nil {
+			return err
+		}
+		ahead.cfg = cfg
+		
+		continuing := userInput == "/continue"
+		var prompt string
+		var turn []chattmpl.Message
+		if continuing {
+			if !lastTruncated {
+				ui.PrintWarn("The last reply was not cut off; there is nothing to continue.")
+				continue
+			}
+			// Pick up the reply where it stopped, as if it had never been interrupted
+			prompt = format.Render(withSources(chatHistory[:len(chatHistory)-1], lastSources)) + lastRaw
+		} else {
+			// Add to history
+			chatHistory = append(chatHistory, chattmpl.Message{Role: "user", Content: userInput})
+			
+			lastSources = nil
+			if opts.Retrieve != nil {
+				if lastSources, err = opts.Retrieve(userInput); err != nil {
+					ui.PrintWarn(fmt.Sprintf("Failed to retrieve sources: %v", err))
+				}
+			}
+			
+			// Format prompt with chat history
+			build := func(history []chattmpl.Message) []chattmpl.Message {
+				turn := withSources(history, lastSources)
+				if opts.Sandbox != nil {
+					turn = withToolInstruction(turn, opts.Sandbox)
+				}
+				if opts.JSON {
+					turn = withJSONInstruction(turn)
+				}
+				return turn
+			}
+			turn = build(chatHistory)
+			total, added, counted := ahead.count(turn[len(turn)-1].Content)
+			if limit := contextSize - replyReserve(cfg, contextSize); counted && contextSize > 0 && total > limit && overflow != "off" {
+				// Make room for the reply rather than let the server drop text silently
+				fitted, used, note, err := fitContext(ctx, cfg, format, stops, chatHistory, build, limit, overflow)
+				switch {
+				case errors.Is(err, errNoRoom):
+					ui.PrintWarn(fmt.Sprintf("Not sent: %v. Shorten it, or start the model with a larger --ctx-size.", err))
+					chatHistory = chatHistory[:len(chatHistory)-1]
+					continue
+				case err != nil:
+					ui.PrintWarn(fmt.Sprintf("Failed to make room in the context: %v", err))
+				default:
+					chatHistory, total = fitted, used
+					turn = build(chatHistory)
+					if note != "" {
+						transcript.Note(note)
+					}
+				}
+			}
+			prompt = format.Render(turn)
+			if footer && counted {
+				transcript.Note(ahead.estimate(total, added))
+			}
+		}
+		
+		// Prepare request
+		req := samplingRequest(cfg, prompt)
+		req.CachePrompt = true
+		req.Stop = stops
+		
+		// Stream response
+		output := transcript.Reply(opts.ShowThinking)
+		if strings.HasSuffix(strings.TrimSpace(prompt), render.ThinkOpen) ||
+			continuing && strings.Count(lastRaw, render.ThinkOpen) > strings.Count(lastRaw, render.ThinkClose) {
+			output.BeginThinking()
+		}
+		
+		var raw strings.Builder
+		started := time.Now()
+		replyCtx, stop := ui.Interruptible(ctx)
+		result, err := streamCompletion(replyCtx, cfg, req, io.MultiWriter(output, &raw))
+		output.Close()
+		cancelled := replyCtx.Err() != nil && ctx.Err() == nil
+		stop()
+		if cancelled {
+			// Keep what was generated, so /continue can pick it up
+			ui.PrintInfo("Reply cancelled. Type /continue to keep going.")
+			result.Truncated = true
+		} else if err != nil {
+			return err
+		}
+		if footer && !cancelled {
+			if result.Stats.PromptTokens == 0 {
+				result.Stats.PromptTokens, _ = countTokens(cfg, prompt)
+			}
+			transcript.Note(turnFooter(result.Stats, time.Since(started), contextSize))
+		}
+		truncated := result.Truncated
+		if truncated && !cancelled {
+			ui.PrintInfo("The reply was cut off at the n_predict limit. Type /continue to keep going.")
+		}
+		
+		// Add response to history, without reasoning
+		answer := output.Answer()
+		// reask streams a new reply to messages in place of the last one
+		reask := func(messages []chattmpl.Message) error {
+			req.Prompt = format.Render(messages)
+			output = transcript.Reply(opts.ShowThinking)
+			raw.Reset()
+			replyCtx, stop := ui.Interruptible(ctx)
+			result, err = streamCompletion(replyCtx, cfg, req, io.MultiWriter(output, &raw))
+			output.Close()
+			cancelled = replyCtx.Err() != nil && ctx.Err() == nil
+			stop()
+			if cancelled {
+				ui.PrintInfo("Reply cancelled. Type /continue to keep going.")
+				result.Truncated = true
+			} else if err != nil {
+				return err
+			}
+			answer = output.Answer()
+			truncated = result.Truncated
+			return nil
+		}
+		for round := 1; opts.Sandbox != nil && !continuing && !truncated && !cancelled; round++ {
+			line, ok := toolRequest(answer)
+			if !ok {
+				break
+			}
+			if round > maxToolRounds {
+				ui.PrintWarn(fmt.Sprintf("The model asked to run more than %d commands for one message; no more were run.", maxToolRounds))
+				break
+			}
+			transcript.Note("Running in the sandbox: " + line)
+			turn = append(append([]chattmpl.Message{}, turn...),
+				chattmpl.Message{Role: "assistant", Content: answer},
+				chattmpl.Message{Role: "user", Content: runTool(ctx, opts.Sandbox, line)})
+			if err := reask(turn); err != nil {
+				return err
+			}
+		}
+		for attempt := 1; opts.JSON && !continuing && !truncated && !cancelled; attempt++ {
+			_, jsonErr := parseJSONReply(answer)
+			if jsonErr == nil {
+				break
+			}
+			if attempt > opts.Retries {
+				ui.PrintWarn(fmt.Sprintf("The reply is not valid JSON: %v", jsonErr))
+				break
+			}
+			transcript.Note(fmt.Sprintf("The reply was not valid JSON (%v); asking again (%d/%d).", jsonErr, attempt, opts.Retries))
+			if err := reask(append(append([]chattmpl.Message{}, turn...),
+				chattmpl.Message{Role: "assistant", Content: answer},
+				chattmpl.Message{Role: "user", Content: jsonCorrection(jsonErr)})); err != nil {
+				return err
+			}
+		}
+		citing := opts.RequireCitations && len(lastSources) > 0
+		for attempt := 1; citing && !continuing && !truncated && !cancelled && len(rag.Citations(answer, len(lastSources))) == 0; attempt++ {
+			if attempt > rag.MaxCitationRetries {
+				ui.PrintWarn("The reply does not cite any of its sources.")
+				break
+			}
+			transcript.Note(fmt.Sprintf("The reply cited none of its sources; asking again (%d/%d).", attempt, rag.MaxCitationRetries))
+			if err := reask(append(append([]chattmpl.Message{}, turn...),
+				chattmpl.Message{Role: "assistant", Content: answer},
+				chattmpl.Message{Role: "user", Content: rag.CitationReminder})); err != nil {
+				return err
+			}
+		}
+		if continuing {
+			answer = chatHistory[len(chatHistory)-1].Content + answer
+			chatHistory[len(chatHistory)-1].Content = answer
+			lastRaw += raw.String()
+		} else {
+			chatHistory = append(chatHistory, chattmpl.Message{Role: "assistant", Content: answer})
+			lastRaw = raw.String()
+		}
+		lastTruncated = truncated
+		conn.used()
+		// Count the history while the user types the next message
+		ahead.observe(result.Stats)
+		ahead.start(format.Render(chatHistory))
+		
+		if len(lastSources) > 0 {
+			// Replies that cite nothing are matched to the sources they draw on
+			cited, _ := rag.Cite(answer, lastSources, false)
+			if sources := rag.Footer(lastSources, cited.Cited); sources != "" {
+				transcript.Note(strings.TrimRight(sources, "\n"))
+			}
+		}
+		
+		if continuing || retrying {
+			conversation.replaceReply(answer)
+		} else {
+			conversation.add("user", userInput, asked)
+			conversation.add("assistant", answer, time.Now())
+		}
+		if session != nil {
+			if continuing || retrying {
+				err = store.ReplaceLastSessionMessage(session.ID, answer)
+			} else {
+				err = saveTurn(store, session.ID, userInput, answer)
+			}
+			if err != nil {
+				ui.PrintWarn(fmt.Sprintf("Failed to save session: %v", err))
+			}
+		}
 	}
 	
+	ui.PrintInfo("Chat session ended.")
+	if opts.Export != "" {
+		return conversation.export(store, opts.Export, slug, string(params), systemPrompt(chatHistory))
+	}
+	return nil
+}
+
+// withSources returns history with its last message, the user's, asking
+// the model to answer from sources. History is left unchanged.
+func withSources(history []chattmpl.Message, sources []rag.Chunk) []chattmpl.Message {
+	if len(sources) == 0 || len(history) == 0 {
+		return history
+	}
+	last := history[len(history)-1]
+	last.Content = rag.Prompt(last.Content, sources)
+	return append(history[:len(history)-1:len(history)-1], last)
+}
+
+// streamResult describes how a streamed completion ended
+type streamResult struct {
+	Truncated bool // generation stopped at the n_predict limit rather than at the end of the reply
+	Stats     completionStats
+}
+
+// streamCompletion sends a streaming completion request and writes the
+// generated text to output as it arrives. Cancelling ctx closes the
+// connection, which makes llama-server stop generating, and returns
+// ctx.Err() with whatever was written.
+func streamCompletion(ctx context.Context, cfg *config.Config, req completionRequest, output io.Writer) (streamResult, error) {
+	var result streamResult
+	req.Stream = true
 	reqBody, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("marshaling request: %w", err)
+		return result, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	touchActivity(cfg, apiPort(cfg))
+	resp, err := apiRequestContext(ctx, cfg, http.MethodPost, "/completion", reqBody)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		return result, fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return result, fmt.Errorf("API returned status %d: %s", resp.StatusCode, body)
+	}
+
+	finished := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var streamData map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &streamData); err != nil {
+			continue
+		}
+		if content, ok := streamData["content"].(string); ok {
+			io.WriteString(output, content)
+		}
+		if stop, _ := streamData["stop"].(bool); stop {
+			result.Truncated = stoppedAtLimit(streamData)
+			result.Stats = statsFromResult(streamData)
+			finished = true
+		}
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		var timeout *timeoutError
+		if errors.As(err, &timeout) {
+			return result, err
+		}
+		return result, streamBroken(cfg, err)
+	}
+	if !finished {
+		return result, streamBroken(cfg, nil)
+	}
+	return result, nil
+}
+
+// stoppedAtLimit reports whether a final completion response says
+// generation ended because n_predict tokens were generated. Newer
+// llama-server builds report stop_type, older ones stopped_limit.
+func stoppedAtLimit(result map[string]interface{}) bool {
+	if stopType, ok := result["stop_type"].(string); ok {
+		return stopType == "limit"
+	}
+	limit, _ := result["stopped_limit"].(bool)
+	return limit
+}
+
+// saveTurn stores a user message and the assistant's reply in a session
+func saveTurn(store *db.Store, sessionID int, userInput, response string) error {
+	if err := store.AddSessionMessage(sessionID, "user", userInput); err != nil {
+		return err
+	}
+	return store.AddSessionMessage(sessionID, "assistant", response)
+}
+
+// chatFormat picks the prompt format for a model from the chat template in
+// its GGUF file, or else the template its running server reports
+func chatFormat(store *db.Store, cfg *config.Config, slug string) *chattmpl.Format {
+	if model, err := store.GetModelBySlug(slug); err == nil {
+		if tmpl, err := chattmpl.FromGGUF(model.FilePath); err == nil && tmpl.Source != "" {
+			if tmpl.Format != nil {
+				return tmpl.Format
+			}
+			return chattmpl.Fallback
+		}
 	}
-	
-	// Send request
-	resp, err := http.Post(fmt.Sprintf("%s/completion", cfg.APIURL), "application/json", bytes.NewBuffer(reqBody))
+
+	resp, err := apiRequest(cfg, http.MethodGet, "/props", nil)
 	if err != nil {
-		return fmt.Errorf("sending request: %w", err)
+		return chattmpl.Fallback
 	}
 	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, body)
-	}
-	
-	// Parse response
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("parsing response: %w", err)
+
+	var props struct {
+		ChatTemplate string `json:"chat_template"`
 	}
-	
-	// Print response
-	fmt.Println(strings.Repeat("─", 80))
-	
-	if content, ok := result["content"].(string); ok {
-		fmt.Println(content)
+	if err := json.NewDecoder(resp.Body).Decode(&props); err == nil {
+		if format := chattmpl.Detect(props.ChatTemplate); format != nil {
+			return format
+		}
 	}
-	
-	return nil
+	return chattmpl.Fallback
 }
 
-// Chat starts an interactive chat session
-func Chat(store *db.Store, cfg *config.Config, slug string) error {
+// EmbedFormat selects how Embed prints the embedding
+type EmbedFormat int
+
+const (
+	// EmbedJSON prints the full server response as indented JSON
+	EmbedJSON EmbedFormat = iota
+	// EmbedSummary prints the vector dimension, norm, and model used
+	EmbedSummary
+	// EmbedRaw prints only the vector as a single-line JSON array
+	EmbedRaw
+)
+
+// Embed generates embeddings for text
+func Embed(store *db.Store, cfg *config.Config, slug, text string, format EmbedFormat) error {
 	if err := EnsureServerRunning(store, cfg, slug); err != nil {
 		return err
 	}
-
-	ui.PrintInfo("Starting chat session. Type 'exit' to end.")
-	
-	// Chat history
-	var chatHistory []string
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
 	
-	reader := bufio.NewReader(os.Stdin)
+	var value interface{}
+	if err := postJSON(cfg, "/embedding", embeddingRequest{Content: text}, &value); err != nil {
+		return err
+	}
 	
-	for {
-		fmt.Print("User: ")
-		userInput, err := reader.ReadString('\n')
+	switch format {
+	case EmbedSummary:
+		vector, err := extractEmbedding(value)
 		if err != nil {
-			return fmt.Errorf("reading input: %w", err)
-		}
-		
-		userInput = strings.TrimSpace(userInput)
-		if userInput == "exit" {
-			break
-		}
-		
-		// Add to history
-		chatHistory = append(chatHistory, userInput)
-		
-		// Format prompt with chat history
-		prompt := formatChatPrompt(chatHistory)
-		
-		// Prepare request
-		req := completionRequest{
-			Prompt:      prompt,
-			NPredict:    cfg.NPredictMax,
-			Temperature: cfg.Temperature,
-			TopK:        cfg.TopK,
-			TopP:        cfg.TopP,
-			CachePrompt: true,
-			Stop:        []string{"\n### Human:"},
-			Stream:      true,
+			return err
 		}
-		
-		reqBody, err := json.Marshal(req)
+		model, err := store.GetModelBySlug(slug)
 		if err != nil {
-			return fmt.Errorf("marshaling request: %w", err)
+			return err
 		}
 
-		// Create HTTP request
-		httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/completion", cfg.APIURL), bytes.NewBuffer(reqBody))
+		fmt.Printf("Model:      %s (%s)\n", slug, model.FileName)
+		fmt.Printf("Dimension:  %d\n", len(vector))
+		fmt.Printf("L2 norm:    %.6f\n", vectorNorm(vector))
+		return nil
+
+	case EmbedRaw:
+		vector, err := extractEmbedding(value)
 		if err != nil {
-			return fmt.Errorf("creating request: %w", err)
+			return err
 		}
-		
-		httpReq.Header.Set("Content-Type", "application/json")
-		
-		// Send request
-		client := &http.Client{}
-		resp, err := client.Do(httpReq)
+		line, err := json.Marshal(vector)
 		if err != nil {
-			return fmt.Errorf("sending request: %w", err)
-		}
-		
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			return fmt.Errorf("API returned status %d: %s", resp.StatusCode, body)
-		}
-		
-		// Stream response
-		fmt.Print("Assistant: ")
-		var fullResponse strings.Builder
-		
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				
-				var streamData map[string]interface{}
-				if err := json.Unmarshal([]byte(data), &streamData); err != nil {
-					continue
-				}
-				
-				if content, ok := streamData["content"].(string); ok {
-					fmt.Print(content)
-					fullResponse.WriteString(content)
-				}
-			}
-		}
-		
-		fmt.Println()
-		resp.Body.Close()
-		
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("reading stream: %w", err)
+			return fmt.Errorf("formatting response: %w", err)
 		}
-		
-		// Add response to history
-		chatHistory = append(chatHistory, fullResponse.String())
+		fmt.Println(string(line))
+		return nil
 	}
 	
-	ui.PrintInfo("Chat session ended.")
-	return nil
-}
-
-// formatChatPrompt formats a chat prompt with history
-func formatChatPrompt(history []string) string {
-	var b strings.Builder
-	
-	// Instruction
-	b.WriteString("A chat between a curious human and an artificial intelligence assistant. ")
-	b.WriteString("The assistant gives helpful, detailed, and polite answers to the human's questions.")
-	
-	// Format history as alternating human/assistant messages
-	for i := 0; i < len(history); i += 2 {
-		b.WriteString("\n### Human: ")
-		b.WriteString(history[i])
-		
-		if i+1 < len(history) {
-			b.WriteString("\n### Assistant: ")
-			b.WriteString(history[i+1])
-		}
-	}
+	// Print the full response
+	var prettyJSON bytes.Buffer
+	encoder := json.NewEncoder(&prettyJSON)
+	encoder.SetIndent("", "  ")
 	
-	// Add final human message if there's an odd number of messages
-	if len(history)%2 == 1 {
-		b.WriteString("\n### Assistant: ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("formatting response: %w", err)
 	}
 	
-	return b.String()
+	fmt.Println(prettyJSON.String())
+	return nil
 }
 
-// Embed generates embeddings for text
-func Embed(store *db.Store, cfg *config.Config, slug, text string) error {
-	if err := EnsureServerRunning(store, cfg, slug); err != nil {
-		return err
-	}
-	
-	// Prepare request
-	req := embeddingRequest{
-		Content: text,
+// embedText requests the embedding vector of text from the running server
+func embedText(ctx context.Context, cfg *config.Config, text string) ([]float64, error) {
+	var value interface{}
+	if err := postJSONContext(ctx, cfg, "/embedding", embeddingRequest{Content: text}, &value); err != nil {
+		return nil, err
 	}
-	
+	return extractEmbedding(value)
+}
+
+// postJSON sends a JSON request to an API endpoint and decodes the JSON response into out
+func postJSON(cfg *config.Config, endpoint string, req, out interface{}) error {
+	return postJSONContext(context.Background(), cfg, endpoint, req, out)
+}
+
+// postJSONContext is postJSON, abandoning the request when ctx is done
+func postJSONContext(ctx context.Context, cfg *config.Config, endpoint string, req, out interface{}) error {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return fmt.Errorf("marshaling request: %w", err)
 	}
-	
-	// Send request
-	resp, err := http.Post(fmt.Sprintf("%s/embedding", cfg.APIURL), "application/json", bytes.NewBuffer(reqBody))
+
+	touchActivity(cfg, apiPort(cfg))
+	resp, err := apiRequestContext(ctx, cfg, http.MethodPost, endpoint, reqBody)
 	if err != nil {
 		return fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
-	
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, body)
 	}
-	
-	// Parse and print response
-	var prettyJSON bytes.Buffer
-	decoder := json.NewDecoder(resp.Body)
-	encoder := json.NewEncoder(&prettyJSON)
-	encoder.SetIndent("", "  ")
-	
-	var value interface{}
-	if err := decoder.Decode(&value); err != nil {
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 		return fmt.Errorf("parsing response: %w", err)
 	}
-	
-	if err := encoder.Encode(value); err != nil {
-		return fmt.Errorf("formatting response: %w", err)
+
+	return nil
+}
+
+// extractEmbedding pulls the embedding vector out of an /embedding response.
+// Older servers return {"embedding": [...]}, newer ones return a list with
+// one entry per input whose embedding may itself be nested per token.
+func extractEmbedding(value interface{}) ([]float64, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if embedding, ok := v["embedding"]; ok {
+			return extractEmbedding(embedding)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("server returned an empty embedding")
+		}
+		if _, ok := v[0].(float64); !ok {
+			return extractEmbedding(v[0])
+		}
+		vector := make([]float64, len(v))
+		for i, x := range v {
+			f, ok := x.(float64)
+			if !ok {
+				return nil, fmt.Errorf("unexpected embedding value: %v", x)
+			}
+			vector[i] = f
+		}
+		return vector, nil
 	}
 	
-	fmt.Println(prettyJSON.String())
-	return nil
+	return nil, fmt.Errorf("no embedding found in server response")
+}
+
+// vectorNorm returns the Euclidean (L2) norm of a vector
+func vectorNorm(vector []float64) float64 {
+	var sum float64
+	for _, x := range vector {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
 }
 
 // Tokenize tokenizes text
@@ -383,6 +1444,10 @@ func Tokenize(store *db.Store, cfg *config.Config, slug, text string) error {
 	if err := EnsureServerRunning(store, cfg, slug); err != nil {
 		return err
 	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
 	
 	// Prepare request
 	req := tokenizeRequest{
@@ -395,7 +1460,7 @@ func Tokenize(store *db.Store, cfg *config.Config, slug, text string) error {
 	}
 	
 	// Send request
-	resp, err := http.Post(fmt.Sprintf("%s/tokenize", cfg.APIURL), "application/json", bytes.NewBuffer(reqBody))
+	resp, err := apiRequest(cfg, http.MethodPost, "/tokenize", reqBody)
 	if err != nil {
 		return fmt.Errorf("sending request: %w", err)
 	}
@@ -430,6 +1495,10 @@ func Detokenize(store *db.Store, cfg *config.Config, slug, tokensStr string) err
 	if err := EnsureServerRunning(store, cfg, slug); err != nil {
 		return err
 	}
+	cfg, err := ModelConfig(store, cfg, slug)
+	if err != nil {
+		return err
+	}
 	
 	// Parse tokens string as JSON array
 	var tokens []int
@@ -446,7 +1515,7 @@ func Detokenize(store *db.Store, cfg *config.Config, slug, tokensStr string) err
 	}
 	
 	// Send request
-	resp, err := http.Post(fmt.Sprintf("%s/detokenize", cfg.APIURL), "application/json", bytes.NewBuffer(reqBody))
+	resp, err := apiRequest(cfg, http.MethodPost, "/detokenize", reqBody)
 	if err != nil {
 		return fmt.Errorf("sending request: %w", err)
 	}
@@ -479,7 +1548,7 @@ func Detokenize(store *db.Store, cfg *config.Config, slug, tokensStr string) err
 // CheckHealth checks the server health
 func CheckHealth(cfg *config.Config) error {
 	// Send request
-	resp, err := http.Get(fmt.Sprintf("%s/health", cfg.APIURL))
+	resp, err := apiRequest(cfg, http.MethodGet, "/health", nil)
 	if err != nil {
 		return fmt.Errorf("sending request: %w", err)
 	}
@@ -514,7 +1583,7 @@ func CheckHealth(cfg *config.Config) error {
 // GetProperties gets the server properties
 func GetProperties(cfg *config.Config) error {
 	// Send request
-	resp, err := http.Get(fmt.Sprintf("%s/props", cfg.APIURL))
+	resp, err := apiRequest(cfg, http.MethodGet, "/props", nil)
 	if err != nil {
 		return fmt.Errorf("sending request: %w", err)
 	}
@@ -542,210 +1611,147 @@ func GetProperties(cfg *config.Config) error {
 	
 	fmt.Println(prettyJSON.String())
 	
+	if n := effectiveContext(value); n > 0 {
+		ui.PrintInfo(fmt.Sprintf("Effective context: %d tokens", n))
+	}
+	
 	return nil
 }
 
-// ListProcesses lists running llama-server processes
-func ListProcesses(store *db.Store) error {
-	// Run ps command to get processes
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("running ps command: %w", err)
+// effectiveContext returns the context size a server reports in /props
+func effectiveContext(props interface{}) int {
+	m, ok := props.(map[string]interface{})
+	if !ok {
+		return 0
 	}
-	
-	// Filter for llama-server processes
-	var serverProcesses [][]string
-	
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.Contains(line, "llama-server") {
-			continue
-		}
-		
-		fields := strings.Fields(line)
-		if len(fields) < 11 {
-			continue
-		}
-		
-		pid := fields[1]
-		
-		// Extract model file path
-		cmdLine := strings.Join(fields[10:], " ")
-		parts := strings.Split(cmdLine, "-m ")
-		if len(parts) < 2 {
-			continue
-		}
-		
-		modelPathParts := strings.Split(parts[1], " ")
-		if len(modelPathParts) < 1 {
-			continue
-		}
-		
-		modelPath := modelPathParts[0]
-		if strings.HasPrefix(modelPath, "\"") && strings.HasSuffix(modelPath, "\"") {
-			modelPath = modelPath[1 : len(modelPath)-1]
-		}
-		
-		fileName := filepath.Base(modelPath)
-		modelName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-		
-		// Look up slug in database
-		var slug string
-		models, err := store.GetAllModels()
-		if err == nil {
-			for _, model := range models {
-				if strings.HasSuffix(model.FilePath, fileName) {
-					slug = model.Slug
-					break
-				}
-			}
-		}
-		
-		if slug == "" {
-			slug = "unknown"
+	if settings, ok := m["default_generation_settings"].(map[string]interface{}); ok {
+		if n, ok := settings["n_ctx"].(float64); ok {
+			return int(n)
 		}
-		
-		serverProcesses = append(serverProcesses, []string{pid, slug, modelName})
 	}
-	
-	if len(serverProcesses) == 0 {
+	if n, ok := m["n_ctx"].(float64); ok {
+		return int(n)
+	}
+	return 0
+}
+
+// ListProcesses lists the running llama-server processes started by llm-cli
+func ListProcesses(store *db.Store) error {
+	servers, err := runningServers(store)
+	if err != nil {
+		return err
+	}
+
+	if len(servers) == 0 {
 		fmt.Println("No running llama-server processes found.")
 		return nil
 	}
-	
-	// Print processes
-	fmt.Println("PID\tSLUG\tMODEL")
-	for _, proc := range serverProcesses {
-		fmt.Printf("%s\t%s\t%s\n", proc[0], proc[1], proc[2])
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tPORT\tSLUG\tMODEL\tUPTIME\tLATENCY\tHEALTH")
+	for _, srv := range servers {
+		fileName := filepath.Base(srv.ModelPath)
+		modelName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		uptime := time.Since(srv.StartedAt).Round(time.Second)
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", srv.PID, srv.Port, srv.Slug, modelName, uptime, formatLatency(srv), formatHealth(srv))
 	}
-	
-	return nil
+	return w.Flush()
 }
 
 // Kill terminates a server process
-func Kill(target string) error {
-	// Check if target is a PID
-	if pid, err := strconv.Atoi(target); err == nil {
-		// Kill by PID
-		process, err := os.FindProcess(pid)
-		if err != nil {
-			return fmt.Errorf("finding process: %w", err)
-		}
-		
-		if err := process.Signal(syscall.SIGTERM); err != nil {
-			return fmt.Errorf("terminating process: %w", err)
-		}
-		
-		ui.PrintInfo(fmt.Sprintf("Process with PID %d terminated.", pid))
+func Kill(store *db.Store, cfg *config.Config, target string) error {
+	// Servers owned by the daemon are stopped through it so it doesn't restart them
+	req := stopRequest{Slug: target}
+	pid, pidErr := strconv.Atoi(target)
+	if pidErr == nil {
+		req = stopRequest{PID: pid}
+	}
+	slugs, err := daemonRelease(cfg, req)
+	if err != nil {
+		return err
+	}
+	if len(slugs) > 0 {
+		ui.PrintInfo(fmt.Sprintf("Server for model '%s' stopped by the daemon.", slugs[0]))
 		return nil
 	}
-	
-	// Otherwise, treat as a slug and find matching processes
-	cmd := exec.Command("pgrep", "-f", fmt.Sprintf("llama-server.*%s", target))
-	output, err := cmd.Output()
+
+	servers, err := runningServers(store)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return fmt.Errorf("no running server found for model '%s'", target)
-		}
-		return fmt.Errorf("finding processes: %w", err)
+		return err
 	}
-	
-	pids := strings.Fields(string(output))
-	if len(pids) == 0 {
-		return fmt.Errorf("no running server found for model '%s'", target)
+
+	var matching []db.Server
+	for _, srv := range servers {
+		if (pidErr == nil && srv.PID == pid) || (pidErr != nil && srv.Slug == target) {
+			matching = append(matching, srv)
+		}
 	}
-	
-	for _, pidStr := range pids {
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			continue
+
+	if len(matching) == 0 {
+		if pidErr != nil {
+			return fmt.Errorf("no running server found for model '%s'", target)
 		}
-		
-		process, err := os.FindProcess(pid)
-		if err != nil {
-			ui.PrintWarn(fmt.Sprintf("Could not find process %d: %v", pid, err))
-			continue
+
+		// Not one of ours, but the user named the process explicitly
+		if !processExists(pid) {
+			return fmt.Errorf("no process with PID %d", pid)
 		}
-		
-		if err := process.Signal(syscall.SIGTERM); err != nil {
-			ui.PrintError(fmt.Sprintf("Failed to terminate process %d: %v", pid, err))
+		if err := stopProcess(pid, false); err != nil {
+			return fmt.Errorf("terminating process: %w", err)
+		}
+		ui.PrintInfo(fmt.Sprintf("Process with PID %d terminated.", pid))
+		return nil
+	}
+
+	for _, srv := range matching {
+		if err := stopProcess(srv.PID, false); err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to terminate process %d: %v", srv.PID, err))
 			continue
 		}
-		
-		ui.PrintInfo(fmt.Sprintf("Server for model '%s' (PID: %d) terminated.", target, pid))
+		store.RemoveServer(srv.PID)
+		ui.PrintInfo(fmt.Sprintf("Server for model '%s' (PID: %d) terminated.", srv.Slug, srv.PID))
 	}
-	
+
 	return nil
 }
 
-// KillAll terminates all llama-server processes
-func KillAll() error {
-	// Find all llama-server processes
-	cmd := exec.Command("pgrep", "-f", "llama-server")
-	output, err := cmd.Output()
+// KillAll terminates all llama-server processes started by llm-cli
+func KillAll(store *db.Store, cfg *config.Config) error {
+	released, err := daemonRelease(cfg, stopRequest{})
+	if err != nil {
+		return err
+	}
+	if len(released) > 0 {
+		ui.PrintInfo(fmt.Sprintf("Daemon stopped servers for: %s", strings.Join(released, ", ")))
+	}
+
+	servers, err := runningServers(store)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return err
+	}
+	if len(servers) == 0 {
+		if len(released) == 0 {
 			ui.PrintWarn("No running llama-server processes found.")
-			return nil
 		}
-		return fmt.Errorf("finding processes: %w", err)
-	}
-	
-	pids := strings.Fields(string(output))
-	if len(pids) == 0 {
-		ui.PrintWarn("No running llama-server processes found.")
 		return nil
 	}
-	
-	// Kill each process
+
 	ui.PrintInfo("Killing all llama-server processes...")
-	
-	for _, pidStr := range pids {
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			continue
-		}
-		
-		process, err := os.FindProcess(pid)
-		if err != nil {
-			ui.PrintWarn(fmt.Sprintf("Could not find process %d: %v", pid, err))
-			continue
-		}
-		
-		if err := process.Signal(syscall.SIGTERM); err != nil {
-			ui.PrintError(fmt.Sprintf("Failed to terminate process %d: %v", pid, err))
-		}
+	if err := signalServers(servers, false); err != nil {
+		ui.PrintError(err.Error())
 	}
-	
-	// Wait a bit for processes to terminate
-	time.Sleep(2 * time.Second)
-	
-	// Check for any remaining processes and force kill them
-	cmd = exec.Command("pgrep", "-f", "llama-server")
-	output, err = cmd.Output()
-	if err == nil && len(output) > 0 {
+
+	// Force kill any that don't terminate cleanly
+	if remaining := waitForExit(servers, 2*time.Second); len(remaining) > 0 {
 		ui.PrintWarn("Some processes didn't terminate cleanly. Force killing...")
-		
-		pids = strings.Fields(string(output))
-		for _, pidStr := range pids {
-			pid, err := strconv.Atoi(pidStr)
-			if err != nil {
-				continue
-			}
-			
-			process, err := os.FindProcess(pid)
-			if err != nil {
-				continue
-			}
-			
-			if err := process.Signal(syscall.SIGKILL); err != nil {
-				ui.PrintError(fmt.Sprintf("Failed to force kill process %d: %v", pid, err))
-			}
+		if err := signalServers(remaining, true); err != nil {
+			ui.PrintError(err.Error())
 		}
 	}
-	
+
+	for _, srv := range servers {
+		store.RemoveServer(srv.PID)
+	}
 	ui.PrintInfo("All llama-server processes terminated.")
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// Setting is a per-model override stored in the model_settings table
+type Setting struct {
+	Name   string // stored key; for server settings also the llama-server flag
+	Kind   string // "int", "float", "bool" or "string"
+	Server bool   // passed to llama-server rather than sent with completion requests
+}
+
+// Settings lists every per-model override, server flags in the order they are passed
+var Settings = []Setting{
+	{"ctx-size", "int", true},
+	{"n-gpu-layers", "int", true},
+	{"threads", "int", true},
+	{"batch-size", "int", true},
+	{"parallel", "int", true},
+	{"flash-attn", "bool", true},
+	{"rope-scaling", "string", true},
+	{"rope-scale", "float", true},
+	{"rope-freq-base", "float", true},
+	{"rope-freq-scale", "float", true},
+	{"yarn-orig-ctx", "int", true},
+	{"yarn-ext-factor", "float", true},
+	{"yarn-attn-factor", "float", true},
+	{"yarn-beta-slow", "float", true},
+	{"yarn-beta-fast", "float", true},
+	{"temperature", "float", false},
+	{"top-k", "int", false},
+	{"top-p", "float", false},
+	{"n-predict", "int", false},
+	{"mirostat", "int", false},
+	{"mirostat-tau", "float", false},
+	{"mirostat-eta", "float", false},
+	{"dynatemp-range", "float", false},
+	{"dynatemp-exponent", "float", false},
+}
+
+// ContextSettings are the settings checked together against the model's trained context
+var ContextSettings = []string{
+	"ctx-size",
+	"rope-scaling",
+	"rope-scale",
+	"rope-freq-base",
+	"rope-freq-scale",
+	"yarn-orig-ctx",
+	"yarn-ext-factor",
+	"yarn-attn-factor",
+	"yarn-beta-slow",
+	"yarn-beta-fast",
+}
+
+// settingAliases maps short names, mostly llama.cpp's short flags, to settings
+var settingAliases = map[string]string{
+	"ctx":               "ctx-size",
+	"c":                 "ctx-size",
+	"ngl":               "n-gpu-layers",
+	"gpu-layers":        "n-gpu-layers",
+	"t":                 "threads",
+	"b":                 "batch-size",
+	"np":                "parallel",
+	"batch":             "batch-size",
+	"fa":                "flash-attn",
+	"temp":              "temperature",
+	"top_k":             "top-k",
+	"top_p":             "top-p",
+	"n_predict":         "n-predict",
+	"max-tokens":        "n-predict",
+	"mirostat_tau":      "mirostat-tau",
+	"mirostat_eta":      "mirostat-eta",
+	"dynatemp_range":    "dynatemp-range",
+	"dynatemp_exponent": "dynatemp-exponent",
+}
+
+// LookupSetting finds a setting by name or alias
+func LookupSetting(name string) (Setting, bool) {
+	if canonical, ok := settingAliases[name]; ok {
+		name = canonical
+	}
+	name = strings.ReplaceAll(name, "_", "-")
+	for _, setting := range Settings {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Flags returns the command-line flags that set s: its name and its
+// longer aliases
+func (s Setting) Flags() []string {
+	flags := []string{"--" + s.Name}
+	for alias, name := range settingAliases {
+		if name == s.Name && len(alias) > 1 && !strings.Contains(alias, "_") {
+			flags = append(flags, "--"+alias)
+		}
+	}
+	sort.Strings(flags[1:])
+	return flags
+}
+
+// Validate checks that value suits the setting's kind
+func (s Setting) Validate(value string) error {
+	switch s.Kind {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s must be an integer", s.Name)
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%s must be a number", s.Name)
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be true or false", s.Name)
+		}
+	}
+	if s.Name == "mirostat" && value != "0" && value != "1" && value != "2" {
+		return fmt.Errorf("mirostat must be 0 (off), 1 or 2")
+	}
+	return nil
+}
+
+// SettingArgs returns the llama-server arguments for a model's stored
+// settings with overrides applied, falling back to the hardware profile's
+// defaults and an automatic context size
+func SettingArgs(store *db.Store, cfg *config.Config, model *db.Model, overrides map[string]string) ([]string, error) {
+	settings, err := store.GetModelSettings(model.Slug)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range overrides {
+		settings[name] = value
+	}
+
+	// Global defaults from the config file apply to every model
+	for key, value := range cfg.ServerDefaults {
+		setting, ok := LookupSetting(key)
+		if !ok || !setting.Server {
+			return nil, fmt.Errorf("unknown server setting %q in %s", key, cfg.ConfigPath)
+		}
+		if _, ok := settings[setting.Name]; !ok {
+			settings[setting.Name] = value
+		}
+	}
+
+	if profile := cfg.Profile(); profile != nil {
+		defaults := map[string]int{
+			"n-gpu-layers": profile.GPULayers,
+			"batch-size":   profile.BatchSize,
+			"parallel":     profile.Parallel,
+		}
+		for name, value := range defaults {
+			if _, ok := settings[name]; !ok {
+				settings[name] = strconv.Itoa(value)
+			}
+		}
+	}
+
+	if _, ok := settings["ctx-size"]; !ok {
+		if ctx := AutoContext(cfg, model); ctx > 0 {
+			settings["ctx-size"] = strconv.Itoa(ctx)
+		}
+	}
+
+	var args []string
+	for _, setting := range Settings {
+		value, ok := settings[setting.Name]
+		if !ok || !setting.Server {
+			continue
+		}
+		if setting.Kind == "bool" {
+			if on, _ := strconv.ParseBool(value); on {
+				args = append(args, "--"+setting.Name)
+			}
+			continue
+		}
+		args = append(args, "--"+setting.Name, value)
+	}
+	return args, nil
+}
+
+// ModelConfig returns a copy of cfg with the model's stored sampling overrides applied
+func ModelConfig(store *db.Store, cfg *config.Config, slug string) (*config.Config, error) {
+	settings, err := store.GetModelSettings(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	modelCfg := *cfg
+	model, err := store.GetModelBySlug(slug)
+	if err == nil {
+		// A remote backend serves every model at its own URL
+		if !cfg.RemoteBackend() {
+			port := modelPort(store, cfg, model)
+			modelCfg.APIURL = modelURL(cfg, port)
+			// Every request counts as use of the server, for idle timeouts
+			// and for which server to stop first to make room
+			requestRecorders.Store(modelCfg.APIURL, func(latency time.Duration, err error) {
+				store.TouchServer(model.FilePath)
+				store.RecordServerRequest(port, latency, err)
+			})
+		}
+		if tmpl, err := chattmpl.FromGGUF(model.FilePath); err == nil {
+			modelCfg.Stop = tmpl.Stops()
+		}
+	} else if !cfg.RemoteBackend() {
+		return nil, err
+	}
+	if v, err := strconv.ParseFloat(settings["temperature"], 64); err == nil {
+		modelCfg.Temperature = v
+	}
+	if v, err := strconv.Atoi(settings["top-k"]); err == nil {
+		modelCfg.TopK = v
+	}
+	if v, err := strconv.ParseFloat(settings["top-p"], 64); err == nil {
+		modelCfg.TopP = v
+	}
+	if v, err := strconv.Atoi(settings["n-predict"]); err == nil {
+		modelCfg.NPredictMax = v
+	}
+	if v, err := strconv.Atoi(settings["mirostat"]); err == nil {
+		modelCfg.Mirostat = v
+	}
+	if v, err := strconv.ParseFloat(settings["mirostat-tau"], 64); err == nil {
+		modelCfg.MirostatTau = v
+	}
+	if v, err := strconv.ParseFloat(settings["mirostat-eta"], 64); err == nil {
+		modelCfg.MirostatEta = v
+	}
+	if v, err := strconv.ParseFloat(settings["dynatemp-range"], 64); err == nil {
+		modelCfg.DynatempRange = v
+	}
+	if v, err := strconv.ParseFloat(settings["dynatemp-exponent"], 64); err == nil {
+		modelCfg.DynatempExponent = v
+	}
+	return &modelCfg, nil
+}
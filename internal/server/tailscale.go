@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// tailnetRange holds the addresses Tailscale gives the machines on a tailnet
+var tailnetRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// TailscaleAddress returns this machine's Tailscale IPv4 address, as the
+// tailscale CLI reports it or, without the CLI, as found on Tailscale's own
+// network interface. Other interfaces can hold addresses in the same range,
+// such as a carrier's NAT, so those aren't taken for it.
+func TailscaleAddress() (string, error) {
+	if _, err := exec.LookPath("tailscale"); err == nil {
+		out, err := tailscale("ip", "-4")
+		if err != nil {
+			return "", err
+		}
+		ip := net.ParseIP(strings.TrimSpace(strings.SplitN(out, "\n", 2)[0]))
+		if ip == nil {
+			return "", fmt.Errorf("no Tailscale address found; run 'tailscale up' to connect")
+		}
+		return ip.String(), nil
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("listing network interfaces: %w", err)
+	}
+	for _, iface := range interfaces {
+		if !tailscaleInterface(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && tailnetRange.Contains(ipnet.IP) {
+				return ipnet.IP.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no Tailscale address found; is Tailscale installed and connected? (https://tailscale.com/download)")
+}
+
+// tailscaleInterface reports whether name is the interface Tailscale
+// creates: tailscale0 on Linux, a utun device on macOS
+func tailscaleInterface(name string) bool {
+	return name == "tailscale0" || strings.HasPrefix(name, "utun")
+}
+
+// tailscaleServe registers addr with Tailscale Serve, so the tailnet can
+// also reach it over HTTPS at this machine's name, and returns that URL and
+// a function that removes the registration
+func tailscaleServe(addr string) (url string, remove func(), err error) {
+	if _, err := exec.LookPath("tailscale"); err != nil {
+		return "", nil, fmt.Errorf("--tailscale-serve needs the tailscale CLI installed (https://tailscale.com/download)")
+	}
+	if _, err := tailscale("serve", "--bg", "--https=443", "http://"+addr); err != nil {
+		return "", nil, err
+	}
+	remove = func() {
+		if _, err := tailscale("serve", "--https=443", "off"); err != nil {
+			ui.PrintWarn(fmt.Sprintf("Removing the Tailscale Serve registration: %v", err))
+		}
+	}
+
+	url = "https://<this machine's tailnet name>"
+	if out, err := tailscale("status", "--json"); err == nil {
+		var status struct {
+			Self struct{ DNSName string }
+		}
+		if json.Unmarshal([]byte(out), &status) == nil && status.Self.DNSName != "" {
+			url = "https://" + strings.TrimSuffix(status.Self.DNSName, ".")
+		}
+	}
+	return url, remove, nil
+}
+
+// tailscale runs the tailscale CLI and returns what it printed
+func tailscale(args ...string) (string, error) {
+	cmd := exec.Command("tailscale", args...)
+	ui.LogCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(out))
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("tailscale %s: %s", args[0], message)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+)
+
+// connectBackoff is how long to wait before each retry of a request whose
+// connection was refused, as happens while a server is still starting or
+// restarting
+var connectBackoff = []time.Duration{100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second}
+
+// connectTimeoutKey is the context key of a request's connect timeout
+type connectTimeoutKey struct{}
+
+// dialContext connects like net.Dialer, giving up after the connect
+// timeout of the request's context, if it has one
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{KeepAlive: 30 * time.Second}
+	if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+		d.Timeout = timeout
+	}
+	return d.DialContext(ctx, network, address)
+}
+
+// connectionRefused reports whether err means nothing listens at the
+// server's address yet: a refused TCP connection or a missing socket
+func connectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+}
+
+// timeoutError is a request to a model's server that ran past one of the
+// timeouts in the config
+type timeoutError struct {
+	setting string // first_token or read
+	after   time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	if e.setting == "first_token" {
+		return fmt.Sprintf("the server didn't start answering within %s; it may be hung, or need longer for a long prompt (raise timeouts.first_token)", e.after)
+	}
+	return fmt.Sprintf("the server sent nothing for %s in the middle of its response; it may be hung (raise timeouts.read to wait longer)", e.after)
+}
+
+// doWithTimeouts sends req with client, abandoning it when the server
+// sends nothing within the first_token timeout, or pauses for longer than
+// the read timeout once it has started. Once the response is closed,
+// record, if not nil, is told how long the server took to start answering
+// and why the request failed, if it did.
+func doWithTimeouts(client *http.Client, req *http.Request, timeouts config.RequestTimeouts, record func(time.Duration, error)) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	body := &watchedBody{parent: req.Context(), ctx: ctx, cancel: cancel, timeouts: timeouts, record: record, start: time.Now()}
+	body.arm(timeouts.FirstToken)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		if timeout := body.timedOut(); timeout != nil {
+			err = timeout
+		}
+		body.err = err
+		// Nothing listening is a server that's down rather than flaky
+		if connectionRefused(err) {
+			body.record = nil
+		}
+		body.Close()
+		return nil, err
+	}
+	body.body = resp.Body
+	if resp.StatusCode >= http.StatusInternalServerError {
+		body.err = fmt.Errorf("the server answered %s", resp.Status)
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// watchedBody is the body of a response whose request is cancelled when
+// the server falls silent for too long
+type watchedBody struct {
+	body     io.ReadCloser
+	parent   context.Context // the caller's; cancelling it is not the server's failure
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	timeouts config.RequestTimeouts
+
+	record    func(latency time.Duration, err error)
+	start     time.Time
+	firstByte time.Duration
+	err       error // why the request failed, if it did
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	started atomic.Bool // the first data has arrived
+}
+
+// arm restarts the timeout at d, or turns it off if d is 0
+func (w *watchedBody) arm(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if d <= 0 {
+		return
+	}
+	w.timer = time.AfterFunc(d, func() {
+		setting := "first_token"
+		if w.started.Load() {
+			setting = "read"
+		}
+		w.cancel(&timeoutError{setting: setting, after: d})
+	})
+}
+
+// timedOut returns the timeout that cancelled the request, if one did
+func (w *watchedBody) timedOut() error {
+	var timeout *timeoutError
+	if errors.As(context.Cause(w.ctx), &timeout) {
+		return timeout
+	}
+	return nil
+}
+
+func (w *watchedBody) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 {
+		if !w.started.Swap(true) {
+			w.firstByte = time.Since(w.start)
+		}
+		w.arm(w.timeouts.Read)
+	}
+	if err != nil && err != io.EOF {
+		if timeout := w.timedOut(); timeout != nil {
+			err = timeout
+		}
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *watchedBody) Close() error {
+	w.arm(0)
+	var err error
+	if w.body != nil {
+		err = w.body.Close()
+	}
+	w.cancel(nil)
+	if w.record != nil && w.parent.Err() == nil {
+		latency := w.firstByte
+		if latency == 0 {
+			latency = time.Since(w.start)
+		}
+		w.record(latency, w.err)
+		w.record = nil
+	}
+	return err
+}
+
+// streamBroken explains a streamed response that ended before its final
+// event, which happens when the server crashes while answering
+func streamBroken(cfg *config.Config, err error) error {
+	reason := "the server closed the connection before finishing its response"
+	if !cfg.RemoteBackend() {
+		if running, _ := IsServerRunning(cfg, apiPort(cfg)); !running {
+			reason = "the server stopped while answering; 'llm-cli logs <slug>' shows why"
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", reason, err)
+	}
+	return errors.New(reason)
+}
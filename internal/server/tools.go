@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/sandbox"
+)
+
+// maxToolRounds limits the commands a model may run for one message
+const maxToolRounds = 5
+
+// runPattern matches a reply's request to run a command
+var runPattern = regexp.MustCompile(`(?s)<run>(.*?)</run>`)
+
+// toolInstruction tells the model how to run commands in the sandbox
+func toolInstruction(runner *sandbox.Runner) string {
+	return fmt.Sprintf("You can run a command in a sandbox directory to help you answer. "+
+		"To run one, reply with only <run>command arguments</run> and you will be given its output. "+
+		"There is no shell: no pipes, redirection or variables. The commands allowed are: %s.",
+		strings.Join(runner.Allowed(), ", "))
+}
+
+// withToolInstruction returns history with its last message, the user's,
+// telling the model how to run commands. History is left unchanged.
+func withToolInstruction(history []chattmpl.Message, runner *sandbox.Runner) []chattmpl.Message {
+	if len(history) == 0 {
+		return history
+	}
+	last := history[len(history)-1]
+	last.Content += "\n\n" + toolInstruction(runner)
+	return append(history[:len(history)-1:len(history)-1], last)
+}
+
+// toolRequest returns the command line a reply asks to run, if any
+func toolRequest(reply string) (string, bool) {
+	match := runPattern.FindStringSubmatch(reply)
+	if match == nil {
+		return "", false
+	}
+	return strings.TrimSpace(match[1]), true
+}
+
+// runTool runs a command line in the sandbox and returns its outcome as
+// the message given back to the model
+func runTool(ctx context.Context, runner *sandbox.Runner, line string) string {
+	args, err := sandbox.Split(line)
+	if err != nil {
+		return fmt.Sprintf("<output>Not run: %v</output>", err)
+	}
+	result, err := runner.Run(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("<output>Not run: %v</output>", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<output exit=\"%d\">\n%s", result.ExitCode, result.Stdout)
+	if result.Stderr != "" {
+		fmt.Fprintf(&b, "\n[stderr]\n%s", result.Stderr)
+	}
+	if result.Truncated {
+		b.WriteString("\n[output truncated]")
+	}
+	if result.TimedOut {
+		b.WriteString("\n[timed out]")
+	}
+	b.WriteString("\n</output>")
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Warmup starts the servers of models one at a time, so the first requests
+// to them don't wait for the models to load. A model whose weights
+// wouldn't fit in the memory budget next to the models already loaded is
+// skipped; the budget is memory_budget when set and otherwise the share of
+// memory AutoContext allows.
+func Warmup(store *db.Store, cfg *config.Config, slugs []string) error {
+	if cfg.RemoteBackend() {
+		return fmt.Errorf("backend %s runs its own servers; there is nothing to warm up", cfg.Backend.Name)
+	}
+	loaded, err := loadedPaths(store, cfg)
+	if err != nil {
+		return err
+	}
+	warmed, err := warmup(store, cfg, slugs, loaded, func(slug string) error {
+		return EnsureServerRunning(store, cfg, slug)
+	})
+	if err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Warmed up %d of %d models.", warmed, len(slugs)))
+	return nil
+}
+
+// warmupDaemon warms up the starred models when the daemon starts
+func (s *supervisor) warmupDaemon() {
+	loaded, err := loadedPaths(s.store, s.cfg)
+	if err != nil {
+		ui.PrintWarn(fmt.Sprintf("Not warming up models: %v", err))
+		return
+	}
+	ui.PrintInfo(fmt.Sprintf("Warming up %d starred models...", len(s.cfg.Starred)))
+	warmed, err := warmup(s.store, s.cfg, s.cfg.Starred, loaded, func(slug string) error {
+		_, err := s.ensure(slug, 0, false)
+		return err
+	})
+	if err != nil {
+		ui.PrintWarn(fmt.Sprintf("Not warming up models: %v", err))
+		return
+	}
+	ui.PrintInfo(fmt.Sprintf("Warmed up %d of %d starred models.", warmed, len(s.cfg.Starred)))
+}
+
+// warmup starts each model with start unless its file is in loaded or it
+// doesn't fit in the memory budget, and returns how many it started
+func warmup(store *db.Store, cfg *config.Config, slugs []string, loaded map[string]bool, start func(slug string) error) (int, error) {
+	budget, err := cfg.MemoryBudgetBytes()
+	if err != nil {
+		return 0, err
+	}
+	if budget == 0 {
+		budget = int64(float64(config.SystemMemory()) * memoryShare)
+	}
+	var used int64
+	for path := range loaded {
+		used += modelSize(&db.Model{FilePath: path})
+	}
+
+	warmed := 0
+	for _, slug := range slugs {
+		model, err := store.GetModelBySlug(slug)
+		if err != nil {
+			ui.PrintWarn(fmt.Sprintf("Skipping %s: %v.", slug, err))
+			continue
+		}
+		if loaded[model.FilePath] {
+			ui.PrintInfo(fmt.Sprintf("%s is already loaded.", slug))
+			continue
+		}
+		size := modelSize(model)
+		if budget > 0 && used+size > budget {
+			ui.PrintWarn(fmt.Sprintf("Skipping %s: its %s of weights would take the loaded models past the memory budget of %s.",
+				slug, formatGiB(size), formatGiB(budget)))
+			continue
+		}
+
+		ui.PrintInfo(fmt.Sprintf("Warming up %s...", slug))
+		if err := start(slug); err != nil {
+			ui.PrintWarn(fmt.Sprintf("Failed to warm up %s: %v", slug, err))
+			continue
+		}
+		loaded[model.FilePath] = true
+		used += size
+		warmed++
+	}
+	return warmed, nil
+}
+
+// loadedPaths returns the model files that have a running server, whether
+// started by llm-cli directly or by the daemon
+func loadedPaths(store *db.Store, cfg *config.Config) (map[string]bool, error) {
+	servers, err := runningServers(store)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]bool)
+	for _, srv := range servers {
+		loaded[srv.ModelPath] = true
+	}
+	if status := daemonStatus(cfg); status != nil {
+		for _, srv := range status.Servers {
+			loaded[srv.Path] = true
+		}
+	}
+	return loaded, nil
+}
+
+// formatGiB formats a byte count in GiB, e.g. "4.4 GiB"
+func formatGiB(n int64) string {
+	return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// uiPage is the chat page serve --ui shows at /. It talks to the proxy's
+// own OpenAI API, so it needs nothing else from serve.
+var uiPage = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>llm-cli</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; background: #f6f8fa; color: #1f2328; margin: 0; }
+main { max-width: 860px; margin: 0 auto; padding: 1rem; display: flex; flex-direction: column; height: 100vh; box-sizing: border-box; }
+header { display: flex; gap: 0.75rem; align-items: center; margin-bottom: 1rem; }
+header h1 { font-size: 1.2rem; margin: 0; flex: 1; }
+#log { flex: 1; overflow-y: auto; }
+.message { background: #fff; border: 1px solid #d0d7de; border-radius: 8px; padding: 0.75rem 1rem; margin-bottom: 1rem; white-space: pre-wrap; }
+.message.user { border-left: 4px solid #0969da; }
+.message.assistant { border-left: 4px solid #1a7f37; }
+.message.error { border-left: 4px solid #cf222e; color: #cf222e; }
+form { display: flex; gap: 0.5rem; }
+textarea { flex: 1; font: inherit; padding: 0.5rem; border: 1px solid #d0d7de; border-radius: 6px; resize: vertical; }
+button, select { font: inherit; }
+</style>
+</head>
+<body>
+<main>
+<header>
+<h1>llm-cli</h1>
+<select id="model" aria-label="Model"></select>
+<button id="clear" type="button">Clear</button>
+{{- if .SignOut}}
+<a href="/auth/logout">Sign out</a>
+{{- end}}
+</header>
+<div id="log" aria-live="polite"></div>
+<form id="form">
+<textarea id="input" rows="3" placeholder="Message (Enter sends, Shift-Enter starts a new line)" required></textarea>
+<button type="submit">Send</button>
+</form>
+</main>
+<script>
+const log = document.getElementById("log");
+const input = document.getElementById("input");
+const model = document.getElementById("model");
+let history = [];
+
+function add(role, text) {
+  const div = document.createElement("div");
+  div.className = "message " + role;
+  div.textContent = text;
+  log.appendChild(div);
+  log.scrollTop = log.scrollHeight;
+  return div;
+}
+
+fetch("/v1/models").then(r => r.json()).then(list => {
+  for (const m of list.data) {
+    const option = document.createElement("option");
+    option.textContent = m.id;
+    model.appendChild(option);
+  }
+}).catch(err => add("error", "Listing the models failed: " + err));
+
+document.getElementById("clear").onclick = () => { history = []; log.textContent = ""; };
+input.addEventListener("keydown", e => {
+  if (e.key === "Enter" && !e.shiftKey) {
+    e.preventDefault();
+    document.getElementById("form").requestSubmit();
+  }
+});
+
+document.getElementById("form").onsubmit = async e => {
+  e.preventDefault();
+  const text = input.value.trim();
+  if (!text) return;
+  input.value = "";
+  add("user", text);
+  history.push({role: "user", content: text});
+  const reply = add("assistant", "");
+  try {
+    const resp = await fetch("/v1/chat/completions", {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify({model: model.value, messages: history, stream: true}),
+    });
+    if (!resp.ok) {
+      const body = await resp.json().catch(() => ({}));
+      throw new Error((body.error && body.error.message) || resp.statusText);
+    }
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = "";
+    for (;;) {
+      const {done, value} = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, {stream: true});
+      const lines = buffer.split("\n");
+      buffer = lines.pop();
+      for (const line of lines) {
+        if (!line.startsWith("data: ") || line === "data: [DONE]") continue;
+        const delta = JSON.parse(line.slice(6)).choices[0].delta;
+        if (delta && delta.content) {
+          reply.textContent += delta.content;
+          log.scrollTop = log.scrollHeight;
+        }
+      }
+    }
+    history.push({role: "assistant", content: reply.textContent});
+  } catch (err) {
+    reply.remove();
+    history.pop();
+    add("error", String(err.message || err));
+  }
+};
+</script>
+</body>
+</html>
+`))
+
+// handleUI serves the chat page, with a sign-out link when browsers sign
+// in with OIDC
+func handleUI(signOut bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		uiPage.Execute(w, struct{ SignOut bool }{signOut})
+	}
+}
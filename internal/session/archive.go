@@ -0,0 +1,94 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// archiveMessage is a message in a JSON export
+type archiveMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// archive is a conversation exported as JSON, with everything needed to
+// read it later without llm-cli
+type archive struct {
+	Name      string           `json:"name"`
+	Model     string           `json:"model"`
+	ModelID   string           `json:"model_id,omitempty"`
+	ModelFile string           `json:"model_file,omitempty"`
+	Params    json.RawMessage  `json:"params,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Messages  []archiveMessage `json:"messages"`
+}
+
+// writeJSON writes a conversation as one indented JSON document
+func writeJSON(w io.Writer, session *db.Session, model *db.Model, messages []db.Message) error {
+	doc := archive{
+		Name:      session.Name,
+		Model:     session.ModelSlug,
+		CreatedAt: session.CreatedAt.Truncate(time.Second),
+		UpdatedAt: session.UpdatedAt.Truncate(time.Second),
+		Messages:  []archiveMessage{},
+	}
+	if model != nil {
+		doc.ModelID, doc.ModelFile = model.ModelID, model.FileName
+	}
+	if json.Valid([]byte(session.Params)) {
+		doc.Params = json.RawMessage(session.Params)
+	}
+	for _, message := range messages {
+		doc.Messages = append(doc.Messages, archiveMessage{Role: message.Role, Content: message.Content, CreatedAt: message.CreatedAt.Truncate(time.Second)})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding session: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// writeMarkdown writes a conversation as a Markdown document, a heading
+// per message. Messages are Markdown already, so they are written as is.
+func writeMarkdown(w io.Writer, session *db.Session, model *db.Model, messages []db.Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat session: %s\n\n", session.Name)
+
+	if model != nil {
+		fmt.Fprintf(&b, "- **Model:** %s — %s (%s)\n", session.ModelSlug, model.ModelID, model.FileName)
+	} else {
+		fmt.Fprintf(&b, "- **Model:** %s\n", session.ModelSlug)
+	}
+	var params map[string]interface{}
+	if json.Unmarshal([]byte(session.Params), &params) == nil && len(params) > 0 {
+		var pairs []string
+		for key, value := range params {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+		}
+		sort.Strings(pairs)
+		fmt.Fprintf(&b, "- **Parameters:** %s\n", strings.Join(pairs, ", "))
+	}
+	fmt.Fprintf(&b, "- **Started:** %s\n", session.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "- **Last message:** %s\n", session.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+
+	for _, message := range messages {
+		role := message.Role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s\n\n%s\n", role, message.CreatedAt.Local().Format("2006-01-02 15:04:05"), strings.TrimSpace(message.Content))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
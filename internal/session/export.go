@@ -0,0 +1,121 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// ExportOptions controls how a session is exported
+type ExportOptions struct {
+	Format        string
+	Output        string
+	SelfContained bool
+}
+
+// Export writes a saved session to a file (or stdout) in the requested format
+func Export(store *db.Store, name string, opts ExportOptions) error {
+	session, err := store.GetSession(name)
+	if err != nil {
+		return err
+	}
+
+	messages, err := sessionMessages(store, session)
+	if err != nil {
+		return err
+	}
+
+	// The model may have been removed since the session was recorded
+	model, _ := store.GetModelBySlug(session.ModelSlug)
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := write(out, opts.Format, session, model, messages, opts.SelfContained); err != nil {
+		return err
+	}
+
+	if opts.Output != "" {
+		ui.PrintInfo(fmt.Sprintf("Exported session '%s' to %s", name, opts.Output))
+	}
+	return nil
+}
+
+// ExportConversation writes a conversation, which needn't be saved as a
+// session, to path in the format its extension names; see FormatForPath.
+// session describes the conversation and messages lead with its system
+// prompt, if it has one.
+func ExportConversation(store *db.Store, path string, session *db.Session, messages []db.Message) error {
+	format, ok := FormatForPath(path)
+	if !ok {
+		return fmt.Errorf("can't tell the export format from %s; name it .md, .json or .html", path)
+	}
+	// The model may have been removed since
+	model, _ := store.GetModelBySlug(session.ModelSlug)
+
+	var out bytes.Buffer
+	if err := write(&out, format, session, model, messages, true); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	return nil
+}
+
+// FormatForPath returns the export format a file name's extension names:
+// markdown for .md, json for .json and html for .html. ok is false for
+// any other extension.
+func FormatForPath(path string) (format string, ok bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return "markdown", true
+	case ".json":
+		return "json", true
+	case ".html", ".htm":
+		return "html", true
+	}
+	return "", false
+}
+
+// write writes messages in format
+func write(w io.Writer, format string, session *db.Session, model *db.Model, messages []db.Message, selfContained bool) error {
+	switch format {
+	case "html":
+		return writeHTML(w, session, model, messages, selfContained)
+	case "markdown":
+		return writeMarkdown(w, session, model, messages)
+	case "json":
+		return writeJSON(w, session, model, messages)
+	case "openai", "sharegpt":
+		return writeJSONL(w, session, messages, format)
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
+// sessionMessages returns the messages of a session, led by its system
+// prompt if it has one
+func sessionMessages(store *db.Store, session *db.Session) ([]db.Message, error) {
+	messages, err := store.GetSessionMessages(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	system, err := store.GetSessionSystemPrompt(session.ID)
+	if err != nil || system == "" {
+		return messages, err
+	}
+	return append([]db.Message{{SessionID: session.ID, Role: "system", Content: system, CreatedAt: session.CreatedAt}}, messages...), nil
+}
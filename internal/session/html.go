@@ -0,0 +1,209 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// htmlMessage is a message prepared for the HTML template
+type htmlMessage struct {
+	Role string
+	Time string
+	Body template.HTML
+}
+
+// htmlPage holds everything rendered into an HTML transcript
+type htmlPage struct {
+	Title         string
+	Model         string
+	ModelFile     string
+	Params        []string
+	Created       string
+	Updated       string
+	Messages      []htmlMessage
+	SelfContained bool
+}
+
+var htmlTemplate = template.Must(template.New("session").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if not .SelfContained}}
+<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/styles/github.min.css">
+<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/highlight.min.js"></script>
+<script>document.addEventListener("DOMContentLoaded", () => hljs.highlightAll());</script>
+{{- end}}
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; background: #f6f8fa; color: #1f2328; margin: 0; }
+main { max-width: 860px; margin: 0 auto; padding: 2rem 1rem; }
+h1 { font-size: 1.4rem; margin-bottom: 1.5rem; }
+.message { background: #fff; border: 1px solid #d0d7de; border-radius: 8px; padding: 0.75rem 1rem; margin-bottom: 1rem; }
+.message.user { border-left: 4px solid #0969da; }
+.message.assistant { border-left: 4px solid #1a7f37; }
+.message.system { border-left: 4px solid #8250df; }
+.meta { font-size: 0.8rem; color: #656d76; margin-bottom: 0.5rem; }
+.role { font-weight: 600; text-transform: capitalize; margin-right: 0.5rem; }
+.body p { margin: 0.4rem 0; white-space: pre-wrap; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 0.9em; background: #eff1f3; padding: 0.1em 0.3em; border-radius: 4px; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: 0.75rem; overflow-x: auto; }
+pre code { background: none; padding: 0; }
+.hl-comment { color: #6e7781; font-style: italic; }
+.hl-string { color: #0a3069; }
+.hl-number { color: #0550ae; }
+.hl-keyword { color: #cf222e; font-weight: 600; }
+footer { font-size: 0.8rem; color: #656d76; border-top: 1px solid #d0d7de; margin-top: 2rem; padding-top: 1rem; }
+footer dl { display: grid; grid-template-columns: max-content auto; gap: 0.25rem 1rem; margin: 0; }
+footer dt { font-weight: 600; }
+footer dd { margin: 0; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{- range .Messages}}
+<section class="message {{.Role}}">
+<div class="meta"><span class="role">{{.Role}}</span>{{.Time}}</div>
+<div class="body">{{.Body}}</div>
+</section>
+{{- end}}
+<footer>
+<dl>
+<dt>Model</dt><dd>{{.Model}}{{if .ModelFile}} ({{.ModelFile}}){{end}}</dd>
+{{- if .Params}}
+<dt>Parameters</dt><dd>{{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p}}{{end}}</dd>
+{{- end}}
+<dt>Started</dt><dd>{{.Created}}</dd>
+<dt>Last message</dt><dd>{{.Updated}}</dd>
+</dl>
+<p>Exported with llm-cli</p>
+</footer>
+</main>
+</body>
+</html>
+`))
+
+// writeHTML renders a session as a standalone HTML transcript
+func writeHTML(w io.Writer, session *db.Session, model *db.Model, messages []db.Message, selfContained bool) error {
+	page := htmlPage{
+		Title:         "Chat session: " + session.Name,
+		Model:         session.ModelSlug,
+		Created:       session.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+		Updated:       session.UpdatedAt.Local().Format("2006-01-02 15:04:05"),
+		SelfContained: selfContained,
+	}
+
+	if model != nil {
+		page.Model = fmt.Sprintf("%s — %s", session.ModelSlug, model.ModelID)
+		page.ModelFile = model.FileName
+	}
+
+	var params map[string]interface{}
+	if json.Unmarshal([]byte(session.Params), &params) == nil {
+		for key, value := range params {
+			page.Params = append(page.Params, fmt.Sprintf("%s=%v", key, value))
+		}
+		sort.Strings(page.Params)
+	}
+
+	for _, message := range messages {
+		page.Messages = append(page.Messages, htmlMessage{
+			Role: message.Role,
+			Time: message.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			Body: renderMessage(message.Content, selfContained),
+		})
+	}
+
+	if err := htmlTemplate.Execute(w, page); err != nil {
+		return fmt.Errorf("rendering HTML: %w", err)
+	}
+	return nil
+}
+
+var inlineCodePattern = regexp.MustCompile("`([^`\n]+)`")
+
+// renderMessage converts message text to HTML, turning fenced code blocks
+// into highlighted <pre> blocks and escaping everything else
+func renderMessage(content string, highlight bool) template.HTML {
+	var b strings.Builder
+
+	parts := strings.Split(content, "```")
+	for i, part := range parts {
+		// Odd parts are inside a fence (an unterminated fence runs to the end)
+		if i%2 == 1 {
+			lang, code, _ := strings.Cut(part, "\n")
+			lang = strings.TrimSpace(lang)
+			code = strings.TrimSuffix(code, "\n")
+
+			if lang != "" {
+				fmt.Fprintf(&b, `<pre><code class="language-%s">`, html.EscapeString(lang))
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			if highlight {
+				b.WriteString(highlightCode(code, lang))
+			} else {
+				b.WriteString(html.EscapeString(code))
+			}
+			b.WriteString("</code></pre>")
+			continue
+		}
+
+		for _, paragraph := range strings.Split(strings.Trim(part, "\n"), "\n\n") {
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			escaped := html.EscapeString(paragraph)
+			escaped = inlineCodePattern.ReplaceAllString(escaped, "<code>$1</code>")
+			b.WriteString("<p>" + escaped + "</p>")
+		}
+	}
+
+	return template.HTML(b.String())
+}
+
+var (
+	cStyleTokens = regexp.MustCompile(`(//[^\n]*|/\*[\s\S]*?\*/)|("(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|` + "`[^`]*`" + `)|(\b\d+(?:\.\d+)?\b)|(\b(?:` + keywords + `)\b)`)
+	hashTokens   = regexp.MustCompile(`(#[^\n]*)|("(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*')|(\b\d+(?:\.\d+)?\b)|(\b(?:` + keywords + `)\b)`)
+)
+
+// keywords common to the languages models most often produce
+const keywords = "func|function|def|class|struct|interface|type|return|if|else|elif|for|while|do|switch|case|break|continue|" +
+	"import|from|package|const|let|var|new|try|catch|except|finally|raise|throw|async|await|yield|lambda|" +
+	"public|private|static|void|int|string|bool|true|false|True|False|nil|null|None|self|this|in|not|and|or|fn|mut|impl|pub|use|echo|then|fi|done|esac"
+
+// highlightCode wraps comments, strings, numbers and keywords in styled spans
+func highlightCode(code, lang string) string {
+	pattern := cStyleTokens
+	switch strings.ToLower(lang) {
+	case "python", "py", "sh", "bash", "shell", "zsh", "ruby", "rb", "yaml", "yml", "toml", "perl", "r":
+		pattern = hashTokens
+	}
+
+	classes := []string{"", "hl-comment", "hl-string", "hl-number", "hl-keyword"}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(code, -1) {
+		b.WriteString(html.EscapeString(code[last:match[0]]))
+		for group := 1; group < len(classes); group++ {
+			if match[2*group] >= 0 {
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`, classes[group], html.EscapeString(code[match[0]:match[1]]))
+				break
+			}
+		}
+		last = match[1]
+	}
+	b.WriteString(html.EscapeString(code[last:]))
+
+	return b.String()
+}
@@ -0,0 +1,225 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// openAIMessage is a message in the OpenAI chat format
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIConversation is one line of an OpenAI fine-tuning JSONL file
+type openAIConversation struct {
+	Messages []openAIMessage `json:"messages"`
+}
+
+// shareGPTTurn is a message in the ShareGPT format
+type shareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// shareGPTConversation is one conversation in a ShareGPT dataset
+type shareGPTConversation struct {
+	ID            string         `json:"id,omitempty"`
+	Conversations []shareGPTTurn `json:"conversations"`
+}
+
+// ShareGPT speaker names mapped to chat roles, and back
+var (
+	shareGPTRoles = map[string]string{"human": "user", "user": "user", "gpt": "assistant", "assistant": "assistant", "system": "system"}
+	shareGPTFrom  = map[string]string{"user": "human", "assistant": "gpt", "system": "system"}
+)
+
+// writeJSONL writes messages as a single JSONL line in the given format
+func writeJSONL(w io.Writer, session *db.Session, messages []db.Message, format string) error {
+	var record interface{}
+
+	switch format {
+	case "openai":
+		conv := openAIConversation{Messages: []openAIMessage{}}
+		for _, m := range messages {
+			conv.Messages = append(conv.Messages, openAIMessage{Role: m.Role, Content: m.Content})
+		}
+		record = conv
+	case "sharegpt":
+		conv := shareGPTConversation{ID: session.Name, Conversations: []shareGPTTurn{}}
+		for _, m := range messages {
+			conv.Conversations = append(conv.Conversations, shareGPTTurn{From: shareGPTFrom[m.Role], Value: m.Content})
+		}
+		record = conv
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding session: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", line)
+	return err
+}
+
+// ExportAll writes every saved session as JSONL, one conversation per line
+func ExportAll(store *db.Store, format, output string) error {
+	sessions, err := store.GetAllSessions()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	for i := range sessions {
+		messages, err := sessionMessages(store, &sessions[i])
+		if err != nil {
+			return err
+		}
+		if err := writeJSONL(out, &sessions[i], messages, format); err != nil {
+			return err
+		}
+	}
+
+	if output != "" {
+		ui.PrintInfo(fmt.Sprintf("Exported %d sessions to %s", len(sessions), output))
+	}
+	return nil
+}
+
+// Import reads conversations in OpenAI or ShareGPT format (JSONL or a JSON
+// array) and stores each one as a new session
+func Import(store *db.Store, path, format, modelSlug string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading import file: %w", err)
+	}
+
+	records, err := splitRecords(data)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	imported := 0
+
+	for i, record := range records {
+		name, messages, err := decodeConversation(record, format)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", base, i+1)
+		}
+
+		session, err := createUniqueSession(store, name, modelSlug)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if err := store.AddSessionMessage(session.ID, m.Role, m.Content); err != nil {
+				return err
+			}
+		}
+		imported++
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Imported %d sessions from %s", imported, path))
+	return nil
+}
+
+// splitRecords accepts either a JSON array or JSON Lines and returns the raw records
+func splitRecords(data []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var records []json.RawMessage
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, fmt.Errorf("parsing JSON array: %w", err)
+		}
+		return records, nil
+	}
+
+	var records []json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		records = append(records, json.RawMessage(append([]byte(nil), line...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading JSONL: %w", err)
+	}
+	return records, nil
+}
+
+// decodeConversation converts one record into chat messages
+func decodeConversation(record json.RawMessage, format string) (string, []db.Message, error) {
+	var messages []db.Message
+
+	switch format {
+	case "openai":
+		var conv openAIConversation
+		if err := json.Unmarshal(record, &conv); err != nil {
+			return "", nil, fmt.Errorf("parsing OpenAI conversation: %w", err)
+		}
+		for _, m := range conv.Messages {
+			if m.Role != "user" && m.Role != "assistant" && m.Role != "system" {
+				continue
+			}
+			messages = append(messages, db.Message{Role: m.Role, Content: m.Content})
+		}
+		return "", messages, nil
+
+	case "sharegpt":
+		var conv shareGPTConversation
+		if err := json.Unmarshal(record, &conv); err != nil {
+			return "", nil, fmt.Errorf("parsing ShareGPT conversation: %w", err)
+		}
+		for _, turn := range conv.Conversations {
+			role, ok := shareGPTRoles[strings.ToLower(turn.From)]
+			if !ok {
+				continue
+			}
+			messages = append(messages, db.Message{Role: role, Content: turn.Value})
+		}
+		return conv.ID, messages, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported import format: %s", format)
+}
+
+// createUniqueSession creates a session, adding a numeric suffix if the name is taken
+func createUniqueSession(store *db.Store, name, modelSlug string) (*db.Session, error) {
+	candidate := name
+	for n := 2; ; n++ {
+		if _, err := store.GetSession(candidate); err != nil {
+			break
+		}
+		candidate = fmt.Sprintf("%s-%d", name, n)
+	}
+	return store.GetOrCreateSession(candidate, modelSlug, "")
+}
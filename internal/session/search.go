@@ -0,0 +1,87 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// snippetLength is how much of a message is shown around a match
+const snippetLength = 200
+
+// Search prints the stored session messages and completions matching query,
+// each with the message before it and where it came from
+func Search(store *db.Store, query string, limit int) error {
+	hits, err := store.SearchConversations(query, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(hits) == 0 {
+		fmt.Printf("No matches for %q.\n", query)
+		return nil
+	}
+
+	terms := strings.Fields(strings.ToLower(query))
+	for i, hit := range hits {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		source := "history"
+		if hit.SessionName != "" {
+			source = "session " + hit.SessionName
+		}
+		fmt.Printf("%s · %s · %s\n", source, hit.ModelSlug, hit.CreatedAt.Local().Format("2006-01-02 15:04"))
+		if hit.Context != "" {
+			fmt.Printf("  %s: %s\n", hit.ContextRole, snippet(hit.Context, terms))
+		}
+		fmt.Printf("  %s: %s\n", hit.Role, snippet(hit.Content, terms))
+	}
+
+	return nil
+}
+
+// snippet returns text on one line, cut to the part around the first
+// search term it contains
+func snippet(text string, terms []string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= snippetLength {
+		return text
+	}
+
+	start := 0
+	lower := strings.ToLower(text)
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			start = i - snippetLength/4
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(text) {
+		end = len(text)
+		start = max(0, end-snippetLength)
+	}
+
+	// Keep multi-byte characters whole
+	for start > 0 && start < len(text) && text[start]&0xC0 == 0x80 {
+		start--
+	}
+	for end < len(text) && text[end]&0xC0 == 0x80 {
+		end++
+	}
+
+	result := text[start:end]
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(text) {
+		result += "…"
+	}
+	return result
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+)
+
+// List displays all saved chat sessions
+func List(store *db.Store) error {
+	sessions, err := store.GetAllSessions()
+	if err != nil {
+		return fmt.Errorf("retrieving sessions: %w", err)
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No saved sessions.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMODEL\tMESSAGES\tUPDATED")
+
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+			session.Name, session.ModelSlug, session.Messages,
+			session.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,335 @@
+// Package stack starts and stops a set of model servers declared in a YAML
+// file, like a small docker compose for local models. 'llm-cli up' brings
+// the running servers in line with the file and 'llm-cli down' stops them.
+package stack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// DefaultFile is the stack file up reads when none is given
+const DefaultFile = "stack.yaml"
+
+// Service is how one model's server should run
+type Service struct {
+	Slug      string            `json:"slug"`
+	Port      int               `json:"port,omitempty"`       // 0 lets llm-cli pick one
+	KeepAlive string            `json:"keep_alive,omitempty"` // stop after this long without requests
+	Args      map[string]string `json:"args,omitempty"`       // llama-server settings, e.g. ctx-size
+}
+
+// file is a stack file as written
+type file struct {
+	Models yaml.Node `yaml:"models"`
+}
+
+// service is a model's entry in a stack file
+type service struct {
+	Port      int                    `yaml:"port"`
+	KeepAlive string                 `yaml:"keep_alive"`
+	Args      map[string]interface{} `yaml:"args"`
+}
+
+// state is what the last up started, kept so the next up can tell what
+// changed and down knows what to stop
+type state struct {
+	File     string         `json:"file"`
+	Services []Service      `json:"services"`
+	PIDs     map[string]int `json:"pids"`
+}
+
+// Load reads a stack file, checking that its models are installed and
+// their settings valid. Services are in the order the file lists them.
+func Load(store *db.Store, path string) ([]Service, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading stack file: %w", err)
+	}
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing stack file %s: %w", path, err)
+	}
+	if f.Models.Kind != yaml.MappingNode || len(f.Models.Content) == 0 {
+		return nil, fmt.Errorf("stack file %s declares no models; list them under models:, keyed by slug", path)
+	}
+
+	var services []Service
+	ports := make(map[int]string)
+	// A mapping node's content alternates keys and values
+	for i := 0; i+1 < len(f.Models.Content); i += 2 {
+		slug := f.Models.Content[i].Value
+		var entry service
+		if err := f.Models.Content[i+1].Decode(&entry); err != nil {
+			return nil, fmt.Errorf("model %s in %s: %w", slug, path, err)
+		}
+		if _, err := store.GetModelBySlug(slug); err != nil {
+			return nil, fmt.Errorf("model %s in %s: %w", slug, path, err)
+		}
+
+		svc := Service{Slug: slug, Port: entry.Port, KeepAlive: entry.KeepAlive, Args: make(map[string]string)}
+		if svc.Port != 0 {
+			if svc.Port < 1 || svc.Port > 65535 {
+				return nil, fmt.Errorf("model %s in %s: invalid port %d", slug, path, svc.Port)
+			}
+			if other, ok := ports[svc.Port]; ok {
+				return nil, fmt.Errorf("models %s and %s in %s both use port %d", other, slug, path, svc.Port)
+			}
+			ports[svc.Port] = slug
+		}
+		if svc.KeepAlive != "" {
+			if _, err := (&config.Config{KeepAlive: svc.KeepAlive}).KeepAliveDuration(); err != nil {
+				return nil, fmt.Errorf("model %s in %s: %w", slug, path, err)
+			}
+		}
+		for name, value := range entry.Args {
+			setting, ok := server.LookupSetting(name)
+			if !ok || !setting.Server {
+				return nil, fmt.Errorf("model %s in %s: unknown server setting %s", slug, path, name)
+			}
+			text := fmt.Sprint(value)
+			if err := setting.Validate(text); err != nil {
+				return nil, fmt.Errorf("model %s in %s: %w", slug, path, err)
+			}
+			svc.Args[setting.Name] = text
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// Up brings the running servers in line with the stack file at path:
+// servers it declares are started, or restarted if their settings changed
+// since the last up, and servers the last up started that it no longer
+// declares are stopped. With prune, every other server is stopped too.
+func Up(store *db.Store, cfg *config.Config, path string, prune bool) error {
+	services, err := Load(store, path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	last, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+	running, err := server.RunningServers(store)
+	if err != nil {
+		return err
+	}
+
+	// Stop what isn't declared first, so the declared servers have the memory
+	declared := make(map[string]bool)
+	for _, svc := range services {
+		declared[svc.Slug] = true
+	}
+	for _, srv := range running {
+		if declared[srv.Slug] {
+			continue
+		}
+		if last.PIDs[srv.Slug] != srv.PID && !prune {
+			continue
+		}
+		ui.PrintInfo(fmt.Sprintf("Stopping %s: it isn't in the stack.", srv.Slug))
+		if err := server.StopServer(store, cfg, srv.ModelPath); err != nil {
+			return err
+		}
+	}
+
+	// The servers the last up started for declared models stay recorded
+	// until they are replaced, so down can still stop them if a start fails
+	next := state{File: abs, Services: services, PIDs: make(map[string]int)}
+	for slug, pid := range last.PIDs {
+		if declared[slug] {
+			next.PIDs[slug] = pid
+		}
+	}
+	started, unchanged := 0, 0
+	for _, svc := range services {
+		reason := last.changed(svc, running)
+		if reason == "" {
+			unchanged++
+			continue
+		}
+		ui.PrintInfo(fmt.Sprintf("Starting %s: %s.", svc.Slug, reason))
+		pid, err := start(store, cfg, svc)
+		if err != nil {
+			// Keep what was started, so down can still stop it
+			if saveErr := saveState(cfg, next); saveErr != nil {
+				ui.PrintWarn(saveErr.Error())
+			}
+			return fmt.Errorf("starting %s: %w", svc.Slug, err)
+		}
+		next.PIDs[svc.Slug] = pid
+		started++
+	}
+	if err := saveState(cfg, next); err != nil {
+		return err
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Stack %s is up: %d started, %d already running.", path, started, unchanged))
+	return nil
+}
+
+// Down stops the servers the last up started
+func Down(store *db.Store, cfg *config.Config) error {
+	last, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+	if len(last.PIDs) == 0 {
+		ui.PrintInfo("No stack is up.")
+		return nil
+	}
+	running, err := server.RunningServers(store)
+	if err != nil {
+		return err
+	}
+
+	stopped := 0
+	for _, srv := range running {
+		if pid, ok := last.PIDs[srv.Slug]; !ok || pid != srv.PID {
+			continue
+		}
+		ui.PrintInfo(fmt.Sprintf("Stopping %s...", srv.Slug))
+		if err := server.StopServer(store, cfg, srv.ModelPath); err != nil {
+			return err
+		}
+		stopped++
+	}
+	if err := os.Remove(statePath(cfg)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing stack state: %w", err)
+	}
+	ui.PrintInfo(fmt.Sprintf("Stack %s is down: %d stopped.", last.File, stopped))
+	return nil
+}
+
+// Slugs returns the models the last up declared, in the order of its file,
+// or none if no stack is up
+func Slugs(cfg *config.Config) ([]string, error) {
+	last, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, 0, len(last.Services))
+	for _, svc := range last.Services {
+		slugs = append(slugs, svc.Slug)
+	}
+	return slugs, nil
+}
+
+// start starts a service's server with its port, keep-alive and settings,
+// stopping any running for the model first. The port is used for this
+// server only; the model keeps its own for servers started outside the
+// stack.
+func start(store *db.Store, cfg *config.Config, svc Service) (int, error) {
+	modelCfg := *cfg
+	modelCfg.Port = svc.Port
+	if svc.KeepAlive != "" {
+		modelCfg.KeepAlive = svc.KeepAlive
+	}
+	// Making room must not stop the stack's other servers
+	modelCfg.NoEvict = true
+	return server.StartServer(store, &modelCfg, svc.Slug, svc.Args)
+}
+
+// changed says why svc's server must be started, or returns "" if the last
+// up started it as declared and it is still running
+func (s state) changed(svc Service, running []db.Server) string {
+	pid, ok := s.PIDs[svc.Slug]
+	if !ok {
+		for _, srv := range running {
+			if srv.Slug == svc.Slug {
+				return "it was started outside the stack, with settings that may differ"
+			}
+		}
+		return "it isn't running"
+	}
+	if !slices.ContainsFunc(running, func(srv db.Server) bool { return srv.PID == pid }) {
+		return "it isn't running"
+	}
+	i := slices.IndexFunc(s.Services, func(prev Service) bool { return prev.Slug == svc.Slug })
+	if i < 0 {
+		return "it isn't running"
+	}
+	if diff := difference(s.Services[i], svc); diff != "" {
+		return diff + " changed"
+	}
+	return ""
+}
+
+// difference names what differs between two declarations of a service
+func difference(prev, next Service) string {
+	var changed []string
+	if prev.Port != next.Port {
+		changed = append(changed, "port")
+	}
+	if prev.KeepAlive != next.KeepAlive {
+		changed = append(changed, "keep_alive")
+	}
+	var args []string
+	for name := range prev.Args {
+		if _, ok := next.Args[name]; !ok {
+			args = append(args, name)
+		}
+	}
+	for name, value := range next.Args {
+		if prev.Args[name] != value {
+			args = append(args, name)
+		}
+	}
+	sort.Strings(args)
+	return strings.Join(append(changed, args...), ", ")
+}
+
+// statePath is where the last up's state is kept
+func statePath(cfg *config.Config) string {
+	return filepath.Join(cfg.CacheDir, "stack.json")
+}
+
+// loadState reads what the last up started, or an empty state if no stack
+// is up
+func loadState(cfg *config.Config) (state, error) {
+	var s state
+	data, err := os.ReadFile(statePath(cfg))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading stack state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("parsing stack state %s: %w", statePath(cfg), err)
+	}
+	return s, nil
+}
+
+// saveState records what an up started
+func saveState(cfg *config.Config, s state) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding stack state: %w", err)
+	}
+	if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	if err := os.WriteFile(statePath(cfg), data, 0644); err != nil {
+		return fmt.Errorf("writing stack state: %w", err)
+	}
+	return nil
+}
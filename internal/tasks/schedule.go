@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a task runs: either at a fixed interval
+// ("every 2h"), once a day ("daily 08:00"), or once a week ("weekly mon 09:30")
+type Schedule struct {
+	Every   time.Duration
+	Hour    int
+	Minute  int
+	Weekday time.Weekday
+	Weekly  bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses a schedule expression
+func ParseSchedule(expr string) (Schedule, error) {
+	fields := strings.Fields(strings.ToLower(expr))
+	if len(fields) == 0 {
+		return Schedule{}, fmt.Errorf("empty schedule")
+	}
+
+	switch fields[0] {
+	case "hourly":
+		return Schedule{Every: time.Hour}, nil
+
+	case "every":
+		if len(fields) != 2 {
+			return Schedule{}, fmt.Errorf("expected 'every <duration>', got %q", expr)
+		}
+		every, err := time.ParseDuration(fields[1])
+		if err != nil || every < time.Minute {
+			return Schedule{}, fmt.Errorf("invalid interval %q (minimum 1m)", fields[1])
+		}
+		return Schedule{Every: every}, nil
+
+	case "daily":
+		if len(fields) != 2 {
+			return Schedule{}, fmt.Errorf("expected 'daily HH:MM', got %q", expr)
+		}
+		hour, minute, err := parseClock(fields[1])
+		if err != nil {
+			return Schedule{}, err
+		}
+		return Schedule{Hour: hour, Minute: minute}, nil
+
+	case "weekly":
+		if len(fields) != 3 {
+			return Schedule{}, fmt.Errorf("expected 'weekly <day> HH:MM', got %q", expr)
+		}
+		day, ok := weekdays[fields[1][:min(3, len(fields[1]))]]
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid weekday %q", fields[1])
+		}
+		hour, minute, err := parseClock(fields[2])
+		if err != nil {
+			return Schedule{}, err
+		}
+		return Schedule{Hour: hour, Minute: minute, Weekday: day, Weekly: true}, nil
+	}
+
+	return Schedule{}, fmt.Errorf("unknown schedule %q", expr)
+}
+
+// parseClock parses an HH:MM time of day
+func parseClock(clock string) (int, int, error) {
+	hourStr, minuteStr, ok := strings.Cut(clock, ":")
+	hour, errH := strconv.Atoi(hourStr)
+	minute, errM := strconv.Atoi(minuteStr)
+	if !ok || errH != nil || errM != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", clock)
+	}
+	return hour, minute, nil
+}
+
+// previous returns the latest scheduled time at or before now for
+// daily and weekly schedules
+func (s Schedule) previous(now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), s.Hour, s.Minute, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	if s.Weekly {
+		for t.Weekday() != s.Weekday {
+			t = t.AddDate(0, 0, -1)
+		}
+	}
+	return t
+}
+
+// Due reports whether a task last run at lastRun (zero if never) should run now
+func (s Schedule) Due(lastRun, now time.Time) bool {
+	if s.Every > 0 {
+		return lastRun.IsZero() || !now.Before(lastRun.Add(s.Every))
+	}
+	return lastRun.Before(s.previous(now))
+}
+
+// Next returns when the task will next become due
+func (s Schedule) Next(lastRun, now time.Time) time.Time {
+	if s.Every > 0 {
+		if lastRun.IsZero() {
+			return now
+		}
+		return lastRun.Add(s.Every)
+	}
+	if s.Due(lastRun, now) {
+		return now
+	}
+
+	step := 1
+	if s.Weekly {
+		step = 7
+	}
+	return s.previous(now).AddDate(0, 0, step)
+}
@@ -0,0 +1,218 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/post"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// findTask looks up a configured task by name
+func findTask(cfg *config.Config, name string) (*config.TaskConfig, error) {
+	for i := range cfg.Tasks {
+		if cfg.Tasks[i].Name == name {
+			return &cfg.Tasks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no task named '%s' in %s", name, cfg.ConfigPath)
+}
+
+// List displays the configured tasks with their last and next runs
+func List(store *db.Store, cfg *config.Config) error {
+	if len(cfg.Tasks) == 0 {
+		fmt.Printf("No tasks configured. Add them to the \"tasks\" section of %s\n", cfg.ConfigPath)
+		return nil
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tMODEL\tLAST RUN\tSTATUS\tNEXT RUN")
+
+	for _, task := range cfg.Tasks {
+		lastRun, status := "Never", "-"
+		next := "invalid schedule"
+
+		run, err := store.GetLastTaskRun(task.Name)
+		if err != nil {
+			return err
+		}
+		var lastTime time.Time
+		if run != nil {
+			lastTime = run.StartedAt
+			lastRun = run.StartedAt.Local().Format("2006-01-02 15:04")
+			status = run.Status
+		}
+
+		if schedule, err := ParseSchedule(task.Schedule); err == nil {
+			next = schedule.Next(lastTime, now).Local().Format("2006-01-02 15:04")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", task.Name, task.Schedule, task.Model, lastRun, status, next)
+	}
+
+	return w.Flush()
+}
+
+// RunNow runs a task immediately, regardless of its schedule
+func RunNow(store *db.Store, cfg *config.Config, name string) error {
+	task, err := findTask(cfg, name)
+	if err != nil {
+		return err
+	}
+	return execute(store, cfg, task, nil)
+}
+
+// RunDue runs every task whose schedule says it is due. It is meant to be
+// called periodically, e.g. from cron or launchd; the daemon runs them
+// itself with RunScheduled.
+func RunDue(store *db.Store, cfg *config.Config) error {
+	ran, err := runDue(store, cfg, nil)
+	if err != nil {
+		return err
+	}
+	if ran == 0 {
+		ui.PrintInfo("No tasks are due.")
+	}
+	return nil
+}
+
+// RunScheduled is RunDue for the daemon, which calls it every minute, so
+// it says nothing when no task is due. ensure starts the tasks' models
+// under the daemon itself.
+func RunScheduled(store *db.Store, cfg *config.Config, ensure server.EnsureFunc) {
+	if _, err := runDue(store, cfg, ensure); err != nil {
+		ui.PrintWarn(fmt.Sprintf("Running scheduled tasks: %v", err))
+	}
+}
+
+// runDue runs the tasks that are due and returns how many it ran
+func runDue(store *db.Store, cfg *config.Config, ensure server.EnsureFunc) (int, error) {
+	now := time.Now()
+	ran := 0
+
+	for i := range cfg.Tasks {
+		task := &cfg.Tasks[i]
+
+		schedule, err := ParseSchedule(task.Schedule)
+		if err != nil {
+			ui.PrintWarn(fmt.Sprintf("Skipping task %s: %v", task.Name, err))
+			continue
+		}
+
+		run, err := store.GetLastTaskRun(task.Name)
+		if err != nil {
+			return ran, err
+		}
+		var lastRun time.Time
+		if run != nil {
+			lastRun = run.StartedAt
+		}
+
+		if !schedule.Due(lastRun, now) {
+			continue
+		}
+
+		ran++
+		if err := execute(store, cfg, task, ensure); err != nil {
+			ui.PrintError(fmt.Sprintf("Task %s failed: %v", task.Name, err))
+		}
+	}
+
+	return ran, nil
+}
+
+// execute runs a task and records the outcome. ensure starts the task's
+// model, or when nil it is started as any command would.
+func execute(store *db.Store, cfg *config.Config, task *config.TaskConfig, ensure server.EnsureFunc) error {
+	ui.PrintInfo(fmt.Sprintf("Running task %s with model %s...", task.Name, task.Model))
+
+	runID, err := store.StartTaskRun(task.Name)
+	if err != nil {
+		return err
+	}
+
+	err = runTask(store, cfg, task, ensure)
+
+	status, message := "ok", ""
+	if err != nil {
+		status, message = "failed", err.Error()
+	}
+	if recordErr := store.FinishTaskRun(runID, status, message); recordErr != nil {
+		ui.PrintWarn(fmt.Sprintf("Failed to record task run: %v", recordErr))
+	}
+
+	if err == nil {
+		ui.PrintInfo(fmt.Sprintf("Task %s finished; output written to %s", task.Name, task.Output))
+	}
+	return err
+}
+
+// runTask builds the prompt, completes it and writes the result
+func runTask(store *db.Store, cfg *config.Config, task *config.TaskConfig, ensure server.EnsureFunc) error {
+	prompt := task.Prompt
+	if task.Input != "" {
+		input, err := os.ReadFile(expandHome(task.Input))
+		if err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+		prompt = strings.TrimSpace(prompt) + "\n\n" + string(input)
+	}
+
+	pipeline, err := post.ForCommand(cfg, "tasks", task.Post)
+	if err != nil {
+		return err
+	}
+	var result string
+	if ensure != nil {
+		result, err = server.CompleteWith(store, cfg, task.Model, prompt, ensure)
+	} else {
+		result, err = server.Complete(store, cfg, task.Model, prompt)
+	}
+	if err != nil {
+		return err
+	}
+	if result, err = pipeline.Apply(result); err != nil {
+		return err
+	}
+
+	output := expandHome(task.Output)
+	if output == "" {
+		fmt.Println(result)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+
+	if !task.Append {
+		return os.WriteFile(output, []byte(strings.TrimSpace(result)+"\n"), 0644)
+	}
+
+	file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening output: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "## %s — %s\n\n%s\n\n", task.Name, time.Now().Format("2006-01-02 15:04"), strings.TrimSpace(result))
+	return err
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
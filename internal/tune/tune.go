@@ -0,0 +1,222 @@
+package tune
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// benchPrompt is completed for every combination so results are comparable
+const benchPrompt = "Write a detailed explanation of how a hash map works, including collision handling and resizing."
+
+// Options controls a tuning run
+type Options struct {
+	Grid      string // "ctx=4096,8192;ngl=0,32,99"
+	NPredict  int    // tokens generated per benchmark
+	MaxMemory int64  // combinations using more resident memory are not recommended (0 = no limit)
+	Apply     bool   // store the recommended combination as the model's settings
+}
+
+// param is one grid dimension
+type param struct {
+	name   string
+	values []string
+}
+
+// result is the outcome of benchmarking one combination
+type result struct {
+	combo  map[string]string
+	label  string
+	timing *server.Timings
+	memory int64
+	err    error
+}
+
+// Run benchmarks a model across every combination of the grid, restarting
+// the server for each, records the results and recommends the fastest
+// combination within the memory limit
+func Run(store *db.Store, cfg *config.Config, slug string, opts Options) error {
+	model, err := store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+
+	params, err := parseGrid(opts.Grid)
+	if err != nil {
+		return err
+	}
+	combos := expand(params)
+	ui.PrintInfo(fmt.Sprintf("Benchmarking %d combinations for %s...", len(combos), slug))
+
+	var results []result
+	for i, combo := range combos {
+		r := result{combo: combo, label: comboLabel(params, combo)}
+		ui.PrintInfo(fmt.Sprintf("[%d/%d] %s", i+1, len(combos), r.label))
+
+		var modelCfg *config.Config
+		pid, err := server.StartServer(store, cfg, slug, combo)
+		if err == nil {
+			modelCfg, err = server.ModelConfig(store, cfg, slug)
+		}
+		if err == nil {
+			// Warm up once so model loading doesn't skew the first measurement
+			if _, err = server.CompleteTimed(modelCfg, "Hello", 8); err == nil {
+				r.timing, err = server.CompleteTimed(modelCfg, benchPrompt, opts.NPredict)
+			}
+			if err == nil {
+				r.memory, _ = server.ProcessMemory(pid)
+			}
+		}
+		r.err = err
+		if err != nil {
+			ui.PrintWarn(fmt.Sprintf("%s failed: %v", r.label, err))
+		}
+
+		record := db.TuneResult{Slug: slug, Params: r.label, MemoryBytes: r.memory, Status: "ok"}
+		if r.timing != nil {
+			record.PromptTPS, record.GenTPS = r.timing.PromptPerSecond, r.timing.PredictedPerSecond
+		}
+		if r.err != nil {
+			record.Status = "failed"
+		}
+		if err := store.AddTuneResult(record); err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+
+	// Leave no tuning server behind; the next use starts with the stored settings
+	if err := server.StopServer(store, cfg, model.FilePath); err != nil {
+		ui.PrintWarn(err.Error())
+	}
+
+	best := printResults(results, opts.MaxMemory)
+	if best == nil {
+		return fmt.Errorf("no combination completed within the limits")
+	}
+
+	ui.PrintInfo(fmt.Sprintf("Recommended: %s (%.1f tokens/s)", best.label, best.timing.PredictedPerSecond))
+	if !opts.Apply {
+		var args []string
+		for _, p := range params {
+			args = append(args, fmt.Sprintf("llm-cli set %s %s %s", slug, p.name, best.combo[p.name]))
+		}
+		fmt.Printf("To use it, run: %s\n", strings.Join(args, " && "))
+		return nil
+	}
+
+	if err := store.SetModelSettings(slug, best.combo); err != nil {
+		return err
+	}
+	ui.PrintInfo(fmt.Sprintf("Saved as the settings for %s.", slug))
+	return nil
+}
+
+// parseGrid parses "key=v1,v2;key2=v3" into grid dimensions of server settings
+func parseGrid(grid string) ([]param, error) {
+	var params []param
+	for _, part := range strings.Split(grid, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, list, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid grid entry %q, expected key=v1,v2", part)
+		}
+		setting, ok := server.LookupSetting(strings.TrimSpace(key))
+		if !ok || !setting.Server {
+			return nil, fmt.Errorf("%s is not a server setting that can be tuned", key)
+		}
+
+		p := param{name: setting.Name}
+		for _, value := range strings.Split(list, ",") {
+			value = strings.TrimSpace(value)
+			if err := setting.Validate(value); err != nil {
+				return nil, err
+			}
+			p.values = append(p.values, value)
+		}
+		params = append(params, p)
+	}
+
+	if len(params) == 0 {
+		return nil, fmt.Errorf("empty grid")
+	}
+	return params, nil
+}
+
+// expand returns every combination of the grid's values
+func expand(params []param) []map[string]string {
+	combos := []map[string]string{{}}
+	for _, p := range params {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, value := range p.values {
+				c := make(map[string]string, len(combo)+1)
+				for k, v := range combo {
+					c[k] = v
+				}
+				c[p.name] = value
+				next = append(next, c)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// comboLabel formats a combination in grid order
+func comboLabel(params []param, combo map[string]string) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.name + "=" + combo[p.name]
+	}
+	return strings.Join(parts, " ")
+}
+
+// printResults prints the results fastest first and returns the fastest
+// successful one within maxMemory
+func printResults(results []result, maxMemory int64) *result {
+	sort.SliceStable(results, func(i, j int) bool {
+		return generationSpeed(results[i]) > generationSpeed(results[j])
+	})
+
+	var best *result
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARAMS\tPROMPT T/S\tGEN T/S\tMEMORY\tSTATUS")
+	for i := range results {
+		r := &results[i]
+		if r.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\tfailed\n", r.label)
+			continue
+		}
+
+		status := "ok"
+		if maxMemory > 0 && r.memory > maxMemory {
+			status = "over memory limit"
+		} else if best == nil {
+			best = r
+			status = "recommended"
+		}
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%dM\t%s\n", r.label, r.timing.PromptPerSecond, r.timing.PredictedPerSecond, r.memory/(1024*1024), status)
+	}
+	w.Flush()
+	return best
+}
+
+// generationSpeed is the sort key of a result; failures sort last
+func generationSpeed(r result) float64 {
+	if r.err != nil || r.timing == nil {
+		return -1
+	}
+	return r.timing.PredictedPerSecond
+}
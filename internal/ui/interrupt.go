@@ -0,0 +1,21 @@
+package ui
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Interruptible returns a context that Ctrl-C or SIGTERM cancels, for work
+// that should stop cleanly rather than die part way through, and a function
+// that restores the default handling. Once the context is cancelled, a
+// second Ctrl-C ends the program at once.
+func Interruptible(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
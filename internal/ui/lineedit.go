@@ -0,0 +1,424 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrInterrupted is returned by LineReader.ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// blockDelimiter starts and ends a message of several lines typed at the
+// prompt, as in Python
+const blockDelimiter = `"""`
+
+// Bracketed paste mode makes the terminal mark pasted text, so the newlines
+// in it are kept instead of sending the message
+const (
+	pasteOn    = "\x1b[?2004h"
+	pasteOff   = "\x1b[?2004l"
+	pasteStart = "[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// LineReader reads messages typed at a prompt. On a terminal it edits the
+// line in place, recalls earlier messages with the arrow keys and keeps the
+// newlines of pasted text. Alt-Enter starts a new line, as does a message
+// opened with """, which ends at a line of """. Elsewhere, and in
+// accessibility mode, it reads a line at a time.
+type LineReader struct {
+	in      *bufio.Reader
+	history []string
+}
+
+// NewLineReader reads from stdin, with history as the messages the up
+// arrow recalls first, oldest first
+func NewLineReader(history []string) *LineReader {
+	return &LineReader{in: bufio.NewReader(os.Stdin), history: append([]string{}, history...)}
+}
+
+// ReadLine reads a message typed after a prompt indent columns wide. It
+// returns io.EOF at the end of the input or on Ctrl-D at an empty prompt,
+// and ErrInterrupted on Ctrl-C.
+func (r *LineReader) ReadLine(indent int) (string, error) {
+	if !accessible && IsInteractive() {
+		if restore, ok := rawTerminal(); ok {
+			defer restore()
+			line, err := r.edit(indent)
+			if err == nil && strings.TrimSpace(line) != "" {
+				r.history = append(r.history, line)
+			}
+			return line, err
+		}
+	}
+	return r.readPlain()
+}
+
+// readPlain reads a line, or the lines of a block opened with """
+func (r *LineReader) readPlain() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(strings.TrimSpace(line), blockDelimiter) {
+		return line, nil
+	}
+
+	text := strings.TrimSpace(line)
+	for !blockComplete(text) {
+		next, err := r.in.ReadString('\n')
+		if err != nil && next == "" {
+			return "", err
+		}
+		text += "\n" + strings.TrimRight(next, "\r\n")
+	}
+	return blockText(text), nil
+}
+
+// blockComplete reports whether a message opened with """ has been closed
+func blockComplete(text string) bool {
+	return len(text) >= 2*len(blockDelimiter) && strings.HasSuffix(text, blockDelimiter)
+}
+
+// blockText returns a message opened and closed with """ without them
+func blockText(text string) string {
+	text = strings.TrimPrefix(text, blockDelimiter)
+	text = strings.TrimSuffix(text, blockDelimiter)
+	return strings.Trim(text, "\r\n")
+}
+
+// rawTerminal turns off line buffering, echo and signals on the terminal,
+// so keys arrive as they are pressed, and returns a function that restores
+// it. ok is false where stty isn't available, as on Windows.
+func rawTerminal() (restore func(), ok bool) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "-ixon", "min", "1", "time", "0"); err != nil {
+		stty(strings.TrimSpace(saved))
+		return nil, false
+	}
+	fmt.Print(pasteOn)
+	return func() {
+		fmt.Print(pasteOff)
+		stty(strings.TrimSpace(saved))
+	}, true
+}
+
+// stty runs stty on the terminal and returns its output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// terminalWidth returns the width of the terminal in columns, or 80 if it
+// can't be found
+func terminalWidth() int {
+	out, err := stty("size")
+	if err == nil {
+		var rows, cols int
+		if _, err := fmt.Sscan(out, &rows, &cols); err == nil && cols > 0 {
+			return cols
+		}
+	}
+	return 80
+}
+
+// lineEditor is the state of a message being edited
+type lineEditor struct {
+	buf    []rune
+	pos    int // cursor position in buf
+	width  int // of the terminal
+	indent int // columns taken by the prompt on the first row
+	row    int // screen row of the cursor, counted from the first row of the message
+	recall int // index of the history entry shown; len(history) for the draft
+	draft  string
+}
+
+// edit reads a message on a terminal in raw mode
+func (r *LineReader) edit(indent int) (string, error) {
+	e := &lineEditor{width: terminalWidth(), indent: indent, recall: len(r.history)}
+	for {
+		c, _, err := r.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\r', '\n':
+			text := string(e.buf)
+			if strings.HasPrefix(text, blockDelimiter) && !blockComplete(text) {
+				e.insert("\n")
+				continue
+			}
+			e.pos = len(e.buf)
+			e.redraw()
+			fmt.Print("\n")
+			if strings.HasPrefix(text, blockDelimiter) {
+				return blockText(text), nil
+			}
+			return text, nil
+		case 3: // Ctrl-C
+			fmt.Print("\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				fmt.Print("\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case 127, 8: // Backspace
+			e.delete(e.pos-1, e.pos)
+		case 1: // Ctrl-A
+			e.move(e.lineStart())
+		case 5: // Ctrl-E
+			e.move(e.lineEnd())
+		case 2: // Ctrl-B
+			e.move(e.pos - 1)
+		case 6: // Ctrl-F
+			e.move(e.pos + 1)
+		case 11: // Ctrl-K
+			e.delete(e.pos, e.lineEnd())
+		case 21: // Ctrl-U
+			e.delete(e.lineStart(), e.pos)
+		case 23: // Ctrl-W
+			e.delete(e.wordStart(), e.pos)
+		case 16: // Ctrl-P
+			e.browse(r.history, -1)
+		case 14: // Ctrl-N
+			e.browse(r.history, 1)
+		case 27:
+			if err := r.escape(e); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\t' || c >= ' ' {
+				e.insert(string(c))
+			}
+		}
+	}
+}
+
+// escape handles the keys that send escape sequences: the arrows, Home,
+// End, Delete, Alt-Enter and pasted text
+func (r *LineReader) escape(e *lineEditor) error {
+	c, _, err := r.in.ReadRune()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '\r', '\n': // Alt-Enter
+		e.insert("\n")
+		return nil
+	case '[', 'O':
+	default:
+		return nil
+	}
+
+	// Control sequences end with a letter or ~
+	seq := string(c)
+	for {
+		c, _, err := r.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		seq += string(c)
+		if c == '~' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' {
+			break
+		}
+	}
+	switch seq {
+	case pasteStart:
+		return r.paste(e)
+	case "[A", "OA":
+		if e.lineStart() > 0 {
+			e.vertical(-1)
+		} else {
+			e.browse(r.history, -1)
+		}
+	case "[B", "OB":
+		if e.lineEnd() < len(e.buf) {
+			e.vertical(1)
+		} else {
+			e.browse(r.history, 1)
+		}
+	case "[C", "OC":
+		e.move(e.pos + 1)
+	case "[D", "OD":
+		e.move(e.pos - 1)
+	case "[H", "OH", "[1~", "[7~":
+		e.move(e.lineStart())
+	case "[F", "OF", "[4~", "[8~":
+		e.move(e.lineEnd())
+	case "[3~":
+		e.delete(e.pos, e.pos+1)
+	}
+	return nil
+}
+
+// paste inserts pasted text, newlines included, up to the end of the paste
+func (r *LineReader) paste(e *lineEditor) error {
+	var text strings.Builder
+	for !strings.HasSuffix(text.String(), pasteEnd) {
+		c, _, err := r.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		text.WriteRune(c)
+	}
+	pasted := strings.TrimSuffix(text.String(), pasteEnd)
+	pasted = strings.ReplaceAll(pasted, "\r\n", "\n")
+	e.insert(strings.ReplaceAll(pasted, "\r", "\n"))
+	return nil
+}
+
+// insert adds text at the cursor
+func (e *lineEditor) insert(text string) {
+	runes := []rune(text)
+	e.buf = append(e.buf[:e.pos], append(runes, e.buf[e.pos:]...)...)
+	e.pos += len(runes)
+	e.redraw()
+}
+
+// delete removes the text from start to end, clamped to the message
+func (e *lineEditor) delete(start, end int) {
+	start, end = max(start, 0), min(end, len(e.buf))
+	if start >= end {
+		return
+	}
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	e.pos = start
+	e.redraw()
+}
+
+// move puts the cursor at pos, clamped to the message
+func (e *lineEditor) move(pos int) {
+	e.pos = min(max(pos, 0), len(e.buf))
+	e.redraw()
+}
+
+// lineStart returns where the line the cursor is on starts
+func (e *lineEditor) lineStart() int {
+	for i := e.pos; i > 0; i-- {
+		if e.buf[i-1] == '\n' {
+			return i
+		}
+	}
+	return 0
+}
+
+// lineEnd returns where the line the cursor is on ends
+func (e *lineEditor) lineEnd() int {
+	for i := e.pos; i < len(e.buf); i++ {
+		if e.buf[i] == '\n' {
+			return i
+		}
+	}
+	return len(e.buf)
+}
+
+// wordStart returns where the word before the cursor starts
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && e.buf[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && e.buf[i-1] != ' ' && e.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// vertical moves the cursor to the line above (-1) or below (1), keeping
+// its column where the line is long enough
+func (e *lineEditor) vertical(direction int) {
+	column := e.pos - e.lineStart()
+	if direction < 0 {
+		// From the end of the line above to its start
+		e.pos = e.lineStart() - 1
+		e.pos = e.lineStart()
+	} else {
+		e.pos = e.lineEnd() + 1
+	}
+	e.move(min(e.pos+column, e.lineEnd()))
+}
+
+// browse replaces the message with an earlier (-1) or later (1) one from
+// history, keeping what was typed to come back to after the newest
+func (e *lineEditor) browse(history []string, direction int) {
+	next := e.recall + direction
+	if next < 0 || next > len(history) {
+		return
+	}
+	if e.recall == len(history) {
+		e.draft = string(e.buf)
+	}
+	e.recall = next
+	text := e.draft
+	if next < len(history) {
+		text = history[next]
+	}
+	e.buf = []rune(text)
+	e.pos = len(e.buf)
+	e.redraw()
+}
+
+// position returns the screen row and column, from the start of the
+// message, at which the first n runes of the message end
+func (e *lineEditor) position(n int) (row, col int) {
+	col = e.indent
+	for _, c := range e.buf[:n] {
+		switch c {
+		case '\n':
+			row, col = row+1, 0
+			continue
+		case '\t':
+			col += 8 - col%8
+		default:
+			col++
+		}
+		if col >= e.width {
+			row, col = row+1, 0
+		}
+	}
+	return row, col
+}
+
+// redraw prints the message again from its first row, leaving the cursor
+// at its position
+func (e *lineEditor) redraw() {
+	var out strings.Builder
+	if e.row > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", e.row)
+	}
+	out.WriteString("\r")
+	if e.indent > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", e.indent)
+	}
+	out.WriteString("\x1b[J")
+	out.WriteString(string(e.buf))
+
+	endRow, endCol := e.position(len(e.buf))
+	if endCol == 0 && endRow > 0 && e.buf[len(e.buf)-1] != '\n' {
+		// The terminal waits for the next character before wrapping
+		out.WriteString("\n")
+	}
+	row, col := e.position(e.pos)
+	if endRow > row {
+		fmt.Fprintf(&out, "\x1b[%dA", endRow-row)
+	}
+	out.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", col)
+	}
+	e.row = row
+	fmt.Print(out.String())
+}
@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// logLevel is the least severe level printed: info by default, debug with
+// --verbose and error with --quiet
+var logLevel = new(slog.LevelVar)
+
+// logger prints status messages where messages sends them
+var logger = slog.New(&messageHandler{})
+
+// Logger returns the logger behind PrintInfo, PrintWarn and PrintError, for
+// programs that use llm-cli as a library and want to add to its messages
+func Logger() *slog.Logger {
+	return logger
+}
+
+// SetVerbose also prints debug messages: the HTTP requests llm-cli makes,
+// with their responses, and the commands it runs
+func SetVerbose() {
+	logLevel.Set(slog.LevelDebug)
+}
+
+// SetQuiet prints only errors, leaving the output of the command itself.
+// Progress isn't drawn either.
+func SetQuiet() {
+	logLevel.Set(slog.LevelError)
+}
+
+// Verbose reports whether debug messages are printed
+func Verbose() bool {
+	return logLevel.Level() <= slog.LevelDebug
+}
+
+// Quiet reports whether only errors are printed
+func Quiet() bool {
+	return logLevel.Level() >= slog.LevelError
+}
+
+// Debug prints a message shown only with --verbose, followed by its
+// key-value pairs
+func Debug(msg string, args ...any) {
+	logger.Debug(msg, args...)
+}
+
+// LogCommand prints a command about to be run, with --verbose
+func LogCommand(cmd *exec.Cmd) {
+	if Verbose() {
+		logger.Debug("Running command", "command", cmd.String())
+	}
+}
+
+// LoggingTransport wraps an HTTP transport to print each request and its
+// response with --verbose. Headers and bodies, which can hold tokens and
+// prompts, are left out.
+func LoggingTransport(next http.RoundTripper) http.RoundTripper {
+	return &loggingTransport{next: next}
+}
+
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Verbose() {
+		return t.next.RoundTrip(req)
+	}
+	target := req.URL.Redacted()
+	logger.Debug("HTTP request", "method", req.Method, "url", target)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	took := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		logger.Debug("HTTP request failed", "url", target, "error", err, "took", took)
+		return nil, err
+	}
+	logger.Debug("HTTP response", "url", target, "status", resp.Status, "length", resp.ContentLength, "took", took)
+	return resp, nil
+}
+
+// messageHandler prints log records in the [INFO] style of llm-cli's
+// status messages, with any attributes as key=value pairs after them
+type messageHandler struct {
+	attrs []slog.Attr
+}
+
+// levelLabels are the label and color of each level
+var levelLabels = map[slog.Level][2]string{
+	slog.LevelDebug: {"DEBUG", colorGray},
+	slog.LevelInfo:  {"INFO", colorGreen},
+	slog.LevelWarn:  {"WARN", colorYellow},
+	slog.LevelError: {"ERROR", "\033[0;31m"},
+}
+
+func (h *messageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *messageHandler) Handle(_ context.Context, record slog.Record) error {
+	label, ok := levelLabels[record.Level]
+	if !ok {
+		label = [2]string{record.Level.String(), colorReset}
+	}
+	var line strings.Builder
+	fmt.Fprintf(&line, "%s[%s]%s %s", label[1], label[0], colorReset, record.Message)
+	write := func(attr slog.Attr) bool {
+		fmt.Fprintf(&line, " %s=%s", attr.Key, quoteValue(attr.Value.String()))
+		return true
+	}
+	for _, attr := range h.attrs {
+		write(attr)
+	}
+	record.Attrs(write)
+	line.WriteString("\n")
+	_, err := fmt.Fprint(messages, line.String())
+	return err
+}
+
+func (h *messageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &messageHandler{attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+// WithGroup is not supported; grouped attributes are printed ungrouped
+func (h *messageHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// quoteValue quotes attribute values with spaces, so lines stay parseable
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return fmt.Sprintf("%q", value)
+	}
+	return value
+}
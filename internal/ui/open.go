@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// OpenPath opens a directory in the platform's file manager, or a file in
+// $VISUAL or $EDITOR when set and otherwise in its default application
+func OpenPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if editor := editorSetting(); editor != "" {
+			return runEditor(editor, path)
+		}
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		// The empty argument is the window title start expects before the path
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+
+	if _, err := exec.LookPath(cmd.Path); err != nil {
+		return fmt.Errorf("no way to open files found (%s is not installed); the path is %s", cmd.Args[0], path)
+	}
+	LogCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	return nil
+}
+
+// EditText opens text in $VISUAL or $EDITOR, or vi (notepad on Windows) when
+// neither is set, and returns it as saved once the editor exits
+func EditText(text string) (string, error) {
+	f, err := os.CreateTemp("", "llm-cli-*.md")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing temporary file: %w", err)
+	}
+
+	editor := editorSetting()
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	if err := runEditor(editor, f.Name()); err != nil {
+		return "", err
+	}
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("reading edited text: %w", err)
+	}
+	return string(edited), nil
+}
+
+// editorSetting returns the user's editor command from $VISUAL or $EDITOR
+func editorSetting() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	return os.Getenv("EDITOR")
+}
+
+// runEditor opens path in editor and waits for it to exit
+func runEditor(editor, path string) error {
+	// The editor may include arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	LogCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// accessibleInterval is how often progress of unknown extent is reported
+// in accessibility mode
+const accessibleInterval = 10 * time.Second
+
+// Progress reports the progress of a long task. On a terminal it is one
+// line rewritten in place; in accessibility mode it is a sentence on a line
+// of its own each time the task is another tenth of the way done.
+type Progress struct {
+	w      io.Writer
+	shown  bool      // the line has been drawn and not ended
+	tenths int       // tenths done when last reported in accessibility mode
+	last   time.Time // when last reported in accessibility mode
+}
+
+// NewProgress creates a Progress writing to w, or where SetOutput sends
+// output if it was called
+func NewProgress(w io.Writer) *Progress {
+	if progressOutput != nil {
+		w = progressOutput
+	}
+	return &Progress{w: w}
+}
+
+// Update shows the progress of a task fraction of the way done, or of
+// unknown extent when fraction is negative. line is drawn on the
+// terminal and sentence is printed in accessibility mode, e.g.
+// "1.2 GB / 3.0 GB (40.0%)" and "Downloaded 40% (1.2 GB of 3.0 GB).".
+func (p *Progress) Update(fraction float64, line, sentence string) {
+	if Quiet() {
+		return
+	}
+	if !accessible {
+		fmt.Fprintf(p.w, "\r%s", line)
+		p.shown = true
+		return
+	}
+
+	if fraction < 0 {
+		if time.Since(p.last) < accessibleInterval {
+			return
+		}
+	} else {
+		tenths := int(min(fraction, 1) * 10)
+		if tenths <= p.tenths {
+			return
+		}
+		p.tenths = tenths
+	}
+	p.last = time.Now()
+	fmt.Fprintln(p.w, sentence)
+}
+
+// Done ends the progress line
+func (p *Progress) Done() {
+	if p.shown {
+		fmt.Fprintln(p.w)
+		p.shown = false
+	}
+}
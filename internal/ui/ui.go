@@ -1,7 +1,12 @@
 package ui
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
 )
 
 // Color constants
@@ -14,19 +19,140 @@ const (
 	colorGray    = "\033[0;90m"
 )
 
-// PrintInfo prints an info message
+// messages is where status messages are printed
+var messages io.Writer = os.Stdout
+
+// MessagesToStderr prints status messages and progress on stderr, keeping
+// stdout for output meant to be piped, such as JSON
+func MessagesToStderr() {
+	messages = os.Stderr
+	progressOutput = os.Stderr
+}
+
+// progressOutput, when set, is where progress is drawn instead of the
+// writer it was created with
+var progressOutput io.Writer
+
+// SetOutput sends status messages and progress to w, for programs that use
+// llm-cli as a library and have output of their own
+func SetOutput(w io.Writer) {
+	messages = w
+	progressOutput = w
+}
+
+// Messages returns where status messages are printed, which with --quiet
+// is nowhere
+func Messages() io.Writer {
+	if Quiet() {
+		return io.Discard
+	}
+	return messages
+}
+
+// accessible is whether output is plain sequential text for screen readers
+var accessible bool
+
+// SetAccessible switches to output that screen readers can follow: no
+// box-drawing characters, emoji or spinners, and no lines rewritten in
+// place. Progress is reported in sentences on lines of their own.
+func SetAccessible() {
+	accessible = true
+}
+
+// Accessible reports whether accessibility mode is on
+func Accessible() bool {
+	return accessible
+}
+
+// Rule prints a horizontal line width columns wide, except in
+// accessibility mode, where it would be read out character by character,
+// and with --quiet
+func Rule(width int) {
+	if !accessible && !Quiet() {
+		fmt.Println(strings.Repeat("─", width))
+	}
+}
+
+// PrintInfo prints an info message, unless --quiet was given
 func PrintInfo(msg string) {
-	fmt.Printf("%s[INFO]%s %s\n", colorGreen, colorReset, msg)
+	logger.Info(msg)
 }
 
-// PrintWarn prints a warning message
+// PrintWarn prints a warning message, unless --quiet was given
 func PrintWarn(msg string) {
-	fmt.Printf("%s[WARN]%s %s\n", colorYellow, colorReset, msg)
+	logger.Warn(msg)
 }
 
 // PrintError prints an error message
 func PrintError(msg string) {
-	fmt.Printf("%s[ERROR]%s %s\n", "\033[0;31m", colorReset, msg)
+	logger.Error(msg)
+}
+
+// Confirm asks a yes/no question on the terminal, defaulting to no
+func Confirm(question string) bool {
+	fmt.Printf("%s[CONFIRM]%s %s [y/N] ", colorYellow, colorReset, question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// ReadSecret prompts for a secret on the terminal without echoing it
+func ReadSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	hide := exec.Command("stty", "-echo")
+	hide.Stdin = os.Stdin
+	if err := hide.Run(); err == nil {
+		defer func() {
+			show := exec.Command("stty", "echo")
+			show.Stdin = os.Stdin
+			show.Run()
+			fmt.Println()
+		}()
+	}
+
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && secret == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(secret, "\r\n"), nil
+}
+
+// IsInteractive reports whether stdin is a terminal
+func IsInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Choose prints a numbered list of options and returns the index picked
+func Choose(question string, options []string) (int, error) {
+	fmt.Printf("%s[CHOOSE]%s %s\n", colorYellow, colorReset, question)
+	for i, option := range options {
+		fmt.Printf("  %s%2d)%s %s\n", colorCyan, i+1, colorReset, option)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Enter a number [1-%d]: ", len(options))
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return 0, fmt.Errorf("no selection made")
+		}
+
+		var choice int
+		if _, err := fmt.Sscanf(strings.TrimSpace(answer), "%d", &choice); err == nil && choice >= 1 && choice <= len(options) {
+			return choice - 1, nil
+		}
+		PrintWarn("Invalid selection.")
+	}
 }
 
 // PrintHelp prints help for a command
@@ -46,31 +172,97 @@ func PrintUsage() {
 	fmt.Printf("%sUsage:%s llm-cli %s<command>%s [options]\n\n", colorCyan, colorReset, colorGreen, colorReset)
 
 	fmt.Printf("%sModel Management:%s\n", colorYellow, colorReset)
-	printCommand("pull <model_id>", "Download a new model")
+	printCommand("pull <model_id>", "Download a new model (--quant to choose one)")
 	printCommand("rm <slug>", "Remove a model")
-	printCommand("ls", "List all models")
+	printCommand("du", "Show disk usage per model")
+	printCommand("prune --older-than <age>", "Remove models not used recently")
+	printCommand("convert <hf_model_id>", "Convert safetensors to a quantized GGUF model")
+	printCommand("gguf join <first-shard>", "Merge a split GGUF into one file")
+	printCommand("gguf split <file|slug>", "Split a GGUF file into shards")
+	printCommand("gguf set <file|slug>", "Edit GGUF metadata such as the chat template")
+	printCommand("ls [--tag <t>] [--sort]", "List all models")
+	printCommand("which <term>", "Find installed models by name or metadata")
+	printCommand("info <slug|file>", "Show GGUF metadata without starting a server")
+	printCommand("verify [slug...]", "Check model files against their SHA256")
+	printCommand("outdated", "List models changed on Hugging Face")
+	printCommand("upgrade <slug|all>", "Re-download models changed upstream")
+	printCommand("unquarantine <slug>", "Allow a crash-looping model to start again")
+	printCommand("tag <slug> [--rm] <tags>", "Tag a model, or remove its tags")
 	printCommand("alias <old> <new>", "Create an alias for a model")
+	printCommand("rename [--scheme <s>]", "Rename models with a slug scheme")
+	printCommand("relink <slug> <model_id>", "Follow a renamed Hugging Face repository")
 	printCommand("import", "Import existing models")
 	fmt.Println()
 
 	fmt.Printf("%sModel Operations:%s\n", colorYellow, colorReset)
-	printCommand("run <slug> [text]", "Run a model server and optionally complete text")
-	printCommand("chat <slug>", "Start a chat session")
+	printCommand("set <slug> <key> <value>", "Set a per-model server or sampling option")
+	printCommand("ctx <slug> [options]", "Show or set context size and RoPE scaling")
+	printCommand("tune <slug> --grid <grid>", "Benchmark server settings and pick the fastest")
+	printCommand("bench <slug> [options]", "Measure speed, first-token time and memory")
+	printCommand("bench results [slug...]", "Compare recorded benchmark results")
+	printCommand("run <slug> [text] [flags]", "Run a model server and optionally complete text")
+	printCommand("chat <slug> [--compact]", "Start a chat session")
+	printCommand("compare <slugs...> <prompt>", "Compare models' replies side by side")
+	printCommand("replay <file> [--model]", "Resend recorded requests and compare")
+	printCommand("prompt save <name> <tmpl>", "Save a reusable prompt template")
+	printCommand("prompt ls|show|rm", "List, print or remove saved prompts")
+	printCommand("sessions ls", "List saved chat sessions")
+	printCommand("sessions search <query>", "Search saved sessions and history")
+	printCommand("sessions export <name>", "Export a session (HTML, Markdown, JSON, OpenAI, ShareGPT)")
+	printCommand("sessions import <file>", "Import OpenAI or ShareGPT conversations")
+	printCommand("batch <slug> [options]", "Complete a JSONL file of prompts")
 	printCommand("embed <slug> <text>", "Generate embeddings")
+	printCommand("nearest <slug> [options]", "Rank lines of a file by similarity")
+	printCommand("bench-embed [options]", "Compare embedding models on a dataset")
+	printCommand("index add <name> <files>", "Embed files into a local vector store")
+	printCommand("index query <name> <text>", "Search an index collection by meaning")
+	printCommand("index inspect <name>", "Show how a file was chunked (--file)")
+	printCommand("dataset generate", "Generate fine-tuning pairs from seed prompts")
+	printCommand("mail summarize <slug>", "Summarize or reply to an email from stdin")
 	printCommand("tokenize <slug> <text>", "Tokenize text")
 	printCommand("detokenize <slug> <tokens>", "Detokenize text")
 	fmt.Println()
 
 	fmt.Printf("%sServer Information:%s\n", colorYellow, colorReset)
-	printCommand("health", "Check server health")
+	printCommand("health [--all] [--json]", "Check server health, or every server's")
 	printCommand("props", "Get server properties")
-	printCommand("ps", "Show running processes")
+	printCommand("ps [--watch]", "Show running processes")
+	printCommand("logs <slug> [-f]", "Print or follow a model's server log")
+	printCommand("serve [--port 8080]", "Serve an OpenAI-compatible API for the models")
+	printCommand("metrics [--output <file>]", "Print Prometheus metrics of running models")
+	printCommand("warmup <slug...>", "Load models ahead of use (--all-starred)")
+	printCommand("up [stack.yaml]", "Start the models declared in a stack file")
+	printCommand("down", "Stop the models the stack started")
 	printCommand("kill <slug|all>", "Kill a model server")
+	printCommand("daemon start|stop|status", "Supervise model servers in the background")
 	printCommand("reset", "Reset the database")
+	printCommand("purge --all-data", "Securely remove stored user data")
+	printCommand("config set <key> [value]", "Change a setting, e.g. hardware-profile")
+	printCommand("config profiles", "List hardware profiles")
+	printCommand("config snapshot <slug>", "Save a model's settings and template")
+	printCommand("config rollback <slug>", "Restore a model's saved settings")
+	printCommand("sync setup|push|pull", "Back up and sync the state across machines")
+	printCommand("open <logs|models|config>", "Open a directory or file")
+	printCommand("secrets <ls|set|rm>", "Manage API keys and tokens")
+	printCommand("login", "Store a Hugging Face token")
+	printCommand("logout", "Remove the stored Hugging Face token")
+	printCommand("sandbox <run|audit>", "Test the tool sandbox policy")
+	printCommand("tasks <ls|run-now|run-due>", "Manage scheduled tasks")
+	printCommand("search <query>", "Search Hugging Face for GGUF models")
 	printCommand("recent", "Get most recent GGUF models")
 	printCommand("trending", "Get trending GGUF models")
 	fmt.Println()
 
+	fmt.Printf("%sGlobal Options:%s\n", colorYellow, colorReset)
+	printCommand("--private", "Don't persist anything for this command")
+	printCommand("--keep-alive <duration>", "Stop a server started now after this idle time")
+	printCommand("--backend <name>", "Use a backend profile from the config file")
+	printCommand("--accessible", "Plain output for screen readers")
+	printCommand("--verbose", "Show HTTP requests and commands run")
+	printCommand("--quiet", "Show only command output and errors")
+	printCommand("--describe-commands", "Print all commands and flags as JSON")
+	fmt.Println()
+
 	fmt.Printf("%sFor more information, use:%s llm-cli %s<command> --help%s\n", 
 		colorMagenta, colorReset, colorGreen, colorReset)
 }
@@ -0,0 +1,207 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/secrets"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+const (
+	keySize   = 32
+	nonceSize = 24
+
+	// checkPlaintext is sealed into the meta table to detect a wrong key
+	checkPlaintext = "llm-cli vault check"
+)
+
+// Vault encrypts and decrypts data with NaCl secretbox
+type Vault struct {
+	key [keySize]byte
+}
+
+// New creates a vault from a 32-byte key
+func New(key [keySize]byte) *Vault {
+	return &Vault{key: key}
+}
+
+// Seal encrypts plaintext, prefixing the random nonce to the result
+func (v *Vault) Seal(plaintext []byte) ([]byte, error) {
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return secretbox.Seal(nonce[:], plaintext, &nonce, &v.key), nil
+}
+
+// Open decrypts data produced by Seal
+func (v *Vault) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < nonceSize+secretbox.Overhead {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], ciphertext[:nonceSize])
+
+	plaintext, ok := secretbox.Open(nil, ciphertext[nonceSize:], &nonce, &v.key)
+	if !ok {
+		return nil, fmt.Errorf("decryption failed (wrong key or corrupted data)")
+	}
+	return plaintext, nil
+}
+
+// Unlock returns the vault protecting stored sessions and history, loading
+// the key from the OS keychain or deriving it from a passphrase as configured
+func Unlock(cfg *config.Config, store *db.Store) (*Vault, error) {
+	var key [keySize]byte
+	var err error
+
+	switch cfg.Encryption.KeySource {
+	case "keychain":
+		key, err = keychainKey(cfg, store)
+	case "", "passphrase":
+		key, err = passphraseKey(store)
+	default:
+		return nil, fmt.Errorf("unknown encryption key source: %s", cfg.Encryption.KeySource)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := New(key)
+	if err := v.verify(store); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// verify checks the key against the stored check value, writing one on first use
+func (v *Vault) verify(store *db.Store) error {
+	check, err := store.GetMeta("vault_check")
+	if err != nil {
+		return err
+	}
+
+	if check == "" {
+		sealed, err := v.Seal([]byte(checkPlaintext))
+		if err != nil {
+			return err
+		}
+		return store.SetMeta("vault_check", hex.EncodeToString(sealed))
+	}
+
+	sealed, err := hex.DecodeString(check)
+	if err != nil {
+		return fmt.Errorf("decoding vault check: %w", err)
+	}
+	if _, err := v.Open(sealed); err != nil {
+		return fmt.Errorf("wrong encryption key or passphrase")
+	}
+	return nil
+}
+
+// Matches reports whether check, the stored check value of another
+// database, was sealed with the vault's key
+func (v *Vault) Matches(check string) bool {
+	sealed, err := hex.DecodeString(check)
+	if err != nil {
+		return false
+	}
+	_, err = v.Open(sealed)
+	return err == nil
+}
+
+// passphraseKey derives the key from LLM_CLI_PASSPHRASE or a terminal prompt
+func passphraseKey(store *db.Store) ([keySize]byte, error) {
+	var key [keySize]byte
+
+	salt, err := loadSalt(store)
+	if err != nil {
+		return key, err
+	}
+
+	passphrase := os.Getenv("LLM_CLI_PASSPHRASE")
+	if passphrase == "" {
+		passphrase, err = ui.ReadSecret("Passphrase for encrypted history: ")
+		if err != nil {
+			return key, fmt.Errorf("reading passphrase: %w", err)
+		}
+	}
+	if passphrase == "" {
+		return key, fmt.Errorf("an encryption passphrase is required")
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return key, fmt.Errorf("deriving key: %w", err)
+	}
+	copy(key[:], derived)
+	return key, nil
+}
+
+// loadSalt returns the scrypt salt stored in the database, creating it on first use
+func loadSalt(store *db.Store) ([]byte, error) {
+	stored, err := store.GetMeta("vault_salt")
+	if err != nil {
+		return nil, err
+	}
+	if stored != "" {
+		return hex.DecodeString(stored)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	if err := store.SetMeta("vault_salt", hex.EncodeToString(salt)); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// keychainKey loads the key from the secret store, generating and storing
+// one on first use. Once data has been sealed a missing key is an error:
+// a new one could never open it.
+func keychainKey(cfg *config.Config, store *db.Store) ([keySize]byte, error) {
+	var key [keySize]byte
+	secretStore := secrets.New(cfg)
+
+	stored, err := secretStore.Get(secrets.VaultKey)
+	if err != nil {
+		return key, err
+	}
+
+	if stored == "" {
+		check, err := store.GetMeta("vault_check")
+		if err != nil {
+			return key, err
+		}
+		if check != "" {
+			return key, fmt.Errorf("the encryption key is missing from the %s, and the stored history was encrypted with it", secretStore.Backend())
+		}
+		if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+			return key, fmt.Errorf("generating key: %w", err)
+		}
+		if err := secretStore.Set(secrets.VaultKey, hex.EncodeToString(key[:])); err != nil {
+			return key, err
+		}
+		ui.PrintInfo(fmt.Sprintf("Generated a new encryption key and stored it in the %s.", secretStore.Backend()))
+		return key, nil
+	}
+
+	decoded, err := hex.DecodeString(stored)
+	if err != nil || len(decoded) != keySize {
+		return key, fmt.Errorf("invalid encryption key in secret store")
+	}
+	copy(key[:], decoded)
+	return key, nil
+}
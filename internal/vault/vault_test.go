@@ -0,0 +1,146 @@
+package vault
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/secrets"
+)
+
+// testStore opens an empty database in a temporary directory
+func testStore(t *testing.T) *db.Store {
+	t.Helper()
+	store, err := db.New(filepath.Join(t.TempDir(), "llm-cli.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSealOpen(t *testing.T) {
+	v := New([keySize]byte{1, 2, 3})
+	plaintext := []byte("the conversation so far")
+
+	sealed, err := v.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Error("the sealed data holds the plaintext")
+	}
+	if again, _ := v.Seal(plaintext); bytes.Equal(again, sealed) {
+		t.Error("sealing twice gave the same data; the nonce isn't random")
+	}
+	opened, err := v.Open(sealed)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Open = %q, %v; want %q", opened, err, plaintext)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := v.Open(tampered); err == nil {
+		t.Error("Open accepted tampered data")
+	}
+	if _, err := v.Open(sealed[:nonceSize]); err == nil {
+		t.Error("Open accepted data shorter than a nonce and tag")
+	}
+	if _, err := New([keySize]byte{3, 2, 1}).Open(sealed); err == nil {
+		t.Error("Open with another key succeeded")
+	}
+}
+
+func TestUnlockPassphrase(t *testing.T) {
+	cfg := &config.Config{}
+	store := testStore(t)
+
+	t.Setenv("LLM_CLI_PASSPHRASE", "correct horse")
+	v, err := Unlock(cfg, store)
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	check, _ := store.GetMeta("vault_check")
+	if !v.Matches(check) {
+		t.Error("the stored check wasn't sealed with the vault's key")
+	}
+	if _, err := Unlock(cfg, store); err != nil {
+		t.Errorf("Unlock with the same passphrase: %v", err)
+	}
+
+	t.Setenv("LLM_CLI_PASSPHRASE", "wrong horse")
+	if _, err := Unlock(cfg, store); err == nil || !strings.Contains(err.Error(), "wrong encryption key") {
+		t.Errorf("Unlock with another passphrase = %v, want a wrong key error", err)
+	}
+}
+
+// TestStoreSealed checks sessions are stored sealed and only read back
+// with the right key
+func TestStoreSealed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm-cli.db")
+	open := func(v *Vault) *db.Store {
+		store, err := db.New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		if v != nil {
+			store.SetCipherProvider(func() (db.Cipher, error) { return v, nil })
+		}
+		return store
+	}
+
+	v := New([keySize]byte{7})
+	store := open(v)
+	session, err := store.GetOrCreateSession("secret", "qwen", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddSessionMessage(session.ID, "user", "the launch codes"); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := store.GetSessionMessages(session.ID)
+	if err != nil || len(messages) != 1 || messages[0].Content != "the launch codes" {
+		t.Fatalf("GetSessionMessages = %+v, %v", messages, err)
+	}
+
+	if _, err := open(nil).GetSessionMessages(session.ID); err == nil {
+		t.Error("read a sealed message without a key")
+	}
+	if _, err := open(New([keySize]byte{8})).GetSessionMessages(session.ID); err == nil {
+		t.Error("read a sealed message with the wrong key")
+	}
+}
+
+func TestKeychainKey(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Encryption.KeySource = "keychain"
+	cfg.Secrets = config.SecretsConfig{Backend: "file", FilePath: filepath.Join(t.TempDir(), "secrets.json")}
+	store := testStore(t)
+
+	first, err := Unlock(cfg, store)
+	if err != nil {
+		t.Fatalf("Unlock with no key yet: %v", err)
+	}
+	again, err := Unlock(cfg, store)
+	if err != nil {
+		t.Fatalf("Unlock with the stored key: %v", err)
+	}
+	if first.key != again.key {
+		t.Error("the second Unlock used a different key")
+	}
+
+	// With data sealed, a lost key is an error, not a fresh key
+	if err := secrets.New(cfg).Delete(secrets.VaultKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unlock(cfg, store); err == nil || !strings.Contains(err.Error(), "encryption key is missing") {
+		t.Errorf("Unlock with the key gone = %v, want a missing key error", err)
+	}
+	if stored, _ := secrets.New(cfg).Get(secrets.VaultKey); stored != "" {
+		t.Error("Unlock stored a new key over the lost one")
+	}
+}
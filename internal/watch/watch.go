@@ -0,0 +1,127 @@
+// Package watch detects files that change under a set of directories by
+// polling their modification times and sizes, so callers such as an index
+// can refresh only what changed.
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change is a file that was added, modified or removed since the last scan
+type Change struct {
+	Path    string
+	Removed bool
+}
+
+// State is what a scan records about a file
+type State struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// Watcher tracks the files under its roots between scans
+type Watcher struct {
+	roots   []string
+	include func(path string) bool
+	files   map[string]State
+}
+
+// New creates a watcher for the files under roots. include, if not nil,
+// selects which files are watched; hidden files and directories are always
+// skipped. Roots may also be single files.
+func New(roots []string, include func(path string) bool) *Watcher {
+	return &Watcher{roots: roots, include: include, files: make(map[string]State)}
+}
+
+// Seed sets the known state of files, e.g. from when they were last
+// indexed, so the first scan reports only files that differ from it
+func (w *Watcher) Seed(files map[string]State) {
+	for path, state := range files {
+		w.files[path] = state
+	}
+}
+
+// Scan walks the roots and returns the files that changed since the
+// previous scan or seed, sorted by path
+func (w *Watcher) Scan() ([]Change, error) {
+	current := make(map[string]State)
+	for _, root := range w.roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Files can disappear mid-walk; they are reported as removed
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !d.Type().IsRegular() {
+				return nil
+			}
+			if w.include != nil && !w.include(path) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			current[path] = State{ModTime: info.ModTime(), Size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []Change
+	for path, state := range current {
+		if old, ok := w.files[path]; !ok || !old.ModTime.Equal(state.ModTime) || old.Size != state.Size {
+			changes = append(changes, Change{Path: path})
+		}
+	}
+	for path := range w.files {
+		if _, ok := current[path]; !ok {
+			changes = append(changes, Change{Path: path, Removed: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	w.files = current
+	return changes, nil
+}
+
+// Run scans every interval and passes each non-empty set of changes to
+// handle until stop is closed or handle returns an error
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}, handle func([]Change) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := w.Scan()
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			if err := handle(changes); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
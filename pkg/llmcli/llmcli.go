@@ -0,0 +1,178 @@
+// Package llmcli lets Go programs manage and run local models the way the
+// llm-cli command does, without shelling out to it. It shares llm-cli's
+// config file, database and model directory, so models pulled with the
+// command are available here and the other way around.
+//
+//	client, err := llmcli.New(llmcli.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	reply, err := client.Chat(ctx, "qwen", []llmcli.Message{{Role: "user", Content: "Hello"}}, llmcli.CompleteOptions{})
+//
+// Methods return values instead of printing. Status messages and progress,
+// such as a download's, go to Options.Output.
+package llmcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/garyblankenship/llmcli/internal/chattmpl"
+	"github.com/garyblankenship/llmcli/internal/config"
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/server"
+	"github.com/garyblankenship/llmcli/internal/ui"
+)
+
+// Options controls a Client
+type Options struct {
+	// Backend selects a backend profile from the config file, as the
+	// --backend flag does; empty uses the config file's choice
+	Backend string
+
+	// Private stores no history, usage or logs, as the --private flag does
+	Private bool
+
+	// Output receives status messages and progress. nil discards them.
+	// It is shared by every Client in the process.
+	Output io.Writer
+}
+
+// Client manages models and their servers and runs completions
+type Client struct {
+	store *db.Store
+	cfg   *config.Config
+
+	Models  *ModelManager
+	Servers *ServerManager
+}
+
+// New opens llm-cli's config and database
+func New(opts Options) (*Client, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	if opts.Private {
+		cfg.DisablePersistence()
+	}
+	if opts.Backend != "" {
+		if err := cfg.UseBackend(opts.Backend); err != nil {
+			return nil, err
+		}
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+	ui.SetOutput(output)
+
+	store, err := db.New(cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("initializing database: %w", err)
+	}
+	c := &Client{store: store, cfg: cfg}
+	c.Models = &ModelManager{c}
+	c.Servers = &ServerManager{c}
+	return c, nil
+}
+
+// Close closes the database. Servers keep running until they are stopped
+// or their keep-alive timeout passes.
+func (c *Client) Close() error {
+	return c.store.Close()
+}
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string // "system", "user" or "assistant"
+	Content string
+}
+
+// CompleteOptions controls a completion
+type CompleteOptions struct {
+	MaxTokens int      // overrides the model's n-predict setting when positive
+	Stop      []string // stop sequences besides the model's own
+}
+
+// Completion is a model's output and what it cost
+type Completion struct {
+	Text            string // with any <think> reasoning removed
+	Truncated       bool   // stopped at the token limit
+	PromptTokens    int    // 0 if the server didn't report it
+	PredictedTokens int
+	TokensPerSecond float64
+}
+
+// Complete continues a raw prompt with a model, starting its server if needed
+func (c *Client) Complete(ctx context.Context, slug, prompt string, opts CompleteOptions) (*Completion, error) {
+	cfg, err := c.modelConfig(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return complete(ctx, cfg, prompt, opts)
+}
+
+// Chat returns a model's reply to a conversation, rendered in the model's
+// own chat format, starting its server if needed
+func (c *Client) Chat(ctx context.Context, slug string, messages []Message, opts CompleteOptions) (*Completion, error) {
+	cfg, err := c.modelConfig(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	turns := make([]chattmpl.Message, len(messages))
+	for i, m := range messages {
+		turns[i] = chattmpl.Message{Role: m.Role, Content: m.Content}
+	}
+	prompt, stops := server.ChatPrompt(c.store, cfg, slug, turns)
+	opts.Stop = append(append([]string{}, opts.Stop...), stops...)
+	return complete(ctx, cfg, prompt, opts)
+}
+
+// Embed returns the embeddings of texts from an embedding model, starting
+// its server if needed
+func (c *Client) Embed(ctx context.Context, slug string, texts []string) ([][]float64, error) {
+	cfg, err := c.modelConfig(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return server.EmbedBatchesContext(ctx, cfg, texts, 32)
+}
+
+// Tokenize returns the token ids of text in a model's vocabulary, starting
+// its server if needed
+func (c *Client) Tokenize(ctx context.Context, slug, text string) ([]int, error) {
+	cfg, err := c.modelConfig(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return server.TokenizeContext(ctx, cfg, text)
+}
+
+// modelConfig makes sure the model's server is running and returns the
+// config its requests use
+func (c *Client) modelConfig(ctx context.Context, slug string) (*config.Config, error) {
+	if err := server.EnsureServerRunningContext(ctx, c.store, c.cfg, slug); err != nil {
+		return nil, err
+	}
+	return server.ModelConfig(c.store, c.cfg, slug)
+}
+
+// complete sends a completion request and converts its result
+func complete(ctx context.Context, cfg *config.Config, prompt string, opts CompleteOptions) (*Completion, error) {
+	result, err := server.CompleteContext(ctx, cfg, prompt, opts.MaxTokens, opts.Stop)
+	if err != nil {
+		return nil, err
+	}
+	return &Completion{
+		Text:            result.Text,
+		Truncated:       result.Truncated,
+		PromptTokens:    result.PromptTokens,
+		PredictedTokens: result.PredictedTokens,
+		TokensPerSecond: result.TokensPerSecond,
+	}, nil
+}
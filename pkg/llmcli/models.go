@@ -0,0 +1,134 @@
+package llmcli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/db"
+	"github.com/garyblankenship/llmcli/internal/model"
+)
+
+// Model is an installed model
+type Model struct {
+	Slug       string // name the model is used by
+	ModelID    string // Hugging Face repository, e.g. Qwen/Qwen2.5-7B-Instruct-GGUF
+	FileName   string
+	Path       string
+	Size       string // e.g. "4368M"
+	Quant      string // quantization, e.g. Q4_K_M; empty if unknown
+	Revision   string // Hugging Face commit the file was downloaded from; empty if unknown
+	Quarantine string // why automatic restarts are refused; empty when not quarantined
+	CreatedAt  time.Time
+	LastUsed   time.Time // zero if never used
+}
+
+// ModelManager installs, lists, configures and removes models
+type ModelManager struct {
+	c *Client
+}
+
+// PullOptions controls a download
+type PullOptions struct {
+	Quant string // quantization to download, e.g. Q4_K_M; the default choice when empty
+}
+
+// List returns the installed models
+func (m *ModelManager) List(ctx context.Context) ([]Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	models, err := m.c.store.GetAllModels()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Model, len(models))
+	for i := range models {
+		list[i] = newModel(&models[i])
+	}
+	return list, nil
+}
+
+// Get returns an installed model by slug
+func (m *ModelManager) Get(ctx context.Context, slug string) (*Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	installed, err := m.c.store.GetModelBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	result := newModel(installed)
+	return &result, nil
+}
+
+// Pull downloads a GGUF model from Hugging Face and installs it, or
+// returns it if it is installed already. Cancelling ctx stops the download
+// and removes the partial file.
+func (m *ModelManager) Pull(ctx context.Context, modelID string, opts PullOptions) (*Model, error) {
+	installed, err := model.Download(ctx, m.c.store, m.c.cfg, modelID, model.PullOptions{Quant: opts.Quant, Yes: true})
+	if err != nil {
+		return nil, err
+	}
+	if installed == nil {
+		return nil, fmt.Errorf("the files of %s are already downloaded but not installed; remove them to download them again", modelID)
+	}
+	result := newModel(installed)
+	return &result, nil
+}
+
+// Remove deletes a model's files and forgets it
+func (m *ModelManager) Remove(ctx context.Context, slug string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return model.Remove(m.c.store, m.c.cfg, slug)
+}
+
+// Settings returns a model's stored settings, such as ctx-size or
+// temperature, keyed by name
+func (m *ModelManager) Settings(ctx context.Context, slug string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := m.c.store.GetModelBySlug(slug); err != nil {
+		return nil, err
+	}
+	return m.c.store.GetModelSettings(slug)
+}
+
+// Set stores a model setting, with the same names, aliases and checks as
+// 'llm-cli set'. Server settings apply the next time its server starts.
+func (m *ModelManager) Set(ctx context.Context, slug, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return model.SetSetting(m.c.store, m.c.cfg, slug, key, value)
+}
+
+// Unset removes a model setting so the default applies again
+func (m *ModelManager) Unset(ctx context.Context, slug, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return model.UnsetSetting(m.c.store, slug, key)
+}
+
+// newModel converts a database model
+func newModel(m *db.Model) Model {
+	result := Model{
+		Slug:       m.Slug,
+		ModelID:    m.ModelID,
+		FileName:   m.FileName,
+		Path:       m.FilePath,
+		Size:       m.FileSize,
+		Quant:      m.Quant,
+		Revision:   m.Revision,
+		Quarantine: m.Quarantine,
+		CreatedAt:  m.CreatedAt,
+	}
+	if m.LastUsed.Valid {
+		result.LastUsed = m.LastUsed.Time
+	}
+	return result
+}
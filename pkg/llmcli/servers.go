@@ -0,0 +1,83 @@
+package llmcli
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyblankenship/llmcli/internal/server"
+)
+
+// Server is a running llama-server started by llm-cli
+type Server struct {
+	Slug      string
+	PID       int // 0 when the daemon or a remote backend runs it
+	URL       string
+	StartedAt time.Time // zero when unknown
+}
+
+// ServerManager starts, stops and lists model servers
+type ServerManager struct {
+	c *Client
+}
+
+// Start makes sure a model's server is running, starting it with the
+// model's settings if it isn't, and returns it once it is ready
+func (s *ServerManager) Start(ctx context.Context, slug string) (*Server, error) {
+	cfg, err := s.c.modelConfig(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	srv := &Server{Slug: slug, URL: cfg.APIURL}
+	running, err := server.RunningServers(s.c.store)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range running {
+		if r.Slug == slug {
+			srv.PID, srv.StartedAt = r.PID, r.StartedAt
+		}
+	}
+	return srv, nil
+}
+
+// Stop stops a model's server, if it is running, and waits for it to exit
+func (s *ServerManager) Stop(ctx context.Context, slug string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	installed, err := s.c.store.GetModelBySlug(slug)
+	if err != nil {
+		return err
+	}
+	return server.StopServer(s.c.store, s.c.cfg, installed.FilePath)
+}
+
+// List returns the running servers llm-cli started itself
+func (s *ServerManager) List(ctx context.Context) ([]Server, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	running, err := server.RunningServers(s.c.store)
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]Server, 0, len(running))
+	for _, r := range running {
+		srv := Server{Slug: r.Slug, PID: r.PID, StartedAt: r.StartedAt}
+		if cfg, err := server.ModelConfig(s.c.store, s.c.cfg, r.Slug); err == nil {
+			srv.URL = cfg.APIURL
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// Health returns nil if a model's server is running and answers its
+// health check, or why not. It never starts the server.
+func (s *ServerManager) Health(ctx context.Context, slug string) error {
+	cfg, err := server.ModelConfig(s.c.store, s.c.cfg, slug)
+	if err != nil {
+		return err
+	}
+	return server.HealthContext(ctx, cfg)
+}